@@ -0,0 +1,142 @@
+// Package audit writes an append-only log of queue item operations.
+//
+// Every record is a single line:
+//
+//	<RFC3339 time> <event> queue=<queue> conn=<connection id> item=<message id>
+//
+// Runtime configuration changes are recorded as:
+//
+//	<RFC3339 time> config key=<setting> value=<value> conn=<connection id>
+//
+// Log file is rotated when it grows over a configured size,
+// rotated files are named <path>.1 (most recent) to <path>.<max files>.
+package audit
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// Audit events
+const (
+	EventEnqueue = "enqueue"
+	EventDequeue = "dequeue"
+	EventOpen    = "open"
+	EventClose   = "close"
+	EventAbort   = "abort"
+	EventDrain   = "drain"
+	EventConfig  = "config"
+)
+
+var errClosed = errors.New("audit log is closed")
+
+// Log represents an audit log file, nil Log discards all records
+type Log struct {
+	path     string
+	maxSize  int64
+	maxFiles int
+	file     *os.File
+	size     int64
+	sync.Mutex
+}
+
+// Open opens or creates an audit log file
+func Open(path string, maxSize int64, maxFiles int) (*Log, error) {
+	l := &Log{path: path, maxSize: maxSize, maxFiles: maxFiles}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Record appends an event record to the log
+func (l *Log) Record(event string, queue string, conn uint64, item string) error {
+	if l == nil {
+		return nil
+	}
+	return l.write(fmt.Sprintf("%s %s queue=%s conn=%d item=%s\n",
+		time.Now().UTC().Format(time.RFC3339Nano), event, queue, conn, item))
+}
+
+// RecordConfig appends a record of a runtime configuration change
+func (l *Log) RecordConfig(key string, value string, conn uint64) error {
+	if l == nil {
+		return nil
+	}
+	return l.write(fmt.Sprintf("%s %s key=%s value=%s conn=%d\n",
+		time.Now().UTC().Format(time.RFC3339Nano), EventConfig, key, value, conn))
+}
+
+func (l *Log) write(line string) error {
+	l.Lock()
+	defer l.Unlock()
+	if l.file == nil {
+		return errClosed
+	}
+	if l.maxSize > 0 && l.size+int64(len(line)) > l.maxSize && l.size > 0 {
+		if err := l.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := l.file.WriteString(line)
+	l.size += int64(n)
+	return err
+}
+
+// Close closes the log file
+func (l *Log) Close() error {
+	if l == nil {
+		return nil
+	}
+	l.Lock()
+	defer l.Unlock()
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
+
+func (l *Log) open() error {
+	f, err := os.OpenFile(l.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	l.file = f
+	l.size = info.Size()
+	return nil
+}
+
+// rotate shifts rotated files by one and starts a new log file,
+// the oldest file is removed once maxFiles is reached
+func (l *Log) rotate() error {
+	if err := l.file.Close(); err != nil {
+		return err
+	}
+	l.file = nil
+	if l.maxFiles > 0 {
+		os.Remove(l.rotated(l.maxFiles))
+		for i := l.maxFiles - 1; i > 0; i-- {
+			os.Rename(l.rotated(i), l.rotated(i+1))
+		}
+		if err := os.Rename(l.path, l.rotated(1)); err != nil {
+			return err
+		}
+	} else if err := os.Remove(l.path); err != nil {
+		return err
+	}
+	return l.open()
+}
+
+func (l *Log) rotated(i int) string {
+	return fmt.Sprintf("%s.%d", l.path, i)
+}
@@ -0,0 +1,68 @@
+package audit
+
+import (
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var dir = "./test_data"
+
+func TestMain(m *testing.M) {
+	os.MkdirAll(dir, 0777)
+	result := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(result)
+}
+
+func Test_Record(t *testing.T) {
+	path := dir + "/audit.log"
+	defer os.Remove(path)
+
+	l, err := Open(path, 0, 0)
+	assert.Nil(t, err)
+	assert.Nil(t, l.Record(EventEnqueue, "work", 1, "10"))
+	assert.Nil(t, l.Record(EventOpen, "work", 2, "10"))
+	assert.Nil(t, l.RecordConfig("read_timeout", "30s", 3))
+	assert.Nil(t, l.Close())
+	assert.NotNil(t, l.Record(EventClose, "work", 2, "10"))
+
+	data, _ := ioutil.ReadFile(path)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	assert.Equal(t, 3, len(lines))
+	assert.True(t, strings.HasSuffix(lines[0], " enqueue queue=work conn=1 item=10"))
+	assert.True(t, strings.HasSuffix(lines[1], " open queue=work conn=2 item=10"))
+	assert.True(t, strings.HasSuffix(lines[2], " config key=read_timeout value=30s conn=3"))
+
+	var nilLog *Log
+	assert.Nil(t, nilLog.Record(EventEnqueue, "work", 1, "1"))
+	assert.Nil(t, nilLog.RecordConfig("read_timeout", "30s", 1))
+	assert.Nil(t, nilLog.Close())
+}
+
+func Test_Rotate(t *testing.T) {
+	path := dir + "/rotate.log"
+
+	l, err := Open(path, 100, 2)
+	assert.Nil(t, err)
+	for i := 0; i < 10; i++ {
+		assert.Nil(t, l.Record(EventDequeue, "work", 1, strconv.Itoa(i)))
+	}
+	l.Close()
+
+	for _, name := range []string{path, path + ".1", path + ".2"} {
+		info, err := os.Stat(name)
+		assert.Nil(t, err, name)
+		assert.True(t, info.Size() <= 100, name)
+	}
+	_, err = os.Stat(path + ".3")
+	assert.True(t, os.IsNotExist(err))
+
+	// Most recent record stays in the current file
+	data, _ := ioutil.ReadFile(path)
+	assert.Contains(t, string(data), "item=9\n")
+}
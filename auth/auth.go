@@ -0,0 +1,124 @@
+// Package auth authenticates client sessions.
+//
+// A Provider checks credentials a client sends with AUTH command
+// or a verified TLS client certificate and returns an identity:
+//
+//	AUTH <token>
+//	AUTH <user> <password>
+//
+// Built-in providers check static tokens, htpasswd files, LDAP simple
+// binds and client certificates. Other identity systems are plugged in
+// with Register and configured by their type, settings of a provider
+// section are passed to its factory:
+//
+//	auth.Register("sso", func(cfg *config.AuthProviderConfig) (auth.Provider, error) {
+//		return newSSO(cfg.Options["endpoint"])
+//	})
+package auth
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/bogdanovich/siberite/config"
+)
+
+// ErrInvalidCredentials is returned by providers for credentials they
+// don't accept, the next provider is tried then
+var ErrInvalidCredentials = errors.New("invalid credentials")
+
+// Identity represents an authenticated client
+type Identity struct {
+	// Name is a user name, a token owner or a certificate common name
+	Name string
+	// Provider is a type of the provider that authenticated the client
+	Provider string
+}
+
+// Credentials are sent by a client
+type Credentials struct {
+	// User is empty for tokens
+	User string
+	// Password is a password or a token
+	Password string
+	// Certificates are verified TLS client certificates, leaf first
+	Certificates []*x509.Certificate
+}
+
+// Provider checks client credentials
+type Provider interface {
+	Authenticate(creds Credentials) (*Identity, error)
+}
+
+// Factory creates a provider from its configuration section
+type Factory func(cfg *config.AuthProviderConfig) (Provider, error)
+
+var (
+	factories = map[string]Factory{
+		config.AuthToken:    newTokenProvider,
+		config.AuthHtpasswd: newHtpasswdProvider,
+		config.AuthLDAP:     newLDAPProvider,
+		config.AuthMTLS:     newMTLSProvider,
+	}
+	factoriesLock sync.RWMutex
+)
+
+// Register adds a provider type, it must be called before
+// the server starts, e.g. from an init function
+func Register(kind string, factory Factory) {
+	factoriesLock.Lock()
+	defer factoriesLock.Unlock()
+	factories[kind] = factory
+}
+
+// New creates a provider trying configured providers in order,
+// nil configuration disables authentication
+func New(cfg *config.AuthConfig) (Provider, error) {
+	if cfg == nil {
+		return nil, nil
+	}
+	factoriesLock.RLock()
+	defer factoriesLock.RUnlock()
+	var providers chain
+	for _, pc := range cfg.Providers {
+		factory, ok := factories[pc.Type]
+		if !ok {
+			return nil, fmt.Errorf("auth: unknown provider type %q", pc.Type)
+		}
+		p, err := factory(pc)
+		if err != nil {
+			return nil, fmt.Errorf("auth: %s: %s", pc.Type, err.Error())
+		}
+		providers = append(providers, named{p, pc.Type})
+	}
+	return providers, nil
+}
+
+// named sets a provider type of identities
+type named struct {
+	Provider
+	kind string
+}
+
+// chain returns an identity of the first provider accepting credentials,
+// a provider failure is returned unless a later provider accepts them
+type chain []named
+
+func (c chain) Authenticate(creds Credentials) (*Identity, error) {
+	err := ErrInvalidCredentials
+	for _, p := range c {
+		identity, perr := p.Authenticate(creds)
+		if perr == nil {
+			if identity.Provider == "" {
+				identity.Provider = p.kind
+			}
+			return identity, nil
+		}
+		if perr != ErrInvalidCredentials {
+			err = perr
+		}
+	}
+	return nil, err
+}
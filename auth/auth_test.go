@@ -0,0 +1,158 @@
+package auth
+
+import (
+	"bufio"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/bogdanovich/siberite/config"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func Test_Token(t *testing.T) {
+	p, err := New(&config.AuthConfig{Providers: []*config.AuthProviderConfig{
+		{Type: config.AuthToken, Tokens: map[string]string{"s3cret": "ci", "0ther": "ops"}},
+	}})
+	assert.Nil(t, err)
+
+	identity, err := p.Authenticate(Credentials{Password: "s3cret"})
+	assert.Nil(t, err)
+	assert.Equal(t, &Identity{Name: "ci", Provider: config.AuthToken}, identity)
+
+	for _, creds := range []Credentials{{Password: "wrong"}, {Password: ""}, {User: "ci", Password: "s3cret"}} {
+		_, err = p.Authenticate(creds)
+		assert.Equal(t, ErrInvalidCredentials, err)
+	}
+}
+
+func Test_apr1(t *testing.T) {
+	assert.Equal(t, "$apr1$r31....$gnsoqlxyxQQ0Ot5JCwiei.", apr1("secret", "r31...."))
+	assert.Equal(t, "$apr1$abcdefgh$sIQmFnT1CuEXAsyjuXjUX/", apr1("correct horse", "abcdefgh"))
+}
+
+func Test_Htpasswd(t *testing.T) {
+	file, err := ioutil.TempFile("", "htpasswd")
+	assert.Nil(t, err)
+	defer os.Remove(file.Name())
+	// htpasswd -B writes $2y$ hashes
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	assert.Nil(t, err)
+	file.WriteString("# users\nalice:$apr1$r31....$gnsoqlxyxQQ0Ot5JCwiei.\nbob:{SHA}5en6G6MezRroT3XKqkdPOmY/BfQ=\n")
+	file.WriteString("erin:$2y$" + string(hash[4:]) + "\n")
+	file.Close()
+
+	p, err := New(&config.AuthConfig{Providers: []*config.AuthProviderConfig{{Type: config.AuthHtpasswd, File: file.Name()}}})
+	assert.Nil(t, err)
+	for _, user := range []string{"alice", "bob", "erin"} {
+		identity, err := p.Authenticate(Credentials{User: user, Password: "secret"})
+		assert.Nil(t, err)
+		assert.Equal(t, user, identity.Name)
+		_, err = p.Authenticate(Credentials{User: user, Password: "Secret"})
+		assert.Equal(t, ErrInvalidCredentials, err)
+	}
+	_, err = p.Authenticate(Credentials{User: "carol", Password: "secret"})
+	assert.Equal(t, ErrInvalidCredentials, err)
+
+	// The file is read again once modified
+	ioutil.WriteFile(file.Name(), []byte("carol:{SHA}5en6G6MezRroT3XKqkdPOmY/BfQ=\n"), 0600)
+	os.Chtimes(file.Name(), time.Now(), time.Now().Add(time.Minute))
+	_, err = p.Authenticate(Credentials{User: "carol", Password: "secret"})
+	assert.Nil(t, err)
+	_, err = p.Authenticate(Credentials{User: "alice", Password: "secret"})
+	assert.Equal(t, ErrInvalidCredentials, err)
+
+	ioutil.WriteFile(file.Name(), []byte("dave:$6$abcdefgh$ijklmnopqrstuv\n"), 0600)
+	_, err = New(&config.AuthConfig{Providers: []*config.AuthProviderConfig{{Type: config.AuthHtpasswd, File: file.Name()}}})
+	assert.Equal(t, "auth: htpasswd: "+file.Name()+":1: unsupported hash of dave, use htpasswd -B", err.Error())
+}
+
+func Test_LDAP(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			_, message, _ := readBER(bufio.NewReader(conn))
+			_, _, message, _ = nextBER(message)
+			_, request, _, _ := nextBER(message)
+			_, _, request, _ = nextBER(request)
+			_, dn, request, _ := nextBER(request)
+			_, password, _, _ := nextBER(request)
+			code := byte(ldapInvalidCredentials)
+			if string(dn) == "uid=alice,ou=people,dc=example,dc=com" && string(password) == "secret" {
+				code = ldapSuccess
+			}
+			response := berTLV(0x61, append(append(berTLV(0x0a, []byte{code}), berTLV(0x04, nil)...), berTLV(0x04, nil)...))
+			conn.Write(berTLV(0x30, append(berTLV(0x02, []byte{1}), response...)))
+			conn.Close()
+		}
+	}()
+
+	p, err := New(&config.AuthConfig{Providers: []*config.AuthProviderConfig{
+		{Type: config.AuthLDAP, URL: "ldap://" + listener.Addr().String(), BindDN: "uid=%s,ou=people,dc=example,dc=com"},
+	}})
+	assert.Nil(t, err)
+	identity, err := p.Authenticate(Credentials{User: "alice", Password: "secret"})
+	assert.Nil(t, err)
+	assert.Equal(t, &Identity{Name: "alice", Provider: config.AuthLDAP}, identity)
+	for _, creds := range []Credentials{{User: "alice", Password: "wrong"}, {User: "alice"}, {User: "a,dc=com", Password: "secret"}} {
+		_, err = p.Authenticate(creds)
+		assert.Equal(t, ErrInvalidCredentials, err)
+	}
+}
+
+func Test_berTLV(t *testing.T) {
+	value := make([]byte, 300)
+	encoded := berTLV(0x04, value)
+	assert.Equal(t, []byte{0x04, 0x82, 0x01, 0x2c}, encoded[:4])
+	tag, decoded, rest, err := nextBER(append(encoded, 0x05, 0x00))
+	assert.Nil(t, err)
+	assert.Equal(t, byte(0x04), tag)
+	assert.Equal(t, value, decoded)
+	assert.Equal(t, []byte{0x05, 0x00}, rest)
+}
+
+type failingProvider struct{}
+
+func (failingProvider) Authenticate(creds Credentials) (*Identity, error) {
+	return nil, errors.New("directory is unavailable")
+}
+
+func Test_Register(t *testing.T) {
+	Register("failing", func(cfg *config.AuthProviderConfig) (Provider, error) {
+		return failingProvider{}, nil
+	})
+	defer func() {
+		factoriesLock.Lock()
+		delete(factories, "failing")
+		factoriesLock.Unlock()
+	}()
+
+	p, err := New(&config.AuthConfig{Providers: []*config.AuthProviderConfig{
+		{Type: "failing"}, {Type: config.AuthMTLS},
+	}})
+	assert.Nil(t, err)
+
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: "worker-1"}}
+	identity, err := p.Authenticate(Credentials{Certificates: []*x509.Certificate{cert}})
+	assert.Nil(t, err)
+	assert.Equal(t, &Identity{Name: "worker-1", Provider: config.AuthMTLS}, identity)
+
+	// A provider failure is reported unless another provider accepts credentials
+	_, err = p.Authenticate(Credentials{Password: "token"})
+	assert.Equal(t, "directory is unavailable", err.Error())
+
+	_, err = New(&config.AuthConfig{Providers: []*config.AuthProviderConfig{{Type: "unknown"}}})
+	assert.Equal(t, "auth: unknown provider type \"unknown\"", err.Error())
+}
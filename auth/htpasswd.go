@@ -0,0 +1,186 @@
+package auth
+
+import (
+	"bufio"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bogdanovich/siberite/config"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// htpasswdProvider checks passwords of an htpasswd file, bcrypt, {SHA} and $apr1$
+// hashes are supported, the latter two are logged as weak once the file is read.
+// The file is read again once it is modified.
+type htpasswdProvider struct {
+	path    string
+	modTime time.Time
+	hashes  map[string]string
+	sync.Mutex
+}
+
+func newHtpasswdProvider(cfg *config.AuthProviderConfig) (Provider, error) {
+	p := &htpasswdProvider{path: cfg.File}
+	if err := p.reload(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *htpasswdProvider) Authenticate(creds Credentials) (*Identity, error) {
+	if creds.User == "" {
+		return nil, ErrInvalidCredentials
+	}
+	p.Lock()
+	if err := p.reload(); err != nil {
+		p.Unlock()
+		return nil, err
+	}
+	hash, ok := p.hashes[creds.User]
+	p.Unlock()
+	if !ok || !checkHtpasswd(hash, creds.Password) {
+		return nil, ErrInvalidCredentials
+	}
+	return &Identity{Name: creds.User}, nil
+}
+
+// reload reads the file unless it is not modified since it was read
+func (p *htpasswdProvider) reload() error {
+	info, err := os.Stat(p.path)
+	if err != nil {
+		return err
+	}
+	if p.hashes != nil && info.ModTime().Equal(p.modTime) {
+		return nil
+	}
+	file, err := os.Open(p.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	hashes := map[string]string{}
+	scanner := bufio.NewScanner(file)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.SplitN(line, ":", 2)
+		if len(fields) != 2 {
+			return fmt.Errorf("%s:%d: invalid line", p.path, n)
+		}
+		switch {
+		case isBcrypt(fields[1]):
+		case strings.HasPrefix(fields[1], "{SHA}"), strings.HasPrefix(fields[1], apr1Magic):
+			log.Printf("WARNING: %s:%d: %s has a weak hash, use htpasswd -B", p.path, n, fields[0])
+		default:
+			return fmt.Errorf("%s:%d: unsupported hash of %s, use htpasswd -B", p.path, n, fields[0])
+		}
+		hashes[fields[0]] = fields[1]
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	p.hashes, p.modTime = hashes, info.ModTime()
+	return nil
+}
+
+// isBcrypt reports whether a hash is written by htpasswd -B or another bcrypt implementation
+func isBcrypt(hash string) bool {
+	for _, prefix := range []string{"$2y$", "$2a$", "$2b$"} {
+		if strings.HasPrefix(hash, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func checkHtpasswd(hash, password string) bool {
+	if isBcrypt(hash) {
+		return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+	}
+	var expected string
+	if strings.HasPrefix(hash, "{SHA}") {
+		sum := sha1.Sum([]byte(password))
+		expected = "{SHA}" + base64.StdEncoding.EncodeToString(sum[:])
+	} else {
+		salt := strings.SplitN(strings.TrimPrefix(hash, apr1Magic), "$", 2)[0]
+		expected = apr1(password, salt)
+	}
+	return subtle.ConstantTimeCompare([]byte(hash), []byte(expected)) == 1
+}
+
+const (
+	apr1Magic = "$apr1$"
+	itoa64    = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+)
+
+// apr1 returns an Apache MD5 crypt hash of a password
+func apr1(password, salt string) string {
+	if len(salt) > 8 {
+		salt = salt[:8]
+	}
+	pw := []byte(password)
+	alt := md5.Sum([]byte(password + salt + password))
+
+	h := md5.New()
+	h.Write([]byte(password + apr1Magic + salt))
+	for i := len(pw); i > 0; i -= 16 {
+		if i > 16 {
+			h.Write(alt[:])
+		} else {
+			h.Write(alt[:i])
+		}
+	}
+	for i := len(pw); i > 0; i >>= 1 {
+		if i&1 != 0 {
+			h.Write([]byte{0})
+		} else {
+			h.Write(pw[:1])
+		}
+	}
+	sum := h.Sum(nil)
+
+	for i := 0; i < 1000; i++ {
+		h := md5.New()
+		if i&1 != 0 {
+			h.Write(pw)
+		} else {
+			h.Write(sum)
+		}
+		if i%3 != 0 {
+			h.Write([]byte(salt))
+		}
+		if i%7 != 0 {
+			h.Write(pw)
+		}
+		if i&1 != 0 {
+			h.Write(sum)
+		} else {
+			h.Write(pw)
+		}
+		sum = h.Sum(nil)
+	}
+
+	var out []byte
+	encode := func(v uint32, n int) {
+		for ; n > 0; n-- {
+			out = append(out, itoa64[v&0x3f])
+			v >>= 6
+		}
+	}
+	for _, g := range [][3]int{{0, 6, 12}, {1, 7, 13}, {2, 8, 14}, {3, 9, 15}, {4, 10, 5}} {
+		encode(uint32(sum[g[0]])<<16|uint32(sum[g[1]])<<8|uint32(sum[g[2]]), 4)
+	}
+	encode(uint32(sum[11]), 2)
+	return apr1Magic + salt + "$" + string(out)
+}
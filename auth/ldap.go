@@ -0,0 +1,175 @@
+package auth
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/bogdanovich/siberite/config"
+)
+
+// ldapTimeout limits connecting to an LDAP server and a bind
+const ldapTimeout = 5 * time.Second
+
+// LDAP result codes
+const (
+	ldapSuccess            = 0
+	ldapInvalidCredentials = 49
+)
+
+// ldapProvider checks passwords with an LDAP simple bind
+// as a DN the user name is substituted into
+type ldapProvider struct {
+	addr   string
+	tls    bool
+	bindDN string
+}
+
+func newLDAPProvider(cfg *config.AuthProviderConfig) (Provider, error) {
+	u, err := url.Parse(cfg.URL)
+	if err != nil {
+		return nil, err
+	}
+	p := &ldapProvider{addr: u.Host, tls: u.Scheme == "ldaps", bindDN: cfg.BindDN}
+	if u.Port() == "" {
+		p.addr = net.JoinHostPort(u.Hostname(), "389")
+		if p.tls {
+			p.addr = net.JoinHostPort(u.Hostname(), "636")
+		}
+	}
+	return p, nil
+}
+
+func (p *ldapProvider) Authenticate(creds Credentials) (*Identity, error) {
+	// An empty password is an unauthenticated bind most servers accept
+	if creds.User == "" || creds.Password == "" || strings.ContainsAny(creds.User, `,=+<>#;"\`) {
+		return nil, ErrInvalidCredentials
+	}
+	code, err := p.bind(fmt.Sprintf(p.bindDN, creds.User), creds.Password)
+	if err != nil {
+		return nil, fmt.Errorf("ldap %s: %s", p.addr, err.Error())
+	}
+	switch code {
+	case ldapSuccess:
+		return &Identity{Name: creds.User}, nil
+	case ldapInvalidCredentials:
+		return nil, ErrInvalidCredentials
+	}
+	return nil, fmt.Errorf("ldap %s: bind result %d", p.addr, code)
+}
+
+// bind sends a simple bind request and returns its result code
+func (p *ldapProvider) bind(dn, password string) (int, error) {
+	dialer := &net.Dialer{Timeout: ldapTimeout}
+	var conn net.Conn
+	var err error
+	if p.tls {
+		conn, err = tls.DialWithDialer(dialer, "tcp", p.addr, nil)
+	} else {
+		conn, err = dialer.Dial("tcp", p.addr)
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(ldapTimeout))
+
+	// BindRequest ::= [APPLICATION 0] SEQUENCE { version, name, simple [0] }
+	request := berTLV(0x60, append(append(berTLV(0x02, []byte{3}),
+		berTLV(0x04, []byte(dn))...), berTLV(0x80, []byte(password))...))
+	if _, err = conn.Write(berTLV(0x30, append(berTLV(0x02, []byte{1}), request...))); err != nil {
+		return 0, err
+	}
+
+	r := bufio.NewReader(conn)
+	tag, message, err := readBER(r)
+	if err != nil {
+		return 0, err
+	}
+	if tag != 0x30 {
+		return 0, errors.New("invalid response")
+	}
+	// LDAPMessage ::= SEQUENCE { messageID, BindResponse [APPLICATION 1] { resultCode, ... } }
+	_, _, message, err = nextBER(message)
+	if err != nil {
+		return 0, err
+	}
+	tag, response, _, err := nextBER(message)
+	if err != nil || tag != 0x61 {
+		return 0, errors.New("invalid bind response")
+	}
+	tag, result, _, err := nextBER(response)
+	if err != nil || tag != 0x0a || len(result) == 0 {
+		return 0, errors.New("invalid bind response")
+	}
+	code := 0
+	for _, b := range result {
+		code = code<<8 | int(b)
+	}
+	// UnbindRequest ::= [APPLICATION 2] NULL
+	conn.Write(berTLV(0x30, append(berTLV(0x02, []byte{2}), 0x42, 0)))
+	return code, nil
+}
+
+// berTLV encodes a BER element with a definite length
+func berTLV(tag byte, value []byte) []byte {
+	out := []byte{tag}
+	if n := len(value); n < 0x80 {
+		out = append(out, byte(n))
+	} else {
+		var length []byte
+		for ; n > 0; n >>= 8 {
+			length = append([]byte{byte(n)}, length...)
+		}
+		out = append(append(out, 0x80|byte(len(length))), length...)
+	}
+	return append(out, value...)
+}
+
+// berReader reads BER elements of a connection or a message
+type berReader interface {
+	io.Reader
+	io.ByteReader
+}
+
+// readBER reads a BER element with a definite length
+func readBER(r berReader) (byte, []byte, error) {
+	tag, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	b, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	n := int(b)
+	if b&0x80 != 0 {
+		if b&0x7f > 3 {
+			return 0, nil, errors.New("invalid length")
+		}
+		n = 0
+		for i := b & 0x7f; i > 0; i-- {
+			if b, err = r.ReadByte(); err != nil {
+				return 0, nil, err
+			}
+			n = n<<8 | int(b)
+		}
+	}
+	value := make([]byte, n)
+	_, err = io.ReadFull(r, value)
+	return tag, value, err
+}
+
+// nextBER splits the first BER element off data
+func nextBER(data []byte) (byte, []byte, []byte, error) {
+	r := bytes.NewReader(data)
+	tag, value, err := readBER(r)
+	return tag, value, data[len(data)-r.Len():], err
+}
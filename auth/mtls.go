@@ -0,0 +1,18 @@
+package auth
+
+import "github.com/bogdanovich/siberite/config"
+
+// mtlsProvider accepts client certificates verified by the TLS handshake,
+// a common name of the leaf certificate is an identity name
+type mtlsProvider struct{}
+
+func newMTLSProvider(cfg *config.AuthProviderConfig) (Provider, error) {
+	return mtlsProvider{}, nil
+}
+
+func (mtlsProvider) Authenticate(creds Credentials) (*Identity, error) {
+	if len(creds.Certificates) == 0 || creds.Certificates[0].Subject.CommonName == "" {
+		return nil, ErrInvalidCredentials
+	}
+	return &Identity{Name: creds.Certificates[0].Subject.CommonName}, nil
+}
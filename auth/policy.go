@@ -0,0 +1,70 @@
+package auth
+
+import (
+	"sync"
+
+	"github.com/bogdanovich/siberite/config"
+)
+
+// policyCacheSize is a number of decisions cached, the cache
+// is cleared once full, so it is bounded for any workload
+const policyCacheSize = 4096
+
+// Policy decides whether an identity may run a command on a queue,
+// decisions are cached as rules are matched by glob patterns
+type Policy struct {
+	rules []*config.AuthRule
+	cache map[policyKey]bool
+	sync.RWMutex
+}
+
+type policyKey struct {
+	identity, command, queue string
+}
+
+// NewPolicy creates a policy of configured rules, nil if there are
+// no rules, nil Policy allows every command
+func NewPolicy(cfg *config.AuthConfig) *Policy {
+	if cfg == nil || len(cfg.Policy) == 0 {
+		return nil
+	}
+	return &Policy{rules: cfg.Policy, cache: map[policyKey]bool{}}
+}
+
+// Allowed reports whether an identity may run a command, queue
+// is empty for commands without a queue, they are allowed only
+// by rules that don't limit queues
+func (p *Policy) Allowed(identity *Identity, command, queue string) bool {
+	if p == nil {
+		return true
+	}
+	if identity == nil {
+		return false
+	}
+	key := policyKey{identity.Name, command, queue}
+	p.RLock()
+	allowed, ok := p.cache[key]
+	p.RUnlock()
+	if ok {
+		return allowed
+	}
+
+	allowed = p.match(key)
+	p.Lock()
+	if len(p.cache) >= policyCacheSize {
+		p.cache = map[policyKey]bool{}
+	}
+	p.cache[key] = allowed
+	p.Unlock()
+	return allowed
+}
+
+func (p *Policy) match(key policyKey) bool {
+	for _, rule := range p.rules {
+		if config.MatchAny(rule.Identities, key.identity) && config.MatchAny(rule.Commands, key.command) &&
+			(len(rule.Queues) == 0 || key.queue != "" && config.MatchAny(rule.Queues, key.queue)) {
+			return true
+		}
+	}
+	return false
+}
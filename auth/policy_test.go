@@ -0,0 +1,44 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/bogdanovich/siberite/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Policy(t *testing.T) {
+	assert.Nil(t, NewPolicy(&config.AuthConfig{}))
+	assert.True(t, (*Policy)(nil).Allowed(nil, "flush", "work"))
+
+	p := NewPolicy(&config.AuthConfig{Policy: []*config.AuthRule{
+		{Identities: []string{"ci"}, Commands: []string{"set"}, Queues: []string{"builds_*"}},
+		{Identities: []string{"ops", "admin_*"}, Commands: []string{"*"}},
+	}})
+	ci, ops, admin := &Identity{Name: "ci"}, &Identity{Name: "ops"}, &Identity{Name: "admin_eu"}
+
+	assert.True(t, p.Allowed(ci, "set", "builds_linux"))
+	assert.False(t, p.Allowed(ci, "set", "deploys"))
+	assert.False(t, p.Allowed(ci, "get", "builds_linux"))
+	assert.True(t, p.Allowed(ops, "flush", "deploys"))
+	assert.True(t, p.Allowed(admin, "stats", ""))
+	assert.False(t, p.Allowed(nil, "stats", ""))
+	// A command without a queue doesn't match rules limiting queues
+	assert.False(t, p.Allowed(ci, "set", ""))
+
+	// Decisions are cached
+	assert.Equal(t, 6, len(p.cache))
+	assert.False(t, p.Allowed(ci, "set", "deploys"))
+	assert.Equal(t, 6, len(p.cache))
+}
+
+func Test_Policy_CacheLimit(t *testing.T) {
+	p := NewPolicy(&config.AuthConfig{Policy: []*config.AuthRule{
+		{Identities: []string{"*"}, Commands: []string{"get"}},
+	}})
+	identity := &Identity{Name: "worker"}
+	for i := 0; i <= policyCacheSize; i++ {
+		assert.True(t, p.Allowed(identity, "get", string(rune('a'+i%26))+string(rune(i))))
+	}
+	assert.Equal(t, 1, len(p.cache))
+}
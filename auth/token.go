@@ -0,0 +1,33 @@
+package auth
+
+import (
+	"crypto/subtle"
+
+	"github.com/bogdanovich/siberite/config"
+)
+
+// tokenProvider accepts static tokens sent without a user name
+type tokenProvider struct {
+	tokens map[string]string
+}
+
+func newTokenProvider(cfg *config.AuthProviderConfig) (Provider, error) {
+	return &tokenProvider{tokens: cfg.Tokens}, nil
+}
+
+func (p *tokenProvider) Authenticate(creds Credentials) (*Identity, error) {
+	if creds.User != "" || creds.Password == "" {
+		return nil, ErrInvalidCredentials
+	}
+	// Every token is compared, so response time doesn't depend on a match
+	var name string
+	for token, owner := range p.tokens {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(creds.Password)) == 1 {
+			name = owner
+		}
+	}
+	if name == "" {
+		return nil, ErrInvalidCredentials
+	}
+	return &Identity{Name: name}, nil
+}
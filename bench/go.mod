@@ -0,0 +1,5 @@
+// Benchmark tools are a separate module, so their memcache client
+// is not a dependency of the server, run go mod tidy before building
+module github.com/bogdanovich/siberite/bench
+
+go 1.22
@@ -0,0 +1,102 @@
+// Package chaos injects faults into storage operations and client
+// connections, so retry logic of clients can be tested against a real
+// server instead of mocks. Faults are off until Set is called, the
+// server allows it only with "chaos": true in its configuration.
+package chaos
+
+import (
+	"errors"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Injected errors
+var (
+	ErrStorage = errors.New("Injected storage failure")
+	ErrDropped = errors.New("Connection dropped by chaos mode")
+)
+
+// Faults are fault injection settings, zero values inject nothing
+type Faults struct {
+	// Delay is added to every storage operation
+	Delay time.Duration
+	// FailPercent of storage operations fail with ErrStorage
+	FailPercent int
+	// DropPercent of commands drop the client connection
+	DropPercent int
+}
+
+// Enabled reports whether any fault is injected
+func (f Faults) Enabled() bool {
+	return f.Delay > 0 || f.FailPercent > 0 || f.DropPercent > 0
+}
+
+var (
+	current atomic.Value
+	enabled int32
+	failed  uint64
+	dropped uint64
+
+	random     = rand.New(rand.NewSource(time.Now().UnixNano()))
+	randomLock sync.Mutex
+)
+
+// Set replaces fault injection settings, zero Faults turn it off
+func Set(f Faults) {
+	current.Store(f)
+	if f.Enabled() {
+		atomic.StoreInt32(&enabled, 1)
+	} else {
+		atomic.StoreInt32(&enabled, 0)
+	}
+}
+
+// Current returns fault injection settings
+func Current() Faults {
+	f, _ := current.Load().(Faults)
+	return f
+}
+
+// Counts returns numbers of failed storage operations and dropped connections
+func Counts() (uint64, uint64) {
+	return atomic.LoadUint64(&failed), atomic.LoadUint64(&dropped)
+}
+
+// Storage delays a storage operation and fails it at configured rate
+func Storage() error {
+	if atomic.LoadInt32(&enabled) == 0 {
+		return nil
+	}
+	f := Current()
+	if f.Delay > 0 {
+		time.Sleep(f.Delay)
+	}
+	if hit(f.FailPercent) {
+		atomic.AddUint64(&failed, 1)
+		return ErrStorage
+	}
+	return nil
+}
+
+// Drop reports whether a client connection should be dropped
+func Drop() bool {
+	if atomic.LoadInt32(&enabled) == 0 {
+		return false
+	}
+	if hit(Current().DropPercent) {
+		atomic.AddUint64(&dropped, 1)
+		return true
+	}
+	return false
+}
+
+func hit(percent int) bool {
+	if percent <= 0 {
+		return false
+	}
+	randomLock.Lock()
+	defer randomLock.Unlock()
+	return random.Intn(100) < percent
+}
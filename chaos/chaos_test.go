@@ -0,0 +1,31 @@
+package chaos
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Faults(t *testing.T) {
+	defer Set(Faults{})
+	assert.Nil(t, Storage())
+	assert.False(t, Drop())
+
+	Set(Faults{FailPercent: 100, DropPercent: 100})
+	failed, dropped := Counts()
+	assert.Equal(t, ErrStorage, Storage())
+	assert.True(t, Drop())
+	failedAfter, droppedAfter := Counts()
+	assert.Equal(t, failed+1, failedAfter)
+	assert.Equal(t, dropped+1, droppedAfter)
+
+	Set(Faults{Delay: 20 * time.Millisecond})
+	start := time.Now()
+	assert.Nil(t, Storage())
+	assert.True(t, time.Since(start) >= 20*time.Millisecond)
+	assert.False(t, Drop())
+
+	Set(Faults{})
+	assert.False(t, Current().Enabled())
+}
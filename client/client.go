@@ -0,0 +1,438 @@
+// Package client is a Go client of siberite servers.
+//
+// Queues are spread across servers by consistent hashing of queue names.
+// A server that fails is taken out of the ring for a retry interval,
+// its queues are served by the remaining servers meanwhile and move back
+// once it is tried again and answers.
+package client
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bogdanovich/siberite/errcode"
+	"github.com/bogdanovich/siberite/hashring"
+	"github.com/bogdanovich/siberite/protocol"
+)
+
+// Client defaults
+const (
+	DefaultTimeout       = 5 * time.Second
+	DefaultRetryInterval = 5 * time.Second
+	DefaultMaxIdle       = 4
+)
+
+// ErrNoServers is returned when every server is marked down
+var ErrNoServers = errors.New("no siberite servers available")
+
+// ServerError is an error response of a server
+type ServerError string
+
+func (e ServerError) Error() string { return string(e) }
+
+// Code returns an error code, see package errcode
+func (e ServerError) Code() int { return errcode.Code(string(e)) }
+
+// Client represents a set of siberite servers
+type Client struct {
+	// Timeout limits connecting and every command
+	Timeout time.Duration
+	// RetryInterval is a time a failed server stays out of the ring
+	RetryInterval time.Duration
+	// MaxIdle is a number of idle connections kept per server
+	MaxIdle int
+	// User and Password authenticate connections with AUTH command,
+	// Password alone is sent as a token
+	User     string
+	Password string
+	// TLS connects to servers with TLS, e.g. to present a client certificate
+	TLS *tls.Config
+	// ErrorCodes turns on coded error responses for ServerError.Code,
+	// servers older than the errcodes capability close such connections
+	ErrorCodes bool
+	// Timestamps requests enqueue times of reserved items, see Reservation.EnqueuedAt,
+	// servers older than GET /ts reject such requests
+	Timestamps bool
+
+	servers []string
+	ring    *hashring.Ring
+	down    map[string]time.Time
+	idle    map[string][]*conn
+	sync.Mutex
+}
+
+// New creates a client of given host:port servers
+func New(servers ...string) *Client {
+	return &Client{
+		Timeout:       DefaultTimeout,
+		RetryInterval: DefaultRetryInterval,
+		MaxIdle:       DefaultMaxIdle,
+		servers:       servers,
+		ring:          hashring.New(servers, hashring.DefaultReplicas),
+		down:          map[string]time.Time{},
+		idle:          map[string][]*conn{},
+	}
+}
+
+// Server returns a server a queue is currently mapped to
+func (c *Client) Server(queue string) (string, error) {
+	c.Lock()
+	defer c.Unlock()
+	now := time.Now()
+	changed := false
+	for server, until := range c.down {
+		if now.After(until) {
+			delete(c.down, server)
+			changed = true
+		}
+	}
+	if changed {
+		c.rebuild()
+	}
+	// Fanout children are kept on the server of their parent queue,
+	// partitions on the server of their partitioned queue
+	name := strings.SplitN(queue, "+", 2)[0]
+	if strings.Count(name, "#") == 2 {
+		name = name[:strings.LastIndex(name, "#")]
+	}
+	if server := c.ring.Get(name); server != "" {
+		return server, nil
+	}
+	return "", ErrNoServers
+}
+
+// markDown takes a failed server out of the ring for RetryInterval
+func (c *Client) markDown(server string) {
+	c.Lock()
+	defer c.Unlock()
+	c.down[server] = time.Now().Add(c.RetryInterval)
+	for _, cn := range c.idle[server] {
+		cn.Close()
+	}
+	delete(c.idle, server)
+	c.rebuild()
+}
+
+func (c *Client) rebuild() {
+	live := []string{}
+	for _, server := range c.servers {
+		if _, ok := c.down[server]; !ok {
+			live = append(live, server)
+		}
+	}
+	c.ring = hashring.New(live, hashring.DefaultReplicas)
+}
+
+// Set enqueues a value to a queue
+func (c *Client) Set(queue string, value []byte) error {
+	return c.SetMeta(queue, value, nil)
+}
+
+// SetMeta enqueues a value with key=value headers to a queue
+func (c *Client) SetMeta(queue string, value []byte, headers map[string]string) error {
+	return c.do(queue, func(cn *conn) error {
+		if len(headers) == 0 {
+			fmt.Fprintf(cn.rw, "set %s 0 0 %d\r\n", queue, len(value))
+		} else {
+			fmt.Fprintf(cn.rw, "setmeta %s 0 0 %d", queue, len(value))
+			for key, v := range headers {
+				fmt.Fprintf(cn.rw, " %s=%s", key, v)
+			}
+			cn.rw.WriteString("\r\n")
+		}
+		cn.rw.Write(value)
+		cn.rw.WriteString("\r\n")
+		line, err := cn.roundTrip()
+		if err != nil {
+			return err
+		}
+		if line != "STORED" && line != "NOT_STORED" {
+			return fmt.Errorf("unexpected response %q", line)
+		}
+		return nil
+	})
+}
+
+// Get dequeues a value from a queue, nil value means the queue is empty
+func (c *Client) Get(queue string) ([]byte, error) {
+	var value []byte
+	err := c.do(queue, func(cn *conn) (err error) {
+		fmt.Fprintf(cn.rw, "get %s\r\n", queue)
+		value, err = cn.readValue()
+		return err
+	})
+	return value, err
+}
+
+// Peek returns i-th value counting from the queue head without removing it,
+// nil value means the queue has fewer items
+func (c *Client) Peek(queue string, i int) ([]byte, error) {
+	var value []byte
+	err := c.do(queue, func(cn *conn) (err error) {
+		request := protocol.GetRequest{Queue: queue, SubCommand: "peek", Index: uint64(i)}
+		fmt.Fprintf(cn.rw, "get %s\r\n", request.String())
+		value, err = cn.readValue()
+		return err
+	})
+	return value, err
+}
+
+// Ping checks that a server of a queue responds
+func (c *Client) Ping(queue string) error {
+	return c.do(queue, func(cn *conn) error {
+		cn.rw.WriteString("ping\r\n")
+		line, err := cn.roundTrip()
+		if err == nil && line != "PONG" {
+			err = fmt.Errorf("unexpected response %q", line)
+		}
+		return err
+	})
+}
+
+// Reserve opens the next item of a queue, the item stays reserved by
+// the connection until Close confirms or Abort returns it to the queue.
+// Reservation is nil when the queue is empty.
+func (c *Client) Reserve(queue string) (*Reservation, error) {
+	server, err := c.Server(queue)
+	if err != nil {
+		return nil, err
+	}
+	cn, err := c.get(server)
+	if err != nil {
+		return nil, err
+	}
+	request := protocol.GetRequest{Queue: queue, SubCommand: "open", Timestamp: c.Timestamps}
+	fmt.Fprintf(cn.rw, "get %s\r\n", request.String())
+	value, fields, err := cn.readItem()
+	if err != nil {
+		c.release(cn, err)
+		return nil, err
+	}
+	if value == nil {
+		c.release(cn, nil)
+		return nil, nil
+	}
+	r := &Reservation{Value: value, client: c, conn: cn, queue: queue}
+	for _, field := range fields {
+		if strings.HasPrefix(field, "ts=") {
+			if ms, err := strconv.ParseInt(field[3:], 10, 64); err == nil && ms > 0 {
+				r.EnqueuedAt = time.Unix(0, ms*int64(time.Millisecond))
+			}
+		}
+	}
+	return r, nil
+}
+
+// Reservation represents an open item
+type Reservation struct {
+	Value []byte
+	// EnqueuedAt is a time the item was enqueued,
+	// zero if unknown or Client.Timestamps is off
+	EnqueuedAt time.Time
+	client     *Client
+	conn       *conn
+	queue      string
+}
+
+// Close confirms the item
+func (r *Reservation) Close() error {
+	return r.finish(protocol.GetRequest{SubCommand: "close"})
+}
+
+// Abort returns the item to the queue
+func (r *Reservation) Abort() error {
+	return r.finish(protocol.GetRequest{SubCommand: "abort"})
+}
+
+// AbortTail returns the item to the queue tail
+func (r *Reservation) AbortTail() error {
+	return r.finish(protocol.GetRequest{SubCommand: "abort_tail"})
+}
+
+// AbortDelay returns the item to the queue hidden from consumers for a given time
+func (r *Reservation) AbortDelay(delay time.Duration) error {
+	return r.finish(protocol.GetRequest{SubCommand: "abort", Timeout: delay})
+}
+
+func (r *Reservation) finish(request protocol.GetRequest) error {
+	if r.conn == nil {
+		return errors.New("reservation is already finished")
+	}
+	cn := r.conn
+	r.conn = nil
+	request.Queue = r.queue
+	fmt.Fprintf(cn.rw, "get %s\r\n", request.String())
+	_, err := cn.readValue()
+	r.client.release(cn, err)
+	return err
+}
+
+// do runs a command on a connection to the server of a queue
+func (c *Client) do(queue string, command func(*conn) error) error {
+	server, err := c.Server(queue)
+	if err != nil {
+		return err
+	}
+	cn, err := c.get(server)
+	if err != nil {
+		return err
+	}
+	err = command(cn)
+	c.release(cn, err)
+	return err
+}
+
+func (c *Client) get(server string) (*conn, error) {
+	c.Lock()
+	if idle := c.idle[server]; len(idle) > 0 {
+		cn := idle[len(idle)-1]
+		c.idle[server] = idle[:len(idle)-1]
+		c.Unlock()
+		return cn, nil
+	}
+	c.Unlock()
+
+	var nc net.Conn
+	var err error
+	if c.TLS != nil {
+		nc, err = tls.DialWithDialer(&net.Dialer{Timeout: c.Timeout}, "tcp", server, c.TLS)
+	} else {
+		nc, err = net.DialTimeout("tcp", server, c.Timeout)
+	}
+	if err != nil {
+		c.markDown(server)
+		return nil, err
+	}
+	cn := &conn{Conn: nc, server: server, timeout: c.Timeout,
+		rw: bufio.NewReadWriter(bufio.NewReader(nc), bufio.NewWriter(nc))}
+	if c.ErrorCodes {
+		cn.rw.WriteString("errcodes on\r\n")
+		if _, err = cn.roundTrip(); err != nil {
+			nc.Close()
+			c.markDown(server)
+			return nil, err
+		}
+	}
+	if c.Password != "" {
+		if c.User != "" {
+			fmt.Fprintf(cn.rw, "auth %s %s\r\n", c.User, c.Password)
+		} else {
+			fmt.Fprintf(cn.rw, "auth %s\r\n", c.Password)
+		}
+		if _, err = cn.roundTrip(); err != nil {
+			nc.Close()
+			if _, ok := err.(ServerError); !ok {
+				c.markDown(server)
+			}
+			return nil, err
+		}
+	}
+	return cn, nil
+}
+
+// release returns a connection to the pool, network failures mark
+// the server down, a server closes a connection after an error response
+func (c *Client) release(cn *conn, err error) {
+	if err != nil {
+		cn.Close()
+		if _, ok := err.(ServerError); !ok {
+			c.markDown(cn.server)
+		}
+		return
+	}
+	c.Lock()
+	defer c.Unlock()
+	if len(c.idle[cn.server]) >= c.MaxIdle {
+		cn.Close()
+		return
+	}
+	c.idle[cn.server] = append(c.idle[cn.server], cn)
+}
+
+// Close closes idle connections
+func (c *Client) Close() {
+	c.Lock()
+	defer c.Unlock()
+	for server, idle := range c.idle {
+		for _, cn := range idle {
+			cn.Close()
+		}
+		delete(c.idle, server)
+	}
+}
+
+type conn struct {
+	net.Conn
+	server  string
+	timeout time.Duration
+	rw      *bufio.ReadWriter
+}
+
+// roundTrip flushes a command and reads a response line
+func (cn *conn) roundTrip() (string, error) {
+	cn.SetDeadline(time.Now().Add(cn.timeout))
+	if err := cn.rw.Flush(); err != nil {
+		return "", err
+	}
+	return cn.readLine()
+}
+
+func (cn *conn) readLine() (string, error) {
+	line, err := cn.rw.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	line = strings.TrimRight(line, "\r\n")
+	if strings.HasPrefix(line, "ERROR") || strings.HasPrefix(line, "CLIENT_ERROR") ||
+		strings.HasPrefix(line, "SERVER_ERROR") {
+		return line, ServerError(line)
+	}
+	return line, nil
+}
+
+// readValue reads an optional VALUE block followed by END
+func (cn *conn) readValue() ([]byte, error) {
+	value, _, err := cn.readItem()
+	return value, err
+}
+
+// readItem reads an optional VALUE block followed by END,
+// fields of VALUE line are returned along with the value
+func (cn *conn) readItem() ([]byte, []string, error) {
+	line, err := cn.roundTrip()
+	if err != nil {
+		return nil, nil, err
+	}
+	var value []byte
+	var fields []string
+	if strings.HasPrefix(line, "VALUE ") {
+		fields = strings.Fields(line)
+		if len(fields) < 4 {
+			return nil, nil, fmt.Errorf("unexpected response %q", line)
+		}
+		size, err := strconv.Atoi(fields[3])
+		if err != nil {
+			return nil, nil, err
+		}
+		value = make([]byte, size+2)
+		if _, err = io.ReadFull(cn.rw, value); err != nil {
+			return nil, nil, err
+		}
+		value = value[:size]
+		if line, err = cn.readLine(); err != nil {
+			return nil, nil, err
+		}
+	}
+	if line != "END" {
+		return nil, nil, fmt.Errorf("unexpected response %q", line)
+	}
+	return value, fields, nil
+}
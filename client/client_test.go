@@ -0,0 +1,131 @@
+package client
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/bogdanovich/siberite/errcode"
+	"github.com/bogdanovich/siberite/service"
+	"github.com/stretchr/testify/assert"
+)
+
+var dir = "./test_data"
+
+func TestMain(m *testing.M) {
+	result := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(result)
+}
+
+func startServer(t *testing.T, i int) (string, *service.Service) {
+	dataDir := fmt.Sprintf("%s/server%d", dir, i)
+	assert.Nil(t, os.MkdirAll(dataDir, 0777))
+	s := service.New(dataDir)
+	listener, err := net.ListenTCP("tcp", &net.TCPAddr{IP: net.ParseIP("127.0.0.1")})
+	assert.Nil(t, err)
+	go s.Serve(listener)
+	return listener.Addr().String(), s
+}
+
+func Test_Client(t *testing.T) {
+	addr1, s1 := startServer(t, 1)
+	addr2, s2 := startServer(t, 2)
+	defer s2.Stop()
+
+	c := New(addr1, addr2)
+	defer c.Close()
+
+	// Ports are random, so queues are added until both servers are used
+	queues := []string{}
+	servers := map[string]bool{}
+	for i := 0; i < 20 || len(servers) < 2 && i < 1000; i++ {
+		q := "queue" + strconv.Itoa(i)
+		queues = append(queues, q)
+		server, err := c.Server(q)
+		assert.Nil(t, err)
+		servers[server] = true
+	}
+	for _, q := range queues {
+		assert.Nil(t, c.Set(q, []byte("value_"+q)))
+		assert.Nil(t, c.SetMeta(q, []byte("meta_"+q), map[string]string{"k": "v"}))
+	}
+	assert.Equal(t, 2, len(servers), "queues should be spread across servers")
+
+	// Enqueue times are requested with Timestamps only
+	r, err := c.Reserve(queues[0])
+	assert.Nil(t, err)
+	assert.True(t, r.EnqueuedAt.IsZero())
+	assert.Nil(t, r.Abort())
+	c.Timestamps = true
+
+	for _, q := range queues {
+		value, err := c.Peek(q, 1)
+		assert.Nil(t, err)
+		assert.Equal(t, []byte("meta_"+q), value)
+		value, err = c.Peek(q, 2)
+		assert.Nil(t, err)
+		assert.Nil(t, value)
+
+		value, err = c.Get(q)
+		assert.Nil(t, err)
+		assert.Equal(t, []byte("value_"+q), value)
+
+		r, err := c.Reserve(q)
+		assert.Nil(t, err)
+		assert.Equal(t, []byte("meta_"+q), r.Value)
+		assert.WithinDuration(t, time.Now(), r.EnqueuedAt, time.Minute)
+		assert.Nil(t, r.Abort())
+		r, err = c.Reserve(q)
+		assert.Nil(t, err)
+		assert.Nil(t, r.AbortTail())
+		r, err = c.Reserve(q)
+		assert.Nil(t, err)
+		assert.Nil(t, r.AbortDelay(time.Millisecond))
+		time.Sleep(2 * time.Millisecond)
+		r, err = c.Reserve(q)
+		assert.Nil(t, err)
+		assert.Equal(t, []byte("meta_"+q), r.Value)
+		assert.Nil(t, r.Close())
+		assert.NotNil(t, r.Close())
+
+		value, err = c.Get(q)
+		assert.Nil(t, err)
+		assert.Nil(t, value)
+	}
+
+	// Server errors carry codes once they are turned on
+	_, err = c.Get(queues[0] + "/unknown")
+	assert.Equal(t, "ERROR Invalid command", err.Error())
+	assert.Equal(t, errcode.InvalidCommand, err.(ServerError).Code())
+	c.ErrorCodes = true
+	_, err = c.Get(queues[0] + "/unknown")
+	assert.Equal(t, "ERROR 1003 Invalid command", err.Error())
+	assert.Equal(t, errcode.InvalidCommand, err.(ServerError).Code())
+
+	// Queues of a failed server move to the remaining one
+	var moved string
+	for _, q := range queues {
+		if server, _ := c.Server(q); server == addr1 {
+			moved = q
+		}
+	}
+	c.Close()
+	s1.Stop()
+	assert.NotNil(t, c.Set(moved, []byte("1")))
+	server, err := c.Server(moved)
+	assert.Nil(t, err)
+	assert.Equal(t, addr2, server)
+	assert.Nil(t, c.Set(moved, []byte("1")))
+	assert.Nil(t, c.Ping(moved))
+
+	// Failed server is tried again after retry interval
+	c.RetryInterval = 0
+	c.markDown(addr1)
+	time.Sleep(time.Millisecond)
+	server, _ = c.Server(moved)
+	assert.Equal(t, addr1, server)
+}
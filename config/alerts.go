@@ -0,0 +1,73 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// AlertConfig posts queue alerts to webhooks. An alert is sent when
+// its condition starts and when it is resolved, a lasting condition
+// is sent again every Repeat interval if configured
+type AlertConfig struct {
+	// Webhooks are URLs receiving alerts as JSON POST requests
+	Webhooks []string `json:"webhooks"`
+	// High fires when a queue holds at least that many items, zero disables it
+	High uint64 `json:"high"`
+	// Low fires when a queue holds at most that many items, zero disables it
+	Low uint64 `json:"low"`
+	// MaxAge fires when the head item is older than that, e.g. "10m"
+	MaxAge string `json:"max_age"`
+	// Repeat resends a lasting alert, e.g. "1h"
+	Repeat string `json:"repeat"`
+
+	maxAge time.Duration
+	repeat time.Duration
+}
+
+// HeadAge returns max head item age, zero if the alert is disabled
+func (ac *AlertConfig) HeadAge() time.Duration {
+	return ac.maxAge
+}
+
+// RepeatInterval returns an interval of lasting alerts, zero if they are sent once
+func (ac *AlertConfig) RepeatInterval() time.Duration {
+	return ac.repeat
+}
+
+func (ac *AlertConfig) validate() error {
+	if len(ac.Webhooks) == 0 {
+		return errors.New("alerts: no webhooks configured")
+	}
+	for _, webhook := range ac.Webhooks {
+		u, err := url.Parse(webhook)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("alerts: invalid webhook %q", webhook)
+		}
+	}
+	if ac.High > 0 && ac.Low >= ac.High {
+		return errors.New("alerts: low must be less than high")
+	}
+	for _, d := range []struct {
+		name  string
+		value string
+		field *time.Duration
+	}{
+		{"max_age", ac.MaxAge, &ac.maxAge},
+		{"repeat", ac.Repeat, &ac.repeat},
+	} {
+		if d.value == "" {
+			continue
+		}
+		duration, err := ParseDuration(d.value)
+		if err != nil || duration <= 0 {
+			return fmt.Errorf("alerts: invalid %s %q", d.name, d.value)
+		}
+		*d.field = duration
+	}
+	if ac.High == 0 && ac.Low == 0 && ac.maxAge == 0 {
+		return errors.New("alerts: no thresholds configured")
+	}
+	return nil
+}
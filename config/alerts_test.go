@@ -0,0 +1,46 @@
+package config
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_AlertConfig(t *testing.T) {
+	filename := writeConfig(t, `{
+		"queues": {
+			"work": {"alerts": {"webhooks": ["http://127.0.0.1/hook"], "high": 100, "low": 10, "max_age": "5m", "repeat": "1h"}}
+		}
+	}`)
+	defer os.Remove(filename)
+
+	cfg, err := Load(filename)
+	assert.Nil(t, err)
+
+	alerts := cfg.Queue("work").Alerts
+	assert.Equal(t, uint64(100), alerts.High)
+	assert.Equal(t, uint64(10), alerts.Low)
+	assert.Equal(t, 5*time.Minute, alerts.HeadAge())
+	assert.Equal(t, time.Hour, alerts.RepeatInterval())
+	assert.Nil(t, cfg.Queue("other").Alerts)
+}
+
+func Test_AlertConfig_Invalid(t *testing.T) {
+	testCases := map[string]string{
+		`{"queues": {"work": {"alerts": {"high": 100}}}}`:                                           "queue work: alerts: no webhooks configured",
+		`{"queues": {"work": {"alerts": {"webhooks": ["ftp://host"], "high": 100}}}}`:               "queue work: alerts: invalid webhook \"ftp://host\"",
+		`{"queues": {"work": {"alerts": {"webhooks": ["http://host"]}}}}`:                           "queue work: alerts: no thresholds configured",
+		`{"queues": {"work": {"alerts": {"webhooks": ["http://host"], "high": 10, "low": 10}}}}`:    "queue work: alerts: low must be less than high",
+		`{"queues": {"work": {"alerts": {"webhooks": ["http://host"], "max_age": "-1s"}}}}`:         "queue work: alerts: invalid max_age \"-1s\"",
+		`{"queues": {"work": {"alerts": {"webhooks": ["http://host"], "high": 1, "repeat": "x"}}}}`: "queue work: alerts: invalid repeat \"x\"",
+	}
+
+	for content, expected := range testCases {
+		filename := writeConfig(t, content)
+		_, err := Load(filename)
+		os.Remove(filename)
+		assert.Equal(t, expected, err.Error(), content)
+	}
+}
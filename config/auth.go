@@ -0,0 +1,176 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+)
+
+// Built-in authentication provider types, other types
+// are looked up among providers registered by embedders
+const (
+	AuthToken    = "token"
+	AuthHtpasswd = "htpasswd"
+	AuthLDAP     = "ldap"
+	AuthMTLS     = "mtls"
+)
+
+// AuthConfig requires clients to authenticate with AUTH command or a client
+// certificate before other commands, providers are tried in order
+type AuthConfig struct {
+	Providers []*AuthProviderConfig `json:"providers"`
+	// Policy allows a command to an identity matching any rule,
+	// every identity may run every command if it's empty
+	Policy []*AuthRule `json:"policy"`
+	// Tenants enforce quotas on queues of identities by tenant name,
+	// an identity belongs to the first tenant in name order it matches
+	Tenants map[string]*TenantConfig `json:"tenants"`
+	// Admins are identities allowed to change settings with CONFIG SET,
+	// glob patterns, nobody may change them if it's empty
+	Admins []string `json:"admins"`
+}
+
+// AuthRule allows identities to run commands on queues, all items are glob patterns
+type AuthRule struct {
+	Identities []string `json:"identities"`
+	// Commands are lower case command names, e.g. "set" or "*"
+	Commands []string `json:"commands"`
+	// Queues limit commands taking a queue name, any queue if empty
+	Queues []string `json:"queues"`
+}
+
+// AuthProviderConfig represents settings of an authentication provider
+type AuthProviderConfig struct {
+	Type string `json:"type"`
+	// Tokens map static tokens to identity names, token provider
+	Tokens map[string]string `json:"tokens"`
+	// File is a path to an htpasswd file, htpasswd provider
+	File string `json:"file"`
+	// URL is an ldap:// or ldaps:// server address, ldap provider
+	URL string `json:"url"`
+	// BindDN is a DN template a user name is substituted into
+	// for %s, e.g. "uid=%s,ou=people,dc=example,dc=com", ldap provider
+	BindDN string `json:"bind_dn"`
+	// Options are settings of registered providers
+	Options map[string]string `json:"options"`
+}
+
+// TLSConfig makes the server accept TLS connections only
+type TLSConfig struct {
+	// Cert and Key are paths to PEM encoded server certificate and key
+	Cert string `json:"cert"`
+	Key  string `json:"key"`
+	// ClientCA is a path to PEM encoded certificates client certificates
+	// are verified with, clients without a certificate are still accepted
+	ClientCA string `json:"client_ca"`
+}
+
+// PeerConfig sets how the server connects to other servers for
+// replication, bootstrap, shadowing, migration and routing
+type PeerConfig struct {
+	// TLS connects to peers with TLS, CA is a path to PEM encoded
+	// certificates peers are verified with, system roots if empty
+	TLS bool   `json:"tls"`
+	CA  string `json:"ca"`
+	// Cert and Key are paths to a PEM encoded client certificate and key
+	// presented to peers, e.g. to authenticate with mtls provider
+	Cert string `json:"cert"`
+	Key  string `json:"key"`
+	// User and Password authenticate with AUTH command,
+	// Password alone is sent as a token
+	User     string `json:"user"`
+	Password string `json:"password"`
+}
+
+func (pc *PeerConfig) validate() error {
+	if (pc.Cert == "") != (pc.Key == "") {
+		return errors.New("peer: cert and key must be set together")
+	}
+	if !pc.TLS && (pc.CA != "" || pc.Cert != "") {
+		return errors.New("peer: ca and cert require tls")
+	}
+	if pc.User != "" && pc.Password == "" {
+		return errors.New("peer: user requires password")
+	}
+	return nil
+}
+
+func (ac *AuthConfig) validate(tls *TLSConfig) error {
+	if len(ac.Providers) == 0 {
+		return errors.New("auth: no providers configured")
+	}
+	for _, p := range ac.Providers {
+		if err := p.validate(tls); err != nil {
+			return fmt.Errorf("auth: %s", err.Error())
+		}
+	}
+	for i, rule := range ac.Policy {
+		if err := rule.validate(); err != nil {
+			return fmt.Errorf("auth: policy rule %d: %s", i+1, err.Error())
+		}
+	}
+	for name, tenant := range ac.Tenants {
+		if tenant == nil {
+			return fmt.Errorf("auth: tenant %s: identities and queues are required", name)
+		}
+		if err := tenant.validate(); err != nil {
+			return fmt.Errorf("auth: tenant %s: %s", name, err.Error())
+		}
+	}
+	return nil
+}
+
+func (ar *AuthRule) validate() error {
+	if len(ar.Identities) == 0 || len(ar.Commands) == 0 {
+		return errors.New("identities and commands are required")
+	}
+	for _, patterns := range [][]string{ar.Identities, ar.Commands, ar.Queues} {
+		for _, pattern := range patterns {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("invalid pattern %q", pattern)
+			}
+		}
+	}
+	return nil
+}
+
+func (pc *AuthProviderConfig) validate(tls *TLSConfig) error {
+	switch pc.Type {
+	case "":
+		return errors.New("provider type is required")
+	case AuthToken:
+		if len(pc.Tokens) == 0 {
+			return errors.New("token provider requires tokens")
+		}
+		for token, name := range pc.Tokens {
+			if token == "" || name == "" {
+				return errors.New("token provider requires non-empty tokens and names")
+			}
+		}
+	case AuthHtpasswd:
+		if pc.File == "" {
+			return errors.New("htpasswd provider requires file")
+		}
+	case AuthLDAP:
+		u, err := url.Parse(pc.URL)
+		if err != nil || (u.Scheme != "ldap" && u.Scheme != "ldaps") || u.Host == "" {
+			return fmt.Errorf("invalid ldap url %q", pc.URL)
+		}
+		if pc.BindDN == "" {
+			return errors.New("ldap provider requires bind_dn")
+		}
+	case AuthMTLS:
+		if tls == nil || tls.ClientCA == "" {
+			return errors.New("mtls provider requires tls client_ca")
+		}
+	}
+	return nil
+}
+
+func (tc *TLSConfig) validate() error {
+	if tc.Cert == "" || tc.Key == "" {
+		return errors.New("tls: cert and key are required")
+	}
+	return nil
+}
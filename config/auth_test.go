@@ -0,0 +1,84 @@
+package config
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Auth(t *testing.T) {
+	filename := writeConfig(t, `{
+		"tls": {"cert": "server.pem", "key": "server.key", "client_ca": "ca.pem"},
+		"auth": {"providers": [{"type": "mtls"}, {"type": "token", "tokens": {"s3cret": "ci"}}, {"type": "sso", "options": {"realm": "ops"}}],
+			"policy": [{"identities": ["ci"], "commands": ["set"], "queues": ["builds_*"]}]}
+	}`)
+	defer os.Remove(filename)
+
+	cfg, err := Load(filename)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(cfg.Auth.Providers))
+	assert.Equal(t, "ci", cfg.Auth.Providers[1].Tokens["s3cret"])
+	assert.Equal(t, "ops", cfg.Auth.Providers[2].Options["realm"])
+	assert.Equal(t, "ca.pem", cfg.TLS.ClientCA)
+	assert.Equal(t, []string{"builds_*"}, cfg.Auth.Policy[0].Queues)
+}
+
+func Test_Auth_Peer(t *testing.T) {
+	filename := writeConfig(t, `{
+		"peer": {"tls": true, "ca": "ca.pem", "cert": "client.pem", "key": "client.key", "user": "replica", "password": "s3cret"}
+	}`)
+	defer os.Remove(filename)
+
+	cfg, err := Load(filename)
+	assert.Nil(t, err)
+	assert.True(t, cfg.Peer.TLS)
+	assert.Equal(t, "ca.pem", cfg.Peer.CA)
+	assert.Equal(t, "client.key", cfg.Peer.Key)
+	assert.Equal(t, "replica", cfg.Peer.User)
+}
+
+func Test_Auth_Tenants(t *testing.T) {
+	filename := writeConfig(t, `{
+		"auth": {"providers": [{"type": "token", "tokens": {"s3cret": "ci"}}],
+			"tenants": {"builds": {"identities": ["ci"], "queues": ["builds_*"], "max_queues": 10, "max_bytes": 1048576, "max_enqueue_rate": 50}}}
+	}`)
+	defer os.Remove(filename)
+
+	cfg, err := Load(filename)
+	assert.Nil(t, err)
+	tenant := cfg.Auth.Tenants["builds"]
+	assert.Equal(t, []string{"ci"}, tenant.Identities)
+	assert.Equal(t, 10, tenant.MaxQueues)
+	assert.Equal(t, int64(1048576), tenant.MaxBytes)
+	assert.Equal(t, 50.0, tenant.MaxEnqueueRate)
+}
+
+func Test_Auth_Invalid(t *testing.T) {
+	testCases := map[string]string{
+		`{"auth": {}}`:                                                                                           "auth: no providers configured",
+		`{"auth": {"providers": [{}]}}`:                                                                          "auth: provider type is required",
+		`{"auth": {"providers": [{"type": "token"}]}}`:                                                           "auth: token provider requires tokens",
+		`{"auth": {"providers": [{"type": "token", "tokens": {"t": ""}}]}}`:                                      "auth: token provider requires non-empty tokens and names",
+		`{"auth": {"providers": [{"type": "htpasswd"}]}}`:                                                        "auth: htpasswd provider requires file",
+		`{"auth": {"providers": [{"type": "ldap", "url": "http://ldap"}]}}`:                                      "auth: invalid ldap url \"http://ldap\"",
+		`{"auth": {"providers": [{"type": "ldap", "url": "ldap://ldap"}]}}`:                                      "auth: ldap provider requires bind_dn",
+		`{"auth": {"providers": [{"type": "mtls"}]}}`:                                                            "auth: mtls provider requires tls client_ca",
+		`{"auth": {"providers": [{"type": "token", "tokens": {"t": "ci"}}], "policy": [{"commands": ["set"]}]}}`: "auth: policy rule 1: identities and commands are required",
+		`{"auth": {"providers": [{"type": "token", "tokens": {"t": "ci"}}], "policy": [{"identities": ["ci"], "commands": ["set"], "queues": ["["]}]}}`:            "auth: policy rule 1: invalid pattern \"[\"",
+		`{"auth": {"providers": [{"type": "token", "tokens": {"t": "ci"}}], "tenants": {"a": {"identities": ["ci"]}}}}`:                                            "auth: tenant a: identities and queues are required",
+		`{"auth": {"providers": [{"type": "token", "tokens": {"t": "ci"}}], "tenants": {"a": {"identities": ["ci"], "queues": ["a_*"], "max_queues": -1}}}}`:       "auth: tenant a: invalid max_queues -1",
+		`{"auth": {"providers": [{"type": "token", "tokens": {"t": "ci"}}], "tenants": {"a": {"identities": ["ci"], "queues": ["a_*"], "max_enqueue_rate": -1}}}}`: "auth: tenant a: invalid max_enqueue_rate -1",
+		`{"tls": {"cert": "server.pem"}}`:               "tls: cert and key are required",
+		`{"peer": {"tls": true, "cert": "client.pem"}}`: "peer: cert and key must be set together",
+		`{"peer": {"ca": "ca.pem"}}`:                    "peer: ca and cert require tls",
+		`{"peer": {"user": "replica"}}`:                 "peer: user requires password",
+	}
+
+	for content, expected := range testCases {
+		filename := writeConfig(t, content)
+		_, err := Load(filename)
+		os.Remove(filename)
+		assert.Equal(t, expected, err.Error(), content)
+	}
+}
@@ -0,0 +1,56 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// DefaultMaxCompactionDefer limits how long a throttled compaction waits
+const DefaultMaxCompactionDefer = 6 * time.Hour
+
+// CompactionThrottleConfig defers compact policies while recent
+// command latency is high, compactions run once traffic calms down
+type CompactionThrottleConfig struct {
+	// MaxP99 is a p99 latency of recent commands above which
+	// compactions are deferred, e.g. "20ms"
+	MaxP99 string `json:"max_p99"`
+	// MaxDefer runs a deferred compaction anyway after it waited
+	// for a period, 6h by default
+	MaxDefer string `json:"max_defer"`
+	// Commands are commands whose latency is watched, set and setmeta
+	// by default as GET latency includes time waiting for items
+	Commands []string `json:"commands"`
+
+	maxP99   time.Duration
+	maxDefer time.Duration
+}
+
+// Limits returns parsed MaxP99 and MaxDefer
+func (tc *CompactionThrottleConfig) Limits() (maxP99 time.Duration, maxDefer time.Duration) {
+	return tc.maxP99, tc.maxDefer
+}
+
+// Watched returns commands whose latency is watched
+func (tc *CompactionThrottleConfig) Watched() []string {
+	if len(tc.Commands) == 0 {
+		return []string{"set", "setmeta"}
+	}
+	return tc.Commands
+}
+
+func (tc *CompactionThrottleConfig) validate() error {
+	maxP99, err := ParseDuration(tc.MaxP99)
+	if err != nil || maxP99 <= 0 {
+		return fmt.Errorf("compaction_throttle: invalid max_p99 %q", tc.MaxP99)
+	}
+	tc.maxP99 = maxP99
+	tc.maxDefer = DefaultMaxCompactionDefer
+	if tc.MaxDefer != "" {
+		maxDefer, err := ParseDuration(tc.MaxDefer)
+		if err != nil || maxDefer <= 0 {
+			return fmt.Errorf("compaction_throttle: invalid max_defer %q", tc.MaxDefer)
+		}
+		tc.maxDefer = maxDefer
+	}
+	return nil
+}
@@ -0,0 +1,477 @@
+// Package config loads siberite configuration file.
+//
+// Configuration is a JSON document, queue sections are matched
+// by exact queue name first and by glob pattern otherwise:
+//
+//	{
+//	  "audit": {"path": "/var/log/siberite/audit.log", "max_size": 104857600, "max_files": 10},
+//	  "storage": {"write_buffer": 16777216, "bloom_filter_bits": 10},
+//	  "tcp_keepalive": "30s",
+//	  "read_timeout": "30s",
+//	  "write_timeout": "30s",
+//	  "max_connections": 10000,
+//	  "max_open_files": 50000,
+//	  "max_memory": 1073741824,
+//	  "max_item_size": 67108864,
+//	  "resume_grace": "30s",
+//	  "replay_buffer": 10,
+//	  "verify_on_open": true,
+//	  "paranoid_reads": false,
+//	  "disk_usage_interval": "5m",
+//	  "data_fallback": "memory",
+//	  "queue_names": {"chars": "a-zA-Z0-9_.:-", "max_length": 200, "encode": false},
+//	  "compaction_throttle": {"max_p99": "20ms", "max_defer": "6h"},
+//	  "group_commit": {"target_p99": "2ms", "max_window": "5ms", "max_batch": 1000},
+//	  "replication": {"origin": "us_east", "peers": ["10.1.0.5:22133"], "queues": ["events_*"]},
+//	  "shadow": {"url": "http://kafka-rest:8082", "queues": ["events_*"]},
+//	  "kafka": {"url": "http://kafka-rest:8082", "topics": {"events_*": "events"}, "batch": 100},
+//	  "object_store": {"endpoint": "https://s3.us-east-1.amazonaws.com", "bucket": "siberite-archive", "interval": "10m"},
+//	  "offload": {"min_size": 4194304, "path": "/mnt/siberite-blobs"},
+//	  "tls": {"cert": "/etc/siberite/server.pem", "key": "/etc/siberite/server.key", "client_ca": "/etc/siberite/ca.pem"},
+//	  "network": {"read_buffer": 4096, "write_buffer": 65536, "tcp_nodelay": true, "socket_write_buffer": 1048576},
+//	  "auth": {"providers": [{"type": "mtls"}, {"type": "htpasswd", "file": "/etc/siberite/htpasswd"}]},
+//	  "coordination": {"consul": "http://127.0.0.1:8500", "key": "siberite/events/leader", "ttl": "15s"},
+//	  "queues": {
+//	    "ingest_*": {
+//	      "dedup_window": "10m",
+//	      "retention": "48h",
+//	      "object_archive": true,
+//	      "storage": {"compression": "none"},
+//	      "on_disconnect": {"delay": "30s", "max_aborts": 5, "dead_letter": "ingest_dlq"},
+//	      "alerts": {"webhooks": ["https://hooks.example.com/siberite"], "high": 100000, "max_age": "15m"},
+//	      "fanout": {"detach_after": "24h", "drop": true},
+//	      "routes": [{"header": "type=order", "to": ["orders"], "move": true}, {"prefix": "{", "to": ["json"]}],
+//	      "policies": [
+//	        {"action": "expire", "schedule": "every 1h", "max_age": "7d"},
+//	        {"action": "compact", "schedule": "weekly sun 03:00"}
+//	      ]
+//	    }
+//	  }
+//	}
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"path"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Config represents server configuration
+type Config struct {
+	Audit          *AuditConfig            `json:"audit"`
+	DefaultStorage *StorageConfig          `json:"storage"`
+	Queues         map[string]*QueueConfig `json:"queues"`
+	Replication    *ReplicationConfig      `json:"replication"`
+	Shadow         *ShadowConfig           `json:"shadow"`
+	Kafka          *KafkaConfig            `json:"kafka"`
+	ObjectStore    *ObjectStoreConfig      `json:"object_store"`
+	Offload        *OffloadConfig          `json:"offload"`
+	Auth           *AuthConfig             `json:"auth"`
+	TLS            *TLSConfig              `json:"tls"`
+	Peer           *PeerConfig             `json:"peer"`
+	Network        *NetworkConfig          `json:"network"`
+	Coordination   *CoordinationConfig     `json:"coordination"`
+	Router         *RouterConfig           `json:"router"`
+	QueueNames     *QueueNamesConfig       `json:"queue_names"`
+	// TCPKeepAlive is a keepalive period of client connections, "0" disables it
+	TCPKeepAlive string `json:"tcp_keepalive"`
+	// ReadTimeout limits time a client has to send a command payload,
+	// WriteTimeout limits time to write a response, both are disabled by default
+	ReadTimeout  string `json:"read_timeout"`
+	WriteTimeout string `json:"write_timeout"`
+	// DataFallback is used when data directory is not writable at startup,
+	// a path to a secondary data directory or "memory"
+	DataFallback string `json:"data_fallback"`
+	// MaxConnections turns readiness probe false once reached, zero disables the check
+	MaxConnections uint64 `json:"max_connections"`
+	// MaxOpenFiles is a budget of table files kept open by all queues, it is
+	// split between queues unless open_files_limit is set, zero uses a half
+	// of the process open files limit
+	MaxOpenFiles int `json:"max_open_files"`
+	// SlowlogThreshold is a command duration recorded in the slow log, "0" disables it
+	SlowlogThreshold string `json:"slowlog_threshold"`
+	// SlowlogSize is a number of recent slow commands kept
+	SlowlogSize int `json:"slowlog_size"`
+	// CompactionThrottle defers compact policies while command latency is high
+	CompactionThrottle *CompactionThrottleConfig `json:"compaction_throttle"`
+	// GroupCommit batches concurrent enqueues to a queue into one write
+	GroupCommit *GroupCommitConfig `json:"group_commit"`
+	// MaxMemory caps approximate memory used by queues and connections in bytes,
+	// block caches are shrunk first, then writes are rejected, zero disables it
+	MaxMemory int64 `json:"max_memory"`
+	// MaxItemSize caps SET values in bytes, zero allows values up to 2GB
+	MaxItemSize int64 `json:"max_item_size"`
+	// Chaos allows CHAOS command injecting storage failures, delays and
+	// dropped connections, for testing client retry logic only
+	Chaos bool `json:"chaos"`
+	// ResumeGrace keeps items of a disconnected session for a period, e.g. "30s",
+	// so a client reconnecting with RESUME takes them over, zero disables it
+	ResumeGrace string `json:"resume_grace"`
+	// ReplayBuffer is a number of items consumed by each session kept
+	// for REPLAY_LAST, zero disables it
+	ReplayBuffer int `json:"replay_buffer"`
+	// VerifyOnOpen checks item offsets of every queue when it is opened and
+	// renumbers items to close gaps left by an unclean shutdown, see -check
+	VerifyOnOpen bool `json:"verify_on_open"`
+	// ParanoidReads reads every dequeued key back to verify its removal and
+	// checks the next offset is stored, anomalies are logged, see -check
+	ParanoidReads bool `json:"paranoid_reads"`
+	// DiskUsageInterval is how often disk usage of queues is measured
+	// for stats in background, "0" disables it
+	DiskUsageInterval string `json:"disk_usage_interval"`
+
+	keepAlive        time.Duration
+	readTimeout      time.Duration
+	writeTimeout     time.Duration
+	slowlogThreshold time.Duration
+	resumeGrace      time.Duration
+	diskUsage        time.Duration
+	// mu guards settings changed at runtime, see Set
+	mu sync.RWMutex
+}
+
+// MaxReplayBuffer limits items kept by each session for REPLAY_LAST
+const MaxReplayBuffer = 1000
+
+// FallbackMemory keeps queues in memory when data directory is not writable
+const FallbackMemory = "memory"
+
+// Defaults used for settings that are not configured
+const (
+	DefaultKeepAlive        = time.Minute
+	DefaultSlowlogThreshold = 100 * time.Millisecond
+	DefaultSlowlogSize      = 128
+	DefaultDiskUsage        = time.Minute
+)
+
+// AuditConfig represents audit log settings
+type AuditConfig struct {
+	Path string `json:"path"`
+	// MaxSize is a log file size in bytes that triggers rotation,
+	// zero disables rotation
+	MaxSize int64 `json:"max_size"`
+	// MaxFiles is a number of rotated files to keep
+	MaxFiles int `json:"max_files"`
+}
+
+// QueueConfig represents queue level settings
+type QueueConfig struct {
+	Policies []*Policy `json:"policies"`
+	// DedupWindow enables deduplication of items with the same
+	// idempotency key enqueued within the window, e.g. "10m"
+	DedupWindow string `json:"dedup_window"`
+	// Storage overrides server wide leveldb settings,
+	// applied when the queue is opened
+	Storage *StorageConfig `json:"storage"`
+	// OnDisconnect controls items left open by disconnected consumers
+	OnDisconnect *DisconnectPolicy `json:"on_disconnect"`
+	// Alerts posts depth and head age alerts to webhooks
+	Alerts *AlertConfig `json:"alerts"`
+	// Retention keeps consumed items in an archive for a period, e.g. "48h",
+	// so they can be requeued after consumer bugs
+	Retention string `json:"retention"`
+	// Fanout detaches fanout children abandoned by their consumers
+	Fanout *FanoutConfig `json:"fanout"`
+	// ObjectArchive uploads consumed and expired items to object_store
+	ObjectArchive bool `json:"object_archive"`
+	// Routes copy or move enqueued items to other queues by headers or value prefix
+	Routes []*RouteRule `json:"routes"`
+
+	dedupWindow time.Duration
+	retention   time.Duration
+}
+
+// Dedup returns deduplication window, zero when deduplication is disabled
+func (qc *QueueConfig) Dedup() time.Duration {
+	return qc.dedupWindow
+}
+
+// ArchiveRetention returns how long consumed items are archived, zero when archive is disabled
+func (qc *QueueConfig) ArchiveRetention() time.Duration {
+	return qc.retention
+}
+
+// Default returns configuration used when no file is given
+func Default() *Config {
+	return &Config{
+		Queues:           map[string]*QueueConfig{},
+		SlowlogSize:      DefaultSlowlogSize,
+		keepAlive:        DefaultKeepAlive,
+		slowlogThreshold: DefaultSlowlogThreshold,
+		diskUsage:        DefaultDiskUsage,
+	}
+}
+
+// KeepAlive returns keepalive period of client connections, zero if disabled
+func (c *Config) KeepAlive() time.Duration {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.keepAlive
+}
+
+// Timeouts returns command read and write timeouts, zero if disabled
+func (c *Config) Timeouts() (read time.Duration, write time.Duration) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.readTimeout, c.writeTimeout
+}
+
+// Slowlog returns slow log threshold, zero if disabled, and its size
+func (c *Config) Slowlog() (threshold time.Duration, size int) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.slowlogThreshold, c.SlowlogSize
+}
+
+// Resume returns how long items of a disconnected session are kept, zero if disabled
+func (c *Config) Resume() time.Duration {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.resumeGrace
+}
+
+// ItemSize returns the largest value size in bytes, item sizes
+// are 32-bit, so values are limited to 2GB without max_item_size
+func (c *Config) ItemSize() int64 {
+	if c.MaxItemSize > 0 {
+		return c.MaxItemSize
+	}
+	return math.MaxInt32
+}
+
+// DiskUsage returns how often disk usage of queues is measured, zero if disabled
+func (c *Config) DiskUsage() time.Duration {
+	return c.diskUsage
+}
+
+// Load reads and validates a configuration file
+func Load(filename string) (*Config, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	cfg := Default()
+	if err = json.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("error parsing %s: %s", filename, err.Error())
+	}
+	return cfg, cfg.Validate()
+}
+
+// MatchAny reports whether a name matches any of glob patterns
+func MatchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Queue returns settings for a queue, exact names take precedence
+// over glob patterns, patterns are tried in lexical order
+func (c *Config) Queue(name string) *QueueConfig {
+	if qc, ok := c.Queues[name]; ok {
+		return qc
+	}
+	for _, pattern := range c.patterns() {
+		if ok, _ := path.Match(pattern, name); ok {
+			return c.Queues[pattern]
+		}
+	}
+	return &QueueConfig{}
+}
+
+func (c *Config) patterns() []string {
+	patterns := make([]string, 0, len(c.Queues))
+	for pattern := range c.Queues {
+		patterns = append(patterns, pattern)
+	}
+	sort.Strings(patterns)
+	return patterns
+}
+
+// Validate checks settings and prepares them for use,
+// configurations built in code must be validated before use
+func (c *Config) Validate() error {
+	for _, d := range []struct {
+		name  string
+		value string
+		field *time.Duration
+	}{
+		{"tcp_keepalive", c.TCPKeepAlive, &c.keepAlive},
+		{"read_timeout", c.ReadTimeout, &c.readTimeout},
+		{"write_timeout", c.WriteTimeout, &c.writeTimeout},
+		{"slowlog_threshold", c.SlowlogThreshold, &c.slowlogThreshold},
+		{"resume_grace", c.ResumeGrace, &c.resumeGrace},
+		{"disk_usage_interval", c.DiskUsageInterval, &c.diskUsage},
+	} {
+		if d.value == "" {
+			continue
+		}
+		duration, err := ParseDuration(d.value)
+		if err != nil || duration < 0 {
+			return fmt.Errorf("invalid %s %q", d.name, d.value)
+		}
+		*d.field = duration
+	}
+	if c.SlowlogSize < 0 {
+		return fmt.Errorf("invalid slowlog_size %d", c.SlowlogSize)
+	}
+	if c.MaxOpenFiles < 0 {
+		return fmt.Errorf("invalid max_open_files %d", c.MaxOpenFiles)
+	}
+	if c.MaxMemory < 0 {
+		return fmt.Errorf("invalid max_memory %d", c.MaxMemory)
+	}
+	if c.MaxItemSize < 0 || c.MaxItemSize > math.MaxInt32 {
+		return fmt.Errorf("invalid max_item_size %d", c.MaxItemSize)
+	}
+	if c.ReplayBuffer < 0 || c.ReplayBuffer > MaxReplayBuffer {
+		return fmt.Errorf("invalid replay_buffer %d", c.ReplayBuffer)
+	}
+	if c.Audit != nil {
+		if c.Audit.Path == "" {
+			return fmt.Errorf("audit: path is required")
+		}
+		if c.Audit.MaxSize < 0 || c.Audit.MaxFiles < 0 {
+			return fmt.Errorf("audit: invalid rotation settings")
+		}
+	}
+	if c.DefaultStorage != nil {
+		if err := c.DefaultStorage.validate(); err != nil {
+			return err
+		}
+	}
+	if c.Replication != nil {
+		if err := c.Replication.validate(); err != nil {
+			return err
+		}
+	}
+	if c.Shadow != nil {
+		if err := c.Shadow.validate(); err != nil {
+			return err
+		}
+	}
+	if c.Kafka != nil {
+		if err := c.Kafka.validate(); err != nil {
+			return err
+		}
+	}
+	if c.ObjectStore != nil {
+		if err := c.ObjectStore.validate(); err != nil {
+			return err
+		}
+	}
+	if c.Offload != nil {
+		if err := c.Offload.validate(); err != nil {
+			return err
+		}
+	}
+	if c.TLS != nil {
+		if err := c.TLS.validate(); err != nil {
+			return err
+		}
+	}
+	if c.Auth != nil {
+		if err := c.Auth.validate(c.TLS); err != nil {
+			return err
+		}
+	}
+	if c.Peer != nil {
+		if err := c.Peer.validate(); err != nil {
+			return err
+		}
+	}
+	if c.Network != nil {
+		if err := c.Network.validate(); err != nil {
+			return err
+		}
+	}
+	if c.Coordination != nil {
+		if err := c.Coordination.validate(c.Replication); err != nil {
+			return err
+		}
+	}
+	if c.Router != nil {
+		if err := c.Router.validate(); err != nil {
+			return err
+		}
+	}
+	if c.QueueNames != nil {
+		if err := c.QueueNames.validate(); err != nil {
+			return err
+		}
+	}
+	if c.CompactionThrottle != nil {
+		if err := c.CompactionThrottle.validate(); err != nil {
+			return err
+		}
+	}
+	if c.GroupCommit != nil {
+		if err := c.GroupCommit.validate(); err != nil {
+			return err
+		}
+	}
+	for pattern, qc := range c.Queues {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("queue %s: %s", pattern, err.Error())
+		}
+		if qc == nil {
+			c.Queues[pattern] = &QueueConfig{}
+			continue
+		}
+		for _, policy := range qc.Policies {
+			if err := policy.parse(); err != nil {
+				return fmt.Errorf("queue %s: %s", pattern, err.Error())
+			}
+		}
+		if qc.DedupWindow != "" {
+			window, err := ParseDuration(qc.DedupWindow)
+			if err != nil || window <= 0 {
+				return fmt.Errorf("queue %s: invalid dedup_window %q", pattern, qc.DedupWindow)
+			}
+			qc.dedupWindow = window
+		}
+		if qc.Retention != "" {
+			retention, err := ParseDuration(qc.Retention)
+			if err != nil || retention <= 0 {
+				return fmt.Errorf("queue %s: invalid retention %q", pattern, qc.Retention)
+			}
+			qc.retention = retention
+		}
+		if qc.Storage != nil {
+			if err := qc.Storage.validate(); err != nil {
+				return fmt.Errorf("queue %s: %s", pattern, err.Error())
+			}
+		}
+		if qc.OnDisconnect != nil {
+			if err := qc.OnDisconnect.validate(); err != nil {
+				return fmt.Errorf("queue %s: %s", pattern, err.Error())
+			}
+			if qc.OnDisconnect.DeadLetter == pattern {
+				return fmt.Errorf("queue %s: on_disconnect: dead_letter can not be the queue itself", pattern)
+			}
+		}
+		if qc.Alerts != nil {
+			if err := qc.Alerts.validate(); err != nil {
+				return fmt.Errorf("queue %s: %s", pattern, err.Error())
+			}
+		}
+		if qc.Fanout != nil {
+			if err := qc.Fanout.validate(); err != nil {
+				return fmt.Errorf("queue %s: %s", pattern, err.Error())
+			}
+		}
+		for _, rule := range qc.Routes {
+			if err := rule.validate(pattern); err != nil {
+				return fmt.Errorf("queue %s: %s", pattern, err.Error())
+			}
+		}
+	}
+	return nil
+}
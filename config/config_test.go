@@ -0,0 +1,135 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	f, err := ioutil.TempFile("", "siberite_config")
+	assert.Nil(t, err)
+	f.WriteString(content)
+	f.Close()
+	return f.Name()
+}
+
+func Test_Load(t *testing.T) {
+	filename := writeConfig(t, `{
+		"queues": {
+			"work": {"policies": [{"action": "flush", "schedule": "daily 02:00"}]},
+			"ingest_*": {"dedup_window": "10m", "retention": "2d", "policies": [{"action": "expire", "schedule": "every 1h", "max_age": "7d"}]},
+			"empty": null
+		}
+	}`)
+	defer os.Remove(filename)
+
+	cfg, err := Load(filename)
+	assert.Nil(t, err)
+
+	assert.Equal(t, "flush", cfg.Queue("work").Policies[0].Action)
+	assert.Equal(t, "expire", cfg.Queue("ingest_logs").Policies[0].Action)
+	assert.Equal(t, 7*24*time.Hour, cfg.Queue("ingest_logs").Policies[0].Age())
+	assert.Equal(t, 0, len(cfg.Queue("empty").Policies))
+	assert.Equal(t, 0, len(cfg.Queue("other").Policies))
+	assert.Equal(t, 10*time.Minute, cfg.Queue("ingest_logs").Dedup())
+	assert.Equal(t, time.Duration(0), cfg.Queue("work").Dedup())
+	assert.Equal(t, 48*time.Hour, cfg.Queue("ingest_logs").ArchiveRetention())
+	assert.Equal(t, time.Duration(0), cfg.Queue("work").ArchiveRetention())
+	assert.Equal(t, DefaultKeepAlive, cfg.KeepAlive())
+}
+
+func Test_Timeouts(t *testing.T) {
+	read, write := Default().Timeouts()
+	assert.Equal(t, time.Duration(0), read)
+	assert.Equal(t, time.Duration(0), write)
+
+	filename := writeConfig(t, `{"read_timeout": "10s", "write_timeout": "0"}`)
+	defer os.Remove(filename)
+	cfg, err := Load(filename)
+	assert.Nil(t, err)
+	read, write = cfg.Timeouts()
+	assert.Equal(t, 10*time.Second, read)
+	assert.Equal(t, time.Duration(0), write)
+}
+
+func Test_KeepAlive(t *testing.T) {
+	for content, expected := range map[string]time.Duration{
+		`{"tcp_keepalive": "30s"}`: 30 * time.Second,
+		`{"tcp_keepalive": "0"}`:   0,
+	} {
+		filename := writeConfig(t, content)
+		cfg, err := Load(filename)
+		os.Remove(filename)
+		assert.Nil(t, err)
+		assert.Equal(t, expected, cfg.KeepAlive(), content)
+	}
+}
+
+func Test_Slowlog(t *testing.T) {
+	threshold, size := Default().Slowlog()
+	assert.Equal(t, DefaultSlowlogThreshold, threshold)
+	assert.Equal(t, DefaultSlowlogSize, size)
+
+	filename := writeConfig(t, `{"slowlog_threshold": "0", "slowlog_size": 16}`)
+	defer os.Remove(filename)
+	cfg, err := Load(filename)
+	assert.Nil(t, err)
+	threshold, size = cfg.Slowlog()
+	assert.Equal(t, time.Duration(0), threshold)
+	assert.Equal(t, 16, size)
+}
+
+func Test_Fanout(t *testing.T) {
+	filename := writeConfig(t, `{"queues": {"events": {"fanout": {"detach_after": "24h", "drop": true}}}}`)
+	defer os.Remove(filename)
+	cfg, err := Load(filename)
+	assert.Nil(t, err)
+	assert.Equal(t, 24*time.Hour, cfg.Queue("events").Fanout.Idle())
+	assert.True(t, cfg.Queue("events").Fanout.Drop)
+
+	for content, expected := range map[string]string{
+		`{"queues": {"events": {"fanout": {"detach_after": "0"}}}}`: "queue events: fanout: invalid detach_after \"0\"",
+		`{"queues": {"events": {"fanout": {"drop": true}}}}`:        "queue events: fanout: drop requires detach_after",
+	} {
+		filename := writeConfig(t, content)
+		_, err := Load(filename)
+		os.Remove(filename)
+		assert.Equal(t, expected, err.Error(), content)
+	}
+}
+
+func Test_Load_Invalid(t *testing.T) {
+	testCases := map[string]string{
+		`{"queues": {"work": {"policies": [{"action": "drop", "schedule": "daily 02:00"}]}}}`: "queue work: unknown policy action \"drop\"",
+		`{"queues": {"work": {"policies": [{"action": "flush", "schedule": "hourly"}]}}}`:     "queue work: invalid schedule \"hourly\"",
+		`{"queues": {"work": {"policies": [{"action": "expire", "schedule": "every 1h"}]}}}`:  "queue work: invalid max_age \"\"",
+		`{"queues": {"work": {"dedup_window": "soon"}}}`:                                      "queue work: invalid dedup_window \"soon\"",
+		`{"queues": {"[work": {}}}`:                         "queue [work: syntax error in pattern",
+		`{"tcp_keepalive": "-1s"}`:                          "invalid tcp_keepalive \"-1s\"",
+		`{"read_timeout": "soon"}`:                          "invalid read_timeout \"soon\"",
+		`{"audit": {"max_size": 1}}`:                        "audit: path is required",
+		`{"audit": {"path": "audit.log", "max_files": -1}}`: "audit: invalid rotation settings",
+		`{"queues": {"work": {"retention": "0"}}}`:          "queue work: invalid retention \"0\"",
+		`{"slowlog_size": -1}`:                              "invalid slowlog_size -1",
+		`{"queue_names": {"chars": "z-a"}}`:                 "queue_names: invalid chars \"z-a\"",
+		`{"queue_names": {"max_length": -1}}`:               "queue_names: invalid max_length -1",
+		`{"compaction_throttle": {"max_p99": "0"}}`:         "compaction_throttle: invalid max_p99 \"0\"",
+		`{"max_memory": -1}`:                                "invalid max_memory -1",
+		`{"max_item_size": 2147483648}`:                     "invalid max_item_size 2147483648",
+		`{"replay_buffer": 1001}`:                           "invalid replay_buffer 1001",
+	}
+
+	for content, expected := range testCases {
+		filename := writeConfig(t, content)
+		_, err := Load(filename)
+		os.Remove(filename)
+		assert.Equal(t, expected, err.Error(), content)
+	}
+
+	_, err := Load("/nonexistent/siberite.json")
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,46 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// DefaultLeaderTTL is a leader session TTL used when ttl is not configured
+const DefaultLeaderTTL = 15 * time.Second
+
+// CoordinationConfig enables leader election for replicated queues,
+// followers accept writes to replicated queues only from peers
+type CoordinationConfig struct {
+	// Consul is an address of Consul agent HTTP API, e.g. "http://127.0.0.1:8500"
+	Consul string `json:"consul"`
+	// Key is a lock key shared by instances of a replicated queue set
+	Key string `json:"key"`
+	// TTL is a session TTL, a follower takes over within TTL after leader failure
+	TTL string `json:"ttl"`
+
+	ttl time.Duration
+}
+
+// LeaderTTL returns leader session TTL
+func (cc *CoordinationConfig) LeaderTTL() time.Duration {
+	return cc.ttl
+}
+
+func (cc *CoordinationConfig) validate(replication *ReplicationConfig) error {
+	if replication == nil {
+		return errors.New("coordination: replication is not configured")
+	}
+	if cc.Consul == "" || cc.Key == "" {
+		return errors.New("coordination: consul and key are required")
+	}
+	cc.ttl = DefaultLeaderTTL
+	if cc.TTL != "" {
+		ttl, err := ParseDuration(cc.TTL)
+		if err != nil || ttl < 10*time.Second {
+			return fmt.Errorf("coordination: invalid ttl %q, at least 10s is required", cc.TTL)
+		}
+		cc.ttl = ttl
+	}
+	return nil
+}
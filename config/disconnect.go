@@ -0,0 +1,42 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// DisconnectPolicy controls items left open by disconnected consumers,
+// without a policy such items return to the queue head immediately
+type DisconnectPolicy struct {
+	// Delay postpones redelivery of an aborted item, e.g. "30s"
+	Delay string `json:"delay"`
+	// MaxAborts moves an item to DeadLetter queue
+	// once it was aborted by that many disconnects
+	MaxAborts  int    `json:"max_aborts"`
+	DeadLetter string `json:"dead_letter"`
+
+	delay time.Duration
+}
+
+// RedeliveryDelay returns a delay of aborted items, zero for immediate redelivery
+func (dp *DisconnectPolicy) RedeliveryDelay() time.Duration {
+	return dp.delay
+}
+
+func (dp *DisconnectPolicy) validate() error {
+	if dp.Delay != "" {
+		delay, err := ParseDuration(dp.Delay)
+		if err != nil || delay < 0 {
+			return fmt.Errorf("on_disconnect: invalid delay %q", dp.Delay)
+		}
+		dp.delay = delay
+	}
+	if dp.MaxAborts < 0 {
+		return errors.New("on_disconnect: max_aborts can not be negative")
+	}
+	if (dp.MaxAborts > 0) != (dp.DeadLetter != "") {
+		return errors.New("on_disconnect: max_aborts and dead_letter must be set together")
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package config
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_DisconnectPolicy(t *testing.T) {
+	filename := writeConfig(t, `{
+		"queues": {
+			"work": {"on_disconnect": {"delay": "30s", "max_aborts": 3, "dead_letter": "work_dlq"}}
+		}
+	}`)
+	defer os.Remove(filename)
+
+	cfg, err := Load(filename)
+	assert.Nil(t, err)
+
+	policy := cfg.Queue("work").OnDisconnect
+	assert.Equal(t, 30*time.Second, policy.RedeliveryDelay())
+	assert.Equal(t, 3, policy.MaxAborts)
+	assert.Equal(t, "work_dlq", policy.DeadLetter)
+	assert.Nil(t, cfg.Queue("other").OnDisconnect)
+}
+
+func Test_DisconnectPolicy_Invalid(t *testing.T) {
+	testCases := map[string]string{
+		`{"queues": {"work": {"on_disconnect": {"delay": "soon"}}}}`:                        "queue work: on_disconnect: invalid delay \"soon\"",
+		`{"queues": {"work": {"on_disconnect": {"max_aborts": 3}}}}`:                        "queue work: on_disconnect: max_aborts and dead_letter must be set together",
+		`{"queues": {"work": {"on_disconnect": {"dead_letter": "dlq"}}}}`:                   "queue work: on_disconnect: max_aborts and dead_letter must be set together",
+		`{"queues": {"work": {"on_disconnect": {"max_aborts": 3, "dead_letter": "work"}}}}`: "queue work: on_disconnect: dead_letter can not be the queue itself",
+	}
+
+	for content, expected := range testCases {
+		filename := writeConfig(t, content)
+		_, err := Load(filename)
+		os.Remove(filename)
+		assert.Equal(t, expected, err.Error(), content)
+	}
+}
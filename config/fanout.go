@@ -0,0 +1,37 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// FanoutConfig controls fanout children of a queue
+type FanoutConfig struct {
+	// DetachAfter stops copying items to a child that had no GET
+	// for a period, e.g. "24h", the next GET attaches it again
+	DetachAfter string `json:"detach_after"`
+	// Drop deletes a detached child with its items
+	Drop bool `json:"drop"`
+
+	detachAfter time.Duration
+}
+
+// Idle returns a period after which an unread child is detached,
+// zero when children are never detached
+func (fc *FanoutConfig) Idle() time.Duration {
+	return fc.detachAfter
+}
+
+func (fc *FanoutConfig) validate() error {
+	if fc.DetachAfter != "" {
+		idle, err := ParseDuration(fc.DetachAfter)
+		if err != nil || idle <= 0 {
+			return fmt.Errorf("fanout: invalid detach_after %q", fc.DetachAfter)
+		}
+		fc.detachAfter = idle
+	}
+	if fc.Drop && fc.detachAfter == 0 {
+		return fmt.Errorf("fanout: drop requires detach_after")
+	}
+	return nil
+}
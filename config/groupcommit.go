@@ -0,0 +1,54 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// Defaults of group commit settings
+const (
+	DefaultGroupCommitMaxWindow = 5 * time.Millisecond
+	DefaultGroupCommitMaxBatch  = 1000
+)
+
+// GroupCommitConfig makes concurrent enqueues to a queue share leveldb
+// writes, a commit window adapts to load keeping latency under TargetP99
+type GroupCommitConfig struct {
+	// TargetP99 is an enqueue latency the window is kept under, e.g. "2ms"
+	TargetP99 string `json:"target_p99"`
+	// MaxWindow limits time the first enqueue of a batch waits for others
+	MaxWindow string `json:"max_window"`
+	// MaxBatch commits a batch once it has that many items
+	MaxBatch int `json:"max_batch"`
+
+	targetP99 time.Duration
+	maxWindow time.Duration
+}
+
+// Limits returns parsed TargetP99 and MaxWindow
+func (gc *GroupCommitConfig) Limits() (targetP99 time.Duration, maxWindow time.Duration) {
+	return gc.targetP99, gc.maxWindow
+}
+
+func (gc *GroupCommitConfig) validate() error {
+	targetP99, err := ParseDuration(gc.TargetP99)
+	if err != nil || targetP99 <= 0 {
+		return fmt.Errorf("group_commit: invalid target_p99 %q", gc.TargetP99)
+	}
+	gc.targetP99 = targetP99
+	gc.maxWindow = DefaultGroupCommitMaxWindow
+	if gc.MaxWindow != "" {
+		maxWindow, err := ParseDuration(gc.MaxWindow)
+		if err != nil || maxWindow <= 0 {
+			return fmt.Errorf("group_commit: invalid max_window %q", gc.MaxWindow)
+		}
+		gc.maxWindow = maxWindow
+	}
+	if gc.MaxBatch < 0 {
+		return fmt.Errorf("group_commit: invalid max_batch %d", gc.MaxBatch)
+	}
+	if gc.MaxBatch == 0 {
+		gc.MaxBatch = DefaultGroupCommitMaxBatch
+	}
+	return nil
+}
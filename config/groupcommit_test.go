@@ -0,0 +1,36 @@
+package config
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_GroupCommit(t *testing.T) {
+	filename := writeConfig(t, `{"group_commit": {"target_p99": "2ms"}}`)
+	defer os.Remove(filename)
+
+	cfg, err := Load(filename)
+	assert.Nil(t, err)
+	target, maxWindow := cfg.GroupCommit.Limits()
+	assert.Equal(t, 2*time.Millisecond, target)
+	assert.Equal(t, DefaultGroupCommitMaxWindow, maxWindow)
+	assert.Equal(t, DefaultGroupCommitMaxBatch, cfg.GroupCommit.MaxBatch)
+}
+
+func Test_GroupCommit_Invalid(t *testing.T) {
+	testCases := map[string]string{
+		`{"group_commit": {}}`: "group_commit: invalid target_p99 \"\"",
+		`{"group_commit": {"target_p99": "2ms", "max_window": "never"}}`: "group_commit: invalid max_window \"never\"",
+		`{"group_commit": {"target_p99": "2ms", "max_batch": -1}}`:       "group_commit: invalid max_batch -1",
+	}
+
+	for content, expected := range testCases {
+		filename := writeConfig(t, content)
+		_, err := Load(filename)
+		os.Remove(filename)
+		assert.Equal(t, expected, err.Error(), content)
+	}
+}
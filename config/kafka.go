@@ -0,0 +1,125 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"sort"
+)
+
+// DefaultKafkaBatch is a number of items published in one request
+const DefaultKafkaBatch = 100
+
+// KafkaConfig exports items enqueued to selected queues to Kafka topics
+// and imports records of Kafka topics to queues through a Kafka REST proxy
+type KafkaConfig struct {
+	// URL is a base URL of a Kafka REST proxy
+	URL string `json:"url"`
+	// Topics maps queue names or glob patterns to topics
+	Topics map[string]string `json:"topics"`
+	// Batch is a number of items published in one request
+	Batch int `json:"batch"`
+	// Import subscribes to topics and enqueues their records
+	Import *KafkaImportConfig `json:"import"`
+}
+
+// KafkaImportConfig subscribes a consumer group to topics,
+// records are enqueued to queues before their offsets are committed
+type KafkaImportConfig struct {
+	// Group is a Kafka consumer group, e.g. "siberite-edge"
+	Group string `json:"group"`
+	// Queues maps topics to queues their records are enqueued to
+	Queues map[string]string `json:"queues"`
+}
+
+// ImportTopics returns sorted topics records are imported from
+func (ic *KafkaImportConfig) ImportTopics() []string {
+	topics := make([]string, 0, len(ic.Queues))
+	for topic := range ic.Queues {
+		topics = append(topics, topic)
+	}
+	sort.Strings(topics)
+	return topics
+}
+
+func (ic *KafkaImportConfig) validate() error {
+	if ic.Group == "" {
+		return errors.New("kafka: import group is required")
+	}
+	if len(ic.Queues) == 0 {
+		return errors.New("kafka: no import queues configured")
+	}
+	for topic, name := range ic.Queues {
+		if name == "" {
+			return fmt.Errorf("kafka: empty import queue of %s", topic)
+		}
+	}
+	return nil
+}
+
+// Topic returns a topic items of a queue are exported to, empty if none,
+// queues are matched by exact name first and by glob pattern otherwise
+func (kc *KafkaConfig) Topic(name string) string {
+	if kc == nil {
+		return ""
+	}
+	if topic, ok := kc.Topics[name]; ok {
+		return topic
+	}
+	patterns := make([]string, 0, len(kc.Topics))
+	for pattern := range kc.Topics {
+		patterns = append(patterns, pattern)
+	}
+	sort.Strings(patterns)
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return kc.Topics[pattern]
+		}
+	}
+	return ""
+}
+
+// TopicNames returns distinct topics items are exported to
+func (kc *KafkaConfig) TopicNames() []string {
+	seen := map[string]bool{}
+	topics := []string{}
+	for _, topic := range kc.Topics {
+		if !seen[topic] {
+			seen[topic] = true
+			topics = append(topics, topic)
+		}
+	}
+	sort.Strings(topics)
+	return topics
+}
+
+func (kc *KafkaConfig) validate() error {
+	u, err := url.Parse(kc.URL)
+	if kc.URL == "" || err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return fmt.Errorf("kafka: invalid url %q", kc.URL)
+	}
+	if len(kc.Topics) == 0 && kc.Import == nil {
+		return errors.New("kafka: no topics configured")
+	}
+	if kc.Import != nil {
+		if err := kc.Import.validate(); err != nil {
+			return err
+		}
+	}
+	for pattern, topic := range kc.Topics {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("kafka: %s", err.Error())
+		}
+		if topic == "" {
+			return fmt.Errorf("kafka: empty topic of %s", pattern)
+		}
+	}
+	if kc.Batch < 0 {
+		return fmt.Errorf("kafka: invalid batch %d", kc.Batch)
+	}
+	if kc.Batch == 0 {
+		kc.Batch = DefaultKafkaBatch
+	}
+	return nil
+}
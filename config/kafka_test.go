@@ -0,0 +1,50 @@
+package config
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Kafka(t *testing.T) {
+	filename := writeConfig(t, `{"kafka": {"url": "http://kafka-rest:8082",
+		"topics": {"events_*": "events", "events_audit": "audit", "orders": "events"}}}`)
+	defer os.Remove(filename)
+
+	cfg, err := Load(filename)
+	assert.Nil(t, err)
+	assert.Equal(t, DefaultKafkaBatch, cfg.Kafka.Batch)
+	assert.Equal(t, "events", cfg.Kafka.Topic("events_a"))
+	assert.Equal(t, "audit", cfg.Kafka.Topic("events_audit"))
+	assert.Equal(t, "", cfg.Kafka.Topic("work"))
+	assert.Equal(t, []string{"audit", "events"}, cfg.Kafka.TopicNames())
+}
+
+func Test_KafkaImport(t *testing.T) {
+	filename := writeConfig(t, `{"kafka": {"url": "http://kafka-rest:8082",
+		"import": {"group": "edge", "queues": {"orders": "edge_orders", "events": "edge_events"}}}}`)
+	defer os.Remove(filename)
+
+	cfg, err := Load(filename)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"events", "orders"}, cfg.Kafka.Import.ImportTopics())
+	assert.Empty(t, cfg.Kafka.TopicNames())
+}
+
+func Test_Kafka_Invalid(t *testing.T) {
+	testCases := map[string]string{
+		`{"kafka": {"topics": {"events_*": "events"}}}`:                                            "kafka: invalid url \"\"",
+		`{"kafka": {"url": "http://kafka-rest:8082"}}`:                                             "kafka: no topics configured",
+		`{"kafka": {"url": "http://kafka-rest:8082", "topics": {"a": ""}}}`:                        "kafka: empty topic of a",
+		`{"kafka": {"url": "http://kafka-rest:8082", "import": {"queues": {"events": "events"}}}}`: "kafka: import group is required",
+		`{"kafka": {"url": "http://kafka-rest:8082", "import": {"group": "edge"}}}`:                "kafka: no import queues configured",
+	}
+
+	for content, expected := range testCases {
+		filename := writeConfig(t, content)
+		_, err := Load(filename)
+		os.Remove(filename)
+		assert.Equal(t, expected, err.Error(), content)
+	}
+}
@@ -0,0 +1,29 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// QueueNamesConfig changes rules queue names are validated with,
+// zero values keep default rules allowing a-zA-Z0-9_ up to 100 bytes
+type QueueNamesConfig struct {
+	// Chars is a body of regexp character class, e.g. "a-zA-Z0-9_.:-"
+	Chars     string `json:"chars"`
+	MaxLength int    `json:"max_length"`
+	// Encode stores queues in percent-encoded directory names,
+	// names may then contain any characters unless Chars is set
+	Encode bool `json:"encode"`
+}
+
+func (nc *QueueNamesConfig) validate() error {
+	if nc.Chars != "" {
+		if _, err := regexp.Compile("[^" + nc.Chars + "]"); err != nil {
+			return fmt.Errorf("queue_names: invalid chars %q", nc.Chars)
+		}
+	}
+	if nc.MaxLength < 0 {
+		return fmt.Errorf("queue_names: invalid max_length %d", nc.MaxLength)
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package config
+
+import "fmt"
+
+// Limits of session buffer sizes
+const (
+	DefaultSessionBuffer = 4096
+	minSessionBuffer     = 64
+	maxSessionBuffer     = 64 * 1024 * 1024
+)
+
+// NetworkConfig tunes client connections: small buffers with Nagle's
+// algorithm disabled suit chatty consumers, large buffers suit bulk producers
+type NetworkConfig struct {
+	// ReadBuffer and WriteBuffer are sizes of per-session bufio buffers
+	// in bytes, DefaultSessionBuffer if omitted
+	ReadBuffer  int `json:"read_buffer"`
+	WriteBuffer int `json:"write_buffer"`
+	// TCPNoDelay disables Nagle's algorithm, true if omitted
+	TCPNoDelay *bool `json:"tcp_nodelay"`
+	// SocketReadBuffer and SocketWriteBuffer are SO_RCVBUF and SO_SNDBUF
+	// hints in bytes, zero keeps operating system defaults
+	SocketReadBuffer  int `json:"socket_read_buffer"`
+	SocketWriteBuffer int `json:"socket_write_buffer"`
+}
+
+// NoDelay returns whether Nagle's algorithm is disabled
+func (nc *NetworkConfig) NoDelay() bool {
+	return nc.TCPNoDelay == nil || *nc.TCPNoDelay
+}
+
+func (nc *NetworkConfig) validate() error {
+	for _, b := range []struct {
+		name string
+		size *int
+	}{
+		{"read_buffer", &nc.ReadBuffer},
+		{"write_buffer", &nc.WriteBuffer},
+	} {
+		if *b.size == 0 {
+			*b.size = DefaultSessionBuffer
+		}
+		if *b.size < minSessionBuffer || *b.size > maxSessionBuffer {
+			return fmt.Errorf("network: invalid %s %d", b.name, *b.size)
+		}
+	}
+	if nc.SocketReadBuffer < 0 {
+		return fmt.Errorf("network: invalid socket_read_buffer %d", nc.SocketReadBuffer)
+	}
+	if nc.SocketWriteBuffer < 0 {
+		return fmt.Errorf("network: invalid socket_write_buffer %d", nc.SocketWriteBuffer)
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package config
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Network(t *testing.T) {
+	filename := writeConfig(t, `{"network": {"write_buffer": 65536, "tcp_nodelay": false, "socket_read_buffer": 262144}}`)
+	defer os.Remove(filename)
+
+	cfg, err := Load(filename)
+	assert.Nil(t, err)
+	assert.Equal(t, DefaultSessionBuffer, cfg.Network.ReadBuffer)
+	assert.Equal(t, 65536, cfg.Network.WriteBuffer)
+	assert.False(t, cfg.Network.NoDelay())
+	assert.Equal(t, 262144, cfg.Network.SocketReadBuffer)
+	assert.Equal(t, 0, cfg.Network.SocketWriteBuffer)
+
+	assert.True(t, (&NetworkConfig{}).NoDelay())
+}
+
+func Test_Network_Invalid(t *testing.T) {
+	testCases := map[string]string{
+		`{"network": {"read_buffer": 16}}`:         "network: invalid read_buffer 16",
+		`{"network": {"write_buffer": -1}}`:        "network: invalid write_buffer -1",
+		`{"network": {"socket_read_buffer": -1}}`:  "network: invalid socket_read_buffer -1",
+		`{"network": {"socket_write_buffer": -1}}`: "network: invalid socket_write_buffer -1",
+		`{"network": {"write_buffer": 134217728}}`: "network: invalid write_buffer 134217728",
+	}
+
+	for content, expected := range testCases {
+		filename := writeConfig(t, content)
+		_, err := Load(filename)
+		os.Remove(filename)
+		assert.Equal(t, expected, err.Error(), content)
+	}
+}
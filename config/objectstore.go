@@ -0,0 +1,79 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"time"
+)
+
+// Defaults of object store archival
+const (
+	DefaultObjectStoreInterval    = 10 * time.Minute
+	DefaultObjectStoreSegmentSize = 64 << 20
+	DefaultObjectStoreRegion      = "us-east-1"
+)
+
+// ObjectStoreConfig uploads items consumed from or expired in queues with
+// object_archive enabled to S3 compatible storage in compressed segments
+type ObjectStoreConfig struct {
+	// Endpoint is a URL of the store, e.g. "https://s3.us-east-1.amazonaws.com"
+	Endpoint string `json:"endpoint"`
+	Region   string `json:"region"`
+	Bucket   string `json:"bucket"`
+	// Prefix is prepended to object keys, e.g. "siberite/host1/"
+	Prefix string `json:"prefix"`
+	// AccessKey and SecretKey default to AWS_ACCESS_KEY_ID
+	// and AWS_SECRET_ACCESS_KEY environment variables
+	AccessKey string `json:"access_key"`
+	SecretKey string `json:"secret_key"`
+	// Interval is how often segments are uploaded, e.g. "10m"
+	Interval string `json:"interval"`
+	// SegmentSize closes a segment once it has that many compressed bytes
+	SegmentSize int64 `json:"segment_size"`
+
+	interval time.Duration
+}
+
+// UploadInterval returns how often segments are uploaded
+func (oc *ObjectStoreConfig) UploadInterval() time.Duration {
+	return oc.interval
+}
+
+func (oc *ObjectStoreConfig) validate() error {
+	u, err := url.Parse(oc.Endpoint)
+	if oc.Endpoint == "" || err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return fmt.Errorf("object_store: invalid endpoint %q", oc.Endpoint)
+	}
+	if oc.Bucket == "" {
+		return errors.New("object_store: bucket is required")
+	}
+	if oc.Region == "" {
+		oc.Region = DefaultObjectStoreRegion
+	}
+	if oc.AccessKey == "" {
+		oc.AccessKey = os.Getenv("AWS_ACCESS_KEY_ID")
+	}
+	if oc.SecretKey == "" {
+		oc.SecretKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+	}
+	if oc.AccessKey == "" || oc.SecretKey == "" {
+		return errors.New("object_store: access_key and secret_key are required")
+	}
+	oc.interval = DefaultObjectStoreInterval
+	if oc.Interval != "" {
+		interval, err := ParseDuration(oc.Interval)
+		if err != nil || interval <= 0 {
+			return fmt.Errorf("object_store: invalid interval %q", oc.Interval)
+		}
+		oc.interval = interval
+	}
+	if oc.SegmentSize < 0 {
+		return fmt.Errorf("object_store: invalid segment_size %d", oc.SegmentSize)
+	}
+	if oc.SegmentSize == 0 {
+		oc.SegmentSize = DefaultObjectStoreSegmentSize
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package config
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ObjectStore(t *testing.T) {
+	filename := writeConfig(t, `{
+		"object_store": {"endpoint": "http://minio:9000", "bucket": "archive", "access_key": "a", "secret_key": "s"},
+		"queues": {"work": {"object_archive": true}}
+	}`)
+	defer os.Remove(filename)
+
+	cfg, err := Load(filename)
+	assert.Nil(t, err)
+	assert.Equal(t, DefaultObjectStoreRegion, cfg.ObjectStore.Region)
+	assert.Equal(t, 10*time.Minute, cfg.ObjectStore.UploadInterval())
+	assert.Equal(t, int64(DefaultObjectStoreSegmentSize), cfg.ObjectStore.SegmentSize)
+	assert.True(t, cfg.Queue("work").ObjectArchive)
+}
+
+func Test_ObjectStore_Invalid(t *testing.T) {
+	os.Unsetenv("AWS_ACCESS_KEY_ID")
+	testCases := map[string]string{
+		`{"object_store": {"bucket": "archive"}}`:                                                                                      "object_store: invalid endpoint \"\"",
+		`{"object_store": {"endpoint": "http://minio:9000"}}`:                                                                          "object_store: bucket is required",
+		`{"object_store": {"endpoint": "http://minio:9000", "bucket": "a"}}`:                                                           "object_store: access_key and secret_key are required",
+		`{"object_store": {"endpoint": "http://minio:9000", "bucket": "a", "access_key": "a", "secret_key": "s", "interval": "soon"}}`: "object_store: invalid interval \"soon\"",
+	}
+
+	for content, expected := range testCases {
+		filename := writeConfig(t, content)
+		_, err := Load(filename)
+		os.Remove(filename)
+		assert.Equal(t, expected, err.Error(), content)
+	}
+}
@@ -0,0 +1,43 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Limits of large value offloading
+const (
+	DefaultOffloadMinSize = 4 << 20
+	// MinOffloadSize is a size values up to which are always kept
+	// in queue databases, either inline or in blob chunks
+	MinOffloadSize = 1 << 20
+)
+
+// OffloadConfig keeps values of large items in a filesystem pool
+// or S3 compatible storage, queues keep only references to them
+type OffloadConfig struct {
+	// MinSize is a value size in bytes offloaded values start at
+	MinSize int64 `json:"min_size"`
+	// Path is a directory values are stored in as files
+	Path string `json:"path"`
+	// S3 stores values as objects of a bucket
+	S3 *ObjectStoreConfig `json:"s3"`
+}
+
+func (oc *OffloadConfig) validate() error {
+	if (oc.Path == "") == (oc.S3 == nil) {
+		return errors.New("offload: either path or s3 is required")
+	}
+	if oc.S3 != nil {
+		if err := oc.S3.validate(); err != nil {
+			return fmt.Errorf("offload: %s", err.Error())
+		}
+	}
+	if oc.MinSize == 0 {
+		oc.MinSize = DefaultOffloadMinSize
+	}
+	if oc.MinSize < MinOffloadSize {
+		return fmt.Errorf("offload: min_size must be at least %d", MinOffloadSize)
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+package config
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Offload(t *testing.T) {
+	filename := writeConfig(t, `{"offload": {"path": "/var/lib/siberite/blobs"}}`)
+	defer os.Remove(filename)
+
+	cfg, err := Load(filename)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(DefaultOffloadMinSize), cfg.Offload.MinSize)
+	assert.Equal(t, "/var/lib/siberite/blobs", cfg.Offload.Path)
+}
+
+func Test_Offload_Invalid(t *testing.T) {
+	testCases := map[string]string{
+		`{"offload": {}}`: "offload: either path or s3 is required",
+		`{"offload": {"path": "blobs", "s3": {"endpoint": "http://minio:9000", "bucket": "blobs", "access_key": "a", "secret_key": "s"}}}`: "offload: either path or s3 is required",
+		`{"offload": {"path": "blobs", "min_size": 1024}}`:       "offload: min_size must be at least 1048576",
+		`{"offload": {"s3": {"endpoint": "http://minio:9000"}}}`: "offload: object_store: bucket is required",
+	}
+
+	for content, expected := range testCases {
+		filename := writeConfig(t, content)
+		_, err := Load(filename)
+		os.Remove(filename)
+		assert.Equal(t, expected, err.Error(), content)
+	}
+}
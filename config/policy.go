@@ -0,0 +1,138 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Policy actions
+const (
+	ActionFlush   = "flush"
+	ActionCompact = "compact"
+	ActionExpire  = "expire"
+)
+
+// Policy is a scheduled queue maintenance action
+type Policy struct {
+	// Action is one of flush, compact or expire
+	Action string `json:"action"`
+	// Schedule is "every <duration>", "daily HH:MM" or "weekly <weekday> HH:MM"
+	Schedule string `json:"schedule"`
+	// MaxAge is an age of items removed by expire, e.g. "36h" or "7d"
+	MaxAge string `json:"max_age"`
+
+	schedule schedule
+	maxAge   time.Duration
+}
+
+// Next returns next run time after a given time
+func (p *Policy) Next(after time.Time) time.Time {
+	return p.schedule.next(after)
+}
+
+// Age returns parsed MaxAge
+func (p *Policy) Age() time.Duration {
+	return p.maxAge
+}
+
+func (p *Policy) parse() error {
+	switch p.Action {
+	case ActionFlush, ActionCompact:
+	case ActionExpire:
+		age, err := ParseDuration(p.MaxAge)
+		if err != nil || age <= 0 {
+			return fmt.Errorf("invalid max_age %q", p.MaxAge)
+		}
+		p.maxAge = age
+	default:
+		return fmt.Errorf("unknown policy action %q", p.Action)
+	}
+	s, err := parseSchedule(p.Schedule)
+	if err != nil {
+		return err
+	}
+	p.schedule = s
+	return nil
+}
+
+// ParseDuration parses time.Duration strings extended with a "d" (day) unit
+func ParseDuration(s string) (time.Duration, error) {
+	if strings.HasSuffix(s, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(s, "d"))
+		if err != nil {
+			return 0, err
+		}
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(s)
+}
+
+type schedule struct {
+	every   time.Duration
+	weekday time.Weekday
+	weekly  bool
+	hour    int
+	minute  int
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+func parseSchedule(input string) (schedule, error) {
+	s := schedule{}
+	invalid := fmt.Errorf("invalid schedule %q", input)
+	tokens := strings.Fields(strings.ToLower(input))
+	if len(tokens) < 2 {
+		return s, invalid
+	}
+
+	switch {
+	case tokens[0] == "every" && len(tokens) == 2:
+		every, err := ParseDuration(tokens[1])
+		if err != nil || every <= 0 {
+			return s, invalid
+		}
+		s.every = every
+		return s, nil
+	case tokens[0] == "daily" && len(tokens) == 2:
+	case tokens[0] == "weekly" && len(tokens) == 3:
+		weekday, ok := weekdays[tokens[1]]
+		if !ok {
+			return s, invalid
+		}
+		s.weekly = true
+		s.weekday = weekday
+	default:
+		return s, invalid
+	}
+
+	var err error
+	if s.hour, s.minute, err = parseClock(tokens[len(tokens)-1]); err != nil {
+		return s, invalid
+	}
+	return s, nil
+}
+
+func parseClock(input string) (int, int, error) {
+	clock, err := time.Parse("15:04", input)
+	if err != nil {
+		return 0, 0, errors.New("invalid time")
+	}
+	return clock.Hour(), clock.Minute(), nil
+}
+
+func (s schedule) next(after time.Time) time.Time {
+	if s.every > 0 {
+		return after.Add(s.every)
+	}
+	next := time.Date(after.Year(), after.Month(), after.Day(), s.hour, s.minute, 0, 0, after.Location())
+	for !next.After(after) || (s.weekly && next.Weekday() != s.weekday) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next
+}
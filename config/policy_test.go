@@ -0,0 +1,50 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ParseDuration(t *testing.T) {
+	testCases := map[string]time.Duration{
+		"7d":  7 * 24 * time.Hour,
+		"36h": 36 * time.Hour,
+		"1m":  time.Minute,
+	}
+	for input, expected := range testCases {
+		d, err := ParseDuration(input)
+		assert.Nil(t, err)
+		assert.Equal(t, expected, d, input)
+	}
+
+	_, err := ParseDuration("xd")
+	assert.NotNil(t, err)
+}
+
+func Test_PolicyNext(t *testing.T) {
+	// Wednesday
+	now := time.Date(2015, 9, 23, 10, 30, 0, 0, time.UTC)
+
+	testCases := map[string]time.Time{
+		"every 90m":        time.Date(2015, 9, 23, 12, 0, 0, 0, time.UTC),
+		"daily 02:00":      time.Date(2015, 9, 24, 2, 0, 0, 0, time.UTC),
+		"daily 11:00":      time.Date(2015, 9, 23, 11, 0, 0, 0, time.UTC),
+		"DAILY 10:30":      time.Date(2015, 9, 24, 10, 30, 0, 0, time.UTC),
+		"weekly sun 03:00": time.Date(2015, 9, 27, 3, 0, 0, 0, time.UTC),
+		"weekly wed 10:00": time.Date(2015, 9, 30, 10, 0, 0, 0, time.UTC),
+		"weekly wed 10:45": time.Date(2015, 9, 23, 10, 45, 0, 0, time.UTC),
+	}
+
+	for input, expected := range testCases {
+		p := &Policy{Action: ActionCompact, Schedule: input}
+		assert.Nil(t, p.parse(), input)
+		assert.Equal(t, expected, p.Next(now), input)
+	}
+
+	for _, input := range []string{"", "every", "every -1h", "daily", "daily 25:00", "weekly 03:00", "weekly xyz 03:00"} {
+		p := &Policy{Action: ActionCompact, Schedule: input}
+		assert.NotNil(t, p.parse(), input)
+	}
+}
@@ -0,0 +1,89 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+)
+
+// ReplicationConfig enables active-active replication between sites:
+// items enqueued by clients to matching queues are tagged with origin
+// and forwarded to every peer, items received from peers are not forwarded again
+type ReplicationConfig struct {
+	// Origin identifies this site, e.g. "us_east"
+	Origin string `json:"origin"`
+	// Peers are host:port addresses of other sites
+	Peers []string `json:"peers"`
+	// Queues are queue names or glob patterns to replicate
+	Queues []string `json:"queues"`
+	// Identities are names peers authenticate as, with auth enabled
+	// other sessions can't send items tagged with origin
+	Identities []string `json:"identities"`
+	// Bootstrap loads replicated queues from a snapshot of another site
+	Bootstrap *BootstrapConfig `json:"bootstrap"`
+}
+
+// BootstrapConfig makes a site a warm standby: replicated queues are
+// replaced with a snapshot of a primary, items enqueued at the primary
+// after the snapshot arrive through regular replication
+type BootstrapConfig struct {
+	// Primary is host:port of a site to load snapshots from
+	Primary string `json:"primary"`
+	// Advertise is host:port of this site as listed in peers of the primary,
+	// the primary doesn't forward items already included in a snapshot
+	Advertise string `json:"advertise"`
+	// Interval repeats snapshots, e.g. "1h", by default a snapshot
+	// is loaded once into an empty data directory
+	Interval string `json:"interval"`
+
+	interval time.Duration
+}
+
+// RepeatInterval returns an interval of repeated snapshots, zero if disabled
+func (bc *BootstrapConfig) RepeatInterval() time.Duration {
+	return bc.interval
+}
+
+func (bc *BootstrapConfig) validate() error {
+	if bc.Primary == "" {
+		return errors.New("replication: bootstrap primary is required")
+	}
+	if bc.Interval != "" {
+		interval, err := ParseDuration(bc.Interval)
+		if err != nil || interval < time.Minute {
+			return fmt.Errorf("replication: invalid bootstrap interval %q, at least 1m is required", bc.Interval)
+		}
+		bc.interval = interval
+	}
+	return nil
+}
+
+// Replicated reports whether a queue is replicated to peers
+func (rc *ReplicationConfig) Replicated(name string) bool {
+	if rc == nil {
+		return false
+	}
+	return MatchAny(rc.Queues, name)
+}
+
+func (rc *ReplicationConfig) validate() error {
+	if rc.Origin == "" || strings.ContainsAny(rc.Origin, " =\r\n") {
+		return fmt.Errorf("replication: invalid origin %q", rc.Origin)
+	}
+	if len(rc.Peers) == 0 && rc.Bootstrap == nil {
+		return errors.New("replication: no peers configured")
+	}
+	if rc.Bootstrap != nil {
+		if err := rc.Bootstrap.validate(); err != nil {
+			return err
+		}
+	}
+	for _, pattern := range rc.Queues {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("replication: %s", err.Error())
+		}
+	}
+	return nil
+}
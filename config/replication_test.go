@@ -0,0 +1,56 @@
+package config
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Replication(t *testing.T) {
+	filename := writeConfig(t, `{
+		"replication": {"origin": "dc1", "peers": ["10.0.0.2:22133"], "queues": ["events_*"]},
+		"coordination": {"consul": "http://127.0.0.1:8500", "key": "siberite/leader"}
+	}`)
+	defer os.Remove(filename)
+
+	cfg, err := Load(filename)
+	assert.Nil(t, err)
+	assert.True(t, cfg.Replication.Replicated("events_a"))
+	assert.False(t, cfg.Replication.Replicated("work"))
+	assert.Equal(t, DefaultLeaderTTL, cfg.Coordination.LeaderTTL())
+	assert.False(t, Default().Replication.Replicated("events_a"))
+}
+
+func Test_Replication_Bootstrap(t *testing.T) {
+	filename := writeConfig(t, `{
+		"replication": {"origin": "dc2", "queues": ["events_*"],
+			"bootstrap": {"primary": "10.0.0.1:22133", "advertise": "10.0.0.2:22133", "interval": "1h"}}
+	}`)
+	defer os.Remove(filename)
+
+	cfg, err := Load(filename)
+	assert.Nil(t, err)
+	assert.Equal(t, "10.0.0.1:22133", cfg.Replication.Bootstrap.Primary)
+	assert.Equal(t, time.Hour, cfg.Replication.Bootstrap.RepeatInterval())
+}
+
+func Test_Replication_Invalid(t *testing.T) {
+	testCases := map[string]string{
+		`{"replication": {"origin": "dc 1", "peers": ["a:1"]}}`:                                                          "replication: invalid origin \"dc 1\"",
+		`{"replication": {"origin": "dc1"}}`:                                                                             "replication: no peers configured",
+		`{"replication": {"origin": "dc1", "bootstrap": {}}}`:                                                            "replication: bootstrap primary is required",
+		`{"replication": {"origin": "dc1", "bootstrap": {"primary": "a:1", "interval": "1s"}}}`:                          "replication: invalid bootstrap interval \"1s\", at least 1m is required",
+		`{"coordination": {"consul": "http://127.0.0.1:8500", "key": "leader"}}`:                                         "coordination: replication is not configured",
+		`{"replication": {"origin": "dc1", "peers": ["a:1"]}, "coordination": {}}`:                                       "coordination: consul and key are required",
+		`{"replication": {"origin": "dc1", "peers": ["a:1"]}, "coordination": {"consul": "c", "key": "k", "ttl": "1s"}}`: "coordination: invalid ttl \"1s\", at least 10s is required",
+	}
+
+	for content, expected := range testCases {
+		filename := writeConfig(t, content)
+		_, err := Load(filename)
+		os.Remove(filename)
+		assert.Equal(t, expected, err.Error(), content)
+	}
+}
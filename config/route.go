@@ -0,0 +1,64 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// RouteRule copies or moves items enqueued to a topic queue to destination
+// queues, a rule without conditions matches every item
+type RouteRule struct {
+	// Header matches items with a header, "key=value" or "key" for any value
+	Header string `json:"header"`
+	// Prefix matches items with a value starting with it
+	Prefix string `json:"prefix"`
+	// To are destination queues
+	To []string `json:"to"`
+	// Move keeps matched items out of the topic queue
+	Move bool `json:"move"`
+
+	headerKey   string
+	headerValue string
+	anyValue    bool
+}
+
+// Match reports whether an item with given headers and value matches the rule,
+// values kept as blobs are passed as nil and don't match a prefix
+func (r *RouteRule) Match(headers map[string]string, value []byte) bool {
+	if r.headerKey != "" {
+		v, ok := headers[r.headerKey]
+		if !ok || (!r.anyValue && v != r.headerValue) {
+			return false
+		}
+	}
+	return r.Prefix == "" || bytes.HasPrefix(value, []byte(r.Prefix))
+}
+
+func (r *RouteRule) validate(pattern string) error {
+	if len(r.To) == 0 {
+		return fmt.Errorf("routes: to is required")
+	}
+	for _, name := range r.To {
+		if name == "" || strings.ContainsAny(name, "*?[") {
+			return fmt.Errorf("routes: invalid destination %q", name)
+		}
+		if ok, _ := path.Match(pattern, name); ok {
+			return fmt.Errorf("routes: destination %s matches the topic queue", name)
+		}
+	}
+	if r.Header != "" {
+		kv := strings.SplitN(r.Header, "=", 2)
+		if kv[0] == "" {
+			return fmt.Errorf("routes: invalid header %q", r.Header)
+		}
+		r.headerKey = kv[0]
+		if len(kv) == 2 {
+			r.headerValue = kv[1]
+		} else {
+			r.anyValue = true
+		}
+	}
+	return nil
+}
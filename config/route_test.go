@@ -0,0 +1,44 @@
+package config
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Routes(t *testing.T) {
+	filename := writeConfig(t, `{"queues": {"events": {"routes": [
+		{"header": "type=order", "to": ["orders"], "move": true},
+		{"header": "trace", "prefix": "{", "to": ["traced_json"]}
+	]}}}`)
+	defer os.Remove(filename)
+
+	cfg, err := Load(filename)
+	assert.Nil(t, err)
+	rules := cfg.Queue("events").Routes
+	assert.Equal(t, 2, len(rules))
+	assert.True(t, rules[0].Match(map[string]string{"type": "order"}, []byte("x")))
+	assert.False(t, rules[0].Match(map[string]string{"type": "refund"}, []byte("x")))
+	assert.False(t, rules[0].Match(nil, []byte("x")))
+	assert.True(t, rules[1].Match(map[string]string{"trace": "abc"}, []byte("{}")))
+	assert.False(t, rules[1].Match(map[string]string{"trace": "abc"}, []byte("[]")))
+	assert.False(t, rules[1].Match(map[string]string{"trace": "abc"}, nil))
+	assert.True(t, (&RouteRule{To: []string{"all"}}).Match(nil, nil))
+}
+
+func Test_Routes_Invalid(t *testing.T) {
+	testCases := map[string]string{
+		`{"queues": {"events": {"routes": [{"header": "type=order"}]}}}`:               "queue events: routes: to is required",
+		`{"queues": {"events": {"routes": [{"to": ["orders_*"]}]}}}`:                   "queue events: routes: invalid destination \"orders_*\"",
+		`{"queues": {"events_*": {"routes": [{"to": ["events_orders"]}]}}}`:            "queue events_*: routes: destination events_orders matches the topic queue",
+		`{"queues": {"events": {"routes": [{"header": "=order", "to": ["orders"]}]}}}`: "queue events: routes: invalid header \"=order\"",
+	}
+
+	for content, expected := range testCases {
+		filename := writeConfig(t, content)
+		_, err := Load(filename)
+		os.Remove(filename)
+		assert.Equal(t, expected, err.Error(), content)
+	}
+}
@@ -0,0 +1,24 @@
+package config
+
+import "errors"
+
+// RouterConfig turns the server into a router that spreads queues
+// across backend servers by consistent hashing of queue names
+type RouterConfig struct {
+	// Backends are host:port addresses of siberite servers
+	Backends []string `json:"backends"`
+}
+
+func (rc *RouterConfig) validate() error {
+	if len(rc.Backends) == 0 {
+		return errors.New("router: no backends configured")
+	}
+	seen := map[string]bool{}
+	for _, backend := range rc.Backends {
+		if seen[backend] {
+			return errors.New("router: duplicate backend " + backend)
+		}
+		seen[backend] = true
+	}
+	return nil
+}
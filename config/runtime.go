@@ -0,0 +1,107 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// ErrUnknownSetting is returned for settings that can't be changed at runtime
+var ErrUnknownSetting = errors.New("unknown setting")
+
+// Tunables are settings changed at runtime with Set, in the order Get lists them.
+// There is no log level: the server logs through the standard logger without levels,
+// every line is a startup message, a warning or an error an operator acts on.
+var Tunables = []string{
+	"tcp_keepalive", "read_timeout", "write_timeout", "slowlog_threshold",
+	"slowlog_size", "resume_grace", "max_memory", "max_connections",
+}
+
+// Get returns a current value of a runtime tunable setting
+func (c *Config) Get(key string) (string, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if d := c.durationSetting(key); d != nil {
+		return d.String(), nil
+	}
+	switch key {
+	case "slowlog_size":
+		return strconv.Itoa(c.SlowlogSize), nil
+	case "max_memory":
+		return strconv.FormatInt(c.MaxMemory, 10), nil
+	case "max_connections":
+		return strconv.FormatUint(c.MaxConnections, 10), nil
+	}
+	return "", ErrUnknownSetting
+}
+
+// Set changes a runtime tunable setting, values are validated as in
+// a configuration file. Changes apply to following commands, timeouts
+// and keepalive of connections already waiting are not changed.
+func (c *Config) Set(key string, value string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if d := c.durationSetting(key); d != nil {
+		duration, err := ParseDuration(value)
+		if err != nil || duration < 0 {
+			return fmt.Errorf("invalid %s %q", key, value)
+		}
+		*d = duration
+		return nil
+	}
+	switch key {
+	case "slowlog_size":
+		size, err := strconv.Atoi(value)
+		if err != nil || size < 0 {
+			return fmt.Errorf("invalid %s %q", key, value)
+		}
+		c.SlowlogSize = size
+	case "max_memory":
+		limit, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || limit < 0 {
+			return fmt.Errorf("invalid %s %q", key, value)
+		}
+		c.MaxMemory = limit
+	case "max_connections":
+		limit, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid %s %q", key, value)
+		}
+		c.MaxConnections = limit
+	default:
+		return ErrUnknownSetting
+	}
+	return nil
+}
+
+// durationSetting returns a parsed duration setting, nil for other keys
+func (c *Config) durationSetting(key string) *time.Duration {
+	switch key {
+	case "tcp_keepalive":
+		return &c.keepAlive
+	case "read_timeout":
+		return &c.readTimeout
+	case "write_timeout":
+		return &c.writeTimeout
+	case "slowlog_threshold":
+		return &c.slowlogThreshold
+	case "resume_grace":
+		return &c.resumeGrace
+	}
+	return nil
+}
+
+// MemoryLimit returns max_memory, zero if memory is not limited
+func (c *Config) MemoryLimit() int64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.MaxMemory
+}
+
+// ConnectionLimit returns max_connections, zero if the check is disabled
+func (c *Config) ConnectionLimit() uint64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.MaxConnections
+}
@@ -0,0 +1,41 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_RuntimeSettings(t *testing.T) {
+	cfg := Default()
+	assert.Nil(t, cfg.Validate())
+
+	for _, key := range Tunables {
+		_, err := cfg.Get(key)
+		assert.Nil(t, err, key)
+	}
+	value, err := cfg.Get("read_timeout")
+	assert.Nil(t, err)
+	assert.Equal(t, "0s", value)
+
+	assert.Nil(t, cfg.Set("read_timeout", "30s"))
+	assert.Nil(t, cfg.Set("slowlog_size", "16"))
+	assert.Nil(t, cfg.Set("max_memory", "1048576"))
+	assert.Nil(t, cfg.Set("max_connections", "100"))
+	read, _ := cfg.Timeouts()
+	assert.Equal(t, 30*time.Second, read)
+	_, size := cfg.Slowlog()
+	assert.Equal(t, 16, size)
+	assert.Equal(t, int64(1048576), cfg.MemoryLimit())
+	assert.Equal(t, uint64(100), cfg.ConnectionLimit())
+	value, _ = cfg.Get("max_memory")
+	assert.Equal(t, "1048576", value)
+
+	assert.Equal(t, ErrUnknownSetting, cfg.Set("chaos", "true"))
+	_, err = cfg.Get("chaos")
+	assert.Equal(t, ErrUnknownSetting, err)
+	assert.Equal(t, `invalid write_timeout "-1s"`, cfg.Set("write_timeout", "-1s").Error())
+	assert.Equal(t, `invalid max_memory "lots"`, cfg.Set("max_memory", "lots").Error())
+	assert.Equal(t, `invalid slowlog_size "-1"`, cfg.Set("slowlog_size", "-1").Error())
+}
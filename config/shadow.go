@@ -0,0 +1,61 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+)
+
+// DefaultShadowBuffer is a number of items waiting to be shadowed,
+// items enqueued while the buffer is full are not shadowed
+const DefaultShadowBuffer = 10000
+
+// ShadowConfig forwards copies of items enqueued by clients to another
+// system on a best effort basis, clients are still served locally
+type ShadowConfig struct {
+	// Target is host:port of a siberite or memcache protocol server
+	Target string `json:"target"`
+	// URL is a base URL of a Kafka REST proxy, items of a queue
+	// are produced to a topic of the same name
+	URL string `json:"url"`
+	// Queues are queue names or glob patterns to shadow
+	Queues []string `json:"queues"`
+	// Buffer is a number of items waiting to be sent
+	Buffer int `json:"buffer"`
+}
+
+// Shadowed reports whether items of a queue are shadowed
+func (sc *ShadowConfig) Shadowed(name string) bool {
+	if sc == nil {
+		return false
+	}
+	return MatchAny(sc.Queues, name)
+}
+
+func (sc *ShadowConfig) validate() error {
+	if (sc.Target == "") == (sc.URL == "") {
+		return errors.New("shadow: either target or url is required")
+	}
+	if sc.URL != "" {
+		u, err := url.Parse(sc.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return fmt.Errorf("shadow: invalid url %q", sc.URL)
+		}
+	}
+	if len(sc.Queues) == 0 {
+		return errors.New("shadow: no queues configured")
+	}
+	for _, pattern := range sc.Queues {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("shadow: %s", err.Error())
+		}
+	}
+	if sc.Buffer < 0 {
+		return fmt.Errorf("shadow: invalid buffer %d", sc.Buffer)
+	}
+	if sc.Buffer == 0 {
+		sc.Buffer = DefaultShadowBuffer
+	}
+	return nil
+}
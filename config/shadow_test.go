@@ -0,0 +1,35 @@
+package config
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Shadow(t *testing.T) {
+	filename := writeConfig(t, `{"shadow": {"url": "http://kafka:8082", "queues": ["events_*"]}}`)
+	defer os.Remove(filename)
+
+	cfg, err := Load(filename)
+	assert.Nil(t, err)
+	assert.Equal(t, DefaultShadowBuffer, cfg.Shadow.Buffer)
+	assert.True(t, cfg.Shadow.Shadowed("events_a"))
+	assert.False(t, cfg.Shadow.Shadowed("work"))
+}
+
+func Test_Shadow_Invalid(t *testing.T) {
+	testCases := map[string]string{
+		`{"shadow": {"queues": ["events_*"]}}`:                                 "shadow: either target or url is required",
+		`{"shadow": {"target": "10.0.0.1:22133", "url": "http://kafka:8082"}}`: "shadow: either target or url is required",
+		`{"shadow": {"url": "kafka:8082", "queues": ["events_*"]}}`:            "shadow: invalid url \"kafka:8082\"",
+		`{"shadow": {"target": "10.0.0.1:22133"}}`:                             "shadow: no queues configured",
+	}
+
+	for content, expected := range testCases {
+		filename := writeConfig(t, content)
+		_, err := Load(filename)
+		os.Remove(filename)
+		assert.Equal(t, expected, err.Error(), content)
+	}
+}
@@ -0,0 +1,86 @@
+package config
+
+import "fmt"
+
+// Storage compression choices
+const (
+	CompressionSnappy = "snappy"
+	CompressionNone   = "none"
+)
+
+// Block cacher choices, block cache is disabled by default
+const (
+	CacherNone = "none"
+	CacherLRU  = "lru"
+)
+
+// StorageConfig represents leveldb tuning settings,
+// zero values keep leveldb defaults
+type StorageConfig struct {
+	WriteBuffer         int    `json:"write_buffer"`
+	BlockSize           int    `json:"block_size"`
+	CompactionTableSize int    `json:"compaction_table_size"`
+	OpenFilesLimit      int    `json:"open_files_limit"`
+	BloomFilterBits     int    `json:"bloom_filter_bits"`
+	Compression         string `json:"compression"`
+	// BlockCacher enables block cache for peek-heavy workloads
+	BlockCacher    string `json:"block_cacher"`
+	BlockCacheSize int    `json:"block_cache_size"`
+}
+
+// Storage returns leveldb settings of a queue,
+// queue settings override server wide ones field by field
+func (c *Config) Storage(name string) StorageConfig {
+	var sc StorageConfig
+	if c.DefaultStorage != nil {
+		sc = *c.DefaultStorage
+	}
+	if qs := c.Queue(name).Storage; qs != nil {
+		sc.merge(qs)
+	}
+	return sc
+}
+
+func (sc *StorageConfig) merge(other *StorageConfig) {
+	if other.WriteBuffer != 0 {
+		sc.WriteBuffer = other.WriteBuffer
+	}
+	if other.BlockSize != 0 {
+		sc.BlockSize = other.BlockSize
+	}
+	if other.CompactionTableSize != 0 {
+		sc.CompactionTableSize = other.CompactionTableSize
+	}
+	if other.OpenFilesLimit != 0 {
+		sc.OpenFilesLimit = other.OpenFilesLimit
+	}
+	if other.BloomFilterBits != 0 {
+		sc.BloomFilterBits = other.BloomFilterBits
+	}
+	if other.Compression != "" {
+		sc.Compression = other.Compression
+	}
+	if other.BlockCacher != "" {
+		sc.BlockCacher = other.BlockCacher
+	}
+	if other.BlockCacheSize != 0 {
+		sc.BlockCacheSize = other.BlockCacheSize
+	}
+}
+
+func (sc *StorageConfig) validate() error {
+	if sc.WriteBuffer < 0 || sc.BlockSize < 0 || sc.CompactionTableSize < 0 ||
+		sc.OpenFilesLimit < 0 || sc.BloomFilterBits < 0 || sc.BlockCacheSize < 0 {
+		return fmt.Errorf("storage: negative settings are not allowed")
+	}
+	switch sc.BlockCacher {
+	case "", CacherNone, CacherLRU:
+	default:
+		return fmt.Errorf("storage: unknown block_cacher %q", sc.BlockCacher)
+	}
+	switch sc.Compression {
+	case "", CompressionSnappy, CompressionNone:
+		return nil
+	}
+	return fmt.Errorf("storage: unknown compression %q", sc.Compression)
+}
@@ -0,0 +1,44 @@
+package config
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Storage(t *testing.T) {
+	filename := writeConfig(t, `{
+		"storage": {"write_buffer": 16777216, "bloom_filter_bits": 10},
+		"queues": {
+			"large_*": {"storage": {"write_buffer": 67108864, "compression": "none"}},
+			"peek_*": {"storage": {"block_cacher": "lru", "block_cache_size": 1048576}}
+		}
+	}`)
+	defer os.Remove(filename)
+
+	cfg, err := Load(filename)
+	assert.Nil(t, err)
+
+	assert.Equal(t, StorageConfig{WriteBuffer: 16777216, BloomFilterBits: 10}, cfg.Storage("work"))
+	assert.Equal(t, StorageConfig{WriteBuffer: 67108864, BloomFilterBits: 10, Compression: CompressionNone},
+		cfg.Storage("large_images"))
+	assert.Equal(t, StorageConfig{WriteBuffer: 16777216, BloomFilterBits: 10, BlockCacher: CacherLRU, BlockCacheSize: 1048576},
+		cfg.Storage("peek_heads"))
+	assert.Equal(t, StorageConfig{}, Default().Storage("work"))
+}
+
+func Test_Storage_Invalid(t *testing.T) {
+	testCases := map[string]string{
+		`{"storage": {"block_size": -1}}`:                           "storage: negative settings are not allowed",
+		`{"queues": {"work": {"storage": {"compression": "lz4"}}}}`: "queue work: storage: unknown compression \"lz4\"",
+		`{"storage": {"block_cacher": "arc"}}`:                      "storage: unknown block_cacher \"arc\"",
+	}
+
+	for content, expected := range testCases {
+		filename := writeConfig(t, content)
+		_, err := Load(filename)
+		os.Remove(filename)
+		assert.Equal(t, expected, err.Error(), content)
+	}
+}
@@ -0,0 +1,45 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"path"
+)
+
+// TenantConfig groups identities sharing quotas on queues they own,
+// zero limits are not enforced
+type TenantConfig struct {
+	// Identities are glob patterns of identity names of the tenant
+	Identities []string `json:"identities"`
+	// Queues are glob patterns of queues owned by the tenant, quotas count them
+	Queues []string `json:"queues"`
+	// MaxQueues limits a number of queues of the tenant
+	MaxQueues int `json:"max_queues"`
+	// MaxBytes limits disk usage of queues of the tenant
+	MaxBytes int64 `json:"max_bytes"`
+	// MaxEnqueueRate limits items enqueued to queues of the tenant per second
+	MaxEnqueueRate float64 `json:"max_enqueue_rate"`
+}
+
+func (tc *TenantConfig) validate() error {
+	if len(tc.Identities) == 0 || len(tc.Queues) == 0 {
+		return errors.New("identities and queues are required")
+	}
+	for _, patterns := range [][]string{tc.Identities, tc.Queues} {
+		for _, pattern := range patterns {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("invalid pattern %q", pattern)
+			}
+		}
+	}
+	if tc.MaxQueues < 0 {
+		return fmt.Errorf("invalid max_queues %d", tc.MaxQueues)
+	}
+	if tc.MaxBytes < 0 {
+		return fmt.Errorf("invalid max_bytes %d", tc.MaxBytes)
+	}
+	if tc.MaxEnqueueRate < 0 {
+		return fmt.Errorf("invalid max_enqueue_rate %g", tc.MaxEnqueueRate)
+	}
+	return nil
+}
@@ -0,0 +1,254 @@
+package controller
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"sync/atomic"
+
+	"github.com/bogdanovich/siberite/auth"
+	"github.com/bogdanovich/siberite/config"
+	"github.com/bogdanovich/siberite/repository"
+)
+
+// unauthenticatedCommands are allowed before a session is authenticated
+var unauthenticatedCommands = map[string]bool{
+	"auth": true, "version": true, "capabilities": true, "ping": true, "errcodes": true,
+}
+
+var (
+	errAuthRequired = errors.New("CLIENT_ERROR Authentication required")
+	errForbidden    = errors.New("CLIENT_ERROR Forbidden")
+)
+
+// Auth handles AUTH command, the identity lasts for the session
+// Command: AUTH <token> or AUTH <user> <password>
+// Response: AUTHENTICATED <identity>
+// A failed attempt is answered with CLIENT_ERROR Authentication failed.
+func (c *Controller) Auth(input []string) error {
+	if c.repo.Auth == nil {
+		return errors.New("CLIENT_ERROR Authentication is not enabled")
+	}
+	creds := auth.Credentials{Certificates: c.peerCertificates()}
+	switch len(input) {
+	case 2:
+		creds.Password = input[1]
+	case 3:
+		creds.User, creds.Password = input[1], input[2]
+	default:
+		return errors.New("ERROR Invalid command")
+	}
+	identity, err := c.repo.Auth.Authenticate(creds)
+	if err != nil {
+		atomic.AddUint64(&c.repo.Stats.AuthFailures, 1)
+		if err != auth.ErrInvalidCredentials {
+			log.Printf("Can't authenticate %s: %s", c.info.addr, err.Error())
+		}
+		return errors.New("CLIENT_ERROR Authentication failed")
+	}
+	c.identity = identity
+	fmt.Fprintf(c.rw.Writer, "AUTHENTICATED %s\r\n", identity.Name)
+	c.rw.Writer.Flush()
+	return nil
+}
+
+// authenticate rejects commands of unauthenticated sessions and commands
+// the auth policy doesn't allow, a session with a verified client
+// certificate is authenticated by its first command
+func (c *Controller) authenticate(cmd *Command) error {
+	if c.repo.Auth == nil || unauthenticatedCommands[cmd.Name] {
+		cmd.Identity = c.identity
+		return nil
+	}
+	if c.identity == nil {
+		certs := c.peerCertificates()
+		if len(certs) == 0 {
+			return errAuthRequired
+		}
+		identity, err := c.repo.Auth.Authenticate(auth.Credentials{Certificates: certs})
+		if err != nil {
+			return errAuthRequired
+		}
+		c.identity = identity
+	}
+	cmd.Identity = c.identity
+	queues, named := c.policyQueues(cmd)
+	if !named {
+		queues = []string{""}
+	}
+	for _, name := range queues {
+		if !c.repo.Policy.Allowed(c.identity, cmd.Name, name) {
+			return errForbidden
+		}
+	}
+	return nil
+}
+
+// fromPeer reports whether a session may send items tagged with origin,
+// every session is trusted without auth
+func (c *Controller) fromPeer() bool {
+	if c.repo.Auth == nil {
+		return true
+	}
+	rc := c.repo.Config().Replication
+	if c.identity == nil || rc == nil {
+		return false
+	}
+	for _, name := range rc.Identities {
+		if name == c.identity.Name {
+			return true
+		}
+	}
+	return false
+}
+
+// isAdmin reports whether a session may change server settings, identities
+// matching auth admins may, every local connection may without auth
+func (c *Controller) isAdmin() bool {
+	if c.repo.Auth == nil {
+		return c.isLocal()
+	}
+	ac := c.repo.Config().Auth
+	return c.identity != nil && ac != nil && config.MatchAny(ac.Admins, c.identity.Name)
+}
+
+// isLocal reports whether a session connected over loopback,
+// connections without a network address are local
+func (c *Controller) isLocal() bool {
+	conn, ok := c.conn.(interface{ RemoteAddr() net.Addr })
+	if !ok {
+		return true
+	}
+	if addr, ok := conn.RemoteAddr().(*net.TCPAddr); ok {
+		return addr.IP.IsLoopback()
+	}
+	return conn.RemoteAddr().Network() == "unix"
+}
+
+// admit rejects commands exceeding quotas of the tenant of an identity,
+// any queue command may open a queue, set and bset enqueue an item
+func (c *Controller) admit(cmd *Command) error {
+	if cmd.Identity == nil || cmd.Name == "delete" {
+		return nil
+	}
+	tenant := c.repo.TenantOf(cmd.Identity.Name)
+	if tenant == nil {
+		return nil
+	}
+	for _, name := range commandQueues(cmd) {
+		var err error
+		// Partitions of a partitioned queue are opened together by GET
+		for _, partition := range expandPartitions([]string{name}) {
+			if err == nil {
+				err = c.repo.AdmitQueue(tenant, partition)
+			}
+		}
+		if err == nil && (cmd.Name == "set" || cmd.Name == "setmeta" || cmd.Name == "bset") {
+			err = c.repo.AdmitEnqueue(tenant, name, 1)
+		}
+		if err != nil {
+			return errors.New("CLIENT_ERROR " + err.Error())
+		}
+	}
+	return nil
+}
+
+// commandQueues returns queues a command reads or writes
+func commandQueues(cmd *Command) []string {
+	if cmd.Name == "consume" {
+		return consumeQueues(cmd.Args)
+	}
+	if cmd.QueueName == "" {
+		return nil
+	}
+	queues := []string{cmd.QueueName}
+	args := cmd.Args
+	switch cmd.Name {
+	case "bset":
+		if len(args) > 4 {
+			queues = args[1 : len(args)-3]
+		}
+	case "get", "gets":
+		for _, option := range strings.Split(args[1], "/")[1:] {
+			if strings.HasPrefix(option, "move=") {
+				queues = append(queues, option[len("move="):])
+			}
+		}
+	case "tap":
+		if len(args) > 2 {
+			queues = append(queues, args[2])
+		}
+	case "replay":
+		if len(args) > 4 {
+			queues = append(queues, args[4])
+		}
+	}
+	return queues
+}
+
+// readQueues returns queue names and patterns of commands
+// reading queues without taking a queue name as the first argument
+func readQueues(cmd *Command) []string {
+	args := cmd.Args
+	switch {
+	case cmd.Name == "snapshot" && len(args) > 1:
+		return args[1:2]
+	case cmd.Name == "watch" && len(args) > 1 && args[1] == "events":
+		if len(args) > 2 {
+			return args[2:3]
+		}
+		return []string{"*"}
+	case cmd.Name == "stats" && len(args) > 1:
+		switch args[1] {
+		case "conns", "slowlog", "memory", "config":
+			return nil
+		case "queue":
+			return args[2:]
+		case "leveldb":
+			if len(args) > 2 {
+				return args[2:3]
+			}
+			return []string{"*"}
+		}
+		return args[1:2]
+	}
+	return nil
+}
+
+// policyQueues returns queues the auth policy checks a command on,
+// patterns are expanded to matching queues, so a pattern matching
+// no queues checks none. named is false for commands without a queue.
+func (c *Controller) policyQueues(cmd *Command) (queues []string, named bool) {
+	names := append(append([]string{}, commandQueues(cmd)...), readQueues(cmd)...)
+	for _, name := range names {
+		if !isPattern(name) {
+			queues = append(queues, name)
+			continue
+		}
+		matching, err := c.repo.MatchQueues(name)
+		if err != nil {
+			// The command rejects an invalid pattern
+			queues = append(queues, name)
+			continue
+		}
+		for _, match := range matching {
+			// Spooled items are not sent with a snapshot
+			if cmd.Name != "snapshot" || !repository.SpoolQueue(match) {
+				queues = append(queues, match)
+			}
+		}
+	}
+	return queues, len(names) > 0
+}
+
+// peerCertificates returns verified client certificates of a TLS connection
+func (c *Controller) peerCertificates() []*x509.Certificate {
+	if conn, ok := c.conn.(*tls.Conn); ok {
+		return conn.ConnectionState().PeerCertificates
+	}
+	return nil
+}
@@ -0,0 +1,214 @@
+package controller
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/bogdanovich/siberite/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Auth(t *testing.T) {
+	cfg := config.Default()
+	cfg.Auth = &config.AuthConfig{Providers: []*config.AuthProviderConfig{
+		{Type: config.AuthToken, Tokens: map[string]string{"s3cret": "ci"}},
+	}}
+	assert.Nil(t, cfg.Validate())
+	repo := newTestRepoWithConfig(t, cfg)
+
+	mockTCPConn := NewMockTCPConn()
+	controller := NewSession(mockTCPConn, repo)
+	defer controller.FinishSession()
+
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "get test\r\n")
+	assert.Equal(t, errAuthRequired, controller.Dispatch())
+	assert.Equal(t, "CLIENT_ERROR Authentication required\r\n", mockTCPConn.WriteBuffer.String())
+
+	mockTCPConn.WriteBuffer.Reset()
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "ping\r\n")
+	assert.Nil(t, controller.Dispatch())
+	assert.Equal(t, "PONG\r\n", mockTCPConn.WriteBuffer.String())
+
+	mockTCPConn.WriteBuffer.Reset()
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "auth wrong\r\n")
+	assert.NotNil(t, controller.Dispatch())
+	assert.Equal(t, "CLIENT_ERROR Authentication failed\r\n", mockTCPConn.WriteBuffer.String())
+	assert.Equal(t, uint64(1), repo.Stats.AuthFailures)
+
+	mockTCPConn.WriteBuffer.Reset()
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "auth s3cret\r\n")
+	assert.Nil(t, controller.Dispatch())
+	assert.Equal(t, "AUTHENTICATED ci\r\n", mockTCPConn.WriteBuffer.String())
+
+	var identity string
+	Use(func(cmd *Command, next Handler) error {
+		if cmd.Identity != nil {
+			identity = cmd.Identity.Name
+		}
+		return next(cmd)
+	})
+	defer func() { middleware = nil }()
+
+	mockTCPConn.WriteBuffer.Reset()
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "set test 0 0 1\r\n1\r\n")
+	assert.Nil(t, controller.Dispatch())
+	assert.Equal(t, "STORED\r\n", mockTCPConn.WriteBuffer.String())
+	assert.Equal(t, "ci", identity)
+}
+
+func Test_Auth_Disabled(t *testing.T) {
+	repo := newTestRepo(t)
+
+	mockTCPConn := NewMockTCPConn()
+	controller := NewSession(mockTCPConn, repo)
+	defer controller.FinishSession()
+
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "auth token\r\n")
+	assert.Equal(t, "CLIENT_ERROR Authentication is not enabled", controller.Dispatch().Error())
+}
+
+func Test_AuthPolicy(t *testing.T) {
+	cfg := config.Default()
+	cfg.Auth = &config.AuthConfig{
+		Providers: []*config.AuthProviderConfig{
+			{Type: config.AuthToken, Tokens: map[string]string{"ci_token": "ci", "ops_token": "ops"}},
+		},
+		Policy: []*config.AuthRule{
+			{Identities: []string{"ci"}, Commands: []string{"set", "bset"}, Queues: []string{"builds_*"}},
+			{Identities: []string{"ops"}, Commands: []string{"*"}},
+		},
+	}
+	assert.Nil(t, cfg.Validate())
+	repo := newTestRepoWithConfig(t, cfg)
+
+	mockTCPConn := NewMockTCPConn()
+	controller := NewSession(mockTCPConn, repo)
+	defer controller.FinishSession()
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "auth ci_token\r\n")
+	assert.Nil(t, controller.Dispatch())
+
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "set builds_linux 0 0 1\r\n1\r\n")
+	assert.Nil(t, controller.Dispatch())
+	for _, command := range []string{"get builds_linux", "flush builds_linux", "stats", "bset builds_linux deploys 0 0 1"} {
+		mockTCPConn.WriteBuffer.Reset()
+		fmt.Fprintf(&mockTCPConn.ReadBuffer, "%s\r\n", command)
+		assert.Equal(t, errForbidden, controller.Dispatch(), command)
+		assert.Equal(t, "CLIENT_ERROR Forbidden\r\n", mockTCPConn.WriteBuffer.String())
+	}
+
+	ops := NewSession(mockTCPConn, repo)
+	defer ops.FinishSession()
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "auth ops_token\r\nget builds_linux/move=deploys\r\n")
+	assert.Nil(t, ops.Dispatch())
+	mockTCPConn.WriteBuffer.Reset()
+	assert.Nil(t, ops.Dispatch())
+	assert.Equal(t, "VALUE builds_linux 0 1\r\n1\r\nEND\r\n", mockTCPConn.WriteBuffer.String())
+}
+
+func Test_AuthPolicy_Patterns(t *testing.T) {
+	cfg := config.Default()
+	cfg.Auth = &config.AuthConfig{
+		Providers: []*config.AuthProviderConfig{
+			{Type: config.AuthToken, Tokens: map[string]string{"viewer_token": "viewer"}},
+		},
+		Policy: []*config.AuthRule{
+			{Identities: []string{"viewer"}, Commands: []string{"stats", "snapshot"}, Queues: []string{"builds_*"}},
+		},
+	}
+	assert.Nil(t, cfg.Validate())
+	repo := newTestRepoWithConfig(t, cfg)
+	repo.GetQueue("builds_linux")
+	repo.GetQueue("deploys")
+
+	mockTCPConn := NewMockTCPConn()
+	controller := NewSession(mockTCPConn, repo)
+	defer controller.FinishSession()
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "auth viewer_token\r\n")
+	assert.Nil(t, controller.Dispatch())
+
+	// Patterns are checked on every matching queue
+	for _, command := range []string{"stats builds_*", "stats queue builds_linux", "stats other_*", "snapshot builds_*"} {
+		fmt.Fprintf(&mockTCPConn.ReadBuffer, "%s\r\n", command)
+		assert.Nil(t, controller.Dispatch(), command)
+	}
+	// Patterns matching other queues and commands without a queue are forbidden
+	for _, command := range []string{"stats *", "stats queue deploys", "stats leveldb", "snapshot *", "stats"} {
+		mockTCPConn.WriteBuffer.Reset()
+		fmt.Fprintf(&mockTCPConn.ReadBuffer, "%s\r\n", command)
+		assert.Equal(t, errForbidden, controller.Dispatch(), command)
+		assert.Equal(t, "CLIENT_ERROR Forbidden\r\n", mockTCPConn.WriteBuffer.String())
+	}
+}
+
+func Test_Auth_Tenant(t *testing.T) {
+	cfg := config.Default()
+	cfg.Auth = &config.AuthConfig{
+		Providers: []*config.AuthProviderConfig{{Type: config.AuthToken, Tokens: map[string]string{"s3cret": "ci"}}},
+		Tenants: map[string]*config.TenantConfig{
+			"builds": {Identities: []string{"ci"}, Queues: []string{"builds_*"}, MaxQueues: 1, MaxEnqueueRate: 1},
+		},
+	}
+	assert.Nil(t, cfg.Validate())
+	repo := newTestRepoWithConfig(t, cfg)
+
+	mockTCPConn := NewMockTCPConn()
+	controller := NewSession(mockTCPConn, repo)
+	defer controller.FinishSession()
+
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "auth s3cret\r\n")
+	assert.Nil(t, controller.Dispatch())
+
+	mockTCPConn.WriteBuffer.Reset()
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "set builds_1 0 0 1\r\n1\r\n")
+	assert.Nil(t, controller.Dispatch())
+	assert.Equal(t, "STORED\r\n", mockTCPConn.WriteBuffer.String())
+
+	mockTCPConn.WriteBuffer.Reset()
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "set builds_1 0 0 1\r\n2\r\n")
+	assert.NotNil(t, controller.Dispatch())
+	assert.Equal(t, "CLIENT_ERROR Enqueue rate quota exceeded\r\n", mockTCPConn.WriteBuffer.String())
+
+	// The session is closed on errors, the rejected data chunk is never read
+	mockTCPConn = NewMockTCPConn()
+	controller = NewSession(mockTCPConn, repo)
+	defer controller.FinishSession()
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "auth s3cret\r\n")
+	assert.Nil(t, controller.Dispatch())
+
+	mockTCPConn.WriteBuffer.Reset()
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "get builds_2\r\n")
+	assert.NotNil(t, controller.Dispatch())
+	assert.Equal(t, "CLIENT_ERROR Queue quota exceeded\r\n", mockTCPConn.WriteBuffer.String())
+
+	mockTCPConn.WriteBuffer.Reset()
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "get other\r\n")
+	assert.Nil(t, controller.Dispatch())
+	assert.Equal(t, "END\r\n", mockTCPConn.WriteBuffer.String())
+}
+
+func Test_Auth_Origin(t *testing.T) {
+	cfg := config.Default()
+	cfg.Auth = &config.AuthConfig{Providers: []*config.AuthProviderConfig{
+		{Type: config.AuthToken, Tokens: map[string]string{"s3cret": "ci", "p33r": "replica"}},
+	}}
+	cfg.Replication = &config.ReplicationConfig{Origin: "dc1", Peers: []string{"127.0.0.1:1"},
+		Queues: []string{"events_*"}, Identities: []string{"replica"}}
+	assert.Nil(t, cfg.Validate())
+	repo := newTestRepoWithConfig(t, cfg)
+
+	for token, expected := range map[string]string{
+		"s3cret": "CLIENT_ERROR Header origin is reserved for replication peers\r\n",
+		"p33r":   "STORED\r\n",
+	} {
+		mockTCPConn := NewMockTCPConn()
+		controller := NewSession(mockTCPConn, repo)
+		fmt.Fprintf(&mockTCPConn.ReadBuffer, "auth %s\r\n", token)
+		assert.Nil(t, controller.Dispatch())
+
+		mockTCPConn.WriteBuffer.Reset()
+		fmt.Fprintf(&mockTCPConn.ReadBuffer, "setmeta events_a 0 0 1 origin=dc2\r\n1\r\n")
+		controller.Dispatch()
+		assert.Equal(t, expected, mockTCPConn.WriteBuffer.String(), token)
+		controller.FinishSession()
+	}
+}
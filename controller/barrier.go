@@ -0,0 +1,46 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strconv"
+	"time"
+)
+
+// Barrier handles BARRIER command, it returns once every item enqueued
+// before the command is dequeued and closed, so scripts can wait for
+// the current backlog to be processed
+// Command: BARRIER <queue> [<timeout milliseconds>]
+// Response: END
+// Response: SERVER_ERROR Barrier timed out
+func (c *Controller) Barrier(input []string) error {
+	if len(input) < 2 || len(input) > 3 {
+		return errors.New("ERROR Invalid input")
+	}
+	ctx := c.ctx
+	if len(input) == 3 {
+		timeout, err := strconv.Atoi(input[2])
+		if err != nil || timeout <= 0 {
+			return errors.New("CLIENT_ERROR Invalid timeout")
+		}
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(timeout)*time.Millisecond)
+		defer cancel()
+	}
+	q, err := c.repo.GetQueue(input[1])
+	if err != nil {
+		log.Printf("Can't GetQueue %s: %s", input[1], err.Error())
+		return errors.New("SERVER_ERROR " + err.Error())
+	}
+	if err = q.Barrier(ctx); err == context.DeadlineExceeded {
+		return errors.New("SERVER_ERROR Barrier timed out")
+	} else if err != nil {
+		return errors.New("SERVER_ERROR " + err.Error())
+	}
+	// The wait may outlast write_timeout set when the command was read
+	c.setCommandDeadlines()
+	c.rw.Writer.WriteString("END\r\n")
+	c.rw.Writer.Flush()
+	return nil
+}
@@ -0,0 +1,69 @@
+package controller
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/bogdanovich/siberite/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Barrier(t *testing.T) {
+	repo := newTestRepo(t)
+
+	mockTCPConn := NewMockTCPConn()
+	controller := NewSession(mockTCPConn, repo)
+	defer controller.FinishSession()
+	consumerConn := NewMockTCPConn()
+	consumer := NewSession(consumerConn, repo)
+	defer consumer.FinishSession()
+
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "barrier test\r\n")
+	assert.Nil(t, controller.Dispatch())
+	assert.Equal(t, "END\r\n", mockTCPConn.WriteBuffer.String())
+
+	fmt.Fprintf(&consumerConn.ReadBuffer, "set test 0 0 1\r\n1\r\n")
+	assert.Nil(t, consumer.Dispatch())
+	fmt.Fprintf(&consumerConn.ReadBuffer, "get test/open\r\n")
+	assert.Nil(t, consumer.Dispatch())
+
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "barrier test 20\r\n")
+	err := controller.Dispatch()
+	assert.Equal(t, "SERVER_ERROR Barrier timed out", err.Error())
+
+	fmt.Fprintf(&consumerConn.ReadBuffer, "get test/close\r\n")
+	assert.Nil(t, consumer.Dispatch())
+	mockTCPConn.WriteBuffer.Reset()
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "barrier test 1000\r\n")
+	assert.Nil(t, controller.Dispatch())
+	assert.Equal(t, "END\r\n", mockTCPConn.WriteBuffer.String())
+
+	err = controller.Barrier([]string{"barrier", "test", "0"})
+	assert.Equal(t, "CLIENT_ERROR Invalid timeout", err.Error())
+	err = controller.Barrier([]string{"barrier"})
+	assert.Equal(t, "ERROR Invalid input", err.Error())
+}
+
+func Test_Barrier_Deadline(t *testing.T) {
+	cfg := config.Default()
+	cfg.WriteTimeout = "100ms"
+	assert.Nil(t, cfg.Validate())
+	repo := newTestRepoWithConfig(t, cfg)
+
+	q, _ := repo.GetQueue("test")
+	q.Enqueue([]byte("1"))
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		q.Dequeue()
+	}()
+
+	// The response of a barrier waiting longer than write_timeout is written in time
+	mockTCPConn := NewMockTCPConn()
+	controller := NewSession(mockTCPConn, repo)
+	defer controller.FinishSession()
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "barrier test\r\n")
+	assert.Nil(t, controller.Dispatch())
+	assert.Equal(t, "END\r\n", mockTCPConn.WriteBuffer.String())
+	assert.True(t, mockTCPConn.WriteDeadline.After(time.Now()))
+}
@@ -0,0 +1,113 @@
+package controller
+
+import (
+	"errors"
+	"log"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/bogdanovich/siberite/protocol"
+	"github.com/bogdanovich/siberite/queue"
+	"github.com/bogdanovich/siberite/repository"
+)
+
+// maxBSetQueues limits queues a value is enqueued to by one BSET
+const maxBSetQueues = 100
+
+// BSet handles BSET command, it enqueues one value to a number of queues
+// Command: BSET <queue> [<queue> ...] <flags> <exptime> <bytes>
+// <data block>
+// Response: STORED
+// Response: QUEUED (inside a transaction, see TXN)
+// The value is enqueued to all queues atomically or to none of them,
+// copies are replicated and fanned out as if stored by SET. Values
+// are limited to 1MB, queue options and deduplication are not supported.
+func (c *Controller) BSet(input []string) error {
+	if len(input) < 5 {
+		return errors.New("ERROR Invalid input")
+	}
+	names := append([]string{}, input[1:len(input)-3]...)
+	flags, err := strconv.ParseUint(input[len(input)-3], 10, 32)
+	if err != nil {
+		return errors.New("ERROR Invalid <flags> number")
+	}
+	exptime, err := strconv.ParseInt(input[len(input)-2], 10, 64)
+	if err != nil {
+		return errors.New("ERROR Invalid <exptime> number")
+	}
+	totalBytes, err := strconv.Atoi(input[len(input)-1])
+	if err != nil || totalBytes < 0 {
+		return errors.New("ERROR Invalid <bytes> number")
+	}
+	if len(names) > maxBSetQueues {
+		return errors.New("ERROR Too many queues")
+	}
+	if totalBytes > queue.ChunkSize {
+		return errors.New("CLIENT_ERROR Value is too large for BSET")
+	}
+	seen := map[string]bool{}
+	for i, name := range names {
+		name = c.repo.PartitionFor(name, nil)
+		names[i] = name
+		if err = c.repo.ValidateName(name); err != nil {
+			return errors.New("CLIENT_ERROR " + err.Error())
+		}
+		if seen[name] {
+			return errors.New("CLIENT_ERROR Duplicate queue " + name)
+		}
+		seen[name] = true
+	}
+
+	value, err := c.readDataBlock(totalBytes)
+	if err != nil {
+		return errors.New("CLIENT_ERROR " + err.Error())
+	}
+	if c.repo.MemoryExceeded() {
+		return errors.New("SERVER_ERROR Out of memory")
+	}
+
+	items := make(map[string][]*queue.Item, len(names))
+	expires := protocol.ExpiresAt(exptime, 0, time.Now())
+	for _, name := range names {
+		item := &queue.Item{Flags: uint32(flags), ExpiresAt: expires, Value: value}
+		if !c.repo.Writable(name, item) {
+			return errors.New("SERVER_ERROR Queue is read-only on a follower")
+		}
+		if c.repo.SnapshotLoading(name) {
+			return errors.New("SERVER_ERROR Queue snapshot is loading")
+		}
+		items[name] = []*queue.Item{item}
+	}
+
+	if c.txn != nil {
+		for _, name := range names {
+			if err = c.txn.stage(name, items[name][0]); err != nil {
+				return err
+			}
+			c.repo.TrackMemory(repository.MemoryTransactions, int64(len(value)))
+		}
+		c.rw.Writer.WriteString("QUEUED\r\n")
+		c.rw.Writer.Flush()
+		return nil
+	}
+
+	items = c.repo.RouteAll(items)
+	if err = c.repo.EnqueueAll(items); err != nil {
+		log.Printf("Can't enqueue to %v: %s", names, err.Error())
+		return errors.New("SERVER_ERROR " + err.Error())
+	}
+	var count uint64
+	for name, list := range items {
+		for _, item := range list {
+			c.repo.Enqueued(name, item, c.id)
+			c.observeItem(item)
+			count++
+		}
+	}
+	c.rw.Writer.WriteString("STORED\r\n")
+	c.rw.Writer.Flush()
+	atomic.AddUint64(&c.repo.Stats.CmdSet, 1)
+	atomic.AddUint64(&c.repo.Stats.TotalItems, count)
+	return nil
+}
@@ -0,0 +1,50 @@
+package controller
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/bogdanovich/siberite/queue"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_BSet(t *testing.T) {
+	repo := newTestRepo(t)
+
+	mockTCPConn := NewMockTCPConn()
+	controller := NewSession(mockTCPConn, repo)
+	defer controller.FinishSession()
+
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "bset work audit 5 0 3\r\nabc\r\n")
+	assert.Nil(t, controller.Dispatch())
+	assert.Equal(t, "STORED\r\n", mockTCPConn.WriteBuffer.String())
+	assert.Equal(t, uint64(2), repo.Stats.TotalItems)
+	for _, name := range []string{"work", "audit"} {
+		q, _ := repo.GetQueue(name)
+		item, err := q.Dequeue()
+		assert.Nil(t, err)
+		assert.Equal(t, "abc", string(item.Value))
+		assert.Equal(t, uint32(5), item.Flags)
+	}
+
+	// Copies are staged in a transaction
+	mockTCPConn.WriteBuffer.Reset()
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "txn begin\r\nbset work audit 0 0 1\r\n1\r\ntxn commit\r\n")
+	for i := 0; i < 3; i++ {
+		assert.Nil(t, controller.Dispatch())
+	}
+	assert.Equal(t, "END\r\nQUEUED\r\nCOMMITTED 2\r\nEND\r\n", mockTCPConn.WriteBuffer.String())
+
+	for input, expected := range map[string]string{
+		"bset 0 0 1":                   "ERROR Invalid input",
+		"bset work 0 0 x":              "ERROR Invalid <bytes> number",
+		"bset work 0 0 -2":             "ERROR Invalid <bytes> number",
+		"bset work work 0 0 1":         "CLIENT_ERROR Duplicate queue work",
+		"bset work w/ttl=1 0 0 1":      "CLIENT_ERROR " + queue.ErrInvalidName.Error(),
+		"bset work audit 0 0 99999999": "CLIENT_ERROR Value is too large for BSET",
+	} {
+		err := controller.BSet(strings.Split(input, " "))
+		assert.Equal(t, expected, err.Error(), input)
+	}
+}
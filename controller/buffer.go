@@ -0,0 +1,28 @@
+package controller
+
+import "sync"
+
+// maxPooledBuffer limits size of buffers returned to the pool,
+// so a single large response doesn't stay allocated
+const maxPooledBuffer = 4096
+
+var buffers = sync.Pool{
+	New: func() interface{} {
+		buf := make([]byte, 0, 256)
+		return &buf
+	},
+}
+
+// getBuffer returns an empty response buffer from the pool
+func getBuffer() *[]byte {
+	buf := buffers.Get().(*[]byte)
+	*buf = (*buf)[:0]
+	return buf
+}
+
+// putBuffer returns a response buffer to the pool
+func putBuffer(buf *[]byte) {
+	if cap(*buf) <= maxPooledBuffer {
+		buffers.Put(buf)
+	}
+}
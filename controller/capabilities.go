@@ -0,0 +1,56 @@
+package controller
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/bogdanovich/siberite/protocol"
+	"github.com/bogdanovich/siberite/queue"
+)
+
+// ProtocolVersion is increased when commands change incompatibly
+const ProtocolVersion = 1
+
+// capabilities are extensions of the kestrel protocol supported by the server
+var capabilities = []string{
+	"fanout", "ttl", "dedup", "headers", "bset", "transactions",
+	"delayed_abort", "abort_tail", "prefetch", "session_resume",
+	"extset", "extget", "errcodes", "verbose", "barrier", "auth", "frames",
+	"open_by_id", "config", "consume", "watch", "replay_last", "partitions",
+	"deliveries", "msgid",
+}
+
+// Capabilities handles CAPABILITIES command
+// Command: CAPABILITIES
+// Response:
+// CAPABILITY protocol 1
+// CAPABILITY version siberite-x.y.z
+// CAPABILITY max_item_size 2147483647
+// ...
+// CAPABILITY fanout
+// ...
+// END
+// Limits of zero are unlimited.
+func (c *Controller) Capabilities() error {
+	limits := []struct{ name, value string }{
+		{"protocol", strconv.Itoa(ProtocolVersion)},
+		{"version", c.repo.Stats.Version},
+		{"max_item_size", strconv.FormatInt(c.repo.Config().ItemSize(), 10)},
+		{"max_bset_item_size", strconv.Itoa(queue.ChunkSize)},
+		{"max_bset_queues", strconv.Itoa(maxBSetQueues)},
+		{"max_txn_items", strconv.Itoa(maxTxnItems)},
+		{"max_txn_bytes", strconv.Itoa(maxTxnBytes)},
+		{"max_txn_item_size", strconv.Itoa(queue.ChunkSize)},
+		{"max_headers", strconv.Itoa(protocol.MaxHeaders)},
+		{"max_headers_size", strconv.Itoa(protocol.MaxHeadersSize)},
+	}
+	for _, limit := range limits {
+		fmt.Fprintf(c.rw.Writer, "CAPABILITY %s %s\r\n", limit.name, limit.value)
+	}
+	for _, name := range capabilities {
+		fmt.Fprintf(c.rw.Writer, "CAPABILITY %s\r\n", name)
+	}
+	c.rw.Writer.WriteString("END\r\n")
+	c.rw.Writer.Flush()
+	return nil
+}
@@ -0,0 +1,27 @@
+package controller
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Capabilities(t *testing.T) {
+	repo := newTestRepo(t)
+	mockTCPConn := NewMockTCPConn()
+	controller := NewSession(mockTCPConn, repo)
+	defer controller.FinishSession()
+
+	err := controller.Capabilities()
+	assert.Nil(t, err)
+	response := mockTCPConn.WriteBuffer.String()
+	lines := strings.Split(strings.TrimSuffix(response, "\r\n"), "\r\n")
+	assert.Equal(t, "CAPABILITY protocol 1", lines[0])
+	assert.Equal(t, "CAPABILITY version "+repo.Stats.Version, lines[1])
+	assert.Contains(t, lines, "CAPABILITY max_item_size 2147483647")
+	assert.Contains(t, lines, "CAPABILITY max_bset_item_size 1048576")
+	assert.Contains(t, lines, "CAPABILITY fanout")
+	assert.Contains(t, lines, "CAPABILITY ttl")
+	assert.Equal(t, "END", lines[len(lines)-1])
+}
@@ -0,0 +1,72 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bogdanovich/siberite/chaos"
+)
+
+// Chaos handles CHAOS command, it injects faults for testing client
+// retry logic and is allowed with "chaos": true configuration only
+// Command: CHAOS [delay=<milliseconds>] [fail=<percent>] [drop=<percent>]
+// Storage operations are delayed and fail with SERVER_ERROR at a given
+// rate, commands drop the connection at a given rate, omitted options
+// are zero, CHAOS without options shows current settings
+// Command: CHAOS off
+// Response:
+// CHAOS delay_ms=<n> fail=<percent> drop=<percent> failed=<n> dropped=<n>
+// END
+func (c *Controller) Chaos(input []string) error {
+	if !c.repo.Config().Chaos {
+		return errors.New("CLIENT_ERROR Chaos mode is disabled")
+	}
+	if len(input) == 2 && input[1] == "off" {
+		chaos.Set(chaos.Faults{})
+	} else if len(input) > 1 {
+		faults, err := parseFaults(input[1:])
+		if err != nil {
+			return err
+		}
+		chaos.Set(faults)
+	}
+
+	f := chaos.Current()
+	failed, dropped := chaos.Counts()
+	fmt.Fprintf(c.rw.Writer, "CHAOS delay_ms=%d fail=%d drop=%d failed=%d dropped=%d\r\nEND\r\n",
+		f.Delay/time.Millisecond, f.FailPercent, f.DropPercent, failed, dropped)
+	c.rw.Writer.Flush()
+	return nil
+}
+
+// parseFaults parses <option>=<value> arguments of CHAOS command
+func parseFaults(options []string) (chaos.Faults, error) {
+	var f chaos.Faults
+	for _, option := range options {
+		kv := strings.SplitN(option, "=", 2)
+		if len(kv) != 2 {
+			return f, errors.New("CLIENT_ERROR Invalid chaos option " + option)
+		}
+		value, err := strconv.Atoi(kv[1])
+		if err != nil || value < 0 {
+			return f, errors.New("CLIENT_ERROR Invalid chaos option " + option)
+		}
+		switch kv[0] {
+		case "delay":
+			f.Delay = time.Duration(value) * time.Millisecond
+		case "fail":
+			f.FailPercent = value
+		case "drop":
+			f.DropPercent = value
+		default:
+			return f, errors.New("CLIENT_ERROR Invalid chaos option " + option)
+		}
+		if value > 100 && kv[0] != "delay" {
+			return f, errors.New("CLIENT_ERROR Invalid chaos option " + option)
+		}
+	}
+	return f, nil
+}
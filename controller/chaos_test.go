@@ -0,0 +1,62 @@
+package controller
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/bogdanovich/siberite/chaos"
+	"github.com/bogdanovich/siberite/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Chaos(t *testing.T) {
+	cfg := config.Default()
+	cfg.Chaos = true
+	assert.Nil(t, cfg.Validate())
+	repo := newTestRepoWithConfig(t, cfg)
+	defer chaos.Set(chaos.Faults{})
+
+	mockTCPConn := NewMockTCPConn()
+	controller := NewSession(mockTCPConn, repo)
+	defer controller.FinishSession()
+
+	failed, dropped := chaos.Counts()
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "chaos delay=1 fail=100\r\n")
+	assert.Nil(t, controller.Dispatch())
+	assert.Equal(t, fmt.Sprintf("CHAOS delay_ms=1 fail=100 drop=0 failed=%d dropped=%d\r\nEND\r\n", failed, dropped),
+		mockTCPConn.WriteBuffer.String())
+
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "set test 0 0 1\r\n1\r\n")
+	err := controller.Dispatch()
+	assert.Equal(t, "SERVER_ERROR Injected storage failure", err.Error())
+	// A failed read is not answered as an empty queue, with prefetch too
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "get test\r\n")
+	err = controller.Dispatch()
+	assert.Equal(t, "SERVER_ERROR Injected storage failure", err.Error())
+	controller.prefetch.size = 2
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "get test/open\r\n")
+	err = controller.Dispatch()
+	assert.Equal(t, "SERVER_ERROR Injected storage failure", err.Error())
+	controller.prefetch.size = 0
+
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "chaos drop=100\r\n")
+	assert.Nil(t, controller.Dispatch())
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "version\r\n")
+	assert.Equal(t, chaos.ErrDropped, controller.Dispatch())
+
+	chaos.Set(chaos.Faults{})
+	mockTCPConn.WriteBuffer.Reset()
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "chaos off\r\n")
+	assert.Nil(t, controller.Dispatch())
+	assert.Equal(t, fmt.Sprintf("CHAOS delay_ms=0 fail=0 drop=0 failed=%d dropped=%d\r\nEND\r\n", failed+3, dropped+1),
+		mockTCPConn.WriteBuffer.String())
+
+	for _, options := range [][]string{{"fail"}, {"fail=101"}, {"delay=-1"}, {"slow=1"}} {
+		_, err = parseFaults(options)
+		assert.NotNil(t, err, options[0])
+	}
+
+	cfg.Chaos = false
+	err = controller.Chaos([]string{"chaos", "off"})
+	assert.Equal(t, "CLIENT_ERROR Chaos mode is disabled", err.Error())
+}
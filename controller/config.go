@@ -0,0 +1,74 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/bogdanovich/siberite/config"
+)
+
+// Config handles CONFIG command, it shows and changes settings
+// tunable at runtime, see config.Tunables
+// Command: CONFIG GET [<setting>]
+// Response:
+// CONFIG <setting> <value>
+// ...
+// END
+// Command: CONFIG SET <setting> <value>
+// Response: END
+// Durations are given as in the configuration file, e.g. 30s.
+// Only admins change settings, see isAdmin.
+func (c *Controller) Config(input []string) error {
+	if len(input) < 2 {
+		return errors.New("ERROR Invalid input")
+	}
+	switch strings.ToLower(input[1]) {
+	case "get":
+		return c.configGet(input)
+	case "set":
+		return c.configSet(input)
+	}
+	return errors.New("ERROR Invalid input")
+}
+
+func (c *Controller) configGet(input []string) error {
+	keys := config.Tunables
+	if len(input) == 3 {
+		keys = input[2:]
+	} else if len(input) != 2 {
+		return errors.New("ERROR Invalid input")
+	}
+	values := make([]string, len(keys))
+	for i, key := range keys {
+		value, err := c.repo.Config().Get(key)
+		if err != nil {
+			return errors.New("CLIENT_ERROR Unknown setting " + key)
+		}
+		values[i] = value
+	}
+	for i, key := range keys {
+		fmt.Fprintf(c.rw.Writer, "CONFIG %s %s\r\n", key, values[i])
+	}
+	c.rw.Writer.WriteString("END\r\n")
+	c.rw.Writer.Flush()
+	return nil
+}
+
+func (c *Controller) configSet(input []string) error {
+	if len(input) != 4 {
+		return errors.New("ERROR Invalid input")
+	}
+	if !c.isAdmin() {
+		return errForbidden
+	}
+	key, value := input[2], input[3]
+	if err := c.repo.SetConfig(key, value, c.id); err == config.ErrUnknownSetting {
+		return errors.New("CLIENT_ERROR Unknown setting " + key)
+	} else if err != nil {
+		return errors.New("CLIENT_ERROR Invalid value " + value)
+	}
+	c.rw.Writer.WriteString("END\r\n")
+	c.rw.Writer.Flush()
+	return nil
+}
@@ -0,0 +1,100 @@
+package controller
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bogdanovich/siberite/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Config(t *testing.T) {
+	cfg := config.Default()
+	auditPath := filepath.Join(t.TempDir(), "audit.log")
+	cfg.Audit = &config.AuditConfig{Path: auditPath}
+	assert.Nil(t, cfg.Validate())
+	repo := newTestRepoWithConfig(t, cfg)
+	mockTCPConn := NewMockTCPConn()
+	controller := NewSession(mockTCPConn, repo)
+	defer controller.FinishSession()
+
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "config set slowlog_threshold 5ms\r\n")
+	assert.Nil(t, controller.Dispatch())
+	assert.Equal(t, "END\r\n", mockTCPConn.WriteBuffer.String())
+
+	mockTCPConn.WriteBuffer.Reset()
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "config get slowlog_threshold\r\n")
+	assert.Nil(t, controller.Dispatch())
+	assert.Equal(t, "CONFIG slowlog_threshold 5ms\r\nEND\r\n", mockTCPConn.WriteBuffer.String())
+
+	mockTCPConn.WriteBuffer.Reset()
+	assert.Nil(t, controller.Config([]string{"config", "get"}))
+	lines := strings.Split(mockTCPConn.WriteBuffer.String(), "\r\n")
+	assert.Equal(t, len(config.Tunables)+2, len(lines))
+	assert.Equal(t, "CONFIG tcp_keepalive 1m0s", lines[0])
+
+	mockTCPConn.WriteBuffer.Reset()
+	assert.Nil(t, controller.ConfigStats())
+	output := mockTCPConn.WriteBuffer.String()
+	assert.Contains(t, output, "STAT config_slowlog_threshold 5ms\r\n")
+	assert.Contains(t, output, "STAT config_changes 1\r\n")
+
+	err := controller.Config([]string{"config", "set", "chaos", "true"})
+	assert.Equal(t, "CLIENT_ERROR Unknown setting chaos", err.Error())
+	err = controller.Config([]string{"config", "set", "max_memory", "-1"})
+	assert.Equal(t, "CLIENT_ERROR Invalid value -1", err.Error())
+	err = controller.Config([]string{"config", "get", "chaos"})
+	assert.Equal(t, "CLIENT_ERROR Unknown setting chaos", err.Error())
+	err = controller.Config([]string{"config", "set", "max_memory"})
+	assert.Equal(t, "ERROR Invalid input", err.Error())
+
+	data, err := ioutil.ReadFile(auditPath)
+	assert.Nil(t, err)
+	assert.Contains(t, string(data), " config key=slowlog_threshold value=5ms conn=")
+}
+
+type mockRemoteConn struct {
+	*MockTCPConn
+	addr net.Addr
+}
+
+func (conn *mockRemoteConn) RemoteAddr() net.Addr { return conn.addr }
+
+func Test_Config_Admins(t *testing.T) {
+	repo := newTestRepo(t)
+
+	remote := &mockRemoteConn{NewMockTCPConn(), &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 4000}}
+	controller := NewSession(remote, repo)
+	defer controller.FinishSession()
+	err := controller.Config([]string{"config", "set", "slowlog_size", "64"})
+	assert.Equal(t, errForbidden, err)
+	assert.Nil(t, controller.Config([]string{"config", "get", "slowlog_size"}))
+
+	local := &mockRemoteConn{NewMockTCPConn(), &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 4000}}
+	controller = NewSession(local, repo)
+	defer controller.FinishSession()
+	assert.Nil(t, controller.Config([]string{"config", "set", "slowlog_size", "64"}))
+
+	cfg := config.Default()
+	cfg.Auth = &config.AuthConfig{
+		Providers: []*config.AuthProviderConfig{
+			{Type: config.AuthToken, Tokens: map[string]string{"ci_token": "ci", "ops_token": "ops"}},
+		},
+		Admins: []string{"ops"},
+	}
+	assert.Nil(t, cfg.Validate())
+	authRepo := newTestRepoWithConfig(t, cfg)
+
+	for token, expected := range map[string]error{"ci_token": errForbidden, "ops_token": nil} {
+		mockTCPConn := NewMockTCPConn()
+		controller := NewSession(mockTCPConn, authRepo)
+		fmt.Fprintf(&mockTCPConn.ReadBuffer, "auth %s\r\nconfig set slowlog_size 64\r\n", token)
+		assert.Nil(t, controller.Dispatch())
+		assert.Equal(t, expected, controller.Dispatch(), token)
+		controller.FinishSession()
+	}
+}
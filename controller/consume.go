@@ -0,0 +1,146 @@
+package controller
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// Limits of CONSUME arguments
+const (
+	maxConsumeQueues = 100
+	maxConsumeWeight = 1000
+)
+
+// weightedQueue is a queue of CONSUME with its smooth weighted round robin state
+type weightedQueue struct {
+	name    string
+	weight  int
+	current int
+}
+
+// consumer keeps CONSUME state of a session, so deliveries stay
+// proportional to weights across commands with the same arguments
+type consumer struct {
+	spec   string
+	queues []*weightedQueue
+}
+
+// Consume handles CONSUME command, it takes an item from one of several
+// queues, interleaving deliveries proportionally to queue weights.
+// Empty queues are skipped, so a backlog in one queue doesn't starve others.
+// Command: CONSUME <queue>=<weight> [<queue>=<weight> ...] [open]
+// Response:
+// VALUE <queue> <flags> <bytes>
+// <data block>
+// END
+// An item taken with open is closed or aborted with GET <queue>/close or
+// GET <queue>/abort naming a queue from the VALUE line.
+func (c *Controller) Consume(input []string) error {
+	args := input[1:]
+	subCommand := ""
+	if len(args) > 0 && args[len(args)-1] == "open" {
+		subCommand = "open"
+		args = args[:len(args)-1]
+	}
+	cons, err := c.consumerOf(args)
+	if err != nil {
+		return err
+	}
+	if subCommand == "open" && c.currentItem != nil {
+		return errors.New("CLIENT_ERROR " + "Close current item first")
+	}
+
+	if err = c.consumeFrom(cons, subCommand); err != nil {
+		return err
+	}
+	c.rw.Writer.WriteString("END\r\n")
+	c.rw.Writer.Flush()
+	return nil
+}
+
+// consumeFrom sends an item of one of consumer queues picked by weight
+func (c *Controller) consumeFrom(cons *consumer, subCommand string) error {
+	candidates := make([]*weightedQueue, 0, len(cons.queues))
+	for _, wq := range cons.queues {
+		// Queues are not created by CONSUME, missing ones are empty
+		if q, ok := c.repo.Lookup(wq.name); ok && q.Length() > 0 {
+			candidates = append(candidates, wq)
+		}
+	}
+	for len(candidates) > 0 {
+		i := pickWeighted(candidates)
+		cmd := &Command{Name: "get", QueueName: candidates[i].name, SubCommand: subCommand, Context: c.ctx}
+		delivered, err := c.getItem(cmd)
+		if err != nil {
+			return err
+		}
+		if delivered {
+			break
+		}
+		// Remaining items are delayed or taken by other consumers meanwhile
+		candidates = append(candidates[:i], candidates[i+1:]...)
+	}
+	return nil
+}
+
+// consumerOf returns CONSUME state of the session for given arguments,
+// the state is reset when arguments change
+func (c *Controller) consumerOf(args []string) (*consumer, error) {
+	if len(args) == 0 || len(args) > maxConsumeQueues {
+		return nil, errors.New("ERROR Invalid input")
+	}
+	spec := strings.Join(args, " ")
+	if c.consumer != nil && c.consumer.spec == spec {
+		return c.consumer, nil
+	}
+	cons := &consumer{spec: spec}
+	seen := map[string]bool{}
+	for _, arg := range args {
+		i := strings.LastIndexByte(arg, '=')
+		if i <= 0 {
+			return nil, errors.New("ERROR Invalid input")
+		}
+		weight, err := strconv.Atoi(arg[i+1:])
+		if err != nil || weight < 1 || weight > maxConsumeWeight {
+			return nil, errors.New("ERROR Invalid <weight> " + arg[i+1:])
+		}
+		name := arg[:i]
+		if err := c.repo.ValidateName(name); err != nil {
+			return nil, errors.New("CLIENT_ERROR " + err.Error())
+		}
+		if seen[name] {
+			return nil, errors.New("ERROR Invalid input")
+		}
+		seen[name] = true
+		cons.queues = append(cons.queues, &weightedQueue{name: name, weight: weight})
+	}
+	c.consumer = cons
+	return cons, nil
+}
+
+// pickWeighted selects a queue by smooth weighted round robin: every queue
+// gains its weight, the one with the most is picked and pays back the total
+func pickWeighted(queues []*weightedQueue) int {
+	best, total := 0, 0
+	for i, wq := range queues {
+		wq.current += wq.weight
+		total += wq.weight
+		if wq.current > queues[best].current {
+			best = i
+		}
+	}
+	queues[best].current -= total
+	return best
+}
+
+// consumeQueues returns queue names of CONSUME arguments
+func consumeQueues(args []string) []string {
+	queues := []string{}
+	for _, arg := range args[1:] {
+		if i := strings.LastIndexByte(arg, '='); i > 0 {
+			queues = append(queues, arg[:i])
+		}
+	}
+	return queues
+}
@@ -0,0 +1,66 @@
+package controller
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Consume(t *testing.T) {
+	repo := newTestRepo(t)
+
+	high, _ := repo.GetQueue("high")
+	low, _ := repo.GetQueue("low")
+	for i := 0; i < 10; i++ {
+		high.Enqueue([]byte("h"))
+	}
+	low.Enqueue([]byte("l"))
+	low.Enqueue([]byte("l"))
+
+	mockTCPConn := NewMockTCPConn()
+	controller := NewSession(mockTCPConn, repo)
+	defer controller.FinishSession()
+
+	consumed := ""
+	consume := func(args ...string) string {
+		mockTCPConn.WriteBuffer.Reset()
+		assert.Nil(t, controller.Consume(append([]string{"consume"}, args...)))
+		response := mockTCPConn.WriteBuffer.String()
+		if strings.HasPrefix(response, "VALUE ") {
+			consumed += strings.Fields(response)[1][:1]
+		}
+		return response
+	}
+	for i := 0; i < 8; i++ {
+		consume("high=3", "low=1")
+	}
+	assert.Equal(t, "hhlhhhlh", consumed)
+
+	// The low queue is empty, high is not starved meanwhile
+	consumed = ""
+	for i := 0; i < 4; i++ {
+		consume("high=3", "low=1")
+	}
+	assert.Equal(t, "hhhh", consumed)
+	assert.Equal(t, "END\r\n", consume("high=3", "low=1"))
+	assert.Equal(t, "END\r\n", consume("typo=1"))
+	_, ok := repo.Lookup("typo")
+	assert.False(t, ok)
+
+	low.Enqueue([]byte("l"))
+	assert.Equal(t, "VALUE low 0 1\r\nl\r\nEND\r\n", consume("high=3", "low=1", "open"))
+	assert.Equal(t, int64(1), low.Stats.OpenTransactions)
+	err := controller.Consume([]string{"consume", "high=3", "low=1", "open"})
+	assert.Equal(t, "CLIENT_ERROR Close current item first", err.Error())
+	assert.Nil(t, controller.Get([]string{"get", "low/close"}))
+	assert.Equal(t, int64(0), low.Stats.OpenTransactions)
+
+	for _, args := range [][]string{{"consume"}, {"consume", "high"}, {"consume", "high=1", "high=2"}} {
+		err = controller.Consume(args)
+		assert.Equal(t, "ERROR Invalid input", err.Error(), args)
+	}
+	err = controller.Consume([]string{"consume", "high=0"})
+	assert.Equal(t, "ERROR Invalid <weight> 0", err.Error())
+	assert.Equal(t, []string{"high", "low"}, consumeQueues([]string{"consume", "high=3", "low=1", "open"}))
+}
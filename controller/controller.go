@@ -2,14 +2,20 @@ package controller
 
 import (
 	"bufio"
+	"context"
 	"errors"
 	"fmt"
 	"io"
+	"log"
 	"sync/atomic"
 	"time"
 
+	"github.com/bogdanovich/siberite/auth"
+	"github.com/bogdanovich/siberite/config"
+	"github.com/bogdanovich/siberite/errcode"
 	"github.com/bogdanovich/siberite/queue"
 	"github.com/bogdanovich/siberite/repository"
+	"github.com/bogdanovich/siberite/trace"
 )
 
 // Conn represents a connection interface
@@ -17,15 +23,51 @@ type Conn interface {
 	io.Reader
 	io.Writer
 	SetDeadline(t time.Time) error
+	SetReadDeadline(t time.Time) error
+	SetWriteDeadline(t time.Time) error
 }
 
 // Controller represents a connection controller
 type Controller struct {
+	id             uint64
 	conn           Conn
 	rw             *bufio.ReadWriter
 	repo           *repository.QueueRepository
 	currentItem    *queue.Item
 	currentCommand *Command
+	command        *Command
+	txn            *transaction
+	span           trace.Span
+	// buffers is memory of bufio reader and writer of the session
+	buffers int64
+	// extendedSet makes SET report queue length, see EXTSET
+	extendedSet bool
+	// extendedGet makes GET report queue length, see EXTGET
+	extendedGet bool
+	// errorCodes adds codes to error responses, see ERRCODES
+	errorCodes bool
+	// verbose follows responses with diagnostics, see VERBOSE
+	verbose bool
+	// prefetch keeps items reserved ahead, see PREFETCH
+	prefetch prefetchBuffer
+	// consumer keeps weighted round robin state, see CONSUME
+	consumer *consumer
+	// held are items opened by id, see CLOSE and ABORT
+	held   map[heldKey]*heldItem
+	heldID uint64
+	// replay keeps items consumed last, see REPLAY_LAST
+	replay replayBuffer
+	// frames is set once the client switches to protocol v2, see FramePreamble
+	frames *framed
+	// identity is an authenticated client, see AUTH
+	identity *auth.Identity
+	// token identifies the session for RESUME, see SESSION
+	token string
+	// ctx is cancelled when the client disconnects or the repository is closed
+	ctx    context.Context
+	cancel context.CancelFunc
+	// info is listed by STATS conns
+	info sessionInfo
 }
 
 // Command represents a client command
@@ -34,24 +76,80 @@ type Command struct {
 	QueueName  string
 	SubCommand string
 	DataSize   int
+	Meta       bool
+	Index      uint64
+	// Args are command tokens as sent by the client, Args[0] is the command name
+	Args []string
+	// Item is an item stored by SET or returned by GET, see Middleware
+	Item *queue.Item
+	// Context is the session context, see Controller.Context
+	Context context.Context
+	// Timeout is a t=<milliseconds> option, abort delay for GET <queue>/abort
+	Timeout time.Duration
+	// Timestamp adds enqueue time to VALUE lines, GET <queue>/ts
+	Timestamp bool
+	// Deliveries adds a number of times an item was opened
+	// to VALUE lines, GET <queue>/deliveries
+	Deliveries bool
+	// MessageID adds a message id to VALUE lines, GET <queue>/msgid
+	MessageID bool
+	// MoveTo is a processing queue of GET <queue>/move=<queue>
+	MoveTo string
+	// ByID opens an item in addition to open items, GET <queue>/open/id
+	ByID bool
+	// Identity is an authenticated client, nil if authentication is disabled
+	Identity *auth.Identity
 }
 
 // NewSession creates and initializes new controller
 func NewSession(conn Conn, repo *repository.QueueRepository) *Controller {
-	atomic.AddUint64(&repo.Stats.TotalConnections, 1)
+	id := atomic.AddUint64(&repo.Stats.TotalConnections, 1)
 	atomic.AddUint64(&repo.Stats.CurrentConnections, 1)
-	rw := bufio.NewReadWriter(bufio.NewReader(conn), bufio.NewWriter(conn))
-	return &Controller{conn, rw, repo, nil, nil}
+	readBuffer, writeBuffer := config.DefaultSessionBuffer, config.DefaultSessionBuffer
+	if network := repo.Config().Network; network != nil {
+		readBuffer, writeBuffer = network.ReadBuffer, network.WriteBuffer
+	}
+	rw := bufio.NewReadWriter(bufio.NewReaderSize(conn, readBuffer), bufio.NewWriterSize(conn, writeBuffer))
+	ctx, cancel := context.WithCancel(repo.Context())
+	c := &Controller{id: id, conn: conn, rw: rw, repo: repo, ctx: ctx, cancel: cancel}
+	c.buffers = int64(readBuffer + writeBuffer)
+	repo.TrackMemory(repository.MemoryConnections, c.buffers)
+	c.register()
+	return c
+}
+
+// Context returns a session context, it is cancelled when
+// the session finishes or the repository is closed
+func (c *Controller) Context() context.Context {
+	return c.ctx
 }
 
-// FinishSession aborts unfinished transaction
+// FinishSession aborts unfinished transaction and cancels session context,
+// items of a session with a resume token are kept for resume_grace instead
 func (c *Controller) FinishSession() {
-	if c.currentItem != nil {
-		c.abort(c.currentCommand)
+	c.cancel()
+	if !c.park() {
+		c.release()
 	}
+	c.repo.TrackMemory(repository.MemoryConnections, -c.buffers)
+	c.unregister()
 	atomic.AddUint64(&c.repo.Stats.CurrentConnections, ^uint64(0))
 }
 
+// release returns items held by a finished session to their queues
+func (c *Controller) release() {
+	// Reserved items go back first, so an aborted open item stays ahead of them
+	c.releasePrefetched()
+	if c.currentItem != nil {
+		c.abortOnDisconnect(c.currentCommand)
+	}
+	c.releaseHeld()
+	c.releaseTxn()
+	c.releaseReplay()
+	// An item failed to abort is not held by the session anymore
+	c.repo.TrackMemory(repository.MemoryOpenItems, -itemMemory(c.currentItem))
+}
+
 // ReadFirstMessage reads initial message from connection buffer
 func (c *Controller) ReadFirstMessage() (string, error) {
 	return c.rw.Reader.ReadString('\n')
@@ -66,12 +164,71 @@ func (c *Controller) UnknownCommand() error {
 
 //SendError sends an error message to the client
 func (c *Controller) SendError(errorMessage string) {
+	if c.errorCodes {
+		errorMessage = errcode.Format(errorMessage)
+	}
 	fmt.Fprintf(c.rw.Writer, "%s\r\n", errorMessage)
 	c.rw.Writer.Flush()
 }
 
+// setCommandDeadlines limits time a client has to send command payload
+// and to receive a response, long transfers call it again to extend deadlines
+func (c *Controller) setCommandDeadlines() {
+	now := time.Now()
+	read, write := c.repo.Config().Timeouts()
+	if read > 0 {
+		c.conn.SetReadDeadline(now.Add(read))
+	} else {
+		c.conn.SetReadDeadline(time.Time{})
+	}
+	if write > 0 {
+		c.conn.SetWriteDeadline(now.Add(write))
+	} else {
+		c.conn.SetWriteDeadline(time.Time{})
+	}
+}
+
+// deadlineWriter extends command deadlines on every write to w
+type deadlineWriter struct {
+	c *Controller
+	w io.Writer
+}
+
+func (w deadlineWriter) Write(p []byte) (int, error) {
+	w.c.setCommandDeadlines()
+	return w.w.Write(p)
+}
+
+// startSpan starts a queue operation span as a child of the current command
+func (c *Controller) startSpan(name string, cmd *Command) trace.Span {
+	span := trace.Start(name, c.span, "")
+	span.SetAttribute("queue", cmd.QueueName)
+	return span
+}
+
+// audit records an item operation in the audit log
+func (c *Controller) audit(event string, queueName string, item *queue.Item) {
+	if err := c.repo.Audit.Record(event, queueName, c.id, item.UniqueID()); err != nil {
+		log.Printf("Can't write audit log: %s", err.Error())
+	}
+}
+
 // Save current unconfirmed item
 func (c *Controller) setCurrentState(cmd *Command, item *queue.Item) {
+	c.repo.TrackMemory(repository.MemoryOpenItems, itemMemory(item)-itemMemory(c.currentItem))
 	c.currentCommand = cmd
 	c.currentItem = item
+	if cmd != nil {
+		c.observeOpen(cmd.QueueName)
+	} else {
+		c.observeOpen("")
+	}
+}
+
+// itemMemory is memory held by a value of an open item
+func itemMemory(item *queue.Item) int64 {
+	if item == nil {
+		return 0
+	}
+	return int64(len(item.Value))
 }
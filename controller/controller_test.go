@@ -3,10 +3,15 @@ package controller
 import (
 	"bytes"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"runtime"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/bogdanovich/siberite/config"
 	"github.com/bogdanovich/siberite/repository"
 	"github.com/stretchr/testify/assert"
 )
@@ -16,8 +21,10 @@ var name = "test"
 var err error
 
 type MockTCPConn struct {
-	WriteBuffer bytes.Buffer
-	ReadBuffer  bytes.Buffer
+	WriteBuffer   bytes.Buffer
+	ReadBuffer    bytes.Buffer
+	ReadDeadline  time.Time
+	WriteDeadline time.Time
 }
 
 func NewMockTCPConn() *MockTCPConn {
@@ -34,6 +41,18 @@ func (conn *MockTCPConn) Write(b []byte) (int, error) {
 }
 
 func (conn *MockTCPConn) SetDeadline(t time.Time) error {
+	conn.ReadDeadline = t
+	conn.WriteDeadline = t
+	return nil
+}
+
+func (conn *MockTCPConn) SetReadDeadline(t time.Time) error {
+	conn.ReadDeadline = t
+	return nil
+}
+
+func (conn *MockTCPConn) SetWriteDeadline(t time.Time) error {
+	conn.WriteDeadline = t
 	return nil
 }
 
@@ -49,9 +68,7 @@ func TestMain(m *testing.M) {
 }
 
 func Test_NewSession_FinishSession(t *testing.T) {
-	repo, err := repository.Initialize(dir)
-	defer repo.CloseAllQueues()
-	assert.Nil(t, err)
+	repo := newTestRepo(t)
 
 	mockTCPConn := NewMockTCPConn()
 	c := NewSession(mockTCPConn, repo)
@@ -107,3 +124,80 @@ func Test_SendError(t *testing.T) {
 	controller.SendError("Test error message")
 	assert.Equal(t, "Test error message\r\n", mockTCPConn.WriteBuffer.String())
 }
+
+func Test_AuditLog(t *testing.T) {
+	cfg := config.Default()
+	cfg.Audit = &config.AuditConfig{Path: dir + "/audit.log"}
+	defer os.Remove(cfg.Audit.Path)
+
+	repo, err := repository.InitializeWithConfig(dir, cfg)
+	assert.Nil(t, err)
+
+	mockTCPConn := NewMockTCPConn()
+	c := NewSession(mockTCPConn, repo)
+
+	repo.FlushQueue("test")
+
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "set test 0 0 1\r\n1\r\n")
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "set test 0 0 1\r\n2\r\n")
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "get test/open\r\n")
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "get test/abort\r\n")
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "get test/open\r\n")
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "get test/close\r\n")
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "get test\r\n")
+	for i := 0; i < 7; i++ {
+		assert.Nil(t, c.Dispatch())
+	}
+	c.FinishSession()
+	repo.CloseAllQueues()
+
+	data, err := ioutil.ReadFile(cfg.Audit.Path)
+	assert.Nil(t, err)
+	events := []string{}
+	items := []string{}
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		fields := strings.Fields(line)
+		events = append(events, strings.Join(fields[1:len(fields)-1], " "))
+		items = append(items, fields[len(fields)-1])
+	}
+	id := fmt.Sprintf("conn=%d", c.id)
+	assert.Equal(t, []string{
+		"enqueue queue=test " + id,
+		"enqueue queue=test " + id,
+		"open queue=test " + id,
+		"abort queue=test " + id,
+		"open queue=test " + id,
+		"close queue=test " + id,
+		"dequeue queue=test " + id,
+	}, events)
+	// Items are identified by message ids
+	first, second := items[0], items[1]
+	assert.NotEqual(t, first, second)
+	assert.Equal(t, []string{first, second, first, first, first, first, second}, items)
+}
+
+func Benchmark_SetGet(b *testing.B) {
+	repo, _ := repository.Initialize(dir)
+	defer repo.CloseAllQueues()
+	for i := 0; i < 16; i++ {
+		repo.FlushQueue(fmt.Sprintf("bench%d", i))
+	}
+
+	// 1000 concurrent sessions over 16 queues
+	var sessions uint64
+	b.SetParallelism(1000/runtime.GOMAXPROCS(0) + 1)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		mockTCPConn := NewMockTCPConn()
+		c := NewSession(mockTCPConn, repo)
+		defer c.FinishSession()
+		command := fmt.Sprintf("set bench%d 0 0 10\r\n0123456789\r\nget bench%[1]d\r\n",
+			atomic.AddUint64(&sessions, 1)%16)
+		for pb.Next() {
+			mockTCPConn.WriteBuffer.Reset()
+			mockTCPConn.ReadBuffer.WriteString(command)
+			c.Dispatch()
+			c.Dispatch()
+		}
+	})
+}
@@ -8,9 +8,16 @@ import (
 
 // Delete handles DELETE command
 // Command: DELETE <queue>
+// Command: DELETE <queue pattern> [--force]
 // Response:
 // END
 func (c *Controller) Delete(input []string) error {
+	if len(input) < 2 {
+		return errors.New("ERROR Invalid input")
+	}
+	if isPattern(input[1]) {
+		return c.forEachMatching(input, c.repo.DeleteQueue)
+	}
 	cmd := &Command{Name: input[0], QueueName: input[1]}
 	err := c.repo.DeleteQueue(cmd.QueueName)
 	if err != nil {
@@ -0,0 +1,64 @@
+package controller
+
+import (
+	"errors"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/bogdanovich/siberite/audit"
+	"github.com/bogdanovich/siberite/queue"
+)
+
+// abortOnDisconnect returns an item left open by a disconnected consumer
+// according to on_disconnect policy of the queue: to the queue head,
+// to the queue head after a delay or to a dead letter queue
+func (c *Controller) abortOnDisconnect(cmd *Command) error {
+	item := c.currentItem
+	if item == nil {
+		return nil
+	}
+	if err := c.returnOnDisconnect(cmd, item); err != nil {
+		return err
+	}
+	c.setCurrentState(nil, nil)
+	return nil
+}
+
+// returnOnDisconnect returns an item to its queue according to on_disconnect policy
+func (c *Controller) returnOnDisconnect(cmd *Command, item *queue.Item) error {
+	q, err := c.repo.GetQueue(cmd.QueueName)
+	if err != nil {
+		log.Printf("Can't GetQueue %s: %s", cmd.QueueName, err.Error())
+		return errors.New("SERVER_ERROR " + err.Error())
+	}
+
+	item.Aborts++
+	policy := c.repo.QueueConfig(cmd.QueueName).OnDisconnect
+	span := c.startSpan("siberite.abort", cmd)
+	switch {
+	case policy != nil && policy.MaxAborts > 0 && int(item.Aborts) >= policy.MaxAborts:
+		err = c.repo.DeadLetter(q, item, policy.DeadLetter)
+		if err == nil {
+			atomic.AddInt64(&q.Stats.DisconnectDeadLettered, 1)
+		}
+	case policy != nil && policy.RedeliveryDelay() > 0:
+		err = q.Delay(item, time.Now().Add(policy.RedeliveryDelay()))
+		if err == nil {
+			atomic.AddInt64(&q.Stats.DisconnectDelayed, 1)
+		}
+	default:
+		err = q.Prepend(item)
+		if err == nil {
+			atomic.AddInt64(&q.Stats.DisconnectRequeued, 1)
+		}
+	}
+	span.End()
+	if err != nil {
+		log.Printf("Can't abort item of %s on disconnect: %s", cmd.QueueName, err.Error())
+		return errors.New("SERVER_ERROR " + err.Error())
+	}
+	q.CloseItem(item)
+	c.audit(audit.EventAbort, cmd.QueueName, item)
+	return nil
+}
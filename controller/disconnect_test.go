@@ -0,0 +1,76 @@
+package controller
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bogdanovich/siberite/config"
+	"github.com/bogdanovich/siberite/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_AbortOnDisconnect_Delay(t *testing.T) {
+	cfg := config.Default()
+	cfg.Queues["test"] = &config.QueueConfig{OnDisconnect: &config.DisconnectPolicy{Delay: "50ms"}}
+	assert.Nil(t, cfg.Validate())
+
+	repo, err := repository.InitializeWithConfig(dir, cfg)
+	defer repo.CloseAllQueues()
+	assert.Nil(t, err)
+
+	repo.FlushQueue("test")
+	q, _ := repo.GetQueue("test")
+	q.Enqueue([]byte("1"))
+	q.Enqueue([]byte("2"))
+
+	mockTCPConn := NewMockTCPConn()
+	controller := NewSession(mockTCPConn, repo)
+	assert.Nil(t, controller.Get([]string{"get", "test/open"}))
+	controller.FinishSession()
+	assert.Equal(t, uint64(1), q.Delayed())
+	assert.Equal(t, int64(1), q.Stats.DisconnectDelayed)
+	assert.Equal(t, int64(0), q.Stats.OpenTransactions)
+
+	// Delayed item is skipped until due
+	mockTCPConn = NewMockTCPConn()
+	controller = NewSession(mockTCPConn, repo)
+	assert.Nil(t, controller.Get([]string{"get", "test"}))
+	assert.Equal(t, "VALUE test 0 1\r\n2\r\nEND\r\n", mockTCPConn.WriteBuffer.String())
+
+	time.Sleep(60 * time.Millisecond)
+	mockTCPConn.WriteBuffer.Reset()
+	assert.Nil(t, controller.Get([]string{"get", "test"}))
+	assert.Equal(t, "VALUE test 0 1\r\n1\r\nEND\r\n", mockTCPConn.WriteBuffer.String())
+	assert.Equal(t, uint64(0), q.Delayed())
+}
+
+func Test_AbortOnDisconnect_DeadLetter(t *testing.T) {
+	cfg := config.Default()
+	cfg.Queues["test"] = &config.QueueConfig{
+		OnDisconnect: &config.DisconnectPolicy{MaxAborts: 2, DeadLetter: "test2"},
+	}
+	assert.Nil(t, cfg.Validate())
+
+	repo, err := repository.InitializeWithConfig(dir, cfg)
+	defer repo.CloseAllQueues()
+	assert.Nil(t, err)
+	defer repo.DeleteQueue("test2")
+
+	repo.FlushQueue("test")
+	q, _ := repo.GetQueue("test")
+	q.Enqueue([]byte("1"))
+
+	for i := 0; i < 2; i++ {
+		controller := NewSession(NewMockTCPConn(), repo)
+		assert.Nil(t, controller.Get([]string{"get", "test/open"}))
+		controller.FinishSession()
+	}
+	assert.Equal(t, int64(1), q.Stats.DisconnectRequeued)
+	assert.Equal(t, int64(1), q.Stats.DisconnectDeadLettered)
+	assert.Equal(t, uint64(0), q.Length())
+
+	dlq, _ := repo.GetQueue("test2")
+	item, err := dlq.Dequeue()
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("1"), item.Value)
+}
@@ -1,45 +1,211 @@
 package controller
 
 import (
+	"errors"
 	"strings"
 	"time"
+
+	"github.com/bogdanovich/siberite/chaos"
+	"github.com/bogdanovich/siberite/trace"
 )
 
 // Dispatch routes client commands to their respective handlers
 func (c *Controller) Dispatch() error {
 	var err error
 	c.conn.SetDeadline(time.Now().Add(3e9))
+	if c.frames == nil && c.info.commands == 0 {
+		if _, err = c.detectFrames(); err != nil {
+			return err
+		}
+	}
+	if c.frames != nil {
+		return c.dispatchFrame()
+	}
 	message, err := c.ReadFirstMessage()
 	if err != nil {
 		return err
 	}
+	received := time.Now()
+	if chaos.Drop() {
+		return chaos.ErrDropped
+	}
 
-	c.conn.SetDeadline(time.Time{})
+	c.setCommandDeadlines()
 	command := strings.Split(strings.Trim(message, " \r\n"), " ")
 	command[0] = strings.ToLower(command[0])
+	return c.run(command, received)
+}
 
-	switch command[0] {
+// run executes a command received at a given time
+func (c *Controller) run(command []string, received time.Time) error {
+	var err error
+	start := time.Now()
+	c.span = trace.Start("siberite.command", nil, "")
+	c.span.SetAttribute("command", command[0])
+	defer c.span.End()
+
+	cmd := &Command{Name: command[0], Args: command, Context: c.ctx}
+	if len(command) > 1 && queueCommands[command[0]] {
+		cmd.QueueName = strings.SplitN(command[1], "/", 2)[0]
+	}
+	c.command = cmd
+	var diag *verboseTrace
+	if c.verbose {
+		diag = c.startVerbose(cmd, received, start)
+	}
+	if err = c.authenticate(cmd); err == nil {
+		err = c.admit(cmd)
+	}
+	if err == nil {
+		c.observeClient(cmd)
+		err = chain(c.execute)(cmd)
+	}
+	c.command = nil
+	c.observeCommand()
+	if err == errUnknownCommand {
+		return c.UnknownCommand()
+	}
+	elapsed := time.Since(start)
+	c.repo.Stats.ObserveCommand(cmd.Name, elapsed)
+	c.repo.ObserveSlow(cmd.Name, cmd.QueueName, elapsed, cmd.Item.ValueSize())
+
+	if err != nil {
+		c.span.SetError(err)
+		c.SendError(err.Error())
+	}
+	if diag != nil {
+		c.writeVerbose(diag, cmd, elapsed, err)
+	}
+	return err
+}
+
+// observeClient records the session as a reader or a writer of queues
+// of a command, whether or not it succeeds, so waiting consumers count too
+func (c *Controller) observeClient(cmd *Command) {
+	switch cmd.Name {
+	case "get", "gets":
+		for _, name := range expandPartitions([]string{cmd.QueueName}) {
+			c.repo.ObserveReader(name, c.id)
+		}
+	case "consume":
+		for _, name := range consumeQueues(cmd.Args) {
+			c.repo.ObserveReader(name, c.id)
+		}
+	case "set", "setmeta", "bset":
+		for _, name := range expandPartitions(commandQueues(cmd)) {
+			c.repo.ObserveWriter(name, c.id)
+		}
+	}
+}
+
+// queueCommands take a queue name as the first argument
+var queueCommands = map[string]bool{
+	"get": true, "gets": true, "set": true, "setmeta": true,
+	"delete": true, "flush": true, "drain": true, "tap": true,
+	"requeue": true, "replay": true, "sample": true, "scheduled": true,
+	"barrier": true, "migrate": true, "bset": true, "close": true, "abort": true,
+}
+
+// errUnknownCommand is answered by UnknownCommand
+var errUnknownCommand = errors.New("ERROR Unknown command")
+
+// execute runs a handler of a command
+func (c *Controller) execute(cmd *Command) error {
+	input := cmd.Args
+	switch cmd.Name {
 	case "get", "gets":
-		err = c.Get(command)
+		return c.Get(input)
+	case "consume":
+		return c.Consume(input)
 	case "set":
-		err = c.Set(command)
+		return c.Set(input)
+	case "setmeta":
+		return c.SetMeta(input)
+	case "bset":
+		return c.BSet(input)
+	case "extset":
+		return c.ExtSet(input)
+	case "extget":
+		return c.ExtGet(input)
+	case "errcodes":
+		return c.ErrCodes(input)
+	case "verbose":
+		return c.Verbose(input)
+	case "prefetch":
+		return c.Prefetch(input)
+	case "chaos":
+		return c.Chaos(input)
+	case "config":
+		return c.Config(input)
+	case "session":
+		return c.Session(input)
+	case "resume":
+		return c.Resume(input)
+	case "replay_last":
+		return c.ReplayLast(input)
+	case "auth":
+		return c.Auth(input)
 	case "version":
-		err = c.Version()
+		return c.Version()
+	case "capabilities":
+		return c.Capabilities()
+	case "close":
+		return c.Close(input)
+	case "abort":
+		return c.Abort(input)
+	case "ping":
+		return c.Ping()
 	case "stats":
-		err = c.Stats()
+		if len(input) == 2 && input[1] == "conns" {
+			return c.Conns()
+		}
+		if len(input) == 2 && input[1] == "slowlog" {
+			return c.Slowlog()
+		}
+		if len(input) == 2 && input[1] == "memory" {
+			return c.MemoryStats()
+		}
+		if len(input) == 2 && input[1] == "config" {
+			return c.ConfigStats()
+		}
+		if len(input) == 3 && input[1] == "queue" {
+			return c.QueueInfo(input)
+		}
+		if len(input) > 1 && len(input) <= 3 && input[1] == "leveldb" {
+			return c.StorageStats(input)
+		}
+		if len(input) > 1 {
+			return c.QueueStats(input)
+		}
+		return c.Stats()
+	case "watch":
+		return c.Watch(input)
 	case "delete":
-		err = c.Delete(command)
+		return c.Delete(input)
 	case "flush":
-		err = c.Flush(command)
+		return c.Flush(input)
 	case "flush_all":
-		err = c.FlushAll()
-	default:
-		return c.UnknownCommand()
-	}
-
-	if err != nil {
-		c.SendError(err.Error())
-		return err
+		return c.FlushAll()
+	case "drain":
+		return c.Drain(input)
+	case "txn":
+		return c.Txn(input)
+	case "tap":
+		return c.Tap(input)
+	case "snapshot":
+		return c.Snapshot(input)
+	case "requeue":
+		return c.Requeue(input)
+	case "replay":
+		return c.Replay(input)
+	case "sample":
+		return c.Sample(input)
+	case "scheduled":
+		return c.Scheduled(input)
+	case "barrier":
+		return c.Barrier(input)
+	case "migrate":
+		return c.Migrate(input)
 	}
-	return nil
+	return errUnknownCommand
 }
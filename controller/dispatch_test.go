@@ -4,7 +4,10 @@ import (
 	"fmt"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/bogdanovich/siberite/config"
+	"github.com/bogdanovich/siberite/queue"
 	"github.com/bogdanovich/siberite/repository"
 	"github.com/stretchr/testify/assert"
 )
@@ -60,6 +63,15 @@ func Test_Dispatch(t *testing.T) {
 
 	mockTCPConn.WriteBuffer.Reset()
 
+	// Command: setmeta test 0 0 2 trace=abc
+	// cd
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "setmeta test 0 0 2 trace=abc\r\ncd\r\n")
+	err = controller.Dispatch()
+	assert.Nil(t, err)
+	assert.Equal(t, "STORED\r\n", mockTCPConn.WriteBuffer.String())
+
+	mockTCPConn.WriteBuffer.Reset()
+
 	// Command: get test
 	fmt.Fprintf(&mockTCPConn.ReadBuffer, "get test\r\n")
 	err = controller.Dispatch()
@@ -148,3 +160,60 @@ func Test_Dispatch(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Equal(t, "Flushed all queues.\r\n", mockTCPConn.WriteBuffer.String())
 }
+
+func Test_Dispatch_Deadlines(t *testing.T) {
+	// Deadlines are disabled by default
+	repo, err := repository.Initialize(dir)
+	assert.Nil(t, err)
+
+	mockTCPConn := NewMockTCPConn()
+	controller := NewSession(mockTCPConn, repo)
+
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "version\r\n")
+	assert.Nil(t, controller.Dispatch())
+	assert.True(t, mockTCPConn.ReadDeadline.IsZero())
+	assert.True(t, mockTCPConn.WriteDeadline.IsZero())
+	repo.CloseAllQueues()
+
+	cfg := config.Default()
+	cfg.ReadTimeout = "10s"
+	cfg.WriteTimeout = "20s"
+	assert.Nil(t, cfg.Validate())
+	repo, err = repository.InitializeWithConfig(dir, cfg)
+	defer repo.CloseAllQueues()
+	assert.Nil(t, err)
+
+	controller = NewSession(mockTCPConn, repo)
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "version\r\n")
+	assert.Nil(t, controller.Dispatch())
+	assert.WithinDuration(t, time.Now().Add(10*time.Second), mockTCPConn.ReadDeadline, time.Second)
+	assert.WithinDuration(t, time.Now().Add(20*time.Second), mockTCPConn.WriteDeadline, time.Second)
+}
+
+func Test_QueueNames(t *testing.T) {
+	cfg := config.Default()
+	cfg.QueueNames = &config.QueueNamesConfig{Chars: "a-z0-9_:-"}
+	assert.Nil(t, cfg.Validate())
+	repo, err := repository.InitializeWithConfig(dir, cfg)
+	defer repo.CloseAllQueues()
+	assert.Nil(t, err)
+
+	mockTCPConn := NewMockTCPConn()
+	controller := NewSession(mockTCPConn, repo)
+	defer controller.FinishSession()
+
+	fmt.Fprint(&mockTCPConn.ReadBuffer, "set eu:orders-1 0 0 1\r\n1\r\n")
+	assert.Nil(t, controller.Dispatch())
+	fmt.Fprint(&mockTCPConn.ReadBuffer, "get eu:orders-1\r\n")
+	assert.Nil(t, controller.Dispatch())
+	fmt.Fprint(&mockTCPConn.ReadBuffer, "delete eu:orders-1\r\n")
+	assert.Nil(t, controller.Dispatch())
+	assert.Equal(t, "STORED\r\nVALUE eu:orders-1 0 1\r\n1\r\nEND\r\nEND\r\n", mockTCPConn.WriteBuffer.String())
+
+	for _, command := range []string{"set Orders 0 0 1\r\n1\r\n", "get Orders\r\n", "delete Orders\r\n"} {
+		mockTCPConn.WriteBuffer.Reset()
+		fmt.Fprint(&mockTCPConn.ReadBuffer, command)
+		assert.NotNil(t, controller.Dispatch())
+		assert.Equal(t, "SERVER_ERROR "+queue.ErrInvalidName.Error()+"\r\n", mockTCPConn.WriteBuffer.String(), command)
+	}
+}
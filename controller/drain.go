@@ -0,0 +1,135 @@
+package controller
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/bogdanovich/siberite/audit"
+	"github.com/bogdanovich/siberite/queue"
+)
+
+var drainProgressInterval = time.Second
+
+// drainChunk is a number of items written to a file before they are removed
+const drainChunk = 1000
+
+// Drain handles DRAIN command
+// Command: DRAIN <queue> [<path>|discard]
+// Dequeues all items, writes them to a new file as <bytes>\n<data>\n
+// records or discards them when no path is given
+// Response:
+// PROGRESS <items> (periodically while draining)
+// DRAINED <items>
+// END
+func (c *Controller) Drain(input []string) error {
+	if len(input) < 2 || len(input) > 3 {
+		return errors.New("ERROR Invalid input")
+	}
+	cmd := &Command{Name: input[0], QueueName: input[1]}
+
+	q, err := c.repo.GetQueue(cmd.QueueName)
+	if err != nil {
+		log.Printf("Can't GetQueue %s: %s", cmd.QueueName, err.Error())
+		return errors.New("SERVER_ERROR " + err.Error())
+	}
+
+	var f *os.File
+	var w *bufio.Writer
+	if len(input) == 3 && input[2] != "discard" {
+		f, err = os.OpenFile(input[2], os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err != nil {
+			return errors.New("SERVER_ERROR " + err.Error())
+		}
+		w = bufio.NewWriter(f)
+	}
+
+	drained, err := c.drainItems(cmd.QueueName, q, f, w)
+	if f != nil {
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		return errors.New("SERVER_ERROR " + err.Error())
+	}
+	log.Printf("drained queue %s: %d items", cmd.QueueName, drained)
+	fmt.Fprintf(c.rw.Writer, "DRAINED %d\r\nEND\r\n", drained)
+	c.rw.Writer.Flush()
+	return nil
+}
+
+// drainItems removes items chunk by chunk, a chunk is written to w and
+// synced to f before its items are removed, so a failed write loses nothing.
+// Items taken by other consumers meanwhile may be written too.
+func (c *Controller) drainItems(name string, q *queue.Queue, f *os.File, w *bufio.Writer) (uint64, error) {
+	var drained uint64
+	lastProgress := time.Now()
+	for {
+		head, err := q.Front()
+		if err == queue.ErrEmpty {
+			return drained, nil
+		}
+		if err != nil {
+			return drained, err
+		}
+		items := []*queue.Item{head}
+		for len(items) < drainChunk {
+			item, err := q.PeekAt(uint64(len(items)))
+			if err != nil || item.Expired(time.Now()) {
+				break
+			}
+			items = append(items, item)
+		}
+
+		if w != nil {
+			for _, item := range items {
+				if err = writeDrainRecord(w, q, item); err != nil {
+					return drained, err
+				}
+			}
+			if err = w.Flush(); err != nil {
+				return drained, err
+			}
+			if err = f.Sync(); err != nil {
+				return drained, err
+			}
+		}
+
+		for _, item := range items {
+			if err = q.RemoveHead(item); err == queue.ErrHeadChanged {
+				break
+			} else if err != nil {
+				return drained, err
+			}
+			q.DeleteBlob(item.Blob)
+			c.audit(audit.EventDrain, name, item)
+			drained++
+
+			if time.Since(lastProgress) >= drainProgressInterval {
+				lastProgress = time.Now()
+				log.Printf("draining queue %s: %d items", name, drained)
+				c.setCommandDeadlines()
+				fmt.Fprintf(c.rw.Writer, "PROGRESS %d\r\n", drained)
+				c.rw.Writer.Flush()
+			}
+		}
+	}
+}
+
+func writeDrainRecord(w *bufio.Writer, q *queue.Queue, item *queue.Item) error {
+	if _, err := fmt.Fprintf(w, "%d\n", item.Size); err != nil {
+		return err
+	}
+	if item.Blob != nil {
+		if err := q.WriteBlob(item.Blob, w); err != nil {
+			return err
+		}
+	} else if _, err := w.Write(item.Value); err != nil {
+		return err
+	}
+	return w.WriteByte('\n')
+}
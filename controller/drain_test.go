@@ -0,0 +1,108 @@
+package controller
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bogdanovich/siberite/queue"
+	"github.com/bogdanovich/siberite/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Drain(t *testing.T) {
+	repo, err := repository.Initialize(dir)
+	defer repo.CloseAllQueues()
+	assert.Nil(t, err)
+
+	mockTCPConn := NewMockTCPConn()
+	controller := NewSession(mockTCPConn, repo)
+
+	repo.FlushQueue("test")
+	q, err := repo.GetQueue("test")
+	assert.Nil(t, err)
+
+	q.Enqueue([]byte("1"))
+	q.Enqueue([]byte("22"))
+
+	err = controller.Drain([]string{"drain", "test"})
+	assert.Nil(t, err)
+	assert.Equal(t, "DRAINED 2\r\nEND\r\n", mockTCPConn.WriteBuffer.String())
+	assert.Equal(t, uint64(0), q.Length())
+
+	mockTCPConn.WriteBuffer.Reset()
+
+	q.Enqueue([]byte("1"))
+	q.Enqueue([]byte("22\n"))
+	path := dir + "/drain_test.txt"
+	defer os.Remove(path)
+
+	err = controller.Drain([]string{"drain", "test", path})
+	assert.Nil(t, err)
+	assert.Equal(t, "DRAINED 2\r\nEND\r\n", mockTCPConn.WriteBuffer.String())
+	assert.Equal(t, uint64(0), q.Length())
+
+	data, err := ioutil.ReadFile(path)
+	assert.Nil(t, err)
+	assert.Equal(t, "1\n1\n3\n22\n\n", string(data))
+
+	// Existing files are never overwritten
+	q.Enqueue([]byte("1"))
+	err = controller.Drain([]string{"drain", "test", path})
+	assert.True(t, strings.HasPrefix(err.Error(), "SERVER_ERROR"))
+	assert.Equal(t, uint64(1), q.Length())
+
+	err = controller.Drain([]string{"drain"})
+	assert.Equal(t, "ERROR Invalid input", err.Error())
+}
+
+func Test_Drain_Progress(t *testing.T) {
+	repo, err := repository.Initialize(dir)
+	defer repo.CloseAllQueues()
+	assert.Nil(t, err)
+
+	mockTCPConn := NewMockTCPConn()
+	controller := NewSession(mockTCPConn, repo)
+
+	repo.FlushQueue("test")
+	q, err := repo.GetQueue("test")
+	assert.Nil(t, err)
+	q.Enqueue([]byte("1"))
+	q.Enqueue([]byte("2"))
+
+	drainProgressInterval = 0
+	defer func() { drainProgressInterval = time.Second }()
+
+	err = controller.Drain([]string{"drain", "test", "discard"})
+	assert.Nil(t, err)
+	assert.Equal(t, "PROGRESS 1\r\nPROGRESS 2\r\nDRAINED 2\r\nEND\r\n", mockTCPConn.WriteBuffer.String())
+}
+
+func Test_Drain_Blob(t *testing.T) {
+	repo, err := repository.Initialize(dir)
+	defer repo.CloseAllQueues()
+	assert.Nil(t, err)
+
+	mockTCPConn := NewMockTCPConn()
+	controller := NewSession(mockTCPConn, repo)
+
+	repo.FlushQueue("test")
+	q, _ := repo.GetQueue("test")
+
+	w := q.NewBlobWriter()
+	w.Write([]byte("123"))
+	w.Write([]byte("45"))
+	q.EnqueueItem(&queue.Item{Blob: w.Blob()})
+
+	path := dir + "/drain_blob_test.txt"
+	defer os.Remove(path)
+
+	err = controller.Drain([]string{"drain", "test", path})
+	assert.Nil(t, err)
+	assert.Equal(t, "DRAINED 1\r\nEND\r\n", mockTCPConn.WriteBuffer.String())
+
+	data, _ := ioutil.ReadFile(path)
+	assert.Equal(t, "5\n12345\n", string(data))
+}
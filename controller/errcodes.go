@@ -0,0 +1,17 @@
+package controller
+
+// ErrCodes handles ERRCODES command, coded error responses last for the session
+// Command: ERRCODES <on|off>
+// Response: END
+// Errors then carry a stable code after the class: CLIENT_ERROR 1201 Close current item first,
+// see package errcode for the list of codes
+func (c *Controller) ErrCodes(input []string) error {
+	on, err := parseSwitch(input)
+	if err != nil {
+		return err
+	}
+	c.errorCodes = on
+	c.rw.Writer.WriteString("END\r\n")
+	c.rw.Writer.Flush()
+	return nil
+}
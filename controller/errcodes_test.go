@@ -0,0 +1,36 @@
+package controller
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/bogdanovich/siberite/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ErrCodes(t *testing.T) {
+	repo, err := repository.Initialize(dir)
+	defer repo.CloseAllQueues()
+	assert.Nil(t, err)
+
+	mockTCPConn := NewMockTCPConn()
+	controller := NewSession(mockTCPConn, repo)
+
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "errcodes on\r\nbogus\r\n")
+	err = controller.Dispatch()
+	assert.Nil(t, err)
+	err = controller.Dispatch()
+	assert.Equal(t, "ERROR Unknown command", err.Error())
+	assert.Equal(t, "END\r\nERROR 1001 Unknown command\r\n", mockTCPConn.WriteBuffer.String())
+
+	mockTCPConn.WriteBuffer.Reset()
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "set test 0 0 1\r\n1xx")
+	controller.Dispatch()
+	assert.Equal(t, "CLIENT_ERROR 1202 bad data chunk\r\n", mockTCPConn.WriteBuffer.String())
+
+	mockTCPConn.WriteBuffer.Reset()
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "errcodes off\r\nbogus\r\n")
+	controller.Dispatch()
+	controller.Dispatch()
+	assert.Equal(t, "END\r\nERROR Unknown command\r\n", mockTCPConn.WriteBuffer.String())
+}
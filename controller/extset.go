@@ -0,0 +1,49 @@
+package controller
+
+import (
+	"errors"
+	"strings"
+)
+
+// ExtSet handles EXTSET command, extended SET responses last for the session
+// Command: EXTSET <on|off>
+// Response: END
+// SET then responds STORED <queue length> instead of STORED
+func (c *Controller) ExtSet(input []string) error {
+	on, err := parseSwitch(input)
+	if err != nil {
+		return err
+	}
+	c.extendedSet = on
+	c.rw.Writer.WriteString("END\r\n")
+	c.rw.Writer.Flush()
+	return nil
+}
+
+// ExtGet handles EXTGET command, extended GET responses last for the session
+// Command: EXTGET <on|off>
+// Response: END
+// GET then ends with END <queue length> instead of END
+func (c *Controller) ExtGet(input []string) error {
+	on, err := parseSwitch(input)
+	if err != nil {
+		return err
+	}
+	c.extendedGet = on
+	c.rw.Writer.WriteString("END\r\n")
+	c.rw.Writer.Flush()
+	return nil
+}
+
+// parseSwitch parses on|off argument of session mode commands
+func parseSwitch(input []string) (bool, error) {
+	if len(input) == 2 {
+		switch strings.ToLower(input[1]) {
+		case "on":
+			return true, nil
+		case "off":
+			return false, nil
+		}
+	}
+	return false, errors.New("ERROR Invalid input")
+}
@@ -0,0 +1,70 @@
+package controller
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/bogdanovich/siberite/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ExtSet(t *testing.T) {
+	repo, err := repository.Initialize(dir)
+	defer repo.CloseAllQueues()
+	assert.Nil(t, err)
+	repo.FlushQueue("test")
+
+	mockTCPConn := NewMockTCPConn()
+	controller := NewSession(mockTCPConn, repo)
+
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "EXTSET on\r\n")
+	err = controller.Dispatch()
+	assert.Nil(t, err)
+	assert.Equal(t, "END\r\n", mockTCPConn.WriteBuffer.String())
+
+	for i := 1; i <= 2; i++ {
+		mockTCPConn.WriteBuffer.Reset()
+		fmt.Fprintf(&mockTCPConn.ReadBuffer, "set test 0 0 1\r\n1\r\n")
+		err = controller.Dispatch()
+		assert.Nil(t, err)
+		assert.Equal(t, fmt.Sprintf("STORED %d\r\n", i), mockTCPConn.WriteBuffer.String())
+	}
+
+	mockTCPConn.WriteBuffer.Reset()
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "extset off\r\nset test 0 0 1\r\n1\r\n")
+	controller.Dispatch()
+	err = controller.Dispatch()
+	assert.Nil(t, err)
+	assert.Equal(t, "END\r\nSTORED\r\n", mockTCPConn.WriteBuffer.String())
+
+	err = controller.ExtSet([]string{"extset", "maybe"})
+	assert.Equal(t, "ERROR Invalid input", err.Error())
+
+	repo.FlushQueue("test")
+}
+
+func Test_ExtGet(t *testing.T) {
+	repo, err := repository.Initialize(dir)
+	defer repo.CloseAllQueues()
+	assert.Nil(t, err)
+	repo.FlushQueue("test")
+	q, _ := repo.GetQueue("test")
+	q.Enqueue([]byte("1"))
+	q.Enqueue([]byte("2"))
+
+	mockTCPConn := NewMockTCPConn()
+	controller := NewSession(mockTCPConn, repo)
+
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "extget on\r\nget test\r\nget test/peek\r\n")
+	for i := 0; i < 3; i++ {
+		assert.Nil(t, controller.Dispatch())
+	}
+	assert.Equal(t, "END\r\nVALUE test 0 1\r\n1\r\nEND 1\r\nVALUE test 0 1\r\n2\r\nEND 1\r\n",
+		mockTCPConn.WriteBuffer.String())
+
+	mockTCPConn.WriteBuffer.Reset()
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "extget off\r\nget test\r\n")
+	controller.Dispatch()
+	controller.Dispatch()
+	assert.Equal(t, "END\r\nVALUE test 0 1\r\n2\r\nEND\r\n", mockTCPConn.WriteBuffer.String())
+}
@@ -0,0 +1,36 @@
+package controller
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/bogdanovich/siberite/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Fanout(t *testing.T) {
+	repo, err := repository.Initialize(dir)
+	defer repo.CloseAllQueues()
+	assert.Nil(t, err)
+
+	mockTCPConn := NewMockTCPConn()
+	controller := NewSession(mockTCPConn, repo)
+	defer controller.FinishSession()
+
+	// A consumer opening a child queue registers it
+	fmt.Fprint(&mockTCPConn.ReadBuffer, "get fanout+worker/open\r\n")
+	assert.Nil(t, controller.Dispatch())
+	fmt.Fprint(&mockTCPConn.ReadBuffer, "set fanout 0 0 1\r\n1\r\n")
+	assert.Nil(t, controller.Dispatch())
+	fmt.Fprint(&mockTCPConn.ReadBuffer, "get fanout+worker/open\r\n")
+	assert.Nil(t, controller.Dispatch())
+	fmt.Fprint(&mockTCPConn.ReadBuffer, "get fanout+worker/close\r\n")
+	assert.Nil(t, controller.Dispatch())
+	fmt.Fprint(&mockTCPConn.ReadBuffer, "get fanout\r\n")
+	assert.Nil(t, controller.Dispatch())
+	assert.Equal(t, "END\r\nSTORED\r\nVALUE fanout+worker 0 1\r\n1\r\nEND\r\nEND\r\nVALUE fanout 0 1\r\n1\r\nEND\r\n",
+		mockTCPConn.WriteBuffer.String())
+
+	repo.DeleteQueue("fanout+worker")
+	repo.DeleteQueue("fanout")
+}
@@ -8,9 +8,16 @@ import (
 
 // Flush handles FLUSH command
 // Command: FLUSH <queue>
+// Command: FLUSH <queue pattern> [--force]
 // Response:
 // END
 func (c *Controller) Flush(input []string) error {
+	if len(input) < 2 {
+		return errors.New("ERROR Invalid input")
+	}
+	if isPattern(input[1]) {
+		return c.forEachMatching(input, c.repo.FlushQueue)
+	}
 	cmd := &Command{Name: input[0], QueueName: input[1]}
 	err := c.repo.FlushQueue(cmd.QueueName)
 	if err != nil {
@@ -0,0 +1,326 @@
+package controller
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/bogdanovich/siberite/chaos"
+	"github.com/bogdanovich/siberite/queue"
+)
+
+// FramePreamble switches a connection to the framed protocol v2 when sent
+// as the first bytes, the server answers with the same preamble. Servers
+// without v2 answer ERROR, as it is read as an unknown command.
+const FramePreamble = "\x00SB2\r\n"
+
+// maxFrameMeta limits the size of frame metadata, values are not limited
+const maxFrameMeta = 64 * 1024
+
+var errInvalidFrame = errors.New("Invalid frame")
+
+// unframedCommands write unbounded output, a frame would buffer all of it
+var unframedCommands = map[string]string{
+	"watch":    "Watch",
+	"snapshot": "Snapshot",
+	"drain":    "Drain",
+}
+
+// framed keeps the state of a connection speaking protocol v2.
+//
+// Both requests and responses are frames:
+//
+//	<meta length uint32> <value length uint32> <meta> <value>
+//
+// Request meta holds a command in the text protocol grammar as length-prefixed
+// arguments, so the server doesn't scan for separators, and item headers:
+//
+//	<request id uint32> <argc uint16> (<length uint16> <arg>)... <headers uint16> (<length uint16> <key>=<value>)...
+//
+// A value is a data block of SET, <bytes> argument must match value length.
+// Response meta carries the request id, the last line of a text response
+// as status (STORED, END, CLIENT_ERROR ...) and an item returned by GET:
+//
+//	<request id uint32> <status length uint16> <status> <item uint8> <flags uint32> <item id uint64> <headers uint16> (<length uint16> <key>=<value>)...
+//
+// Item id is set for items opened with GET <queue>/open/id, zero otherwise.
+// Response value is an item value or other response lines, e.g. of STATS.
+// Blob values of GET are streamed, other responses are buffered, so WATCH,
+// SNAPSHOT and DRAIN are rejected. Requests are answered in order, clients
+// may pipeline them.
+type framed struct {
+	conn *bufio.ReadWriter
+	// id of the current request
+	id uint32
+	// value is a value of the current request left to read
+	value io.LimitedReader
+	// headers of the current request
+	headers []string
+	// reader and response are the command's view of the connection
+	reader   *bufio.Reader
+	response bytes.Buffer
+	writer   *bufio.Writer
+	// item is returned by the current command, itemID is its id
+	// if opened by id, see GET <queue>/open/id
+	item     *queue.Item
+	itemID   uint64
+	itemData bytes.Buffer
+	// streamed is set once the response frame is written by captureItem
+	streamed bool
+	meta     []byte
+	// err is a connection error met reading a request value
+	err error
+}
+
+// Read reads the request value followed by the data block terminator
+// of the text protocol, so commands read their payload as usual
+func (f *framed) Read(p []byte) (int, error) {
+	if f.value.N == 0 {
+		return 0, io.EOF
+	}
+	n, err := f.value.Read(p)
+	if err != nil && err != io.EOF {
+		f.err = err
+	}
+	return n, err
+}
+
+// detectFrames switches the session to protocol v2 if the client sent the preamble
+func (c *Controller) detectFrames() (bool, error) {
+	if first, err := c.rw.Reader.Peek(1); err != nil || first[0] != FramePreamble[0] {
+		return false, err
+	}
+	preamble, err := c.rw.Reader.Peek(len(FramePreamble))
+	if err != nil || string(preamble) != FramePreamble {
+		return false, err
+	}
+	c.rw.Reader.Discard(len(FramePreamble))
+	f := &framed{conn: c.rw}
+	f.reader = bufio.NewReader(io.MultiReader())
+	f.writer = bufio.NewWriter(&f.response)
+	c.frames = f
+	c.rw.Writer.WriteString(FramePreamble)
+	return true, c.rw.Writer.Flush()
+}
+
+// dispatchFrame reads a request frame, runs its command and writes a response
+// frame. Command errors are reported in the response, the connection stays open.
+func (c *Controller) dispatchFrame() error {
+	f := c.frames
+	// Peeked lengths stay buffered when the poll deadline passes
+	lengths, err := f.conn.Reader.Peek(8)
+	if err != nil {
+		return err
+	}
+	received := time.Now()
+	metaLength := binary.BigEndian.Uint32(lengths[:4])
+	valueLength := binary.BigEndian.Uint32(lengths[4:])
+	f.conn.Reader.Discard(8)
+	if metaLength > maxFrameMeta {
+		return errInvalidFrame
+	}
+	if cap(f.meta) < int(metaLength) {
+		f.meta = make([]byte, metaLength)
+	}
+	meta := f.meta[:metaLength]
+	c.setCommandDeadlines()
+	if _, err := io.ReadFull(f.conn.Reader, meta); err != nil {
+		return err
+	}
+	id, command, headers, err := decodeRequest(meta)
+	if err != nil {
+		return err
+	}
+	if chaos.Drop() {
+		return chaos.ErrDropped
+	}
+
+	f.id = id
+	f.value = io.LimitedReader{R: f.conn.Reader, N: int64(valueLength)}
+	f.headers = headers
+	f.item = nil
+	f.itemID = 0
+	f.streamed = false
+	f.err = nil
+	f.response.Reset()
+	f.reader.Reset(io.MultiReader(f, strings.NewReader("\r\n")))
+	f.writer.Reset(&f.response)
+	c.rw = bufio.NewReadWriter(f.reader, f.writer)
+
+	if len(command) == 0 {
+		c.SendError("ERROR Invalid command")
+	} else if name, ok := unframedCommands[strings.ToLower(command[0])]; ok {
+		c.SendError("ERROR " + name + " is not supported with frames")
+	} else {
+		command[0] = strings.ToLower(command[0])
+		err = c.run(command, received)
+	}
+	f.writer.Flush()
+	c.rw = f.conn
+
+	if err == chaos.ErrDropped {
+		return err
+	}
+	// A streamed response frame is incomplete if the command failed after all
+	if f.streamed && err != nil {
+		return err
+	}
+	if f.err != nil {
+		return f.err
+	}
+	// A value left unread by a rejected command is skipped
+	if _, err = io.Copy(ioutil.Discard, &f.value); err != nil {
+		return err
+	}
+	if !f.streamed {
+		if err = c.writeResponseFrame(id); err != nil {
+			return err
+		}
+	}
+	// Responses to pipelined requests are flushed together
+	if f.conn.Reader.Buffered() == 0 {
+		return f.conn.Writer.Flush()
+	}
+	return nil
+}
+
+// captureItem keeps an item sent by GET for the response frame. Blob values
+// are streamed right away, GET answers END once an item is sent.
+func (c *Controller) captureItem(q blobSource, item *queue.Item) error {
+	f := c.frames
+	f.item = item
+	f.itemData.Reset()
+	if item.Blob == nil {
+		f.itemData.Write(item.Value)
+		return nil
+	}
+	f.streamed = true
+	c.writeFrameHead(f.id, []byte("END"), item.Size)
+	return q.WriteBlob(item.Blob, deadlineWriter{c, f.conn.Writer})
+}
+
+func (c *Controller) writeResponseFrame(id uint32) error {
+	f := c.frames
+	text := f.response.Bytes()
+	// The last line is the status, preceding lines are the value
+	text = bytes.TrimSuffix(text, []byte("\r\n"))
+	status := text
+	var value []byte
+	if i := bytes.LastIndex(text, []byte("\r\n")); i >= 0 {
+		status = text[i+2:]
+		value = text[:i+2]
+	}
+	if f.item != nil {
+		value = f.itemData.Bytes()
+	}
+	c.writeFrameHead(id, status, int32(len(value)))
+	_, err := f.conn.Writer.Write(value)
+	return err
+}
+
+// writeFrameHead writes lengths and meta of a response frame
+func (c *Controller) writeFrameHead(id uint32, status []byte, valueLength int32) {
+	f := c.frames
+	buf := getBuffer()
+	meta := appendUint32(*buf, id)
+	meta = appendFrameString(meta, string(status))
+	if f.item == nil {
+		meta = append(meta, 0)
+		meta = appendUint32(meta, 0)
+		meta = appendUint32(meta, 0)
+		meta = appendUint32(meta, 0)
+		meta = appendUint16(meta, 0)
+	} else {
+		meta = append(meta, 1)
+		meta = appendUint32(meta, f.item.Flags)
+		meta = appendUint32(meta, uint32(f.itemID>>32))
+		meta = appendUint32(meta, uint32(f.itemID))
+		meta = appendUint16(meta, uint16(len(f.item.Headers)))
+		for _, header := range f.item.Headers {
+			meta = appendFrameString(meta, header.Key+"="+header.Value)
+		}
+	}
+
+	var lengths [8]byte
+	binary.BigEndian.PutUint32(lengths[:4], uint32(len(meta)))
+	binary.BigEndian.PutUint32(lengths[4:], uint32(valueLength))
+	c.setCommandDeadlines()
+	f.conn.Writer.Write(lengths[:])
+	f.conn.Writer.Write(meta)
+	*buf = meta
+	putBuffer(buf)
+}
+
+// decodeRequest parses request frame meta
+func decodeRequest(meta []byte) (uint32, []string, []string, error) {
+	if len(meta) < 4 {
+		return 0, nil, nil, errInvalidFrame
+	}
+	id := binary.BigEndian.Uint32(meta)
+	command, rest, err := decodeFrameStrings(meta[4:])
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	headers, rest, err := decodeFrameStrings(rest)
+	if err != nil || len(rest) != 0 {
+		return 0, nil, nil, errInvalidFrame
+	}
+	return id, command, headers, nil
+}
+
+// decodeFrameStrings parses a count followed by length-prefixed strings
+func decodeFrameStrings(data []byte) ([]string, []byte, error) {
+	if len(data) < 2 {
+		return nil, nil, errInvalidFrame
+	}
+	count := int(binary.BigEndian.Uint16(data))
+	data = data[2:]
+	if count == 0 {
+		return nil, data, nil
+	}
+	values := make([]string, count)
+	for i := range values {
+		if len(data) < 2 {
+			return nil, nil, errInvalidFrame
+		}
+		n := int(binary.BigEndian.Uint16(data))
+		if len(data) < 2+n {
+			return nil, nil, errInvalidFrame
+		}
+		values[i] = string(data[2 : 2+n])
+		data = data[2+n:]
+	}
+	return values, data, nil
+}
+
+func appendFrameString(buf []byte, s string) []byte {
+	buf = appendUint16(buf, uint16(len(s)))
+	return append(buf, s...)
+}
+
+// frameHeaders returns headers of a request frame, nil for text commands
+func (c *Controller) frameHeaders() ([]queue.Header, error) {
+	if c.frames == nil || len(c.frames.headers) == 0 {
+		return nil, nil
+	}
+	for _, header := range c.frames.headers {
+		// Headers are listed on text VALUE lines of other consumers
+		if strings.ContainsAny(header, " \r\n") {
+			return nil, errors.New("ERROR Invalid header " + header)
+		}
+	}
+	return parseHeaders(c.frames.headers)
+}
+
+func appendUint16(buf []byte, v uint16) []byte {
+	return append(buf, byte(v>>8), byte(v))
+}
+
+func appendUint32(buf []byte, v uint32) []byte {
+	return append(buf, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
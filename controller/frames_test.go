@@ -0,0 +1,125 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/bogdanovich/siberite/queue"
+	"github.com/stretchr/testify/assert"
+)
+
+func encodeRequestFrame(id uint32, command []string, headers []string, value string) []byte {
+	meta := appendUint32(nil, id)
+	for _, list := range [][]string{command, headers} {
+		meta = appendUint16(meta, uint16(len(list)))
+		for _, s := range list {
+			meta = appendFrameString(meta, s)
+		}
+	}
+	frame := appendUint32(nil, uint32(len(meta)))
+	frame = appendUint32(frame, uint32(len(value)))
+	return append(append(frame, meta...), value...)
+}
+
+type responseFrame struct {
+	id      uint32
+	status  string
+	item    bool
+	flags   uint32
+	itemID  uint64
+	headers []string
+	value   string
+}
+
+func decodeResponseFrame(t *testing.T, buf *bytes.Buffer) responseFrame {
+	lengths := buf.Next(8)
+	meta := buf.Next(int(binary.BigEndian.Uint32(lengths[:4])))
+	value := buf.Next(int(binary.BigEndian.Uint32(lengths[4:])))
+	var r responseFrame
+	r.id = binary.BigEndian.Uint32(meta)
+	status, rest, err := decodeFrameStrings(append([]byte{0, 1}, meta[4:]...))
+	assert.Nil(t, err)
+	r.status = status[0]
+	r.item = rest[0] == 1
+	r.flags = binary.BigEndian.Uint32(rest[1:])
+	r.itemID = binary.BigEndian.Uint64(rest[5:])
+	r.headers, rest, err = decodeFrameStrings(rest[13:])
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(rest))
+	r.value = string(value)
+	return r
+}
+
+func Test_Frames(t *testing.T) {
+	repo := newTestRepo(t)
+
+	mockTCPConn := NewMockTCPConn()
+	controller := NewSession(mockTCPConn, repo)
+	defer controller.FinishSession()
+
+	// Requests are pipelined
+	mockTCPConn.ReadBuffer.WriteString(FramePreamble)
+	mockTCPConn.ReadBuffer.Write(encodeRequestFrame(1, []string{"SET", "work", "7", "0", "5"}, []string{"trace=abc"}, "hello"))
+	mockTCPConn.ReadBuffer.Write(encodeRequestFrame(2, []string{"set", "work", "0", "0", "3"}, nil, "a b"))
+	mockTCPConn.ReadBuffer.Write(encodeRequestFrame(3, []string{"get", "work/open"}, nil, ""))
+	mockTCPConn.ReadBuffer.Write(encodeRequestFrame(4, []string{"get", "work/open"}, nil, ""))
+	mockTCPConn.ReadBuffer.Write(encodeRequestFrame(5, []string{"set", "work", "0", "0", "4"}, []string{"k v=1"}, "skip"))
+	mockTCPConn.ReadBuffer.Write(encodeRequestFrame(6, []string{"get", "work/close/open"}, nil, ""))
+	mockTCPConn.ReadBuffer.Write(encodeRequestFrame(7, []string{"stats", "queue", "work"}, nil, ""))
+	for i := 0; i < 7; i++ {
+		assert.Nil(t, controller.Dispatch())
+	}
+
+	response := &mockTCPConn.WriteBuffer
+	assert.Equal(t, FramePreamble, string(response.Next(len(FramePreamble))))
+	assert.Equal(t, responseFrame{id: 1, status: "STORED"}, decodeResponseFrame(t, response))
+	assert.Equal(t, responseFrame{id: 2, status: "STORED"}, decodeResponseFrame(t, response))
+	assert.Equal(t, responseFrame{id: 3, status: "END", item: true, flags: 7, headers: []string{"trace=abc"}, value: "hello"},
+		decodeResponseFrame(t, response))
+	assert.Equal(t, responseFrame{id: 4, status: "CLIENT_ERROR Close current item first"}, decodeResponseFrame(t, response))
+	assert.Equal(t, responseFrame{id: 5, status: "ERROR Invalid header k v=1"}, decodeResponseFrame(t, response))
+	assert.Equal(t, responseFrame{id: 6, status: "END", item: true, value: "a b"}, decodeResponseFrame(t, response))
+	stats := decodeResponseFrame(t, response)
+	assert.Equal(t, "END", stats.status)
+	assert.Contains(t, stats.value, "STAT queue_work_items 0\r\n")
+	assert.Equal(t, 0, response.Len())
+}
+
+func Test_Frames_Invalid(t *testing.T) {
+	for _, meta := range [][]byte{{0, 0, 0}, {0, 0, 0, 1, 0, 1, 0, 5, 'g'}, {0, 0, 0, 1, 0, 0, 0, 0, 1}} {
+		_, _, _, err := decodeRequest(meta)
+		assert.Equal(t, errInvalidFrame, err)
+	}
+}
+
+func Test_Frames_Streaming(t *testing.T) {
+	repo := newTestRepo(t)
+
+	mockTCPConn := NewMockTCPConn()
+	controller := NewSession(mockTCPConn, repo)
+	defer controller.FinishSession()
+
+	// Blob values are written to the connection as they are read
+	value := strings.Repeat("0123456789", queue.ChunkSize/4)
+	mockTCPConn.ReadBuffer.WriteString(FramePreamble)
+	mockTCPConn.ReadBuffer.Write(encodeRequestFrame(1, []string{"set", "work", "3", "0", strconv.Itoa(len(value))}, nil, value))
+	mockTCPConn.ReadBuffer.Write(encodeRequestFrame(2, []string{"get", "work"}, nil, ""))
+	mockTCPConn.ReadBuffer.Write(encodeRequestFrame(3, []string{"snapshot", "work"}, nil, ""))
+	mockTCPConn.ReadBuffer.Write(encodeRequestFrame(4, []string{"DRAIN", "work"}, nil, ""))
+	mockTCPConn.ReadBuffer.Write(encodeRequestFrame(5, []string{"watch", "stats"}, nil, ""))
+	for i := 0; i < 5; i++ {
+		assert.Nil(t, controller.Dispatch())
+	}
+
+	response := &mockTCPConn.WriteBuffer
+	assert.Equal(t, FramePreamble, string(response.Next(len(FramePreamble))))
+	assert.Equal(t, responseFrame{id: 1, status: "STORED"}, decodeResponseFrame(t, response))
+	assert.Equal(t, responseFrame{id: 2, status: "END", item: true, flags: 3, value: value}, decodeResponseFrame(t, response))
+	assert.Equal(t, responseFrame{id: 3, status: "ERROR Snapshot is not supported with frames"}, decodeResponseFrame(t, response))
+	assert.Equal(t, responseFrame{id: 4, status: "ERROR Drain is not supported with frames"}, decodeResponseFrame(t, response))
+	assert.Equal(t, responseFrame{id: 5, status: "ERROR Watch is not supported with frames"}, decodeResponseFrame(t, response))
+	assert.Equal(t, 0, response.Len())
+}
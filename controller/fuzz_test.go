@@ -0,0 +1,105 @@
+package controller
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/bogdanovich/siberite/repository"
+)
+
+// fuzzCommands are commands whose arguments and data blocks are fuzzed,
+// other commands block, dial peers or change process-wide settings
+var fuzzCommands = map[string]bool{
+	"get": true, "gets": true, "set": true, "setmeta": true, "bset": true,
+	"close": true, "abort": true, "delete": true, "replay_last": true,
+}
+
+func fuzzRepository(f *testing.F) (*repository.QueueRepository, func()) {
+	dataDir, err := ioutil.TempDir("", "siberite_fuzz")
+	if err != nil {
+		f.Fatal(err)
+	}
+	repo, err := repository.Initialize(dataDir)
+	if err != nil {
+		f.Fatal(err)
+	}
+	return repo, func() {
+		repo.CloseAllQueues()
+		os.RemoveAll(dataDir)
+	}
+}
+
+// FuzzDispatch sends a command line followed by a data block,
+// malformed commands must be answered with errors, not crash the server
+func FuzzDispatch(f *testing.F) {
+	f.Add("get work", []byte{})
+	f.Add("get /open", []byte{})
+	f.Add("get", []byte{})
+	f.Add("gets work/open/t=10/meta", []byte{})
+	f.Add("set work 0 0 1", []byte("1\r\n"))
+	f.Add("set work/ttl=10/dedup=k 0 0 1", []byte("1\r\n"))
+	f.Add("set work 0 0 5", []byte("1\r\n"))
+	f.Add("set work 0 0 -1", []byte("\r\n"))
+	f.Add("set /ttl=5 0 0 1", []byte("1\r\n"))
+	f.Add("setmeta work 0 0 1 a=1 msg_id=x", []byte("1\r\n"))
+	f.Add("bset work,other 0 0 1", []byte("1\r\n"))
+	f.Add("bset work 0 0 -2", []byte("\r\n"))
+	f.Add("close work", []byte{})
+	f.Add("replay_last 1", []byte{})
+
+	repo, cleanup := fuzzRepository(f)
+	defer cleanup()
+
+	f.Fuzz(func(t *testing.T, line string, data []byte) {
+		if strings.ContainsAny(line, "\r\n") || !fuzzCommands[strings.ToLower(strings.SplitN(line, " ", 2)[0])] {
+			t.Skip()
+		}
+		conn := NewMockTCPConn()
+		conn.ReadBuffer.WriteString(line + "\r\n")
+		conn.ReadBuffer.Write(data)
+		controller := NewSession(conn, repo)
+		defer controller.FinishSession()
+		for i := 0; i < 3 && conn.ReadBuffer.Len() > 0; i++ {
+			if err := controller.Dispatch(); err != nil {
+				break
+			}
+		}
+	})
+}
+
+// FuzzFrames sends a protocol v2 request frame
+func FuzzFrames(f *testing.F) {
+	f.Add(encodeRequestFrame(1, []string{"get", "work"}, nil, ""))
+	f.Add(encodeRequestFrame(1, []string{"get", "/open"}, nil, ""))
+	f.Add(encodeRequestFrame(1, []string{"get"}, nil, ""))
+	f.Add(encodeRequestFrame(2, []string{"set", "work", "0", "0", "1"}, []string{"a=1"}, "1"))
+	f.Add(encodeRequestFrame(2, []string{"set", "work", "0", "0", "5"}, []string{"="}, "1"))
+	f.Add(encodeRequestFrame(3, []string{"bset", "work,other", "0", "0", "1"}, nil, "1"))
+	f.Add(encodeRequestFrame(4, nil, nil, ""))
+	f.Add([]byte{0, 0, 0, 4, 0, 0, 0, 0, 0, 0, 0, 1})
+
+	repo, cleanup := fuzzRepository(f)
+	defer cleanup()
+
+	f.Fuzz(func(t *testing.T, frame []byte) {
+		if len(frame) >= 8 {
+			meta := frame[8:]
+			if n := binary.BigEndian.Uint32(frame); uint64(n) < uint64(len(meta)) {
+				meta = meta[:n]
+			}
+			_, command, _, err := decodeRequest(meta)
+			if err == nil && len(command) > 0 && !fuzzCommands[strings.ToLower(command[0])] {
+				t.Skip()
+			}
+		}
+		conn := NewMockTCPConn()
+		conn.ReadBuffer.WriteString(FramePreamble)
+		conn.ReadBuffer.Write(frame)
+		controller := NewSession(conn, repo)
+		defer controller.FinishSession()
+		controller.Dispatch()
+	})
+}
@@ -2,25 +2,101 @@ package controller
 
 import (
 	"errors"
-	"fmt"
+	"io"
 	"log"
-	"regexp"
+	"strconv"
 	"strings"
 	"sync/atomic"
-)
+	"time"
 
-var timeoutRegexp = regexp.MustCompile(`(t\=\d+)\/?`)
+	"github.com/bogdanovich/siberite/audit"
+	"github.com/bogdanovich/siberite/protocol"
+	"github.com/bogdanovich/siberite/queue"
+	"github.com/bogdanovich/siberite/repository"
+)
 
 // Get handles GET command
 // Command: GET <queue>
 // Response:
-// VALUE <queue> 0 <bytes>
+// VALUE <queue> <flags> <bytes>
+// <data block>
+// END
+// Command: GET <queue>/peek/i=<n>
+// Returns n-th item counting from the head (0 is the head item)
+// Command: GET <queue>/peek_tail
+// Returns the most recently enqueued item
+// Command: GET <queue>/abort/t=<milliseconds>
+// Returns the open item to the queue hidden from consumers for a given time
+// Command: GET <queue>/abort_tail
+// Returns the open item to the queue tail, behind items enqueued meanwhile
+// Command: GET <queue>/meta
+// Response:
+// VALUE <queue> <flags> <bytes> [<key>=<value> ...]
+// <data block>
+// END
+// Command: GET <queue>/move=<processing queue>
+// Takes the head item and enqueues it to a processing queue in one step,
+// the item stays there until a consumer takes it from the processing queue
+// Command: GET <queue>/ts (combines with other options, e.g. <queue>/open/ts)
+// Response:
+// VALUE <queue> <flags> <bytes> ts=<enqueue unix milliseconds>
+// <data block>
+// END
+// Command: GET <queue>/deliveries (combines with other options, e.g. <queue>/open/deliveries)
+// Response:
+// VALUE <queue> <flags> <bytes> deliveries=<times the item was opened, this one included>
+// <data block>
+// END
+// Command: GET <queue>/msgid (combines with other options)
+// Response:
+// VALUE <queue> <flags> <bytes> msg_id=<message id>
+// <data block>
+// END
+// Command: GET <queue>/open/id
+// Opens an item in addition to items the session holds open,
+// see CLOSE and ABORT
+// Response:
+// VALUE <queue> <flags> <bytes> id=<item id>
 // <data block>
 // END
+// Extended responses end with END <queue length>, see EXTGET
 func (c *Controller) Get(input []string) error {
+	if len(input) < 2 {
+		return errors.New("ERROR Invalid input")
+	}
 	var err error
 	cmd := parseGetCommand(input)
+	if cmd.QueueName == "" {
+		return errors.New("CLIENT_ERROR " + queue.ErrInvalidName.Error())
+	}
+	c.repo.TouchFanout(cmd.QueueName)
+
+	partitions := repository.Partitions(cmd.QueueName)
+	switch {
+	case partitions != nil:
+		err = c.getPartitioned(cmd, partitions)
+	case cmd.ByID && cmd.SubCommand != "open":
+		err = errors.New("ERROR " + "Invalid command")
+	case cmd.ByID:
+		err = c.openByID(cmd)
+	default:
+		err = c.getSubCommand(cmd)
+	}
+
+	if err != nil {
+		return err
+	}
+	if c.extendedGet {
+		c.writeEndLength(cmd.QueueName)
+	} else {
+		c.rw.Writer.WriteString("END\r\n")
+	}
+	c.rw.Writer.Flush()
+	return nil
+}
 
+func (c *Controller) getSubCommand(cmd *Command) error {
+	var err error
 	switch cmd.SubCommand {
 	case "", "open":
 		err = c.get(cmd)
@@ -30,43 +106,85 @@ func (c *Controller) Get(input []string) error {
 		if err = c.getClose(cmd); err == nil {
 			err = c.get(cmd)
 		}
-	case "abort":
+	case "abort", "abort_tail":
 		err = c.getAbort(cmd)
 	case "peek":
 		err = c.peek(cmd)
+	case "peek_tail":
+		err = c.peekTail(cmd)
+	case "move":
+		err = c.move(cmd)
 	default:
 		err = errors.New("ERROR " + "Invalid command")
 	}
+	return err
+}
 
-	if err != nil {
-		return err
+// writeEndLength writes END followed by queue length, see EXTGET
+func (c *Controller) writeEndLength(queueName string) {
+	var length uint64
+	for _, name := range expandPartitions([]string{queueName}) {
+		if q, err := c.repo.GetQueue(name); err == nil {
+			length += q.Length()
+		}
 	}
-	fmt.Fprint(c.rw.Writer, "END\r\n")
-	c.rw.Writer.Flush()
-	return nil
+	buf := getBuffer()
+	*buf = append(*buf, "END "...)
+	*buf = strconv.AppendUint(*buf, length, 10)
+	*buf = append(*buf, "\r\n"...)
+	c.rw.Writer.Write(*buf)
+	putBuffer(buf)
 }
 
 func (c *Controller) get(cmd *Command) error {
+	_, err := c.getItem(cmd)
+	return err
+}
+
+// getItem sends the head item of a queue, it reports whether the queue had one
+func (c *Controller) getItem(cmd *Command) (bool, error) {
 	if c.currentItem != nil {
-		return errors.New("CLIENT_ERROR " + "Close current item first")
+		return false, errors.New("CLIENT_ERROR " + "Close current item first")
 	}
 
 	q, err := c.repo.GetQueue(cmd.QueueName)
 	if err != nil {
 		log.Printf("Can't GetQueue %s: %s", cmd.QueueName, err.Error())
-		return errors.New("SERVER_ERROR " + err.Error())
+		return false, errors.New("SERVER_ERROR " + err.Error())
+	}
+	item, prefetched, err := c.dequeue(cmd, q)
+	if err != nil {
+		return false, errors.New("SERVER_ERROR " + err.Error())
 	}
-	item, _ := q.Dequeue()
-	if len(item.Value) > 0 {
-		fmt.Fprintf(c.rw.Writer, "VALUE %s 0 %d\r\n", cmd.QueueName, len(item.Value))
-		fmt.Fprintf(c.rw.Writer, "%s\r\n", item.Value)
+	open := strings.Contains(cmd.SubCommand, "open")
+	if item.Size > 0 {
+		if open {
+			item.Deliveries++
+		}
+		if err = c.sendItem(cmd, q, item); err != nil {
+			q.Prepend(item)
+			if prefetched {
+				q.CloseItem(item)
+			}
+			return false, errors.New("SERVER_ERROR " + err.Error())
+		}
+		c.repo.Mirror(cmd.QueueName, q, item)
+		c.observeItem(item)
 	}
-	if strings.Contains(cmd.SubCommand, "open") && len(item.Value) > 0 {
+	if open && item.Size > 0 {
 		c.setCurrentState(cmd, item)
-		q.AddOpenTransactions(1)
+		if !prefetched {
+			q.OpenItem(item)
+		}
+		c.audit(audit.EventOpen, cmd.QueueName, item)
+	} else if item.Size > 0 {
+		c.repo.Archive(cmd.QueueName, q, item)
+		q.DeleteBlob(item.Blob)
+		c.audit(audit.EventDequeue, cmd.QueueName, item)
+		c.consumed(cmd.QueueName, item)
 	}
 	atomic.AddUint64(&c.repo.Stats.CmdGet, 1)
-	return nil
+	return item.Size > 0, nil
 }
 
 func (c *Controller) getClose(cmd *Command) error {
@@ -76,7 +194,11 @@ func (c *Controller) getClose(cmd *Command) error {
 		return errors.New("SERVER_ERROR " + err.Error())
 	}
 	if c.currentItem != nil {
-		q.AddOpenTransactions(-1)
+		q.CloseItem(c.currentItem)
+		c.repo.Archive(cmd.QueueName, q, c.currentItem)
+		q.DeleteBlob(c.currentItem.Blob)
+		c.audit(audit.EventClose, cmd.QueueName, c.currentItem)
+		c.consumed(cmd.QueueName, c.currentItem)
 		c.setCurrentState(nil, nil)
 	}
 
@@ -98,12 +220,30 @@ func (c *Controller) abort(cmd *Command) error {
 			log.Printf("Can't GetQueue %s: %s", cmd.QueueName, err.Error())
 			return errors.New("SERVER_ERROR " + err.Error())
 		}
-		err = q.Prepend(c.currentItem)
+		// Storage spans of the item are children of the operation span
+		if cmd.Timeout > 0 {
+			span := c.startSpan("siberite.delay", cmd)
+			c.currentItem.Span = span
+			err = q.Delay(c.currentItem, time.Now().Add(cmd.Timeout))
+			span.End()
+		} else if cmd.SubCommand == "abort_tail" {
+			span := c.startSpan("siberite.enqueue", cmd)
+			c.currentItem.Span = span
+			err = q.EnqueueItem(c.currentItem)
+			span.End()
+		} else {
+			span := c.startSpan("siberite.prepend", cmd)
+			c.currentItem.Span = span
+			err = q.Prepend(c.currentItem)
+			span.End()
+		}
+		c.currentItem.Span = nil
 		if err != nil {
 			return errors.New("SERVER_ERROR " + err.Error())
 		}
 		if c.currentItem != nil {
-			q.AddOpenTransactions(-1)
+			q.CloseItem(c.currentItem)
+			c.audit(audit.EventAbort, cmd.QueueName, c.currentItem)
 			c.setCurrentState(nil, nil)
 		}
 	}
@@ -116,24 +256,115 @@ func (c *Controller) peek(cmd *Command) error {
 		log.Printf("Can't GetQueue %s: %s", cmd.QueueName, err.Error())
 		return errors.New("SERVER_ERROR " + err.Error())
 	}
-	item, _ := q.Peek()
-	if len(item.Value) > 0 {
-		fmt.Fprintf(c.rw.Writer, "VALUE %s 0 %d\r\n", cmd.QueueName, len(item.Value))
-		fmt.Fprintf(c.rw.Writer, "%s\r\n", item.Value)
+	span := c.startSpan("siberite.peek", cmd)
+	item, _ := q.PeekAt(cmd.Index)
+	span.End()
+	if item.Size > 0 {
+		if err = c.sendItem(cmd, q, item); err != nil {
+			return errors.New("SERVER_ERROR " + err.Error())
+		}
 	}
 	atomic.AddUint64(&c.repo.Stats.CmdGet, 1)
 	return nil
 }
 
-func parseGetCommand(input []string) *Command {
-	cmd := &Command{Name: input[0], QueueName: input[1], SubCommand: ""}
-	if strings.Contains(input[1], "t=") {
-		input[1] = timeoutRegexp.ReplaceAllString(input[1], "")
+func (c *Controller) peekTail(cmd *Command) error {
+	q, err := c.repo.GetQueue(cmd.QueueName)
+	if err != nil {
+		log.Printf("Can't GetQueue %s: %s", cmd.QueueName, err.Error())
+		return errors.New("SERVER_ERROR " + err.Error())
 	}
-	if strings.Contains(input[1], "/") {
-		tokens := strings.SplitN(input[1], "/", 2)
-		cmd.QueueName = tokens[0]
-		cmd.SubCommand = strings.Trim(tokens[1], "/")
+	span := c.startSpan("siberite.peek", cmd)
+	item, _ := q.PeekTail()
+	span.End()
+	if item.Size > 0 {
+		if err = c.sendItem(cmd, q, item); err != nil {
+			return errors.New("SERVER_ERROR " + err.Error())
+		}
+	}
+	atomic.AddUint64(&c.repo.Stats.CmdGet, 1)
+	return nil
+}
+
+// blobSource streams blob chunks of items, a queue or its snapshot
+type blobSource interface {
+	WriteBlob(blob *queue.Blob, w io.Writer) error
+}
+
+// sendItem writes VALUE response, blob chunks are streamed
+// to the client without loading the whole value
+func (c *Controller) sendItem(cmd *Command, q blobSource, item *queue.Item) error {
+	if c.frames != nil && (cmd.Name == "get" || cmd.Name == "gets") {
+		return c.captureItem(q, item)
+	}
+	if c.frames != nil && item.Blob != nil {
+		// Other responses are buffered for the frame
+		return errors.New("Blob values are only sent by GET with frames")
+	}
+	buf := getBuffer()
+	line := append(*buf, "VALUE "...)
+	line = append(line, cmd.QueueName...)
+	line = append(line, ' ')
+	line = strconv.AppendUint(line, uint64(item.Flags), 10)
+	line = append(line, ' ')
+	line = strconv.AppendInt(line, int64(item.Size), 10)
+	if cmd.Meta {
+		for _, header := range item.Headers {
+			line = append(line, ' ')
+			line = append(line, header.Key...)
+			line = append(line, '=')
+			line = append(line, header.Value...)
+		}
+	}
+	if cmd.Timestamp {
+		line = append(line, " ts="...)
+		ms := int64(0)
+		if !item.EnqueuedAt.IsZero() {
+			ms = item.EnqueuedAt.UnixNano() / int64(time.Millisecond)
+		}
+		line = strconv.AppendInt(line, ms, 10)
+	}
+	if cmd.Deliveries {
+		line = append(line, " deliveries="...)
+		line = strconv.AppendUint(line, uint64(item.Deliveries), 10)
+	}
+	if cmd.MessageID && item.MessageID != "" {
+		line = append(line, " "+repository.MessageIDHeader+"="...)
+		line = append(line, item.MessageID...)
+	}
+	if cmd.ByID {
+		line = append(line, " id="...)
+		line = strconv.AppendUint(line, c.heldID, 10)
+	}
+	line = append(line, "\r\n"...)
+	c.rw.Writer.Write(line)
+	*buf = line
+	putBuffer(buf)
+
+	if item.Blob != nil {
+		if err := q.WriteBlob(item.Blob, deadlineWriter{c, c.rw.Writer}); err != nil {
+			return err
+		}
+	} else {
+		c.rw.Writer.Write(item.Value)
+	}
+	_, err := c.rw.Writer.WriteString("\r\n")
+	return err
+}
+
+func parseGetCommand(input []string) *Command {
+	r := protocol.ParseGet(input[1])
+	return &Command{
+		Name:       input[0],
+		QueueName:  r.Queue,
+		SubCommand: r.SubCommand,
+		Meta:       r.Meta,
+		Timestamp:  r.Timestamp,
+		Deliveries: r.Deliveries,
+		MessageID:  r.MessageID,
+		ByID:       r.ByID,
+		Timeout:    r.Timeout,
+		Index:      r.Index,
+		MoveTo:     r.MoveTo,
 	}
-	return cmd
 }
@@ -1,8 +1,12 @@
 package controller
 
 import (
+	"fmt"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/bogdanovich/siberite/queue"
 	"github.com/bogdanovich/siberite/repository"
 	"github.com/stretchr/testify/assert"
 )
@@ -20,6 +24,15 @@ func Test_parseGetCommand(t *testing.T) {
 		"work/open/t=10":               "open",
 		"work/close/open/t=10":         "close/open",
 		"work/close/t=10/open/abort":   "close/open/abort",
+		"work/meta":                    "",
+		"work/open/meta":               "open",
+		"work/close/meta/open/t=10":    "close/open",
+		"work/peek/i=3":                "peek",
+		"work/peek/i=x":                "peek/i=x",
+		"work/peek_tail":               "peek_tail",
+		"work/abort_tail":              "abort_tail",
+		"work/open/ts":                 "open",
+		"work/open/deliveries":         "open",
 	}
 
 	for input, subCommand := range testCases {
@@ -28,6 +41,12 @@ func Test_parseGetCommand(t *testing.T) {
 		assert.Equal(t, "work", cmd.QueueName, input)
 		assert.Equal(t, subCommand, cmd.SubCommand, input)
 	}
+
+	cmd := parseGetCommand([]string{"get", "work/abort/t=5000"})
+	assert.Equal(t, "abort", cmd.SubCommand)
+	assert.Equal(t, 5*time.Second, cmd.Timeout)
+	cmd = parseGetCommand([]string{"get", "work/abort"})
+	assert.Equal(t, time.Duration(0), cmd.Timeout)
 }
 
 // Initialize queue 'test' with 1 item
@@ -83,6 +102,23 @@ func Test_Get(t *testing.T) {
 	assert.Equal(t, "END\r\n", mockTCPConn.WriteBuffer.String())
 }
 
+func Test_Get_InvalidInput(t *testing.T) {
+	repo, err := repository.Initialize(dir)
+	defer repo.CloseAllQueues()
+	assert.Nil(t, err)
+
+	controller := NewSession(NewMockTCPConn(), repo)
+	for input, expected := range map[string]string{
+		"get":        "ERROR Invalid input",
+		"get /open":  "CLIENT_ERROR " + queue.ErrInvalidName.Error(),
+		"gets //ts":  "CLIENT_ERROR " + queue.ErrInvalidName.Error(),
+		"get /abort": "CLIENT_ERROR " + queue.ErrInvalidName.Error(),
+	} {
+		err = controller.Get(strings.Split(input, " "))
+		assert.Equal(t, expected, err.Error(), input)
+	}
+}
+
 // Initialize test queue with 4 items
 // get test/open = value
 // get test = error
@@ -216,6 +252,84 @@ func Test_GetOpen_Disconnect(t *testing.T) {
 	assert.Equal(t, "VALUE test 0 1\r\n1\r\nEND\r\n", mockTCPConn.WriteBuffer.String())
 }
 
+// get test/open = 1
+// get test/abort/t=50 = 1 is hidden
+// get test = 2
+// get test = 1 after the delay
+func Test_GetAbortDelay(t *testing.T) {
+	repo, err := repository.Initialize(dir)
+	defer repo.CloseAllQueues()
+	assert.Nil(t, err)
+
+	mockTCPConn := NewMockTCPConn()
+	controller := NewSession(mockTCPConn, repo)
+
+	repo.FlushQueue("test")
+	q, err := repo.GetQueue("test")
+	assert.Nil(t, err)
+
+	q.Enqueue([]byte("1"))
+	q.Enqueue([]byte("2"))
+
+	err = controller.Get([]string{"get", "test/open"})
+	assert.Nil(t, err)
+	err = controller.Get([]string{"get", "test/abort/t=50"})
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(1), q.Delayed())
+	assert.Equal(t, int64(0), q.Stats.OpenTransactions)
+
+	mockTCPConn.WriteBuffer.Reset()
+	err = controller.Get([]string{"get", "test"})
+	assert.Nil(t, err)
+	assert.Equal(t, "VALUE test 0 1\r\n2\r\nEND\r\n", mockTCPConn.WriteBuffer.String())
+
+	mockTCPConn.WriteBuffer.Reset()
+	err = controller.Get([]string{"get", "test"})
+	assert.Nil(t, err)
+	assert.Equal(t, "END\r\n", mockTCPConn.WriteBuffer.String())
+
+	time.Sleep(60 * time.Millisecond)
+	mockTCPConn.WriteBuffer.Reset()
+	err = controller.Get([]string{"get", "test"})
+	assert.Nil(t, err)
+	assert.Equal(t, "VALUE test 0 1\r\n1\r\nEND\r\n", mockTCPConn.WriteBuffer.String())
+}
+
+// get test/open = 1
+// get test/abort_tail
+// get test = 2, get test = 1
+func Test_GetAbortTail(t *testing.T) {
+	repo, err := repository.Initialize(dir)
+	defer repo.CloseAllQueues()
+	assert.Nil(t, err)
+
+	mockTCPConn := NewMockTCPConn()
+	controller := NewSession(mockTCPConn, repo)
+
+	repo.FlushQueue("test")
+	q, err := repo.GetQueue("test")
+	assert.Nil(t, err)
+
+	q.Enqueue([]byte("1"))
+	q.Enqueue([]byte("2"))
+
+	err = controller.Get([]string{"get", "test/open"})
+	assert.Nil(t, err)
+	mockTCPConn.WriteBuffer.Reset()
+	err = controller.Get([]string{"get", "test/abort_tail"})
+	assert.Nil(t, err)
+	assert.Equal(t, "END\r\n", mockTCPConn.WriteBuffer.String())
+	assert.Equal(t, int64(0), q.Stats.OpenTransactions)
+	assert.Equal(t, uint64(2), q.Length())
+
+	for _, value := range []string{"2", "1"} {
+		mockTCPConn.WriteBuffer.Reset()
+		err = controller.Get([]string{"get", "test"})
+		assert.Nil(t, err)
+		assert.Equal(t, "VALUE test 0 1\r\n"+value+"\r\nEND\r\n", mockTCPConn.WriteBuffer.String())
+	}
+}
+
 // Initialize test queue with 4 items
 // get test/close/open = value
 // get test = error
@@ -327,3 +441,193 @@ func Test_Gets(t *testing.T) {
 	mockTCPConn.WriteBuffer.Reset()
 
 }
+
+// set test 5 0 1 = STORED
+// get test = value with flags 5
+// get test/peek = value with flags 5
+func Test_GetFlags(t *testing.T) {
+	repo, err := repository.Initialize(dir)
+	defer repo.CloseAllQueues()
+	assert.Nil(t, err)
+
+	mockTCPConn := NewMockTCPConn()
+	controller := NewSession(mockTCPConn, repo)
+
+	repo.FlushQueue("test")
+
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "1\r\n")
+	err = controller.Set([]string{"set", "test", "5", "0", "1"})
+	assert.Nil(t, err)
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "2\r\n")
+	err = controller.Set([]string{"set", "test", "0", "0", "1"})
+	assert.Nil(t, err)
+
+	mockTCPConn.WriteBuffer.Reset()
+
+	err = controller.Get([]string{"get", "test/peek"})
+	assert.Nil(t, err)
+	assert.Equal(t, "VALUE test 5 1\r\n1\r\nEND\r\n", mockTCPConn.WriteBuffer.String())
+
+	mockTCPConn.WriteBuffer.Reset()
+
+	err = controller.Get([]string{"get", "test"})
+	assert.Nil(t, err)
+	assert.Equal(t, "VALUE test 5 1\r\n1\r\nEND\r\n", mockTCPConn.WriteBuffer.String())
+
+	mockTCPConn.WriteBuffer.Reset()
+
+	err = controller.Get([]string{"get", "test"})
+	assert.Nil(t, err)
+	assert.Equal(t, "VALUE test 0 1\r\n2\r\nEND\r\n", mockTCPConn.WriteBuffer.String())
+}
+
+// setmeta test 0 0 1 trace=abc route=eu = STORED
+// get test/peek = value without headers
+// get test/open/meta = value with headers
+func Test_GetMeta(t *testing.T) {
+	repo, err := repository.Initialize(dir)
+	defer repo.CloseAllQueues()
+	assert.Nil(t, err)
+
+	mockTCPConn := NewMockTCPConn()
+	controller := NewSession(mockTCPConn, repo)
+
+	repo.FlushQueue("test")
+
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "1\r\n")
+	err = controller.SetMeta([]string{"setmeta", "test", "3", "0", "1", "trace=abc", "route=eu"})
+	assert.Nil(t, err)
+
+	mockTCPConn.WriteBuffer.Reset()
+
+	err = controller.Get([]string{"get", "test/peek"})
+	assert.Nil(t, err)
+	assert.Equal(t, "VALUE test 3 1\r\n1\r\nEND\r\n", mockTCPConn.WriteBuffer.String())
+
+	mockTCPConn.WriteBuffer.Reset()
+
+	err = controller.Get([]string{"get", "test/open/meta"})
+	assert.Nil(t, err)
+	assert.Equal(t, "VALUE test 3 1 trace=abc route=eu\r\n1\r\nEND\r\n", mockTCPConn.WriteBuffer.String())
+	assert.True(t, controller.currentCommand.Meta)
+}
+
+// get test/open/ts = value with enqueue time
+func Test_GetTimestamp(t *testing.T) {
+	repo, err := repository.Initialize(dir)
+	defer repo.CloseAllQueues()
+	assert.Nil(t, err)
+
+	mockTCPConn := NewMockTCPConn()
+	controller := NewSession(mockTCPConn, repo)
+
+	repo.FlushQueue("test")
+	q, err := repo.GetQueue("test")
+	assert.Nil(t, err)
+	enqueuedAt := time.Unix(1443308758, 123e6)
+	q.EnqueueItem(&queue.Item{Value: []byte("1"), EnqueuedAt: enqueuedAt, Headers: []queue.Header{{Key: "k", Value: "v"}}})
+
+	err = controller.Get([]string{"get", "test/peek/ts"})
+	assert.Nil(t, err)
+	assert.Equal(t, "VALUE test 0 1 ts=1443308758123\r\n1\r\nEND\r\n", mockTCPConn.WriteBuffer.String())
+
+	mockTCPConn.WriteBuffer.Reset()
+	err = controller.Get([]string{"get", "test/open/meta/ts"})
+	assert.Nil(t, err)
+	assert.Equal(t, "VALUE test 0 1 k=v ts=1443308758123\r\n1\r\nEND\r\n", mockTCPConn.WriteBuffer.String())
+	assert.Nil(t, controller.Get([]string{"get", "test/close"}))
+}
+
+// get test/open/deliveries twice with abort in between = deliveries=1, deliveries=2
+// get test/peek/deliveries after abort = deliveries=2
+func Test_GetDeliveries(t *testing.T) {
+	repo, err := repository.Initialize(dir)
+	defer repo.CloseAllQueues()
+	assert.Nil(t, err)
+
+	mockTCPConn := NewMockTCPConn()
+	controller := NewSession(mockTCPConn, repo)
+
+	repo.FlushQueue("test")
+	q, err := repo.GetQueue("test")
+	assert.Nil(t, err)
+	q.Enqueue([]byte("1"))
+
+	err = controller.Get([]string{"get", "test/open/deliveries"})
+	assert.Nil(t, err)
+	assert.Nil(t, controller.Get([]string{"get", "test/abort"}))
+	err = controller.Get([]string{"get", "test/open/ts/deliveries"})
+	assert.Nil(t, err)
+	assert.Nil(t, controller.Get([]string{"get", "test/abort"}))
+	assert.Regexp(t, "^VALUE test 0 1 deliveries=1\r\n1\r\nEND\r\nEND\r\n"+
+		"VALUE test 0 1 ts=[0-9]+ deliveries=2\r\n1\r\nEND\r\nEND\r\n$", mockTCPConn.WriteBuffer.String())
+
+	mockTCPConn.WriteBuffer.Reset()
+	err = controller.Get([]string{"get", "test/peek/deliveries"})
+	assert.Nil(t, err)
+	err = controller.Get([]string{"get", "test/open"})
+	assert.Nil(t, err)
+	assert.Equal(t, "VALUE test 0 1 deliveries=2\r\n1\r\nEND\r\nVALUE test 0 1\r\n1\r\nEND\r\n", mockTCPConn.WriteBuffer.String())
+	assert.Equal(t, uint32(3), controller.currentItem.Deliveries)
+	assert.Nil(t, controller.Get([]string{"get", "test/close"}))
+}
+
+// Initialize queue 'test' with 3 items
+// get test/peek/i=1 = second value
+// get test/peek/i=3 = empty
+// get test/peek_tail = last value
+func Test_GetPeekPosition(t *testing.T) {
+	repo, err := repository.Initialize(dir)
+	defer repo.CloseAllQueues()
+	assert.Nil(t, err)
+
+	mockTCPConn := NewMockTCPConn()
+	controller := NewSession(mockTCPConn, repo)
+
+	repo.FlushQueue("test")
+	q, err := repo.GetQueue("test")
+	assert.Nil(t, err)
+
+	q.Enqueue([]byte("1"))
+	q.Enqueue([]byte("2"))
+	q.Enqueue([]byte("3"))
+
+	err = controller.Get([]string{"get", "test/peek/i=1"})
+	assert.Nil(t, err)
+	assert.Equal(t, "VALUE test 0 1\r\n2\r\nEND\r\n", mockTCPConn.WriteBuffer.String())
+
+	mockTCPConn.WriteBuffer.Reset()
+
+	err = controller.Get([]string{"get", "test/peek/i=3"})
+	assert.Nil(t, err)
+	assert.Equal(t, "END\r\n", mockTCPConn.WriteBuffer.String())
+
+	mockTCPConn.WriteBuffer.Reset()
+
+	err = controller.Get([]string{"get", "test/peek_tail"})
+	assert.Nil(t, err)
+	assert.Equal(t, "VALUE test 0 1\r\n3\r\nEND\r\n", mockTCPConn.WriteBuffer.String())
+
+	mockTCPConn.WriteBuffer.Reset()
+
+	err = controller.Get([]string{"get", "test/peek/i=x"})
+	assert.Equal(t, "ERROR Invalid command", err.Error())
+	assert.Equal(t, uint64(3), q.Length())
+}
+
+func Benchmark_sendItem(b *testing.B) {
+	repo, _ := repository.Initialize(dir)
+	defer repo.CloseAllQueues()
+
+	mockTCPConn := NewMockTCPConn()
+	controller := NewSession(mockTCPConn, repo)
+	cmd := &Command{Name: "get", QueueName: "work", Meta: true}
+	item := &queue.Item{Value: []byte("0123456789"), Size: 10, Flags: 1, Headers: []queue.Header{{Key: "k", Value: "v"}}}
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		mockTCPConn.WriteBuffer.Reset()
+		controller.sendItem(cmd, nil, item)
+		controller.rw.Writer.Flush()
+	}
+}
@@ -0,0 +1,184 @@
+package controller
+
+import (
+	"errors"
+	"log"
+	"sort"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/bogdanovich/siberite/audit"
+	"github.com/bogdanovich/siberite/queue"
+	"github.com/bogdanovich/siberite/repository"
+)
+
+// maxHeldItems limits items a session holds open by id at once
+const maxHeldItems = 1000
+
+// heldKey identifies an item opened by id. Ids are given by the session
+// in the order items are opened, queue keys are reused by prepended items.
+type heldKey struct {
+	queue string
+	id    uint64
+}
+
+// heldItem is an item opened with GET <queue>/open/id
+type heldItem struct {
+	id   uint64
+	cmd  *Command
+	item *queue.Item
+}
+
+// openByID opens the next item in addition to items the session holds,
+// VALUE line carries its id for CLOSE and ABORT
+func (c *Controller) openByID(cmd *Command) error {
+	if len(c.held) >= maxHeldItems {
+		return errors.New("CLIENT_ERROR Too many open items")
+	}
+	q, err := c.repo.GetQueue(cmd.QueueName)
+	if err != nil {
+		log.Printf("Can't GetQueue %s: %s", cmd.QueueName, err.Error())
+		return errors.New("SERVER_ERROR " + err.Error())
+	}
+	item, prefetched, err := c.dequeue(cmd, q)
+	if err != nil {
+		return errors.New("SERVER_ERROR " + err.Error())
+	}
+	if item.Size > 0 {
+		c.heldID++
+		item.Deliveries++
+		if c.frames != nil {
+			c.frames.itemID = c.heldID
+		}
+		if err = c.sendItem(cmd, q, item); err != nil {
+			q.Prepend(item)
+			if prefetched {
+				q.CloseItem(item)
+			}
+			return errors.New("SERVER_ERROR " + err.Error())
+		}
+		c.repo.Mirror(cmd.QueueName, q, item)
+		c.observeItem(item)
+		if !prefetched {
+			q.OpenItem(item)
+		}
+		if c.held == nil {
+			c.held = map[heldKey]*heldItem{}
+		}
+		c.held[heldKey{cmd.QueueName, c.heldID}] = &heldItem{id: c.heldID, cmd: cmd, item: item}
+		c.repo.TrackMemory(repository.MemoryOpenItems, itemMemory(item))
+		c.audit(audit.EventOpen, cmd.QueueName, item)
+	}
+	atomic.AddUint64(&c.repo.Stats.CmdGet, 1)
+	return nil
+}
+
+// Close handles CLOSE command, it confirms an item opened by id
+// Command: CLOSE <queue> <item id>
+// Response: END
+// Response: NOT_FOUND (the session holds no such item)
+func (c *Controller) Close(input []string) error {
+	held, err := c.takeHeld(input, 3)
+	if err != nil || held == nil {
+		return err
+	}
+	q, err := c.repo.GetQueue(held.cmd.QueueName)
+	if err != nil {
+		log.Printf("Can't GetQueue %s: %s", held.cmd.QueueName, err.Error())
+		return errors.New("SERVER_ERROR " + err.Error())
+	}
+	q.CloseItem(held.item)
+	c.repo.Archive(held.cmd.QueueName, q, held.item)
+	q.DeleteBlob(held.item.Blob)
+	c.audit(audit.EventClose, held.cmd.QueueName, held.item)
+	c.consumed(held.cmd.QueueName, held.item)
+	c.rw.Writer.WriteString("END\r\n")
+	c.rw.Writer.Flush()
+	return nil
+}
+
+// Abort handles ABORT command, it returns an item opened by id to the queue head
+// Command: ABORT <queue> <item id> [<delay ms>]
+// Response: END
+// Response: NOT_FOUND (the session holds no such item)
+// With a delay the item is hidden from consumers for a given time.
+func (c *Controller) Abort(input []string) error {
+	var delay time.Duration
+	if len(input) == 4 {
+		ms, err := strconv.ParseUint(input[3], 10, 32)
+		if err != nil {
+			return errors.New("ERROR Invalid <delay> number")
+		}
+		delay = time.Duration(ms) * time.Millisecond
+		input = input[:3]
+	}
+	held, err := c.takeHeld(input, 3)
+	if err != nil || held == nil {
+		return err
+	}
+	q, err := c.repo.GetQueue(held.cmd.QueueName)
+	if err != nil {
+		log.Printf("Can't GetQueue %s: %s", held.cmd.QueueName, err.Error())
+		return errors.New("SERVER_ERROR " + err.Error())
+	}
+	span := c.startSpan("siberite.prepend", held.cmd)
+	if delay > 0 {
+		err = q.Delay(held.item, time.Now().Add(delay))
+	} else {
+		err = q.Prepend(held.item)
+	}
+	span.End()
+	if err != nil {
+		c.hold(held)
+		return errors.New("SERVER_ERROR " + err.Error())
+	}
+	q.CloseItem(held.item)
+	c.audit(audit.EventAbort, held.cmd.QueueName, held.item)
+	c.rw.Writer.WriteString("END\r\n")
+	c.rw.Writer.Flush()
+	return nil
+}
+
+// takeHeld removes an item named by CLOSE or ABORT arguments from
+// the session, NOT_FOUND is sent if the session doesn't hold it
+func (c *Controller) takeHeld(input []string, args int) (*heldItem, error) {
+	if len(input) != args {
+		return nil, errors.New("ERROR Invalid input")
+	}
+	id, err := strconv.ParseUint(input[2], 10, 64)
+	if err != nil {
+		return nil, errors.New("ERROR Invalid <item id> number")
+	}
+	key := heldKey{input[1], id}
+	held, ok := c.held[key]
+	if !ok {
+		c.rw.Writer.WriteString("NOT_FOUND\r\n")
+		c.rw.Writer.Flush()
+		return nil, nil
+	}
+	delete(c.held, key)
+	c.repo.TrackMemory(repository.MemoryOpenItems, -itemMemory(held.item))
+	return held, nil
+}
+
+// hold puts an item back to items held by the session
+func (c *Controller) hold(held *heldItem) {
+	c.held[heldKey{held.cmd.QueueName, held.id}] = held
+	c.repo.TrackMemory(repository.MemoryOpenItems, itemMemory(held.item))
+}
+
+// releaseHeld returns items opened by id according to on_disconnect policy,
+// items opened later go first, so the queue head keeps their order
+func (c *Controller) releaseHeld() {
+	list := make([]*heldItem, 0, len(c.held))
+	for _, held := range c.held {
+		list = append(list, held)
+	}
+	c.held = nil
+	sort.Slice(list, func(i, j int) bool { return list[i].id > list[j].id })
+	for _, held := range list {
+		c.repo.TrackMemory(repository.MemoryOpenItems, -itemMemory(held.item))
+		c.returnOnDisconnect(held.cmd, held.item)
+	}
+}
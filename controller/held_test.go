@@ -0,0 +1,70 @@
+package controller
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/bogdanovich/siberite/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_CloseAbortByID(t *testing.T) {
+	repo, err := repository.Initialize(dir)
+	defer repo.CloseAllQueues()
+	assert.Nil(t, err)
+
+	repo.FlushQueue("test")
+	q, _ := repo.GetQueue("test")
+	q.Enqueue([]byte("1"))
+	q.Enqueue([]byte("2"))
+	q.Enqueue([]byte("3"))
+
+	mockTCPConn := NewMockTCPConn()
+	controller := NewSession(mockTCPConn, repo)
+	defer controller.FinishSession()
+
+	ids := make([]string, 3)
+	for i := range ids {
+		mockTCPConn.WriteBuffer.Reset()
+		assert.Nil(t, controller.Get([]string{"get", "test/open/id"}))
+		response := mockTCPConn.WriteBuffer.String()
+		fields := strings.Fields(response)
+		assert.Equal(t, fmt.Sprintf("VALUE test 0 1 %s\r\n%d\r\nEND\r\n", fields[4], i+1), response)
+		ids[i] = strings.TrimPrefix(fields[4], "id=")
+	}
+	assert.Equal(t, int64(3), q.Stats.OpenTransactions)
+
+	// Items are acknowledged in any order
+	mockTCPConn.WriteBuffer.Reset()
+	assert.Nil(t, controller.Close([]string{"close", "test", ids[1]}))
+	assert.Equal(t, "END\r\n", mockTCPConn.WriteBuffer.String())
+
+	mockTCPConn.WriteBuffer.Reset()
+	assert.Nil(t, controller.Close([]string{"close", "test", ids[1]}))
+	assert.Equal(t, "NOT_FOUND\r\n", mockTCPConn.WriteBuffer.String())
+
+	mockTCPConn.WriteBuffer.Reset()
+	assert.Nil(t, controller.Abort([]string{"abort", "test", ids[0]}))
+	assert.Equal(t, "END\r\n", mockTCPConn.WriteBuffer.String())
+	assert.Equal(t, int64(1), q.Stats.OpenTransactions)
+	assert.Equal(t, uint64(1), q.Length())
+
+	err = controller.Close([]string{"close", "test", "x"})
+	assert.Equal(t, "ERROR Invalid <item id> number", err.Error())
+	err = controller.Get([]string{"get", "test/id"})
+	assert.Equal(t, "ERROR Invalid command", err.Error())
+
+	// Items still open are returned on disconnect in the order they were opened
+	mockTCPConn.WriteBuffer.Reset()
+	assert.Nil(t, controller.Get([]string{"get", "test/open/id"}))
+	controller.FinishSession()
+	assert.Equal(t, int64(0), q.Stats.OpenTransactions)
+	assert.Equal(t, uint64(2), q.Length())
+
+	mockTCPConn = NewMockTCPConn()
+	controller = NewSession(mockTCPConn, repo)
+	assert.Nil(t, controller.Get([]string{"get", "test"}))
+	assert.Nil(t, controller.Get([]string{"get", "test"}))
+	assert.Equal(t, "VALUE test 0 1\r\n3\r\nEND\r\nVALUE test 0 1\r\n1\r\nEND\r\n", mockTCPConn.WriteBuffer.String())
+}
@@ -0,0 +1,100 @@
+package controller
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bogdanovich/siberite/config"
+	"github.com/bogdanovich/siberite/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_MemoryStats(t *testing.T) {
+	repo, err := repository.Initialize(dir)
+	defer repo.CloseAllQueues()
+	assert.Nil(t, err)
+	repo.FlushQueue("test")
+
+	mockTCPConn := NewMockTCPConn()
+	controller := NewSession(mockTCPConn, repo)
+
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "set test 0 0 5\r\n12345\r\n")
+	assert.Nil(t, controller.Dispatch())
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "get test/open\r\n")
+	assert.Nil(t, controller.Dispatch())
+
+	mockTCPConn.WriteBuffer.Reset()
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "stats memory\r\n")
+	assert.Nil(t, controller.Dispatch())
+	output := mockTCPConn.WriteBuffer.String()
+	assert.True(t, strings.HasPrefix(output, "STAT memory_connections 8192\r\nSTAT memory_open_items 5\r\n"), output)
+	assert.True(t, strings.HasSuffix(output, "STAT memory_limit 0\r\nSTAT memory_caches_shrunk 0\r\nEND\r\n"), output)
+
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "get test/close\r\n")
+	assert.Nil(t, controller.Dispatch())
+	assert.Equal(t, int64(0), repo.MemoryUsage().OpenItems)
+
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "txn begin\r\nset test 0 0 3\r\nabc\r\n")
+	assert.Nil(t, controller.Dispatch())
+	assert.Nil(t, controller.Dispatch())
+	assert.Equal(t, int64(3), repo.MemoryUsage().Transactions)
+	controller.FinishSession()
+	assert.Equal(t, int64(0), repo.MemoryUsage().Transactions)
+	assert.Equal(t, int64(0), repo.MemoryUsage().Connections)
+}
+
+func Test_MaxMemory(t *testing.T) {
+	cfg := config.Default()
+	cfg.MaxMemory = 1 << 40
+	assert.Nil(t, cfg.Validate())
+	repo, err := repository.InitializeWithConfig(dir, cfg)
+	defer repo.CloseAllQueues()
+	assert.Nil(t, err)
+	repo.FlushQueue("test")
+
+	mockTCPConn := NewMockTCPConn()
+	controller := NewSession(mockTCPConn, repo)
+	defer controller.FinishSession()
+
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "txn begin\r\nset test 0 0 3\r\nabc\r\n")
+	assert.Nil(t, controller.Dispatch())
+	assert.Nil(t, controller.Dispatch())
+
+	// Storage memory is estimated in background
+	assert.Nil(t, cfg.Set("max_memory", "1"))
+	assert.Eventually(t, repo.MemoryExceeded, 5*time.Second, 10*time.Millisecond)
+
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "set test 0 0 5\r\n12345\r\n")
+	err = controller.Dispatch()
+	assert.Equal(t, "SERVER_ERROR Out of memory", err.Error())
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "txn commit\r\n")
+	err = controller.Dispatch()
+	assert.Equal(t, "SERVER_ERROR Out of memory", err.Error())
+	q, _ := repo.GetQueue("test")
+	assert.Equal(t, uint64(0), q.Length())
+
+	q.Enqueue([]byte("1"))
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "get test/move=test_processing\r\n")
+	err = controller.Dispatch()
+	assert.Equal(t, "SERVER_ERROR Out of memory", err.Error())
+	assert.Equal(t, uint64(1), q.Length())
+	repo.DeleteQueue("test_processing")
+}
+
+func Test_SessionBuffers(t *testing.T) {
+	cfg := config.Default()
+	cfg.Network = &config.NetworkConfig{ReadBuffer: 1024, WriteBuffer: 65536}
+	assert.Nil(t, cfg.Validate())
+	repo, err := repository.InitializeWithConfig(dir, cfg)
+	defer repo.CloseAllQueues()
+	assert.Nil(t, err)
+
+	controller := NewSession(NewMockTCPConn(), repo)
+	assert.Equal(t, 1024, controller.rw.Reader.Size())
+	assert.Equal(t, 65536, controller.rw.Writer.Size())
+	assert.Equal(t, int64(1024+65536), repo.MemoryUsage().Connections)
+	controller.FinishSession()
+	assert.Equal(t, int64(0), repo.MemoryUsage().Connections)
+}
@@ -0,0 +1,48 @@
+package controller
+
+import (
+	"sync"
+
+	"github.com/bogdanovich/siberite/queue"
+)
+
+// Handler executes a client command
+type Handler func(cmd *Command) error
+
+// Middleware wraps execution of client commands. It may validate
+// or rewrite cmd.Args before calling next, return an error instead
+// of calling next to reject a command (the error is sent to the client
+// as is, e.g. "CLIENT_ERROR Forbidden"), or act on the result once next
+// returns, cmd.Item then holds an item stored by SET or returned by GET
+type Middleware func(cmd *Command, next Handler) error
+
+var (
+	middleware     []Middleware
+	middlewareLock sync.RWMutex
+)
+
+// Use adds middleware to commands of every connection,
+// middleware added first runs first
+func Use(m ...Middleware) {
+	middlewareLock.Lock()
+	defer middlewareLock.Unlock()
+	middleware = append(middleware, m...)
+}
+
+// chain wraps a handler with registered middleware
+func chain(h Handler) Handler {
+	middlewareLock.RLock()
+	defer middlewareLock.RUnlock()
+	for i := len(middleware) - 1; i >= 0; i-- {
+		m, next := middleware[i], h
+		h = func(cmd *Command) error { return m(cmd, next) }
+	}
+	return h
+}
+
+// observeItem passes an item handled by a command to middleware
+func (c *Controller) observeItem(item *queue.Item) {
+	if c.command != nil {
+		c.command.Item = item
+	}
+}
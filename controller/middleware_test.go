@@ -0,0 +1,59 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/bogdanovich/siberite/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Middleware(t *testing.T) {
+	repo, err := repository.Initialize(dir)
+	defer repo.CloseAllQueues()
+	assert.Nil(t, err)
+	repo.FlushQueue("test")
+	defer repo.DeleteQueue("renamed")
+
+	stored := []string{}
+	Use(func(cmd *Command, next Handler) error {
+		if cmd.QueueName == "forbidden" {
+			return errors.New("CLIENT_ERROR Forbidden")
+		}
+		return next(cmd)
+	}, func(cmd *Command, next Handler) error {
+		// Rewrite queue name before the command runs
+		if cmd.Name == "set" && cmd.QueueName == "test" {
+			cmd.Args[1] = "renamed"
+		}
+		err := next(cmd)
+		if err == nil && cmd.Name == "set" {
+			stored = append(stored, string(cmd.Item.Value))
+		}
+		return err
+	})
+	defer func() { middleware = nil }()
+
+	mockTCPConn := NewMockTCPConn()
+	controller := NewSession(mockTCPConn, repo)
+
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "set test 0 0 1\r\n1\r\n")
+	err = controller.Dispatch()
+	assert.Nil(t, err)
+	assert.Equal(t, "STORED\r\n", mockTCPConn.WriteBuffer.String())
+	assert.Equal(t, []string{"1"}, stored)
+	q, _ := repo.GetQueue("renamed")
+	assert.Equal(t, uint64(1), q.Length())
+
+	mockTCPConn.WriteBuffer.Reset()
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "get forbidden\r\n")
+	err = controller.Dispatch()
+	assert.Equal(t, "CLIENT_ERROR Forbidden", err.Error())
+	assert.Equal(t, "CLIENT_ERROR Forbidden\r\n", mockTCPConn.WriteBuffer.String())
+
+	// Session context ends with the session
+	assert.Nil(t, controller.Context().Err())
+	controller.FinishSession()
+	assert.NotNil(t, controller.Context().Err())
+}
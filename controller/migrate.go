@@ -0,0 +1,56 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+
+	"github.com/bogdanovich/siberite/repository"
+)
+
+// Migrate handles MIGRATE command, it streams all items of a queue
+// to another siberite server in background, progress is shown by
+// queue_<queue>_migrate_* stats. Running it again after a stop or
+// a restart continues with items left in the queue.
+// Command: MIGRATE <queue> <host:port> [<items per second>]
+// Response:
+// MIGRATING <queue> <host:port>
+// END
+// Command: MIGRATE <queue> stop
+// Response: END
+func (c *Controller) Migrate(input []string) error {
+	if len(input) < 3 || len(input) > 4 {
+		return errors.New("ERROR Invalid input")
+	}
+	name, target := input[1], input[2]
+	if target == "stop" && len(input) == 3 {
+		if !c.repo.StopMigration(name) {
+			return errors.New("CLIENT_ERROR No migration is running")
+		}
+		c.rw.Writer.WriteString("END\r\n")
+		c.rw.Writer.Flush()
+		return nil
+	}
+	if _, _, err := net.SplitHostPort(target); err != nil {
+		return errors.New("CLIENT_ERROR Invalid target address")
+	}
+	rate := 0
+	if len(input) == 4 {
+		var err error
+		if rate, err = strconv.Atoi(input[3]); err != nil || rate < 0 {
+			return errors.New("CLIENT_ERROR Invalid rate")
+		}
+	}
+	err := c.repo.Migrate(name, target, rate)
+	if err == repository.ErrMigrationRunning {
+		return errors.New("CLIENT_ERROR " + err.Error())
+	} else if err != nil {
+		log.Printf("Can't migrate %s: %s", name, err.Error())
+		return errors.New("SERVER_ERROR " + err.Error())
+	}
+	fmt.Fprintf(c.rw.Writer, "MIGRATING %s %s\r\nEND\r\n", name, target)
+	c.rw.Writer.Flush()
+	return nil
+}
@@ -0,0 +1,58 @@
+package controller
+
+import (
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/bogdanovich/siberite/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Migrate(t *testing.T) {
+	repo, err := repository.Initialize(dir)
+	defer repo.CloseAllQueues()
+	assert.Nil(t, err)
+	repo.FlushQueue("test")
+
+	mockTCPConn := NewMockTCPConn()
+	controller := NewSession(mockTCPConn, repo)
+	defer controller.FinishSession()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer listener.Close()
+	target := listener.Addr().String()
+
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "set test 0 0 1\r\n1\r\n")
+	assert.Nil(t, controller.Dispatch())
+
+	// The target never responds, the item is in flight until the stop
+	mockTCPConn.WriteBuffer.Reset()
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "migrate test %s 10\r\n", target)
+	assert.Nil(t, controller.Dispatch())
+	assert.Equal(t, "MIGRATING test "+target+"\r\nEND\r\n", mockTCPConn.WriteBuffer.String())
+
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "migrate test %s\r\n", target)
+	err = controller.Dispatch()
+	assert.Equal(t, "CLIENT_ERROR Queue migration is already running", err.Error())
+
+	mockTCPConn.WriteBuffer.Reset()
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "migrate test stop\r\n")
+	assert.Nil(t, controller.Dispatch())
+	assert.Equal(t, "END\r\n", mockTCPConn.WriteBuffer.String())
+	q, _ := repo.GetQueue("test")
+	for i := 0; i < 100 && q.Length() == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, uint64(1), q.Length())
+
+	for _, input := range []string{"migrate test localhost", "migrate test localhost:1 fast"} {
+		fmt.Fprintf(&mockTCPConn.ReadBuffer, "%s\r\n", input)
+		err = controller.Dispatch()
+		assert.NotNil(t, err, input)
+	}
+	err = controller.Migrate([]string{"migrate", "test"})
+	assert.Equal(t, "ERROR Invalid input", err.Error())
+}
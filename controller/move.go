@@ -0,0 +1,60 @@
+package controller
+
+import (
+	"errors"
+	"log"
+	"sync/atomic"
+
+	"github.com/bogdanovich/siberite/queue"
+)
+
+// move takes the head item of a queue and enqueues it to a processing
+// queue in one operation, the item is sent as for GET <queue>. Unlike open
+// reads it is kept in the processing queue when the consumer disconnects.
+func (c *Controller) move(cmd *Command) error {
+	if cmd.MoveTo == cmd.QueueName {
+		return errors.New("CLIENT_ERROR " + queue.ErrSameQueue.Error())
+	}
+	q, err := c.repo.GetQueue(cmd.QueueName)
+	if err != nil {
+		log.Printf("Can't GetQueue %s: %s", cmd.QueueName, err.Error())
+		return errors.New("SERVER_ERROR " + err.Error())
+	}
+	dest, err := c.repo.GetQueue(cmd.MoveTo)
+	if err != nil {
+		log.Printf("Can't GetQueue %s: %s", cmd.MoveTo, err.Error())
+		return errors.New("SERVER_ERROR " + err.Error())
+	}
+	if !c.repo.Writable(cmd.MoveTo, &queue.Item{}) {
+		return errors.New("SERVER_ERROR Queue is read-only on a follower")
+	}
+	if c.repo.SnapshotLoading(cmd.MoveTo) {
+		return errors.New("SERVER_ERROR Queue snapshot is loading")
+	}
+	if c.repo.MemoryExceeded() {
+		return errors.New("SERVER_ERROR Out of memory")
+	}
+
+	span := c.startSpan("siberite.move", cmd)
+	item, moved, err := q.Move(dest)
+	span.End()
+	if err == queue.ErrEmpty {
+		atomic.AddUint64(&c.repo.Stats.CmdGet, 1)
+		return nil
+	}
+	if !moved {
+		return errors.New("SERVER_ERROR " + err.Error())
+	}
+	c.repo.Mirror(cmd.QueueName, dest, item)
+	c.repo.Enqueued(cmd.MoveTo, item, c.id)
+	if err != nil {
+		// The item is in both queues, the processing copy is kept
+		return errors.New("SERVER_ERROR " + err.Error())
+	}
+	if err = c.sendItem(cmd, dest, item); err != nil {
+		return errors.New("SERVER_ERROR " + err.Error())
+	}
+	c.observeItem(item)
+	atomic.AddUint64(&c.repo.Stats.CmdGet, 1)
+	return nil
+}
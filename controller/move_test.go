@@ -0,0 +1,46 @@
+package controller
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/bogdanovich/siberite/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_GetMove(t *testing.T) {
+	repo, err := repository.Initialize(dir)
+	defer repo.CloseAllQueues()
+	assert.Nil(t, err)
+	repo.FlushQueue("test")
+	defer repo.DeleteQueue("test_processing")
+
+	mockTCPConn := NewMockTCPConn()
+	controller := NewSession(mockTCPConn, repo)
+
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "set test 0 0 1\r\n1\r\n")
+	assert.Nil(t, controller.Dispatch())
+
+	mockTCPConn.WriteBuffer.Reset()
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "get test/move=test_processing\r\n")
+	assert.Nil(t, controller.Dispatch())
+	assert.Equal(t, "VALUE test 0 1\r\n1\r\nEND\r\n", mockTCPConn.WriteBuffer.String())
+
+	// An empty source answers END
+	mockTCPConn.WriteBuffer.Reset()
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "get test/move=test_processing\r\n")
+	assert.Nil(t, controller.Dispatch())
+	assert.Equal(t, "END\r\n", mockTCPConn.WriteBuffer.String())
+
+	// The item is kept in the processing queue after the consumer is gone
+	controller.FinishSession()
+	q, _ := repo.GetQueue("test")
+	assert.Equal(t, uint64(0), q.Length())
+	pq, _ := repo.GetQueue("test_processing")
+	assert.Equal(t, uint64(1), pq.Length())
+
+	err = controller.Get([]string{"get", "test/move=test"})
+	assert.Equal(t, "CLIENT_ERROR Can't move items to the same queue", err.Error())
+	err = controller.Get([]string{"get", "test/open/move=test_processing"})
+	assert.Equal(t, "ERROR Invalid command", err.Error())
+}
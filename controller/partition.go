@@ -0,0 +1,69 @@
+package controller
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/bogdanovich/siberite/queue"
+	"github.com/bogdanovich/siberite/repository"
+)
+
+// getPartitioned handles GET of a partitioned queue <queue>#<count>,
+// items are taken from partitions round robin, skipping empty ones.
+// VALUE lines name the partition of an item, an open item is closed
+// or aborted by the partition name or by the partitioned queue name.
+func (c *Controller) getPartitioned(cmd *Command, partitions []string) error {
+	if cmd.ByID {
+		return errors.New("ERROR Invalid command")
+	}
+	switch cmd.SubCommand {
+	case "", "open":
+		return c.consumePartitions(cmd, partitions)
+	case "close", "abort", "abort_tail", "close/open":
+		if c.currentCommand != nil && partitionOf(c.currentCommand.QueueName, cmd.QueueName) {
+			cmd.QueueName = c.currentCommand.QueueName
+		}
+		if cmd.SubCommand != "close/open" {
+			return c.getSubCommand(cmd)
+		}
+		if err := c.getClose(cmd); err != nil {
+			return err
+		}
+		return c.consumePartitions(cmd, partitions)
+	}
+	return errors.New("ERROR Invalid command")
+}
+
+func (c *Controller) consumePartitions(cmd *Command, partitions []string) error {
+	args := make([]string, len(partitions))
+	for i, name := range partitions {
+		args[i] = name + "=1"
+	}
+	cons, err := c.consumerOf(args)
+	if err != nil {
+		return err
+	}
+	subCommand := ""
+	if strings.HasSuffix(cmd.SubCommand, "open") {
+		subCommand = "open"
+	}
+	return c.consumeFrom(cons, subCommand)
+}
+
+// partitionOf reports whether a queue is a partition of a partitioned queue
+func partitionOf(name string, partitioned string) bool {
+	return strings.HasPrefix(name, partitioned+queue.PartitionSeparator)
+}
+
+// expandPartitions replaces partitioned queues with their partitions
+func expandPartitions(names []string) []string {
+	expanded := make([]string, 0, len(names))
+	for _, name := range names {
+		if partitions := repository.Partitions(name); partitions != nil {
+			expanded = append(expanded, partitions...)
+		} else {
+			expanded = append(expanded, name)
+		}
+	}
+	return expanded
+}
@@ -0,0 +1,65 @@
+package controller
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/bogdanovich/siberite/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Partitions(t *testing.T) {
+	repo, err := repository.Initialize(dir)
+	defer repo.CloseAllQueues()
+	assert.Nil(t, err)
+	defer repo.DeleteQueue("jobs#2#0")
+	defer repo.DeleteQueue("jobs#2#1")
+
+	mockTCPConn := NewMockTCPConn()
+	controller := NewSession(mockTCPConn, repo)
+	defer controller.FinishSession()
+
+	// Items of one key keep their order in one partition
+	for _, value := range []string{"1", "2", "3"} {
+		fmt.Fprintf(&mockTCPConn.ReadBuffer, "setmeta jobs#2 0 0 1 partition_key=a\r\n%s\r\n", value)
+		assert.Nil(t, controller.Dispatch())
+	}
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "setmeta jobs#2 0 0 1 partition_key=b\r\n4\r\n")
+	assert.Nil(t, controller.Dispatch())
+	assert.Equal(t, "STORED\r\nSTORED\r\nSTORED\r\nSTORED\r\n", mockTCPConn.WriteBuffer.String())
+	q0, _ := repo.GetQueue("jobs#2#0")
+	q1, _ := repo.GetQueue("jobs#2#1")
+	assert.Equal(t, uint64(3), q0.Length())
+	assert.Equal(t, uint64(1), q1.Length())
+
+	// Partitions are consumed round robin
+	mockTCPConn.WriteBuffer.Reset()
+	for i := 0; i < 3; i++ {
+		fmt.Fprintf(&mockTCPConn.ReadBuffer, "get jobs#2\r\n")
+		assert.Nil(t, controller.Dispatch())
+	}
+	assert.Equal(t, "VALUE jobs#2#0 0 1\r\n1\r\nEND\r\n"+
+		"VALUE jobs#2#1 0 1\r\n4\r\nEND\r\n"+
+		"VALUE jobs#2#0 0 1\r\n2\r\nEND\r\n", mockTCPConn.WriteBuffer.String())
+
+	// An open item is closed by the partitioned queue name
+	mockTCPConn.WriteBuffer.Reset()
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "get jobs#2/open\r\n")
+	assert.Nil(t, controller.Dispatch())
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "get jobs#2/abort\r\n")
+	assert.Nil(t, controller.Dispatch())
+	assert.Equal(t, "VALUE jobs#2#0 0 1\r\n3\r\nEND\r\nEND\r\n", mockTCPConn.WriteBuffer.String())
+	assert.Equal(t, uint64(1), q0.Length())
+
+	// Consumers attach to a partition by its name
+	mockTCPConn.WriteBuffer.Reset()
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "get jobs#2#1\r\nget jobs#2#0\r\n")
+	assert.Nil(t, controller.Dispatch())
+	assert.Nil(t, controller.Dispatch())
+	assert.Equal(t, "END\r\nVALUE jobs#2#0 0 1\r\n3\r\nEND\r\n", mockTCPConn.WriteBuffer.String())
+
+	mockTCPConn.WriteBuffer.Reset()
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "get jobs#2/peek\r\n")
+	assert.NotNil(t, controller.Dispatch())
+	assert.Equal(t, "ERROR Invalid command\r\n", mockTCPConn.WriteBuffer.String())
+}
@@ -0,0 +1,10 @@
+package controller
+
+// Ping handles PING command
+// Command: PING
+// Response: PONG
+func (c *Controller) Ping() error {
+	c.rw.Writer.WriteString("PONG\r\n")
+	c.rw.Writer.Flush()
+	return nil
+}
@@ -0,0 +1,108 @@
+package controller
+
+import (
+	"errors"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/bogdanovich/siberite/queue"
+	"github.com/bogdanovich/siberite/repository"
+)
+
+// maxPrefetch limits items a session reserves ahead
+const maxPrefetch = 1000
+
+// prefetchBuffer keeps items reserved ahead for GET <queue>/open
+type prefetchBuffer struct {
+	size  int
+	queue string
+	items []*queue.Item
+}
+
+// Prefetch handles PREFETCH command, the hint lasts for the session
+// Command: PREFETCH <n>
+// Response: END
+// GET <queue>/open then reserves up to n items in one queue read and
+// serves the following ones without reading the queue again. Reserved
+// items count as open transactions and return to the queue head when
+// the session ends, opens another queue or changes the hint.
+// PREFETCH 0 turns prefetching off.
+func (c *Controller) Prefetch(input []string) error {
+	if len(input) != 2 {
+		return errors.New("ERROR Invalid input")
+	}
+	size, err := strconv.Atoi(input[1])
+	if err != nil || size < 0 || size > maxPrefetch {
+		return errors.New("CLIENT_ERROR Invalid prefetch size")
+	}
+	c.releasePrefetched()
+	c.prefetch.size = size
+	c.rw.Writer.WriteString("END\r\n")
+	c.rw.Writer.Flush()
+	return nil
+}
+
+// dequeue takes the next item for GET, prefetched reports whether
+// it was reserved ahead and is already counted as open. An empty
+// queue gives an empty item, other errors are storage failures.
+func (c *Controller) dequeue(cmd *Command, q *queue.Queue) (item *queue.Item, prefetched bool, err error) {
+	if c.prefetch.size == 0 || !strings.Contains(cmd.SubCommand, "open") {
+		span := c.startSpan("siberite.dequeue", cmd)
+		item, err = q.Dequeue()
+		span.End()
+		if err == queue.ErrEmpty {
+			err = nil
+		}
+		return item, false, err
+	}
+	if c.prefetch.queue != cmd.QueueName {
+		c.releasePrefetched()
+		c.prefetch.queue = cmd.QueueName
+	}
+	if len(c.prefetch.items) == 0 {
+		span := c.startSpan("siberite.dequeue", cmd)
+		for len(c.prefetch.items) < c.prefetch.size {
+			reserved, err := q.Dequeue()
+			if err != nil && err != queue.ErrEmpty && len(c.prefetch.items) == 0 {
+				span.End()
+				return reserved, false, err
+			}
+			if reserved.Size == 0 {
+				break
+			}
+			q.OpenItem(reserved)
+			c.repo.TrackMemory(repository.MemoryOpenItems, itemMemory(reserved))
+			c.prefetch.items = append(c.prefetch.items, reserved)
+		}
+		span.End()
+	}
+	if len(c.prefetch.items) == 0 {
+		return &queue.Item{}, false, nil
+	}
+	item = c.prefetch.items[0]
+	c.prefetch.items = c.prefetch.items[1:]
+	c.repo.TrackMemory(repository.MemoryOpenItems, -itemMemory(item))
+	return item, true, nil
+}
+
+// releasePrefetched returns reserved items to the queue head in their order
+func (c *Controller) releasePrefetched() {
+	items := c.prefetch.items
+	c.prefetch.items = nil
+	if len(items) == 0 {
+		return
+	}
+	q, err := c.repo.GetQueue(c.prefetch.queue)
+	if err != nil {
+		log.Printf("Can't GetQueue %s: %s", c.prefetch.queue, err.Error())
+		return
+	}
+	for i := len(items) - 1; i >= 0; i-- {
+		if err = q.Prepend(items[i]); err != nil {
+			log.Printf("Can't return prefetched item of %s: %s", c.prefetch.queue, err.Error())
+		}
+		q.CloseItem(items[i])
+		c.repo.TrackMemory(repository.MemoryOpenItems, -itemMemory(items[i]))
+	}
+}
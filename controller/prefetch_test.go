@@ -0,0 +1,66 @@
+package controller
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/bogdanovich/siberite/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Prefetch(t *testing.T) {
+	repo, err := repository.Initialize(dir)
+	defer repo.CloseAllQueues()
+	assert.Nil(t, err)
+	repo.FlushQueue("test")
+
+	mockTCPConn := NewMockTCPConn()
+	controller := NewSession(mockTCPConn, repo)
+
+	for _, value := range []string{"1", "2", "3", "4"} {
+		fmt.Fprintf(&mockTCPConn.ReadBuffer, "set test 0 0 1\r\n%s\r\n", value)
+		assert.Nil(t, controller.Dispatch())
+	}
+
+	mockTCPConn.WriteBuffer.Reset()
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "prefetch 2\r\n")
+	assert.Nil(t, controller.Dispatch())
+	assert.Equal(t, "END\r\n", mockTCPConn.WriteBuffer.String())
+
+	mockTCPConn.WriteBuffer.Reset()
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "get test/open\r\n")
+	assert.Nil(t, controller.Dispatch())
+	assert.Equal(t, "VALUE test 0 1\r\n1\r\nEND\r\n", mockTCPConn.WriteBuffer.String())
+
+	q, _ := repo.GetQueue("test")
+	assert.Equal(t, uint64(2), q.Length())
+	assert.Equal(t, int64(2), q.Stats.OpenTransactions)
+
+	mockTCPConn.WriteBuffer.Reset()
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "get test/close/open\r\n")
+	assert.Nil(t, controller.Dispatch())
+	assert.Equal(t, "VALUE test 0 1\r\n2\r\nEND\r\n", mockTCPConn.WriteBuffer.String())
+	assert.Equal(t, uint64(2), q.Length())
+	assert.Equal(t, int64(1), q.Stats.OpenTransactions)
+
+	mockTCPConn.WriteBuffer.Reset()
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "get test/close/open\r\n")
+	assert.Nil(t, controller.Dispatch())
+	assert.Equal(t, "VALUE test 0 1\r\n3\r\nEND\r\n", mockTCPConn.WriteBuffer.String())
+	assert.Equal(t, uint64(0), q.Length())
+	assert.Equal(t, int64(2), q.Stats.OpenTransactions)
+
+	// Open and reserved items return to the queue head in order
+	controller.FinishSession()
+	assert.Equal(t, int64(0), q.Stats.OpenTransactions)
+	assert.Equal(t, int64(0), repo.MemoryUsage().OpenItems)
+	for _, value := range []string{"3", "4"} {
+		item, _ := q.Dequeue()
+		assert.Equal(t, value, string(item.Value))
+	}
+
+	err = controller.Prefetch([]string{"prefetch", "-1"})
+	assert.Equal(t, "CLIENT_ERROR Invalid prefetch size", err.Error())
+	err = controller.Prefetch([]string{"prefetch"})
+	assert.Equal(t, "ERROR Invalid input", err.Error())
+}
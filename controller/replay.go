@@ -0,0 +1,96 @@
+package controller
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/bogdanovich/siberite/queue"
+	"github.com/bogdanovich/siberite/repository"
+)
+
+// replayBuffer is a ring of the last items consumed by a session, see REPLAY_LAST
+type replayBuffer struct {
+	items []replayedItem
+	// next is a position of the oldest item once the ring is full
+	next int
+}
+
+// replayedItem is a consumed item with a name of its queue
+type replayedItem struct {
+	queue string
+	item  *queue.Item
+}
+
+// consumed keeps an item closed or taken by GET for REPLAY_LAST, the oldest
+// one is dropped once replay_buffer items are kept. Chunks of large values
+// are deleted on consume, so such items are not kept.
+func (c *Controller) consumed(queueName string, item *queue.Item) {
+	size := c.repo.Config().ReplayBuffer
+	if size == 0 || item.Blob != nil {
+		return
+	}
+	r := &c.replay
+	kept := replayedItem{queue: queueName, item: item}
+	if len(r.items) < size {
+		r.items = append(r.items, kept)
+	} else {
+		c.repo.TrackMemory(repository.MemoryReplay, -itemMemory(r.items[r.next].item))
+		r.items[r.next] = kept
+		r.next = (r.next + 1) % len(r.items)
+	}
+	c.repo.TrackMemory(repository.MemoryReplay, itemMemory(item))
+}
+
+// last returns up to n most recently consumed items, the oldest first
+func (r *replayBuffer) last(n int) []replayedItem {
+	if n > len(r.items) {
+		n = len(r.items)
+	}
+	items := make([]replayedItem, 0, n)
+	for i := len(r.items) - n; i < len(r.items); i++ {
+		items = append(items, r.items[(r.next+i)%len(r.items)])
+	}
+	return items
+}
+
+// releaseReplay drops items kept for REPLAY_LAST
+func (c *Controller) releaseReplay() {
+	for _, kept := range c.replay.items {
+		c.repo.TrackMemory(repository.MemoryReplay, -itemMemory(kept.item))
+	}
+	c.replay = replayBuffer{}
+}
+
+// ReplayLast handles REPLAY_LAST command, it sends again items
+// the session consumed, so a consumer that failed to process them
+// after close recovers them, the items are not enqueued again
+// Command: REPLAY_LAST <n>
+// Response:
+// VALUE <queue> <flags> <bytes>
+// <data block>
+// ...
+// END
+// Up to replay_buffer items are kept, the oldest is sent first.
+// Items are kept over a reconnect with RESUME.
+func (c *Controller) ReplayLast(input []string) error {
+	if len(input) != 2 {
+		return errors.New("ERROR Invalid input")
+	}
+	n, err := strconv.ParseUint(input[1], 10, 32)
+	if err != nil || n == 0 {
+		return errors.New("ERROR Invalid <n> number")
+	}
+	if c.repo.Config().ReplayBuffer == 0 {
+		return errors.New("CLIENT_ERROR Replay is disabled")
+	}
+	for _, kept := range c.replay.last(int(n)) {
+		cmd := &Command{Name: input[0], QueueName: kept.queue}
+		// Items without blobs are sent from memory
+		if err = c.sendItem(cmd, nil, kept.item); err != nil {
+			return errors.New("SERVER_ERROR " + err.Error())
+		}
+	}
+	c.rw.Writer.WriteString("END\r\n")
+	c.rw.Writer.Flush()
+	return nil
+}
@@ -0,0 +1,67 @@
+package controller
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/bogdanovich/siberite/config"
+	"github.com/bogdanovich/siberite/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ReplayLast(t *testing.T) {
+	repo, err := repository.Initialize(dir)
+	assert.Nil(t, err)
+	controller := NewSession(NewMockTCPConn(), repo)
+	assert.Equal(t, "CLIENT_ERROR Replay is disabled", controller.ReplayLast([]string{"replay_last", "1"}).Error())
+	controller.FinishSession()
+	repo.CloseAllQueues()
+
+	cfg := config.Default()
+	cfg.ResumeGrace = "1m"
+	cfg.ReplayBuffer = 2
+	assert.Nil(t, cfg.Validate())
+	repo, err = repository.InitializeWithConfig(dir, cfg)
+	defer repo.CloseAllQueues()
+	assert.Nil(t, err)
+	repo.FlushQueue("test")
+	q, _ := repo.GetQueue("test")
+	for _, value := range []string{"1", "2", "3", "4"} {
+		q.Enqueue([]byte(value))
+	}
+
+	mockTCPConn := NewMockTCPConn()
+	controller = NewSession(mockTCPConn, repo)
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "session\r\nget test\r\nget test/open\r\nget test/close\r\n")
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "get test/open/id\r\nclose test 1\r\nget test/open\r\n")
+	for i := 0; i < 7; i++ {
+		assert.Nil(t, controller.Dispatch())
+	}
+	token := strings.Fields(mockTCPConn.WriteBuffer.String())[1]
+
+	// Items closed last are sent oldest first, the open one is not consumed yet
+	mockTCPConn.WriteBuffer.Reset()
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "replay_last 5\r\nreplay_last 1\r\n")
+	assert.Nil(t, controller.Dispatch())
+	assert.Nil(t, controller.Dispatch())
+	assert.Equal(t, "VALUE test 0 1\r\n2\r\nVALUE test 0 1\r\n3\r\nEND\r\n"+
+		"VALUE test 0 1\r\n3\r\nEND\r\n", mockTCPConn.WriteBuffer.String())
+	assert.Equal(t, int64(2), repo.MemoryUsage().Replay)
+
+	// Consumed items survive a crash of the consumer
+	controller.FinishSession()
+	mockTCPConn = NewMockTCPConn()
+	controller = NewSession(mockTCPConn, repo)
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "resume %s\r\nget test/close\r\nreplay_last 2\r\n", token)
+	for i := 0; i < 3; i++ {
+		assert.Nil(t, controller.Dispatch())
+	}
+	assert.Equal(t, "RESUMED open=test prefetched=0 staged=0\r\nEND\r\n"+
+		"VALUE test 0 1\r\n3\r\nVALUE test 0 1\r\n4\r\nEND\r\n", mockTCPConn.WriteBuffer.String())
+	assert.Equal(t, uint64(0), q.Length())
+
+	assert.Equal(t, "ERROR Invalid <n> number", controller.ReplayLast([]string{"replay_last", "0"}).Error())
+	assert.Equal(t, "ERROR Invalid input", controller.ReplayLast([]string{"replay_last"}).Error())
+	controller.FinishSession()
+}
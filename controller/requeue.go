@@ -0,0 +1,99 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/bogdanovich/siberite/config"
+)
+
+// Requeue handles REQUEUE command
+// Command: REQUEUE <queue> <since>
+// Moves items archived since <since> back to the queue tail, <since> is
+// unix time or a duration ago, e.g. 90m. Items are archived by queues
+// with retention configured.
+// Response:
+// REQUEUED <items>
+// END
+func (c *Controller) Requeue(input []string) error {
+	if len(input) != 3 {
+		return errors.New("ERROR Invalid input")
+	}
+	since, err := parseTime(input[2], time.Now())
+	if err != nil {
+		return errors.New("ERROR Invalid <since>")
+	}
+
+	q, err := c.repo.GetQueue(input[1])
+	if err != nil {
+		log.Printf("Can't GetQueue %s: %s", input[1], err.Error())
+		return errors.New("SERVER_ERROR " + err.Error())
+	}
+	requeued, err := q.Requeue(since)
+	if err != nil {
+		return errors.New("SERVER_ERROR " + err.Error())
+	}
+	fmt.Fprintf(c.rw.Writer, "REQUEUED %d\r\nEND\r\n", requeued)
+	c.rw.Writer.Flush()
+	return nil
+}
+
+// parseTime parses unix time in seconds or a duration before now
+func parseTime(value string, now time.Time) (time.Time, error) {
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil && seconds >= 0 {
+		return time.Unix(seconds, 0), nil
+	}
+	d, err := config.ParseDuration(value)
+	if err != nil || d < 0 {
+		return time.Time{}, errors.New("invalid time")
+	}
+	return now.Add(-d), nil
+}
+
+// Replay handles REPLAY command
+// Command: REPLAY <queue> <from> <to> [<dest_queue>]
+// Enqueues copies of items archived within [<from>, <to>) to the queue tail
+// or to <dest_queue>, times are unix time or durations ago like <since>
+// of REQUEUE. Archived items are kept.
+// Response:
+// REPLAYED <items>
+// END
+func (c *Controller) Replay(input []string) error {
+	if len(input) < 4 || len(input) > 5 {
+		return errors.New("ERROR Invalid input")
+	}
+	now := time.Now()
+	from, err := parseTime(input[2], now)
+	if err != nil {
+		return errors.New("ERROR Invalid <from>")
+	}
+	to, err := parseTime(input[3], now)
+	if err != nil {
+		return errors.New("ERROR Invalid <to>")
+	}
+	destName := input[1]
+	if len(input) == 5 {
+		destName = input[4]
+	}
+
+	q, err := c.repo.GetQueue(input[1])
+	if err != nil {
+		log.Printf("Can't GetQueue %s: %s", input[1], err.Error())
+		return errors.New("SERVER_ERROR " + err.Error())
+	}
+	dest, err := c.repo.GetQueue(destName)
+	if err != nil {
+		log.Printf("Can't GetQueue %s: %s", destName, err.Error())
+		return errors.New("SERVER_ERROR " + err.Error())
+	}
+	replayed, err := q.Replay(from, to, dest)
+	if err != nil {
+		return errors.New("SERVER_ERROR " + err.Error())
+	}
+	fmt.Fprintf(c.rw.Writer, "REPLAYED %d\r\nEND\r\n", replayed)
+	c.rw.Writer.Flush()
+	return nil
+}
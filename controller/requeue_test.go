@@ -0,0 +1,100 @@
+package controller
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/bogdanovich/siberite/config"
+	"github.com/bogdanovich/siberite/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Requeue(t *testing.T) {
+	cfg := config.Default()
+	cfg.Queues["archived"] = &config.QueueConfig{Retention: "1h"}
+	assert.Nil(t, cfg.Validate())
+
+	repo, err := repository.InitializeWithConfig(dir, cfg)
+	defer repo.CloseAllQueues()
+	assert.Nil(t, err)
+	defer repo.DeleteQueue("archived")
+	mockTCPConn := NewMockTCPConn()
+	controller := NewSession(mockTCPConn, repo)
+
+	q, _ := repo.GetQueue("archived")
+	q.Enqueue([]byte("1"))
+	q.Enqueue([]byte("2"))
+
+	// Dequeued and closed items are archived, aborted are not
+	assert.Nil(t, controller.Get([]string{"get", "archived"}))
+	assert.Nil(t, controller.Get([]string{"get", "archived/open"}))
+	assert.Nil(t, controller.Get([]string{"get", "archived/abort"}))
+	assert.Nil(t, controller.Get([]string{"get", "archived/open"}))
+	assert.Nil(t, controller.Get([]string{"get", "archived/close"}))
+	assert.Equal(t, uint64(2), q.Archived())
+	assert.Equal(t, uint64(0), q.Length())
+	mockTCPConn.WriteBuffer.Reset()
+
+	err = controller.Requeue([]string{"requeue", "archived", "10m"})
+	assert.Nil(t, err)
+	assert.Equal(t, "REQUEUED 2\r\nEND\r\n", mockTCPConn.WriteBuffer.String())
+	assert.Equal(t, uint64(2), q.Length())
+	item, _ := q.Peek()
+	assert.Equal(t, "1", string(item.Value))
+
+	err = controller.Requeue([]string{"requeue", "archived", "soon"})
+	assert.Equal(t, "ERROR Invalid <since>", err.Error())
+}
+
+func Test_Replay(t *testing.T) {
+	cfg := config.Default()
+	cfg.Queues["archived"] = &config.QueueConfig{Retention: "1h"}
+	assert.Nil(t, cfg.Validate())
+
+	repo, err := repository.InitializeWithConfig(dir, cfg)
+	defer repo.CloseAllQueues()
+	assert.Nil(t, err)
+	defer repo.DeleteQueue("archived")
+	defer repo.DeleteQueue("archived_replay")
+	mockTCPConn := NewMockTCPConn()
+	controller := NewSession(mockTCPConn, repo)
+
+	q, _ := repo.GetQueue("archived")
+	q.Enqueue([]byte("1"))
+	assert.Nil(t, controller.Get([]string{"get", "archived"}))
+	mockTCPConn.WriteBuffer.Reset()
+
+	to := fmt.Sprintf("%d", time.Now().Unix()+1)
+	err = controller.Replay([]string{"replay", "archived", "10m", to, "archived_replay"})
+	assert.Nil(t, err)
+	assert.Equal(t, "REPLAYED 1\r\nEND\r\n", mockTCPConn.WriteBuffer.String())
+	dest, _ := repo.GetQueue("archived_replay")
+	item, _ := dest.Peek()
+	assert.Equal(t, "1", string(item.Value))
+	assert.Equal(t, uint64(1), q.Archived())
+
+	// Replayed items go to the queue itself by default
+	mockTCPConn.WriteBuffer.Reset()
+	assert.Nil(t, controller.Replay([]string{"replay", "archived", "10m", "0s"}))
+	assert.Equal(t, "REPLAYED 1\r\nEND\r\n", mockTCPConn.WriteBuffer.String())
+	assert.Equal(t, uint64(1), q.Length())
+
+	err = controller.Replay([]string{"replay", "archived", "10m", "later"})
+	assert.Equal(t, "ERROR Invalid <to>", err.Error())
+}
+
+func Test_parseTime(t *testing.T) {
+	now := time.Unix(1000, 0)
+	for value, expected := range map[string]time.Time{
+		"500": time.Unix(500, 0),
+		"90s": time.Unix(910, 0),
+		"1d":  now.Add(-24 * time.Hour),
+	} {
+		parsed, err := parseTime(value, now)
+		assert.Nil(t, err)
+		assert.Equal(t, expected, parsed, value)
+	}
+	_, err := parseTime("-5s", now)
+	assert.NotNil(t, err)
+}
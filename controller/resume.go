@@ -0,0 +1,99 @@
+package controller
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+// sessionTokenSize is a number of random bytes of a resume token
+const sessionTokenSize = 16
+
+// Session handles SESSION command, it returns a token of the session
+// Command: SESSION
+// Response: SESSION <token>
+// When resume_grace is configured and the connection of a session with
+// a token drops, its open item, prefetched items and staged transaction
+// are kept for the grace period instead of being aborted, a client
+// reconnecting in time takes them over with RESUME <token>.
+func (c *Controller) Session(input []string) error {
+	if len(input) != 1 {
+		return errors.New("ERROR Invalid input")
+	}
+	if c.token == "" {
+		token := make([]byte, sessionTokenSize)
+		if _, err := rand.Read(token); err != nil {
+			return errors.New("SERVER_ERROR " + err.Error())
+		}
+		c.token = hex.EncodeToString(token)
+	}
+	fmt.Fprintf(c.rw.Writer, "SESSION %s\r\n", c.token)
+	c.rw.Writer.Flush()
+	return nil
+}
+
+// Resume handles RESUME command
+// Command: RESUME <token>
+// Response: RESUMED open=<queue|-> prefetched=<items> staged=<items>
+// Items opened by id and items kept for REPLAY_LAST are taken over too.
+// The session takes over items kept for a disconnected session with
+// the token and the token itself, it must not hold items of its own.
+// Only a session authenticated as the same identity may resume it.
+func (c *Controller) Resume(input []string) error {
+	if len(input) != 2 {
+		return errors.New("ERROR Invalid input")
+	}
+	if c.holdsItems() {
+		return errors.New("CLIENT_ERROR Close current item first")
+	}
+	state, ok := c.repo.ResumeSession(input[1], c.identityName())
+	if !ok {
+		return errors.New("CLIENT_ERROR Unknown session")
+	}
+	old := state.(*Controller)
+	c.token = old.token
+	c.currentCommand, c.currentItem = old.currentCommand, old.currentItem
+	c.prefetch, c.txn = old.prefetch, old.txn
+	c.held, c.heldID = old.held, old.heldID
+	c.releaseReplay()
+	c.replay = old.replay
+	for _, held := range c.held {
+		held.cmd.Context = c.ctx
+	}
+
+	open, staged := "-", 0
+	if c.currentCommand != nil {
+		c.currentCommand.Context = c.ctx
+		open = c.currentCommand.QueueName
+		c.observeOpen(open)
+	}
+	if c.txn != nil {
+		staged = c.txn.count
+	}
+	fmt.Fprintf(c.rw.Writer, "RESUMED open=%s prefetched=%d staged=%d\r\n", open, len(c.prefetch.items), staged)
+	c.rw.Writer.Flush()
+	return nil
+}
+
+// holdsItems reports whether the session has items to abort when it ends
+func (c *Controller) holdsItems() bool {
+	return c.currentItem != nil || len(c.prefetch.items) > 0 || c.txn != nil || len(c.held) > 0
+}
+
+// park keeps items of a session with a token for resume_grace,
+// a session that consumed items is kept for REPLAY_LAST after a crash
+func (c *Controller) park() bool {
+	if c.token == "" || !c.holdsItems() && len(c.replay.items) == 0 {
+		return false
+	}
+	return c.repo.ParkSession(c.token, c.identityName(), c, c.release)
+}
+
+// identityName returns a name of the authenticated identity, empty without auth
+func (c *Controller) identityName() string {
+	if c.identity == nil {
+		return ""
+	}
+	return c.identity.Name
+}
@@ -0,0 +1,131 @@
+package controller
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bogdanovich/siberite/config"
+	"github.com/bogdanovich/siberite/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Resume(t *testing.T) {
+	cfg := config.Default()
+	cfg.ResumeGrace = "100ms"
+	assert.Nil(t, cfg.Validate())
+	repo, err := repository.InitializeWithConfig(dir, cfg)
+	defer repo.CloseAllQueues()
+	assert.Nil(t, err)
+	repo.FlushQueue("test")
+	q, _ := repo.GetQueue("test")
+
+	mockTCPConn := NewMockTCPConn()
+	controller := NewSession(mockTCPConn, repo)
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "set test 0 0 1\r\n1\r\n")
+	assert.Nil(t, controller.Dispatch())
+
+	mockTCPConn.WriteBuffer.Reset()
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "session\r\n")
+	assert.Nil(t, controller.Dispatch())
+	response := mockTCPConn.WriteBuffer.String()
+	assert.Regexp(t, regexp.MustCompile("^SESSION [0-9a-f]{32}\r\n$"), response)
+	token := strings.Fields(response)[1]
+
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "get test/open\r\n")
+	assert.Nil(t, controller.Dispatch())
+	controller.FinishSession()
+	// The open item is kept for the grace period
+	assert.Equal(t, uint64(0), q.Length())
+	assert.Equal(t, int64(1), q.Stats.OpenTransactions)
+
+	mockTCPConn = NewMockTCPConn()
+	controller = NewSession(mockTCPConn, repo)
+	defer controller.FinishSession()
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "resume %s\r\n", token)
+	assert.Nil(t, controller.Dispatch())
+	assert.Equal(t, "RESUMED open=test prefetched=0 staged=0\r\n", mockTCPConn.WriteBuffer.String())
+
+	mockTCPConn.WriteBuffer.Reset()
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "get test/close\r\n")
+	assert.Nil(t, controller.Dispatch())
+	assert.Equal(t, "END\r\n", mockTCPConn.WriteBuffer.String())
+	assert.Equal(t, int64(0), q.Stats.OpenTransactions)
+
+	err = controller.Resume([]string{"resume", token})
+	assert.Equal(t, "CLIENT_ERROR Unknown session", err.Error())
+	err = controller.Resume([]string{"resume"})
+	assert.Equal(t, "ERROR Invalid input", err.Error())
+}
+
+func Test_Resume_GraceExpired(t *testing.T) {
+	cfg := config.Default()
+	cfg.ResumeGrace = "10ms"
+	assert.Nil(t, cfg.Validate())
+	repo, err := repository.InitializeWithConfig(dir, cfg)
+	defer repo.CloseAllQueues()
+	assert.Nil(t, err)
+	repo.FlushQueue("test")
+	q, _ := repo.GetQueue("test")
+
+	mockTCPConn := NewMockTCPConn()
+	controller := NewSession(mockTCPConn, repo)
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "set test 0 0 1\r\n1\r\n")
+	assert.Nil(t, controller.Dispatch())
+	assert.Nil(t, controller.Session([]string{"session"}))
+	token := controller.token
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "get test/open\r\n")
+	assert.Nil(t, controller.Dispatch())
+	controller.FinishSession()
+
+	// The item is aborted once the grace period is over
+	for i := 0; i < 100 && atomic.LoadInt64(&q.Stats.OpenTransactions) != 0; i++ {
+		time.Sleep(5 * time.Millisecond)
+	}
+	assert.Equal(t, uint64(1), q.Length())
+	assert.Equal(t, int64(0), q.Stats.OpenTransactions)
+	_, ok := repo.ResumeSession(token, "")
+	assert.False(t, ok)
+}
+
+func Test_Resume_OtherIdentity(t *testing.T) {
+	cfg := config.Default()
+	cfg.ResumeGrace = "1s"
+	cfg.Auth = &config.AuthConfig{Providers: []*config.AuthProviderConfig{
+		{Type: config.AuthToken, Tokens: map[string]string{"s3cret": "ci", "other": "ops"}},
+	}}
+	assert.Nil(t, cfg.Validate())
+	repo := newTestRepoWithConfig(t, cfg)
+
+	mockTCPConn := NewMockTCPConn()
+	controller := NewSession(mockTCPConn, repo)
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "auth s3cret\r\nset test 0 0 1\r\n1\r\nsession\r\n")
+	for i := 0; i < 3; i++ {
+		assert.Nil(t, controller.Dispatch())
+	}
+	token := strings.Fields(strings.Split(mockTCPConn.WriteBuffer.String(), "\r\n")[2])[1]
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "get test/open\r\n")
+	assert.Nil(t, controller.Dispatch())
+	controller.FinishSession()
+
+	// Another identity can't take over the session, it stays parked
+	mockTCPConn = NewMockTCPConn()
+	controller = NewSession(mockTCPConn, repo)
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "auth other\r\n")
+	assert.Nil(t, controller.Dispatch())
+	err := controller.Resume([]string{"resume", token})
+	assert.Equal(t, "CLIENT_ERROR Unknown session", err.Error())
+	controller.FinishSession()
+
+	mockTCPConn = NewMockTCPConn()
+	controller = NewSession(mockTCPConn, repo)
+	defer controller.FinishSession()
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "auth s3cret\r\nresume %s\r\n", token)
+	assert.Nil(t, controller.Dispatch())
+	mockTCPConn.WriteBuffer.Reset()
+	assert.Nil(t, controller.Dispatch())
+	assert.Equal(t, "RESUMED open=test prefetched=0 staged=0\r\n", mockTCPConn.WriteBuffer.String())
+}
@@ -0,0 +1,48 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// maxSampleSize limits a number of items returned by SAMPLE
+const maxSampleSize = 1000
+
+// Sample handles SAMPLE command, it returns random items spread
+// across the queue without removing them
+// Command: SAMPLE <queue> <n>
+// Response:
+// VALUE <queue> <flags> <bytes> [<key>=<value>...]
+// <data block>
+// ...
+// END
+func (c *Controller) Sample(input []string) error {
+	if len(input) != 3 {
+		return errors.New("ERROR Invalid input")
+	}
+	n, err := strconv.Atoi(input[2])
+	if err != nil || n < 0 {
+		return errors.New("ERROR Invalid input")
+	}
+	if n > maxSampleSize {
+		n = maxSampleSize
+	}
+	q, err := c.repo.GetQueue(input[1])
+	if err != nil {
+		return errors.New("SERVER_ERROR " + err.Error())
+	}
+	items, err := q.Sample(n)
+	if err != nil {
+		return errors.New("SERVER_ERROR " + err.Error())
+	}
+	cmd := &Command{Name: "sample", QueueName: q.Name, Meta: true}
+	for _, item := range items {
+		if err = c.sendItem(cmd, q, item); err != nil {
+			return errors.New("SERVER_ERROR " + err.Error())
+		}
+	}
+	fmt.Fprint(c.rw.Writer, "END\r\n")
+	c.rw.Writer.Flush()
+	return nil
+}
@@ -0,0 +1,43 @@
+package controller
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/bogdanovich/siberite/queue"
+	"github.com/bogdanovich/siberite/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Sample(t *testing.T) {
+	repo, err := repository.Initialize(dir)
+	defer repo.CloseAllQueues()
+	assert.Nil(t, err)
+
+	mockTCPConn := NewMockTCPConn()
+	controller := NewSession(mockTCPConn, repo)
+	defer controller.FinishSession()
+
+	repo.FlushQueue("test")
+	q, _ := repo.GetQueue("test")
+	q.EnqueueItem(&queue.Item{Value: []byte("1"), Headers: []queue.Header{{Key: "tenant", Value: "a"}}})
+	q.Enqueue([]byte("2"))
+
+	fmt.Fprint(&mockTCPConn.ReadBuffer, "sample test 5\r\n")
+	assert.Nil(t, controller.Dispatch())
+	assert.Equal(t, "VALUE test 0 1 tenant=a\r\n1\r\nVALUE test 0 1\r\n2\r\nEND\r\n", mockTCPConn.WriteBuffer.String())
+	assert.Equal(t, uint64(2), q.Length())
+
+	mockTCPConn.WriteBuffer.Reset()
+	fmt.Fprint(&mockTCPConn.ReadBuffer, "sample test 1\r\n")
+	assert.Nil(t, controller.Dispatch())
+	assert.Regexp(t, "^VALUE test 0 1( tenant=a)?\r\n[12]\r\nEND\r\n$", mockTCPConn.WriteBuffer.String())
+
+	for _, command := range []string{"sample test\r\n", "sample test -1\r\n", "sample test all\r\n"} {
+		mockTCPConn.WriteBuffer.Reset()
+		fmt.Fprint(&mockTCPConn.ReadBuffer, command)
+		assert.NotNil(t, controller.Dispatch())
+		assert.Equal(t, "ERROR Invalid input\r\n", mockTCPConn.WriteBuffer.String())
+	}
+	repo.FlushQueue("test")
+}
@@ -0,0 +1,38 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/bogdanovich/siberite/repository"
+)
+
+// Scheduled handles SCHEDULED command, it shows delayed items
+// waiting to return to the queue, so stuck items can be spotted
+// Command: SCHEDULED <queue>
+// Response:
+// SCHEDULED <queue> items=<n> next_due=<unix ms|0> overdue_ms=<n>
+// END
+// overdue_ms is how long the earliest delayed item is past its due time,
+// queues are not created, unknown ones get CLIENT_ERROR Unknown queue
+func (c *Controller) Scheduled(input []string) error {
+	if len(input) != 2 {
+		return errors.New("ERROR Invalid input")
+	}
+	q, ok := c.repo.Lookup(input[1])
+	if !ok {
+		return errors.New("CLIENT_ERROR " + repository.ErrUnknownQueue.Error())
+	}
+	var nextDue, overdue int64
+	if due := q.NextDue(); !due.IsZero() {
+		nextDue = due.UnixNano() / int64(time.Millisecond)
+		if late := time.Since(due); late > 0 {
+			overdue = int64(late / time.Millisecond)
+		}
+	}
+	fmt.Fprintf(c.rw.Writer, "SCHEDULED %s items=%d next_due=%d overdue_ms=%d\r\nEND\r\n",
+		q.Name, q.Delayed(), nextDue, overdue)
+	c.rw.Writer.Flush()
+	return nil
+}
@@ -0,0 +1,44 @@
+package controller
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/bogdanovich/siberite/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Scheduled(t *testing.T) {
+	repo, err := repository.Initialize(dir)
+	defer repo.CloseAllQueues()
+	assert.Nil(t, err)
+	repo.FlushQueue("test")
+
+	mockTCPConn := NewMockTCPConn()
+	controller := NewSession(mockTCPConn, repo)
+
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "scheduled test\r\n")
+	assert.Nil(t, controller.Dispatch())
+	assert.Equal(t, "SCHEDULED test items=0 next_due=0 overdue_ms=0\r\nEND\r\n", mockTCPConn.WriteBuffer.String())
+
+	q, _ := repo.GetQueue("test")
+	q.Enqueue([]byte("1"))
+	item, _ := q.Dequeue()
+	due := time.Now().Add(time.Hour)
+	assert.Nil(t, q.Delay(item, due))
+
+	mockTCPConn.WriteBuffer.Reset()
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "scheduled test\r\n")
+	assert.Nil(t, controller.Dispatch())
+	assert.Equal(t, fmt.Sprintf("SCHEDULED test items=1 next_due=%d overdue_ms=0\r\nEND\r\n",
+		due.UnixNano()/int64(time.Millisecond)), mockTCPConn.WriteBuffer.String())
+	repo.FlushQueue("test")
+
+	err = controller.Scheduled([]string{"scheduled"})
+	assert.Equal(t, "ERROR Invalid input", err.Error())
+	err = controller.Scheduled([]string{"scheduled", "typo"})
+	assert.Equal(t, "CLIENT_ERROR Unknown queue", err.Error())
+	_, ok := repo.Lookup("typo")
+	assert.False(t, ok)
+}
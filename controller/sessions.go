@@ -0,0 +1,94 @@
+package controller
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// sessions keeps active sessions listed by STATS conns
+var sessions = struct {
+	sync.Mutex
+	m map[uint64]*Controller
+}{m: map[uint64]*Controller{}}
+
+// sessionInfo is visible to other sessions, it's updated by the session itself
+type sessionInfo struct {
+	addr       string
+	startedAt  time.Time
+	commands   uint64
+	lastActive int64
+	sync.Mutex
+	openQueue string
+	openedAt  time.Time
+}
+
+func (c *Controller) register() {
+	c.info.addr = "-"
+	if conn, ok := c.conn.(interface{ RemoteAddr() net.Addr }); ok {
+		c.info.addr = conn.RemoteAddr().String()
+	}
+	c.info.startedAt = time.Now()
+	c.info.lastActive = c.info.startedAt.UnixNano()
+	sessions.Lock()
+	sessions.m[c.id] = c
+	sessions.Unlock()
+}
+
+func (c *Controller) unregister() {
+	sessions.Lock()
+	delete(sessions.m, c.id)
+	sessions.Unlock()
+}
+
+// observeCommand counts an executed command and marks the session active
+func (c *Controller) observeCommand() {
+	atomic.AddUint64(&c.info.commands, 1)
+	atomic.StoreInt64(&c.info.lastActive, time.Now().UnixNano())
+}
+
+// observeOpen tracks a queue of an open item, empty name when it's closed
+func (c *Controller) observeOpen(name string) {
+	c.info.Lock()
+	c.info.openQueue = name
+	c.info.openedAt = time.Now()
+	c.info.Unlock()
+}
+
+// Conns handles STATS conns command, it lists active connections
+// Command: STATS conns
+// Response:
+// CONN <id> addr=<remote address> age=<seconds> idle=<seconds> commands=<n> open=<queue|-> open_age=<seconds>
+// ...
+// END
+func (c *Controller) Conns() error {
+	sessions.Lock()
+	list := make([]*Controller, 0, len(sessions.m))
+	for _, s := range sessions.m {
+		if s.repo == c.repo {
+			list = append(list, s)
+		}
+	}
+	sessions.Unlock()
+	sort.Slice(list, func(i, j int) bool { return list[i].id < list[j].id })
+
+	now := time.Now()
+	for _, s := range list {
+		lastActive := time.Unix(0, atomic.LoadInt64(&s.info.lastActive))
+		s.info.Lock()
+		open, openAge := "-", time.Duration(0)
+		if s.info.openQueue != "" {
+			open, openAge = s.info.openQueue, now.Sub(s.info.openedAt)
+		}
+		s.info.Unlock()
+		fmt.Fprintf(c.rw.Writer, "CONN %d addr=%s age=%d idle=%d commands=%d open=%s open_age=%d\r\n",
+			s.id, s.info.addr, int64(now.Sub(s.info.startedAt)/time.Second), int64(now.Sub(lastActive)/time.Second),
+			atomic.LoadUint64(&s.info.commands), open, int64(openAge/time.Second))
+	}
+	fmt.Fprint(c.rw.Writer, "END\r\n")
+	c.rw.Writer.Flush()
+	return nil
+}
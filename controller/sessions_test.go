@@ -0,0 +1,44 @@
+package controller
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/bogdanovich/siberite/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Conns(t *testing.T) {
+	repo, err := repository.Initialize(dir)
+	defer repo.CloseAllQueues()
+	assert.Nil(t, err)
+
+	mockTCPConn := NewMockTCPConn()
+	controller := NewSession(mockTCPConn, repo)
+	consumerConn := NewMockTCPConn()
+	consumer := NewSession(consumerConn, repo)
+
+	repo.FlushQueue("test")
+	q, _ := repo.GetQueue("test")
+	q.Enqueue([]byte("1"))
+	fmt.Fprint(&consumerConn.ReadBuffer, "get test/open\r\n")
+	assert.Nil(t, consumer.Dispatch())
+
+	fmt.Fprint(&mockTCPConn.ReadBuffer, "stats conns\r\n")
+	assert.Nil(t, controller.Dispatch())
+	assert.Equal(t, fmt.Sprintf(
+		"CONN %d addr=- age=0 idle=0 commands=0 open=- open_age=0\r\n"+
+			"CONN %d addr=- age=0 idle=0 commands=1 open=test open_age=0\r\n"+
+			"END\r\n", controller.id, consumer.id), mockTCPConn.WriteBuffer.String())
+
+	// Finished sessions are not listed
+	consumer.FinishSession()
+	controller.FinishSession()
+	mockTCPConn.WriteBuffer.Reset()
+	controller = NewSession(mockTCPConn, repo)
+	defer controller.FinishSession()
+	assert.Nil(t, controller.Conns())
+	assert.Equal(t, fmt.Sprintf("CONN %d addr=- age=0 idle=0 commands=0 open=- open_age=0\r\nEND\r\n", controller.id),
+		mockTCPConn.WriteBuffer.String())
+	assert.Equal(t, uint64(1), q.Length())
+}
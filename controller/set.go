@@ -2,33 +2,128 @@ package controller
 
 import (
 	"errors"
-	"fmt"
 	"io"
 	"log"
 	"strconv"
 	"sync/atomic"
+	"time"
+
+	"github.com/bogdanovich/siberite/protocol"
+	"github.com/bogdanovich/siberite/queue"
+	"github.com/bogdanovich/siberite/repository"
+	"github.com/bogdanovich/siberite/trace"
 )
 
+// DedupHeader carries item idempotency key
+const DedupHeader = "dedup"
+
 // Set handles SET command
-// Command: SET <queue> <not_impl> <not_impl> <bytes>
+// Command: SET <queue>[/ttl=<ms>][/dedup=<key>] <flags> <exptime> <bytes>
 // <data block>
+// Nonzero <exptime> expires the item in seconds, or at a Unix timestamp
+// when it is over 30 days, /ttl=<ms> takes precedence over <exptime>.
+// Expired items are dropped instead of being returned by GET.
 // Response: STORED
+// Response: STORED <queue length> (extended responses, see EXTSET)
+// Response: NOT_STORED (duplicate within queue dedup_window)
+// Response: QUEUED (inside a transaction, see TXN)
 func (c *Controller) Set(input []string) error {
 	if len(input) < 5 || len(input) > 6 {
 		return errors.New("ERROR Invalid input")
 	}
+	headers, err := c.frameHeaders()
+	if err != nil {
+		return err
+	}
+	return c.set(input, headers)
+}
 
-	totalBytes, err := strconv.Atoi(input[4])
+// SetMeta handles SETMETA command
+// Command: SETMETA <queue> <flags> <exptime> <bytes> <key>=<value> [<key>=<value> ...]
+// <data block>
+// Response: STORED
+// Response: NOT_STORED (duplicate of a dedup=<key> header within queue dedup_window)
+// A msg_id=<message id> header keeps a message id given by another server,
+// such items are deduplicated by it within queue dedup_window
+func (c *Controller) SetMeta(input []string) error {
+	if len(input) < 6 {
+		return errors.New("ERROR Invalid input")
+	}
+	headers, err := parseHeaders(input[5:])
+	if err != nil {
+		return err
+	}
+	for _, header := range headers {
+		if header.Key == repository.OriginHeader && !c.fromPeer() {
+			return errors.New("CLIENT_ERROR Header origin is reserved for replication peers")
+		}
+	}
+	return c.set(input, headers)
+}
+
+func (c *Controller) set(input []string, headers []queue.Header) error {
+	flags, err := strconv.ParseUint(input[2], 10, 32)
 	if err != nil {
+		return errors.New("ERROR Invalid <flags> number")
+	}
+
+	totalBytes, err := strconv.Atoi(input[4])
+	if err != nil || totalBytes < 0 {
 		return errors.New("ERROR Invalid <bytes> number")
 	}
+	if int64(totalBytes) > c.repo.Config().ItemSize() {
+		return errors.New("CLIENT_ERROR Value is too large")
+	}
 
-	cmd := &Command{Name: input[0], QueueName: input[1], DataSize: totalBytes}
+	exptime, err := strconv.ParseInt(input[3], 10, 64)
+	if err != nil {
+		return errors.New("ERROR Invalid <exptime> number")
+	}
 
-	dataBlock, err := c.readDataBlock(cmd.DataSize)
+	r, err := protocol.ParseSet(input[1])
 	if err != nil {
+		return errors.New("ERROR " + err.Error())
+	}
+	if r.Queue == "" {
+		return errors.New("CLIENT_ERROR " + queue.ErrInvalidName.Error())
+	}
+	queueName := c.repo.PartitionFor(r.Queue, headers)
+	dedupKey := r.DedupKey
+	if dedupKey == "" {
+		for _, header := range headers {
+			if header.Key == DedupHeader {
+				dedupKey = header.Value
+			}
+		}
+	}
+
+	cmd := &Command{Name: input[0], QueueName: queueName, DataSize: totalBytes}
+
+	if c.txn != nil && cmd.DataSize > queue.ChunkSize {
+		return errors.New("CLIENT_ERROR Value is too large for a transaction")
+	}
+	if c.txn != nil && dedupKey != "" {
+		return errors.New("CLIENT_ERROR Deduplication is not supported in transactions")
+	}
+
+	item := &queue.Item{Flags: uint32(flags), Headers: headers}
+	item.ExpiresAt = protocol.ExpiresAt(exptime, r.TTL, time.Now())
+	if err = repository.AdoptMessageID(item); err != nil {
 		return errors.New("CLIENT_ERROR " + err.Error())
 	}
+	// Copies sent again by peers and migrations are dropped by message id
+	if dedupKey == "" && c.txn == nil {
+		dedupKey = item.MessageID
+	}
+	if cmd.DataSize <= queue.ChunkSize {
+		item.Value, err = c.readDataBlock(cmd.DataSize)
+		if err != nil {
+			return errors.New("CLIENT_ERROR " + err.Error())
+		}
+	}
+	if c.repo.MemoryExceeded() {
+		return errors.New("SERVER_ERROR Out of memory")
+	}
 
 	q, err := c.repo.GetQueue(cmd.QueueName)
 	if err != nil {
@@ -36,16 +131,100 @@ func (c *Controller) Set(input []string) error {
 		return errors.New("SERVER_ERROR " + err.Error())
 	}
 
-	err = q.Enqueue([]byte(dataBlock))
-	if err != nil {
-		return errors.New("SERVER_ERROR " + err.Error())
+	// Large values are streamed into blob chunks instead of buffering
+	if cmd.DataSize > queue.ChunkSize {
+		if item.Blob, err = c.readBlob(q, cmd.DataSize); err != nil {
+			return err
+		}
+	}
+
+	if !c.repo.Writable(cmd.QueueName, item) {
+		q.DeleteBlob(item.Blob)
+		return errors.New("SERVER_ERROR Queue is read-only on a follower")
+	}
+	if c.repo.SnapshotLoading(cmd.QueueName) {
+		q.DeleteBlob(item.Blob)
+		return errors.New("SERVER_ERROR Queue snapshot is loading")
+	}
+
+	if c.txn != nil {
+		if err = c.txn.stage(cmd.QueueName, item); err != nil {
+			return err
+		}
+		c.repo.TrackMemory(repository.MemoryTransactions, int64(len(item.Value)))
+		c.rw.Writer.WriteString("QUEUED\r\n")
+		c.rw.Writer.Flush()
+		return nil
+	}
+
+	targets, keep := c.repo.RouteTargets(cmd.QueueName, item)
+	if keep {
+		stored, err := c.enqueue(cmd, q, item, dedupKey)
+		if err != nil {
+			return err
+		}
+		if !stored {
+			c.rw.Writer.WriteString("NOT_STORED\r\n")
+			c.rw.Writer.Flush()
+			return nil
+		}
+	}
+	err = c.repo.Route(cmd.QueueName, q, item, targets)
+	if !keep {
+		// The item was moved, its blob was copied to destination queues
+		q.DeleteBlob(item.Blob)
+		if err != nil {
+			return errors.New("SERVER_ERROR " + err.Error())
+		}
+	}
+	c.observeItem(item)
+	if c.extendedSet {
+		buf := getBuffer()
+		*buf = append(*buf, "STORED "...)
+		*buf = strconv.AppendUint(*buf, q.Length(), 10)
+		*buf = append(*buf, "\r\n"...)
+		c.rw.Writer.Write(*buf)
+		putBuffer(buf)
+	} else {
+		c.rw.Writer.WriteString("STORED\r\n")
 	}
-	fmt.Fprint(c.rw.Writer, "STORED\r\n")
 	c.rw.Writer.Flush()
 	atomic.AddUint64(&c.repo.Stats.CmdSet, 1)
+	if keep {
+		atomic.AddUint64(&c.repo.Stats.TotalItems, 1)
+	}
 	return nil
 }
 
+// enqueue stores an item of SET, stored is false for a duplicate
+// of an item enqueued within the dedup window of the queue
+func (c *Controller) enqueue(cmd *Command, q *queue.Queue, item *queue.Item, dedupKey string) (bool, error) {
+	var err error
+	span := c.startEnqueueSpan(cmd, item)
+	item.Span = span
+	stored := true
+	window := c.repo.QueueConfig(cmd.QueueName).Dedup()
+	if dedupKey != "" && window > 0 {
+		stored, err = q.EnqueueUnique(item, dedupKey, window)
+	} else {
+		err = q.EnqueueItem(item)
+	}
+	item.Span = nil
+	if err != nil {
+		q.DeleteBlob(item.Blob)
+		span.SetError(err)
+		span.End()
+		return false, errors.New("SERVER_ERROR " + err.Error())
+	}
+	span.End()
+	if !stored {
+		q.DeleteBlob(item.Blob)
+		return false, nil
+	}
+	c.repo.Enqueued(cmd.QueueName, item, c.id)
+	return true, nil
+}
+
 func (c *Controller) readDataBlock(totalBytes int) ([]byte, error) {
 	expectedBytes := totalBytes + 2
 	dataBlock := make([]byte, expectedBytes)
@@ -60,3 +239,64 @@ func (c *Controller) readDataBlock(totalBytes int) ([]byte, error) {
 
 	return dataBlock[:totalBytes], nil
 }
+
+// readBlob reads a data block chunk by chunk into queue blob storage
+func (c *Controller) readBlob(q *queue.Queue, totalBytes int) (*queue.Blob, error) {
+	w := q.NewSizedBlobWriter(int64(totalBytes))
+	chunk := make([]byte, queue.ChunkSize)
+	for remaining := totalBytes; remaining > 0; remaining -= len(chunk) {
+		if remaining < len(chunk) {
+			chunk = chunk[:remaining]
+		}
+		c.setCommandDeadlines()
+		if _, err := io.ReadFull(c.rw.Reader, chunk); err != nil {
+			w.Abort()
+			return nil, errors.New("CLIENT_ERROR " + err.Error())
+		}
+		if _, err := w.Write(chunk); err != nil {
+			w.Abort()
+			return nil, errors.New("SERVER_ERROR " + err.Error())
+		}
+	}
+
+	end := make([]byte, 2)
+	if _, err := io.ReadFull(c.rw.Reader, end); err != nil || string(end) != "\r\n" {
+		w.Abort()
+		return nil, errors.New("CLIENT_ERROR bad data chunk")
+	}
+	if err := w.Close(); err != nil {
+		w.Abort()
+		return nil, errors.New("SERVER_ERROR " + err.Error())
+	}
+	return w.Blob(), nil
+}
+
+// startEnqueueSpan continues producer trace when an item carries
+// trace context and passes siberite span context on to consumers
+func (c *Controller) startEnqueueSpan(cmd *Command, item *queue.Item) trace.Span {
+	remote, _ := item.Header(trace.TraceParentHeader)
+	span := trace.Start("siberite.enqueue", c.span, remote)
+	span.SetAttribute("queue", cmd.QueueName)
+	traceParent := span.TraceParent()
+	if remote == "" || traceParent == "" {
+		return span
+	}
+	for i := range item.Headers {
+		if item.Headers[i].Key == trace.TraceParentHeader {
+			item.Headers[i].Value = traceParent
+		}
+	}
+	return span
+}
+
+func parseHeaders(input []string) ([]queue.Header, error) {
+	parsed, err := protocol.ParseHeaders(input)
+	if err != nil {
+		return nil, errors.New("ERROR " + err.Error())
+	}
+	headers := make([]queue.Header, len(parsed))
+	for i, header := range parsed {
+		headers[i] = queue.Header(header)
+	}
+	return headers, nil
+}
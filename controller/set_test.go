@@ -1,10 +1,15 @@
 package controller
 
 import (
+	"bytes"
 	"fmt"
 	"testing"
+	"time"
 
+	"github.com/bogdanovich/siberite/config"
+	"github.com/bogdanovich/siberite/queue"
 	"github.com/bogdanovich/siberite/repository"
+	"github.com/bogdanovich/siberite/trace"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -33,11 +38,23 @@ func Test_Set(t *testing.T) {
 
 	mockTCPConn.WriteBuffer.Reset()
 
+	command = []string{"set", "test", "invalid", "0", "10"}
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "0123567890\r\n")
+
+	err = controller.Set(command)
+	assert.Equal(t, "ERROR Invalid <flags> number", err.Error())
+
+	mockTCPConn.WriteBuffer.Reset()
+
 	command = []string{"set", "test", "0", "0", "invalid"}
 	fmt.Fprintf(&mockTCPConn.ReadBuffer, "0123567890\r\n")
 
 	err = controller.Set(command)
 	assert.Equal(t, "ERROR Invalid <bytes> number", err.Error())
+	err = controller.Set([]string{"set", "test", "0", "0", "-1"})
+	assert.Equal(t, "ERROR Invalid <bytes> number", err.Error())
+	err = controller.Set([]string{"set", "/ttl=5", "0", "0", "1"})
+	assert.Equal(t, "CLIENT_ERROR "+queue.ErrInvalidName.Error(), err.Error())
 
 	mockTCPConn.WriteBuffer.Reset()
 
@@ -46,4 +63,271 @@ func Test_Set(t *testing.T) {
 
 	err = controller.Set(command)
 	assert.Equal(t, "CLIENT_ERROR bad data chunk", err.Error())
+
+	err = controller.Set([]string{"set", "test", "0", "0", "2147483648"})
+	assert.Equal(t, "CLIENT_ERROR Value is too large", err.Error())
+	repo.Config().MaxItemSize = 5
+	err = controller.Set([]string{"set", "test", "0", "0", "6"})
+	assert.Equal(t, "CLIENT_ERROR Value is too large", err.Error())
+	repo.Config().MaxItemSize = 0
+}
+
+func Test_SetMeta(t *testing.T) {
+	repo, err := repository.Initialize(dir)
+	defer repo.CloseAllQueues()
+	assert.Nil(t, err)
+
+	mockTCPConn := NewMockTCPConn()
+	controller := NewSession(mockTCPConn, repo)
+
+	repo.FlushQueue("test")
+
+	command := []string{"setmeta", "test", "0", "0", "10", "trace=abc", "empty=", "eq=a=b"}
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "0123567890\r\n")
+
+	err = controller.SetMeta(command)
+	assert.Nil(t, err)
+	assert.Equal(t, "STORED\r\n", mockTCPConn.WriteBuffer.String())
+
+	q, _ := repo.GetQueue("test")
+	item, err := q.Dequeue()
+	assert.Nil(t, err)
+	assert.Equal(t, "0123567890", string(item.Value))
+	assert.Equal(t, []queue.Header{{Key: "trace", Value: "abc"}, {Key: "empty", Value: ""}, {Key: "eq", Value: "a=b"}}, item.Headers)
+
+	command = []string{"setmeta", "test", "0", "0", "10"}
+	err = controller.SetMeta(command)
+	assert.Equal(t, "ERROR Invalid input", err.Error())
+
+	command = []string{"setmeta", "test", "0", "0", "10", "trace"}
+	err = controller.SetMeta(command)
+	assert.Equal(t, "ERROR Invalid header trace", err.Error())
+
+	command = []string{"setmeta", "test", "0", "0", "10", "=abc"}
+	err = controller.SetMeta(command)
+	assert.Equal(t, "ERROR Invalid header =abc", err.Error())
+}
+
+type mockTracer struct {
+	started []string
+	parents []trace.Span
+	spans   []trace.Span
+}
+
+type mockSpan struct {
+	traceParent string
+}
+
+func (t *mockTracer) Start(name string, parent trace.Span, remote string) trace.Span {
+	span := &mockSpan{"00-4bf92f3577b34da6a3ce929d0e0e4736-00000000000000aa-01"}
+	t.started = append(t.started, name)
+	t.parents = append(t.parents, parent)
+	t.spans = append(t.spans, span)
+	return span
+}
+
+func (s *mockSpan) SetAttribute(key string, value string) {}
+func (s *mockSpan) SetError(err error)                    {}
+func (s *mockSpan) TraceParent() string                   { return s.traceParent }
+func (s *mockSpan) End()                                  {}
+
+func Test_SetMeta_TraceParent(t *testing.T) {
+	repo, err := repository.Initialize(dir)
+	defer repo.CloseAllQueues()
+	assert.Nil(t, err)
+
+	tracer := &mockTracer{}
+	trace.SetTracer(tracer)
+	defer trace.SetTracer(nil)
+
+	mockTCPConn := NewMockTCPConn()
+	controller := NewSession(mockTCPConn, repo)
+
+	repo.FlushQueue("test")
+
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "setmeta test 0 0 1 traceparent=00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01\r\n1\r\n")
+	err = controller.Dispatch()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"siberite.command", "siberite.enqueue", "siberite.leveldb.write"}, tracer.started)
+	// Storage spans are children of the queue operation
+	assert.True(t, tracer.parents[2] == tracer.spans[1])
+
+	// Consumers continue the trace from siberite span
+	q, _ := repo.GetQueue("test")
+	item, _ := q.Peek()
+	traceParent, _ := item.Header(trace.TraceParentHeader)
+	assert.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-00000000000000aa-01", traceParent)
+}
+
+func Test_SetDedup(t *testing.T) {
+	cfg := config.Default()
+	cfg.Queues["test"] = &config.QueueConfig{DedupWindow: "1h"}
+	assert.Nil(t, cfg.Validate())
+
+	repo, err := repository.InitializeWithConfig(dir, cfg)
+	defer repo.CloseAllQueues()
+	assert.Nil(t, err)
+
+	mockTCPConn := NewMockTCPConn()
+	controller := NewSession(mockTCPConn, repo)
+
+	repo.FlushQueue("test")
+	defer repo.DeleteQueue("test2")
+
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "set test/dedup=a 0 0 1\r\n1\r\n")
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "set test/dedup=a 0 0 1\r\n2\r\n")
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "setmeta test 0 0 1 dedup=a\r\n3\r\n")
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "setmeta test 0 0 1 dedup=b\r\n4\r\n")
+	for i := 0; i < 4; i++ {
+		assert.Nil(t, controller.Dispatch())
+	}
+	assert.Equal(t, "STORED\r\nNOT_STORED\r\nNOT_STORED\r\nSTORED\r\n", mockTCPConn.WriteBuffer.String())
+
+	q, _ := repo.GetQueue("test")
+	assert.Equal(t, uint64(2), q.Length())
+
+	// Dedup keys are ignored when dedup_window is not configured
+	mockTCPConn.WriteBuffer.Reset()
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "set test2/dedup=a 0 0 1\r\n1\r\n")
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "set test2/dedup=a 0 0 1\r\n2\r\n")
+	for i := 0; i < 2; i++ {
+		assert.Nil(t, controller.Dispatch())
+	}
+	assert.Equal(t, "STORED\r\nSTORED\r\n", mockTCPConn.WriteBuffer.String())
+
+	err = controller.Set([]string{"set", "test/dedup=", "0", "0", "1"})
+	assert.Equal(t, "ERROR Invalid dedup key", err.Error())
+}
+
+func Test_SetMessageID(t *testing.T) {
+	cfg := config.Default()
+	cfg.Queues["test"] = &config.QueueConfig{DedupWindow: "1h"}
+	assert.Nil(t, cfg.Validate())
+
+	repo, err := repository.InitializeWithConfig(dir, cfg)
+	defer repo.CloseAllQueues()
+	assert.Nil(t, err)
+
+	mockTCPConn := NewMockTCPConn()
+	controller := NewSession(mockTCPConn, repo)
+
+	repo.FlushQueue("test")
+
+	// Items sent again with the same message id are dropped
+	for _, value := range []string{"1", "2"} {
+		fmt.Fprintf(&mockTCPConn.ReadBuffer, "setmeta test 0 0 1 k=v msg_id=0005225d3a3b70000000002a\r\n%s\r\n", value)
+		assert.Nil(t, controller.Dispatch())
+	}
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "set test 0 0 1\r\n3\r\n")
+	assert.Nil(t, controller.Dispatch())
+	assert.Equal(t, "STORED\r\nNOT_STORED\r\nSTORED\r\n", mockTCPConn.WriteBuffer.String())
+
+	mockTCPConn.WriteBuffer.Reset()
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "get test/meta/msgid\r\nget test/msgid\r\n")
+	assert.Nil(t, controller.Dispatch())
+	assert.Nil(t, controller.Dispatch())
+	assert.Regexp(t, "^VALUE test 0 1 k=v msg_id=0005225d3a3b70000000002a\r\n1\r\nEND\r\n"+
+		"VALUE test 0 1 msg_id=[0-9a-f]{24}\r\n3\r\nEND\r\n$", mockTCPConn.WriteBuffer.String())
+
+	mockTCPConn.WriteBuffer.Reset()
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "setmeta test 0 0 1 msg_id=x\r\n1\r\n")
+	assert.NotNil(t, controller.Dispatch())
+	assert.Equal(t, "CLIENT_ERROR Invalid msg_id header\r\n", mockTCPConn.WriteBuffer.String())
+}
+
+func Test_SetExpiration(t *testing.T) {
+	repo, err := repository.Initialize(dir)
+	defer repo.CloseAllQueues()
+	assert.Nil(t, err)
+
+	mockTCPConn := NewMockTCPConn()
+	controller := NewSession(mockTCPConn, repo)
+
+	repo.FlushQueue("test")
+
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "set test 0 -1 1\r\n1\r\n")
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "set test 0 1000000000 1\r\n2\r\n")
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "set test/ttl=1 0 0 1\r\n3\r\n")
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "set test 0 60 1\r\n4\r\n")
+	for i := 0; i < 4; i++ {
+		assert.Nil(t, controller.Dispatch())
+	}
+	assert.Equal(t, "STORED\r\nSTORED\r\nSTORED\r\nSTORED\r\n", mockTCPConn.WriteBuffer.String())
+
+	time.Sleep(2 * time.Millisecond)
+	mockTCPConn.WriteBuffer.Reset()
+	assert.Nil(t, controller.Get([]string{"get", "test"}))
+	assert.Equal(t, "VALUE test 0 1\r\n4\r\nEND\r\n", mockTCPConn.WriteBuffer.String())
+
+	err = controller.Set([]string{"set", "test", "0", "soon", "1"})
+	assert.Equal(t, "ERROR Invalid <exptime> number", err.Error())
+	err = controller.Set([]string{"set", "test/ttl=0", "0", "0", "1"})
+	assert.Equal(t, "ERROR Invalid ttl", err.Error())
+}
+
+func Test_SetGet_Blob(t *testing.T) {
+	repo, err := repository.Initialize(dir)
+	defer repo.CloseAllQueues()
+	assert.Nil(t, err)
+
+	mockTCPConn := NewMockTCPConn()
+	controller := NewSession(mockTCPConn, repo)
+
+	repo.FlushQueue("test")
+
+	value := bytes.Repeat([]byte("0123456789"), queue.ChunkSize/4)
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "set test 0 0 %d\r\n%s\r\n", len(value), value)
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "get test/open\r\n")
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "get test/abort\r\n")
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "get test\r\n")
+	for i := 0; i < 4; i++ {
+		assert.Nil(t, controller.Dispatch())
+	}
+	response := fmt.Sprintf("VALUE test 0 %d\r\n%s\r\nEND\r\n", len(value), value)
+	assert.Equal(t, "STORED\r\n"+response+"END\r\n"+response, mockTCPConn.WriteBuffer.String())
+
+	q, _ := repo.GetQueue("test")
+	assert.Equal(t, uint64(0), q.Length())
+
+	// Truncated data block doesn't leave stored chunks behind
+	mockTCPConn.WriteBuffer.Reset()
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "set test 0 0 %d\r\n%s", len(value), value[:queue.ChunkSize+1])
+	err = controller.Dispatch()
+	assert.Equal(t, "CLIENT_ERROR unexpected EOF", err.Error())
+	assert.Equal(t, uint64(0), q.Length())
+}
+
+func Test_SetRoutes(t *testing.T) {
+	cfg := config.Default()
+	cfg.Queues["test"] = &config.QueueConfig{Routes: []*config.RouteRule{
+		{Header: "type=order", To: []string{"test_orders"}, Move: true},
+		{Header: "type=invalid", To: []string{".invalid"}, Move: true},
+	}}
+	assert.Nil(t, cfg.Validate())
+	repo, err := repository.InitializeWithConfig(dir, cfg)
+	defer repo.CloseAllQueues()
+	assert.Nil(t, err)
+	repo.FlushQueue("test")
+	defer repo.DeleteQueue("test_orders")
+
+	mockTCPConn := NewMockTCPConn()
+	controller := NewSession(mockTCPConn, repo)
+	defer controller.FinishSession()
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "setmeta test 0 0 1 type=order\r\n1\r\nset test 0 0 1\r\n2\r\n")
+	assert.Nil(t, controller.Dispatch())
+	assert.Nil(t, controller.Dispatch())
+	assert.Equal(t, "STORED\r\nSTORED\r\n", mockTCPConn.WriteBuffer.String())
+
+	q, _ := repo.GetQueue("test")
+	orders, _ := repo.GetQueue("test_orders")
+	assert.Equal(t, uint64(1), q.Length())
+	item, _ := orders.Dequeue()
+	assert.Equal(t, "1", string(item.Value))
+
+	// An item moved nowhere is not acknowledged
+	mockTCPConn.WriteBuffer.Reset()
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "setmeta test 0 0 1 type=invalid\r\n3\r\n")
+	assert.NotNil(t, controller.Dispatch())
+	assert.Equal(t, "SERVER_ERROR Can't route item: "+queue.ErrInvalidName.Error()+"\r\n", mockTCPConn.WriteBuffer.String())
+	assert.Equal(t, uint64(1), q.Length())
 }
@@ -0,0 +1,27 @@
+package controller
+
+import (
+	"fmt"
+	"time"
+)
+
+// Slowlog handles STATS slowlog command, it lists recent commands
+// that exceeded slow log threshold, the most recent first
+// Command: STATS slowlog
+// Response:
+// SLOW <id> time=<unix time> command=<name> queue=<queue|-> duration_us=<n> bytes=<n>
+// ...
+// END
+func (c *Controller) Slowlog() error {
+	for _, e := range c.repo.Slowlog() {
+		name := e.Queue
+		if name == "" {
+			name = "-"
+		}
+		fmt.Fprintf(c.rw.Writer, "SLOW %d time=%d command=%s queue=%s duration_us=%d bytes=%d\r\n",
+			e.ID, e.Time.Unix(), e.Command, name, int64(e.Duration/time.Microsecond), e.Size)
+	}
+	fmt.Fprint(c.rw.Writer, "END\r\n")
+	c.rw.Writer.Flush()
+	return nil
+}
@@ -0,0 +1,43 @@
+package controller
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/bogdanovich/siberite/config"
+	"github.com/bogdanovich/siberite/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Slowlog(t *testing.T) {
+	cfg := config.Default()
+	cfg.SlowlogThreshold = "1ns"
+	assert.Nil(t, cfg.Validate())
+	repo, err := repository.InitializeWithConfig(dir, cfg)
+	defer repo.CloseAllQueues()
+	assert.Nil(t, err)
+
+	mockTCPConn := NewMockTCPConn()
+	controller := NewSession(mockTCPConn, repo)
+	defer controller.FinishSession()
+
+	fmt.Fprint(&mockTCPConn.ReadBuffer, "set test 0 0 5\r\n12345\r\n")
+	assert.Nil(t, controller.Dispatch())
+	fmt.Fprint(&mockTCPConn.ReadBuffer, "version\r\n")
+	assert.Nil(t, controller.Dispatch())
+
+	entries := repo.Slowlog()
+	assert.Equal(t, 2, len(entries))
+	mockTCPConn.WriteBuffer.Reset()
+	fmt.Fprint(&mockTCPConn.ReadBuffer, "stats slowlog\r\n")
+	assert.Nil(t, controller.Dispatch())
+	assert.Equal(t, fmt.Sprintf(
+		"SLOW 2 time=%d command=version queue=- duration_us=%d bytes=0\r\n"+
+			"SLOW 1 time=%d command=set queue=test duration_us=%d bytes=5\r\n"+
+			"END\r\n",
+		entries[0].Time.Unix(), entries[0].Duration.Nanoseconds()/1000,
+		entries[1].Time.Unix(), entries[1].Duration.Nanoseconds()/1000),
+		mockTCPConn.WriteBuffer.String())
+
+	repo.FlushQueue("test")
+}
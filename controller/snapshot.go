@@ -0,0 +1,67 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/bogdanovich/siberite/queue"
+	"github.com/bogdanovich/siberite/repository"
+)
+
+// Snapshot handles SNAPSHOT command, a warm standby loads queues with it
+// Command: SNAPSHOT <queue pattern> [<peer>]
+// Streams items of every matching queue as of a point in time, items
+// spooled for <peer> before the snapshot are not forwarded to it.
+// With an auth policy every matching queue must be allowed to the identity.
+// Response:
+// QUEUE <queue> <items>
+// VALUE <queue> <flags> <bytes> [<key>=<value>...] ts=<enqueue unix milliseconds> [msg_id=<message id>]
+// <data block>
+// ...
+// END
+func (c *Controller) Snapshot(input []string) error {
+	if len(input) < 2 || len(input) > 3 {
+		return errors.New("ERROR Invalid input")
+	}
+	peer := ""
+	if len(input) == 3 {
+		peer = input[2]
+	}
+	names, err := c.repo.MatchQueues(input[1])
+	if err != nil {
+		return errors.New("CLIENT_ERROR Invalid queue pattern")
+	}
+	for _, name := range names {
+		if repository.SpoolQueue(name) {
+			continue
+		}
+		if err = c.sendSnapshot(name, peer); err != nil {
+			return err
+		}
+	}
+	fmt.Fprint(c.rw.Writer, "END\r\n")
+	c.rw.Writer.Flush()
+	return nil
+}
+
+func (c *Controller) sendSnapshot(name string, peer string) error {
+	_, snap, err := c.repo.Snapshot(name, peer)
+	if err == repository.ErrUnknownPeer {
+		return errors.New("CLIENT_ERROR " + err.Error())
+	}
+	if err != nil {
+		return errors.New("SERVER_ERROR " + err.Error())
+	}
+	defer snap.Release()
+
+	fmt.Fprintf(c.rw.Writer, "QUEUE %s %d\r\n", name, snap.Length())
+	cmd := &Command{Name: "snapshot", QueueName: name, Meta: true, Timestamp: true, MessageID: true}
+	err = snap.Items(func(item *queue.Item) error {
+		c.setCommandDeadlines()
+		return c.sendItem(cmd, snap, item)
+	})
+	if err != nil {
+		return errors.New("SERVER_ERROR " + err.Error())
+	}
+	return nil
+}
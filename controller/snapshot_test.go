@@ -0,0 +1,46 @@
+package controller
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/bogdanovich/siberite/queue"
+	"github.com/bogdanovich/siberite/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Snapshot(t *testing.T) {
+	repo, err := repository.Initialize(dir)
+	defer repo.CloseAllQueues()
+	assert.Nil(t, err)
+	mockTCPConn := NewMockTCPConn()
+	controller := NewSession(mockTCPConn, repo)
+
+	q, err := repo.GetQueue("snapshot_a")
+	assert.Nil(t, err)
+	defer repo.DeleteQueue("snapshot_a")
+	q.EnqueueItem(&queue.Item{Value: []byte("1"), Flags: 2, Headers: []queue.Header{{Key: "k", Value: "v"}},
+		MessageID: "0005225d3a3b70000000002a", EnqueuedAt: time.Unix(1800000000, 0)})
+	q.Enqueue([]byte("23"))
+	item, _ := q.PeekAt(1)
+	ts := fmt.Sprintf("%d", item.EnqueuedAt.UnixNano()/int64(time.Millisecond))
+	repo.GetQueue("snapshot_b")
+	defer repo.DeleteQueue("snapshot_b")
+
+	err = controller.Snapshot([]string{"snapshot", "snapshot_*"})
+	assert.Nil(t, err)
+	assert.Equal(t, "QUEUE snapshot_a 2\r\n"+
+		"VALUE snapshot_a 2 1 k=v ts=1800000000000 msg_id=0005225d3a3b70000000002a\r\n1\r\n"+
+		"VALUE snapshot_a 0 2 ts="+ts+" msg_id="+item.MessageID+"\r\n23\r\n"+
+		"QUEUE snapshot_b 0\r\n"+
+		"END\r\n", mockTCPConn.WriteBuffer.String())
+	assert.Equal(t, uint64(2), q.Length())
+
+	// Peers are known only with replication configured
+	err = controller.Snapshot([]string{"snapshot", "snapshot_a", "10.0.0.2:22133"})
+	assert.Equal(t, "CLIENT_ERROR Unknown replication peer", err.Error())
+
+	err = controller.Snapshot([]string{"snapshot"})
+	assert.Equal(t, "ERROR Invalid input", err.Error())
+}
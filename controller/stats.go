@@ -1,6 +1,11 @@
 package controller
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+
+	"github.com/bogdanovich/siberite/repository"
+)
 
 // Stats handles STATS command
 func (c *Controller) Stats() error {
@@ -12,3 +17,87 @@ func (c *Controller) Stats() error {
 	c.rw.Writer.Flush()
 	return nil
 }
+
+// QueueStats handles STATS command limited to queues matching a pattern
+// Command: STATS <queue pattern>
+func (c *Controller) QueueStats(input []string) error {
+	if len(input) != 2 {
+		return errors.New("ERROR Invalid input")
+	}
+	stats, err := c.repo.MatchingStats(input[1])
+	if err != nil {
+		return errors.New("CLIENT_ERROR Invalid queue pattern")
+	}
+	for _, item := range stats {
+		fmt.Fprintf(c.rw.Writer, "STAT %s %s\r\n", item.Key, item.Value)
+	}
+	fmt.Fprintf(c.rw.Writer, "END\r\n")
+	c.rw.Writer.Flush()
+	return nil
+}
+
+// QueueInfo handles STATS queue command, it shows stats of a single queue
+// with head and tail offsets and disk usage of its database
+// Command: STATS queue <queue>
+func (c *Controller) QueueInfo(input []string) error {
+	if len(input) != 3 {
+		return errors.New("ERROR Invalid input")
+	}
+	stats, err := c.repo.QueueInfo(input[2])
+	if err == repository.ErrUnknownQueue {
+		return errors.New("CLIENT_ERROR " + err.Error())
+	}
+	if err != nil {
+		return errors.New("SERVER_ERROR " + err.Error())
+	}
+	for _, item := range stats {
+		fmt.Fprintf(c.rw.Writer, "STAT %s %s\r\n", item.Key, item.Value)
+	}
+	fmt.Fprintf(c.rw.Writer, "END\r\n")
+	c.rw.Writer.Flush()
+	return nil
+}
+
+// StorageStats handles STATS leveldb command, it shows leveldb internals
+// of queues matching a pattern, all queues by default
+// Command: STATS leveldb [<queue pattern>]
+func (c *Controller) StorageStats(input []string) error {
+	pattern := "*"
+	if len(input) == 3 {
+		pattern = input[2]
+	}
+	stats, err := c.repo.StorageStats(pattern)
+	if err != nil {
+		return errors.New("CLIENT_ERROR Invalid queue pattern")
+	}
+	for _, item := range stats {
+		fmt.Fprintf(c.rw.Writer, "STAT %s %s\r\n", item.Key, item.Value)
+	}
+	fmt.Fprintf(c.rw.Writer, "END\r\n")
+	c.rw.Writer.Flush()
+	return nil
+}
+
+// MemoryStats handles STATS memory command, it shows approximate memory
+// used by connections, open items, transactions and queue storage
+// Command: STATS memory
+func (c *Controller) MemoryStats() error {
+	for _, item := range c.repo.MemoryStats() {
+		fmt.Fprintf(c.rw.Writer, "STAT %s %s\r\n", item.Key, item.Value)
+	}
+	fmt.Fprintf(c.rw.Writer, "END\r\n")
+	c.rw.Writer.Flush()
+	return nil
+}
+
+// ConfigStats handles STATS config command, it shows runtime tunable
+// settings and a number of changes made with CONFIG SET
+// Command: STATS config
+func (c *Controller) ConfigStats() error {
+	for _, item := range c.repo.ConfigStats() {
+		fmt.Fprintf(c.rw.Writer, "STAT %s %s\r\n", item.Key, item.Value)
+	}
+	fmt.Fprintf(c.rw.Writer, "END\r\n")
+	c.rw.Writer.Flush()
+	return nil
+}
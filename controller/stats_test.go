@@ -2,6 +2,7 @@ package controller
 
 import (
 	"fmt"
+	"strings"
 	"testing"
 	"time"
 
@@ -10,6 +11,63 @@ import (
 )
 
 func Test_Stats(t *testing.T) {
+	repo := newTestRepo(t)
+
+	mockTCPConn := NewMockTCPConn()
+	controller := NewSession(mockTCPConn, repo)
+
+	q, err := repo.GetQueue("test")
+	assert.Nil(t, err)
+
+	q.Enqueue([]byte("1"))
+
+	err = controller.Stats()
+	assert.Nil(t, err)
+	response := mockTCPConn.WriteBuffer.String()
+	assert.True(t, strings.HasPrefix(response, "STAT uptime 0\r\n"))
+	assert.True(t, strings.HasSuffix(response, "END\r\n"))
+	for _, stat := range []string{
+		fmt.Sprintf("STAT time %d", time.Now().Unix()),
+		"STAT version " + repo.Stats.Version,
+		"STAT curr_connections 1",
+		"STAT total_connections 1",
+		"STAT cmd_get 0",
+		"STAT cmd_set 0",
+		"STAT total_items 0",
+		"STAT panics 0",
+		"STAT enqueue_rate_1m 0.00",
+		"STAT dequeue_rate_15m 0.00",
+		fmt.Sprintf("STAT queue_test_items %d", q.Length()),
+		"STAT queue_test_open_transactions 0",
+		"STAT queue_test_delayed_items 0",
+		"STAT queue_test_delayed_next_due 0",
+		"STAT queue_test_archived_items 0",
+		"STAT queue_test_peak_items 1",
+		"STAT queue_test_bytes_in 1",
+		"STAT queue_test_bytes_out 0",
+		"STAT queue_test_enqueue_rate_1m 0.00",
+		"STAT queue_test_dequeue_rate_15m 0.00",
+		fmt.Sprintf("STAT queue_test_last_enqueue %d", q.Stats.LastEnqueue/int64(time.Second)),
+		"STAT queue_test_last_dequeue 0",
+		"STAT queue_test_readers 0",
+		"STAT queue_test_writers 0",
+		"STAT queue_test_rebases 0",
+		"STAT queue_test_last_rebase 0",
+		"STAT queue_test_disconnect_requeued 0",
+		"STAT queue_test_disconnect_delayed 0",
+		"STAT queue_test_disconnect_dead_lettered 0",
+		"STAT queue_test_time_in_queue_p99_ms 0",
+	} {
+		assert.Contains(t, response, stat+"\r\n")
+	}
+
+	// Head item age depends on test timing
+	var age int
+	fmt.Sscanf(response[strings.Index(response, "STAT queue_test_age_ms"):], "STAT queue_test_age_ms %d", &age)
+	assert.True(t, age < 1000)
+}
+
+func Test_StorageStats(t *testing.T) {
 	repo, err := repository.Initialize(dir)
 	defer repo.CloseAllQueues()
 	assert.Nil(t, err)
@@ -19,20 +77,67 @@ func Test_Stats(t *testing.T) {
 
 	q, err := repo.GetQueue("test")
 	assert.Nil(t, err)
+	q.Enqueue([]byte("1"))
+	assert.Nil(t, q.Compact())
+
+	assert.Nil(t, controller.StorageStats([]string{"stats", "leveldb", "test"}))
+	response := mockTCPConn.WriteBuffer.String()
+	assert.Contains(t, response, "STAT queue_test_leveldb_write_delays 0\r\n")
+	assert.Contains(t, response, "STAT queue_test_leveldb_write_paused 0\r\n")
+	assert.Regexp(t, "STAT queue_test_leveldb_level\\d_tables [1-9]", response)
+	assert.Contains(t, response, "STAT queue_test_leveldb_mem_compactions 1\r\n")
+	assert.True(t, strings.HasSuffix(response, "END\r\n"))
+
+	err = controller.StorageStats([]string{"stats", "leveldb", "["})
+	assert.Equal(t, "CLIENT_ERROR Invalid queue pattern", err.Error())
+}
 
+func Test_QueueInfo(t *testing.T) {
+	repo, err := repository.Initialize(dir)
+	defer repo.CloseAllQueues()
+	assert.Nil(t, err)
+
+	mockTCPConn := NewMockTCPConn()
+	controller := NewSession(mockTCPConn, repo)
+
+	repo.FlushQueue("test")
+	q, err := repo.GetQueue("test")
+	assert.Nil(t, err)
 	q.Enqueue([]byte("1"))
 
-	err = controller.Stats()
-	statsResponse := "STAT uptime 0\r\n" +
-		fmt.Sprintf("STAT time %d\r\n", time.Now().Unix()) +
-		"STAT version " + repo.Stats.Version + "\r\n" +
-		"STAT curr_connections 1\r\n" +
-		"STAT total_connections 1\r\n" +
-		"STAT cmd_get 0\r\n" +
-		"STAT cmd_set 0\r\n" +
-		fmt.Sprintf("STAT queue_test_items %d\r\n", q.Length()) +
-		"STAT queue_test_open_transactions 0\r\n" +
-		"END\r\n"
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "stats queue test\r\n")
+	assert.Nil(t, controller.Dispatch())
+	response := mockTCPConn.WriteBuffer.String()
+	assert.True(t, strings.HasPrefix(response, "STAT queue_test_items 1\r\n"))
+	assert.Contains(t, response, fmt.Sprintf("STAT queue_test_head %d\r\n", q.Head()))
+	assert.Contains(t, response, fmt.Sprintf("STAT queue_test_tail %d\r\n", q.Tail()))
+	assert.Regexp(t, "STAT queue_test_disk_bytes [1-9]", response)
+	assert.Regexp(t, "STAT queue_test_disk_files [1-9]", response)
+	assert.True(t, strings.HasSuffix(response, "END\r\n"))
+
+	err = controller.QueueInfo([]string{"stats", "queue", "missing"})
+	assert.Equal(t, "CLIENT_ERROR Unknown queue", err.Error())
+}
+
+func Test_QueueClients(t *testing.T) {
+	repo, err := repository.Initialize(dir)
+	defer repo.CloseAllQueues()
 	assert.Nil(t, err)
-	assert.Equal(t, statsResponse, mockTCPConn.WriteBuffer.String())
+	repo.FlushQueue("clients")
+
+	reader, writer := NewMockTCPConn(), NewMockTCPConn()
+	readerSession, writerSession := NewSession(reader, repo), NewSession(writer, repo)
+	fmt.Fprintf(&reader.ReadBuffer, "get clients\r\n")
+	assert.Nil(t, readerSession.Dispatch())
+	fmt.Fprintf(&writer.ReadBuffer, "set clients 0 0 1\r\n1\r\n")
+	assert.Nil(t, writerSession.Dispatch())
+	fmt.Fprintf(&writer.ReadBuffer, "set clients 0 0 1\r\n2\r\n")
+	assert.Nil(t, writerSession.Dispatch())
+
+	writer.WriteBuffer.Reset()
+	fmt.Fprintf(&writer.ReadBuffer, "stats queue clients\r\n")
+	assert.Nil(t, writerSession.Dispatch())
+	response := writer.WriteBuffer.String()
+	assert.Contains(t, response, "STAT queue_clients_readers 1\r\n")
+	assert.Contains(t, response, "STAT queue_clients_writers 1\r\n")
 }
@@ -0,0 +1,47 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	defaultTapDuration = time.Minute
+	maxTapDuration     = 24 * time.Hour
+)
+
+// Tap handles TAP command
+// Command: TAP <queue> <tap_queue> [<duration>]
+// Mirrors copies of items dequeued from <queue> to <tap_queue>
+// for a duration (1m by default, 24h at most), 0 removes the tap
+// Response: END
+func (c *Controller) Tap(input []string) error {
+	if len(input) < 3 || len(input) > 4 {
+		return errors.New("ERROR Invalid input")
+	}
+
+	duration := defaultTapDuration
+	if len(input) == 4 {
+		var err error
+		if input[3] == "0" {
+			duration = 0
+		} else if duration, err = time.ParseDuration(input[3]); err != nil || duration <= 0 {
+			return errors.New("ERROR Invalid <duration>")
+		}
+	}
+	if duration > maxTapDuration {
+		return errors.New("ERROR Tap duration is too long")
+	}
+
+	until := time.Time{}
+	if duration > 0 {
+		until = time.Now().Add(duration)
+	}
+	if err := c.repo.Tap(input[1], input[2], until); err != nil {
+		return errors.New("SERVER_ERROR " + err.Error())
+	}
+	fmt.Fprint(c.rw.Writer, "END\r\n")
+	c.rw.Writer.Flush()
+	return nil
+}
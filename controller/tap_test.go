@@ -0,0 +1,56 @@
+package controller
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/bogdanovich/siberite/queue"
+	"github.com/bogdanovich/siberite/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Tap(t *testing.T) {
+	repo, err := repository.Initialize(dir)
+	defer repo.CloseAllQueues()
+	assert.Nil(t, err)
+
+	mockTCPConn := NewMockTCPConn()
+	controller := NewSession(mockTCPConn, repo)
+
+	repo.FlushQueue("test")
+	defer repo.DeleteQueue("test_tap")
+
+	q, _ := repo.GetQueue("test")
+	q.Enqueue([]byte("1"))
+	q.Enqueue([]byte("2"))
+	q.Enqueue([]byte("3"))
+
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "tap test test_tap 1h\r\n")
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "get test\r\n")
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "get test/open\r\n")
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "get test/close\r\n")
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "tap test test_tap 0\r\n")
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "get test\r\n")
+	for i := 0; i < 6; i++ {
+		assert.Nil(t, controller.Dispatch())
+	}
+
+	tq, _ := repo.GetQueue("test_tap")
+	assert.Equal(t, uint64(2), tq.Length())
+	item, _ := tq.Dequeue()
+	assert.Equal(t, "1", string(item.Value))
+	item, _ = tq.Dequeue()
+	assert.Equal(t, "2", string(item.Value))
+
+	testCases := map[string][]string{
+		"ERROR Invalid input":                                      {"tap", "test"},
+		"ERROR Invalid <duration>":                                 {"tap", "test", "test_tap", "soon"},
+		"ERROR Tap duration is too long":                           {"tap", "test", "test_tap", "25h"},
+		"SERVER_ERROR Tap queue must differ from the tapped queue": {"tap", "test", "test"},
+		"SERVER_ERROR " + queue.ErrInvalidName.Error():             {"tap", "test", "test-tap"},
+	}
+	for expected, command := range testCases {
+		err = controller.Tap(command)
+		assert.Equal(t, expected, err.Error())
+	}
+}
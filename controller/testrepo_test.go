@@ -0,0 +1,28 @@
+package controller
+
+import (
+	"testing"
+
+	"github.com/bogdanovich/siberite/config"
+	"github.com/bogdanovich/siberite/repository"
+)
+
+// newTestRepo initializes a repository with the default configuration
+// in its own data directory, see newTestRepoWithConfig
+func newTestRepo(t *testing.T) *repository.QueueRepository {
+	t.Helper()
+	return newTestRepoWithConfig(t, config.Default())
+}
+
+// newTestRepoWithConfig initializes a repository in its own data directory,
+// which keeps connection counters of other tests intact. Queues are closed
+// and the directory is removed once the test is over.
+func newTestRepoWithConfig(t *testing.T, cfg *config.Config) *repository.QueueRepository {
+	t.Helper()
+	repo, err := repository.InitializeWithConfig(t.TempDir(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { repo.CloseAllQueues() })
+	return repo
+}
@@ -0,0 +1,104 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+
+	"github.com/bogdanovich/siberite/queue"
+	"github.com/bogdanovich/siberite/repository"
+)
+
+const (
+	maxTxnItems = 1000
+	maxTxnBytes = 16 << 20
+)
+
+// transaction keeps items staged between TXN BEGIN and TXN COMMIT
+type transaction struct {
+	items map[string][]*queue.Item
+	count int
+	size  int
+}
+
+// Txn handles TXN command
+// Command: TXN BEGIN
+// Response: END
+// SET and SETMETA commands are staged until commit, each responds QUEUED
+// Command: TXN COMMIT
+// Enqueues all staged items atomically
+// Response:
+// COMMITTED <items>
+// END
+// Command: TXN ABORT
+// Discards staged items
+// Response: END
+func (c *Controller) Txn(input []string) error {
+	if len(input) != 2 {
+		return errors.New("ERROR Invalid input")
+	}
+
+	switch strings.ToLower(input[1]) {
+	case "begin":
+		if c.txn != nil {
+			return errors.New("CLIENT_ERROR Transaction is already started")
+		}
+		c.txn = &transaction{items: map[string][]*queue.Item{}}
+	case "commit":
+		if c.txn == nil {
+			return errors.New("CLIENT_ERROR No transaction started")
+		}
+		// Staged items are kept, so the commit can be retried
+		if c.repo.MemoryExceeded() {
+			return errors.New("SERVER_ERROR Out of memory")
+		}
+		txn := c.releaseTxn()
+		batch := c.repo.RouteAll(txn.items)
+		if err := c.repo.EnqueueAll(batch); err != nil {
+			return errors.New("SERVER_ERROR " + err.Error())
+		}
+		var count uint64
+		for queueName, items := range batch {
+			for _, item := range items {
+				c.repo.Enqueued(queueName, item, c.id)
+				count++
+			}
+		}
+		atomic.AddUint64(&c.repo.Stats.CmdSet, uint64(txn.count))
+		atomic.AddUint64(&c.repo.Stats.TotalItems, count)
+		fmt.Fprintf(c.rw.Writer, "COMMITTED %d\r\n", txn.count)
+	case "abort":
+		c.releaseTxn()
+	default:
+		return errors.New("ERROR Invalid command")
+	}
+
+	c.rw.Writer.WriteString("END\r\n")
+	c.rw.Writer.Flush()
+	return nil
+}
+
+// stage adds an item to the transaction
+func (t *transaction) stage(queueName string, item *queue.Item) error {
+	if t.count >= maxTxnItems {
+		return errors.New("CLIENT_ERROR Too many items in transaction")
+	}
+	if t.size+len(item.Value) > maxTxnBytes {
+		return errors.New("CLIENT_ERROR Transaction is too large")
+	}
+	t.items[queueName] = append(t.items[queueName], item)
+	t.count++
+	t.size += len(item.Value)
+	return nil
+}
+
+// releaseTxn ends the transaction and releases memory of its staged items
+func (c *Controller) releaseTxn() *transaction {
+	txn := c.txn
+	c.txn = nil
+	if txn != nil {
+		c.repo.TrackMemory(repository.MemoryTransactions, -int64(txn.size))
+	}
+	return txn
+}
@@ -0,0 +1,72 @@
+package controller
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/bogdanovich/siberite/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Txn(t *testing.T) {
+	repo, err := repository.Initialize(dir)
+	defer repo.CloseAllQueues()
+	assert.Nil(t, err)
+
+	mockTCPConn := NewMockTCPConn()
+	controller := NewSession(mockTCPConn, repo)
+
+	repo.FlushQueue("test")
+	defer repo.DeleteQueue("test2")
+
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "txn begin\r\n")
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "set test 0 0 1\r\n1\r\n")
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "setmeta test2 0 0 1 k=v\r\n2\r\n")
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "set test 0 0 1\r\n3\r\n")
+	for i := 0; i < 4; i++ {
+		assert.Nil(t, controller.Dispatch())
+	}
+	assert.Equal(t, "END\r\nQUEUED\r\nQUEUED\r\nQUEUED\r\n", mockTCPConn.WriteBuffer.String())
+
+	q, _ := repo.GetQueue("test")
+	q2, _ := repo.GetQueue("test2")
+	assert.Equal(t, uint64(0), q.Length())
+	assert.Equal(t, uint64(0), q2.Length())
+
+	mockTCPConn.WriteBuffer.Reset()
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "txn commit\r\n")
+	assert.Nil(t, controller.Dispatch())
+	assert.Equal(t, "COMMITTED 3\r\nEND\r\n", mockTCPConn.WriteBuffer.String())
+	assert.Equal(t, uint64(2), q.Length())
+	assert.Equal(t, uint64(1), q2.Length())
+
+	item, _ := q2.Dequeue()
+	assert.Equal(t, "2", string(item.Value))
+	value, _ := item.Header("k")
+	assert.Equal(t, "v", value)
+
+	// Aborted transaction discards staged items
+	mockTCPConn.WriteBuffer.Reset()
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "txn begin\r\nset test 0 0 1\r\n4\r\ntxn abort\r\n")
+	for i := 0; i < 3; i++ {
+		assert.Nil(t, controller.Dispatch())
+	}
+	assert.Equal(t, "END\r\nQUEUED\r\nEND\r\n", mockTCPConn.WriteBuffer.String())
+	assert.Equal(t, uint64(2), q.Length())
+
+	err = controller.Txn([]string{"txn", "commit"})
+	assert.Equal(t, "CLIENT_ERROR No transaction started", err.Error())
+
+	controller.Txn([]string{"txn", "begin"})
+	err = controller.Txn([]string{"txn", "begin"})
+	assert.Equal(t, "CLIENT_ERROR Transaction is already started", err.Error())
+
+	err = controller.Set([]string{"set", "test/dedup=a", "0", "0", "1"})
+	assert.Equal(t, "CLIENT_ERROR Deduplication is not supported in transactions", err.Error())
+
+	err = controller.Txn([]string{"txn", "rollback"})
+	assert.Equal(t, "ERROR Invalid command", err.Error())
+
+	err = controller.Txn([]string{"txn"})
+	assert.Equal(t, "ERROR Invalid input", err.Error())
+}
@@ -0,0 +1,120 @@
+package controller
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Verbose handles VERBOSE command, responses to following commands
+// of the session are followed by diagnostics lines
+// Command: VERBOSE <on|off>
+// Response: END
+// Diagnostics:
+// VERBOSE command=<name> args=<quoted command line> queue=<queue|-> [<parsed option>=<value>...]
+// VERBOSE timing parse_us=<n> execute_us=<n> total_us=<n>
+// VERBOSE result status=<ok|error> bytes=<item bytes> [error=<quoted error>]
+// VERBOSE queue before items=<n> open_transactions=<n> delayed=<n>
+// VERBOSE queue after items=<n> open_transactions=<n> delayed=<n>
+// END
+func (c *Controller) Verbose(input []string) error {
+	on, err := parseSwitch(input)
+	if err != nil {
+		return err
+	}
+	c.verbose = on
+	c.rw.Writer.WriteString("END\r\n")
+	c.rw.Writer.Flush()
+	return nil
+}
+
+// verboseTrace keeps diagnostics of a command collected before it runs,
+// as handlers may rewrite command arguments
+type verboseTrace struct {
+	received time.Time
+	start    time.Time
+	args     string
+	options  string
+	before   string
+}
+
+func (c *Controller) startVerbose(cmd *Command, received time.Time, start time.Time) *verboseTrace {
+	return &verboseTrace{
+		received: received,
+		start:    start,
+		args:     strings.Join(cmd.Args, " "),
+		options:  parsedOptions(cmd),
+		before:   c.queueState(cmd.QueueName),
+	}
+}
+
+// writeVerbose writes diagnostics of a command after its response
+func (c *Controller) writeVerbose(v *verboseTrace, cmd *Command, elapsed time.Duration, err error) {
+	w := c.rw.Writer
+	queueName := cmd.QueueName
+	if queueName == "" {
+		queueName = "-"
+	}
+	fmt.Fprintf(w, "VERBOSE command=%s args=%s queue=%s%s\r\n",
+		cmd.Name, strconv.Quote(v.args), queueName, v.options)
+	fmt.Fprintf(w, "VERBOSE timing parse_us=%d execute_us=%d total_us=%d\r\n",
+		v.start.Sub(v.received)/time.Microsecond, elapsed/time.Microsecond, time.Since(v.received)/time.Microsecond)
+	if err != nil {
+		fmt.Fprintf(w, "VERBOSE result status=error bytes=%d error=%s\r\n", cmd.Item.ValueSize(), strconv.Quote(err.Error()))
+	} else {
+		fmt.Fprintf(w, "VERBOSE result status=ok bytes=%d\r\n", cmd.Item.ValueSize())
+	}
+	if v.before != "" {
+		fmt.Fprintf(w, "VERBOSE queue before %s\r\n", v.before)
+	}
+	if after := c.queueState(cmd.QueueName); after != "" {
+		fmt.Fprintf(w, "VERBOSE queue after %s\r\n", after)
+	}
+	w.WriteString("END\r\n")
+	w.Flush()
+}
+
+// parsedOptions lists options of a queue name the way GET parses them
+func parsedOptions(cmd *Command) string {
+	if (cmd.Name != "get" && cmd.Name != "gets") || len(cmd.Args) < 2 {
+		return ""
+	}
+	parsed := parseGetCommand(cmd.Args[:2])
+	options := ""
+	if parsed.SubCommand != "" {
+		options += " sub=" + parsed.SubCommand
+	}
+	if parsed.Timeout > 0 {
+		options += fmt.Sprintf(" timeout_ms=%d", parsed.Timeout/time.Millisecond)
+	}
+	if parsed.Meta {
+		options += " meta=1"
+	}
+	if parsed.Timestamp {
+		options += " ts=1"
+	}
+	if parsed.Deliveries {
+		options += " deliveries=1"
+	}
+	if parsed.MessageID {
+		options += " msgid=1"
+	}
+	if parsed.Index > 0 {
+		options += fmt.Sprintf(" i=%d", parsed.Index)
+	}
+	return options
+}
+
+// queueState describes an open queue, empty for queues that are not open
+func (c *Controller) queueState(name string) string {
+	if name == "" {
+		return ""
+	}
+	q, ok := c.repo.Lookup(name)
+	if !ok {
+		return ""
+	}
+	return fmt.Sprintf("items=%d open_transactions=%d delayed=%d",
+		q.Length(), q.Stats.OpenTransactions, q.Delayed())
+}
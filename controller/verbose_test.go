@@ -0,0 +1,54 @@
+package controller
+
+import (
+	"fmt"
+	"regexp"
+	"testing"
+
+	"github.com/bogdanovich/siberite/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Verbose(t *testing.T) {
+	repo, err := repository.Initialize(dir)
+	defer repo.CloseAllQueues()
+	assert.Nil(t, err)
+	repo.FlushQueue("test")
+
+	mockTCPConn := NewMockTCPConn()
+	controller := NewSession(mockTCPConn, repo)
+
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "verbose on\r\n")
+	assert.Nil(t, controller.Dispatch())
+	assert.Equal(t, "END\r\n", mockTCPConn.WriteBuffer.String())
+
+	mockTCPConn.WriteBuffer.Reset()
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "set test 0 0 1\r\n1\r\n")
+	assert.Nil(t, controller.Dispatch())
+	timing := regexp.MustCompile(`parse_us=\d+ execute_us=\d+ total_us=\d+`)
+	assert.Equal(t, "STORED\r\n"+
+		"VERBOSE command=set args=\"set test 0 0 1\" queue=test\r\n"+
+		"VERBOSE timing -\r\n"+
+		"VERBOSE result status=ok bytes=1\r\n"+
+		"VERBOSE queue before items=0 open_transactions=0 delayed=0\r\n"+
+		"VERBOSE queue after items=1 open_transactions=0 delayed=0\r\n"+
+		"END\r\n", timing.ReplaceAllString(mockTCPConn.WriteBuffer.String(), "-"))
+
+	mockTCPConn.WriteBuffer.Reset()
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "get test/open/t=10\r\n")
+	assert.Nil(t, controller.Dispatch())
+	assert.Equal(t, "VALUE test 0 1\r\n1\r\nEND\r\n"+
+		"VERBOSE command=get args=\"get test/open/t=10\" queue=test sub=open timeout_ms=10\r\n"+
+		"VERBOSE timing -\r\n"+
+		"VERBOSE result status=ok bytes=1\r\n"+
+		"VERBOSE queue before items=1 open_transactions=0 delayed=0\r\n"+
+		"VERBOSE queue after items=0 open_transactions=1 delayed=0\r\n"+
+		"END\r\n", timing.ReplaceAllString(mockTCPConn.WriteBuffer.String(), "-"))
+
+	mockTCPConn.WriteBuffer.Reset()
+	fmt.Fprintf(&mockTCPConn.ReadBuffer, "verbose off\r\nextset maybe\r\n")
+	controller.Dispatch()
+	controller.Dispatch()
+	assert.Contains(t, mockTCPConn.WriteBuffer.String(), "END\r\nVERBOSE command=verbose")
+	assert.True(t, regexp.MustCompile(`END\r\nERROR Invalid input\r\n$`).MatchString(mockTCPConn.WriteBuffer.String()))
+}
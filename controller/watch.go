@@ -0,0 +1,138 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/bogdanovich/siberite/repository"
+)
+
+const (
+	defaultWatchInterval = time.Second
+	minWatchInterval     = 100 * time.Millisecond
+	maxWatchInterval     = time.Hour
+)
+
+// watchHeartbeat is how often an idle event stream writes a heartbeat,
+// a failed write ends the stream of a disconnected client
+var watchHeartbeat = 30 * time.Second
+
+// Watch handles WATCH command, it streams stats snapshots or queue
+// events until the client disconnects, the session reads no commands meanwhile
+// Command: WATCH stats [<interval seconds>]
+// Response: STAT lines ended with END every interval (1 second by default,
+// fractions are allowed, 0.1 to 3600)
+// Command: WATCH events [<queue pattern>]
+// Response: EVENT lines, see writeEvent
+func (c *Controller) Watch(input []string) error {
+	if len(input) < 2 || len(input) > 3 {
+		return errors.New("ERROR Invalid input")
+	}
+	switch input[1] {
+	case "stats":
+		return c.watchStats(input)
+	case "events":
+		return c.watchEvents(input)
+	}
+	return errors.New("ERROR Invalid input")
+}
+
+func (c *Controller) watchStats(input []string) error {
+	interval := defaultWatchInterval
+	if len(input) == 3 {
+		seconds, err := strconv.ParseFloat(input[2], 64)
+		interval = time.Duration(seconds * float64(time.Second))
+		if err != nil || interval < minWatchInterval || interval > maxWatchInterval {
+			return errors.New("ERROR Invalid <interval>")
+		}
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := c.writeSnapshot(c.repo.FullStats()); err != nil {
+			return err
+		}
+		select {
+		case <-c.ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func (c *Controller) watchEvents(input []string) error {
+	pattern := "*"
+	if len(input) == 3 {
+		pattern = input[2]
+	}
+	if _, err := path.Match(pattern, ""); err != nil {
+		return errors.New("CLIENT_ERROR Invalid queue pattern")
+	}
+	s := c.repo.Subscribe()
+	defer c.repo.Unsubscribe(s)
+	fmt.Fprintf(c.rw.Writer, "WATCHING events\r\n")
+	if err := c.rw.Writer.Flush(); err != nil {
+		return err
+	}
+
+	heartbeat := time.NewTicker(watchHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		var err error
+		select {
+		case <-c.ctx.Done():
+			return nil
+		case event := <-s.C:
+			if dropped := c.repo.Dropped(s); dropped > 0 {
+				if err = c.writeEvent(repository.Event{Kind: repository.EventDropped, Count: dropped, Time: event.Time}); err != nil {
+					return err
+				}
+			}
+			// Queues created after the command was authorized are checked by event
+			if ok, _ := path.Match(pattern, event.Queue); ok && c.repo.Policy.Allowed(c.identity, input[0], event.Queue) {
+				err = c.writeEvent(event)
+			}
+		case now := <-heartbeat.C:
+			err = c.writeEvent(repository.Event{Kind: "heartbeat", Time: now})
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// writeEvent writes an event line:
+// EVENT <unix ms> created|deleted|flushed <queue>
+// EVENT <unix ms> alert <queue> <alert> firing|resolved <value> <threshold>
+// EVENT <unix ms> dropped <number of events missed by a slow client>
+// EVENT <unix ms> heartbeat
+func (c *Controller) writeEvent(event repository.Event) error {
+	c.setCommandDeadlines()
+	line := fmt.Sprintf("EVENT %d %s", event.Time.UnixNano()/int64(time.Millisecond), event.Kind)
+	if event.Queue != "" {
+		line += " " + event.Queue
+	}
+	if a := event.Alert; a != nil {
+		line += fmt.Sprintf(" %s %s %d %d", a.Alert, a.State, a.Value, a.Threshold)
+	}
+	if event.Kind == repository.EventDropped {
+		line += " " + strconv.FormatUint(event.Count, 10)
+	}
+	fmt.Fprintf(c.rw.Writer, "%s\r\n", line)
+	return c.rw.Writer.Flush()
+}
+
+// writeSnapshot writes stats ended with END, a failed write means
+// the client is gone
+func (c *Controller) writeSnapshot(stats []repository.StatItem) error {
+	c.setCommandDeadlines()
+	for _, item := range stats {
+		fmt.Fprintf(c.rw.Writer, "STAT %s %s\r\n", item.Key, item.Value)
+	}
+	fmt.Fprintf(c.rw.Writer, "END\r\n")
+	return c.rw.Writer.Flush()
+}
@@ -0,0 +1,120 @@
+package controller
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bogdanovich/siberite/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Watch(t *testing.T) {
+	repo, err := repository.Initialize(dir)
+	defer repo.CloseAllQueues()
+	assert.Nil(t, err)
+
+	mockTCPConn := NewMockTCPConn()
+	controller := NewSession(mockTCPConn, repo)
+	defer controller.FinishSession()
+
+	done := make(chan error)
+	go func() { done <- controller.Watch([]string{"watch", "stats", "0.1"}) }()
+	time.Sleep(250 * time.Millisecond)
+	// The stream ends when the session is cancelled on disconnect
+	controller.cancel()
+	assert.Nil(t, <-done)
+	response := mockTCPConn.WriteBuffer.String()
+	assert.True(t, strings.Count(response, "END\r\n") >= 2)
+	assert.True(t, strings.HasPrefix(response, "STAT uptime "))
+
+	for _, input := range [][]string{{"watch"}, {"watch", "queues"}, {"watch", "stats", "0"}, {"watch", "stats", "x"}, {"watch", "events", "["}} {
+		err = controller.Watch(input)
+		assert.NotNil(t, err)
+	}
+	assert.Equal(t, "ERROR Invalid <interval>", controller.Watch([]string{"watch", "stats", "7200"}).Error())
+}
+
+// mockStreamConn passes each write to a channel, so a test waits for
+// streamed lines instead of sleeping
+type mockStreamConn struct {
+	*MockTCPConn
+	writes chan string
+}
+
+func (conn *mockStreamConn) Write(b []byte) (int, error) {
+	conn.writes <- string(b)
+	return len(b), nil
+}
+
+// next returns the next write of a stream
+func (conn *mockStreamConn) next(t *testing.T) string {
+	select {
+	case line := <-conn.writes:
+		return line
+	case <-time.After(5 * time.Second):
+		t.Fatal("no line streamed")
+		return ""
+	}
+}
+
+func Test_WatchEvents(t *testing.T) {
+	repo, err := repository.Initialize(dir)
+	assert.Nil(t, err)
+	defer repo.CloseAllQueues()
+	repo.DeleteQueue("watched")
+	repo.DeleteQueue("other")
+
+	conn := &mockStreamConn{NewMockTCPConn(), make(chan string, 16)}
+	controller := NewSession(conn, repo)
+	defer controller.FinishSession()
+
+	done := make(chan error)
+	go func() { done <- controller.Watch([]string{"watch", "events", "watch*"}) }()
+	// The session is subscribed before WATCHING is written
+	assert.Equal(t, "WATCHING events\r\n", conn.next(t))
+	repo.GetQueue("other")
+	repo.GetQueue("watched")
+	repo.FlushQueue("watched")
+	repo.DeleteQueue("watched")
+	// Events of other queues are skipped, the first event is of watched
+	for _, kind := range []string{"created", "flushed", "deleted"} {
+		assert.Regexp(t, "^EVENT \\d+ "+kind+" watched\r\n$", conn.next(t))
+	}
+	controller.cancel()
+	assert.Nil(t, <-done)
+}
+
+func Test_WatchEvents_Heartbeat(t *testing.T) {
+	repo, err := repository.Initialize(dir)
+	assert.Nil(t, err)
+	defer repo.CloseAllQueues()
+
+	conn := &mockStreamConn{NewMockTCPConn(), make(chan string, 16)}
+	controller := NewSession(conn, repo)
+	defer controller.FinishSession()
+	defer func(saved time.Duration) { watchHeartbeat = saved }(watchHeartbeat)
+	watchHeartbeat = 10 * time.Millisecond
+
+	done := make(chan error)
+	go func() { done <- controller.Watch([]string{"watch", "events", "heartbeat_only"}) }()
+	assert.Equal(t, "WATCHING events\r\n", conn.next(t))
+	assert.Regexp(t, "^EVENT \\d+ heartbeat\r\n$", conn.next(t))
+	controller.cancel()
+	assert.Nil(t, <-done)
+}
+
+func Test_writeEvent(t *testing.T) {
+	repo, err := repository.Initialize(dir)
+	assert.Nil(t, err)
+	defer repo.CloseAllQueues()
+	mockTCPConn := NewMockTCPConn()
+	controller := NewSession(mockTCPConn, repo)
+	defer controller.FinishSession()
+
+	now := time.Unix(1500000000, 0)
+	assert.Nil(t, controller.writeEvent(repository.Event{Kind: repository.EventDropped, Count: 3, Time: now}))
+	assert.Nil(t, controller.writeEvent(repository.Event{Kind: repository.EventCreated, Queue: "work", Time: now}))
+	assert.Equal(t, "EVENT 1500000000000 dropped 3\r\nEVENT 1500000000000 created work\r\n",
+		mockTCPConn.WriteBuffer.String())
+}
@@ -0,0 +1,43 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ForceFlag confirms an admin command on every queue matching a pattern
+const ForceFlag = "--force"
+
+// isPattern reports whether a queue argument is a glob pattern
+func isPattern(name string) bool {
+	return strings.ContainsAny(name, "*?[")
+}
+
+// forEachMatching runs an admin command on every queue matching a pattern.
+// Without --force matching queues are only listed:
+// Response: MATCH <queue>
+// ...
+// END
+func (c *Controller) forEachMatching(input []string, apply func(name string) error) error {
+	if len(input) > 3 || (len(input) == 3 && input[2] != ForceFlag) {
+		return errors.New("ERROR Invalid input")
+	}
+	names, err := c.repo.MatchQueues(input[1])
+	if err != nil {
+		return errors.New("CLIENT_ERROR Invalid queue pattern")
+	}
+	force := len(input) == 3
+	for _, name := range names {
+		if !force {
+			fmt.Fprintf(c.rw.Writer, "MATCH %s\r\n", name)
+			continue
+		}
+		if err = apply(name); err != nil {
+			return errors.New("SERVER_ERROR " + err.Error())
+		}
+	}
+	fmt.Fprint(c.rw.Writer, "END\r\n")
+	c.rw.Writer.Flush()
+	return nil
+}
@@ -0,0 +1,58 @@
+package controller
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bogdanovich/siberite/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Wildcards(t *testing.T) {
+	repo, err := repository.Initialize(dir)
+	defer repo.CloseAllQueues()
+	assert.Nil(t, err)
+	defer repo.DeleteQueue("ingest_a")
+	defer repo.DeleteQueue("ingest_b")
+
+	mockTCPConn := NewMockTCPConn()
+	controller := NewSession(mockTCPConn, repo)
+
+	repo.FlushQueue("test")
+	for _, name := range []string{"ingest_a", "ingest_b", "test"} {
+		q, _ := repo.GetQueue(name)
+		q.Enqueue([]byte("1"))
+	}
+
+	// Without --force matching queues are only listed
+	assert.Nil(t, controller.Flush([]string{"flush", "ingest_*"}))
+	assert.Equal(t, "MATCH ingest_a\r\nMATCH ingest_b\r\nEND\r\n", mockTCPConn.WriteBuffer.String())
+	q, _ := repo.GetQueue("ingest_a")
+	assert.Equal(t, uint64(1), q.Length())
+
+	mockTCPConn.WriteBuffer.Reset()
+	assert.Nil(t, controller.QueueStats([]string{"stats", "ingest_?"}))
+	response := mockTCPConn.WriteBuffer.String()
+	assert.True(t, strings.HasPrefix(response, "STAT queue_ingest_a_items 1\r\n"))
+	assert.Contains(t, response, "STAT queue_ingest_b_items 1\r\n")
+	assert.NotContains(t, response, "queue_test_")
+
+	mockTCPConn.WriteBuffer.Reset()
+	assert.Nil(t, controller.Flush([]string{"flush", "ingest_*", "--force"}))
+	assert.Equal(t, "END\r\n", mockTCPConn.WriteBuffer.String())
+	for _, name := range []string{"ingest_a", "ingest_b"} {
+		q, _ := repo.GetQueue(name)
+		assert.Equal(t, uint64(0), q.Length())
+	}
+	q, _ = repo.GetQueue("test")
+	assert.Equal(t, uint64(1), q.Length())
+
+	assert.Nil(t, controller.Delete([]string{"delete", "ingest_*", "--force"}))
+	names, _ := repo.MatchQueues("ingest_*")
+	assert.Equal(t, []string{}, names)
+
+	err = controller.Flush([]string{"flush", "ingest_*", "force"})
+	assert.Equal(t, "ERROR Invalid input", err.Error())
+	err = controller.Delete([]string{"delete", "ingest_[", "--force"})
+	assert.Equal(t, "CLIENT_ERROR Invalid queue pattern", err.Error())
+}
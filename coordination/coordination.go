@@ -0,0 +1,167 @@
+// Package coordination elects a leader among siberite instances
+// sharing a replicated queue set.
+//
+// Leadership is a Consul lock: an instance creates a session with a TTL,
+// acquires a key with it and renews the session while it runs.
+// When the leader stops renewing, Consul invalidates its session,
+// releases the key and a follower acquires it on its next attempt.
+package coordination
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Elector keeps leadership state of an instance
+type Elector struct {
+	address string
+	key     string
+	node    string
+	ttl     time.Duration
+	client  *http.Client
+	session string
+	leader  int32
+	done    chan struct{}
+	wg      sync.WaitGroup
+	// elected is closed once the first campaign has a result
+	elected     chan struct{}
+	electedOnce sync.Once
+}
+
+// NewConsul creates an elector using Consul agent at a given address
+func NewConsul(address string, key string, node string, ttl time.Duration) *Elector {
+	return &Elector{
+		address: strings.TrimRight(address, "/"),
+		key:     strings.Trim(key, "/"),
+		node:    node,
+		ttl:     ttl,
+		client:  &http.Client{Timeout: ttl / 2},
+		done:    make(chan struct{}),
+		elected: make(chan struct{}),
+	}
+}
+
+// Leader reports whether the instance holds leadership, nil Elector is never a leader
+func (e *Elector) Leader() bool {
+	return e != nil && atomic.LoadInt32(&e.leader) == 1
+}
+
+// Start runs election in background until Stop
+func (e *Elector) Start() {
+	e.wg.Add(1)
+	go e.run()
+}
+
+// Elected returns a channel closed once the first campaign either acquired
+// leadership or failed to, Leader is known from then on
+func (e *Elector) Elected() <-chan struct{} {
+	return e.elected
+}
+
+// Stop gives up leadership, so a follower takes over without waiting for TTL
+func (e *Elector) Stop() {
+	if e == nil {
+		return
+	}
+	close(e.done)
+	e.wg.Wait()
+	if e.session != "" {
+		e.put("/v1/session/destroy/"+e.session, nil)
+	}
+	e.setLeader(false)
+}
+
+func (e *Elector) run() {
+	defer e.wg.Done()
+	for {
+		if err := e.campaign(); err != nil {
+			log.Printf("leader election: %s", err.Error())
+			e.session = ""
+			e.setLeader(false)
+		}
+		e.electedOnce.Do(func() { close(e.elected) })
+		select {
+		case <-e.done:
+			return
+		case <-time.After(e.ttl / 3):
+		}
+	}
+}
+
+// campaign renews the session, creating it if needed, and tries to acquire the key
+func (e *Elector) campaign() error {
+	if e.session != "" {
+		if _, err := e.put("/v1/session/renew/"+e.session, nil); err != nil {
+			return err
+		}
+	} else {
+		body, err := e.put("/v1/session/create", map[string]string{
+			"Name": e.node, "TTL": e.ttl.String(), "Behavior": "release", "LockDelay": "0s",
+		})
+		if err != nil {
+			return err
+		}
+		var session struct{ ID string }
+		if err = json.Unmarshal(body, &session); err != nil || session.ID == "" {
+			return errors.New("invalid session response")
+		}
+		e.session = session.ID
+	}
+
+	body, err := e.put("/v1/kv/"+e.key+"?acquire="+url.QueryEscape(e.session), e.node)
+	if err != nil {
+		return err
+	}
+	acquired := strings.TrimSpace(string(body)) == "true"
+	if acquired != e.Leader() {
+		log.Printf("leader election: %s leader=%t", e.node, acquired)
+	}
+	e.setLeader(acquired)
+	return nil
+}
+
+func (e *Elector) setLeader(leader bool) {
+	var value int32
+	if leader {
+		value = 1
+	}
+	atomic.StoreInt32(&e.leader, value)
+}
+
+func (e *Elector) put(path string, payload interface{}) ([]byte, error) {
+	var data []byte
+	switch p := payload.(type) {
+	case nil:
+	case string:
+		data = []byte(p)
+	default:
+		data, _ = json.Marshal(p)
+	}
+	req, err := http.NewRequest("PUT", e.address+path, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s %s", path, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return body, nil
+}
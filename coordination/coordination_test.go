@@ -0,0 +1,78 @@
+package coordination
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeConsul implements session and lock endpoints used by Elector
+type fakeConsul struct {
+	sessions map[string]bool
+	holder   string
+	nextID   int
+	sync.Mutex
+}
+
+func (c *fakeConsul) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c.Lock()
+	defer c.Unlock()
+	switch {
+	case r.URL.Path == "/v1/session/create":
+		c.nextID++
+		id := fmt.Sprintf("s%d", c.nextID)
+		c.sessions[id] = true
+		fmt.Fprintf(w, `{"ID": "%s"}`, id)
+	case strings.HasPrefix(r.URL.Path, "/v1/session/renew/"):
+		if !c.sessions[strings.TrimPrefix(r.URL.Path, "/v1/session/renew/")] {
+			http.NotFound(w, r)
+		}
+	case strings.HasPrefix(r.URL.Path, "/v1/session/destroy/"):
+		id := strings.TrimPrefix(r.URL.Path, "/v1/session/destroy/")
+		delete(c.sessions, id)
+		if c.holder == id {
+			c.holder = ""
+		}
+	case strings.HasPrefix(r.URL.Path, "/v1/kv/"):
+		id := r.URL.Query().Get("acquire")
+		if c.holder == "" || c.holder == id {
+			c.holder = id
+			fmt.Fprint(w, "true")
+		} else {
+			fmt.Fprint(w, "false")
+		}
+	}
+}
+
+func Test_Elector(t *testing.T) {
+	server := httptest.NewServer(&fakeConsul{sessions: map[string]bool{}})
+	defer server.Close()
+
+	ttl := 300 * time.Millisecond
+	first := NewConsul(server.URL, "siberite/leader", "first", ttl)
+	first.Start()
+	<-first.Elected()
+	assert.True(t, first.Leader())
+	second := NewConsul(server.URL, "siberite/leader", "second", ttl)
+	second.Start()
+	defer second.Stop()
+
+	time.Sleep(150 * time.Millisecond)
+	assert.True(t, first.Leader())
+	assert.False(t, second.Leader())
+
+	// Follower takes over once the leader gives up its session
+	first.Stop()
+	assert.False(t, first.Leader())
+	time.Sleep(250 * time.Millisecond)
+	assert.True(t, second.Leader())
+
+	var e *Elector
+	assert.False(t, e.Leader())
+}
@@ -0,0 +1,187 @@
+// Package errcode assigns stable numeric codes to protocol error responses.
+//
+// A coded response keeps the legacy class and text and puts the code
+// between them, so clients can branch on the code:
+//
+//	CLIENT_ERROR Close current item first
+//	CLIENT_ERROR 1201 Close current item first
+//
+// Codes are grouped by class: 10xx for ERROR (malformed commands),
+// 12xx for CLIENT_ERROR and 15xx for SERVER_ERROR. Messages without
+// a specific code get the generic code of their class.
+//
+// Messages are matched exactly, a message ending with a space
+// is followed by an argument, e.g. "Invalid header " matches
+// "Invalid header x".
+package errcode
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Error response classes
+const (
+	ClassError       = "ERROR"
+	ClassClientError = "CLIENT_ERROR"
+	ClassServerError = "SERVER_ERROR"
+)
+
+// Error codes
+const (
+	Error                 = 1000
+	UnknownCommand        = 1001
+	InvalidInput          = 1002
+	InvalidCommand        = 1003
+	InvalidFlags          = 1004
+	InvalidBytes          = 1005
+	InvalidHeader         = 1006
+	TooManyHeaders        = 1007
+	HeadersTooLarge       = 1008
+	InvalidDedupKey       = 1009
+	InvalidDuration       = 1010
+	TapDurationTooLong    = 1011
+	NotSupportedByRouter  = 1012
+	InvalidSince          = 1013
+	InvalidTimeRange      = 1014
+	InvalidItemID         = 1015
+	InvalidWeight         = 1016
+	InvalidInterval       = 1017
+	InvalidCount          = 1018
+	ClientError           = 1200
+	CloseCurrentItemFirst = 1201
+	BadDataChunk          = 1202
+	ValueTooLarge         = 1203
+	TransactionTooLarge   = 1204
+	TooManyItems          = 1205
+	TransactionStarted    = 1206
+	NoTransaction         = 1207
+	DedupInTransaction    = 1208
+	InvalidQueuePattern   = 1209
+	UnknownPeer           = 1210
+	AuthRequired          = 1211
+	AuthFailed            = 1212
+	Forbidden             = 1213
+	TooManyOpenItems      = 1214
+	UnknownSetting        = 1215
+	InvalidSettingValue   = 1216
+	QueueQuotaExceeded    = 1217
+	StorageQuotaExceeded  = 1218
+	RateQuotaExceeded     = 1219
+	ReplayDisabled        = 1220
+	ServerError           = 1500
+	ReadOnlyFollower      = 1501
+	BackendUnavailable    = 1502
+	SnapshotLoading       = 1503
+)
+
+// messages maps message texts of each class to codes
+var messages = []struct {
+	class string
+	text  string
+	code  int
+}{
+	{ClassError, "Unknown command", UnknownCommand},
+	{ClassError, "Invalid input", InvalidInput},
+	{ClassError, "Invalid command", InvalidCommand},
+	{ClassError, "Invalid <flags> number", InvalidFlags},
+	{ClassError, "Invalid <bytes> number", InvalidBytes},
+	{ClassError, "Invalid header ", InvalidHeader},
+	{ClassError, "Too many headers", TooManyHeaders},
+	{ClassError, "Headers are too large", HeadersTooLarge},
+	{ClassError, "Invalid dedup key", InvalidDedupKey},
+	{ClassError, "Invalid <duration>", InvalidDuration},
+	{ClassError, "Tap duration is too long", TapDurationTooLong},
+	{ClassError, "Invalid <since>", InvalidSince},
+	{ClassError, "Invalid <from>", InvalidTimeRange},
+	{ClassError, "Invalid <to>", InvalidTimeRange},
+	{ClassError, "Invalid <item id> number", InvalidItemID},
+	{ClassError, "Invalid <weight> ", InvalidWeight},
+	{ClassError, "Invalid <interval>", InvalidInterval},
+	{ClassError, "Invalid <n> number", InvalidCount},
+	{ClassError, "Queue patterns are not supported by router", NotSupportedByRouter},
+	{ClassError, "Transactions are not supported by router", NotSupportedByRouter},
+	{ClassClientError, "Close current item first", CloseCurrentItemFirst},
+	{ClassClientError, "bad data chunk", BadDataChunk},
+	{ClassClientError, "Value is too large", ValueTooLarge},
+	{ClassClientError, "Value is too large for a transaction", ValueTooLarge},
+	{ClassClientError, "Value is too large for BSET", ValueTooLarge},
+	{ClassClientError, "Transaction is too large", TransactionTooLarge},
+	{ClassClientError, "Too many items in transaction", TooManyItems},
+	{ClassClientError, "Transaction is already started", TransactionStarted},
+	{ClassClientError, "No transaction started", NoTransaction},
+	{ClassClientError, "Deduplication is not supported in transactions", DedupInTransaction},
+	{ClassClientError, "Invalid queue pattern", InvalidQueuePattern},
+	{ClassClientError, "Unknown replication peer", UnknownPeer},
+	{ClassClientError, "Authentication required", AuthRequired},
+	{ClassClientError, "Authentication failed", AuthFailed},
+	{ClassClientError, "Forbidden", Forbidden},
+	{ClassClientError, "Too many open items", TooManyOpenItems},
+	{ClassClientError, "Unknown setting ", UnknownSetting},
+	{ClassClientError, "Invalid value ", InvalidSettingValue},
+	{ClassClientError, "Queue quota exceeded", QueueQuotaExceeded},
+	{ClassClientError, "Storage quota exceeded", StorageQuotaExceeded},
+	{ClassClientError, "Enqueue rate quota exceeded", RateQuotaExceeded},
+	{ClassClientError, "Replay is disabled", ReplayDisabled},
+	{ClassServerError, "Queue is read-only on a follower", ReadOnlyFollower},
+	{ClassServerError, "Backend ", BackendUnavailable},
+	{ClassServerError, "Queue snapshot is loading", SnapshotLoading},
+}
+
+var classes = map[string]int{
+	ClassError:       Error,
+	ClassClientError: ClientError,
+	ClassServerError: ServerError,
+}
+
+// Code returns a code of an error response line, zero if the line
+// is not an error response
+func Code(line string) int {
+	class, text := split(line)
+	generic, ok := classes[class]
+	if !ok {
+		return 0
+	}
+	if code, err := strconv.Atoi(strings.SplitN(text, " ", 2)[0]); err == nil {
+		return code
+	}
+	for _, message := range messages {
+		if message.class == class && matches(text, message.text) {
+			return message.code
+		}
+	}
+	return generic
+}
+
+// Format inserts a code into an error response line,
+// lines that are not error responses or already coded are returned as is
+func Format(line string) string {
+	class, text := split(line)
+	if _, ok := classes[class]; !ok {
+		return line
+	}
+	if _, err := strconv.Atoi(strings.SplitN(text, " ", 2)[0]); err == nil {
+		return line
+	}
+	if text == "" {
+		return class + " " + strconv.Itoa(Code(line))
+	}
+	return class + " " + strconv.Itoa(Code(line)) + " " + text
+}
+
+// matches reports whether text is the message,
+// or the message followed by an argument
+func matches(text, message string) bool {
+	if strings.HasSuffix(message, " ") {
+		return strings.HasPrefix(text, message)
+	}
+	return text == message
+}
+
+func split(line string) (string, string) {
+	parts := strings.SplitN(strings.TrimRight(line, "\r\n"), " ", 2)
+	if len(parts) == 1 {
+		return parts[0], ""
+	}
+	return parts[0], parts[1]
+}
@@ -0,0 +1,33 @@
+package errcode
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Code(t *testing.T) {
+	assert.Equal(t, CloseCurrentItemFirst, Code("CLIENT_ERROR Close current item first"))
+	assert.Equal(t, InvalidHeader, Code("ERROR Invalid header x"))
+	assert.Equal(t, UnknownCommand, Code("ERROR Unknown command\r\n"))
+	assert.Equal(t, ServerError, Code("SERVER_ERROR leveldb: closed"))
+	assert.Equal(t, ClientError, Code("CLIENT_ERROR unexpected EOF"))
+	assert.Equal(t, Error, Code("ERROR"))
+	assert.Equal(t, ReadOnlyFollower, Code("SERVER_ERROR 1501 Queue is read-only on a follower"))
+	// Message text is matched within its class only
+	assert.Equal(t, ServerError, Code("SERVER_ERROR Invalid input"))
+	// Message text is matched exactly unless it takes an argument
+	assert.Equal(t, ValueTooLarge, Code("CLIENT_ERROR Value is too large"))
+	assert.Equal(t, ClientError, Code("CLIENT_ERROR Invalid value"))
+	assert.Equal(t, InvalidSettingValue, Code("CLIENT_ERROR Invalid value x"))
+	assert.Equal(t, ClientError, Code("CLIENT_ERROR Invalid prefetch size"))
+	assert.Equal(t, Error, Code("ERROR Invalid input x"))
+	assert.Equal(t, 0, Code("STORED"))
+}
+
+func Test_Format(t *testing.T) {
+	assert.Equal(t, "CLIENT_ERROR 1201 Close current item first", Format("CLIENT_ERROR Close current item first"))
+	assert.Equal(t, "ERROR 1000", Format("ERROR"))
+	assert.Equal(t, "ERROR 1002 Invalid input", Format("ERROR 1002 Invalid input"))
+	assert.Equal(t, "END", Format("END"))
+}
@@ -0,0 +1,53 @@
+// Package hashring maps keys to nodes with consistent hashing,
+// adding or removing a node moves only keys of that node.
+package hashring
+
+import (
+	"hash/crc32"
+	"sort"
+	"strconv"
+)
+
+// DefaultReplicas is a number of ring points per node
+const DefaultReplicas = 160
+
+// Ring represents a consistent hash ring of nodes
+type Ring struct {
+	points []uint32
+	nodes  map[uint32]string
+}
+
+// New creates a ring of nodes with a given number of points per node
+func New(nodes []string, replicas int) *Ring {
+	r := &Ring{nodes: map[uint32]string{}}
+	for _, node := range nodes {
+		for i := 0; i < replicas; i++ {
+			point := crc32.ChecksumIEEE([]byte(node + "#" + strconv.Itoa(i)))
+			if _, ok := r.nodes[point]; !ok {
+				r.points = append(r.points, point)
+				r.nodes[point] = node
+			}
+		}
+	}
+	sort.Sort(uint32Slice(r.points))
+	return r
+}
+
+// Get returns a node of a key, empty string for an empty ring
+func (r *Ring) Get(key string) string {
+	if len(r.points) == 0 {
+		return ""
+	}
+	hash := crc32.ChecksumIEEE([]byte(key))
+	i := sort.Search(len(r.points), func(i int) bool { return r.points[i] >= hash })
+	if i == len(r.points) {
+		i = 0
+	}
+	return r.nodes[r.points[i]]
+}
+
+type uint32Slice []uint32
+
+func (s uint32Slice) Len() int           { return len(s) }
+func (s uint32Slice) Less(i, j int) bool { return s[i] < s[j] }
+func (s uint32Slice) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
@@ -0,0 +1,35 @@
+package hashring
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Ring(t *testing.T) {
+	assert.Equal(t, "", New(nil, DefaultReplicas).Get("work"))
+
+	nodes := []string{"a:22133", "b:22133", "c:22133"}
+	ring := New(nodes, DefaultReplicas)
+	counts := map[string]int{}
+	before := map[string]string{}
+	for i := 0; i < 3000; i++ {
+		key := "queue_" + strconv.Itoa(i)
+		node := ring.Get(key)
+		assert.Equal(t, node, ring.Get(key))
+		counts[node]++
+		before[key] = node
+	}
+	for _, node := range nodes {
+		assert.True(t, counts[node] > 700, "keys are not balanced: %v", counts)
+	}
+
+	// Removing a node moves only its keys
+	ring = New(nodes[:2], DefaultReplicas)
+	for key, node := range before {
+		if node != "c:22133" {
+			assert.Equal(t, node, ring.Get(key))
+		}
+	}
+}
@@ -0,0 +1,155 @@
+// Package hlc generates globally unique message ids ordered by
+// hybrid logical clocks: ids of one node grow strictly, and a node
+// observing an id of another node never issues smaller ids afterwards,
+// so ids follow causality even when wall clocks of nodes drift.
+package hlc
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"hash/fnv"
+	"sync"
+	"time"
+)
+
+// logicalBits is a number of low timestamp bits counting ids
+// issued within one millisecond
+const logicalBits = 16
+
+// MaxDrift limits how far ahead of the wall clock observed timestamps may be
+const MaxDrift = time.Minute
+
+// IDLength is a length of message ids: 16 hex digits of a timestamp
+// followed by 8 hex digits of a node
+const IDLength = 24
+
+// Timestamp is a hybrid logical clock value, unix milliseconds
+// in high bits and a logical counter in low logicalBits bits
+type Timestamp uint64
+
+// Time returns wall clock time of the timestamp
+func (ts Timestamp) Time() time.Time {
+	ms := int64(ts >> logicalBits)
+	return time.Unix(ms/1000, ms%1000*int64(time.Millisecond))
+}
+
+// Clock issues timestamps of a node
+type Clock struct {
+	node uint32
+	now  func() time.Time
+
+	sync.Mutex
+	last Timestamp
+}
+
+// NewClock creates a clock of a node, nodes must have distinct names
+func NewClock(node string) *Clock {
+	return &Clock{node: nodeHash(node), now: time.Now}
+}
+
+// Now returns a timestamp greater than any issued or observed before
+func (c *Clock) Now() Timestamp {
+	c.Lock()
+	defer c.Unlock()
+	return c.tick()
+}
+
+// Observe advances the clock past a timestamp received from another node,
+// timestamps over MaxDrift ahead of the wall clock are ignored, so a node
+// with a broken clock doesn't move ids of other nodes into the future
+func (c *Clock) Observe(ts Timestamp) {
+	c.Lock()
+	defer c.Unlock()
+	if ts > c.last && ts.Time().Sub(c.now()) <= MaxDrift {
+		c.last = ts
+	}
+}
+
+func (c *Clock) physical() Timestamp {
+	return Timestamp(c.now().UnixNano()/int64(time.Millisecond)) << logicalBits
+}
+
+// NewID returns a message id of the next timestamp
+func (c *Clock) NewID() string {
+	return FormatID(c.Now(), c.node)
+}
+
+// tick must be called with the clock locked
+func (c *Clock) tick() Timestamp {
+	physical := c.physical()
+	// A counter overflow borrows the next millisecond
+	if physical > c.last {
+		c.last = physical
+	} else {
+		c.last++
+	}
+	return c.last
+}
+
+// FormatID formats a message id of a timestamp issued by a node,
+// ids sort in timestamp order as strings
+func FormatID(ts Timestamp, node uint32) string {
+	var data [12]byte
+	binary.BigEndian.PutUint64(data[:8], uint64(ts))
+	binary.BigEndian.PutUint32(data[8:], node)
+	return hex.EncodeToString(data[:])
+}
+
+// ParseID returns a timestamp and a node of a message id
+func ParseID(id string) (Timestamp, uint32, bool) {
+	if len(id) != IDLength {
+		return 0, 0, false
+	}
+	data, err := hex.DecodeString(id)
+	if err != nil || hex.EncodeToString(data) != id {
+		return 0, 0, false
+	}
+	return Timestamp(binary.BigEndian.Uint64(data[:8])), binary.BigEndian.Uint32(data[8:]), true
+}
+
+func nodeHash(node string) uint32 {
+	if node == "" {
+		var data [4]byte
+		rand.Read(data[:])
+		return binary.BigEndian.Uint32(data[:])
+	}
+	h := fnv.New32a()
+	h.Write([]byte(node))
+	return h.Sum32()
+}
+
+var (
+	defaultClock = NewClock("")
+	defaultLock  sync.RWMutex
+)
+
+// SetNode replaces the default clock with a clock of a named node,
+// without it the default clock has a random node
+func SetNode(node string) {
+	defaultLock.Lock()
+	defer defaultLock.Unlock()
+	clock := NewClock(node)
+	clock.last = defaultClock.Now()
+	defaultClock = clock
+}
+
+// Default returns the clock of the process
+func Default() *Clock {
+	defaultLock.RLock()
+	defer defaultLock.RUnlock()
+	return defaultClock
+}
+
+// NewID returns a message id of the default clock
+func NewID() string {
+	return Default().NewID()
+}
+
+// Observe advances the default clock past a message id received
+// from another node, invalid ids are ignored
+func Observe(id string) {
+	if ts, _, ok := ParseID(id); ok {
+		Default().Observe(ts)
+	}
+}
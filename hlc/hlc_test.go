@@ -0,0 +1,51 @@
+package hlc
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Clock(t *testing.T) {
+	now := time.Unix(1443308758, 0)
+	c := NewClock("a")
+	c.now = func() time.Time { return now }
+
+	first := c.Now()
+	assert.Equal(t, now, first.Time())
+	second := c.Now()
+	assert.Equal(t, first+1, second)
+
+	// A wall clock going back doesn't move timestamps back
+	now = now.Add(-time.Second)
+	assert.Equal(t, second+1, c.Now())
+
+	// Timestamps of other nodes are followed unless too far ahead
+	remote := Timestamp(now.Add(30*time.Second).UnixNano()/int64(time.Millisecond)) << logicalBits
+	c.Observe(remote)
+	assert.Equal(t, remote+1, c.Now())
+	c.Observe(remote + Timestamp(2*MaxDrift/time.Millisecond)<<logicalBits)
+	assert.Equal(t, remote+2, c.Now())
+}
+
+func Test_ID(t *testing.T) {
+	c := NewClock("a")
+	ids := []string{c.NewID(), c.NewID(), NewClock("b").NewID()}
+	assert.True(t, ids[0] < ids[1])
+	assert.NotEqual(t, ids[1][16:], ids[2][16:])
+
+	ts, node, ok := ParseID(ids[1])
+	assert.True(t, ok)
+	assert.Equal(t, c.node, node)
+	assert.Equal(t, ids[1], FormatID(ts, node))
+
+	for _, id := range []string{"", "abc", "0123456789ABCDEF01234567", "0123456789abcdef0123456g"} {
+		_, _, ok = ParseID(id)
+		assert.False(t, ok, id)
+	}
+
+	SetNode("b")
+	assert.Equal(t, NewClock("b").node, Default().node)
+	assert.True(t, NewID() > ids[1])
+}
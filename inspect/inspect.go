@@ -0,0 +1,140 @@
+// Package inspect renders queue item payloads in a human-readable form.
+//
+// Decoders are looked up by name, the built-in ones are:
+//
+//	raw       bytes as is, non-printable bytes escaped
+//	json      indented JSON
+//	gzip      gunzipped payload rendered by the auto decoder
+//	protobuf  protobuf wire format, field numbers only (see Protobuf)
+//	auto      gzip, JSON or text picked by payload content
+//
+// Other formats are plugged in with Register.
+package inspect
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"sync"
+	"unicode/utf8"
+)
+
+// Decoder renders a payload as text
+type Decoder interface {
+	Decode(value []byte) (string, error)
+}
+
+// DecoderFunc is a function used as Decoder
+type DecoderFunc func(value []byte) (string, error)
+
+// Decode calls f(value)
+func (f DecoderFunc) Decode(value []byte) (string, error) {
+	return f(value)
+}
+
+var (
+	decoders    = map[string]Decoder{}
+	decodersMux sync.RWMutex
+)
+
+func init() {
+	Register("raw", DecoderFunc(Raw))
+	Register("json", DecoderFunc(JSON))
+	Register("gzip", DecoderFunc(Gzip))
+	Register("protobuf", &Protobuf{})
+	Register("auto", DecoderFunc(Auto))
+}
+
+// Register makes a decoder available by name, a decoder
+// registered with the same name is replaced
+func Register(name string, d Decoder) {
+	decodersMux.Lock()
+	decoders[name] = d
+	decodersMux.Unlock()
+}
+
+// Lookup returns a decoder registered by name
+func Lookup(name string) (Decoder, bool) {
+	decodersMux.RLock()
+	defer decodersMux.RUnlock()
+	d, ok := decoders[name]
+	return d, ok
+}
+
+// Names returns names of registered decoders
+func Names() []string {
+	decodersMux.RLock()
+	defer decodersMux.RUnlock()
+	names := make([]string, 0, len(decoders))
+	for name := range decoders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Raw returns a payload as is, with non-printable bytes escaped
+func Raw(value []byte) (string, error) {
+	if printable(value) {
+		return string(value), nil
+	}
+	quoted := strconv.Quote(string(value))
+	return quoted[1 : len(quoted)-1], nil
+}
+
+// JSON indents a JSON payload
+func JSON(value []byte) (string, error) {
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, value, "", "  "); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// Gzip decompresses a payload and renders it with Auto
+func Gzip(value []byte) (string, error) {
+	r, err := gzip.NewReader(bytes.NewReader(value))
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return "", err
+	}
+	return Auto(data)
+}
+
+// Auto picks a decoder by payload content: gzip magic bytes,
+// valid JSON or text, other payloads are rendered by Raw
+func Auto(value []byte) (string, error) {
+	switch {
+	case len(value) > 2 && value[0] == 0x1f && value[1] == 0x8b:
+		if s, err := Gzip(value); err == nil {
+			return s, nil
+		}
+	case json.Valid(value):
+		return JSON(value)
+	}
+	return Raw(value)
+}
+
+// printable reports whether a payload is valid UTF-8 text
+func printable(value []byte) bool {
+	if !utf8.Valid(value) {
+		return false
+	}
+	for _, r := range string(value) {
+		if r < 0x20 && r != '\n' && r != '\r' && r != '\t' || r == 0x7f {
+			return false
+		}
+	}
+	return true
+}
+
+// errTruncated is returned for payloads ending in the middle of a field
+var errTruncated = fmt.Errorf("truncated payload")
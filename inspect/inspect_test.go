@@ -0,0 +1,111 @@
+package inspect
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Auto(t *testing.T) {
+	for value, expected := range map[string]string{
+		`{"id":1,"tags":["a"]}`: "{\n  \"id\": 1,\n  \"tags\": [\n    \"a\"\n  ]\n}",
+		"plain text":            "plain text",
+		"\x00\x01bin":           `\x00\x01bin`,
+	} {
+		text, err := Auto([]byte(value))
+		assert.Nil(t, err)
+		assert.Equal(t, expected, text)
+	}
+
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	w.Write([]byte(`{"id":1}`))
+	w.Close()
+	text, err := Auto(buf.Bytes())
+	assert.Nil(t, err)
+	assert.Equal(t, "{\n  \"id\": 1\n}", text)
+
+	_, err = JSON([]byte("{"))
+	assert.NotNil(t, err)
+	_, err = Gzip([]byte("plain"))
+	assert.NotNil(t, err)
+}
+
+func Test_Register(t *testing.T) {
+	Register("upper", DecoderFunc(func(value []byte) (string, error) {
+		return string(bytes.ToUpper(value)), nil
+	}))
+	d, ok := Lookup("upper")
+	assert.True(t, ok)
+	text, _ := d.Decode([]byte("abc"))
+	assert.Equal(t, "ABC", text)
+	assert.Equal(t, []string{"auto", "gzip", "json", "protobuf", "raw", "upper"}, Names())
+	_, ok = Lookup("xml")
+	assert.False(t, ok)
+}
+
+// pb appends a field in protobuf wire format, ints are varints
+// and byte slices or strings are length delimited
+func pb(b []byte, num int, value interface{}) []byte {
+	varint := func(b []byte, v uint64) []byte {
+		buf := make([]byte, binary.MaxVarintLen64)
+		return append(b, buf[:binary.PutUvarint(buf, v)]...)
+	}
+	switch v := value.(type) {
+	case int:
+		return varint(varint(b, uint64(num<<3)), uint64(v))
+	case string:
+		value = []byte(v)
+	}
+	data := value.([]byte)
+	b = varint(varint(b, uint64(num<<3|2)), uint64(len(data)))
+	return append(b, data...)
+}
+
+func Test_Protobuf(t *testing.T) {
+	// message Order { string id = 1; sint32 delta = 2; repeated int32 qty = 3; Customer customer = 4;
+	//   message Customer { string name = 1; } }
+	field := func(name string, num, kind int, typeName string) []byte {
+		f := pb(pb(pb(nil, 1, name), 3, num), 5, kind)
+		if typeName != "" {
+			f = pb(f, 6, typeName)
+		}
+		return f
+	}
+	customer := pb(pb(nil, 1, "Customer"), 2, field("name", 1, typeString, ""))
+	order := pb(nil, 1, "Order")
+	order = pb(order, 2, field("id", 1, typeString, ""))
+	order = pb(order, 2, field("delta", 2, typeSint32, ""))
+	order = pb(order, 2, field("qty", 3, typeInt32, ""))
+	order = pb(order, 2, field("customer", 4, typeMessage, ".shop.Order.Customer"))
+	order = pb(order, 3, customer)
+	set := pb(nil, 1, pb(pb(pb(nil, 1, "order.proto"), 2, "shop"), 4, order))
+
+	value := pb(nil, 1, "o-1")
+	value = pb(value, 2, 3)
+	value = pb(value, 3, []byte{5, 6})
+	value = pb(value, 4, pb(nil, 1, "Ann"))
+	value = pb(value, 9, 7)
+
+	p, err := NewProtobuf(set, "shop.Order")
+	assert.Nil(t, err)
+	text, err := p.Decode(value)
+	assert.Nil(t, err)
+	assert.Equal(t, "id: \"o-1\"\ndelta: -2\nqty: 5\nqty: 6\ncustomer {\n  name: \"Ann\"\n}\n9: 7", text)
+
+	// Without descriptors fields are shown by numbers
+	d, _ := Lookup("protobuf")
+	text, err = d.Decode(value)
+	assert.Nil(t, err)
+	assert.Equal(t, "1: \"o-1\"\n2: 3\n3: \"\\x05\\x06\"\n4 {\n  1: \"Ann\"\n}\n9: 7", text)
+
+	_, err = p.Decode(value[:len(value)-1])
+	assert.NotNil(t, err)
+	_, err = NewProtobuf(set, "shop.Invoice")
+	assert.Equal(t, "unknown message type \"shop.Invoice\"", err.Error())
+	_, err = NewProtobuf([]byte{0x0a, 0x05}, "shop.Order")
+	assert.NotNil(t, err)
+}
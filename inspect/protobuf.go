@@ -0,0 +1,336 @@
+package inspect
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Protobuf renders protobuf payloads in text format. Without descriptors
+// fields are shown by numbers like protoc --decode_raw does, with
+// a descriptor set and a message type fields get their names and types.
+type Protobuf struct {
+	// Message is a fully qualified name of a payload message type
+	Message  string
+	messages map[string]*messageType
+}
+
+type messageType struct {
+	name   string
+	fields map[uint64]*fieldType
+}
+
+type fieldType struct {
+	name     string
+	kind     uint64
+	typeName string
+}
+
+// Field types of FieldDescriptorProto
+const (
+	typeDouble   = 1
+	typeFloat    = 2
+	typeInt64    = 3
+	typeUint64   = 4
+	typeInt32    = 5
+	typeFixed64  = 6
+	typeFixed32  = 7
+	typeBool     = 8
+	typeString   = 9
+	typeGroup    = 10
+	typeMessage  = 11
+	typeBytes    = 12
+	typeUint32   = 13
+	typeEnum     = 14
+	typeSfixed32 = 15
+	typeSfixed64 = 16
+	typeSint32   = 17
+	typeSint64   = 18
+)
+
+// Wire types
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+// NewProtobuf creates a decoder of message payloads described
+// by a serialized FileDescriptorSet, e.g. an output of
+// protoc --include_imports --descriptor_set_out
+func NewProtobuf(descriptorSet []byte, message string) (*Protobuf, error) {
+	p := &Protobuf{Message: strings.TrimPrefix(message, "."), messages: map[string]*messageType{}}
+	err := eachField(descriptorSet, func(num, wire uint64, v uint64, data []byte) error {
+		if num == 1 && wire == wireBytes {
+			return p.addFile(data)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid descriptor set: %s", err.Error())
+	}
+	if _, ok := p.messages[p.Message]; !ok {
+		return nil, fmt.Errorf("unknown message type %q", message)
+	}
+	return p, nil
+}
+
+// Decode renders a payload in protobuf text format
+func (p *Protobuf) Decode(value []byte) (string, error) {
+	var b strings.Builder
+	if err := p.decode(&b, value, p.messages[p.Message], 0); err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(b.String(), "\n"), nil
+}
+
+// addFile adds message types of FileDescriptorProto
+func (p *Protobuf) addFile(data []byte) error {
+	var pkg string
+	var messages [][]byte
+	err := eachField(data, func(num, wire uint64, v uint64, data []byte) error {
+		switch {
+		case num == 2 && wire == wireBytes:
+			pkg = string(data)
+		case num == 4 && wire == wireBytes:
+			messages = append(messages, data)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, m := range messages {
+		if err = p.addMessage(pkg, m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addMessage adds DescriptorProto and its nested types
+func (p *Protobuf) addMessage(scope string, data []byte) error {
+	m := &messageType{fields: map[uint64]*fieldType{}}
+	var nested [][]byte
+	err := eachField(data, func(num, wire uint64, v uint64, data []byte) error {
+		if wire != wireBytes {
+			return nil
+		}
+		switch num {
+		case 1:
+			m.name = string(data)
+		case 2:
+			f, number, err := parseField(data)
+			if err != nil {
+				return err
+			}
+			m.fields[number] = f
+		case 3:
+			nested = append(nested, data)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if scope != "" {
+		m.name = scope + "." + m.name
+	}
+	p.messages[m.name] = m
+	for _, n := range nested {
+		if err = p.addMessage(m.name, n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseField parses FieldDescriptorProto
+func parseField(data []byte) (*fieldType, uint64, error) {
+	f := &fieldType{}
+	var number uint64
+	err := eachField(data, func(num, wire uint64, v uint64, data []byte) error {
+		switch {
+		case num == 1 && wire == wireBytes:
+			f.name = string(data)
+		case num == 3 && wire == wireVarint:
+			number = v
+		case num == 5 && wire == wireVarint:
+			f.kind = v
+		case num == 6 && wire == wireBytes:
+			f.typeName = strings.TrimPrefix(string(data), ".")
+		}
+		return nil
+	})
+	return f, number, err
+}
+
+type field struct {
+	num, wire, v uint64
+	data         []byte
+}
+
+func (p *Protobuf) decode(b *strings.Builder, value []byte, m *messageType, depth int) error {
+	fields := []field{}
+	err := eachField(value, func(num, wire uint64, v uint64, data []byte) error {
+		fields = append(fields, field{num, wire, v, data})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	indent := strings.Repeat("  ", depth)
+	for _, f := range fields {
+		var ft *fieldType
+		if m != nil {
+			ft = m.fields[f.num]
+		}
+		name := strconv.FormatUint(f.num, 10)
+		if ft != nil {
+			name = ft.name
+		}
+
+		if f.wire == wireBytes && ft != nil && packable(ft.kind) {
+			err = eachPacked(f.data, ft.kind, func(v uint64) {
+				fmt.Fprintf(b, "%s%s: %s\n", indent, name, scalar(ft.kind, v))
+			})
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		switch {
+		case f.wire != wireBytes && ft != nil:
+			fmt.Fprintf(b, "%s%s: %s\n", indent, name, scalar(ft.kind, f.v))
+		case f.wire == wireVarint:
+			fmt.Fprintf(b, "%s%s: %d\n", indent, name, f.v)
+		case f.wire == wireFixed64:
+			fmt.Fprintf(b, "%s%s: 0x%016x\n", indent, name, f.v)
+		case f.wire == wireFixed32:
+			fmt.Fprintf(b, "%s%s: 0x%08x\n", indent, name, f.v)
+		case ft != nil && ft.kind == typeMessage:
+			fmt.Fprintf(b, "%s%s {\n", indent, name)
+			if err = p.decode(b, f.data, p.messages[ft.typeName], depth+1); err != nil {
+				return err
+			}
+			fmt.Fprintf(b, "%s}\n", indent)
+		case ft != nil && (ft.kind == typeString || ft.kind == typeBytes):
+			fmt.Fprintf(b, "%s%s: %s\n", indent, name, strconv.Quote(string(f.data)))
+		default:
+			// Unknown length delimited fields are embedded messages
+			// when they parse as such, strings otherwise
+			var nested strings.Builder
+			if len(f.data) > 0 && !printable(f.data) && p.decode(&nested, f.data, nil, depth+1) == nil {
+				fmt.Fprintf(b, "%s%s {\n%s%s}\n", indent, name, nested.String(), indent)
+			} else {
+				fmt.Fprintf(b, "%s%s: %s\n", indent, name, strconv.Quote(string(f.data)))
+			}
+		}
+	}
+	return nil
+}
+
+// scalar formats a varint or fixed value of a field type
+func scalar(kind uint64, v uint64) string {
+	switch kind {
+	case typeDouble:
+		return strconv.FormatFloat(math.Float64frombits(v), 'g', -1, 64)
+	case typeFloat:
+		return strconv.FormatFloat(float64(math.Float32frombits(uint32(v))), 'g', -1, 32)
+	case typeInt64, typeSfixed64:
+		return strconv.FormatInt(int64(v), 10)
+	case typeInt32, typeSfixed32, typeEnum:
+		return strconv.FormatInt(int64(int32(v)), 10)
+	case typeBool:
+		return strconv.FormatBool(v != 0)
+	case typeSint32, typeSint64:
+		return strconv.FormatInt(int64(v>>1)^-int64(v&1), 10)
+	}
+	return strconv.FormatUint(v, 10)
+}
+
+func packable(kind uint64) bool {
+	switch kind {
+	case typeString, typeBytes, typeMessage, typeGroup:
+		return false
+	}
+	return true
+}
+
+// eachPacked calls fn for values of a packed repeated field
+func eachPacked(data []byte, kind uint64, fn func(v uint64)) error {
+	for len(data) > 0 {
+		var v uint64
+		switch kind {
+		case typeDouble, typeFixed64, typeSfixed64:
+			if len(data) < 8 {
+				return errTruncated
+			}
+			v, data = binary.LittleEndian.Uint64(data), data[8:]
+		case typeFloat, typeFixed32, typeSfixed32:
+			if len(data) < 4 {
+				return errTruncated
+			}
+			v, data = uint64(binary.LittleEndian.Uint32(data)), data[4:]
+		default:
+			n := 0
+			if v, n = binary.Uvarint(data); n <= 0 {
+				return errTruncated
+			}
+			data = data[n:]
+		}
+		fn(v)
+	}
+	return nil
+}
+
+// eachField calls fn for every field of a message in wire format,
+// v holds varint and fixed values, data holds length delimited ones
+func eachField(value []byte, fn func(num, wire uint64, v uint64, data []byte) error) error {
+	for len(value) > 0 {
+		key, n := binary.Uvarint(value)
+		if n <= 0 {
+			return errTruncated
+		}
+		value = value[n:]
+		num, wire := key>>3, key&7
+		if num == 0 {
+			return fmt.Errorf("invalid field number 0")
+		}
+		var v uint64
+		var data []byte
+		switch wire {
+		case wireVarint:
+			if v, n = binary.Uvarint(value); n <= 0 {
+				return errTruncated
+			}
+			value = value[n:]
+		case wireFixed64:
+			if len(value) < 8 {
+				return errTruncated
+			}
+			v, value = binary.LittleEndian.Uint64(value), value[8:]
+		case wireFixed32:
+			if len(value) < 4 {
+				return errTruncated
+			}
+			v, value = uint64(binary.LittleEndian.Uint32(value)), value[4:]
+		case wireBytes:
+			size, n := binary.Uvarint(value)
+			if n <= 0 || size > uint64(len(value)-n) {
+				return errTruncated
+			}
+			data, value = value[n:n+int(size)], value[n+int(size):]
+		default:
+			return fmt.Errorf("unsupported wire type %d", wire)
+		}
+		if err := fn(num, wire, v, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+// Package metrics implements lightweight histograms, moving rates
+// and Prometheus text format output
+package metrics
+
+import (
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// LatencyBuckets are upper bounds in seconds suitable for command latencies
+var LatencyBuckets = []float64{
+	.00005, .0001, .00025, .0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10,
+}
+
+// AgeBuckets are upper bounds in seconds suitable for time spent in a queue
+var AgeBuckets = []float64{
+	.001, .01, .1, 1, 5, 15, 30, 60, 300, 900, 1800, 3600, 7200, 21600, 43200, 86400, 259200, 604800,
+}
+
+// Histogram counts observed durations in fixed buckets
+type Histogram struct {
+	bounds []float64
+	counts []uint64
+	count  uint64
+	sum    int64
+}
+
+// NewHistogram creates a histogram with given bucket upper bounds in seconds
+func NewHistogram(bounds []float64) *Histogram {
+	return &Histogram{
+		bounds: bounds,
+		counts: make([]uint64, len(bounds)+1),
+	}
+}
+
+// Observe adds a duration to the histogram
+func (h *Histogram) Observe(d time.Duration) {
+	i := sort.SearchFloat64s(h.bounds, d.Seconds())
+	atomic.AddUint64(&h.counts[i], 1)
+	atomic.AddUint64(&h.count, 1)
+	atomic.AddInt64(&h.sum, int64(d))
+}
+
+// Count returns a total number of observations
+func (h *Histogram) Count() uint64 {
+	return atomic.LoadUint64(&h.count)
+}
+
+// Sum returns a sum of all observed durations
+func (h *Histogram) Sum() time.Duration {
+	return time.Duration(atomic.LoadInt64(&h.sum))
+}
+
+// Add adds observations of another histogram with the same bounds
+func (h *Histogram) Add(other *Histogram) {
+	for i := range h.counts {
+		atomic.AddUint64(&h.counts[i], atomic.LoadUint64(&other.counts[i]))
+	}
+	atomic.AddUint64(&h.count, other.Count())
+	atomic.AddInt64(&h.sum, int64(other.Sum()))
+}
+
+// Sub returns observations of h made since an earlier copy of it
+func (h *Histogram) Sub(earlier *Histogram) *Histogram {
+	d := NewHistogram(h.bounds)
+	for i := range h.counts {
+		now, before := atomic.LoadUint64(&h.counts[i]), atomic.LoadUint64(&earlier.counts[i])
+		if now > before {
+			d.counts[i] = now - before
+			d.count += now - before
+		}
+	}
+	if sum := h.Sum() - earlier.Sum(); sum > 0 {
+		d.sum = int64(sum)
+	}
+	return d
+}
+
+// Buckets returns bucket upper bounds and cumulative counts,
+// observations above the last bound are only included in Count
+func (h *Histogram) Buckets() ([]float64, []uint64) {
+	cumulative := make([]uint64, len(h.bounds))
+	var total uint64
+	for i := range h.bounds {
+		total += atomic.LoadUint64(&h.counts[i])
+		cumulative[i] = total
+	}
+	return h.bounds, cumulative
+}
+
+// Quantile estimates q-quantile (0 < q <= 1) by linear interpolation
+// within the bucket that contains it
+func (h *Histogram) Quantile(q float64) time.Duration {
+	counts := make([]uint64, len(h.counts))
+	var total uint64
+	for i := range h.counts {
+		counts[i] = atomic.LoadUint64(&h.counts[i])
+		total += counts[i]
+	}
+	if total == 0 {
+		return 0
+	}
+
+	rank := q * float64(total)
+	var seen float64
+	for i, count := range counts {
+		if count == 0 || seen+float64(count) < rank {
+			seen += float64(count)
+			continue
+		}
+		if i == len(h.bounds) {
+			return seconds(h.bounds[len(h.bounds)-1])
+		}
+		lower := 0.0
+		if i > 0 {
+			lower = h.bounds[i-1]
+		}
+		upper := h.bounds[i]
+		return seconds(lower + (upper-lower)*(rank-seen)/float64(count))
+	}
+	return seconds(h.bounds[len(h.bounds)-1])
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
@@ -0,0 +1,60 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_HistogramObserve(t *testing.T) {
+	h := NewHistogram([]float64{1, 2, 5})
+
+	h.Observe(500 * time.Millisecond)
+	h.Observe(time.Second)
+	h.Observe(1500 * time.Millisecond)
+	h.Observe(10 * time.Second)
+
+	assert.Equal(t, uint64(4), h.Count())
+	assert.Equal(t, 13*time.Second, h.Sum())
+
+	bounds, counts := h.Buckets()
+	assert.Equal(t, []float64{1, 2, 5}, bounds)
+	assert.Equal(t, []uint64{2, 3, 3}, counts)
+}
+
+func Test_HistogramQuantile(t *testing.T) {
+	h := NewHistogram([]float64{1, 2, 4})
+	assert.Equal(t, time.Duration(0), h.Quantile(0.5))
+
+	for i := 0; i < 50; i++ {
+		h.Observe(500 * time.Millisecond)
+	}
+	for i := 0; i < 50; i++ {
+		h.Observe(3 * time.Second)
+	}
+
+	assert.Equal(t, time.Second, h.Quantile(0.5))
+	assert.Equal(t, 3*time.Second, h.Quantile(0.75))
+	assert.Equal(t, 4*time.Second, h.Quantile(1))
+
+	h.Observe(time.Minute)
+	assert.Equal(t, 4*time.Second, h.Quantile(1))
+}
+
+func Test_HistogramAddSub(t *testing.T) {
+	h := NewHistogram([]float64{1, 2})
+	h.Observe(500 * time.Millisecond)
+
+	earlier := NewHistogram([]float64{1, 2})
+	earlier.Add(h)
+	assert.Equal(t, uint64(1), earlier.Count())
+
+	h.Observe(1500 * time.Millisecond)
+	h.Observe(1500 * time.Millisecond)
+	recent := h.Sub(earlier)
+	assert.Equal(t, uint64(2), recent.Count())
+	assert.Equal(t, 3*time.Second, recent.Sum())
+	_, counts := recent.Buckets()
+	assert.Equal(t, []uint64{0, 2}, counts)
+}
@@ -0,0 +1,65 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// PrometheusWriter writes metrics in Prometheus text exposition format.
+// All samples of a metric must be written one after another.
+type PrometheusWriter struct {
+	w    io.Writer
+	last string
+}
+
+// NewPrometheusWriter creates a writer
+func NewPrometheusWriter(w io.Writer) *PrometheusWriter {
+	return &PrometheusWriter{w: w}
+}
+
+// Counter writes a counter sample, labels are key, value pairs
+func (p *PrometheusWriter) Counter(name, help string, value float64, labels ...string) {
+	p.header(name, help, "counter")
+	p.sample(name, value, labels)
+}
+
+// Gauge writes a gauge sample, labels are key, value pairs
+func (p *PrometheusWriter) Gauge(name, help string, value float64, labels ...string) {
+	p.header(name, help, "gauge")
+	p.sample(name, value, labels)
+}
+
+// Histogram writes histogram buckets, sum and count in seconds
+func (p *PrometheusWriter) Histogram(name, help string, h *Histogram, labels ...string) {
+	p.header(name, help, "histogram")
+	bounds, counts := h.Buckets()
+	for i, bound := range bounds {
+		le := strconv.FormatFloat(bound, 'g', -1, 64)
+		p.sample(name+"_bucket", float64(counts[i]), append(labels, "le", le))
+	}
+	p.sample(name+"_bucket", float64(h.Count()), append(labels, "le", "+Inf"))
+	p.sample(name+"_sum", h.Sum().Seconds(), labels)
+	p.sample(name+"_count", float64(h.Count()), labels)
+}
+
+func (p *PrometheusWriter) header(name, help, metricType string) {
+	if p.last == name {
+		return
+	}
+	p.last = name
+	fmt.Fprintf(p.w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, metricType)
+}
+
+func (p *PrometheusWriter) sample(name string, value float64, labels []string) {
+	fmt.Fprint(p.w, name)
+	if len(labels) > 0 {
+		pairs := make([]string, 0, len(labels)/2)
+		for i := 0; i+1 < len(labels); i += 2 {
+			pairs = append(pairs, labels[i]+"="+strconv.Quote(labels[i+1]))
+		}
+		fmt.Fprintf(p.w, "{%s}", strings.Join(pairs, ","))
+	}
+	fmt.Fprintf(p.w, " %s\n", strconv.FormatFloat(value, 'g', -1, 64))
+}
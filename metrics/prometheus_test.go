@@ -0,0 +1,39 @@
+package metrics
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_PrometheusWriter(t *testing.T) {
+	var buf bytes.Buffer
+	p := NewPrometheusWriter(&buf)
+
+	p.Counter("siberite_cmd_get_total", "Get commands", 10)
+	p.Gauge("siberite_queue_items", "Items", 3, "queue", "a")
+	p.Gauge("siberite_queue_items", "Items", 5, "queue", "b")
+
+	h := NewHistogram([]float64{0.5, 1})
+	h.Observe(250 * time.Millisecond)
+	h.Observe(2 * time.Second)
+	p.Histogram("siberite_latency_seconds", "Latency", h, "command", "get")
+
+	expected := "# HELP siberite_cmd_get_total Get commands\n" +
+		"# TYPE siberite_cmd_get_total counter\n" +
+		"siberite_cmd_get_total 10\n" +
+		"# HELP siberite_queue_items Items\n" +
+		"# TYPE siberite_queue_items gauge\n" +
+		"siberite_queue_items{queue=\"a\"} 3\n" +
+		"siberite_queue_items{queue=\"b\"} 5\n" +
+		"# HELP siberite_latency_seconds Latency\n" +
+		"# TYPE siberite_latency_seconds histogram\n" +
+		"siberite_latency_seconds_bucket{command=\"get\",le=\"0.5\"} 1\n" +
+		"siberite_latency_seconds_bucket{command=\"get\",le=\"1\"} 1\n" +
+		"siberite_latency_seconds_bucket{command=\"get\",le=\"+Inf\"} 2\n" +
+		"siberite_latency_seconds_sum{command=\"get\"} 2.25\n" +
+		"siberite_latency_seconds_count{command=\"get\"} 2\n"
+	assert.Equal(t, expected, buf.String())
+}
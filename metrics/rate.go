@@ -0,0 +1,71 @@
+package metrics
+
+import (
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// RateInterval is how often moving averages of a Rate are updated
+const RateInterval = 5 * time.Second
+
+// RateWindows are averaging windows of a Rate, as in Unix load averages
+var RateWindows = []time.Duration{time.Minute, 5 * time.Minute, 15 * time.Minute}
+
+// Rate keeps exponentially weighted moving averages of events per second
+// over RateWindows, averages are updated lazily every RateInterval
+type Rate struct {
+	uncounted int64
+	// lastTick is unix nanoseconds of the last averages update
+	lastTick int64
+	rates    []float64
+	sync.Mutex
+}
+
+// NewRate creates a rate with all averages at zero
+func NewRate() *Rate {
+	return &Rate{lastTick: time.Now().UnixNano(), rates: make([]float64, len(RateWindows))}
+}
+
+// Mark counts n events
+func (r *Rate) Mark(n int64) {
+	r.tick(time.Now())
+	atomic.AddInt64(&r.uncounted, n)
+}
+
+// Rates returns per second averages over RateWindows
+func (r *Rate) Rates() []float64 {
+	return r.RatesAt(time.Now())
+}
+
+// RatesAt returns per second averages over RateWindows updated up to now
+func (r *Rate) RatesAt(now time.Time) []float64 {
+	r.tick(now)
+	r.Lock()
+	defer r.Unlock()
+	return append([]float64{}, r.rates...)
+}
+
+// tick updates averages for every interval elapsed since the last update,
+// events counted in between belong to the first of them
+func (r *Rate) tick(now time.Time) {
+	if now.UnixNano()-atomic.LoadInt64(&r.lastTick) < int64(RateInterval) {
+		return
+	}
+	r.Lock()
+	defer r.Unlock()
+	last := atomic.LoadInt64(&r.lastTick)
+	ticks := (now.UnixNano() - last) / int64(RateInterval)
+	if ticks <= 0 {
+		return
+	}
+	atomic.StoreInt64(&r.lastTick, last+ticks*int64(RateInterval))
+	current := float64(atomic.SwapInt64(&r.uncounted, 0)) / RateInterval.Seconds()
+	for i, window := range RateWindows {
+		decay := math.Exp(-RateInterval.Seconds() / window.Seconds())
+		r.rates[i] = current + decay*(r.rates[i]-current)
+		// Intervals without events only decay the average
+		r.rates[i] *= math.Pow(decay, float64(ticks-1))
+	}
+}
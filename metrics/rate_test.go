@@ -0,0 +1,38 @@
+package metrics
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Rate(t *testing.T) {
+	r := NewRate()
+	start := time.Unix(0, r.lastTick)
+	assert.Equal(t, []float64{0, 0, 0}, r.RatesAt(start))
+
+	r.Mark(50)
+	rates := r.RatesAt(start.Add(RateInterval))
+	for i, window := range RateWindows {
+		alpha := 1 - math.Exp(-RateInterval.Seconds()/window.Seconds())
+		assert.InDelta(t, alpha*10, rates[i], 1e-9)
+	}
+	assert.True(t, rates[0] > rates[1] && rates[1] > rates[2])
+
+	// Steady 10 events per second converge to 10
+	now := start.Add(RateInterval)
+	for i := 0; i < 720; i++ {
+		r.Mark(50)
+		now = now.Add(RateInterval)
+		rates = r.RatesAt(now)
+	}
+	assert.InDelta(t, 10, rates[0], 0.01)
+	assert.InDelta(t, 10*(1-math.Exp(-4)), rates[2], 0.01)
+
+	// Idle intervals decay averages at once
+	idle := r.RatesAt(now.Add(15 * time.Minute))
+	assert.InDelta(t, rates[0]*math.Exp(-15), idle[0], 1e-9)
+	assert.InDelta(t, rates[2]*math.Exp(-1), idle[2], 1e-9)
+}
@@ -0,0 +1,153 @@
+// Package objectstore uploads objects to S3 compatible storage.
+//
+// Requests are signed with AWS Signature Version 4 and sent path-style
+// (<endpoint>/<bucket>/<key>), which AWS S3, MinIO, Ceph and most other
+// S3 compatible stores accept.
+package objectstore
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// S3 is a client of a bucket
+type S3 struct {
+	endpoint  string
+	region    string
+	bucket    string
+	accessKey string
+	secretKey string
+	client    *http.Client
+	// now is replaced in tests
+	now func() time.Time
+}
+
+// NewS3 creates a client of a bucket at an endpoint, e.g. https://s3.us-east-1.amazonaws.com
+func NewS3(endpoint string, region string, bucket string, accessKey string, secretKey string) *S3 {
+	return &S3{
+		endpoint:  strings.TrimRight(endpoint, "/"),
+		region:    region,
+		bucket:    bucket,
+		accessKey: accessKey,
+		secretKey: secretKey,
+		client:    &http.Client{Timeout: 5 * time.Minute},
+		now:       time.Now,
+	}
+}
+
+// Put stores an object under a key
+func (s *S3) Put(key string, body []byte, contentType string) error {
+	resp, err := s.do("PUT", key, body, contentType)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// Get returns a body of an object, it must be closed
+func (s *S3) Get(key string) (io.ReadCloser, error) {
+	resp, err := s.do("GET", key, nil, "")
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// Delete removes an object
+func (s *S3) Delete(key string) error {
+	resp, err := s.do("DELETE", key, nil, "")
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// do sends a signed request for an object, responses other
+// than 200 OK and 204 No Content are returned as errors
+func (s *S3) do(method string, key string, body []byte, contentType string) (*http.Response, error) {
+	u, err := url.Parse(s.endpoint + "/" + s.bucket + "/" + escapePath(key))
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	s.sign(req, body)
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+		message, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s %s responded %s: %s", method, key, resp.Status, strings.TrimSpace(string(message)))
+	}
+	return resp, nil
+}
+
+// sign adds Signature Version 4 authorization headers to a request
+func (s *S3) sign(req *http.Request, body []byte) {
+	now := s.now().UTC()
+	date := now.Format("20060102")
+	timestamp := now.Format("20060102T150405Z")
+	payloadHash := hashHex(body)
+	req.Header.Set("X-Amz-Date", timestamp)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	signedHeaders := "content-type;host;x-amz-content-sha256;x-amz-date"
+	canonical := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		"content-type:" + req.Header.Get("Content-Type"),
+		"host:" + req.URL.Host,
+		"x-amz-content-sha256:" + payloadHash,
+		"x-amz-date:" + timestamp,
+		"",
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := date + "/" + s.region + "/s3/aws4_request"
+	toSign := "AWS4-HMAC-SHA256\n" + timestamp + "\n" + scope + "\n" + hashHex([]byte(canonical))
+
+	key := hmacSHA256([]byte("AWS4"+s.secretKey), date)
+	key = hmacSHA256(key, s.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, toSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.accessKey, scope, signedHeaders, signature))
+}
+
+// escapePath escapes key segments as required by S3 canonical requests
+func escapePath(key string) string {
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		segments[i] = strings.Replace(url.PathEscape(segment), "+", "%2B", -1)
+	}
+	return strings.Join(segments, "/")
+}
+
+func hashHex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
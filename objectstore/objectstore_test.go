@@ -0,0 +1,74 @@
+package objectstore
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Put(t *testing.T) {
+	var received *http.Request
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r
+		body, _ = ioutil.ReadAll(r.Body)
+	}))
+	defer server.Close()
+
+	s := NewS3(server.URL+"/", "eu-west-1", "archive", "AKID", "secret")
+	s.now = func() time.Time { return time.Date(2015, 9, 26, 12, 0, 0, 0, time.UTC) }
+	assert.Nil(t, s.Put("siberite/work/1 2.gz", []byte("data"), "application/gzip"))
+
+	assert.Equal(t, "/archive/siberite/work/1%202.gz", received.URL.EscapedPath())
+	assert.Equal(t, "data", string(body))
+	assert.Equal(t, "20150926T120000Z", received.Header.Get("X-Amz-Date"))
+	assert.Equal(t, "3a6eb0790f39ac87c94f3856b2dd2c5d110e6811602261a9a923d3bb23adc8b7", received.Header.Get("X-Amz-Content-Sha256"))
+	auth := received.Header.Get("Authorization")
+	assert.True(t, strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKID/20150926/eu-west-1/s3/aws4_request, "+
+		"SignedHeaders=content-type;host;x-amz-content-sha256;x-amz-date, Signature="), auth)
+}
+
+func Test_Put_Error(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte("<Error><Code>AccessDenied</Code></Error>"))
+	}))
+	defer server.Close()
+
+	s := NewS3(server.URL, "us-east-1", "archive", "AKID", "secret")
+	err := s.Put("key", []byte("data"), "application/gzip")
+	assert.EqualError(t, err, "PUT key responded 403 Forbidden: <Error><Code>AccessDenied</Code></Error>")
+}
+
+func Test_GetDelete(t *testing.T) {
+	objects := map[string]string{"/archive/key": "data"}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		value, ok := objects[r.URL.Path]
+		switch {
+		case !ok:
+			http.NotFound(w, r)
+		case r.Method == "GET":
+			w.Write([]byte(value))
+		case r.Method == "DELETE":
+			delete(objects, r.URL.Path)
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer server.Close()
+
+	s := NewS3(server.URL, "us-east-1", "archive", "AKID", "secret")
+	body, err := s.Get("key")
+	assert.Nil(t, err)
+	data, _ := ioutil.ReadAll(body)
+	body.Close()
+	assert.Equal(t, "data", string(data))
+
+	assert.Nil(t, s.Delete("key"))
+	_, err = s.Get("key")
+	assert.NotNil(t, err)
+}
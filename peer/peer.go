@@ -0,0 +1,122 @@
+// Package peer connects a server to other servers for replication,
+// bootstrap, shadowing, migration and routing with TLS and credentials
+// of peer settings, so peers may require authentication like clients.
+package peer
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/bogdanovich/siberite/config"
+)
+
+// maxReply limits a response line read while authenticating
+const maxReply = 1024
+
+// Dialer opens authenticated connections to peers,
+// a nil Dialer opens plain TCP connections
+type Dialer struct {
+	tls      *tls.Config
+	user     string
+	password string
+}
+
+// NewDialer loads certificates of peer settings, nil settings give a nil Dialer
+func NewDialer(cfg *config.PeerConfig) (*Dialer, error) {
+	if cfg == nil {
+		return nil, nil
+	}
+	d := &Dialer{user: cfg.User, password: cfg.Password}
+	if !cfg.TLS {
+		return d, nil
+	}
+	d.tls = &tls.Config{MinVersion: tls.VersionTLS12}
+	if cfg.CA != "" {
+		pem, err := ioutil.ReadFile(cfg.CA)
+		if err != nil {
+			return nil, fmt.Errorf("error loading peer ca: %s", err.Error())
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New("error loading peer ca: no certificates found")
+		}
+		d.tls.RootCAs = pool
+	}
+	if cfg.Cert != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.Cert, cfg.Key)
+		if err != nil {
+			return nil, fmt.Errorf("error loading peer certificate: %s", err.Error())
+		}
+		d.tls.Certificates = []tls.Certificate{cert}
+	}
+	return d, nil
+}
+
+// Dial connects to a peer and authenticates with AUTH command
+// if a password is set, timeout limits both
+func (d *Dialer) Dial(addr string, timeout time.Duration) (net.Conn, error) {
+	if d == nil {
+		return net.DialTimeout("tcp", addr, timeout)
+	}
+	var conn net.Conn
+	var err error
+	if d.tls != nil {
+		conn, err = tls.DialWithDialer(&net.Dialer{Timeout: timeout}, "tcp", addr, d.tls)
+	} else {
+		conn, err = net.DialTimeout("tcp", addr, timeout)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if d.password == "" {
+		return conn, nil
+	}
+	conn.SetDeadline(time.Now().Add(timeout))
+	if err = d.authenticate(conn); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("can't authenticate with %s: %s", addr, err.Error())
+	}
+	conn.SetDeadline(time.Time{})
+	return conn, nil
+}
+
+func (d *Dialer) authenticate(conn net.Conn) error {
+	command := "auth " + d.password + "\r\n"
+	if d.user != "" {
+		command = "auth " + d.user + " " + d.password + "\r\n"
+	}
+	if _, err := conn.Write([]byte(command)); err != nil {
+		return err
+	}
+	reply, err := readLine(conn)
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(reply, "AUTHENTICATED") {
+		return errors.New(reply)
+	}
+	return nil
+}
+
+// readLine reads a response line byte by byte, so nothing
+// past it is consumed before the caller buffers the connection
+func readLine(conn net.Conn) (string, error) {
+	line := make([]byte, 0, 64)
+	b := make([]byte, 1)
+	for len(line) < maxReply {
+		if _, err := conn.Read(b); err != nil {
+			return "", err
+		}
+		if b[0] == '\n' {
+			return strings.TrimRight(string(line), "\r"), nil
+		}
+		line = append(line, b[0])
+	}
+	return "", errors.New("response line is too long")
+}
@@ -0,0 +1,77 @@
+package peer
+
+import (
+	"bufio"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/bogdanovich/siberite/config"
+	"github.com/stretchr/testify/assert"
+)
+
+// serve answers the first command line of every connection with reply
+func serve(t *testing.T, reply string) (net.Listener, chan string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	commands := make(chan string, 1)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			line, _ := bufio.NewReader(conn).ReadString('\n')
+			commands <- line
+			conn.Write([]byte(reply))
+			conn.Close()
+		}
+	}()
+	return listener, commands
+}
+
+func Test_Dial(t *testing.T) {
+	listener, commands := serve(t, "AUTHENTICATED replica\r\n")
+	defer listener.Close()
+
+	d, err := NewDialer(&config.PeerConfig{User: "replica", Password: "s3cret"})
+	assert.Nil(t, err)
+	conn, err := d.Dial(listener.Addr().String(), time.Second)
+	assert.Nil(t, err)
+	conn.Close()
+	assert.Equal(t, "auth replica s3cret\r\n", <-commands)
+
+	d, _ = NewDialer(&config.PeerConfig{Password: "s3cret"})
+	conn, err = d.Dial(listener.Addr().String(), time.Second)
+	assert.Nil(t, err)
+	conn.Close()
+	assert.Equal(t, "auth s3cret\r\n", <-commands)
+}
+
+func Test_Dial_Rejected(t *testing.T) {
+	listener, _ := serve(t, "CLIENT_ERROR Invalid credentials\r\n")
+	defer listener.Close()
+
+	d, _ := NewDialer(&config.PeerConfig{Password: "wrong"})
+	_, err := d.Dial(listener.Addr().String(), time.Second)
+	assert.EqualError(t, err, "can't authenticate with "+listener.Addr().String()+": CLIENT_ERROR Invalid credentials")
+}
+
+func Test_Dial_Plain(t *testing.T) {
+	listener, _ := serve(t, "")
+	defer listener.Close()
+
+	var d *Dialer
+	conn, err := d.Dial(listener.Addr().String(), time.Second)
+	assert.Nil(t, err)
+	conn.Close()
+
+	d, err = NewDialer(nil)
+	assert.Nil(t, err)
+	assert.Nil(t, d)
+}
+
+func Test_NewDialer_Invalid(t *testing.T) {
+	_, err := NewDialer(&config.PeerConfig{TLS: true, CA: "./test_data/missing.pem"})
+	assert.Contains(t, err.Error(), "error loading peer ca")
+}
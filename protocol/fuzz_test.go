@@ -0,0 +1,72 @@
+package protocol
+
+import (
+	"strings"
+	"testing"
+)
+
+// FuzzParseGet checks that any GET argument parses to a request
+// that keeps its meaning in the canonical form
+func FuzzParseGet(f *testing.F) {
+	for _, arg := range []string{
+		"work", "work/open", "work/close/open/t=10", "work/peek/i=3", "work/peek/i=x",
+		"work/open/move=work_wip/meta/ts/deliveries/msgid", "work/open/id", "/open", "", "/",
+		"work//t=/i=/move=", "work/t=99999999999", "work/i=99999999999999999999",
+	} {
+		f.Add(arg)
+	}
+	f.Fuzz(func(t *testing.T, arg string) {
+		r := ParseGet(arg)
+		if strings.Contains(r.Queue, "/") {
+			t.Fatalf("queue name %q of %q has options", r.Queue, arg)
+		}
+		canonical := r.String()
+		if again := ParseGet(canonical); *again != *r {
+			t.Fatalf("%q parsed as %+v, its canonical form %q as %+v", arg, r, canonical, again)
+		}
+	})
+}
+
+// FuzzParseSet checks SET arguments the same way
+func FuzzParseSet(f *testing.F) {
+	for _, arg := range []string{
+		"work", "work/ttl=10", "work/dedup=a", "work/ttl=10/dedup=a/ttl=", "work/ttl=0",
+		"work/dedup=", "/ttl=1", "",
+	} {
+		f.Add(arg)
+	}
+	f.Fuzz(func(t *testing.T, arg string) {
+		r, err := ParseSet(arg)
+		if err != nil {
+			return
+		}
+		canonical := r.String()
+		again, err := ParseSet(canonical)
+		if err != nil || *again != *r {
+			t.Fatalf("%q parsed as %+v, its canonical form %q as %+v (%v)", arg, r, canonical, again, err)
+		}
+	})
+}
+
+// FuzzParseHeaders checks that SETMETA headers are parsed within limits
+func FuzzParseHeaders(f *testing.F) {
+	for _, line := range []string{"a=1 b=2", "a", "=1", "a==", "a=1  b=2"} {
+		f.Add(line)
+	}
+	f.Fuzz(func(t *testing.T, line string) {
+		headers, err := ParseHeaders(strings.Fields(line))
+		if err != nil {
+			return
+		}
+		size := 0
+		for _, header := range headers {
+			if header.Key == "" || strings.Contains(header.Key, "=") {
+				t.Fatalf("invalid header key %q of %q", header.Key, line)
+			}
+			size += len(header.Key) + 1 + len(header.Value)
+		}
+		if len(headers) > MaxHeaders || size > MaxHeadersSize {
+			t.Fatalf("headers of %q are over limits", line)
+		}
+	})
+}
@@ -0,0 +1,118 @@
+package protocol
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// GetRequest is a parsed argument of GET, see get-arg
+type GetRequest struct {
+	Queue string
+	// SubCommand are sub-command tokens joined with "/", empty for a plain GET
+	SubCommand string
+	// Meta adds item headers to VALUE lines, /meta
+	Meta bool
+	// Timestamp adds enqueue time to VALUE lines, /ts
+	Timestamp bool
+	// Deliveries adds a number of times an item was opened, /deliveries
+	Deliveries bool
+	// MessageID adds a message id to VALUE lines, /msgid
+	MessageID bool
+	// ByID opens an item in addition to open items, /open/id
+	ByID bool
+	// Timeout is an abort delay, /t=<milliseconds>, the last one counts
+	Timeout time.Duration
+	// Index is a peek position, /i=<n>
+	Index uint64
+	// MoveTo is a processing queue, /move=<queue> adds a "move" sub-command
+	MoveTo string
+}
+
+// ParseGet parses an argument of GET
+func ParseGet(arg string) *GetRequest {
+	r := &GetRequest{Queue: arg}
+	i := strings.Index(arg, "/")
+	if i < 0 {
+		return r
+	}
+	r.Queue = arg[:i]
+	subCommand := []string{}
+	for _, token := range strings.Split(strings.Trim(arg[i+1:], "/"), "/") {
+		switch {
+		case token == "meta":
+			r.Meta = true
+		case token == "ts":
+			r.Timestamp = true
+		case token == "deliveries":
+			r.Deliveries = true
+		case token == "msgid":
+			r.MessageID = true
+		case token == "id":
+			r.ByID = true
+		case strings.HasPrefix(token, "move="):
+			r.MoveTo = token[len("move="):]
+			subCommand = append(subCommand, "move")
+		case strings.HasPrefix(token, "t=") && digits(token[2:]):
+			// Delays over 32 bits are ignored
+			if ms, err := strconv.ParseUint(token[2:], 10, 32); err == nil {
+				r.Timeout = time.Duration(ms) * time.Millisecond
+			}
+		case strings.HasPrefix(token, "i=") && digits(token[2:]):
+			index, err := strconv.ParseUint(token[2:], 10, 64)
+			if err != nil {
+				subCommand = append(subCommand, token)
+			} else {
+				r.Index = index
+			}
+		case token == "":
+		default:
+			subCommand = append(subCommand, token)
+		}
+	}
+	r.SubCommand = strings.Join(subCommand, "/")
+	return r
+}
+
+// String returns the request in a canonical form, sub-commands
+// followed by options, ParseGet returns the same request for it
+func (r *GetRequest) String() string {
+	arg := []string{r.Queue}
+	if r.SubCommand != "" {
+		for _, token := range strings.Split(r.SubCommand, "/") {
+			if token == "move" {
+				token += "=" + r.MoveTo
+			}
+			arg = append(arg, token)
+		}
+	}
+	for _, option := range []struct {
+		set   bool
+		token string
+	}{
+		{r.Meta, "meta"},
+		{r.Timestamp, "ts"},
+		{r.Deliveries, "deliveries"},
+		{r.MessageID, "msgid"},
+		{r.ByID, "id"},
+		{r.Timeout > 0, "t=" + strconv.FormatInt(int64(r.Timeout/time.Millisecond), 10)},
+		{r.Index > 0, "i=" + strconv.FormatUint(r.Index, 10)},
+	} {
+		if option.set {
+			arg = append(arg, option.token)
+		}
+	}
+	return strings.Join(arg, "/")
+}
+
+func digits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,68 @@
+package protocol
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ParseGet(t *testing.T) {
+	testCases := map[string]GetRequest{
+		"work":                             {Queue: "work"},
+		"work/":                            {Queue: "work"},
+		"work//open":                       {Queue: "work", SubCommand: "open"},
+		"work/close/t=10/open/abort":       {Queue: "work", SubCommand: "close/open/abort", Timeout: 10 * time.Millisecond},
+		"work/t=10/t=100/t=1234567890":     {Queue: "work", Timeout: 1234567890 * time.Millisecond},
+		"work/abort/t=4294967296":          {Queue: "work", SubCommand: "abort"},
+		"work/abort/t=5s":                  {Queue: "work", SubCommand: "abort/t=5s"},
+		"work/peek/i=3":                    {Queue: "work", SubCommand: "peek", Index: 3},
+		"work/peek/i=x":                    {Queue: "work", SubCommand: "peek/i=x"},
+		"work/peek/i=":                     {Queue: "work", SubCommand: "peek/i="},
+		"work/peek/i=99999999999999999999": {Queue: "work", SubCommand: "peek/i=99999999999999999999"},
+		"work/open/move=work_wip/meta":     {Queue: "work", SubCommand: "open/move", MoveTo: "work_wip", Meta: true},
+		"work/open/id/ts/deliveries/msgid": {Queue: "work", SubCommand: "open", ByID: true, Timestamp: true, Deliveries: true, MessageID: true},
+		"jobst=5/open":                     {Queue: "jobst=5", SubCommand: "open"},
+		"/open":                            {Queue: "", SubCommand: "open"},
+		"":                                 {Queue: ""},
+	}
+	for input, expected := range testCases {
+		assert.Equal(t, expected, *ParseGet(input), input)
+	}
+}
+
+// Test_GetRequestString checks that every combination of options
+// is parsed back from its canonical form
+func Test_GetRequestString(t *testing.T) {
+	subCommands := []string{"", "open", "close/open", "abort", "peek", "peek_tail", "open/move", "unknown"}
+	timeouts := []time.Duration{0, time.Millisecond, 5 * time.Second}
+	indexes := []uint64{0, 1, 1 << 40}
+	count := 0
+	for _, subCommand := range subCommands {
+		for flags := 0; flags < 1<<5; flags++ {
+			for _, timeout := range timeouts {
+				for _, index := range indexes {
+					r := GetRequest{
+						Queue:      "work",
+						SubCommand: subCommand,
+						Meta:       flags&1 != 0,
+						Timestamp:  flags&2 != 0,
+						Deliveries: flags&4 != 0,
+						MessageID:  flags&8 != 0,
+						ByID:       flags&16 != 0,
+						Timeout:    timeout,
+						Index:      index,
+					}
+					if strings.Contains(subCommand, "move") {
+						r.MoveTo = "work_wip"
+					}
+					assert.Equal(t, r, *ParseGet(r.String()), r.String())
+					count++
+				}
+			}
+		}
+	}
+	assert.Equal(t, len(subCommands)*32*len(timeouts)*len(indexes), count)
+	assert.Equal(t, "work/close/open/meta/t=10", (&GetRequest{Queue: "work", SubCommand: "close/open", Meta: true, Timeout: 10 * time.Millisecond}).String())
+}
@@ -0,0 +1,50 @@
+// Package protocol parses arguments of siberite commands, an extension
+// of the memcache text protocol of kestrel. The server, the router and
+// clients share it, so a command means the same thing to all of them.
+//
+// The grammar of the arguments parsed here, in ABNF (RFC 5234):
+//
+//	get-arg    = queue *("/" get-option)
+//	get-option = "meta" / "ts" / "deliveries" / "msgid" / "id"
+//	           / "t=" 1*DIGIT          ; abort delay in milliseconds
+//	           / "i=" 1*DIGIT          ; peek position
+//	           / "move=" queue         ; processing queue
+//	           / sub-command
+//	sub-command = "open" / "close" / "abort" / "abort_tail" / "peek" / "peek_tail" / token
+//
+//	set-arg    = queue ["/ttl=" 1*DIGIT] ["/dedup=" 1*250VCHAR]
+//	headers    = header *(SP header)   ; SETMETA arguments after <bytes>
+//	header     = key "=" value
+//	key        = 1*(VCHAR except "=")
+//	value      = *VCHAR
+//
+//	queue      = 1*(VCHAR except "/")
+//	token      = *(VCHAR except "/")
+//
+// Options of get-arg may come in any order. Sub-commands are kept in
+// their order joined with "/", e.g. get work/close/t=10/open is the
+// sub-command close/open with t=10. Empty options, e.g. of work//open,
+// are skipped. Malformed t= and i= options are sub-commands, so servers
+// reject them as unknown. Queue names are not validated here, servers
+// check them against their queue name rules.
+package protocol
+
+import "errors"
+
+// Errors of SET arguments and headers, servers answer them
+// with ERROR <message>
+var (
+	ErrInvalidTTL      = errors.New("Invalid ttl")
+	ErrInvalidDedupKey = errors.New("Invalid dedup key")
+	ErrTooManyHeaders  = errors.New("Too many headers")
+	ErrHeadersTooLarge = errors.New("Headers are too large")
+)
+
+// InvalidHeaderError is returned for a header token without a key
+type InvalidHeaderError struct {
+	Token string
+}
+
+func (e *InvalidHeaderError) Error() string {
+	return "Invalid header " + e.Token
+}
@@ -0,0 +1,104 @@
+package protocol
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Limits of SET arguments
+const (
+	MaxHeaders     = 32
+	MaxHeadersSize = 4096
+	MaxDedupKey    = 250
+
+	// MaxRelativeExptime is the largest <exptime> counted in seconds
+	// from now, larger values are absolute Unix timestamps as in memcached
+	MaxRelativeExptime = 30 * 24 * 60 * 60
+)
+
+// Header is a key=value pair attached to an item
+type Header struct {
+	Key   string
+	Value string
+}
+
+// SetRequest is a parsed queue argument of SET, see set-arg
+type SetRequest struct {
+	Queue string
+	// TTL is a time to live, /ttl=<milliseconds>, it takes precedence over <exptime>
+	TTL time.Duration
+	// DedupKey is an idempotency key, /dedup=<key>
+	DedupKey string
+}
+
+// ParseSet parses a queue argument of SET and SETMETA
+func ParseSet(arg string) (*SetRequest, error) {
+	r := &SetRequest{Queue: arg}
+	if i := strings.Index(r.Queue, "/dedup="); i >= 0 {
+		r.DedupKey = r.Queue[i+len("/dedup="):]
+		if r.DedupKey == "" || len(r.DedupKey) > MaxDedupKey {
+			return nil, ErrInvalidDedupKey
+		}
+		r.Queue = r.Queue[:i]
+	}
+	if i := strings.Index(r.Queue, "/ttl="); i >= 0 {
+		ms, err := strconv.ParseUint(r.Queue[i+len("/ttl="):], 10, 32)
+		if err != nil || ms == 0 {
+			return nil, ErrInvalidTTL
+		}
+		r.TTL = time.Duration(ms) * time.Millisecond
+		r.Queue = r.Queue[:i]
+	}
+	return r, nil
+}
+
+// String returns the argument in a canonical form
+func (r *SetRequest) String() string {
+	arg := r.Queue
+	if r.TTL > 0 {
+		arg += "/ttl=" + strconv.FormatInt(int64(r.TTL/time.Millisecond), 10)
+	}
+	if r.DedupKey != "" {
+		arg += "/dedup=" + r.DedupKey
+	}
+	return arg
+}
+
+// ParseHeaders parses key=value tokens of SETMETA
+func ParseHeaders(tokens []string) ([]Header, error) {
+	if len(tokens) > MaxHeaders {
+		return nil, ErrTooManyHeaders
+	}
+	headers := make([]Header, 0, len(tokens))
+	size := 0
+	for _, token := range tokens {
+		pair := strings.SplitN(token, "=", 2)
+		if len(pair) != 2 || pair[0] == "" {
+			return nil, &InvalidHeaderError{token}
+		}
+		size += len(token)
+		headers = append(headers, Header{Key: pair[0], Value: pair[1]})
+	}
+	if size > MaxHeadersSize {
+		return nil, ErrHeadersTooLarge
+	}
+	return headers, nil
+}
+
+// ExpiresAt returns an item expiration time following memcached
+// <exptime> semantics, negative <exptime> expires the item immediately
+func ExpiresAt(exptime int64, ttl time.Duration, now time.Time) time.Time {
+	switch {
+	case ttl > 0:
+		return now.Add(ttl)
+	case exptime == 0:
+		return time.Time{}
+	case exptime < 0:
+		return now
+	case exptime <= MaxRelativeExptime:
+		return now.Add(time.Duration(exptime) * time.Second)
+	default:
+		return time.Unix(exptime, 0)
+	}
+}
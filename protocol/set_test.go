@@ -0,0 +1,76 @@
+package protocol
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ParseSet(t *testing.T) {
+	testCases := map[string]SetRequest{
+		"work":                     {Queue: "work"},
+		"work/ttl=1500":            {Queue: "work", TTL: 1500 * time.Millisecond},
+		"work/dedup=order-1":       {Queue: "work", DedupKey: "order-1"},
+		"work/ttl=10/dedup=a/ttl=": {Queue: "work", TTL: 10 * time.Millisecond, DedupKey: "a/ttl="},
+		"work#2/ttl=10/dedup=a=b":  {Queue: "work#2", TTL: 10 * time.Millisecond, DedupKey: "a=b"},
+	}
+	for input, expected := range testCases {
+		r, err := ParseSet(input)
+		assert.Nil(t, err, input)
+		assert.Equal(t, expected, *r, input)
+		r, err = ParseSet(r.String())
+		assert.Nil(t, err, input)
+		assert.Equal(t, expected, *r, input)
+	}
+
+	for _, input := range []string{"work/ttl=", "work/ttl=0", "work/ttl=-1", "work/ttl=1s", "work/ttl=4294967296"} {
+		_, err := ParseSet(input)
+		assert.Equal(t, ErrInvalidTTL, err, input)
+	}
+	for _, input := range []string{"work/dedup=", "work/dedup=" + strings.Repeat("k", MaxDedupKey+1)} {
+		_, err := ParseSet(input)
+		assert.Equal(t, ErrInvalidDedupKey, err, input)
+	}
+	_, err := ParseSet("work/dedup=" + strings.Repeat("k", MaxDedupKey))
+	assert.Nil(t, err)
+}
+
+func Test_ParseHeaders(t *testing.T) {
+	headers, err := ParseHeaders([]string{"a=1", "b=", "c=x=y"})
+	assert.Nil(t, err)
+	assert.Equal(t, []Header{{"a", "1"}, {"b", ""}, {"c", "x=y"}}, headers)
+
+	headers, err = ParseHeaders(nil)
+	assert.Nil(t, err)
+	assert.Empty(t, headers)
+
+	for _, token := range []string{"a", "=1", ""} {
+		_, err = ParseHeaders([]string{"a=1", token})
+		assert.Equal(t, &InvalidHeaderError{token}, err, token)
+		assert.Equal(t, "Invalid header "+token, err.Error())
+	}
+
+	tokens := make([]string, MaxHeaders+1)
+	for i := range tokens {
+		tokens[i] = "k=v"
+	}
+	_, err = ParseHeaders(tokens)
+	assert.Equal(t, ErrTooManyHeaders, err)
+	_, err = ParseHeaders(tokens[:MaxHeaders])
+	assert.Nil(t, err)
+
+	_, err = ParseHeaders([]string{"k=" + strings.Repeat("v", MaxHeadersSize)})
+	assert.Equal(t, ErrHeadersTooLarge, err)
+}
+
+func Test_ExpiresAt(t *testing.T) {
+	now := time.Unix(1800000000, 0)
+	assert.True(t, ExpiresAt(0, 0, now).IsZero())
+	assert.Equal(t, now, ExpiresAt(-1, 0, now))
+	assert.Equal(t, now.Add(time.Minute), ExpiresAt(60, 0, now))
+	assert.Equal(t, now.Add(30*24*time.Hour), ExpiresAt(MaxRelativeExptime, 0, now))
+	assert.Equal(t, time.Unix(1800000060, 0), ExpiresAt(1800000060, 0, now))
+	assert.Equal(t, now.Add(1500*time.Millisecond), ExpiresAt(1800000060, 1500*time.Millisecond, now))
+}
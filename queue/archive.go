@@ -0,0 +1,218 @@
+package queue
+
+import (
+	"encoding/binary"
+	"time"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// Consumed items are archived as <archivePrefix> <archived at> <item id>
+// until they are purged, blob values are copied to blobs of the archive
+var archivePrefix = []byte{metaPrefix, 'a'}
+
+// archiveBatch limits archived items purged or requeued under the lock at once
+const archiveBatch = 1000
+
+// Archive keeps a copy of a consumed item, the copy can be returned
+// to the queue with Requeue until it is removed by PurgeArchive.
+// Blob values not read yet are copied chunk by chunk.
+func (q *Queue) Archive(item *Item, at time.Time) error {
+	archived := *item
+	if item.Blob != nil && len(item.Value) > 0 {
+		archived.Blob = nil
+	} else if item.Blob != nil {
+		blob, err := q.copyBlob(item.Blob, q)
+		if err != nil {
+			return err
+		}
+		archived.Blob = blob
+	}
+
+	q.Lock()
+	defer q.Unlock()
+	batch := new(leveldb.Batch)
+	batch.Put(archiveKey(at, item.ID()), encodeItem(&archived))
+	reference(batch, &archived)
+	if err := q.db.Write(batch, nil); err != nil {
+		q.DeleteBlob(archived.Blob)
+		return err
+	}
+	q.archived++
+	return nil
+}
+
+// Archived returns a number of archived items
+func (q *Queue) Archived() uint64 {
+	q.RLock()
+	defer q.RUnlock()
+	return q.archived
+}
+
+// PurgeArchive removes items archived before a given time and their blobs,
+// the lock is released between batches of archiveBatch items
+func (q *Queue) PurgeArchive(before time.Time) (int, error) {
+	purged := 0
+	for {
+		n, err := q.purgeArchiveBatch(archiveKey(before, 0))
+		purged += n
+		if err != nil || n < archiveBatch {
+			return purged, err
+		}
+	}
+}
+
+func (q *Queue) purgeArchiveBatch(limit []byte) (int, error) {
+	q.Lock()
+	defer q.Unlock()
+
+	iter := q.db.NewIterator(&util.Range{Start: archivePrefix, Limit: limit}, nil)
+	batch := new(leveldb.Batch)
+	var external []*Blob
+	n := 0
+	for n < archiveBatch && iter.Next() {
+		item, err := decodeItem(nil, iter.Value())
+		if err == nil && item.Blob != nil && item.Blob.External {
+			// Listed values are removed on open if deleting them fails
+			release(batch, item)
+			external = append(external, item.Blob)
+		} else if err == nil && item.Blob != nil {
+			deleteBlob(batch, item.Blob)
+		}
+		batch.Delete(append([]byte{}, iter.Key()...))
+		n++
+	}
+	iter.Release()
+	if err := iter.Error(); err != nil {
+		return 0, err
+	}
+	if err := q.db.Write(batch, nil); err != nil {
+		return 0, err
+	}
+	q.archived -= uint64(n)
+	for _, blob := range external {
+		if err := q.deleteExternal(blob); err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// Requeue moves items archived since a given time back to the queue tail
+// in order they were archived and returns a number of requeued items,
+// the lock is released between batches of archiveBatch items
+func (q *Queue) Requeue(since time.Time) (int, error) {
+	requeued := 0
+	start := archiveKey(since, 0)
+	for {
+		n, next, err := q.requeueBatch(start)
+		requeued += n
+		if err != nil || n < archiveBatch {
+			return requeued, err
+		}
+		start = next
+	}
+}
+
+// requeueBatch requeues archived items starting from a given key,
+// it returns the key to continue from
+func (q *Queue) requeueBatch(start []byte) (int, []byte, error) {
+	q.Lock()
+	defer q.Unlock()
+
+	iter := q.db.NewIterator(&util.Range{Start: start, Limit: []byte{metaPrefix, 'a' + 1}}, nil)
+	defer iter.Release()
+	batch := new(leveldb.Batch)
+	tail := q.tail
+	var size int64
+	var next []byte
+	for tail-q.tail < archiveBatch && iter.Next() {
+		item, err := decodeItem(nil, iter.Value())
+		if err != nil {
+			return 0, nil, err
+		}
+		tail++
+		key := make([]byte, 8)
+		binary.BigEndian.PutUint64(key, tail)
+		batch.Put(key, append([]byte{}, iter.Value()...))
+		archived := append([]byte{}, iter.Key()...)
+		batch.Delete(archived)
+		next = append(archived, 0)
+		size += item.ValueSize()
+	}
+	if err := iter.Error(); err != nil {
+		return 0, nil, err
+	}
+	if err := q.db.Write(batch, nil); err != nil {
+		return 0, nil, err
+	}
+	requeued := int(tail - q.tail)
+	q.tail = tail
+	q.archived -= uint64(requeued)
+	if requeued > 0 {
+		q.observeEnqueue(requeued, size)
+	}
+	return requeued, next, nil
+}
+
+// Replay enqueues copies of items archived within [from, to) to dest
+// in order they were archived, archived items and their blobs are kept
+func (q *Queue) Replay(from time.Time, to time.Time, dest *Queue) (int, error) {
+	// Iterator reads a consistent view without holding the lock,
+	// dest may be the queue itself
+	iter := q.db.NewIterator(&util.Range{Start: archiveKey(from, 0), Limit: archiveKey(to, 0)}, nil)
+	defer iter.Release()
+	replayed := 0
+	for iter.Next() {
+		item, err := decodeItem(nil, append([]byte{}, iter.Value()...))
+		if err != nil {
+			return replayed, err
+		}
+		if item.Blob != nil {
+			if item.Blob, err = q.copyBlob(item.Blob, dest); err != nil {
+				return replayed, err
+			}
+		}
+		if err = dest.EnqueueItem(item); err != nil {
+			dest.DeleteBlob(item.Blob)
+			return replayed, err
+		}
+		replayed++
+	}
+	return replayed, iter.Error()
+}
+
+// initializeArchive counts archived items
+func (q *Queue) initializeArchive() error {
+	iter := q.db.NewIterator(util.BytesPrefix(archivePrefix), nil)
+	defer iter.Release()
+	q.archived = 0
+	for iter.Next() {
+		q.archived++
+	}
+	return iter.Error()
+}
+
+// copyBlob writes a copy of a blob to a new blob of dest chunk by chunk,
+// the copy is listed as unreferenced until an item references it
+func (q *Queue) copyBlob(blob *Blob, dest *Queue) (*Blob, error) {
+	w := dest.NewSizedBlobWriter(blob.Size)
+	err := q.WriteBlob(blob, w)
+	if err == nil {
+		err = w.Close()
+	}
+	if err != nil {
+		w.Abort()
+		return nil, err
+	}
+	return w.Blob(), nil
+}
+
+func archiveKey(at time.Time, id uint64) []byte {
+	key := make([]byte, len(archivePrefix)+16)
+	copy(key, archivePrefix)
+	binary.BigEndian.PutUint64(key[len(archivePrefix):], uint64(at.UnixNano()))
+	binary.BigEndian.PutUint64(key[len(archivePrefix)+8:], id)
+	return key
+}
@@ -0,0 +1,99 @@
+package queue
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ArchiveRequeue(t *testing.T) {
+	q, err := Open(name, dir)
+	defer q.Drop()
+	assert.Nil(t, err)
+
+	q.Enqueue([]byte("1"))
+	q.EnqueueItem(&Item{Value: []byte("2"), Flags: 5, Headers: []Header{{Key: "k", Value: "v"}}})
+	w := q.NewBlobWriter()
+	w.Write([]byte("chunk"))
+	q.EnqueueItem(&Item{Blob: w.Blob()})
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		item, _ := q.Dequeue()
+		assert.Nil(t, q.Archive(item, start.Add(time.Duration(i)*time.Minute)))
+		q.DeleteBlob(item.Blob)
+	}
+	assert.Equal(t, uint64(3), q.Archived())
+	assert.Equal(t, uint64(0), q.Length())
+
+	// Archived items survive reopening
+	q.Close()
+	q, err = Open(name, dir)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(3), q.Archived())
+
+	dest, err := Open(name+"_replay", dir)
+	defer dest.Drop()
+	assert.Nil(t, err)
+	replayed, err := q.Replay(start.Add(time.Second), start.Add(2*time.Minute), dest)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, replayed)
+	item, _ := dest.Dequeue()
+	assert.Equal(t, []byte("2"), item.Value)
+	assert.Equal(t, uint64(3), q.Archived())
+
+	purged, err := q.PurgeArchive(start.Add(time.Second))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, purged)
+
+	requeued, err := q.Requeue(start)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, requeued)
+	assert.Equal(t, uint64(0), q.Archived())
+
+	item, _ = q.Dequeue()
+	assert.Equal(t, []byte("2"), item.Value)
+	assert.Equal(t, uint32(5), item.Flags)
+	assert.Equal(t, []Header{{Key: "k", Value: "v"}}, item.Headers)
+	// Blob values are archived as blobs
+	item, _ = q.Dequeue()
+	assert.NotNil(t, item.Blob)
+	var value bytes.Buffer
+	assert.Nil(t, q.WriteBlob(item.Blob, &value))
+	assert.Equal(t, "chunk", value.String())
+}
+
+func Test_ArchiveBatches(t *testing.T) {
+	q, err := Open(name, dir)
+	defer q.Drop()
+	assert.Nil(t, err)
+
+	start := time.Now()
+	for i := 0; i < archiveBatch*2+1; i++ {
+		w := q.NewBlobWriter()
+		w.Write([]byte("chunk"))
+		item := &Item{Blob: w.Blob()}
+		q.EnqueueItem(item)
+		item, _ = q.Dequeue()
+		assert.Nil(t, q.Archive(item, start))
+		q.DeleteBlob(item.Blob)
+	}
+
+	requeued, err := q.Requeue(start)
+	assert.Nil(t, err)
+	assert.Equal(t, archiveBatch*2+1, requeued)
+	assert.Equal(t, uint64(archiveBatch*2+1), q.Length())
+
+	for i := 0; i < archiveBatch*2+1; i++ {
+		item, _ := q.Dequeue()
+		assert.Nil(t, q.Archive(item, start))
+		q.DeleteBlob(item.Blob)
+	}
+	purged, err := q.PurgeArchive(start.Add(time.Second))
+	assert.Nil(t, err)
+	assert.Equal(t, archiveBatch*2+1, purged)
+	assert.Equal(t, uint64(0), q.Archived())
+	assert.False(t, q.hasKeys(blobPrefix))
+}
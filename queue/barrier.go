@@ -0,0 +1,83 @@
+package queue
+
+import (
+	"context"
+	"encoding/binary"
+	"time"
+)
+
+// barrierPollInterval is how often Barrier checks the queue head
+var barrierPollInterval = 10 * time.Millisecond
+
+// OpenItem counts an item opened by a consumer until CloseItem
+func (q *Queue) OpenItem(item *Item) {
+	q.AddOpenTransactions(1)
+	q.Lock()
+	defer q.Unlock()
+	if q.opened == nil {
+		q.opened = map[uint64]int{}
+	}
+	q.opened[itemSeq(item)]++
+}
+
+// CloseItem counts an open item closed, aborted or delayed
+func (q *Queue) CloseItem(item *Item) {
+	q.AddOpenTransactions(-1)
+	q.Lock()
+	defer q.Unlock()
+	seq := itemSeq(item)
+	if q.opened[seq] <= 1 {
+		delete(q.opened, seq)
+	} else {
+		q.opened[seq]--
+	}
+}
+
+// Barrier waits until every item enqueued before the call is dequeued
+// and closed. Items aborted to the head are waited for again, items
+// delayed or aborted to the tail are not, ctx error is returned once
+// ctx is done. Queues are not rebased while barriers wait.
+func (q *Queue) Barrier(ctx context.Context) error {
+	q.Lock()
+	barrier := q.tail
+	q.barriers++
+	q.Unlock()
+	defer func() {
+		q.Lock()
+		q.barriers--
+		q.Unlock()
+	}()
+	ticker := time.NewTicker(barrierPollInterval)
+	defer ticker.Stop()
+	for !q.passed(barrier) {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
+
+// passed reports whether items up to a sequence number are dequeued and closed
+func (q *Queue) passed(barrier uint64) bool {
+	q.RLock()
+	defer q.RUnlock()
+	if q.head < barrier {
+		return false
+	}
+	for seq := range q.opened {
+		if seq <= barrier {
+			return false
+		}
+	}
+	return true
+}
+
+// itemSeq returns a sequence number of an item key, zero for items without one
+func itemSeq(item *Item) uint64 {
+	if len(item.Key) != 8 {
+		return 0
+	}
+	return binary.BigEndian.Uint64(item.Key)
+}
@@ -0,0 +1,55 @@
+package queue
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Barrier(t *testing.T) {
+	q, err := Open(name, dir)
+	defer q.Drop()
+	assert.Nil(t, err)
+
+	assert.Nil(t, q.Barrier(context.Background()))
+
+	q.Enqueue([]byte("1"))
+	q.Enqueue([]byte("2"))
+	assert.False(t, q.passed(rebaseOffset+2))
+
+	item, _ := q.Dequeue()
+	q.OpenItem(item)
+	q.Enqueue([]byte("3"))
+	second, _ := q.Dequeue()
+	q.OpenItem(second)
+	assert.False(t, q.passed(rebaseOffset+2))
+
+	// Aborted item is waited for again
+	q.Prepend(item)
+	q.CloseItem(item)
+	q.CloseItem(second)
+	assert.False(t, q.passed(rebaseOffset+2))
+	item, _ = q.Dequeue()
+	q.OpenItem(item)
+	assert.False(t, q.passed(rebaseOffset+2))
+
+	// Items enqueued after the barrier don't hold it
+	third, _ := q.Dequeue()
+	q.OpenItem(third)
+	q.CloseItem(item)
+	assert.True(t, q.passed(rebaseOffset+2))
+	q.CloseItem(third)
+
+	q.Enqueue([]byte("4"))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*barrierPollInterval)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, q.Barrier(ctx))
+
+	go func() {
+		time.Sleep(2 * barrierPollInterval)
+		q.Dequeue()
+	}()
+	assert.Nil(t, q.Barrier(context.Background()))
+}
@@ -0,0 +1,273 @@
+package queue
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"io"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// ChunkSize is a maximum size of a blob chunk,
+// values larger than ChunkSize are stored as blobs
+const ChunkSize = 1 << 20
+
+// Blob chunks are stored as <blobPrefix> <blob id> <chunk index>,
+// item record only references a blob.
+// Chunks outlive the item record on Dequeue, so consumers can stream
+// them after the item is taken, they are removed with DeleteBlob.
+var blobPrefix = []byte{metaPrefix, 'b'}
+
+// Blobs no stored or delayed item references are listed as
+// <unreferencedPrefix> <blob id>: a blob is listed once it is started
+// and once its item is taken, and unlisted in the same batch an item
+// referencing it is stored or the blob is deleted. Listed blobs are
+// removed on open, so open doesn't scan items.
+var unreferencedPrefix = []byte{metaPrefix, 'o'}
+
+// ledgerKey marks databases listing unreferenced blobs
+var ledgerKey = []byte{metaPrefix, 'l', 'e', 'd', 'g', 'e', 'r'}
+
+// Blob references a value stored in chunks
+type Blob struct {
+	ID     uint64
+	Chunks uint32
+	Size   int64
+	// External values are kept in a blob store, see SetBlobStore
+	External bool
+}
+
+// BlobWriter stores a value chunk by chunk
+type BlobWriter struct {
+	q    *Queue
+	blob Blob
+	ext  io.WriteCloser
+}
+
+// NewBlobWriter starts a new blob
+func (q *Queue) NewBlobWriter() *BlobWriter {
+	return &BlobWriter{q: q, blob: Blob{ID: newBlobID()}}
+}
+
+// newBlobID returns a random blob ID, so servers sharing a blob store
+// don't overwrite or delete values of each other
+func newBlobID() uint64 {
+	var id [8]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		panic(err)
+	}
+	return binary.BigEndian.Uint64(id[:])
+}
+
+// Write stores p as the next chunk
+func (w *BlobWriter) Write(p []byte) (int, error) {
+	if w.blob.External {
+		return w.writeExternal(p)
+	}
+	batch := new(leveldb.Batch)
+	if w.blob.Chunks == 0 {
+		batch.Put(unreferencedKey(w.blob.ID), nil)
+	}
+	batch.Put(blobKey(w.blob.ID, w.blob.Chunks), p)
+	if err := w.q.db.Write(batch, nil); err != nil {
+		return 0, err
+	}
+	w.blob.Chunks++
+	w.blob.Size += int64(len(p))
+	return len(p), nil
+}
+
+// Blob returns a reference to written chunks
+func (w *BlobWriter) Blob() *Blob {
+	blob := w.blob
+	return &blob
+}
+
+// Abort removes written chunks
+func (w *BlobWriter) Abort() error {
+	if w.blob.External {
+		if w.ext == nil {
+			return nil
+		}
+		w.ext.Close()
+	}
+	return w.q.DeleteBlob(w.Blob())
+}
+
+// WriteBlob writes blob chunks to w one by one
+func (q *Queue) WriteBlob(blob *Blob, w io.Writer) error {
+	if blob.External {
+		return copyExternal(q.blobs, blob, w)
+	}
+	for i := uint32(0); i < blob.Chunks; i++ {
+		chunk, err := q.db.Get(blobKey(blob.ID, i), nil)
+		if err != nil {
+			return err
+		}
+		if _, err = w.Write(chunk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteBlob removes blob chunks, nil blob is ignored
+func (q *Queue) DeleteBlob(blob *Blob) error {
+	if blob == nil {
+		return nil
+	}
+	if blob.External {
+		return q.deleteExternal(blob)
+	}
+	batch := new(leveldb.Batch)
+	deleteBlob(batch, blob)
+	return q.db.Write(batch, nil)
+}
+
+func deleteBlob(batch *leveldb.Batch, blob *Blob) {
+	for i := uint32(0); i < blob.Chunks; i++ {
+		batch.Delete(blobKey(blob.ID, i))
+	}
+	batch.Delete(unreferencedKey(blob.ID))
+}
+
+// reference unlists a blob of an item stored by a batch
+func reference(batch *leveldb.Batch, item *Item) {
+	if item.Blob != nil {
+		batch.Delete(unreferencedKey(item.Blob.ID))
+	}
+}
+
+// release lists a blob of an item removed by a batch, the blob is
+// kept until DeleteBlob or removed on open
+func release(batch *leveldb.Batch, item *Item) {
+	if item.Blob != nil {
+		batch.Put(unreferencedKey(item.Blob.ID), nil)
+	}
+}
+
+// removeOrphanBlobs deletes chunks of listed unreferenced blobs, left by
+// interrupted SET or by consumers of a stopped server. Listed external
+// values are kept for RemoveOrphanValues. Databases without the list are
+// scanned once instead.
+func (q *Queue) removeOrphanBlobs() error {
+	q.orphanValues = nil
+	if _, err := q.db.Get(ledgerKey, nil); err == leveldb.ErrNotFound {
+		return q.scanOrphanBlobs()
+	} else if err != nil {
+		return err
+	}
+
+	iter := q.db.NewIterator(util.BytesPrefix(unreferencedPrefix), nil)
+	defer iter.Release()
+	batch := new(leveldb.Batch)
+	for iter.Next() {
+		key := iter.Key()
+		if len(key) != len(unreferencedPrefix)+8 {
+			continue
+		}
+		id := binary.BigEndian.Uint64(key[len(unreferencedPrefix):])
+		external, err := q.db.Has(externalKey(id), nil)
+		if err != nil {
+			return err
+		}
+		if external {
+			q.orphanValues = append(q.orphanValues, id)
+			continue
+		}
+		chunks := q.db.NewIterator(util.BytesPrefix(blobKey(id, 0)[:len(blobPrefix)+8]), nil)
+		for chunks.Next() {
+			batch.Delete(append([]byte{}, chunks.Key()...))
+		}
+		chunks.Release()
+		if err = chunks.Error(); err != nil {
+			return err
+		}
+		batch.Delete(append([]byte{}, key...))
+	}
+	if err := iter.Error(); err != nil {
+		return err
+	}
+	return q.db.Write(batch, nil)
+}
+
+// scanOrphanBlobs deletes chunks that no stored, delayed or archived item references
+// and lists unreferenced external values, then marks the database as
+// keeping the list of unreferenced blobs
+func (q *Queue) scanOrphanBlobs() error {
+	batch := new(leveldb.Batch)
+	batch.Put(ledgerKey, nil)
+	if !q.hasKeys(blobPrefix) && !q.hasKeys(externalPrefix) {
+		return q.db.Write(batch, nil)
+	}
+
+	referenced := map[uint64]bool{}
+	for _, r := range []*util.Range{itemRange, util.BytesPrefix(delayedPrefix), util.BytesPrefix(archivePrefix)} {
+		items := q.db.NewIterator(r, nil)
+		for items.Next() {
+			item, err := decodeItem(nil, items.Value())
+			if err == nil && item.Blob != nil {
+				referenced[item.Blob.ID] = true
+			}
+		}
+		items.Release()
+		if err := items.Error(); err != nil {
+			return err
+		}
+	}
+
+	iter := q.db.NewIterator(util.BytesPrefix(blobPrefix), nil)
+	defer iter.Release()
+	for iter.Next() {
+		key := iter.Key()
+		if len(key) != len(blobPrefix)+12 {
+			continue
+		}
+		if !referenced[binary.BigEndian.Uint64(key[len(blobPrefix):])] {
+			batch.Delete(append([]byte{}, key...))
+		}
+	}
+	if err := iter.Error(); err != nil {
+		return err
+	}
+
+	values := q.db.NewIterator(util.BytesPrefix(externalPrefix), nil)
+	defer values.Release()
+	for values.Next() {
+		key := values.Key()
+		if len(key) != len(externalPrefix)+8 {
+			continue
+		}
+		if id := binary.BigEndian.Uint64(key[len(externalPrefix):]); !referenced[id] {
+			q.orphanValues = append(q.orphanValues, id)
+			batch.Put(unreferencedKey(id), nil)
+		}
+	}
+	if err := values.Error(); err != nil {
+		return err
+	}
+	return q.db.Write(batch, nil)
+}
+
+// hasKeys reports whether the database has keys with a given prefix
+func (q *Queue) hasKeys(prefix []byte) bool {
+	iter := q.db.NewIterator(util.BytesPrefix(prefix), nil)
+	defer iter.Release()
+	return iter.First()
+}
+
+func unreferencedKey(id uint64) []byte {
+	key := make([]byte, len(unreferencedPrefix)+8)
+	copy(key, unreferencedPrefix)
+	binary.BigEndian.PutUint64(key[len(unreferencedPrefix):], id)
+	return key
+}
+
+func blobKey(id uint64, chunk uint32) []byte {
+	key := make([]byte, len(blobPrefix)+12)
+	copy(key, blobPrefix)
+	binary.BigEndian.PutUint64(key[len(blobPrefix):], id)
+	binary.BigEndian.PutUint32(key[len(blobPrefix)+8:], chunk)
+	return key
+}
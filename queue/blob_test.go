@@ -0,0 +1,101 @@
+package queue
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+func Test_encodeDecodeBlob(t *testing.T) {
+	input := &Item{Flags: 1, Blob: &Blob{ID: 1 << 60, Chunks: 3, Size: 3*ChunkSize - 10}}
+	item, err := decodeItem([]byte("key"), encodeItem(input))
+	assert.Nil(t, err)
+	assert.Equal(t, input.Blob, item.Blob)
+	assert.Equal(t, int32(3*ChunkSize-10), item.Size)
+	assert.Equal(t, 0, len(item.Value))
+}
+
+func Test_Blob(t *testing.T) {
+	q, _ := Open(name, dir)
+	defer q.Drop()
+
+	w := q.NewBlobWriter()
+	w.Write([]byte("0123"))
+	w.Write([]byte("4567"))
+	w.Write([]byte("89"))
+	assert.Nil(t, q.EnqueueItem(&Item{Blob: w.Blob()}))
+
+	item, err := q.Dequeue()
+	assert.Nil(t, err)
+	assert.Equal(t, int32(10), item.Size)
+
+	var buf bytes.Buffer
+	assert.Nil(t, q.WriteBlob(item.Blob, &buf))
+	assert.Equal(t, "0123456789", buf.String())
+
+	assert.Nil(t, q.DeleteBlob(item.Blob))
+	assert.NotNil(t, q.WriteBlob(item.Blob, &buf))
+	assert.Equal(t, 0, countKeys(q, blobPrefix))
+}
+
+func Test_removeOrphanBlobs(t *testing.T) {
+	q, _ := Open(name, dir)
+	defer q.Drop()
+
+	for _, value := range []string{"taken", "stored"} {
+		w := q.NewBlobWriter()
+		w.Write([]byte(value))
+		q.EnqueueItem(&Item{Blob: w.Blob()})
+	}
+	// Consumers of a stopped server leave blobs of taken items
+	taken, _ := q.Dequeue()
+	assert.NotNil(t, taken.Blob)
+
+	orphan := q.NewBlobWriter()
+	orphan.Write([]byte("orphan"))
+	orphan.Write([]byte("orphan"))
+	assert.Equal(t, 4, countKeys(q, blobPrefix))
+	assert.Equal(t, 2, countKeys(q, unreferencedPrefix))
+
+	q.Close()
+	q, _ = Open(name, dir)
+	assert.Equal(t, 1, countKeys(q, blobPrefix))
+	assert.Equal(t, 0, countKeys(q, unreferencedPrefix))
+
+	item, _ := q.Dequeue()
+	var buf bytes.Buffer
+	assert.Nil(t, q.WriteBlob(item.Blob, &buf))
+	assert.Equal(t, "stored", buf.String())
+	assert.Nil(t, q.DeleteBlob(item.Blob))
+	assert.Equal(t, 0, countKeys(q, unreferencedPrefix))
+}
+
+func Test_removeOrphanBlobs_Unlisted(t *testing.T) {
+	q, _ := Open(name, dir)
+	defer q.Drop()
+
+	w := q.NewBlobWriter()
+	w.Write([]byte("stored"))
+	q.EnqueueItem(&Item{Blob: w.Blob()})
+	q.db.Put(blobKey(1, 0), []byte("orphan"), nil)
+
+	// Databases without the list of unreferenced blobs are scanned once
+	q.db.Delete(ledgerKey, nil)
+	q.Close()
+	q, _ = Open(name, dir)
+	assert.Equal(t, 1, countKeys(q, blobPrefix))
+	has, _ := q.db.Has(ledgerKey, nil)
+	assert.True(t, has)
+}
+
+func countKeys(q *Queue, prefix []byte) int {
+	iter := q.db.NewIterator(util.BytesPrefix(prefix), nil)
+	defer iter.Release()
+	count := 0
+	for iter.Next() {
+		count++
+	}
+	return count
+}
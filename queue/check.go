@@ -0,0 +1,98 @@
+package queue
+
+import (
+	"encoding/binary"
+
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+// CheckReport describes anomalies found in queue items keyspace
+type CheckReport struct {
+	Queue string
+	Head  uint64
+	Tail  uint64
+	Items uint64
+	// Gaps are ranges of missing offsets between head and tail,
+	// dequeue stops at the first gap
+	Gaps []Gap
+	// InvalidKeys are keys in items keyspace that are not 8 byte offsets
+	InvalidKeys int
+	// InvalidRecords are items that can't be decoded
+	InvalidRecords int
+	Repaired       bool
+}
+
+// Gap is an inclusive range of missing offsets
+type Gap struct {
+	From uint64
+	To   uint64
+}
+
+// OK reports whether no anomalies were found
+func (r *CheckReport) OK() bool {
+	return len(r.Gaps) == 0 && r.InvalidKeys == 0 && r.InvalidRecords == 0
+}
+
+// Check walks queue items verifying that offsets between head and tail
+// are contiguous. Repair renumbers items to close gaps keeping their order
+// and removes invalid keys, undecodable items are only reported.
+func (q *Queue) Check(repair bool) (*CheckReport, error) {
+	q.Lock()
+	defer q.Unlock()
+
+	report := &CheckReport{Queue: q.Name, Head: q.head, Tail: q.tail}
+	snapshot, err := q.db.GetSnapshot()
+	if err != nil {
+		return report, err
+	}
+	defer snapshot.Release()
+
+	iter := snapshot.NewIterator(itemRange, nil)
+	defer iter.Release()
+	batch := new(leveldb.Batch)
+	next := q.head + 1
+	for iter.Next() {
+		key := iter.Key()
+		if len(key) != 8 {
+			report.InvalidKeys++
+			if repair {
+				batch.Delete(append([]byte(nil), key...))
+			}
+			continue
+		}
+		if _, err := decodeItem(key, iter.Value()); err != nil {
+			report.InvalidRecords++
+		}
+
+		offset := binary.BigEndian.Uint64(key)
+		expected := q.head + 1 + report.Items
+		if offset > next {
+			report.Gaps = append(report.Gaps, Gap{From: next, To: offset - 1})
+		}
+		next = offset + 1
+		report.Items++
+
+		if repair && offset != expected {
+			newKey := make([]byte, 8)
+			binary.BigEndian.PutUint64(newKey, expected)
+			batch.Put(newKey, append([]byte(nil), iter.Value()...))
+			batch.Delete(append([]byte(nil), key...))
+		}
+	}
+	if err = iter.Error(); err != nil {
+		return report, err
+	}
+	if !repair || (len(report.Gaps) == 0 && report.InvalidKeys == 0) {
+		return report, nil
+	}
+	// Repairs are written in one batch once the walk is over,
+	// so a crash leaves either old or new offsets
+	iter.Release()
+	snapshot.Release()
+	if err = q.db.Write(batch, nil); err != nil {
+		return report, err
+	}
+	q.tail = q.head + report.Items
+	report.Repaired = true
+	return report, nil
+}
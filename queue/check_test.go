@@ -0,0 +1,126 @@
+package queue
+
+import (
+	"encoding/binary"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Check(t *testing.T) {
+	q, err := Open(name, dir)
+	defer q.Drop()
+	assert.Nil(t, err)
+
+	for i := 1; i <= 6; i++ {
+		q.Enqueue([]byte(strconv.Itoa(i)))
+	}
+	q.Dequeue()
+
+	// Remove items 3 and 5 behind the queue's back
+	for _, offset := range []uint64{3, 5} {
+		key := make([]byte, 8)
+		binary.BigEndian.PutUint64(key, rebaseOffset+offset)
+		assert.Nil(t, q.db.Delete(key, nil))
+	}
+
+	report, err := q.Check(false)
+	assert.Nil(t, err)
+	assert.False(t, report.OK())
+	assert.Equal(t, []Gap{{rebaseOffset + 3, rebaseOffset + 3}, {rebaseOffset + 5, rebaseOffset + 5}}, report.Gaps)
+	assert.Equal(t, uint64(3), report.Items)
+	assert.False(t, report.Repaired)
+	assert.Equal(t, uint64(5), q.Length())
+
+	report, err = q.Check(true)
+	assert.Nil(t, err)
+	assert.True(t, report.Repaired)
+	assert.Equal(t, uint64(3), q.Length())
+	for _, value := range []string{"2", "4", "6"} {
+		item, err := q.Dequeue()
+		assert.Nil(t, err)
+		assert.Equal(t, []byte(value), item.Value)
+	}
+	q.Enqueue([]byte("7"))
+	item, _ := q.Dequeue()
+	assert.Equal(t, []byte("7"), item.Value)
+
+	report, err = q.Check(false)
+	assert.Nil(t, err)
+	assert.True(t, report.OK())
+}
+
+func Test_Initialize_Recovery(t *testing.T) {
+	q, err := Open(name, dir)
+	defer q.Drop()
+	assert.Nil(t, err)
+
+	for i := 1; i <= 5; i++ {
+		q.Enqueue([]byte(strconv.Itoa(i)))
+	}
+	item, _ := q.Dequeue()
+	assert.Nil(t, q.Prepend(item))
+
+	// A lost item and a stray key as left by an unclean shutdown
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, rebaseOffset+3)
+	assert.Nil(t, q.db.Delete(key, nil))
+	assert.Nil(t, q.db.Put([]byte{0, 1}, []byte("x"), nil))
+	q.Close()
+
+	q, err = Open(name, dir)
+	assert.Nil(t, err)
+	assert.Equal(t, rebaseOffset, q.Head())
+	assert.Equal(t, rebaseOffset+5, q.Tail())
+
+	report, err := q.Check(true)
+	assert.Nil(t, err)
+	assert.Equal(t, []Gap{{rebaseOffset + 3, rebaseOffset + 3}}, report.Gaps)
+	assert.Equal(t, 1, report.InvalidKeys)
+	assert.Equal(t, uint64(4), q.Length())
+
+	item, _ = q.Dequeue()
+	assert.Equal(t, []byte("1"), item.Value)
+	assert.Nil(t, q.Prepend(item))
+	q.Enqueue([]byte("6"))
+	for _, value := range []string{"1", "2", "4", "5", "6"} {
+		item, err = q.Dequeue()
+		assert.Nil(t, err)
+		assert.Equal(t, []byte(value), item.Value)
+	}
+	assert.Equal(t, uint64(0), q.Length())
+}
+
+func Test_Dequeue_Gaps(t *testing.T) {
+	q, err := Open(name, dir)
+	defer q.Drop()
+	assert.Nil(t, err)
+
+	for i := 1; i <= 6; i++ {
+		q.Enqueue([]byte(strconv.Itoa(i)))
+	}
+	// Gaps are skipped without Check
+	for _, offset := range []uint64{1, 3, 4, 6} {
+		key := make([]byte, 8)
+		binary.BigEndian.PutUint64(key, rebaseOffset+offset)
+		assert.Nil(t, q.db.Delete(key, nil))
+	}
+	item, err := q.Peek()
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("2"), item.Value)
+	for _, value := range []string{"2", "5"} {
+		item, err = q.Dequeue()
+		assert.Nil(t, err)
+		assert.Equal(t, []byte(value), item.Value)
+	}
+	assert.Equal(t, rebaseOffset+5, q.Head())
+	_, err = q.Dequeue()
+	assert.Equal(t, ErrEmpty, err)
+
+	q.Enqueue([]byte("7"))
+	item, err = q.Dequeue()
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("7"), item.Value)
+	assert.Equal(t, uint64(0), q.Length())
+}
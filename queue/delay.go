@@ -0,0 +1,144 @@
+package queue
+
+import (
+	"encoding/binary"
+	"time"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// Delayed items are stored as <delayedPrefix> <due time> <item id>
+// and return to the queue head once due
+var delayedPrefix = []byte{metaPrefix, 'w'}
+
+// Delay takes an item out of the queue until a given time,
+// the item returns to the queue head on Dequeue or PromoteDelayed once due
+func (q *Queue) Delay(item *Item, until time.Time) error {
+	q.Lock()
+	defer q.Unlock()
+
+	key := make([]byte, len(delayedPrefix)+16)
+	copy(key, delayedPrefix)
+	binary.BigEndian.PutUint64(key[len(delayedPrefix):], uint64(until.UnixNano()))
+	binary.BigEndian.PutUint64(key[len(delayedPrefix)+8:], item.ID())
+	batch := new(leveldb.Batch)
+	batch.Put(key, encodeItem(item))
+	reference(batch, item)
+	if err := q.write(batch, item.Span); err != nil {
+		return err
+	}
+	if q.delayed == 0 || until.Before(q.nextDue) {
+		q.nextDue = until
+	}
+	q.delayed++
+	// Waiting readers reschedule their wake up
+	q.signal()
+	return nil
+}
+
+// Delayed returns a number of delayed items
+func (q *Queue) Delayed() uint64 {
+	q.RLock()
+	defer q.RUnlock()
+	return q.delayed
+}
+
+// NextDue returns a due time of the earliest delayed item,
+// zero when there are no delayed items
+func (q *Queue) NextDue() time.Time {
+	q.RLock()
+	defer q.RUnlock()
+	if q.delayed == 0 {
+		return time.Time{}
+	}
+	return q.nextDue
+}
+
+// PromoteDelayed returns due delayed items to the queue head
+func (q *Queue) PromoteDelayed() error {
+	q.Lock()
+	defer q.Unlock()
+	return q.promoteDelayed(time.Now())
+}
+
+func (q *Queue) promoteDelayed(now time.Time) error {
+	if q.delayed == 0 || now.Before(q.nextDue) {
+		return nil
+	}
+
+	iter := q.db.NewIterator(util.BytesPrefix(delayedPrefix), nil)
+	defer iter.Release()
+	keys := [][]byte{}
+	values := [][]byte{}
+	q.nextDue = time.Time{}
+	for iter.Next() {
+		due, ok := delayedDue(iter.Key())
+		if !ok {
+			continue
+		}
+		if due.After(now) {
+			q.nextDue = due
+			break
+		}
+		keys = append(keys, append([]byte{}, iter.Key()...))
+		values = append(values, append([]byte{}, iter.Value()...))
+	}
+	if err := iter.Error(); err != nil {
+		return err
+	}
+
+	// Keys are in due order, the earliest due items take free head positions,
+	// so the earliest is the head, the rest follow the tail in due order.
+	// An empty queue of a restarted server has no free head position.
+	prepended := uint64(len(keys))
+	if prepended > q.head {
+		prepended = q.head
+	}
+	head, tail := q.head-prepended, q.tail
+	batch := new(leveldb.Batch)
+	for i := range keys {
+		key := make([]byte, 8)
+		if uint64(i) < prepended {
+			binary.BigEndian.PutUint64(key, head+1+uint64(i))
+		} else {
+			tail++
+			binary.BigEndian.PutUint64(key, tail)
+		}
+		batch.Delete(keys[i])
+		batch.Put(key, values[i])
+	}
+	if err := q.db.Write(batch, nil); err != nil {
+		return err
+	}
+	q.head, q.tail = head, tail
+	q.delayed -= uint64(len(keys))
+	return nil
+}
+
+// initializeDelayed counts delayed items and finds the earliest due time
+func (q *Queue) initializeDelayed() error {
+	iter := q.db.NewIterator(util.BytesPrefix(delayedPrefix), nil)
+	defer iter.Release()
+	q.delayed = 0
+	for iter.Next() {
+		due, ok := delayedDue(iter.Key())
+		if !ok {
+			continue
+		}
+		if q.delayed == 0 {
+			q.nextDue = due
+		}
+		q.delayed++
+	}
+	return iter.Error()
+}
+
+// delayedDue returns a due time of a delayed item key,
+// malformed keys are not counted as delayed items
+func delayedDue(key []byte) (time.Time, bool) {
+	if len(key) != len(delayedPrefix)+16 {
+		return time.Time{}, false
+	}
+	return time.Unix(0, int64(binary.BigEndian.Uint64(key[len(delayedPrefix):]))), true
+}
@@ -0,0 +1,67 @@
+package queue
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_DelayPromoteDelayed(t *testing.T) {
+	q, err := Open(name, dir)
+	defer q.Drop()
+	assert.Nil(t, err)
+
+	for _, value := range []string{"1", "2", "3", "4"} {
+		q.Enqueue([]byte(value))
+	}
+	first, _ := q.Dequeue()
+	second, _ := q.Dequeue()
+
+	now := time.Now()
+	assert.Nil(t, q.Delay(second, now.Add(20*time.Millisecond)))
+	assert.Nil(t, q.Delay(first, now.Add(10*time.Millisecond)))
+	assert.Equal(t, uint64(2), q.Delayed())
+	assert.Equal(t, uint64(2), q.Length())
+
+	// Delayed items survive reopening
+	q.Close()
+	q, err = Open(name, dir)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(2), q.Delayed())
+	assert.True(t, now.Add(10*time.Millisecond).Equal(q.NextDue()))
+
+	item, _ := q.Peek()
+	assert.Equal(t, []byte("3"), item.Value)
+
+	time.Sleep(30 * time.Millisecond)
+	for _, value := range []string{"1", "2", "3", "4"} {
+		item, err = q.Dequeue()
+		assert.Nil(t, err)
+		assert.Equal(t, []byte(value), item.Value)
+	}
+	assert.Equal(t, uint64(0), q.Delayed())
+	assert.True(t, q.NextDue().IsZero())
+}
+
+func Test_PromoteDelayed_Tail(t *testing.T) {
+	q, err := Open(name, dir)
+	defer q.Drop()
+	assert.Nil(t, err)
+
+	// An empty reopened queue has no free head positions
+	q.Close()
+	q, _ = Open(name, dir)
+	now := time.Now()
+	for i, value := range []string{"2", "1", "3"} {
+		due := now.Add(time.Duration([]int{20, 10, 30}[i]) * time.Millisecond)
+		assert.Nil(t, q.Delay(&Item{Value: []byte(value)}, due))
+	}
+
+	time.Sleep(40 * time.Millisecond)
+	for _, value := range []string{"1", "2", "3"} {
+		item, err := q.Dequeue()
+		assert.Nil(t, err)
+		assert.Equal(t, []byte(value), item.Value)
+	}
+}
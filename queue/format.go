@@ -0,0 +1,213 @@
+package queue
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// formatFile keeps an on-disk format version of a queue next to
+// its leveldb files, written once every migration is applied
+const formatFile = "FORMAT"
+
+// upgradeBatchSize limits a number of legacy items rewritten in one batch
+const upgradeBatchSize = 1000
+
+// migration upgrades a queue database from the previous format version,
+// it must be safe to run again after an interruption
+type migration struct {
+	version int
+	name    string
+	apply   func(q *Queue) error
+}
+
+// migrations are applied in order to queues of older format versions,
+// a format change appends a migration, FormatVersion is the last one
+var migrations = []migration{
+	{1, "item records", (*Queue).upgradeRecords},
+	{2, "high offsets", (*Queue).upgradeOffsets},
+}
+
+// FormatVersion is the on-disk format version of queues written by this build
+func FormatVersion() int {
+	return migrations[len(migrations)-1].version
+}
+
+// formatMeta is the content of formatFile
+type formatMeta struct {
+	Version int `json:"version"`
+}
+
+// migrate brings the database to FormatVersion on open, queues
+// of a newer version are not opened, so downgrades can't damage them
+func (q *Queue) migrate() error {
+	version, err := q.formatVersion()
+	if err != nil {
+		return err
+	}
+	if version > FormatVersion() {
+		return fmt.Errorf("queue %s format version %d is newer than supported %d",
+			q.Name, version, FormatVersion())
+	}
+	for _, m := range migrations {
+		if m.version <= version {
+			continue
+		}
+		if err = m.apply(q); err != nil {
+			return fmt.Errorf("queue %s migration to version %d (%s): %s",
+				q.Name, m.version, m.name, err.Error())
+		}
+		if err = q.writeFormat(m.version); err != nil {
+			return err
+		}
+		version = m.version
+	}
+	if !q.inMemory {
+		if _, err = os.Stat(q.formatPath()); os.IsNotExist(err) {
+			return q.writeFormat(version)
+		}
+	}
+	return err
+}
+
+// formatVersion reads formatFile, queues written before it existed
+// are version 1 if their items are records and version 0 otherwise
+func (q *Queue) formatVersion() (int, error) {
+	if !q.inMemory {
+		data, err := ioutil.ReadFile(q.formatPath())
+		if err == nil {
+			meta := formatMeta{}
+			if err = json.Unmarshal(data, &meta); err != nil {
+				return 0, fmt.Errorf("queue %s has invalid %s file: %s", q.Name, formatFile, err.Error())
+			}
+			return meta.Version, nil
+		}
+		if !os.IsNotExist(err) {
+			return 0, err
+		}
+	}
+	if ok, err := q.db.Has(formatKey, nil); ok || err != nil {
+		return 1, err
+	}
+	return 0, nil
+}
+
+// writeFormat replaces formatFile atomically
+func (q *Queue) writeFormat(version int) error {
+	if q.inMemory {
+		return nil
+	}
+	data, _ := json.Marshal(formatMeta{Version: version})
+	tmp, err := ioutil.TempFile(q.Path(), formatFile)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err = tmp.Write(append(data, '\n')); err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), q.formatPath())
+}
+
+func (q *Queue) formatPath() string {
+	return filepath.Join(q.Path(), formatFile)
+}
+
+// upgradeRecords converts raw values written by older versions into item records
+func (q *Queue) upgradeRecords() error {
+	if ok, err := q.db.Has(formatKey, nil); ok || err != nil {
+		return err
+	}
+
+	start := []byte(nil)
+	if progress, err := q.db.Get(upgradeKey, nil); err == nil {
+		start = progress
+	} else if err != leveldb.ErrNotFound {
+		return err
+	}
+
+	for {
+		iter := q.db.NewIterator(&util.Range{Start: start, Limit: []byte{metaPrefix}}, nil)
+		batch := new(leveldb.Batch)
+		var lastKey []byte
+		for iter.Next() && batch.Len() < upgradeBatchSize {
+			lastKey = append([]byte(nil), iter.Key()...)
+			// Keys that are not offsets are left to Check
+			if len(lastKey) != 8 {
+				continue
+			}
+			value := append([]byte(nil), iter.Value()...)
+			batch.Put(lastKey, encodeItem(&Item{Value: value}))
+		}
+		iter.Release()
+		if err := iter.Error(); err != nil {
+			return err
+		}
+		if lastKey == nil {
+			break
+		}
+
+		// Remember progress in the same batch, so an interrupted upgrade
+		// never converts the same item twice, the next batch starts
+		// at the least key after lastKey
+		start = append(lastKey, 0)
+		batch.Put(upgradeKey, start)
+		if err := q.db.Write(batch, nil); err != nil {
+			return err
+		}
+	}
+
+	// formatKey is kept for older builds, which convert items without it
+	batch := new(leveldb.Batch)
+	batch.Put(formatKey, []byte{recordVersion})
+	batch.Delete(upgradeKey)
+	return q.db.Write(batch, nil)
+}
+
+// upgradeOffsets moves items of queues started at zero up by rebaseOffset,
+// so items can be prepended below their head. Items are moved in batches,
+// each batch moves items to keys above every legacy offset, so an interrupted
+// upgrade continues with legacy offsets left.
+func (q *Queue) upgradeOffsets() error {
+	limit := make([]byte, 8)
+	binary.BigEndian.PutUint64(limit, rebaseOffset)
+	for {
+		iter := q.db.NewIterator(&util.Range{Limit: limit}, nil)
+		batch := new(leveldb.Batch)
+		moved := 0
+		for moved < upgradeBatchSize && iter.Next() {
+			key := iter.Key()
+			// Keys that are not offsets are left to Check
+			if len(key) != 8 {
+				continue
+			}
+			newKey := make([]byte, 8)
+			binary.BigEndian.PutUint64(newKey, binary.BigEndian.Uint64(key)+rebaseOffset)
+			batch.Put(newKey, append([]byte(nil), iter.Value()...))
+			batch.Delete(append([]byte(nil), key...))
+			moved++
+		}
+		iter.Release()
+		if err := iter.Error(); err != nil {
+			return err
+		}
+		if moved == 0 {
+			return nil
+		}
+		if err := q.db.Write(batch, nil); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package queue
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_migrate(t *testing.T) {
+	q, err := Open(name, dir)
+	assert.Nil(t, err)
+	defer q.Drop()
+
+	data, err := ioutil.ReadFile(filepath.Join(q.Path(), formatFile))
+	assert.Nil(t, err)
+	assert.Equal(t, "{\"version\":2}\n", string(data))
+	q.Enqueue([]byte("1"))
+	q.Close()
+
+	// Migrations apply in order and are not applied again
+	applied := []string{}
+	defer func(saved []migration) { migrations = saved }(migrations)
+	migrations = append(migrations,
+		migration{3, "third", func(q *Queue) error { applied = append(applied, "third"); return nil }},
+		migration{4, "fourth", func(q *Queue) error { applied = append(applied, "fourth"); return nil }})
+	q, err = Open(name, dir)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"third", "fourth"}, applied)
+	q.Close()
+	q, err = Open(name, dir)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(applied))
+	q.Close()
+
+	// A failed migration is retried on the next open
+	migrations = append(migrations, migration{5, "failing", func(q *Queue) error { return errors.New("disk full") }})
+	q, err = Open(name, dir)
+	assert.Equal(t, "queue test migration to version 5 (failing): disk full", err.Error())
+	q.Close()
+	version, err := q.formatVersion()
+	assert.Equal(t, 4, version)
+
+	// Queues of newer builds are not opened
+	migrations = migrations[:2]
+	q, err = Open(name, dir)
+	assert.Equal(t, "queue test format version 4 is newer than supported 2", err.Error())
+	q.Close()
+}
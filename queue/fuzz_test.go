@@ -0,0 +1,99 @@
+package queue
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+// fuzzRecords splits fuzz data into leveldb keys and values,
+// each prefixed with its length byte
+func fuzzRecords(data []byte) [][2][]byte {
+	next := func() []byte {
+		if len(data) == 0 {
+			return nil
+		}
+		n := int(data[0])
+		data = data[1:]
+		if n > len(data) {
+			n = len(data)
+		}
+		chunk := data[:n]
+		data = data[n:]
+		return chunk
+	}
+	records := [][2][]byte{}
+	for len(data) > 0 {
+		key := next()
+		records = append(records, [2][]byte{key, next()})
+	}
+	return records
+}
+
+func fuzzRecord(key []byte, item *Item) []byte {
+	record := encodeItem(item)
+	return append(append([]byte{byte(len(key))}, key...), append([]byte{byte(len(record))}, record...)...)
+}
+
+func fuzzKey(prefix []byte, offset uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, offset)
+	return append(append([]byte(nil), prefix...), key...)
+}
+
+// FuzzOpen opens queues over random database contents, a damaged queue
+// may fail to open or to return items, but must not crash the server
+func FuzzOpen(f *testing.F) {
+	f.Add([]byte{})
+	f.Add(fuzzRecord(fuzzKey(nil, 1), &Item{Value: []byte("1")}))
+	f.Add(append(fuzzRecord(fuzzKey(nil, 0), &Item{Value: []byte("0")}),
+		fuzzRecord(fuzzKey(nil, 1<<64-1), &Item{Value: []byte("1")})...))
+	f.Add(append(fuzzRecord(fuzzKey(nil, 5), &Item{Value: []byte("5"), Headers: []Header{{"k", "v"}}}),
+		fuzzRecord(fuzzKey(nil, 2), &Item{Value: []byte("2"), Blob: &Blob{ID: 1, Size: 3, Chunks: 1}})...))
+	f.Add(fuzzRecord(fuzzKey(delayedPrefix, 1), &Item{Value: []byte("d")}))
+	f.Add(fuzzRecord(fuzzKey(archivePrefix, 1), &Item{Value: []byte("a")}))
+	f.Add(append([]byte{byte(len(formatKey))}, append(formatKey, 1, 1)...))
+	f.Add([]byte{8, 0, 0, 0, 0, 0, 0, 0, 1, 2, 1, 0xff})
+	// A key that is not an offset in a database of the raw values format
+	f.Add([]byte{1, 'k', 1, 'v'})
+	f.Add(append([]byte{byte(len(delayedPrefix))}, delayedPrefix...))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		dataDir, err := ioutil.TempDir("", "siberite_fuzz")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dataDir)
+
+		db, err := leveldb.OpenFile(dataDir+"/"+name, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, record := range fuzzRecords(data) {
+			db.Put(record[0], record[1], nil)
+		}
+		db.Close()
+
+		q, err := Open(name, dataDir)
+		defer q.Close()
+		if err != nil {
+			return
+		}
+		q.Length()
+		q.Peek()
+		q.PeekTail()
+		q.Sample(3)
+		q.Check(true)
+		for i := 0; i < 10; i++ {
+			if _, err = q.Dequeue(); err != nil {
+				break
+			}
+		}
+		q.Prepend(&Item{Value: []byte("p")})
+		q.Enqueue([]byte("e"))
+		q.Dequeue()
+	})
+}
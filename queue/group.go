@@ -0,0 +1,185 @@
+package queue
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// groupCommitStep is added to the commit window when batches keep latency
+// under the target, so the window can grow again after dropping to zero
+const groupCommitStep = 50 * time.Microsecond
+
+// groupCommitSamples is a number of enqueue latencies the window adapts to
+const groupCommitSamples = 100
+
+// groupCommit collects concurrent enqueues into batches written at once.
+// The first enqueue of a batch leads it: it waits for a commit window,
+// closes the batch and writes its items. The window adapts to the p99
+// latency of enqueues, waits of batch members included, shrinking when it
+// is over the target or nobody joined a batch and growing while batches
+// stay under the target.
+type groupCommit struct {
+	target    time.Duration
+	maxWindow time.Duration
+	maxBatch  int
+
+	sync.Mutex
+	window time.Duration
+	// open is a batch enqueues join, it is closed by its leader or once full
+	open *groupBatch
+	// opened counts batches, so a leader sees enqueues arriving meanwhile
+	opened uint64
+	// latencies are collected until there are groupCommitSamples of them
+	latencies []time.Duration
+	p99       time.Duration
+	batches   uint64
+	items     uint64
+}
+
+type groupBatch struct {
+	pending []*pendingEnqueue
+	// full is closed when pending reaches maxBatch
+	full chan struct{}
+}
+
+type pendingEnqueue struct {
+	item  *Item
+	start time.Time
+	done  chan error
+}
+
+// GroupCommitStats are a current commit window, the last p99 enqueue latency
+// and counts of written batches and items, see SetGroupCommit
+type GroupCommitStats struct {
+	Window  time.Duration
+	P99     time.Duration
+	Batches uint64
+	Items   uint64
+}
+
+// SetGroupCommit makes concurrent EnqueueItem calls share writes, a commit
+// window up to maxWindow adapts to keep p99 enqueue latency under target.
+// It must be called before the queue is used.
+func (q *Queue) SetGroupCommit(target time.Duration, maxWindow time.Duration, maxBatch int) {
+	q.group = &groupCommit{target: target, maxWindow: maxWindow, maxBatch: maxBatch}
+}
+
+// GroupCommitStats returns group commit stats, nil when it is not set
+func (q *Queue) GroupCommitStats() *GroupCommitStats {
+	g := q.group
+	if g == nil {
+		return nil
+	}
+	g.Lock()
+	defer g.Unlock()
+	return &GroupCommitStats{
+		Window:  g.window,
+		P99:     g.p99,
+		Batches: atomic.LoadUint64(&g.batches),
+		Items:   atomic.LoadUint64(&g.items),
+	}
+}
+
+// enqueueGrouped adds an item to a pending batch and waits until it is written
+func (q *Queue) enqueueGrouped(item *Item) error {
+	g := q.group
+	p := &pendingEnqueue{item: item, start: time.Now(), done: make(chan error, 1)}
+	g.Lock()
+	b := g.open
+	leader := b == nil
+	if leader {
+		b = &groupBatch{full: make(chan struct{})}
+		g.open = b
+		g.opened++
+	}
+	b.pending = append(b.pending, p)
+	if len(b.pending) == g.maxBatch {
+		close(b.full)
+		g.open = nil
+	}
+	window := g.window
+	g.Unlock()
+	if !leader {
+		return <-p.done
+	}
+
+	if window > 0 {
+		timer := time.NewTimer(window)
+		select {
+		case <-b.full:
+		case <-timer.C:
+		}
+		timer.Stop()
+	}
+
+	// The batch is closed before waiting for the queue lock,
+	// enqueues arriving meanwhile lead a new one
+	g.Lock()
+	if g.open == b {
+		g.open = nil
+	}
+	batch, opened := b.pending, g.opened
+	g.Unlock()
+	items := make([]*Item, len(batch))
+	for i, p := range batch {
+		items[i] = p.item
+	}
+	q.Lock()
+	err := q.WriteRecords(q.PrepareRecords(items))
+	q.Unlock()
+
+	if err != nil {
+		for _, item := range items {
+			item.Key = nil
+		}
+	}
+	for _, p := range batch[1:] {
+		p.done <- err
+	}
+	written := time.Now()
+	latencies := make([]time.Duration, len(batch))
+	for i, p := range batch {
+		latencies[i] = written.Sub(p.start)
+	}
+	atomic.AddUint64(&g.batches, 1)
+	atomic.AddUint64(&g.items, uint64(len(batch)))
+	g.Lock()
+	joined := len(batch) > 1 || g.opened != opened
+	g.Unlock()
+	g.adapt(latencies, joined)
+	return err
+}
+
+// adapt halves the window when nobody joined a batch or p99 latency of
+// the last groupCommitSamples enqueues is over the target, the window grows
+// by a quarter up to maxWindow when the p99 is under the target
+func (g *groupCommit) adapt(latencies []time.Duration, joined bool) {
+	g.Lock()
+	defer g.Unlock()
+	g.latencies = append(g.latencies, latencies...)
+	measured := len(g.latencies) >= groupCommitSamples
+	if measured {
+		sort.Slice(g.latencies, func(i, j int) bool { return g.latencies[i] < g.latencies[j] })
+		g.p99 = g.latencies[(len(g.latencies)*99+99)/100-1]
+		g.latencies = g.latencies[:0]
+	}
+	switch {
+	case !joined || measured && g.p99 > g.target:
+		g.shrink()
+	case measured:
+		g.window += g.window/4 + groupCommitStep
+		if g.window > g.maxWindow {
+			g.window = g.maxWindow
+		}
+	}
+}
+
+// shrink halves the window, caller must hold the group lock
+func (g *groupCommit) shrink() {
+	g.window /= 2
+	if g.window < groupCommitStep {
+		g.window = 0
+	}
+}
@@ -0,0 +1,103 @@
+package queue
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_GroupCommit(t *testing.T) {
+	q, err := Open(name, dir)
+	defer q.Drop()
+	assert.Nil(t, err)
+	q.SetGroupCommit(time.Second, 20*time.Millisecond, 10)
+	q.group.window = 20 * time.Millisecond
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			assert.Nil(t, q.Enqueue([]byte(strconv.Itoa(i))))
+		}(i)
+	}
+	wg.Wait()
+
+	// A full batch is written before the window passes
+	stats := q.GroupCommitStats()
+	assert.Equal(t, uint64(10), stats.Items)
+	assert.True(t, stats.Batches < 10)
+	assert.Equal(t, uint64(10), q.Length())
+	assert.True(t, stats.Window <= 20*time.Millisecond)
+
+	// Enqueues without company shrink the window
+	for i := 0; i < 20; i++ {
+		q.Enqueue([]byte("single"))
+	}
+	stats = q.GroupCommitStats()
+	assert.Equal(t, time.Duration(0), stats.Window)
+	assert.Equal(t, uint64(30), q.Length())
+	item, err := q.Dequeue()
+	assert.Nil(t, err)
+	assert.NotEmpty(t, item.Value)
+}
+
+func Test_GroupCommit_Adapt(t *testing.T) {
+	g := &groupCommit{target: time.Millisecond, maxWindow: 2 * time.Millisecond}
+	latencies := func(latency time.Duration, n int) []time.Duration {
+		samples := make([]time.Duration, n)
+		for i := range samples {
+			samples[i] = latency
+		}
+		return samples
+	}
+
+	// The window adapts once per groupCommitSamples latencies
+	g.adapt(latencies(100*time.Microsecond, groupCommitSamples-1), true)
+	assert.Equal(t, time.Duration(0), g.window)
+	g.adapt(latencies(100*time.Microsecond, 1), true)
+	assert.Equal(t, groupCommitStep, g.window)
+	assert.Equal(t, 100*time.Microsecond, g.p99)
+	for i := 0; i < 50; i++ {
+		g.adapt(latencies(100*time.Microsecond, groupCommitSamples), true)
+	}
+	assert.Equal(t, 2*time.Millisecond, g.window)
+
+	// Waits of batch members over the target halve the window
+	samples := latencies(100*time.Microsecond, groupCommitSamples-2)
+	g.adapt(append(samples, 3*time.Millisecond, 3*time.Millisecond), true)
+	assert.Equal(t, 3*time.Millisecond, g.p99)
+	assert.Equal(t, time.Millisecond, g.window)
+	g.adapt(latencies(100*time.Microsecond, 1), false)
+	assert.Equal(t, 500*time.Microsecond, g.window)
+}
+
+func Test_GroupCommit_MaxBatch(t *testing.T) {
+	q, err := Open(name, dir)
+	defer q.Drop()
+	assert.Nil(t, err)
+	q.SetGroupCommit(time.Second, time.Second, 3)
+	q.group.window = time.Second
+
+	// Enqueues waiting for the queue lock don't join a closed batch
+	q.Lock()
+	var wg sync.WaitGroup
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			assert.Nil(t, q.Enqueue([]byte(strconv.Itoa(i))))
+		}(i)
+	}
+	time.Sleep(50 * time.Millisecond)
+	q.Unlock()
+	wg.Wait()
+
+	stats := q.GroupCommitStats()
+	assert.Equal(t, uint64(6), stats.Items)
+	assert.Equal(t, uint64(2), stats.Batches)
+	assert.Equal(t, uint64(6), q.Length())
+}
@@ -0,0 +1,46 @@
+package queue
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"time"
+
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+// ErrHeadChanged is returned by RemoveHead when the item is no longer the head item
+var ErrHeadChanged = errors.New("Queue head item changed")
+
+// Front returns the head item without removing it, due delayed items
+// are promoted and expired items dropped on the way as with Dequeue
+func (q *Queue) Front() (*Item, error) {
+	q.Lock()
+	defer q.unlockExpiring()
+	return q.headItem(time.Now())
+}
+
+// RemoveHead removes an item returned by Front if it is still the head item,
+// so an item is removed only once it was handed over elsewhere. Blob chunks
+// of the item are kept until DeleteBlob as with Dequeue.
+func (q *Queue) RemoveHead(item *Item) error {
+	q.Lock()
+	defer q.Unlock()
+	head, err := q.peek()
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(head.Key, item.Key) || !head.EnqueuedAt.Equal(item.EnqueuedAt) {
+		return ErrHeadChanged
+	}
+	batch := new(leveldb.Batch)
+	batch.Delete(item.Key)
+	release(batch, item)
+	if err = q.db.Write(batch, nil); err != nil {
+		return err
+	}
+	q.head = binary.BigEndian.Uint64(item.Key)
+	q.observeDequeue(item)
+	q.verifyDequeue(item)
+	return nil
+}
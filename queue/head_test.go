@@ -0,0 +1,50 @@
+package queue
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Front(t *testing.T) {
+	q, err := Open(name, dir)
+	defer q.Drop()
+	assert.Nil(t, err)
+
+	_, err = q.Front()
+	assert.Equal(t, ErrEmpty, err)
+
+	q.EnqueueItem(&Item{Value: []byte("expired"), ExpiresAt: time.Now().Add(-time.Second)})
+	q.Enqueue([]byte("1"))
+	q.Enqueue([]byte("2"))
+
+	item, err := q.Front()
+	assert.Nil(t, err)
+	assert.Equal(t, "1", string(item.Value))
+	assert.Equal(t, uint64(2), q.Length())
+
+	assert.Nil(t, q.RemoveHead(item))
+	assert.Equal(t, uint64(1), q.Length())
+	// The item was already removed
+	assert.Equal(t, ErrHeadChanged, q.RemoveHead(item))
+
+	item, _ = q.Front()
+	q.Dequeue()
+	assert.Equal(t, ErrEmpty, q.RemoveHead(item))
+}
+
+func Test_Front_Delayed(t *testing.T) {
+	q, err := Open(name, dir)
+	defer q.Drop()
+	assert.Nil(t, err)
+
+	q.Enqueue([]byte("1"))
+	item, _ := q.Dequeue()
+	assert.Nil(t, q.Delay(item, time.Now().Add(-time.Millisecond)))
+
+	item, err = q.Front()
+	assert.Nil(t, err)
+	assert.Equal(t, "1", string(item.Value))
+	assert.Equal(t, uint64(0), q.Delayed())
+}
@@ -0,0 +1,270 @@
+package queue
+
+import (
+	"encoding/binary"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/bogdanovich/siberite/hlc"
+	"github.com/bogdanovich/siberite/trace"
+)
+
+// Item represents a queue item
+type Item struct {
+	Key        []byte
+	Value      []byte
+	Size       int32
+	Flags      uint32
+	Headers    []Header
+	EnqueuedAt time.Time
+	// Blob references chunked value, Value is empty for such items
+	Blob *Blob
+	// Aborts counts aborts caused by consumer disconnects
+	Aborts uint32
+	// Deliveries counts times the item was opened by consumers
+	Deliveries uint32
+	// MessageID is a globally unique id given on enqueue, copies
+	// of the item in other queues and on other servers keep it
+	MessageID string
+	// ExpiresAt is a time after which the item is dropped instead
+	// of being dequeued, zero for items that never expire
+	ExpiresAt time.Time
+	// Span is a span of the command storing the item, storage
+	// operations are traced as its children, it is not stored
+	Span trace.Span
+}
+
+// Header represents a key=value pair attached to an item
+type Header struct {
+	Key   string
+	Value string
+}
+
+// ID returns item position in the queue, zero for items not stored yet
+func (item *Item) ID() uint64 {
+	if len(item.Key) != 8 {
+		return 0
+	}
+	return binary.BigEndian.Uint64(item.Key)
+}
+
+// ValueSize returns a size of item value, chunked values included,
+// zero for nil items
+func (item *Item) ValueSize() int64 {
+	switch {
+	case item == nil:
+		return 0
+	case item.Blob != nil:
+		return item.Blob.Size
+	}
+	return int64(len(item.Value))
+}
+
+// UniqueID returns the message id of an item, items stored
+// before message ids were given are identified by their offset
+func (item *Item) UniqueID() string {
+	if item.MessageID != "" {
+		return item.MessageID
+	}
+	return strconv.FormatUint(item.ID(), 10)
+}
+
+// Expired reports whether the item expired by a given time
+func (item *Item) Expired(now time.Time) bool {
+	return !item.ExpiresAt.IsZero() && !now.Before(item.ExpiresAt)
+}
+
+// stamp sets enqueue time and message id of an item enqueued
+// for the first time, copies keep those of the original item
+func (item *Item) stamp(now time.Time) {
+	if item.EnqueuedAt.IsZero() {
+		item.EnqueuedAt = now
+	}
+	if item.MessageID == "" {
+		item.MessageID = hlc.NewID()
+	}
+}
+
+// Header returns a value of the first header with a given key
+func (item *Item) Header(key string) (string, bool) {
+	for _, header := range item.Headers {
+		if header.Key == key {
+			return header.Value, true
+		}
+	}
+	return "", false
+}
+
+// Item records are stored in leveldb as:
+// <version> [<field tag> <uvarint length> <field data>]... <fieldValue> <value>
+const (
+	recordVersion byte = 1
+
+	fieldValue  byte = 0
+	fieldFlags  byte = 1
+	fieldHeader byte = 2
+	fieldTime   byte = 3
+	fieldBlob   byte = 4
+	fieldAborts byte = 5
+	fieldExpiry byte = 6
+	// Builds without the field skip it, so no format migration is needed
+	fieldDeliveries byte = 7
+	fieldMessageID  byte = 8
+)
+
+var errInvalidRecord = errors.New("Invalid item record")
+
+// encodeItem serializes item fields and value into a leveldb record
+func encodeItem(item *Item) []byte {
+	buf := make([]byte, 0, len(item.Value)+16)
+	buf = append(buf, recordVersion)
+	if item.Flags != 0 {
+		buf = appendUvarintField(buf, fieldFlags, uint64(item.Flags))
+	}
+	for _, header := range item.Headers {
+		buf = appendField(buf, fieldHeader, encodeHeader(header))
+	}
+	if !item.EnqueuedAt.IsZero() {
+		buf = appendUvarintField(buf, fieldTime, uint64(item.EnqueuedAt.UnixNano()))
+	}
+	if item.Blob != nil {
+		buf = appendField(buf, fieldBlob, encodeBlob(item.Blob))
+	}
+	if item.Aborts != 0 {
+		buf = appendUvarintField(buf, fieldAborts, uint64(item.Aborts))
+	}
+	if !item.ExpiresAt.IsZero() {
+		buf = appendUvarintField(buf, fieldExpiry, uint64(item.ExpiresAt.UnixNano()))
+	}
+	if item.Deliveries != 0 {
+		buf = appendUvarintField(buf, fieldDeliveries, uint64(item.Deliveries))
+	}
+	if item.MessageID != "" {
+		buf = appendField(buf, fieldMessageID, []byte(item.MessageID))
+	}
+	buf = append(buf, fieldValue)
+	return append(buf, item.Value...)
+}
+
+// decodeItem restores item fields and value from a leveldb record
+func decodeItem(key []byte, record []byte) (*Item, error) {
+	item := &Item{Key: key}
+	if len(record) < 2 || record[0] != recordVersion {
+		return item, errInvalidRecord
+	}
+	pos := 1
+	for pos < len(record) {
+		tag := record[pos]
+		pos++
+		if tag == fieldValue {
+			item.Value = record[pos:]
+			item.Size = int32(len(item.Value))
+			if item.Blob != nil {
+				item.Size = int32(item.Blob.Size)
+			}
+			return item, nil
+		}
+		length, n := binary.Uvarint(record[pos:])
+		if n <= 0 || uint64(len(record)-pos-n) < length {
+			return item, errInvalidRecord
+		}
+		pos += n
+		data := record[pos : pos+int(length)]
+		pos += int(length)
+
+		switch tag {
+		case fieldFlags:
+			flags, _ := binary.Uvarint(data)
+			item.Flags = uint32(flags)
+		case fieldHeader:
+			header, err := decodeHeader(data)
+			if err != nil {
+				return item, err
+			}
+			item.Headers = append(item.Headers, header)
+		case fieldTime:
+			nanoseconds, _ := binary.Uvarint(data)
+			item.EnqueuedAt = time.Unix(0, int64(nanoseconds))
+		case fieldBlob:
+			blob, err := decodeBlob(data)
+			if err != nil {
+				return item, err
+			}
+			item.Blob = blob
+		case fieldAborts:
+			aborts, _ := binary.Uvarint(data)
+			item.Aborts = uint32(aborts)
+		case fieldExpiry:
+			nanoseconds, _ := binary.Uvarint(data)
+			item.ExpiresAt = time.Unix(0, int64(nanoseconds))
+		case fieldDeliveries:
+			deliveries, _ := binary.Uvarint(data)
+			item.Deliveries = uint32(deliveries)
+		case fieldMessageID:
+			item.MessageID = string(data)
+		}
+	}
+	return item, errInvalidRecord
+}
+
+func appendUvarintField(buf []byte, tag byte, value uint64) []byte {
+	var data [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(data[:], value)
+	return appendField(buf, tag, data[:n])
+}
+
+func appendField(buf []byte, tag byte, data []byte) []byte {
+	var length [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(length[:], uint64(len(data)))
+	buf = append(buf, tag)
+	buf = append(buf, length[:n]...)
+	return append(buf, data...)
+}
+
+func encodeHeader(header Header) []byte {
+	var length [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(length[:], uint64(len(header.Key)))
+	data := make([]byte, 0, n+len(header.Key)+len(header.Value))
+	data = append(data, length[:n]...)
+	data = append(data, header.Key...)
+	return append(data, header.Value...)
+}
+
+func decodeHeader(data []byte) (Header, error) {
+	length, n := binary.Uvarint(data)
+	if n <= 0 || uint64(len(data)-n) < length {
+		return Header{}, errInvalidRecord
+	}
+	key := data[n : n+int(length)]
+	return Header{string(key), string(data[n+int(length):])}, nil
+}
+
+func encodeBlob(blob *Blob) []byte {
+	data := make([]byte, 4*binary.MaxVarintLen64)
+	n := binary.PutUvarint(data, blob.ID)
+	n += binary.PutUvarint(data[n:], uint64(blob.Chunks))
+	n += binary.PutUvarint(data[n:], uint64(blob.Size))
+	// The flag is omitted for chunked blobs, their records are unchanged
+	if blob.External {
+		n += binary.PutUvarint(data[n:], 1)
+	}
+	return data[:n]
+}
+
+func decodeBlob(data []byte) (*Blob, error) {
+	var values [3]uint64
+	for i := range values {
+		value, n := binary.Uvarint(data)
+		if n <= 0 {
+			return nil, errInvalidRecord
+		}
+		values[i] = value
+		data = data[n:]
+	}
+	blob := &Blob{ID: values[0], Chunks: uint32(values[1]), Size: int64(values[2])}
+	if external, n := binary.Uvarint(data); n > 0 {
+		blob.External = external == 1
+	}
+	return blob, nil
+}
@@ -0,0 +1,76 @@
+package queue
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_encodeDecodeItem(t *testing.T) {
+	testCases := []*Item{
+		{Value: []byte("value")},
+		{Value: []byte("value"), Flags: 1},
+		{Value: []byte("value"), Flags: 4294967295},
+		{Value: []byte{}, Flags: 10},
+		{Value: []byte("value"), Headers: []Header{{"trace", "abc"}, {"route", ""}}},
+		{Value: []byte("value"), EnqueuedAt: time.Unix(1443308758, 123)},
+		{Value: []byte("value"), ExpiresAt: time.Unix(1443308758, 456)},
+		{Value: []byte("value"), Aborts: 2, Deliveries: 3},
+		{Value: []byte("value"), MessageID: "0005225d3a3b70000000002a"},
+	}
+
+	for _, input := range testCases {
+		item, err := decodeItem([]byte("key"), encodeItem(input))
+		assert.Nil(t, err)
+		assert.Equal(t, "key", string(item.Key))
+		assert.Equal(t, string(input.Value), string(item.Value))
+		assert.Equal(t, int32(len(input.Value)), item.Size)
+		assert.Equal(t, input.Flags, item.Flags)
+		assert.Equal(t, input.Headers, item.Headers)
+		assert.True(t, input.EnqueuedAt.Equal(item.EnqueuedAt))
+		assert.True(t, input.ExpiresAt.Equal(item.ExpiresAt))
+		assert.Equal(t, input.Aborts, item.Aborts)
+		assert.Equal(t, input.Deliveries, item.Deliveries)
+		assert.Equal(t, input.MessageID, item.MessageID)
+	}
+}
+
+func Test_ItemHeader(t *testing.T) {
+	item := &Item{Headers: []Header{{"trace", "abc"}, {"route", "eu"}, {"trace", "def"}}}
+
+	value, ok := item.Header("trace")
+	assert.True(t, ok)
+	assert.Equal(t, "abc", value)
+
+	value, ok = item.Header("route")
+	assert.True(t, ok)
+	assert.Equal(t, "eu", value)
+
+	_, ok = item.Header("missing")
+	assert.False(t, ok)
+}
+
+func Test_ItemValueSize(t *testing.T) {
+	var item *Item
+	assert.Equal(t, int64(0), item.ValueSize())
+	assert.Equal(t, int64(3), (&Item{Value: []byte("abc")}).ValueSize())
+	assert.Equal(t, int64(1<<20), (&Item{Blob: &Blob{Size: 1 << 20}}).ValueSize())
+}
+
+func Test_decodeItem_Invalid(t *testing.T) {
+	testCases := [][]byte{
+		nil,
+		[]byte{},
+		[]byte{recordVersion},
+		[]byte{2, fieldValue, 'a'},
+		[]byte{recordVersion, fieldFlags, 10, 1},
+		[]byte{recordVersion, fieldFlags, 1, 1},
+		[]byte{recordVersion, fieldHeader, 2, 5, 'a', fieldValue},
+	}
+
+	for _, input := range testCases {
+		_, err := decodeItem(nil, input)
+		assert.Equal(t, errInvalidRecord, err, "%v", input)
+	}
+}
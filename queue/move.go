@@ -0,0 +1,129 @@
+package queue
+
+import (
+	"encoding/binary"
+	"errors"
+	"time"
+
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+// ErrSameQueue is returned when items are moved to the queue they are taken from
+var ErrSameQueue = errors.New("Can't move items to the same queue")
+
+// Move takes the head item of the queue and enqueues it to dest in one
+// operation, both queues are locked meanwhile. The item with its blob
+// chunks is written to dest before it is removed from the queue, a crash
+// in between leaves it in both queues rather than losing it.
+// The returned item is stored in dest, moved reports whether it was stored
+// there, an error with moved set means it is left in the queue too.
+func (q *Queue) Move(dest *Queue) (item *Item, moved bool, err error) {
+	if dest == q {
+		return &Item{}, false, ErrSameQueue
+	}
+	// Queues are locked in path order, so opposite moves can't deadlock
+	first, second := q, dest
+	if dest.Path() < q.Path() {
+		first, second = dest, q
+	}
+	// Expired items are passed to the expire hook once both queues are unlocked
+	var expired []*Item
+	defer func() { q.expire(expired) }()
+	first.Lock()
+	defer first.Unlock()
+	second.Lock()
+	defer second.Unlock()
+
+	now := time.Now()
+	item, err = q.headItem(now)
+	expired, q.expired = q.expired, nil
+	if err != nil {
+		return item, false, err
+	}
+
+	stored := *item
+	stored.EnqueuedAt = now
+	batch := new(leveldb.Batch)
+	if item.Blob != nil && item.Blob.External {
+		batch.Put(externalKey(item.Blob.ID), nil)
+	} else if item.Blob != nil {
+		for i := uint32(0); i < item.Blob.Chunks; i++ {
+			chunk, err := q.db.Get(blobKey(item.Blob.ID, i), nil)
+			if err != nil {
+				return &Item{}, false, err
+			}
+			batch.Put(blobKey(item.Blob.ID, i), chunk)
+		}
+	}
+	stored.Key = make([]byte, 8)
+	binary.BigEndian.PutUint64(stored.Key, dest.tail+1)
+	batch.Put(stored.Key, encodeItem(&stored))
+	if err = dest.db.Write(batch, nil); err != nil {
+		return &Item{}, false, err
+	}
+	dest.tail++
+	dest.observeEnqueue(1, stored.ValueSize())
+
+	batch.Reset()
+	batch.Delete(item.Key)
+	if item.Blob != nil && item.Blob.External {
+		batch.Delete(externalKey(item.Blob.ID))
+	} else if item.Blob != nil {
+		deleteBlob(batch, item.Blob)
+	}
+	if err = q.db.Write(batch, nil); err != nil {
+		return &stored, true, err
+	}
+	q.head = binary.BigEndian.Uint64(item.Key)
+	q.observeDequeue(item)
+	return &stored, true, nil
+}
+
+// Transfer enqueues an item taken from the queue to dest, the item is
+// written to dest with its blob chunks in one batch before the blob is
+// deleted from the queue. The blob of a taken item is listed as unreferenced,
+// so a crash in between removes it on open and the item is kept only in dest.
+// Offloaded values are copied. The returned item is stored in dest.
+func (q *Queue) Transfer(item *Item, dest *Queue) (*Item, error) {
+	if dest == q {
+		return &Item{}, ErrSameQueue
+	}
+	moved := &Item{Value: item.Value, Flags: item.Flags, Headers: item.Headers,
+		ExpiresAt: item.ExpiresAt, MessageID: item.MessageID}
+	batch := new(leveldb.Batch)
+	if item.Blob != nil && item.Blob.External {
+		blob, err := q.copyBlob(item.Blob, dest)
+		if err != nil {
+			return &Item{}, err
+		}
+		moved.Blob = blob
+	} else if item.Blob != nil {
+		for i := uint32(0); i < item.Blob.Chunks; i++ {
+			chunk, err := q.db.Get(blobKey(item.Blob.ID, i), nil)
+			if err != nil {
+				return &Item{}, err
+			}
+			batch.Put(blobKey(item.Blob.ID, i), chunk)
+		}
+		blob := *item.Blob
+		moved.Blob = &blob
+	}
+
+	dest.Lock()
+	moved.stamp(time.Now())
+	moved.Key = make([]byte, 8)
+	binary.BigEndian.PutUint64(moved.Key, dest.tail+1)
+	batch.Put(moved.Key, encodeItem(moved))
+	reference(batch, moved)
+	err := dest.db.Write(batch, nil)
+	if err == nil {
+		dest.tail++
+		dest.observeEnqueue(1, moved.ValueSize())
+	}
+	dest.Unlock()
+	if err != nil {
+		dest.DeleteBlob(moved.Blob)
+		return &Item{}, err
+	}
+	return moved, q.DeleteBlob(item.Blob)
+}
@@ -0,0 +1,76 @@
+package queue
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Move(t *testing.T) {
+	q, err := Open(name, dir)
+	defer q.Drop()
+	assert.Nil(t, err)
+	dest, err := Open(name+"_processing", dir)
+	defer dest.Drop()
+	assert.Nil(t, err)
+
+	q.Enqueue([]byte("1"))
+	w := q.NewBlobWriter()
+	w.Write([]byte("chunk"))
+	assert.Nil(t, q.EnqueueItem(&Item{Blob: w.Blob(), Flags: 2}))
+
+	item, moved, err := q.Move(dest)
+	assert.Nil(t, err)
+	assert.True(t, moved)
+	assert.Equal(t, "1", string(item.Value))
+	assert.Equal(t, rebaseOffset+1, item.ID())
+
+	item, _, err = q.Move(dest)
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(2), item.Flags)
+	var buf bytes.Buffer
+	assert.Nil(t, dest.WriteBlob(item.Blob, &buf))
+	assert.Equal(t, "chunk", buf.String())
+	assert.NotNil(t, q.WriteBlob(item.Blob, &buf))
+
+	_, moved, err = q.Move(dest)
+	assert.Equal(t, ErrEmpty, err)
+	assert.False(t, moved)
+	_, moved, err = q.Move(q)
+	assert.Equal(t, ErrSameQueue, err)
+	assert.False(t, moved)
+
+	assert.Equal(t, uint64(0), q.Length())
+	assert.Equal(t, uint64(2), dest.Length())
+	first, _ := dest.Dequeue()
+	assert.Equal(t, "1", string(first.Value))
+}
+
+func Test_Transfer(t *testing.T) {
+	q, _ := Open(name, dir)
+	defer q.Drop()
+	dest, _ := Open(name+"_dlq", dir)
+	defer dest.Drop()
+
+	w := q.NewBlobWriter()
+	w.Write([]byte("chunk"))
+	assert.Nil(t, q.EnqueueItem(&Item{Blob: w.Blob(), Flags: 2}))
+	taken, _ := q.Dequeue()
+
+	item, err := q.Transfer(taken, dest)
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(2), item.Flags)
+	assert.Equal(t, taken.MessageID, item.MessageID)
+	assert.Equal(t, 0, countKeys(q, blobPrefix))
+	assert.Equal(t, 0, countKeys(q, unreferencedPrefix))
+	assert.Equal(t, 0, countKeys(dest, unreferencedPrefix))
+
+	item, _ = dest.Dequeue()
+	var buf bytes.Buffer
+	assert.Nil(t, dest.WriteBlob(item.Blob, &buf))
+	assert.Equal(t, "chunk", buf.String())
+
+	_, err = q.Transfer(item, q)
+	assert.Equal(t, ErrSameQueue, err)
+}
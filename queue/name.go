@@ -0,0 +1,152 @@
+package queue
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/syndtr/goleveldb/leveldb/opt"
+)
+
+// Default queue name rules
+const (
+	DefaultNameChars     = "a-zA-Z0-9_"
+	DefaultNameMaxLength = 100
+)
+
+// DefaultNameRule is used by queues opened without a rule
+var DefaultNameRule, _ = NewNameRule(DefaultNameChars, DefaultNameMaxLength)
+
+// reservedNameChars separate queue names from paths, patterns, options,
+// fanout children and partitions
+const reservedNameChars = "/\\*?[+# \r\n\t"
+
+// FanoutSeparator separates a parent queue name from a fanout child name,
+// <parent>+<child> queue gets copies of items enqueued to the parent
+const FanoutSeparator = "+"
+
+// maxDirLength is a common file name length limit of filesystems
+const maxDirLength = 255
+
+// NameRule restricts characters and length of queue names
+type NameRule struct {
+	Chars     string
+	MaxLength int
+	// Encoded names are percent-encoded into directory names,
+	// so they may contain any characters but reserved ones
+	Encoded bool
+	invalid *regexp.Regexp
+}
+
+// NewNameRule creates a rule allowing chars, a body of regexp character
+// class like a-z0-9_, and names up to maxLength bytes long
+func NewNameRule(chars string, maxLength int) (*NameRule, error) {
+	if chars == "" || maxLength <= 0 {
+		return nil, fmt.Errorf("invalid queue name rule %q %d", chars, maxLength)
+	}
+	invalid, err := regexp.Compile("[^" + chars + "]")
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range reservedNameChars {
+		if !invalid.MatchString(string(c)) {
+			return nil, fmt.Errorf("queue name can't contain %q", c)
+		}
+	}
+	return &NameRule{Chars: chars, MaxLength: maxLength, invalid: invalid}, nil
+}
+
+// NewEncodedNameRule creates a rule for names stored percent-encoded,
+// empty chars allow any characters but reserved and control ones
+func NewEncodedNameRule(chars string, maxLength int) (*NameRule, error) {
+	if maxLength <= 0 {
+		return nil, fmt.Errorf("invalid queue name rule %q %d", chars, maxLength)
+	}
+	rule := &NameRule{MaxLength: maxLength, Encoded: true}
+	if chars != "" {
+		r, err := NewNameRule(chars, maxLength)
+		if err != nil {
+			return nil, err
+		}
+		rule.Chars, rule.invalid = r.Chars, r.invalid
+	}
+	return rule, nil
+}
+
+// Validate checks a queue name, names starting with a dot are
+// reserved for service data in data directory. Parent and child
+// names of a fanout child queue are checked separately, a parent
+// may be a partition <queue>#<count>#<index>.
+func (r *NameRule) Validate(name string) error {
+	for i, part := range strings.SplitN(name, FanoutSeparator, 2) {
+		ok := true
+		if i == 0 {
+			part, ok = splitPartition(part)
+		}
+		if !ok || !r.valid(part) {
+			return ErrInvalidName
+		}
+	}
+	if len(name) > r.MaxLength || r.Encoded && len(r.Dir(name)) > maxDirLength {
+		return ErrNameTooLong
+	}
+	return nil
+}
+
+func (r *NameRule) valid(name string) bool {
+	if name == "" {
+		return false
+	}
+	if !r.Encoded {
+		return !strings.HasPrefix(name, ".") && !r.invalid.MatchString(name)
+	}
+	invalid := func(c rune) bool {
+		return unicode.IsControl(c) || unicode.IsSpace(c) || strings.ContainsRune(reservedNameChars, c)
+	}
+	return strings.IndexFunc(name, invalid) < 0 && (r.invalid == nil || !r.invalid.MatchString(name))
+}
+
+// Dir returns a name of a queue directory in data directory
+func (r *NameRule) Dir(name string) string {
+	if !r.Encoded {
+		return name
+	}
+	var dir strings.Builder
+	for i := 0; i < len(name); i++ {
+		if c := name[i]; c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' {
+			dir.WriteByte(c)
+		} else {
+			fmt.Fprintf(&dir, "%%%02X", c)
+		}
+	}
+	return dir.String()
+}
+
+// Name returns a name of a queue kept in a directory, false if the
+// directory name is not a valid queue directory name
+func (r *NameRule) Name(dir string) (string, bool) {
+	if !r.Encoded {
+		return dir, true
+	}
+	name, err := url.PathUnescape(dir)
+	if err != nil || r.Dir(name) != dir {
+		return "", false
+	}
+	return name, true
+}
+
+// OpenWithRule is OpenWithOptions validating the name with a given rule
+func OpenWithRule(name string, dataDir string, options *opt.Options, rule *NameRule) (*Queue, error) {
+	q := newQueue(name, rule)
+	q.DataDir = dataDir
+	return q, q.open(options)
+}
+
+// OpenInMemoryWithRule is OpenInMemory validating the name with a given rule
+func OpenInMemoryWithRule(name string, options *opt.Options, rule *NameRule) (*Queue, error) {
+	q := newQueue(name, rule)
+	q.inMemory = true
+	return q, q.open(options)
+}
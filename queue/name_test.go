@@ -0,0 +1,107 @@
+package queue
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_NameRule(t *testing.T) {
+	rule, err := NewNameRule("a-z0-9_.:-", 10)
+	assert.Nil(t, err)
+	for name, expected := range map[string]error{
+		"orders":      nil,
+		"orders.v2":   nil,
+		"eu:orders-1": ErrNameTooLong,
+		"eu:orders":   nil,
+		"orders+eu":   nil,
+		"jobs#4#0":    nil,
+		"jobs#4#3+eu": ErrNameTooLong,
+		"jobs#4#3+e":  nil,
+		"jobs#4":      ErrInvalidName,
+		"jobs#4#4":    ErrInvalidName,
+		"jobs#04#1":   ErrInvalidName,
+		"jobs#0#0":    ErrInvalidName,
+		"jobs+eu#2#0": ErrInvalidName,
+		"orders+":     ErrInvalidName,
+		"a+b+c":       ErrInvalidName,
+		"Orders":      ErrInvalidName,
+		".meta":       ErrInvalidName,
+		"..":          ErrInvalidName,
+		"":            ErrInvalidName,
+	} {
+		assert.Equal(t, expected, rule.Validate(name), name)
+	}
+
+	assert.Nil(t, DefaultNameRule.Validate(strings.Repeat("a", 100)))
+	assert.Equal(t, ErrInvalidName, DefaultNameRule.Validate("test-1"))
+
+	for _, chars := range []string{"", "a-z/", "a-z ", "\\w*", "a-z\\][", "a-z\\"} {
+		_, err = NewNameRule(chars, 10)
+		assert.NotNil(t, err, chars)
+	}
+	_, err = NewNameRule("a-z", 0)
+	assert.NotNil(t, err)
+
+	q, err := OpenWithRule("test-1", dir, DefaultOptions(), rule)
+	defer q.Drop()
+	assert.Nil(t, err)
+}
+
+func Test_SplitPartitioned(t *testing.T) {
+	base, count, ok := SplitPartitioned("work#4")
+	assert.True(t, ok)
+	assert.Equal(t, "work", base)
+	assert.Equal(t, 4, count)
+	assert.Equal(t, "work#4#3", PartitionName("work#4", 3))
+
+	for _, name := range []string{"work", "work#0", "work#257", "work#4#1", "work#x", "work#+1"} {
+		_, _, ok = SplitPartitioned(name)
+		assert.False(t, ok, name)
+	}
+}
+
+func Test_EncodedNameRule(t *testing.T) {
+	rule, err := NewEncodedNameRule("", 100)
+	assert.Nil(t, err)
+	for name, expected := range map[string]error{
+		"orders":                 nil,
+		".meta":                  nil,
+		"tenant:Café%":           nil,
+		"a b":                    ErrInvalidName,
+		"a\x00":                  ErrInvalidName,
+		"a/b":                    ErrInvalidName,
+		"a*":                     ErrInvalidName,
+		strings.Repeat("é", 50):  ErrNameTooLong,
+		strings.Repeat("a", 101): ErrNameTooLong,
+		strings.Repeat("é", 42):  nil,
+		strings.Repeat("é", 43):  ErrNameTooLong,
+		"":                       ErrInvalidName,
+	} {
+		assert.Equal(t, expected, rule.Validate(name), name)
+	}
+
+	assert.Equal(t, "orders_1", rule.Dir("orders_1"))
+	assert.Equal(t, "tenant%3ACaf%C3%A9%25", rule.Dir("tenant:Café%"))
+	assert.Equal(t, "%2Emeta", rule.Dir(".meta"))
+	for dir, expected := range map[string]string{
+		"orders_1":              "orders_1",
+		"tenant%3ACaf%C3%A9%25": "tenant:Café%",
+		"tenant%3aCaf%c3%a9%25": "",
+		"tenant:Caf":            "",
+		"bad%2":                 "",
+	} {
+		name, ok := rule.Name(dir)
+		assert.Equal(t, expected, name, dir)
+		assert.Equal(t, expected != "", ok, dir)
+	}
+
+	_, ok := DefaultNameRule.Name("tenant%3A")
+	assert.True(t, ok)
+
+	q, err := OpenWithRule("tenant:Café", dir, DefaultOptions(), rule)
+	defer q.Drop()
+	assert.Nil(t, err)
+	assert.Equal(t, dir+"/tenant%3ACaf%C3%A9", q.Path())
+}
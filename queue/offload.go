@@ -0,0 +1,133 @@
+package queue
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+// ErrNoBlobStore is returned when an offloaded value is read or removed
+// by a queue without a blob store
+var ErrNoBlobStore = errors.New("Blob store is not configured")
+
+// External values are listed as <externalPrefix> <blob id> in the queue
+// holding them until they are deleted, so values left by interrupted SET
+// or consumers of a stopped server are found on open. Move lists a value
+// in the destination queue.
+var externalPrefix = []byte{metaPrefix, 'x'}
+
+// BlobStore keeps values of large items outside of queue databases, so
+// compactions don't rewrite them. Values are addressed by blob ID, which is
+// random, so items keep their values when moved between queues and servers
+// may share a store.
+type BlobStore interface {
+	// Create starts a value, it is stored once the writer is closed
+	Create(id uint64) (io.WriteCloser, error)
+	Open(id uint64) (io.ReadCloser, error)
+	Delete(id uint64) error
+}
+
+// SetBlobStore offloads values of at least minSize bytes written with
+// NewSizedBlobWriter to a blob store, item records keep only a reference.
+// It must be called before the queue is used.
+func (q *Queue) SetBlobStore(store BlobStore, minSize int64) {
+	q.blobs = store
+	q.offloadSize = minSize
+}
+
+// RemoveOrphanValues deletes external values listed by the queue that
+// no item referenced on open, it returns the number of deleted values
+func (q *Queue) RemoveOrphanValues() (int, error) {
+	q.Lock()
+	defer q.Unlock()
+	removed := 0
+	for len(q.orphanValues) > 0 {
+		if err := q.deleteExternal(&Blob{ID: q.orphanValues[0], External: true}); err != nil {
+			return removed, err
+		}
+		q.orphanValues = q.orphanValues[1:]
+		removed++
+	}
+	return removed, nil
+}
+
+// NewSizedBlobWriter starts a new blob of a given size, values of
+// the offload size are written to the blob store of the queue
+func (q *Queue) NewSizedBlobWriter(size int64) *BlobWriter {
+	w := q.NewBlobWriter()
+	w.blob.External = q.blobs != nil && size >= q.offloadSize
+	return w
+}
+
+// writeExternal appends p to an offloaded value
+func (w *BlobWriter) writeExternal(p []byte) (int, error) {
+	if w.ext == nil {
+		// The value is listed before it is created, so it is found if interrupted
+		batch := new(leveldb.Batch)
+		batch.Put(externalKey(w.blob.ID), nil)
+		batch.Put(unreferencedKey(w.blob.ID), nil)
+		if err := w.q.db.Write(batch, nil); err != nil {
+			return 0, err
+		}
+		ext, err := w.q.blobs.Create(w.blob.ID)
+		if err != nil {
+			return 0, err
+		}
+		w.ext = ext
+	}
+	n, err := w.ext.Write(p)
+	w.blob.Size += int64(n)
+	return n, err
+}
+
+// Close stores an offloaded value, it must be called before
+// the blob is referenced by an item
+func (w *BlobWriter) Close() error {
+	if !w.blob.External {
+		return nil
+	}
+	if w.ext == nil {
+		// Empty values are stored too
+		if _, err := w.writeExternal(nil); err != nil {
+			return err
+		}
+	}
+	return w.ext.Close()
+}
+
+// copyExternal writes an offloaded value to w
+func copyExternal(store BlobStore, blob *Blob, w io.Writer) error {
+	if store == nil {
+		return ErrNoBlobStore
+	}
+	r, err := store.Open(blob.ID)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	_, err = io.Copy(w, r)
+	return err
+}
+
+// deleteExternal removes an offloaded value and its listing
+func (q *Queue) deleteExternal(blob *Blob) error {
+	if q.blobs == nil {
+		return ErrNoBlobStore
+	}
+	if err := q.blobs.Delete(blob.ID); err != nil {
+		return err
+	}
+	batch := new(leveldb.Batch)
+	batch.Delete(externalKey(blob.ID))
+	batch.Delete(unreferencedKey(blob.ID))
+	return q.db.Write(batch, nil)
+}
+
+func externalKey(id uint64) []byte {
+	key := make([]byte, len(externalPrefix)+8)
+	copy(key, externalPrefix)
+	binary.BigEndian.PutUint64(key[len(externalPrefix):], id)
+	return key
+}
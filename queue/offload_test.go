@@ -0,0 +1,164 @@
+package queue
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// memBlobStore keeps offloaded values in memory
+type memBlobStore map[uint64][]byte
+
+type memBlobWriter struct {
+	bytes.Buffer
+	store memBlobStore
+	id    uint64
+}
+
+func (w *memBlobWriter) Close() error {
+	w.store[w.id] = w.Bytes()
+	return nil
+}
+
+func (s memBlobStore) Create(id uint64) (io.WriteCloser, error) {
+	return &memBlobWriter{store: s, id: id}, nil
+}
+
+func (s memBlobStore) Open(id uint64) (io.ReadCloser, error) {
+	value, ok := s[id]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return ioutil.NopCloser(bytes.NewReader(value)), nil
+}
+
+func (s memBlobStore) Delete(id uint64) error {
+	delete(s, id)
+	return nil
+}
+
+func Test_encodeDecodeExternalBlob(t *testing.T) {
+	input := &Item{Blob: &Blob{ID: 7, Size: 5 * ChunkSize, External: true}}
+	item, err := decodeItem([]byte("key"), encodeItem(input))
+	assert.Nil(t, err)
+	assert.Equal(t, input.Blob, item.Blob)
+	assert.Equal(t, int32(5*ChunkSize), item.Size)
+}
+
+func Test_SetBlobStore(t *testing.T) {
+	q, _ := Open(name, dir)
+	defer q.Drop()
+
+	store := memBlobStore{}
+	q.SetBlobStore(store, 10)
+
+	small := q.NewSizedBlobWriter(4)
+	small.Write([]byte("1234"))
+	assert.Nil(t, small.Close())
+	assert.False(t, small.Blob().External)
+	assert.Nil(t, q.EnqueueItem(&Item{Blob: small.Blob()}))
+
+	large := q.NewSizedBlobWriter(10)
+	large.Write([]byte("01234"))
+	large.Write([]byte("56789"))
+	assert.Nil(t, large.Close())
+	assert.True(t, large.Blob().External)
+	assert.Equal(t, 1, len(store))
+	assert.Nil(t, q.EnqueueItem(&Item{Blob: large.Blob()}))
+	assert.Equal(t, 1, countKeys(q, blobPrefix))
+
+	q.Dequeue()
+	item, err := q.Dequeue()
+	assert.Nil(t, err)
+	assert.True(t, item.Blob.External)
+	assert.Equal(t, int32(10), item.Size)
+
+	var buf bytes.Buffer
+	assert.Nil(t, q.WriteBlob(item.Blob, &buf))
+	assert.Equal(t, "0123456789", buf.String())
+	assert.Nil(t, q.DeleteBlob(item.Blob))
+	assert.Equal(t, 0, len(store))
+
+	aborted := q.NewSizedBlobWriter(20)
+	aborted.Write([]byte("0123"))
+	assert.Nil(t, aborted.Abort())
+	assert.Equal(t, 0, len(store))
+}
+
+func Test_SetBlobStore_Expired(t *testing.T) {
+	q, _ := Open(name, dir)
+	defer q.Drop()
+
+	store := memBlobStore{}
+	q.SetBlobStore(store, 1)
+
+	w := q.NewSizedBlobWriter(5)
+	w.Write([]byte("value"))
+	assert.Nil(t, w.Close())
+	assert.Nil(t, q.EnqueueItem(&Item{Blob: w.Blob(), ExpiresAt: time.Now().Add(-time.Second)}))
+
+	_, err := q.Dequeue()
+	assert.NotNil(t, err)
+	assert.Equal(t, 0, len(store))
+}
+
+func Test_NewSizedBlobWriter_NoStore(t *testing.T) {
+	q, _ := Open(name, dir)
+	defer q.Drop()
+
+	w := q.NewSizedBlobWriter(1 << 30)
+	assert.False(t, w.Blob().External)
+	assert.Nil(t, w.Close())
+	assert.Equal(t, ErrNoBlobStore, q.WriteBlob(&Blob{External: true}, ioutil.Discard))
+}
+
+func Test_RemoveOrphanValues(t *testing.T) {
+	q, _ := Open(name, dir)
+	defer q.Drop()
+	dest, _ := Open(name+"_dest", dir)
+	defer dest.Drop()
+
+	store := memBlobStore{}
+	q.SetBlobStore(store, 1)
+	dest.SetBlobStore(store, 1)
+	for _, value := range []string{"moved", "taken", "stored", "interrupted"} {
+		w := q.NewSizedBlobWriter(int64(len(value)))
+		w.Write([]byte(value))
+		assert.Nil(t, w.Close())
+		if value != "interrupted" {
+			assert.Nil(t, q.EnqueueItem(&Item{Blob: w.Blob()}))
+		}
+	}
+	item, _, _ := q.Move(dest)
+	moved := item.Blob.ID
+	// Consumers of a stopped server leave values of taken items
+	taken, _ := q.Dequeue()
+	assert.NotNil(t, taken.Blob)
+	assert.Equal(t, 4, len(store))
+
+	q.Close()
+	dest.Close()
+	q, _ = Open(name, dir)
+	dest, _ = Open(name+"_dest", dir)
+	q.SetBlobStore(store, 1)
+	dest.SetBlobStore(store, 1)
+	removed, err := dest.RemoveOrphanValues()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, removed)
+	removed, err = q.RemoveOrphanValues()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, removed)
+	assert.Equal(t, 2, len(store))
+	assert.Equal(t, 1, countKeys(q, externalPrefix))
+
+	item, _ = dest.Dequeue()
+	assert.Equal(t, moved, item.Blob.ID)
+	var buf bytes.Buffer
+	assert.Nil(t, dest.WriteBlob(item.Blob, &buf))
+	assert.Equal(t, "moved", buf.String())
+}
@@ -0,0 +1,44 @@
+package queue
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sync/atomic"
+)
+
+// SetReadVerification makes Dequeue read a removed item key back and
+// check that the next item is stored at the following offset. Anomalies
+// are passed to fn and counted in Stats.ReadAnomalies, the dequeue itself
+// succeeds. It must be called before the queue is used.
+func (q *Queue) SetReadVerification(fn func(anomaly string)) {
+	q.onAnomaly = fn
+}
+
+// verifyDequeue checks storage after the head item is deleted,
+// caller must hold the queue lock
+func (q *Queue) verifyDequeue(item *Item) {
+	if q.onAnomaly == nil {
+		return
+	}
+	if offset := binary.BigEndian.Uint64(item.Key); offset != q.head {
+		q.anomaly(fmt.Sprintf("dequeued offset %d while head is %d", offset, q.head))
+	}
+	if ok, err := q.db.Has(item.Key, nil); err != nil {
+		q.anomaly(fmt.Sprintf("can't read offset %d back: %s", q.head, err.Error()))
+	} else if ok {
+		q.anomaly(fmt.Sprintf("offset %d is still stored after delete", q.head))
+	}
+	if q.length() == 0 {
+		return
+	}
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, q.head+1)
+	if ok, err := q.db.Has(key, nil); err == nil && !ok {
+		q.anomaly(fmt.Sprintf("offset %d is missing after offset %d", q.head+1, q.head))
+	}
+}
+
+func (q *Queue) anomaly(text string) {
+	atomic.AddUint64(&q.Stats.ReadAnomalies, 1)
+	q.onAnomaly(text)
+}
@@ -0,0 +1,35 @@
+package queue
+
+import (
+	"encoding/binary"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ReadVerification(t *testing.T) {
+	q, err := Open(name, dir)
+	assert.Nil(t, err)
+	defer q.Drop()
+
+	anomalies := []string{}
+	q.SetReadVerification(func(anomaly string) { anomalies = append(anomalies, anomaly) })
+	for _, value := range []string{"1", "2", "3"} {
+		q.Enqueue([]byte(value))
+	}
+	item, err := q.Dequeue()
+	assert.Nil(t, err)
+	assert.Equal(t, "1", string(item.Value))
+	assert.Equal(t, 0, len(anomalies))
+
+	// A key lost under the queue breaks contiguity
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, q.head+2)
+	assert.Nil(t, q.db.Delete(key, nil))
+	item, err = q.Dequeue()
+	assert.Nil(t, err)
+	assert.Equal(t, "2", string(item.Value))
+	assert.Equal(t, []string{fmt.Sprintf("offset %d is missing after offset %d", rebaseOffset+3, rebaseOffset+2)}, anomalies)
+	assert.Equal(t, uint64(1), q.Stats.ReadAnomalies)
+}
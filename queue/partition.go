@@ -0,0 +1,54 @@
+package queue
+
+import (
+	"strconv"
+	"strings"
+)
+
+// PartitionSeparator separates a queue name from a number of its partitions,
+// <queue>#<count> is a partitioned queue of <queue>#<count>#<index> queues
+const PartitionSeparator = "#"
+
+// MaxPartitions limits a number of partitions of a queue
+const MaxPartitions = 256
+
+// SplitPartitioned splits a partitioned queue name <queue>#<count>
+// into a queue name and a number of partitions
+func SplitPartitioned(name string) (base string, count int, ok bool) {
+	parts := strings.Split(name, PartitionSeparator)
+	if len(parts) != 2 {
+		return name, 0, false
+	}
+	count, ok = partitionNumber(parts[1])
+	if !ok || count < 1 || count > MaxPartitions {
+		return name, 0, false
+	}
+	return parts[0], count, true
+}
+
+// PartitionName returns a name of a partition of a partitioned queue
+func PartitionName(name string, index int) string {
+	return name + PartitionSeparator + strconv.Itoa(index)
+}
+
+// splitPartition strips #<count>#<index> of a partition name,
+// ok is false if the suffix is not a valid partition
+func splitPartition(name string) (base string, ok bool) {
+	parts := strings.Split(name, PartitionSeparator)
+	if len(parts) == 1 {
+		return name, true
+	}
+	if len(parts) != 3 {
+		return name, false
+	}
+	count, countOK := partitionNumber(parts[1])
+	index, indexOK := partitionNumber(parts[2])
+	return parts[0], countOK && indexOK && count >= 1 && count <= MaxPartitions && index < count
+}
+
+// partitionNumber parses a decimal number without leading zeros,
+// so every partition has one name
+func partitionNumber(s string) (int, bool) {
+	n, err := strconv.Atoi(s)
+	return n, err == nil && n >= 0 && strconv.Itoa(n) == s
+}
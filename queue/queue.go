@@ -3,15 +3,48 @@ package queue
 import (
 	"encoding/binary"
 	"errors"
+	"math/rand"
 	"os"
-	"regexp"
+	"sort"
 	"sync"
 	"sync/atomic"
+	"time"
+
+	"github.com/bogdanovich/siberite/chaos"
+	"github.com/bogdanovich/siberite/metrics"
 
 	"github.com/syndtr/goleveldb/leveldb"
 	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/storage"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// Keys starting with metaPrefix hold queue metadata,
+// item keys are big endian offsets and always sort before them
+const metaPrefix byte = 0xff
+
+var (
+	formatKey   = []byte{metaPrefix, 'f', 'o', 'r', 'm', 'a', 't'}
+	upgradeKey  = []byte{metaPrefix, 'u', 'p', 'g', 'r', 'a', 'd', 'e'}
+	dedupPrefix = []byte{metaPrefix, 'd'}
+	itemRange   = &util.Range{Start: nil, Limit: []byte{metaPrefix}}
+)
+
+// Errors returned by queue operations, ErrInvalidName is returned for names
+// with characters outside of NameRule chars or reserved ones, see reservedNameChars
+var (
+	ErrEmpty       = errors.New("Queue is empty")
+	ErrInvalidName = errors.New("Queue name is empty, starts with a dot or has characters not allowed by queue_names")
+	ErrNameTooLong = errors.New("Queue name is too long")
 )
 
+// rebaseOffset is the head offset of new queues, queues of older format
+// versions are moved up by it, it leaves room for prepending items
+const rebaseOffset uint64 = 1 << 62
+
+// expireBatch limits expired items removed under the lock at once
+const expireBatch = 1000
+
 // Queue represents a persistent FIFO structure
 // that stores the data in leveldb
 type Queue struct {
@@ -22,39 +55,105 @@ type Queue struct {
 	head     uint64
 	tail     uint64
 	db       *leveldb.DB
+	storage  *countingStorage
 	isOpened bool
+	inMemory bool
+	nameRule *NameRule
+	delayed  uint64
+	nextDue  time.Time
+	archived uint64
+	// added is closed when items are added, see DequeueCtx
+	added chan struct{}
+	// opened counts open items by sequence number, see Barrier
+	opened map[uint64]int
+	// barriers counts waiting barriers, see Rebase
+	barriers int
+	// group batches concurrent enqueues, see SetGroupCommit
+	group *groupCommit
+	// onExpire is called for expired items, see SetExpireHook,
+	// expired items are passed to it once the queue is unlocked
+	onExpire func(item *Item)
+	expired  []*Item
+	// onAnomaly reports storage anomalies, see SetReadVerification
+	onAnomaly func(anomaly string)
+	// blobs keeps values of offloadSize and larger, see SetBlobStore
+	blobs       BlobStore
+	offloadSize int64
+	// orphanValues are external values no item referenced on open
+	orphanValues []uint64
 }
 
 //Stats contains queue level stats
 type Stats struct {
 	OpenTransactions int64
-}
-
-// Item represents a queue item
-type Item struct {
-	Key   []byte
-	Value []byte
-	Size  int32
+	TimeInQueue      *metrics.Histogram
+	// Items aborted by consumer disconnects by outcome
+	DisconnectRequeued     int64
+	DisconnectDelayed      int64
+	DisconnectDeadLettered int64
+	// Access stats, times are unix nanoseconds, zero if never happened
+	LastEnqueue int64
+	LastDequeue int64
+	PeakItems   uint64
+	BytesIn     uint64
+	BytesOut    uint64
+	// Moving averages of items enqueued and dequeued per second
+	EnqueueRate *metrics.Rate
+	DequeueRate *metrics.Rate
+	// LastRebase is unix nanoseconds of the last Rebase, Rebases counts them
+	LastRebase int64
+	Rebases    uint64
+	// ReadAnomalies counts anomalies found by read verification
+	ReadAnomalies uint64
 }
 
 // Open creates a queue and opens underlying leveldb database
 func Open(name string, dataDir string) (*Queue, error) {
-	q := &Queue{
+	return OpenWithOptions(name, dataDir, DefaultOptions())
+}
+
+// OpenWithOptions creates a queue and opens underlying leveldb database
+// with given leveldb options
+func OpenWithOptions(name string, dataDir string, options *opt.Options) (*Queue, error) {
+	return OpenWithRule(name, dataDir, options, DefaultNameRule)
+}
+
+// OpenInMemory creates a queue kept in memory only,
+// items are lost when the queue is closed
+func OpenInMemory(name string, options *opt.Options) (*Queue, error) {
+	return OpenInMemoryWithRule(name, options, DefaultNameRule)
+}
+
+func newStats() *Stats {
+	return &Stats{
+		TimeInQueue: metrics.NewHistogram(metrics.AgeBuckets),
+		EnqueueRate: metrics.NewRate(),
+		DequeueRate: metrics.NewRate(),
+	}
+}
+
+func newQueue(name string, rule *NameRule) *Queue {
+	return &Queue{
 		Name:     name,
-		DataDir:  dataDir,
-		Stats:    &Stats{0},
+		Stats:    newStats(),
 		db:       &leveldb.DB{},
-		head:     0,
-		tail:     0,
-		isOpened: false,
+		nameRule: rule,
+	}
+}
+
+// DefaultOptions returns leveldb options used by Open
+func DefaultOptions() *opt.Options {
+	return &opt.Options{
+		BlockCacher:       opt.NoCacher,
+		DisableBlockCache: true,
 	}
-	return q, q.open()
 }
 
 // Close leveldb database
 func (q *Queue) Close() {
 	if q.isOpened {
 		q.db.Close()
+		q.storage.Close()
 	}
 	q.isOpened = false
 }
@@ -62,7 +161,9 @@ func (q *Queue) Close() {
 // Drop closes and deletes leveldb database
 func (q *Queue) Drop() {
 	q.Close()
-	os.RemoveAll(q.Path())
+	if !q.inMemory {
+		os.RemoveAll(q.Path())
+	}
 }
 
 // Head returns current head offset of the queue
@@ -86,85 +187,422 @@ func (q *Queue) Peek() (*Item, error) {
 	return q.peek()
 }
 
+// PeekAt returns i-th item counting from the head (0 is the head item)
+// without removing it from the queue
+func (q *Queue) PeekAt(i uint64) (*Item, error) {
+	q.RLock()
+	defer q.RUnlock()
+
+	if i >= q.length() {
+		return &Item{}, ErrEmpty
+	}
+	return q.get(q.head + 1 + i)
+}
+
+// PeekTail returns the most recently enqueued item
+// without removing it from the queue
+func (q *Queue) PeekTail() (*Item, error) {
+	q.RLock()
+	defer q.RUnlock()
+
+	if q.length() < 1 {
+		return &Item{}, ErrEmpty
+	}
+	return q.get(q.tail)
+}
+
+// Sample returns up to n items at random offsets between head and tail
+// in queue order without removing them from the queue
+func (q *Queue) Sample(n int) ([]*Item, error) {
+	q.RLock()
+	defer q.RUnlock()
+
+	length := q.length()
+	offsets := []uint64{}
+	if uint64(n) >= length {
+		for i := uint64(0); i < length; i++ {
+			offsets = append(offsets, i)
+		}
+	} else {
+		picked := make(map[uint64]bool, n)
+		for len(offsets) < n {
+			// Offsets of a damaged queue may span over int64
+			i := rand.Uint64() % length
+			if !picked[i] {
+				picked[i] = true
+				offsets = append(offsets, i)
+			}
+		}
+		sort.Slice(offsets, func(i, j int) bool { return offsets[i] < offsets[j] })
+	}
+
+	items := make([]*Item, 0, len(offsets))
+	for _, i := range offsets {
+		item, err := q.get(q.head + 1 + i)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
 // Enqueue adds new value to the queue
 func (q *Queue) Enqueue(value []byte) error {
+	return q.EnqueueItem(&Item{Value: value})
+}
+
+// EnqueueItem adds new item with its flags to the queue
+func (q *Queue) EnqueueItem(item *Item) error {
+	if err := chaos.Storage(); err != nil {
+		return err
+	}
+	if q.group != nil {
+		return q.enqueueGrouped(item)
+	}
 	q.Lock()
 	defer q.Unlock()
 
+	item.stamp(time.Now())
+
 	key := make([]byte, 8)
 	binary.BigEndian.PutUint64(key, q.tail+1)
-	err := q.db.Put(key, value, nil)
+	batch := new(leveldb.Batch)
+	batch.Put(key, encodeItem(item))
+	reference(batch, item)
+	err := q.write(batch, item.Span)
 	if err == nil {
+		item.Key = key
 		q.tail++
+		q.observeEnqueue(1, item.ValueSize())
 	}
 	return err
 }
 
-// Dequeue returns next queue item and removes it from the queue
-func (q *Queue) Dequeue() (*Item, error) {
+// EnqueueUnique adds new item to the queue unless an item with the same
+// deduplication key was enqueued within a given window.
+// Returns false for duplicates.
+func (q *Queue) EnqueueUnique(item *Item, dedupKey string, window time.Duration) (bool, error) {
+	if err := chaos.Storage(); err != nil {
+		return false, err
+	}
 	q.Lock()
 	defer q.Unlock()
 
-	item, err := q.peek()
+	now := time.Now()
+	key := append(append([]byte{}, dedupPrefix...), dedupKey...)
+	value, err := q.read(key, item.Span)
+	if err == nil && len(value) == 8 {
+		seenAt := time.Unix(0, int64(binary.BigEndian.Uint64(value)))
+		if now.Sub(seenAt) < window {
+			return false, nil
+		}
+	} else if err != nil && err != leveldb.ErrNotFound {
+		return false, err
+	}
+
+	item.stamp(now)
+	itemKey := make([]byte, 8)
+	binary.BigEndian.PutUint64(itemKey, q.tail+1)
+	seenAt := make([]byte, 8)
+	binary.BigEndian.PutUint64(seenAt, uint64(now.UnixNano()))
+
+	batch := new(leveldb.Batch)
+	batch.Put(itemKey, encodeItem(item))
+	batch.Put(key, seenAt)
+	reference(batch, item)
+	if err = q.write(batch, item.Span); err != nil {
+		return false, err
+	}
+	item.Key = itemKey
+	q.tail++
+	q.observeEnqueue(1, item.ValueSize())
+	return true, nil
+}
+
+// PurgeDedupKeys removes deduplication keys seen before a given time
+func (q *Queue) PurgeDedupKeys(before time.Time) (int, error) {
+	q.Lock()
+	defer q.Unlock()
+
+	iter := q.db.NewIterator(util.BytesPrefix(dedupPrefix), nil)
+	defer iter.Release()
+	batch := new(leveldb.Batch)
+	for iter.Next() {
+		value := iter.Value()
+		if len(value) != 8 || time.Unix(0, int64(binary.BigEndian.Uint64(value))).Before(before) {
+			batch.Delete(append([]byte{}, iter.Key()...))
+		}
+	}
+	if err := iter.Error(); err != nil {
+		return 0, err
+	}
+	return batch.Len(), q.db.Write(batch, nil)
+}
+
+// Dequeue returns next queue item and removes it from the queue,
+// blob chunks of the item are kept until DeleteBlob
+func (q *Queue) Dequeue() (*Item, error) {
+	// Injected delays don't hold the queue lock
+	if err := chaos.Storage(); err != nil {
+		return &Item{}, err
+	}
+	q.Lock()
+	defer q.unlockExpiring()
+	return q.dequeue()
+}
+
+// dequeue removes the head item, caller must hold the queue lock
+func (q *Queue) dequeue() (*Item, error) {
+	item, err := q.headItem(time.Now())
 	if err != nil {
 		return item, err
 	}
 
-	err = q.db.Delete(item.Key, nil)
+	batch := new(leveldb.Batch)
+	batch.Delete(item.Key)
+	release(batch, item)
+	err = q.write(batch, nil)
 	if err == nil {
-		q.head++
+		q.head = binary.BigEndian.Uint64(item.Key)
+		q.observeDequeue(item)
+		q.verifyDequeue(item)
 	}
 	return item, err
 }
 
+// headItem returns the head item promoting due delayed items and
+// dropping expired ones on the way, caller must hold the queue lock
+func (q *Queue) headItem(now time.Time) (*Item, error) {
+	if err := q.promoteDelayed(now); err != nil {
+		return &Item{}, err
+	}
+
+	item, err := q.peek()
+	for err == nil && item.Expired(now) {
+		if err = q.dropHead(item); err == nil {
+			item, err = q.peek()
+		}
+	}
+	return item, err
+}
+
+// observeDequeue updates access stats of a removed head item
+func (q *Queue) observeDequeue(item *Item) {
+	if !item.EnqueuedAt.IsZero() {
+		q.Stats.TimeInQueue.Observe(time.Since(item.EnqueuedAt))
+	}
+	atomic.StoreInt64(&q.Stats.LastDequeue, time.Now().UnixNano())
+	atomic.AddUint64(&q.Stats.BytesOut, uint64(item.ValueSize()))
+	q.Stats.DequeueRate.Mark(1)
+}
+
+// dropHead removes the head item with its blob chunks, caller must hold the queue lock.
+// With an expire hook the blob is kept for the hook, see unlockExpiring.
+func (q *Queue) dropHead(item *Item) error {
+	batch := new(leveldb.Batch)
+	q.drop(batch, item)
+	if err := q.db.Write(batch, nil); err != nil {
+		return err
+	}
+	q.dropped(item)
+	return nil
+}
+
+// drop adds removal of an expired item to a batch
+func (q *Queue) drop(batch *leveldb.Batch, item *Item) {
+	batch.Delete(item.Key)
+	if item.Blob != nil && q.onExpire == nil && !item.Blob.External {
+		deleteBlob(batch, item.Blob)
+	} else {
+		release(batch, item)
+	}
+}
+
+// dropped moves the head past an expired item removed by a batch,
+// caller must hold the queue lock
+func (q *Queue) dropped(item *Item) {
+	q.head = binary.BigEndian.Uint64(item.Key)
+	if q.onExpire != nil {
+		q.expired = append(q.expired, item)
+	} else if item.Blob != nil && item.Blob.External {
+		q.deleteExternal(item.Blob)
+	}
+}
+
+// SetExpireHook sets a function called for every item removed as expired
+// before its blob chunks are deleted. It is called once the queue is
+// unlocked, fn may read the item blob with WriteBlob.
+// It must be called before the queue is used.
+func (q *Queue) SetExpireHook(fn func(item *Item)) {
+	q.onExpire = fn
+}
+
+// unlockExpiring unlocks the queue and passes items dropped as expired
+// meanwhile to the expire hook, their blobs are deleted afterwards
+func (q *Queue) unlockExpiring() {
+	expired := q.expired
+	q.expired = nil
+	q.Unlock()
+	q.expire(expired)
+}
+
+// expire passes items to the expire hook and deletes their blobs,
+// the queue must not be locked
+func (q *Queue) expire(items []*Item) {
+	for _, item := range items {
+		q.onExpire(item)
+		q.DeleteBlob(item.Blob)
+	}
+}
+
 // Prepend adds new queue intem in from of the queue
 func (q *Queue) Prepend(item *Item) error {
 	q.Lock()
 	defer q.Unlock()
 	if q.head < 1 {
-		return errors.New("Queue head can not be less then zero")
+		return errors.New("Queue offsets are exhausted")
 	}
 	key := make([]byte, 8)
 	binary.BigEndian.PutUint64(key, q.head)
-	err := q.db.Put(key, item.Value, nil)
+	batch := new(leveldb.Batch)
+	batch.Put(key, encodeItem(item))
+	reference(batch, item)
+	err := q.write(batch, item.Span)
 	if err == nil {
 		q.head--
+		q.signal()
 	}
 	return err
 }
 
-// AddOpenTransactions increments OpenTransactions stats item
+// Expire removes items enqueued before a given time from the head
+// of the queue and returns a number of removed items.
+// Items without enqueue time stop expiration. Items are removed
+// in batches of expireBatch, the lock is released between them.
+func (q *Queue) Expire(before time.Time) (int, error) {
+	expired := 0
+	for {
+		n, err := q.expireBatch(before)
+		expired += n
+		if err != nil || n < expireBatch {
+			return expired, err
+		}
+	}
+}
+
+// expireBatch removes up to expireBatch expired head items in one batch
+func (q *Queue) expireBatch(before time.Time) (int, error) {
+	q.Lock()
+	defer q.unlockExpiring()
+
+	start := make([]byte, 8)
+	binary.BigEndian.PutUint64(start, q.head+1)
+	limit := make([]byte, 8)
+	binary.BigEndian.PutUint64(limit, q.tail+1)
+	iter := q.db.NewIterator(&util.Range{Start: start, Limit: limit}, nil)
+	batch := new(leveldb.Batch)
+	var items []*Item
+	for len(items) < expireBatch && iter.Next() {
+		if len(iter.Key()) != 8 {
+			continue
+		}
+		item, err := decodeItem(append([]byte(nil), iter.Key()...), append([]byte(nil), iter.Value()...))
+		if err != nil {
+			iter.Release()
+			return 0, err
+		}
+		if item.EnqueuedAt.IsZero() || !item.EnqueuedAt.Before(before) {
+			break
+		}
+		q.drop(batch, item)
+		items = append(items, item)
+	}
+	iter.Release()
+	if err := iter.Error(); err != nil {
+		return 0, err
+	}
+	if len(items) == 0 {
+		return 0, nil
+	}
+	if err := q.db.Write(batch, nil); err != nil {
+		return 0, err
+	}
+	for _, item := range items {
+		q.dropped(item)
+	}
+	return len(items), nil
+}
+
+// Compact compacts underlying leveldb database
+func (q *Queue) Compact() error {
+	return q.db.CompactRange(util.Range{})
+}
+
+// Age returns how long the head item has been waiting in the queue
+func (q *Queue) Age() time.Duration {
+	item, err := q.Peek()
+	if err != nil || item.EnqueuedAt.IsZero() {
+		return 0
+	}
+	return time.Since(item.EnqueuedAt)
+}
+
+// observeEnqueue updates access stats of stored items and wakes
+// up waiting readers, caller must hold the queue lock
+func (q *Queue) observeEnqueue(items int, size int64) {
+	q.signal()
+	atomic.StoreInt64(&q.Stats.LastEnqueue, time.Now().UnixNano())
+	atomic.AddUint64(&q.Stats.BytesIn, uint64(size))
+	q.Stats.EnqueueRate.Mark(int64(items))
+	if length := q.length(); length > atomic.LoadUint64(&q.Stats.PeakItems) {
+		atomic.StoreUint64(&q.Stats.PeakItems, length)
+	}
+}
+
+// AddOpenTransactions increments OpenTransactions stats item,
+// OpenItem and CloseItem keep track of open items for Barrier too
 func (q *Queue) AddOpenTransactions(value int64) {
 	atomic.AddInt64(&q.Stats.OpenTransactions, value)
 }
 
 // Path returns leveldb database file path
 func (q *Queue) Path() string {
-	return q.DataDir + "/" + q.Name
+	return q.DataDir + "/" + q.nameRule.Dir(q.Name)
 }
 
-func (q *Queue) open() error {
+func (q *Queue) open(options *opt.Options) error {
 	q.Lock()
 	defer q.Unlock()
-	if regexp.MustCompile(`[^a-zA-Z0-9_]+`).MatchString(q.Name) {
-		return errors.New("Queue name is not alphanumeric")
-	}
-
-	if len(q.Name) > 100 {
-		return errors.New("Queue name is too long")
-	}
-
-	o := opt.Options{
-		BlockCacher:       opt.NoCacher,
-		DisableBlockCache: true,
+	if err := q.nameRule.Validate(q.Name); err != nil {
+		return err
 	}
 
+	var stor storage.Storage
 	var err error
-	q.db, err = leveldb.OpenFile(q.Path(), &o)
-	if err != nil {
+	if q.inMemory {
+		stor = storage.NewMemStorage()
+	} else if stor, err = storage.OpenFile(q.Path(), options.GetReadOnly()); err != nil {
+		return err
+	}
+	q.storage = &countingStorage{Storage: stor}
+	if q.db, err = leveldb.Open(q.storage, options); err != nil {
+		stor.Close()
 		return err
 	}
 	q.isOpened = true
+	if err = q.migrate(); err != nil {
+		return err
+	}
+	if err = q.removeOrphanBlobs(); err != nil {
+		return err
+	}
+	if err = q.initializeDelayed(); err != nil {
+		return err
+	}
+	if err = q.initializeArchive(); err != nil {
+		return err
+	}
 	return q.initialize()
 }
 
@@ -174,25 +612,69 @@ func (q *Queue) length() uint64 {
 
 func (q *Queue) peek() (*Item, error) {
 	if q.length() < 1 {
-		return &Item{nil, nil, 0}, errors.New("Queue is empty")
+		return &Item{}, ErrEmpty
+	}
+	item, err := q.get(q.head + 1)
+	if err == leveldb.ErrNotFound {
+		// Offsets lost in an unclean shutdown are skipped,
+		// removing the item moves the head past them
+		return q.nextStored(q.head + 1)
+	}
+	return item, err
+}
+
+// nextStored returns the first item stored at an offset
+// from a given one up to the tail, keys that are not offsets are skipped
+func (q *Queue) nextStored(offset uint64) (*Item, error) {
+	start := make([]byte, 8)
+	binary.BigEndian.PutUint64(start, offset)
+	limit := make([]byte, 8)
+	binary.BigEndian.PutUint64(limit, q.tail+1)
+	iter := q.db.NewIterator(&util.Range{Start: start, Limit: limit}, nil)
+	defer iter.Release()
+	for iter.Next() {
+		if len(iter.Key()) == 8 {
+			return decodeItem(append([]byte(nil), iter.Key()...), append([]byte(nil), iter.Value()...))
+		}
+	}
+	if err := iter.Error(); err != nil {
+		return &Item{}, err
 	}
+	return &Item{}, ErrEmpty
+}
 
+func (q *Queue) get(offset uint64) (*Item, error) {
 	key := make([]byte, 8)
-	binary.BigEndian.PutUint64(key, q.head+1)
-	value, err := q.db.Get(key, nil)
-	item := &Item{key, value, int32(len(value))}
-	return item, err
+	binary.BigEndian.PutUint64(key, offset)
+	record, err := q.read(key, nil)
+	if err != nil {
+		return &Item{Key: key}, err
+	}
+	return decodeItem(key, record)
 }
 
+// initialize sets head and tail from the first and the last item keys,
+// keys that are not offsets are skipped, gaps in between are left to Check.
+// Empty queues start at rebaseOffset.
 func (q *Queue) initialize() error {
-	iter := q.db.NewIterator(nil, nil)
+	iter := q.db.NewIterator(itemRange, nil)
 	defer iter.Release()
 
-	if iter.First() {
+	q.head, q.tail = rebaseOffset, rebaseOffset
+
+	ok := iter.First()
+	for ok && len(iter.Key()) != 8 {
+		ok = iter.Next()
+	}
+	if ok {
 		q.head = binary.BigEndian.Uint64(iter.Key()) - 1
 	}
 
-	if iter.Last() {
+	ok = iter.Last()
+	for ok && len(iter.Key()) != 8 {
+		ok = iter.Prev()
+	}
+	if ok {
 		q.tail = binary.BigEndian.Uint64(iter.Key())
 	}
 
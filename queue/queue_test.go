@@ -1,11 +1,17 @@
 package queue
 
 import (
+	"bytes"
+	"context"
+	"encoding/binary"
 	"os"
 	"strconv"
 	"testing"
+	"time"
 
+	"github.com/bogdanovich/siberite/hlc"
 	"github.com/stretchr/testify/assert"
+	"github.com/syndtr/goleveldb/leveldb"
 )
 
 var dir = "./test_data"
@@ -22,14 +28,14 @@ func Test_Open(t *testing.T) {
 	q, err := Open(name, dir)
 	defer q.Drop()
 	assert.Nil(t, err)
-	assert.Equal(t, uint64(0), q.Head(), "Invalid initial queue state")
-	assert.Equal(t, uint64(0), q.Tail(), "Invalid initial queue state")
+	assert.Equal(t, rebaseOffset, q.Head(), "Invalid initial queue state")
+	assert.Equal(t, rebaseOffset, q.Tail(), "Invalid initial queue state")
 	assert.Equal(t, uint64(0), q.Length(), "Invalid initial queue state")
 
 	invalidQueueName := "%@#*(&($%@#"
 	q2, err := Open(invalidQueueName, dir)
 	defer q2.Drop()
-	assert.Equal(t, "Queue name is not alphanumeric", err.Error())
+	assert.Equal(t, ErrInvalidName.Error(), err.Error())
 
 	invalidQueueName = "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
 	q3, err := Open(invalidQueueName, dir)
@@ -52,14 +58,14 @@ func Test_HeadTail(t *testing.T) {
 
 	for i := 1; i <= queueLength; i++ {
 		_ = q.Enqueue([]byte("1"))
-		assert.Equal(t, uint64(0), q.Head())
-		assert.Equal(t, uint64(i), q.Tail())
+		assert.Equal(t, rebaseOffset, q.Head())
+		assert.Equal(t, rebaseOffset+uint64(i), q.Tail())
 	}
 
 	for i := 1; i <= queueLength; i++ {
 		_, _ = q.Dequeue()
-		assert.Equal(t, uint64(i), q.Head())
-		assert.Equal(t, uint64(queueLength), q.Tail())
+		assert.Equal(t, rebaseOffset+uint64(i), q.Head())
+		assert.Equal(t, rebaseOffset+uint64(queueLength), q.Tail())
 	}
 
 }
@@ -79,6 +85,65 @@ func Test_Peek(t *testing.T) {
 	}
 }
 
+func Test_PeekAtPeekTail(t *testing.T) {
+	q, _ := Open(name, dir)
+	defer q.Drop()
+
+	_, err = q.PeekAt(0)
+	assert.NotNil(t, err)
+	_, err = q.PeekTail()
+	assert.NotNil(t, err)
+
+	for i := 1; i <= 5; i++ {
+		q.Enqueue([]byte(strconv.Itoa(i)))
+	}
+	q.Dequeue()
+
+	for i := 0; i < 4; i++ {
+		item, err := q.PeekAt(uint64(i))
+		assert.Nil(t, err)
+		assert.Equal(t, strconv.Itoa(i+2), string(item.Value))
+	}
+
+	_, err = q.PeekAt(4)
+	assert.Equal(t, "Queue is empty", err.Error())
+
+	item, err := q.PeekTail()
+	assert.Nil(t, err)
+	assert.Equal(t, "5", string(item.Value))
+	assert.Equal(t, uint64(4), q.Length())
+}
+
+func Test_Sample(t *testing.T) {
+	q, _ := Open(name, dir)
+	defer q.Drop()
+
+	items, err := q.Sample(3)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(items))
+
+	for i := 1; i <= 100; i++ {
+		q.Enqueue([]byte(strconv.Itoa(i)))
+	}
+	q.Dequeue()
+
+	items, err = q.Sample(10)
+	assert.Nil(t, err)
+	assert.Equal(t, 10, len(items))
+	last := 1
+	for _, item := range items {
+		value, _ := strconv.Atoi(string(item.Value))
+		assert.True(t, value > last, "items are distinct and in queue order")
+		last = value
+	}
+	assert.Equal(t, uint64(99), q.Length())
+
+	items, err = q.Sample(1000)
+	assert.Nil(t, err)
+	assert.Equal(t, 99, len(items))
+	assert.Equal(t, "2", string(items[0].Value))
+}
+
 func Test_EnqueueDequeueLength(t *testing.T) {
 	q, _ := Open(name, dir)
 	defer q.Drop()
@@ -117,18 +182,59 @@ func Test_Prepend(t *testing.T) {
 	item, _ := q.Dequeue()
 	q.Dequeue()
 
-	assert.Equal(t, uint64(2), q.Head())
+	assert.Equal(t, rebaseOffset+2, q.Head())
 
 	err = q.Prepend(item)
 	assert.Nil(t, err)
 
-	assert.Equal(t, uint64(1), q.Head())
+	assert.Equal(t, rebaseOffset+1, q.Head())
 
 	// Check that we get the same item with the next Dequeue
 	item, _ = q.Dequeue()
 	assert.Equal(t, "1", string(item.Value))
 }
 
+func Test_Prepend_ZeroHead(t *testing.T) {
+	q, _ := Open(name, dir)
+
+	// An empty queue takes an item aborted after a flush
+	assert.Nil(t, q.Prepend(&Item{Value: []byte("0")}))
+	assert.Equal(t, uint64(1), q.Length())
+	item, _ := q.Dequeue()
+	assert.Equal(t, "0", string(item.Value))
+	q.Drop()
+
+	// A queue of format version 1 started at offset zero
+	q, _ = Open(name, dir)
+	for i, value := range []string{"1", "2"} {
+		key := make([]byte, 8)
+		binary.BigEndian.PutUint64(key, uint64(i+1))
+		assert.Nil(t, q.db.Put(key, encodeItem(&Item{Value: []byte(value)}), nil))
+	}
+	q.Close()
+	assert.Nil(t, q.writeFormat(1))
+
+	// Its items are moved up on open, so the first item can be aborted
+	q, err = Open(name, dir)
+	assert.Nil(t, err)
+	assert.Equal(t, rebaseOffset, q.Head())
+	assert.Equal(t, rebaseOffset+2, q.Tail())
+	item, _ = q.Dequeue()
+	assert.Nil(t, q.Prepend(item))
+	assert.Nil(t, q.Prepend(&Item{Value: []byte("x")}))
+	assert.Equal(t, rebaseOffset-1, q.Head())
+
+	q.Close()
+	q, _ = Open(name, dir)
+	for _, value := range []string{"x", "1", "2"} {
+		item, err := q.Dequeue()
+		assert.Nil(t, err)
+		assert.Equal(t, value, string(item.Value))
+	}
+	assert.Equal(t, uint64(0), q.Length())
+	q.Drop()
+}
+
 func Test_Length(t *testing.T) {
 	q, _ := Open(name, dir)
 	defer q.Drop()
@@ -186,8 +292,286 @@ func Test_initialize(t *testing.T) {
 	assert.Equal(t, uint64(expectedTail), q.Tail())
 }
 
+func Test_EnqueueItemFlags(t *testing.T) {
+	q, _ := Open(name, dir)
+	defer q.Drop()
+
+	err = q.EnqueueItem(&Item{Value: []byte("1"), Flags: 12})
+	assert.Nil(t, err)
+	q.Enqueue([]byte("2"))
+
+	item, err := q.Dequeue()
+	assert.Nil(t, err)
+	assert.Equal(t, "1", string(item.Value))
+	assert.Equal(t, uint32(12), item.Flags)
+
+	err = q.Prepend(item)
+	assert.Nil(t, err)
+
+	// Flags survive abort and reopen
+	q.Close()
+	q, err = Open(name, dir)
+	assert.Nil(t, err)
+
+	item, _ = q.Dequeue()
+	assert.Equal(t, "1", string(item.Value))
+	assert.Equal(t, uint32(12), item.Flags)
+
+	item, _ = q.Dequeue()
+	assert.Equal(t, "2", string(item.Value))
+	assert.Equal(t, uint32(0), item.Flags)
+}
+
+func Test_EnqueueItemMessageID(t *testing.T) {
+	q, _ := Open(name, dir)
+	defer q.Drop()
+
+	q.Enqueue([]byte("1"))
+	q.EnqueueItem(&Item{Value: []byte("2"), MessageID: "0005225d3a3b70000000002a"})
+	q.EnqueueItem(&Item{Value: []byte("3")})
+
+	first, _ := q.Dequeue()
+	second, _ := q.Dequeue()
+	third, _ := q.Dequeue()
+	assert.Len(t, first.MessageID, hlc.IDLength)
+	assert.Equal(t, "0005225d3a3b70000000002a", second.MessageID)
+	assert.True(t, first.MessageID < third.MessageID)
+
+	// The id survives abort
+	q.Prepend(third)
+	item, _ := q.Dequeue()
+	assert.Equal(t, third.MessageID, item.MessageID)
+}
+
+func Test_upgrade(t *testing.T) {
+	q, _ := Open(name, dir)
+	q.Drop()
+
+	// Write raw values the way older versions did
+	db, err := leveldb.OpenFile(q.Path(), nil)
+	assert.Nil(t, err)
+	for i := 1; i <= 2500; i++ {
+		key := make([]byte, 8)
+		binary.BigEndian.PutUint64(key, uint64(i))
+		db.Put(key, []byte(strconv.Itoa(i)), nil)
+	}
+	db.Close()
+
+	q, err = Open(name, dir)
+	defer q.Drop()
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(2500), q.Length())
+
+	for i := 1; i <= 2500; i++ {
+		item, err := q.Dequeue()
+		assert.Nil(t, err)
+		assert.Equal(t, strconv.Itoa(i), string(item.Value))
+	}
+
+	// Upgrade runs only once
+	q.Enqueue([]byte("1"))
+	q.Close()
+	q, err = Open(name, dir)
+	assert.Nil(t, err)
+	item, err := q.Dequeue()
+	assert.Nil(t, err)
+	assert.Equal(t, "1", string(item.Value))
+}
+
+func Test_Age(t *testing.T) {
+	q, _ := Open(name, dir)
+	defer q.Drop()
+
+	assert.Equal(t, time.Duration(0), q.Age())
+
+	q.EnqueueItem(&Item{Value: []byte("1"), EnqueuedAt: time.Now().Add(-time.Minute)})
+	q.Enqueue([]byte("2"))
+	assert.True(t, q.Age() >= time.Minute)
+
+	q.Dequeue()
+	assert.True(t, q.Age() < time.Minute)
+	assert.Equal(t, uint64(1), q.Stats.TimeInQueue.Count())
+	assert.True(t, q.Stats.TimeInQueue.Sum() >= time.Minute)
+}
+
+func Test_Expire(t *testing.T) {
+	q, _ := Open(name, dir)
+	defer q.Drop()
+
+	now := time.Now()
+	q.EnqueueItem(&Item{Value: []byte("1"), EnqueuedAt: now.Add(-3 * time.Hour)})
+	q.EnqueueItem(&Item{Value: []byte("2"), EnqueuedAt: now.Add(-2 * time.Hour)})
+	q.EnqueueItem(&Item{Value: []byte("3"), EnqueuedAt: now})
+
+	expired, err := q.Expire(now.Add(-time.Hour))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, expired)
+	assert.Equal(t, uint64(1), q.Length())
+
+	expired, err = q.Expire(now.Add(-time.Hour))
+	assert.Nil(t, err)
+	assert.Equal(t, 0, expired)
+
+	item, _ := q.Peek()
+	assert.Equal(t, "3", string(item.Value))
+
+	assert.Nil(t, q.Compact())
+}
+
+func Test_Expire_Batches(t *testing.T) {
+	q, _ := Open(name, dir)
+	defer q.Drop()
+
+	now := time.Now()
+	for i := 0; i < expireBatch*2+1; i++ {
+		q.EnqueueItem(&Item{Value: []byte("1"), EnqueuedAt: now.Add(-2 * time.Hour)})
+	}
+	q.EnqueueItem(&Item{Value: []byte("2"), EnqueuedAt: now})
+
+	expired, err := q.Expire(now.Add(-time.Hour))
+	assert.Nil(t, err)
+	assert.Equal(t, expireBatch*2+1, expired)
+	assert.Equal(t, uint64(1), q.Length())
+	item, _ := q.Peek()
+	assert.Equal(t, "2", string(item.Value))
+}
+
+func Test_SetExpireHook(t *testing.T) {
+	q, _ := Open(name, dir)
+	defer q.Drop()
+	expired := []string{}
+	q.SetExpireHook(func(item *Item) {
+		// The hook runs once the queue is unlocked, blobs are still stored
+		var buf bytes.Buffer
+		if item.Blob != nil {
+			assert.Nil(t, q.WriteBlob(item.Blob, &buf))
+		}
+		expired = append(expired, string(item.Value)+buf.String())
+		q.Length()
+	})
+
+	now := time.Now()
+	q.EnqueueItem(&Item{Value: []byte("1"), EnqueuedAt: now.Add(-2 * time.Hour)})
+	w := q.NewBlobWriter()
+	w.Write([]byte("blob"))
+	q.EnqueueItem(&Item{Blob: w.Blob(), ExpiresAt: now.Add(-time.Second)})
+	q.EnqueueItem(&Item{Value: []byte("3")})
+
+	q.Expire(now.Add(-time.Hour))
+	item, err := q.Dequeue()
+	assert.Nil(t, err)
+	assert.Equal(t, "3", string(item.Value))
+	assert.Equal(t, []string{"1", "blob"}, expired)
+	assert.Equal(t, 0, countKeys(q, blobPrefix))
+}
+
+func Test_DequeueExpired(t *testing.T) {
+	q, _ := Open(name, dir)
+	defer q.Drop()
+
+	now := time.Now()
+	q.EnqueueItem(&Item{Value: []byte("1"), ExpiresAt: now.Add(-time.Second)})
+	q.EnqueueItem(&Item{Value: []byte("2"), ExpiresAt: now.Add(time.Hour)})
+	q.EnqueueItem(&Item{Value: []byte("3"), ExpiresAt: now.Add(-time.Second)})
+
+	item, err := q.Dequeue()
+	assert.Nil(t, err)
+	assert.Equal(t, "2", string(item.Value))
+
+	_, err = q.Dequeue()
+	assert.Equal(t, ErrEmpty, err)
+	assert.Equal(t, uint64(0), q.Length())
+}
+
+func Test_EnqueueUnique(t *testing.T) {
+	q, _ := Open(name, dir)
+	defer q.Drop()
+
+	stored, err := q.EnqueueUnique(&Item{Value: []byte("1")}, "a", time.Hour)
+	assert.Nil(t, err)
+	assert.True(t, stored)
+
+	stored, err = q.EnqueueUnique(&Item{Value: []byte("2")}, "a", time.Hour)
+	assert.Nil(t, err)
+	assert.False(t, stored)
+
+	stored, err = q.EnqueueUnique(&Item{Value: []byte("3")}, "b", time.Hour)
+	assert.Nil(t, err)
+	assert.True(t, stored)
+	assert.Equal(t, uint64(2), q.Length())
+
+	stored, _ = q.EnqueueUnique(&Item{Value: []byte("4")}, "a", time.Nanosecond)
+	assert.True(t, stored)
+
+	purged, err := q.PurgeDedupKeys(time.Now().Add(time.Hour))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, purged)
+
+	stored, _ = q.EnqueueUnique(&Item{Value: []byte("5")}, "b", time.Hour)
+	assert.True(t, stored)
+
+	q.Close()
+	q, _ = Open(name, dir)
+	assert.Equal(t, uint64(4), q.Length())
+	item, _ := q.Dequeue()
+	assert.Equal(t, "1", string(item.Value))
+}
+
 func Test_queuePath(t *testing.T) {
 	q, _ := Open("test_queue", dir)
 	defer q.Drop()
 	assert.Equal(t, "./test_data/test_queue", q.Path())
 }
+
+func Test_AccessStats(t *testing.T) {
+	q, err := Open(name, dir)
+	defer q.Drop()
+	assert.Nil(t, err)
+
+	assert.Equal(t, int64(0), q.Stats.LastEnqueue)
+	assert.Equal(t, int64(0), q.Stats.LastDequeue)
+
+	before := time.Now().UnixNano()
+	q.Enqueue([]byte("12"))
+	q.Enqueue([]byte("345"))
+	q.Dequeue()
+	q.Enqueue([]byte("6"))
+
+	assert.True(t, q.Stats.LastEnqueue >= before)
+	assert.True(t, q.Stats.LastDequeue >= before)
+	assert.Equal(t, uint64(2), q.Stats.PeakItems)
+	assert.Equal(t, uint64(6), q.Stats.BytesIn)
+	assert.Equal(t, uint64(2), q.Stats.BytesOut)
+}
+
+func Test_DequeueCtx(t *testing.T) {
+	q, err := Open(name, dir)
+	defer q.Drop()
+	assert.Nil(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	_, err = q.DequeueCtx(ctx)
+	cancel()
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	// Waiting readers wake up on enqueue and when delayed items are due
+	go func() {
+		time.Sleep(5 * time.Millisecond)
+		q.EnqueueCtx(context.Background(), &Item{Value: []byte("1")})
+	}()
+	item, err := q.DequeueCtx(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("1"), item.Value)
+
+	assert.Nil(t, q.Delay(item, time.Now().Add(10*time.Millisecond)))
+	start := time.Now()
+	item, err = q.DequeueCtx(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("1"), item.Value)
+	assert.True(t, time.Since(start) >= 5*time.Millisecond)
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	assert.Equal(t, context.Canceled, q.EnqueueCtx(ctx, &Item{Value: []byte("2")}))
+	assert.Equal(t, uint64(0), q.Length())
+}
@@ -0,0 +1,82 @@
+package queue
+
+import (
+	"encoding/binary"
+	"sync/atomic"
+	"time"
+
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+// rebaseDistance is how far the head of a queue moves away
+// from rebaseOffset before the queue is rebased when idle
+var rebaseDistance uint64 = 1 << 32
+
+// Rebase renumbers items of an idle queue from rebaseOffset in one batch
+// once its head moved rebaseDistance away from it, so a long-lived queue
+// never runs out of offsets and keeps room for prepends. Queues with open
+// items, waiting barriers, items enqueued or dequeued within idle or more
+// than maxItems items are left alone. It reports whether the queue was rebased.
+// Items get new IDs, the audit log continues with them.
+func (q *Queue) Rebase(idle time.Duration, maxItems uint64) (bool, error) {
+	q.Lock()
+	defer q.Unlock()
+
+	distance := q.head - rebaseOffset
+	if q.head < rebaseOffset {
+		distance = rebaseOffset - q.head
+	}
+	if distance < rebaseDistance || q.length() > maxItems || len(q.opened) > 0 || q.barriers > 0 ||
+		atomic.LoadInt64(&q.Stats.OpenTransactions) > 0 {
+		return false, nil
+	}
+	now := time.Now()
+	for _, last := range []int64{atomic.LoadInt64(&q.Stats.LastEnqueue), atomic.LoadInt64(&q.Stats.LastDequeue)} {
+		if now.Sub(time.Unix(0, last)) < idle {
+			return false, nil
+		}
+	}
+
+	if err := q.renumber(rebaseOffset); err != nil {
+		return false, err
+	}
+	atomic.StoreInt64(&q.Stats.LastRebase, now.UnixNano())
+	atomic.AddUint64(&q.Stats.Rebases, 1)
+	return true, nil
+}
+
+// renumber moves items in one batch so they follow a given head offset,
+// gaps between items are closed. Caller must hold the queue lock.
+func (q *Queue) renumber(head uint64) error {
+	var keys, values [][]byte
+	iter := q.db.NewIterator(itemRange, nil)
+	for iter.Next() {
+		if len(iter.Key()) != 8 {
+			continue
+		}
+		keys = append(keys, append([]byte(nil), iter.Key()...))
+		values = append(values, append([]byte(nil), iter.Value()...))
+	}
+	iter.Release()
+	if err := iter.Error(); err != nil {
+		return err
+	}
+
+	// Old keys are deleted before new ones are written,
+	// so a new key may take a key of another item
+	batch := new(leveldb.Batch)
+	for _, key := range keys {
+		batch.Delete(key)
+	}
+	for i, value := range values {
+		key := make([]byte, 8)
+		binary.BigEndian.PutUint64(key, head+1+uint64(i))
+		batch.Put(key, value)
+	}
+	if err := q.db.Write(batch, nil); err != nil {
+		return err
+	}
+	q.head = head
+	q.tail = head + uint64(len(keys))
+	return nil
+}
@@ -0,0 +1,81 @@
+package queue
+
+import (
+	"encoding/binary"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Rebase(t *testing.T) {
+	q, err := Open(name, dir)
+	defer q.Drop()
+	assert.Nil(t, err)
+
+	start := rebaseOffset + rebaseDistance
+	q.head, q.tail = start, start
+	for i := 1; i <= 5; i++ {
+		q.Enqueue([]byte(strconv.Itoa(i)))
+	}
+	item, _ := q.Dequeue()
+	q.OpenItem(item)
+
+	// Busy queues and queues with open items are left alone
+	rebased, err := q.Rebase(time.Hour, 100)
+	assert.Nil(t, err)
+	assert.False(t, rebased)
+	q.CloseItem(item)
+	rebased, err = q.Rebase(0, 3)
+	assert.Nil(t, err)
+	assert.False(t, rebased)
+
+	// A gap is closed on the way
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, start+3)
+	assert.Nil(t, q.db.Delete(key, nil))
+
+	rebased, err = q.Rebase(0, 100)
+	assert.Nil(t, err)
+	assert.True(t, rebased)
+	assert.Equal(t, rebaseOffset, q.Head())
+	assert.Equal(t, rebaseOffset+3, q.Tail())
+	assert.Equal(t, uint64(1), q.Stats.Rebases)
+	assert.NotZero(t, q.Stats.LastRebase)
+
+	// Offsets close to rebaseOffset are kept
+	rebased, err = q.Rebase(0, 100)
+	assert.Nil(t, err)
+	assert.False(t, rebased)
+
+	q.Close()
+	q, err = Open(name, dir)
+	assert.Nil(t, err)
+	for _, value := range []string{"2", "4", "5"} {
+		item, err := q.Dequeue()
+		assert.Nil(t, err)
+		assert.Equal(t, value, string(item.Value))
+	}
+	assert.Equal(t, uint64(0), q.Length())
+}
+
+func Test_Rebase_Down(t *testing.T) {
+	q, err := Open(name, dir)
+	defer q.Drop()
+	assert.Nil(t, err)
+
+	q.head, q.tail = rebaseOffset+rebaseDistance, rebaseOffset+rebaseDistance
+	for i := 1; i <= 3; i++ {
+		q.Enqueue([]byte(strconv.Itoa(i)))
+	}
+	rebased, err := q.Rebase(0, 100)
+	assert.Nil(t, err)
+	assert.True(t, rebased)
+	assert.Equal(t, rebaseOffset, q.Head())
+	for _, value := range []string{"1", "2", "3"} {
+		item, err := q.Dequeue()
+		assert.Nil(t, err)
+		assert.Equal(t, value, string(item.Value))
+	}
+}
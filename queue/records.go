@@ -0,0 +1,84 @@
+package queue
+
+import (
+	"encoding/binary"
+	"time"
+
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+// Record is an encoded item stored under its queue key
+type Record struct {
+	Key   []byte
+	Value []byte
+}
+
+// PrepareRecords encodes items under consecutive keys following the queue tail.
+// Caller must hold the queue lock until records are written or dropped,
+// so a number of queues can be written together.
+func (q *Queue) PrepareRecords(items []*Item) []Record {
+	now := time.Now()
+	records := make([]Record, len(items))
+	for i, item := range items {
+		item.stamp(now)
+		item.Key = make([]byte, 8)
+		binary.BigEndian.PutUint64(item.Key, q.tail+uint64(i)+1)
+		records[i] = Record{Key: item.Key, Value: encodeItem(item)}
+	}
+	return records
+}
+
+// WriteRecords stores prepared records and moves the queue tail,
+// caller must hold the queue lock
+func (q *Queue) WriteRecords(records []Record) error {
+	batch := new(leveldb.Batch)
+	var size int64
+	for _, record := range records {
+		batch.Put(record.Key, record.Value)
+		if item, err := decodeItem(nil, record.Value); err == nil {
+			reference(batch, item)
+			size += item.ValueSize()
+		}
+	}
+	if err := q.write(batch, nil); err != nil {
+		return err
+	}
+	q.tail += uint64(len(records))
+	q.observeEnqueue(len(records), size)
+	return nil
+}
+
+// RemoveRecords deletes written records and moves the queue tail back,
+// caller must hold the queue lock
+func (q *Queue) RemoveRecords(records []Record) error {
+	batch := new(leveldb.Batch)
+	for _, record := range records {
+		batch.Delete(record.Key)
+		if item, err := decodeItem(nil, record.Value); err == nil {
+			release(batch, item)
+		}
+	}
+	if err := q.db.Write(batch, nil); err != nil {
+		return err
+	}
+	q.tail -= uint64(len(records))
+	return nil
+}
+
+// RestoreRecords stores records of an interrupted write again,
+// records already stored are overwritten with the same data
+func (q *Queue) RestoreRecords(records []Record) error {
+	q.Lock()
+	defer q.Unlock()
+	batch := new(leveldb.Batch)
+	for _, record := range records {
+		batch.Put(record.Key, record.Value)
+		if item, err := decodeItem(nil, record.Value); err == nil {
+			reference(batch, item)
+		}
+	}
+	if err := q.db.Write(batch, nil); err != nil {
+		return err
+	}
+	return q.initialize()
+}
@@ -0,0 +1,71 @@
+package queue
+
+import (
+	"io"
+
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+// Snapshot is a point in time view of queue items,
+// items enqueued or dequeued after it was taken are not visible
+type Snapshot struct {
+	snap   *leveldb.Snapshot
+	length uint64
+	blobs  BlobStore
+}
+
+// Snapshot takes a snapshot of queue items, delayed items are not included.
+// The snapshot must be released.
+func (q *Queue) Snapshot() (*Snapshot, error) {
+	q.RLock()
+	defer q.RUnlock()
+	snap, err := q.db.GetSnapshot()
+	if err != nil {
+		return nil, err
+	}
+	return &Snapshot{snap: snap, length: q.length(), blobs: q.blobs}, nil
+}
+
+// Length returns a number of items in the snapshot
+func (s *Snapshot) Length() uint64 {
+	return s.length
+}
+
+// Items calls fn for every item of the snapshot from head to tail
+func (s *Snapshot) Items(fn func(item *Item) error) error {
+	iter := s.snap.NewIterator(itemRange, nil)
+	defer iter.Release()
+	for iter.Next() {
+		key := append([]byte{}, iter.Key()...)
+		item, err := decodeItem(key, append([]byte{}, iter.Value()...))
+		if err != nil {
+			return err
+		}
+		if err = fn(item); err != nil {
+			return err
+		}
+	}
+	return iter.Error()
+}
+
+// WriteBlob writes chunks of a snapshot item blob to w
+func (s *Snapshot) WriteBlob(blob *Blob, w io.Writer) error {
+	if blob.External {
+		return copyExternal(s.blobs, blob, w)
+	}
+	for i := uint32(0); i < blob.Chunks; i++ {
+		chunk, err := s.snap.Get(blobKey(blob.ID, i), nil)
+		if err != nil {
+			return err
+		}
+		if _, err = w.Write(chunk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Release releases the snapshot
+func (s *Snapshot) Release() {
+	s.snap.Release()
+}
@@ -0,0 +1,43 @@
+package queue
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Snapshot(t *testing.T) {
+	q, err := Open(name, dir)
+	defer q.Drop()
+	assert.Nil(t, err)
+
+	q.Enqueue([]byte("1"))
+	w := q.NewBlobWriter()
+	w.Write([]byte("chunk"))
+	assert.Nil(t, q.EnqueueItem(&Item{Blob: w.Blob(), Flags: 2}))
+
+	snap, err := q.Snapshot()
+	assert.Nil(t, err)
+	defer snap.Release()
+
+	// Changes after the snapshot are not visible
+	q.Dequeue()
+	item, _ := q.Dequeue()
+	q.DeleteBlob(item.Blob)
+	q.Enqueue([]byte("3"))
+
+	assert.Equal(t, uint64(2), snap.Length())
+	items := []*Item{}
+	assert.Nil(t, snap.Items(func(item *Item) error {
+		items = append(items, item)
+		return nil
+	}))
+	assert.Equal(t, 2, len(items))
+	assert.Equal(t, []byte("1"), items[0].Value)
+	assert.Equal(t, uint32(2), items[1].Flags)
+
+	var buf bytes.Buffer
+	assert.Nil(t, snap.WriteBlob(items[1].Blob, &buf))
+	assert.Equal(t, "chunk", buf.String())
+}
@@ -0,0 +1,169 @@
+package queue
+
+import (
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/storage"
+)
+
+// StorageStats are leveldb internals of a queue database
+type StorageStats struct {
+	Levels []LevelStats
+	// WriteDelays counts writes slowed down or paused by compaction
+	WriteDelays    int32
+	WriteDelayTime time.Duration
+	WritePaused    bool
+	OpenedTables   int
+	BlockCache     int
+	IORead         uint64
+	IOWrite        uint64
+	// MemtableBytes is a size of writes not flushed to tables yet,
+	// taken from the journal backing the memtable
+	MemtableBytes int64
+	// Compactions count memtable flushes, level 0 compactions
+	// and compactions of other levels since the queue was opened
+	MemCompactions    uint32
+	Level0Compactions uint32
+	TableCompactions  uint32
+}
+
+// LevelStats are table and compaction stats of a leveldb level
+type LevelStats struct {
+	Level           int
+	Tables          int
+	Size            int64
+	CompactionTime  time.Duration
+	CompactionRead  int64
+	CompactionWrite int64
+}
+
+// StorageStats returns leveldb stats of the queue database,
+// levels without tables and compactions are omitted
+func (q *Queue) StorageStats() (*StorageStats, error) {
+	q.RLock()
+	defer q.RUnlock()
+	var s leveldb.DBStats
+	if err := q.db.Stats(&s); err != nil {
+		return nil, err
+	}
+	// DBStats level slices skip empty levels, level numbers
+	// are taken from the stats property listing the same levels
+	property, err := q.db.GetProperty("leveldb.stats")
+	if err != nil {
+		return nil, err
+	}
+	levels := statsLevels(property)
+
+	stats := &StorageStats{
+		WriteDelays:    s.WriteDelayCount,
+		WriteDelayTime: s.WriteDelayDuration,
+		WritePaused:    s.WritePaused,
+		OpenedTables:   s.OpenedTablesCount,
+		BlockCache:     s.BlockCacheSize,
+		IORead:         s.IORead,
+		IOWrite:        s.IOWrite,
+	}
+	if q.storage != nil {
+		stats.MemtableBytes = atomic.LoadInt64(&q.storage.journal)
+		stats.MemCompactions = atomic.LoadUint32(&q.storage.memCompactions)
+		stats.Level0Compactions = atomic.LoadUint32(&q.storage.level0Compactions)
+		stats.TableCompactions = atomic.LoadUint32(&q.storage.tableCompactions)
+	}
+	for i := range s.LevelSizes {
+		level := i
+		if len(levels) == len(s.LevelSizes) {
+			level = levels[i]
+		}
+		stats.Levels = append(stats.Levels, LevelStats{
+			Level:           level,
+			Tables:          s.LevelTablesCounts[i],
+			Size:            s.LevelSizes[i],
+			CompactionTime:  s.LevelDurations[i],
+			CompactionRead:  s.LevelRead[i],
+			CompactionWrite: s.LevelWrite[i],
+		})
+	}
+	return stats, nil
+}
+
+// DiskUsage returns a size of files of the queue database and their number,
+// queues kept in memory use no disk
+func (q *Queue) DiskUsage() (size int64, files int, err error) {
+	if q.inMemory {
+		return 0, 0, nil
+	}
+	entries, err := ioutil.ReadDir(q.Path())
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, entry := range entries {
+		if entry.Mode().IsRegular() {
+			size += entry.Size()
+			files++
+		}
+	}
+	return size, files, nil
+}
+
+// statsLevels returns level numbers of "leveldb.stats" property rows
+func statsLevels(property string) []int {
+	levels := []int{}
+	for _, line := range strings.Split(property, "\n") {
+		fields := strings.Split(line, "|")
+		if len(fields) < 2 {
+			continue
+		}
+		if level, err := strconv.Atoi(strings.TrimSpace(fields[0])); err == nil {
+			levels = append(levels, level)
+		}
+	}
+	return levels
+}
+
+// countingStorage is a leveldb storage counting compactions from leveldb log
+// messages and bytes written to the current journal
+type countingStorage struct {
+	storage.Storage
+	journal           int64
+	memCompactions    uint32
+	level0Compactions uint32
+	tableCompactions  uint32
+}
+
+func (s *countingStorage) Log(str string) {
+	switch {
+	case strings.HasPrefix(str, "memdb@flush committed"):
+		atomic.AddUint32(&s.memCompactions, 1)
+	case strings.HasPrefix(str, "table@compaction L0"), strings.HasPrefix(str, "table@move L0"):
+		atomic.AddUint32(&s.level0Compactions, 1)
+	case strings.HasPrefix(str, "table@compaction L"), strings.HasPrefix(str, "table@move L"):
+		atomic.AddUint32(&s.tableCompactions, 1)
+	}
+	s.Storage.Log(str)
+}
+
+func (s *countingStorage) Create(fd storage.FileDesc) (storage.Writer, error) {
+	w, err := s.Storage.Create(fd)
+	if err != nil || fd.Type != storage.TypeJournal {
+		return w, err
+	}
+	atomic.StoreInt64(&s.journal, 0)
+	return &journalWriter{Writer: w, size: &s.journal}, nil
+}
+
+// journalWriter counts bytes written to a journal
+type journalWriter struct {
+	storage.Writer
+	size *int64
+}
+
+func (w *journalWriter) Write(p []byte) (int, error) {
+	n, err := w.Writer.Write(p)
+	atomic.AddInt64(w.size, int64(n))
+	return n, err
+}
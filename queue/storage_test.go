@@ -0,0 +1,41 @@
+package queue
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_StorageStats(t *testing.T) {
+	q, err := Open(name, dir)
+	defer q.Drop()
+	assert.Nil(t, err)
+
+	q.Enqueue([]byte("1"))
+	stats, err := q.StorageStats()
+	assert.Nil(t, err)
+	assert.True(t, stats.MemtableBytes > 0)
+	assert.Equal(t, uint32(0), stats.MemCompactions)
+
+	assert.Nil(t, q.Compact())
+	stats, err = q.StorageStats()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), stats.MemtableBytes)
+	assert.Equal(t, uint32(1), stats.MemCompactions)
+	assert.Equal(t, int32(0), stats.WriteDelays)
+	assert.False(t, stats.WritePaused)
+	tables := 0
+	for _, l := range stats.Levels {
+		tables += l.Tables
+	}
+	assert.True(t, tables > 0)
+}
+
+func Test_statsLevels(t *testing.T) {
+	property := "Compactions\n" +
+		" Level |   Tables   |    Size(MB)   |    Time(sec)  |    Read(MB)   |   Write(MB)\n" +
+		"-------+------------+---------------+---------------+---------------+---------------\n" +
+		"   0   |          1 |       0.00010 |       0.00000 |       0.00000 |       0.00000\n" +
+		"   2   |          1 |       0.00010 |       0.00100 |       0.00000 |       0.00010\n"
+	assert.Equal(t, []int{0, 2}, statsLevels(property))
+}
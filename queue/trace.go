@@ -0,0 +1,34 @@
+package queue
+
+import (
+	"github.com/bogdanovich/siberite/trace"
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+// Storage operations of items are traced as siberite.leveldb.write and
+// siberite.leveldb.get spans. Operations on an item carrying a Span are traced
+// as its children, so storage latency shows up under the command span.
+
+// write stores a batch with a span
+func (q *Queue) write(batch *leveldb.Batch, parent trace.Span) error {
+	span := trace.Start("siberite.leveldb.write", parent, "")
+	span.SetAttribute("queue", q.Name)
+	err := q.db.Write(batch, nil)
+	if err != nil {
+		span.SetError(err)
+	}
+	span.End()
+	return err
+}
+
+// read returns a stored value with a span
+func (q *Queue) read(key []byte, parent trace.Span) ([]byte, error) {
+	span := trace.Start("siberite.leveldb.get", parent, "")
+	span.SetAttribute("queue", q.Name)
+	value, err := q.db.Get(key, nil)
+	if err != nil && err != leveldb.ErrNotFound {
+		span.SetError(err)
+	}
+	span.End()
+	return value, err
+}
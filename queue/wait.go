@@ -0,0 +1,65 @@
+package queue
+
+import (
+	"context"
+	"time"
+
+	"github.com/bogdanovich/siberite/chaos"
+)
+
+// EnqueueCtx adds an item to the queue unless ctx is done
+func (q *Queue) EnqueueCtx(ctx context.Context, item *Item) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return q.EnqueueItem(item)
+}
+
+// DequeueCtx returns next queue item like Dequeue, an empty queue
+// is waited on until an item is added or a delayed item is due,
+// ctx error is returned once ctx is done
+func (q *Queue) DequeueCtx(ctx context.Context) (*Item, error) {
+	for {
+		if err := ctx.Err(); err != nil {
+			return &Item{}, err
+		}
+		if err := chaos.Storage(); err != nil {
+			return &Item{}, err
+		}
+		q.Lock()
+		item, err := q.dequeue()
+		if err != ErrEmpty {
+			q.unlockExpiring()
+			return item, err
+		}
+		if q.added == nil {
+			q.added = make(chan struct{})
+		}
+		added := q.added
+		var due <-chan time.Time
+		var timer *time.Timer
+		if q.delayed > 0 {
+			timer = time.NewTimer(q.nextDue.Sub(time.Now()))
+			due = timer.C
+		}
+		q.unlockExpiring()
+
+		select {
+		case <-ctx.Done():
+		case <-added:
+		case <-due:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+}
+
+// signal wakes up readers waiting in DequeueCtx,
+// caller must hold the queue lock
+func (q *Queue) signal() {
+	if q.added != nil {
+		close(q.added)
+		q.added = nil
+	}
+}
@@ -0,0 +1,214 @@
+package repository
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/bogdanovich/siberite/config"
+)
+
+// Alert names
+const (
+	AlertDepthHigh = "depth_high"
+	AlertDepthLow  = "depth_low"
+	AlertHeadAge   = "head_age"
+)
+
+// Alert states
+const (
+	AlertFiring   = "firing"
+	AlertResolved = "resolved"
+)
+
+var (
+	alertInterval      = 10 * time.Second
+	alertRetries       = 3
+	alertRetryInterval = 5 * time.Second
+	alertTimeout       = 10 * time.Second
+	alertBacklog       = 100
+)
+
+// Alert is a webhook payload, Value and Threshold are item
+// counts for depth alerts and milliseconds for head age alerts
+type Alert struct {
+	Queue     string `json:"queue"`
+	Alert     string `json:"alert"`
+	State     string `json:"state"`
+	Value     int64  `json:"value"`
+	Threshold int64  `json:"threshold"`
+	Time      int64  `json:"time"`
+}
+
+type alertState struct {
+	firing bool
+	sent   time.Time
+}
+
+type alertDelivery struct {
+	webhooks []string
+	alert    Alert
+}
+
+// alerter checks queue thresholds and posts alerts to webhooks
+type alerter struct {
+	repo       *QueueRepository
+	states     map[string]*alertState
+	deliveries chan alertDelivery
+	client     *http.Client
+	done       chan struct{}
+	wg         sync.WaitGroup
+}
+
+func startAlerter(repo *QueueRepository, cfg *config.Config) *alerter {
+	configured := false
+	for _, qc := range cfg.Queues {
+		configured = configured || qc.Alerts != nil
+	}
+	if !configured {
+		return nil
+	}
+	a := &alerter{
+		repo:       repo,
+		states:     map[string]*alertState{},
+		deliveries: make(chan alertDelivery, alertBacklog),
+		client:     &http.Client{Timeout: alertTimeout},
+		done:       make(chan struct{}),
+	}
+	a.wg.Add(2)
+	go a.run()
+	go a.deliver()
+	return a
+}
+
+func (a *alerter) stop() {
+	if a == nil {
+		return
+	}
+	close(a.done)
+	a.wg.Wait()
+}
+
+func (a *alerter) run() {
+	defer a.wg.Done()
+	ticker := time.NewTicker(alertInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-a.done:
+			return
+		case now := <-ticker.C:
+			a.check(now)
+		}
+	}
+}
+
+// check evaluates alert thresholds of every open queue
+func (a *alerter) check(now time.Time) {
+	for _, name := range a.repo.queueNames() {
+		ac := a.repo.config.Queue(name).Alerts
+		if ac == nil {
+			continue
+		}
+		q, err := a.repo.GetQueue(name)
+		if err != nil {
+			continue
+		}
+		length := int64(q.Length())
+		if ac.High > 0 {
+			a.update(ac, name, AlertDepthHigh, length >= int64(ac.High), length, int64(ac.High), now)
+		}
+		if ac.Low > 0 {
+			a.update(ac, name, AlertDepthLow, length <= int64(ac.Low), length, int64(ac.Low), now)
+		}
+		if ac.HeadAge() > 0 {
+			age := q.Age()
+			a.update(ac, name, AlertHeadAge, age > ac.HeadAge(), int64(age/time.Millisecond),
+				int64(ac.HeadAge()/time.Millisecond), now)
+		}
+	}
+}
+
+// update sends an alert when its condition starts or ends,
+// lasting conditions are sent again every repeat interval
+func (a *alerter) update(ac *config.AlertConfig, name string, alert string, firing bool,
+	value int64, threshold int64, now time.Time) {
+	key := name + "/" + alert
+	state, ok := a.states[key]
+	if !ok {
+		state = &alertState{}
+		a.states[key] = state
+	}
+	repeat := firing && ac.RepeatInterval() > 0 && now.Sub(state.sent) >= ac.RepeatInterval()
+	changed := firing != state.firing
+	if !changed && !repeat {
+		return
+	}
+	state.firing = firing
+	state.sent = now
+	status := AlertResolved
+	if firing {
+		status = AlertFiring
+	}
+	d := alertDelivery{webhooks: ac.Webhooks, alert: Alert{
+		Queue: name, Alert: alert, State: status, Value: value, Threshold: threshold, Time: now.Unix(),
+	}}
+	if changed {
+		a.repo.publish(EventAlert, name, &d.alert)
+	}
+	select {
+	case a.deliveries <- d:
+	default:
+		log.Printf("queue %s: alert backlog is full, %s %s alert dropped", name, alert, status)
+	}
+}
+
+func (a *alerter) deliver() {
+	defer a.wg.Done()
+	for {
+		select {
+		case <-a.done:
+			return
+		case d := <-a.deliveries:
+			for _, webhook := range d.webhooks {
+				a.post(webhook, d.alert)
+			}
+		}
+	}
+}
+
+// post sends an alert to a webhook, retrying failed requests
+func (a *alerter) post(webhook string, alert Alert) {
+	body, _ := json.Marshal(alert)
+	for attempt := 1; ; attempt++ {
+		err := a.send(webhook, body)
+		if err == nil {
+			return
+		}
+		if attempt >= alertRetries {
+			log.Printf("queue %s: can't post %s alert to %s: %s", alert.Queue, alert.Alert, webhook, err.Error())
+			return
+		}
+		select {
+		case <-a.done:
+			return
+		case <-time.After(alertRetryInterval):
+		}
+	}
+}
+
+func (a *alerter) send(webhook string, body []byte) error {
+	resp, err := a.client.Post(webhook, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
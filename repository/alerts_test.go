@@ -0,0 +1,75 @@
+package repository
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bogdanovich/siberite/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Alerts(t *testing.T) {
+	alertRetryInterval = time.Millisecond
+	alerts := make(chan Alert, 10)
+	failures := 1
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The first request fails and is retried
+		if failures > 0 {
+			failures--
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		var alert Alert
+		assert.Nil(t, json.NewDecoder(r.Body).Decode(&alert))
+		alerts <- alert
+	}))
+	defer server.Close()
+
+	cfg := config.Default()
+	cfg.Queues["alerts_*"] = &config.QueueConfig{Alerts: &config.AlertConfig{
+		Webhooks: []string{server.URL}, High: 2, Repeat: "1m",
+	}}
+	assert.Nil(t, cfg.Validate())
+	repo, err := InitializeWithConfig(dir, cfg)
+	assert.Nil(t, err)
+	defer repo.DeleteAllQueues()
+	defer repo.CloseAllQueues()
+	assert.NotNil(t, repo.alerter)
+
+	q, _ := repo.GetQueue("alerts_a")
+	q.Enqueue([]byte("1"))
+	q.Enqueue([]byte("2"))
+
+	expect := func(state string, value int64) {
+		select {
+		case alert := <-alerts:
+			assert.Equal(t, Alert{Queue: "alerts_a", Alert: AlertDepthHigh, State: state,
+				Value: value, Threshold: 2, Time: alert.Time}, alert)
+		case <-time.After(time.Second):
+			t.Fatalf("%s alert was not sent", state)
+		}
+	}
+
+	now := time.Now()
+	repo.alerter.check(now)
+	expect(AlertFiring, 2)
+
+	// Lasting alert is sent again only after repeat interval
+	repo.alerter.check(now.Add(time.Second))
+	repo.alerter.check(now.Add(time.Minute))
+	expect(AlertFiring, 2)
+
+	q.Dequeue()
+	repo.alerter.check(now.Add(2 * time.Minute))
+	expect(AlertResolved, 1)
+
+	repo.alerter.check(now.Add(3 * time.Minute))
+	select {
+	case alert := <-alerts:
+		t.Fatalf("unexpected alert %v", alert)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
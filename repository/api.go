@@ -0,0 +1,174 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"sync/atomic"
+
+	"github.com/bogdanovich/siberite/audit"
+	"github.com/bogdanovich/siberite/queue"
+)
+
+// The in-process API below lets Go programs use siberite queues
+// as an embedded library, the same way clients do over the network:
+//
+//	repo, err := repository.Initialize("./data")
+//	defer repo.CloseAllQueues()
+//	repo.Enqueue(ctx, "work", &queue.Item{Value: []byte("job")})
+//	r, err := repo.Reserve(ctx, "work") // waits for an item
+//	...
+//	r.Commit() // or r.Abort()
+//
+// Enqueued items are audited and replicated like items set by clients,
+// dequeued items are mirrored to taps. Audit records use connection id 0.
+
+// ErrReadOnly is returned by Enqueue to a replicated queue on a follower
+var ErrReadOnly = errors.New("Queue is read-only on a follower")
+
+// ErrOutOfMemory is returned by Enqueue while memory is over max_memory, see MemoryExceeded
+var ErrOutOfMemory = errors.New("Out of memory")
+
+// ErrClosed is returned by operations waiting for an item when the repository is closed
+var ErrClosed = errors.New("Repository is closed")
+
+// ErrFinished is returned when a reservation is already committed or aborted
+var ErrFinished = errors.New("Reservation is already finished")
+
+// Enqueue adds an item to a queue, item Key is set once it is stored.
+// Items moved by routing rules of the queue are not stored in it.
+func (repo *QueueRepository) Enqueue(ctx context.Context, name string, item *queue.Item) error {
+	q, err := repo.GetQueue(name)
+	if err != nil {
+		return err
+	}
+	if !repo.Writable(name, item) {
+		return ErrReadOnly
+	}
+	if repo.MemoryExceeded() {
+		return ErrOutOfMemory
+	}
+	targets, keep := repo.RouteTargets(name, item)
+	if keep {
+		if err = q.EnqueueCtx(ctx, item); err != nil {
+			return err
+		}
+		repo.enqueued(name, item)
+	}
+	// Copies of a kept item are best effort, a moved item must be stored
+	if err = repo.Route(name, q, item, targets); err != nil && !keep {
+		return err
+	}
+	return nil
+}
+
+// Dequeue removes and returns the head item of a queue,
+// it waits for an item until ctx is done and returns ctx error then
+func (repo *QueueRepository) Dequeue(ctx context.Context, name string) (*queue.Item, error) {
+	q, item, err := repo.next(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	repo.Archive(name, q, item)
+	q.DeleteBlob(item.Blob)
+	item.Blob = nil
+	repo.record(audit.EventDequeue, name, item)
+	return item, nil
+}
+
+// Reservation is an item dequeued until it is committed
+// or aborted, like an item read with GET <queue>/open
+type Reservation struct {
+	Item *queue.Item
+	repo *QueueRepository
+	q    *queue.Queue
+	name string
+	done int32
+}
+
+// Reserve dequeues the head item of a queue until the reservation
+// is committed or aborted, it waits for an item until ctx is done
+func (repo *QueueRepository) Reserve(ctx context.Context, name string) (*Reservation, error) {
+	q, item, err := repo.next(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	q.OpenItem(item)
+	repo.record(audit.EventOpen, name, item)
+	return &Reservation{Item: item, repo: repo, q: q, name: name}, nil
+}
+
+// Commit removes the reserved item for good
+func (r *Reservation) Commit() error {
+	if !atomic.CompareAndSwapInt32(&r.done, 0, 1) {
+		return ErrFinished
+	}
+	r.q.CloseItem(r.Item)
+	r.repo.Archive(r.name, r.q, r.Item)
+	r.q.DeleteBlob(r.Item.Blob)
+	r.repo.record(audit.EventClose, r.name, r.Item)
+	return nil
+}
+
+// Abort returns the reserved item to the queue head
+func (r *Reservation) Abort() error {
+	if !atomic.CompareAndSwapInt32(&r.done, 0, 1) {
+		return ErrFinished
+	}
+	// Values of chunked items stay in blob chunks
+	stored := *r.Item
+	if stored.Blob != nil {
+		stored.Value = nil
+	}
+	if err := r.q.Prepend(&stored); err != nil {
+		atomic.StoreInt32(&r.done, 0)
+		return err
+	}
+	r.q.CloseItem(r.Item)
+	r.repo.record(audit.EventAbort, r.name, r.Item)
+	return nil
+}
+
+// next dequeues the head item of a queue waiting for one until ctx is done
+// or the repository is closed, values stored in blob chunks are read into item Value
+func (repo *QueueRepository) next(ctx context.Context, name string) (*queue.Queue, *queue.Item, error) {
+	q, err := repo.GetQueue(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	repo.TouchFanout(name)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-repo.Context().Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	item, err := q.DequeueCtx(ctx)
+	if err != nil {
+		if repo.Context().Err() != nil {
+			return nil, nil, ErrClosed
+		}
+		return nil, nil, err
+	}
+	if item.Blob != nil {
+		var value bytes.Buffer
+		if err = q.WriteBlob(item.Blob, &value); err != nil {
+			q.Prepend(item)
+			return nil, nil, err
+		}
+		item.Value = value.Bytes()
+	}
+	repo.Mirror(name, q, item)
+	return q, item, nil
+}
+
+func (repo *QueueRepository) record(event string, name string, item *queue.Item) {
+	if err := repo.Audit.Record(event, name, 0, item.UniqueID()); err != nil {
+		log.Printf("Can't write audit log: %s", err.Error())
+	}
+}
@@ -0,0 +1,87 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bogdanovich/siberite/queue"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_API(t *testing.T) {
+	repo, err := Initialize(dir)
+	assert.Nil(t, err)
+	defer repo.DeleteAllQueues()
+	defer repo.CloseAllQueues()
+	ctx := context.Background()
+
+	item := &queue.Item{Value: []byte("1"), Flags: 2}
+	assert.Nil(t, repo.Enqueue(ctx, "api", item))
+	assert.Equal(t, uint64(1<<62+1), item.ID())
+	assert.Equal(t, queue.ErrInvalidName, repo.Enqueue(ctx, "api-1", &queue.Item{}))
+
+	r, err := repo.Reserve(ctx, "api")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("1"), r.Item.Value)
+	assert.Equal(t, uint32(2), r.Item.Flags)
+	q, _ := repo.GetQueue("api")
+	assert.Equal(t, int64(1), q.Stats.OpenTransactions)
+	assert.Nil(t, r.Abort())
+	assert.Equal(t, ErrFinished, r.Commit())
+	assert.Equal(t, int64(0), q.Stats.OpenTransactions)
+
+	r, err = repo.Reserve(ctx, "api")
+	assert.Nil(t, err)
+	assert.Nil(t, r.Commit())
+	assert.Equal(t, uint64(0), q.Length())
+
+	// Dequeue waits for an item until the context is done
+	timeout, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	_, err = repo.Dequeue(timeout, "api")
+	cancel()
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	go func() {
+		time.Sleep(5 * time.Millisecond)
+		repo.Enqueue(ctx, "api", &queue.Item{Value: []byte("2")})
+	}()
+	item, err = repo.Dequeue(ctx, "api")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("2"), item.Value)
+
+	// Closing the repository stops waiting reads
+	go func() {
+		time.Sleep(5 * time.Millisecond)
+		repo.cancel()
+	}()
+	_, err = repo.Reserve(ctx, "api")
+	assert.Equal(t, ErrClosed, err)
+	assert.Equal(t, context.Canceled, repo.Context().Err())
+}
+
+func Test_APIBlob(t *testing.T) {
+	repo, err := Initialize(dir)
+	assert.Nil(t, err)
+	defer repo.DeleteAllQueues()
+	defer repo.CloseAllQueues()
+	ctx := context.Background()
+
+	value := bytes.Repeat([]byte("x"), queue.ChunkSize+10)
+	q, _ := repo.GetQueue("api_blob")
+	w := q.NewBlobWriter()
+	w.Write(value)
+	assert.Nil(t, repo.Enqueue(ctx, "api_blob", &queue.Item{Blob: w.Blob()}))
+
+	// Aborted chunked items keep their value in chunks
+	r, err := repo.Reserve(ctx, "api_blob")
+	assert.Nil(t, err)
+	assert.Equal(t, value, r.Item.Value)
+	assert.Nil(t, r.Abort())
+
+	item, err := repo.Dequeue(ctx, "api_blob")
+	assert.Nil(t, err)
+	assert.Equal(t, value, item.Value)
+	assert.Nil(t, item.Blob)
+}
@@ -0,0 +1,24 @@
+package repository
+
+import (
+	"log"
+	"time"
+
+	"github.com/bogdanovich/siberite/queue"
+)
+
+// Archive keeps a copy of an item consumed from a queue with retention
+// configured, archived items can be requeued until they are purged.
+// Items of queues with object_archive are also written to object store segments.
+func (repo *QueueRepository) Archive(name string, q *queue.Queue, item *queue.Item) {
+	qc := repo.config.Queue(name)
+	if qc.ObjectArchive {
+		repo.objects.add(name, q, item, ObjectConsumed)
+	}
+	if qc.ArchiveRetention() == 0 {
+		return
+	}
+	if err := q.Archive(item, time.Now()); err != nil {
+		log.Printf("Can't archive item of %s: %s", name, err.Error())
+	}
+}
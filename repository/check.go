@@ -0,0 +1,44 @@
+package repository
+
+import (
+	"log"
+	"sort"
+
+	"github.com/bogdanovich/siberite/queue"
+)
+
+// Check verifies items keyspace of every queue, see queue.Check
+func (repo *QueueRepository) Check(repair bool) ([]*queue.CheckReport, error) {
+	names := repo.queueNames()
+	sort.Strings(names)
+	reports := []*queue.CheckReport{}
+	for _, name := range names {
+		q, err := repo.GetQueue(name)
+		if err != nil {
+			return reports, err
+		}
+		report, err := q.Check(repair)
+		if err != nil {
+			return reports, err
+		}
+		reports = append(reports, report)
+	}
+	return reports, nil
+}
+
+// verify repairs item offsets of a queue being opened, so dequeue
+// doesn't stop at a gap left by an unclean shutdown
+func (repo *QueueRepository) verify(q *queue.Queue) {
+	report, err := q.Check(true)
+	if err != nil {
+		log.Printf("Can't verify queue %s: %s", q.Name, err.Error())
+		return
+	}
+	if report.Repaired {
+		log.Printf("Queue %s: closed %d gaps and removed %d invalid keys, %d items kept in order",
+			q.Name, len(report.Gaps), report.InvalidKeys, report.Items)
+	}
+	if report.InvalidRecords > 0 {
+		log.Printf("WARNING: queue %s has %d items that can't be decoded", q.Name, report.InvalidRecords)
+	}
+}
@@ -0,0 +1,91 @@
+package repository
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/bogdanovich/siberite/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+func Test_VerifyOnOpen(t *testing.T) {
+	dataDir, err := ioutil.TempDir("", "siberite")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dataDir)
+
+	repo, err := Initialize(dataDir)
+	assert.Nil(t, err)
+	q, err := repo.GetQueue("work")
+	assert.Nil(t, err)
+	for _, value := range []string{"1", "2", "3"} {
+		q.Enqueue([]byte(value))
+	}
+	path := q.Path()
+	repo.CloseAllQueues()
+
+	// Lose the middle item behind the queue's back
+	db, err := leveldb.OpenFile(path, nil)
+	assert.Nil(t, err)
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, 1<<62+2)
+	assert.Nil(t, db.Delete(key, nil))
+	db.Close()
+
+	cfg := config.Default()
+	cfg.VerifyOnOpen = true
+	repo, err = InitializeWithConfig(dataDir, cfg)
+	assert.Nil(t, err)
+	defer repo.CloseAllQueues()
+	q, err = repo.GetQueue("work")
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(2), q.Length())
+	for _, value := range []string{"1", "3"} {
+		item, err := q.Dequeue()
+		assert.Nil(t, err)
+		assert.Equal(t, value, string(item.Value))
+	}
+}
+
+func Test_ParanoidReads(t *testing.T) {
+	cfg := config.Default()
+	cfg.ParanoidReads = true
+	repo, err := InitializeWithConfig(dir, cfg)
+	assert.Nil(t, err)
+	defer repo.DeleteAllQueues()
+	q, err := repo.GetQueue("work")
+	assert.Nil(t, err)
+	q.Enqueue([]byte("1"))
+	_, err = q.Dequeue()
+	assert.Nil(t, err)
+
+	stats := map[string]string{}
+	for _, item := range repo.FullStats() {
+		stats[item.Key] = item.Value
+	}
+	assert.Equal(t, "0", stats["queue_work_read_anomalies"])
+}
+
+func Test_OpenWithConfig(t *testing.T) {
+	dataDir, err := ioutil.TempDir("", "siberite")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dataDir)
+
+	repo, err := Initialize(dataDir)
+	assert.Nil(t, err)
+	q, _ := repo.GetQueue("work")
+	q.Enqueue([]byte("1"))
+	repo.CloseAllQueues()
+
+	// Checks open queues without background services
+	repo, err = OpenWithConfig(dataDir, config.Default())
+	assert.Nil(t, err)
+	defer repo.CloseAllQueues()
+	assert.Nil(t, repo.sizer)
+	reports, err := repo.Check(false)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(reports))
+	assert.Equal(t, uint64(1), reports[0].Items)
+}
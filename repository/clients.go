@@ -0,0 +1,87 @@
+package repository
+
+import (
+	"sync"
+	"time"
+)
+
+// clientWindow is how long a session counts as a reader or a writer
+// of a queue after its last command on the queue
+const clientWindow = 5 * time.Minute
+
+// clientRegistry keeps sessions recently reading and writing each queue
+type clientRegistry struct {
+	queues map[string]*queueClients
+	sync.Mutex
+}
+
+// queueClients keeps last access times of sessions by session id
+type queueClients struct {
+	readers map[uint64]time.Time
+	writers map[uint64]time.Time
+	pruned  time.Time
+}
+
+func newClientRegistry() *clientRegistry {
+	return &clientRegistry{queues: map[string]*queueClients{}}
+}
+
+// ObserveReader records a session reading a queue
+func (repo *QueueRepository) ObserveReader(name string, session uint64) {
+	repo.clients.observe(name, session, false, time.Now())
+}
+
+// ObserveWriter records a session writing to a queue
+func (repo *QueueRepository) ObserveWriter(name string, session uint64) {
+	repo.clients.observe(name, session, true, time.Now())
+}
+
+// Clients returns numbers of distinct sessions that read from and wrote
+// to a queue within clientWindow
+func (repo *QueueRepository) Clients(name string) (readers int, writers int) {
+	return repo.clients.count(name, time.Now())
+}
+
+func (r *clientRegistry) observe(name string, session uint64, write bool, now time.Time) {
+	r.Lock()
+	defer r.Unlock()
+	qc, ok := r.queues[name]
+	if !ok {
+		qc = &queueClients{readers: map[uint64]time.Time{}, writers: map[uint64]time.Time{}, pruned: now}
+		r.queues[name] = qc
+	}
+	if write {
+		qc.writers[session] = now
+	} else {
+		qc.readers[session] = now
+	}
+	// Sessions gone for a window are forgotten even if stats are never read
+	if now.Sub(qc.pruned) > clientWindow {
+		qc.prune(now)
+	}
+}
+
+func (r *clientRegistry) count(name string, now time.Time) (int, int) {
+	r.Lock()
+	defer r.Unlock()
+	qc, ok := r.queues[name]
+	if !ok {
+		return 0, 0
+	}
+	qc.prune(now)
+	if len(qc.readers) == 0 && len(qc.writers) == 0 {
+		delete(r.queues, name)
+	}
+	return len(qc.readers), len(qc.writers)
+}
+
+func (qc *queueClients) prune(now time.Time) {
+	for _, sessions := range []map[uint64]time.Time{qc.readers, qc.writers} {
+		for session, seen := range sessions {
+			if now.Sub(seen) > clientWindow {
+				delete(sessions, session)
+			}
+		}
+	}
+	qc.pruned = now
+}
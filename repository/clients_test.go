@@ -0,0 +1,28 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Clients(t *testing.T) {
+	r := newClientRegistry()
+	now := time.Now()
+	r.observe("work", 1, false, now.Add(-clientWindow-time.Second))
+	r.observe("work", 2, false, now)
+	r.observe("work", 2, false, now)
+	r.observe("work", 3, true, now)
+
+	readers, writers := r.count("work", now)
+	assert.Equal(t, 1, readers)
+	assert.Equal(t, 1, writers)
+
+	// Queues without recent sessions are forgotten
+	readers, writers = r.count("work", now.Add(clientWindow+time.Second))
+	assert.Equal(t, 0, readers+writers)
+	assert.Equal(t, 0, len(r.queues))
+	readers, writers = r.count("other", now)
+	assert.Equal(t, 0, readers+writers)
+}
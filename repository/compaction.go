@@ -0,0 +1,104 @@
+package repository
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bogdanovich/siberite/config"
+	"github.com/bogdanovich/siberite/metrics"
+)
+
+// compactionThrottle watches latency of commands between scheduler
+// ticks, compact policies are deferred while it is above max_p99
+type compactionThrottle struct {
+	cfg *config.CompactionThrottleConfig
+	// latency is a sum of watched command histograms at the last update
+	latency  *metrics.Histogram
+	p99      time.Duration
+	deferred uint64
+	sync.Mutex
+}
+
+func newCompactionThrottle(cfg *config.CompactionThrottleConfig) *compactionThrottle {
+	if cfg == nil {
+		return nil
+	}
+	return &compactionThrottle{cfg: cfg}
+}
+
+// update estimates p99 latency of watched commands since the previous update
+func (t *compactionThrottle) update(stats *Stats) {
+	if t == nil {
+		return
+	}
+	latency := metrics.NewHistogram(metrics.LatencyBuckets)
+	stats.RLock()
+	for _, name := range t.cfg.Watched() {
+		if h, ok := stats.latency[name]; ok {
+			latency.Add(h)
+		}
+	}
+	stats.RUnlock()
+
+	t.Lock()
+	defer t.Unlock()
+	recent := latency
+	if t.latency != nil {
+		recent = latency.Sub(t.latency)
+	}
+	t.latency = latency
+	t.p99 = recent.Quantile(0.99)
+}
+
+// throttled reports whether recent latency is too high for compactions
+func (t *compactionThrottle) throttled() bool {
+	if t == nil {
+		return false
+	}
+	maxP99, _ := t.cfg.Limits()
+	t.Lock()
+	defer t.Unlock()
+	return t.p99 > maxP99
+}
+
+// deferCompaction reports whether a due compact policy waits for a quiet
+// period, a policy deferred for max_defer runs regardless of latency
+func (s *scheduler) deferCompaction(run *policyRun, now time.Time) bool {
+	s.Lock()
+	defer s.Unlock()
+	if !s.throttle.throttled() {
+		run.deferredSince = time.Time{}
+		return false
+	}
+	if run.deferredSince.IsZero() {
+		run.deferredSince = now
+	}
+	if _, maxDefer := s.throttle.cfg.Limits(); now.Sub(run.deferredSince) >= maxDefer {
+		run.deferredSince = time.Time{}
+		return false
+	}
+	atomic.AddUint64(&s.throttle.deferred, 1)
+	return true
+}
+
+// stats shows whether compactions are throttled, recent p99 latency
+// of watched commands and a number of deferred compaction runs
+func (t *compactionThrottle) stats() []StatItem {
+	if t == nil {
+		return nil
+	}
+	throttled := 0
+	if t.throttled() {
+		throttled = 1
+	}
+	t.Lock()
+	p99 := t.p99
+	t.Unlock()
+	return []StatItem{
+		{"compaction_throttled", fmt.Sprintf("%d", throttled)},
+		{"compaction_recent_p99_us", fmt.Sprintf("%d", p99/time.Microsecond)},
+		{"compaction_deferred", fmt.Sprintf("%d", atomic.LoadUint64(&t.deferred))},
+	}
+}
@@ -0,0 +1,80 @@
+package repository
+
+import (
+	"encoding/binary"
+	"path/filepath"
+	"sync/atomic"
+
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+// metaDir keeps repository metadata next to queue directories,
+// queue names are alphanumeric so it never collides with a queue
+const metaDir = ".meta"
+
+// counters returns cumulative stats persisted across restarts by key
+func (repo *QueueRepository) counters() map[string]*uint64 {
+	return map[string]*uint64{
+		"total_connections": &repo.Stats.TotalConnections,
+		"cmd_get":           &repo.Stats.CmdGet,
+		"cmd_set":           &repo.Stats.CmdSet,
+		"total_items":       &repo.Stats.TotalItems,
+	}
+}
+
+// loadCounters opens metadata database and restores saved counters,
+// counters are not persisted when queues are kept in memory
+func (repo *QueueRepository) loadCounters() error {
+	if repo.inMemory {
+		return nil
+	}
+	db, err := leveldb.OpenFile(filepath.Join(repo.DataPath, metaDir), nil)
+	if err != nil {
+		return err
+	}
+	repo.meta = db
+	for key, counter := range repo.counters() {
+		value, err := db.Get([]byte(key), nil)
+		if err == leveldb.ErrNotFound || len(value) != 8 {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		atomic.StoreUint64(counter, binary.BigEndian.Uint64(value))
+	}
+	return nil
+}
+
+// saveCounters writes current counters to metadata database
+func (repo *QueueRepository) saveCounters() error {
+	repo.metaLock.Lock()
+	defer repo.metaLock.Unlock()
+	return repo.writeCounters()
+}
+
+func (repo *QueueRepository) writeCounters() error {
+	if repo.meta == nil {
+		return nil
+	}
+	batch := new(leveldb.Batch)
+	for key, counter := range repo.counters() {
+		value := make([]byte, 8)
+		binary.BigEndian.PutUint64(value, atomic.LoadUint64(counter))
+		batch.Put([]byte(key), value)
+	}
+	return repo.meta.Write(batch, nil)
+}
+
+// closeCounters saves counters and closes metadata database
+func (repo *QueueRepository) closeCounters() error {
+	repo.metaLock.Lock()
+	defer repo.metaLock.Unlock()
+	if repo.meta == nil {
+		return nil
+	}
+	err := repo.writeCounters()
+	repo.meta.Close()
+	repo.meta = nil
+	return err
+}
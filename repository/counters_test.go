@@ -0,0 +1,33 @@
+package repository
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Counters_Persisted(t *testing.T) {
+	dataDir, err := ioutil.TempDir("", "siberite_counters")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dataDir)
+
+	repo, err := Initialize(dataDir)
+	assert.Nil(t, err)
+	repo.Stats.TotalConnections = 5
+	repo.Stats.CmdGet = 7
+	repo.Stats.CmdSet = 3
+	repo.Stats.TotalItems = 4
+	repo.CloseAllQueues()
+
+	repo, err = Initialize(dataDir)
+	assert.Nil(t, err)
+	defer repo.CloseAllQueues()
+	assert.Equal(t, uint64(5), repo.Stats.TotalConnections)
+	assert.Equal(t, uint64(7), repo.Stats.CmdGet)
+	assert.Equal(t, uint64(3), repo.Stats.CmdSet)
+	assert.Equal(t, uint64(4), repo.Stats.TotalItems)
+	assert.Equal(t, uint64(0), repo.Stats.CurrentConnections)
+	assert.Equal(t, 0, repo.Count(), "Metadata directory is not a queue")
+}
@@ -0,0 +1,14 @@
+package repository
+
+import "github.com/bogdanovich/siberite/queue"
+
+// DeadLetter moves an item taken from a queue to a dead letter queue,
+// see Transfer
+func (repo *QueueRepository) DeadLetter(q *queue.Queue, item *queue.Item, name string) error {
+	dq, err := repo.GetQueue(name)
+	if err != nil {
+		return err
+	}
+	_, err = q.Transfer(item, dq)
+	return err
+}
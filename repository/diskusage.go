@@ -0,0 +1,101 @@
+package repository
+
+import (
+	"sync"
+	"time"
+)
+
+// diskUsage is a measured size of a queue database
+type diskUsage struct {
+	bytes int64
+	files int
+}
+
+// diskSizer measures disk usage of open queues in background,
+// so stats don't walk queue directories
+type diskSizer struct {
+	repo     *QueueRepository
+	interval time.Duration
+	usage    map[string]diskUsage
+	done     chan struct{}
+	wg       sync.WaitGroup
+	sync.Mutex
+}
+
+// startDiskSizer returns nil when queues are kept in memory
+// or disk_usage_interval is zero
+func startDiskSizer(repo *QueueRepository, interval time.Duration) *diskSizer {
+	if repo.inMemory || interval == 0 {
+		return nil
+	}
+	s := &diskSizer{repo: repo, interval: interval, usage: map[string]diskUsage{}, done: make(chan struct{})}
+	s.wg.Add(1)
+	go s.run()
+	return s
+}
+
+func (s *diskSizer) stop() {
+	if s == nil {
+		return
+	}
+	close(s.done)
+	s.wg.Wait()
+}
+
+func (s *diskSizer) run() {
+	defer s.wg.Done()
+	s.refresh()
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			s.refresh()
+		}
+	}
+}
+
+// refresh measures every open queue, queues closed since are forgotten
+func (s *diskSizer) refresh() {
+	usage := map[string]diskUsage{}
+	for _, q := range s.repo.queues() {
+		select {
+		case <-s.done:
+			return
+		default:
+		}
+		if bytes, files, err := q.DiskUsage(); err == nil {
+			usage[q.Name] = diskUsage{bytes: bytes, files: files}
+		}
+	}
+	s.Lock()
+	s.usage = usage
+	s.Unlock()
+}
+
+// get returns the last measured usage of a queue
+func (s *diskSizer) get(name string) (diskUsage, bool) {
+	if s == nil {
+		return diskUsage{}, false
+	}
+	s.Lock()
+	defer s.Unlock()
+	usage, ok := s.usage[name]
+	return usage, ok
+}
+
+// diskUsage returns disk usage of a queue measured in background,
+// queues not measured yet are measured right away
+func (repo *QueueRepository) diskUsage(name string) (diskUsage, error) {
+	if usage, ok := repo.sizer.get(name); ok {
+		return usage, nil
+	}
+	q, err := repo.GetQueue(name)
+	if err != nil {
+		return diskUsage{}, err
+	}
+	bytes, files, err := q.DiskUsage()
+	return diskUsage{bytes: bytes, files: files}, err
+}
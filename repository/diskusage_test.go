@@ -0,0 +1,56 @@
+package repository
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/bogdanovich/siberite/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_DiskSizer(t *testing.T) {
+	dataDir, err := ioutil.TempDir("", "siberite")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dataDir)
+
+	cfg := config.Default()
+	cfg.DiskUsageInterval = "10ms"
+	assert.Nil(t, cfg.Validate())
+	repo, err := InitializeWithConfig(dataDir, cfg)
+	assert.Nil(t, err)
+	defer repo.CloseAllQueues()
+
+	q, err := repo.GetQueue("work")
+	assert.Nil(t, err)
+	q.Enqueue([]byte("value"))
+
+	var usage diskUsage
+	ok := false
+	for i := 0; i < 100 && !ok; i++ {
+		time.Sleep(10 * time.Millisecond)
+		usage, ok = repo.sizer.get("work")
+	}
+	assert.True(t, ok)
+	assert.True(t, usage.bytes > 0)
+	assert.True(t, usage.files > 0)
+
+	var buf bytes.Buffer
+	repo.WritePrometheus(&buf)
+	assert.Contains(t, buf.String(), `siberite_queue_disk_bytes{queue="work"}`)
+
+	// Without background sizing queues are measured on demand
+	cfg = config.Default()
+	cfg.DiskUsageInterval = "0"
+	assert.Nil(t, cfg.Validate())
+	repo2, err := InitializeWithConfig(dataDir+"/other", cfg)
+	assert.Nil(t, err)
+	defer repo2.CloseAllQueues()
+	assert.Nil(t, repo2.sizer)
+	repo2.GetQueue("work")
+	usage, err = repo2.diskUsage("work")
+	assert.Nil(t, err)
+	assert.True(t, usage.files > 0)
+}
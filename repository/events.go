@@ -0,0 +1,87 @@
+package repository
+
+import (
+	"sync"
+	"time"
+)
+
+// Event kinds
+const (
+	EventCreated = "created"
+	EventDeleted = "deleted"
+	EventFlushed = "flushed"
+	EventAlert   = "alert"
+	EventDropped = "dropped"
+)
+
+// eventBacklog is a number of events kept for a subscriber,
+// events are dropped for subscribers that fall further behind
+const eventBacklog = 1024
+
+// Event is a queue lifecycle change, Alert fields are set for
+// EventAlert only, see Alert. EventDropped reports a Count of events
+// a subscriber missed and has no queue.
+type Event struct {
+	Kind  string
+	Queue string
+	Time  time.Time
+	Alert *Alert
+	Count uint64
+}
+
+// eventBus fans out events to subscribers
+type eventBus struct {
+	subscribers map[*Subscription]struct{}
+	sync.Mutex
+}
+
+// Subscription receives events published after Subscribe
+type Subscription struct {
+	C       <-chan Event
+	events  chan Event
+	dropped uint64
+}
+
+func newEventBus() *eventBus {
+	return &eventBus{subscribers: map[*Subscription]struct{}{}}
+}
+
+// Subscribe returns a subscription to queue lifecycle events,
+// it must be ended with Unsubscribe
+func (repo *QueueRepository) Subscribe() *Subscription {
+	events := make(chan Event, eventBacklog)
+	s := &Subscription{C: events, events: events}
+	repo.events.Lock()
+	repo.events.subscribers[s] = struct{}{}
+	repo.events.Unlock()
+	return s
+}
+
+// Unsubscribe ends a subscription
+func (repo *QueueRepository) Unsubscribe(s *Subscription) {
+	repo.events.Lock()
+	delete(repo.events.subscribers, s)
+	repo.events.Unlock()
+}
+
+// Dropped returns a number of events the subscriber missed and resets it
+func (repo *QueueRepository) Dropped(s *Subscription) uint64 {
+	repo.events.Lock()
+	defer repo.events.Unlock()
+	dropped := s.dropped
+	s.dropped = 0
+	return dropped
+}
+
+func (repo *QueueRepository) publish(kind string, name string, alert *Alert) {
+	event := Event{Kind: kind, Queue: name, Time: time.Now(), Alert: alert}
+	repo.events.Lock()
+	defer repo.events.Unlock()
+	for s := range repo.events.subscribers {
+		select {
+		case s.events <- event:
+		default:
+			s.dropped++
+		}
+	}
+}
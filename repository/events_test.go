@@ -0,0 +1,58 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bogdanovich/siberite/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Events(t *testing.T) {
+	repo, err := Initialize(dir)
+	assert.Nil(t, err)
+	defer repo.DeleteAllQueues()
+
+	s := repo.Subscribe()
+	repo.GetQueue("events")
+	repo.GetQueue("events")
+	repo.FlushQueue("events")
+	repo.DeleteQueue("events")
+	repo.DeleteQueue("events")
+	for _, kind := range []string{EventCreated, EventFlushed, EventDeleted} {
+		event := <-s.C
+		assert.Equal(t, kind, event.Kind)
+		assert.Equal(t, "events", event.Queue)
+	}
+	assert.Equal(t, 0, len(s.C))
+
+	// Slow subscribers miss events
+	for i := 0; i < eventBacklog+2; i++ {
+		repo.publish(EventFlushed, "events", nil)
+	}
+	assert.Equal(t, uint64(2), repo.Dropped(s))
+	assert.Equal(t, uint64(0), repo.Dropped(s))
+	repo.Unsubscribe(s)
+	repo.publish(EventFlushed, "events", nil)
+	assert.Equal(t, eventBacklog, len(s.C))
+}
+
+func Test_Events_Alert(t *testing.T) {
+	cfg := config.Default()
+	cfg.Queues["alerted"] = &config.QueueConfig{Alerts: &config.AlertConfig{High: 1}}
+	repo, err := InitializeWithConfig(dir, cfg)
+	assert.Nil(t, err)
+	defer repo.DeleteAllQueues()
+
+	q, _ := repo.GetQueue("alerted")
+	s := repo.Subscribe()
+	defer repo.Unsubscribe(s)
+	q.Enqueue([]byte("1"))
+	repo.alerter.check(time.Now())
+	repo.alerter.check(time.Now())
+	event := <-s.C
+	assert.Equal(t, EventAlert, event.Kind)
+	assert.Equal(t, AlertDepthHigh, event.Alert.Alert)
+	assert.Equal(t, AlertFiring, event.Alert.State)
+	assert.Equal(t, 0, len(s.C))
+}
@@ -0,0 +1,188 @@
+package repository
+
+import (
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bogdanovich/siberite/queue"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// fanoutPrefix keeps fanout child registrations in metadata database
+// as <fanoutPrefix><parent>+<child> keys
+const fanoutPrefix = "fanout:"
+
+// fanoutRegistry keeps registered fanout children of parent queues
+// and a time each child was last read
+type fanoutRegistry struct {
+	sync.RWMutex
+	children map[string][]string
+	seen     map[string]time.Time
+}
+
+func newFanoutRegistry() *fanoutRegistry {
+	return &fanoutRegistry{children: map[string][]string{}, seen: map[string]time.Time{}}
+}
+
+// SplitFanout splits a fanout child queue name into parent and child names
+func SplitFanout(name string) (parent string, child string, ok bool) {
+	parts := strings.SplitN(name, queue.FanoutSeparator, 2)
+	if len(parts) != 2 {
+		return name, "", false
+	}
+	return parts[0], parts[1], true
+}
+
+// Fanouts returns child names registered for a parent queue
+func (repo *QueueRepository) Fanouts(parent string) []string {
+	repo.fanouts.RLock()
+	defer repo.fanouts.RUnlock()
+	return append([]string{}, repo.fanouts.children[parent]...)
+}
+
+// Fanout enqueues copies of an item enqueued to a queue to its fanout children
+func (repo *QueueRepository) Fanout(name string, item *queue.Item) {
+	children := repo.Fanouts(name)
+	if len(children) == 0 {
+		return
+	}
+	q, err := repo.GetQueue(name)
+	if err != nil {
+		log.Printf("Can't fan out item of %s: %s", name, err.Error())
+		return
+	}
+	for _, child := range children {
+		cq, err := repo.GetQueue(name + queue.FanoutSeparator + child)
+		if err == nil {
+			err = mirrorItem(q, cq, item)
+		}
+		if err != nil {
+			log.Printf("Can't fan out item of %s to %s: %s", name, child, err.Error())
+		}
+	}
+}
+
+// TouchFanout marks a fanout child as read by a consumer,
+// a child detached for inactivity is attached again
+func (repo *QueueRepository) TouchFanout(name string) {
+	if !strings.Contains(name, queue.FanoutSeparator) || repo.ValidateName(name) != nil {
+		return
+	}
+	repo.registerFanout(name)
+	repo.fanouts.Lock()
+	repo.fanouts.seen[name] = time.Now()
+	repo.fanouts.Unlock()
+}
+
+// detachFanouts stops copying items to children that had no GET
+// for detach_after of their parent queue and drops them if configured
+func (repo *QueueRepository) detachFanouts(now time.Time) {
+	repo.fanouts.RLock()
+	idle := map[string]bool{}
+	for parent, children := range repo.fanouts.children {
+		fc := repo.config.Queue(parent).Fanout
+		if fc == nil || fc.Idle() == 0 {
+			continue
+		}
+		for _, child := range children {
+			name := parent + queue.FanoutSeparator + child
+			if now.Sub(repo.fanouts.seen[name]) > fc.Idle() {
+				idle[name] = fc.Drop
+			}
+		}
+	}
+	repo.fanouts.RUnlock()
+
+	for name, drop := range idle {
+		log.Printf("fanout %s had no consumers for a while, detaching it (drop: %t)", name, drop)
+		if drop {
+			if err := repo.DeleteQueue(name); err != nil {
+				log.Printf("Can't drop fanout %s: %s", name, err.Error())
+			}
+		}
+		repo.unregisterFanout(name)
+	}
+}
+
+// registerFanout adds a fanout child of a queue opened by a consumer,
+// registrations are kept in metadata database across restarts
+func (repo *QueueRepository) registerFanout(name string) {
+	parent, child, ok := SplitFanout(name)
+	if !ok {
+		return
+	}
+	repo.fanouts.Lock()
+	for _, c := range repo.fanouts.children[parent] {
+		if c == child {
+			repo.fanouts.Unlock()
+			return
+		}
+	}
+	repo.fanouts.seen[name] = time.Now()
+	repo.fanouts.children[parent] = append(repo.fanouts.children[parent], child)
+	sort.Strings(repo.fanouts.children[parent])
+	repo.fanouts.Unlock()
+
+	repo.metaLock.Lock()
+	defer repo.metaLock.Unlock()
+	if repo.meta == nil {
+		return
+	}
+	if err := repo.meta.Put([]byte(fanoutPrefix+name), nil, nil); err != nil {
+		log.Printf("Can't save fanout %s: %s", name, err.Error())
+	}
+}
+
+// unregisterFanout removes a fanout child of a deleted queue
+func (repo *QueueRepository) unregisterFanout(name string) {
+	parent, child, ok := SplitFanout(name)
+	if !ok {
+		return
+	}
+	repo.fanouts.Lock()
+	children := []string{}
+	for _, c := range repo.fanouts.children[parent] {
+		if c != child {
+			children = append(children, c)
+		}
+	}
+	if len(children) == 0 {
+		delete(repo.fanouts.children, parent)
+	} else {
+		repo.fanouts.children[parent] = children
+	}
+	delete(repo.fanouts.seen, name)
+	repo.fanouts.Unlock()
+
+	repo.metaLock.Lock()
+	defer repo.metaLock.Unlock()
+	if repo.meta == nil {
+		return
+	}
+	if err := repo.meta.Delete([]byte(fanoutPrefix+name), nil); err != nil {
+		log.Printf("Can't delete fanout %s: %s", name, err.Error())
+	}
+}
+
+// loadFanouts restores fanout children registered before restart,
+// their inactivity is counted from startup
+func (repo *QueueRepository) loadFanouts() error {
+	repo.metaLock.Lock()
+	defer repo.metaLock.Unlock()
+	if repo.meta == nil {
+		return nil
+	}
+	iter := repo.meta.NewIterator(util.BytesPrefix([]byte(fanoutPrefix)), nil)
+	defer iter.Release()
+	for iter.Next() {
+		parent, child, ok := SplitFanout(strings.TrimPrefix(string(iter.Key()), fanoutPrefix))
+		if ok {
+			repo.fanouts.children[parent] = append(repo.fanouts.children[parent], child)
+			repo.fanouts.seen[parent+queue.FanoutSeparator+child] = time.Now()
+		}
+	}
+	return iter.Error()
+}
@@ -0,0 +1,82 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bogdanovich/siberite/config"
+	"github.com/bogdanovich/siberite/queue"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Fanout(t *testing.T) {
+	repo, err := Initialize(dir)
+	assert.Nil(t, err)
+	ctx := context.Background()
+
+	assert.Nil(t, repo.Enqueue(ctx, "events", &queue.Item{Value: []byte("0")}))
+	_, err = repo.GetQueue("events+audit")
+	assert.Nil(t, err)
+	_, err = repo.GetQueue("events+billing")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"audit", "billing"}, repo.Fanouts("events"))
+
+	assert.Nil(t, repo.Enqueue(ctx, "events", &queue.Item{Value: []byte("1"), Headers: []queue.Header{{Key: "k", Value: "v"}}}))
+	for _, name := range []string{"events+audit", "events+billing"} {
+		item, err := repo.Dequeue(ctx, name)
+		assert.Nil(t, err)
+		assert.Equal(t, "1", string(item.Value), name)
+		assert.Equal(t, []queue.Header{{Key: "k", Value: "v"}}, item.Headers)
+	}
+	q, _ := repo.GetQueue("events")
+	assert.Equal(t, uint64(2), q.Length())
+
+	// Registrations survive restarts
+	repo.CloseAllQueues()
+	repo, err = Initialize(dir)
+	assert.Nil(t, err)
+	defer repo.DeleteAllQueues()
+	assert.Equal(t, []string{"audit", "billing"}, repo.Fanouts("events"))
+
+	assert.Nil(t, repo.DeleteQueue("events+audit"))
+	assert.Equal(t, []string{"billing"}, repo.Fanouts("events"))
+	assert.Nil(t, repo.Enqueue(ctx, "events", &queue.Item{Value: []byte("2")}))
+	q, _ = repo.GetQueue("events+billing")
+	assert.Equal(t, uint64(1), q.Length())
+
+	_, err = repo.GetQueue("events+")
+	assert.Equal(t, queue.ErrInvalidName, err)
+	_, err = repo.GetQueue("events+a+b")
+	assert.Equal(t, queue.ErrInvalidName, err)
+}
+
+func Test_DetachFanouts(t *testing.T) {
+	cfg := config.Default()
+	cfg.Queues["events"] = &config.QueueConfig{Fanout: &config.FanoutConfig{DetachAfter: "1h"}}
+	cfg.Queues["logs"] = &config.QueueConfig{Fanout: &config.FanoutConfig{DetachAfter: "1h", Drop: true}}
+	assert.Nil(t, cfg.Validate())
+	repo, err := InitializeWithConfig(dir, cfg)
+	assert.Nil(t, err)
+	defer repo.DeleteAllQueues()
+
+	for _, name := range []string{"events+idle", "events+active", "logs+idle", "other+idle"} {
+		_, err = repo.GetQueue(name)
+		assert.Nil(t, err)
+	}
+	later := time.Now().Add(90 * time.Minute)
+	repo.fanouts.seen["events+active"] = later
+	repo.detachFanouts(later)
+
+	assert.Equal(t, []string{"active"}, repo.Fanouts("events"))
+	assert.Equal(t, []string{}, repo.Fanouts("logs"))
+	assert.Equal(t, []string{"idle"}, repo.Fanouts("other"))
+	_, ok := repo.get("events+idle")
+	assert.True(t, ok, "detached child is kept")
+	_, ok = repo.get("logs+idle")
+	assert.False(t, ok, "detached child is dropped")
+
+	// A consumer coming back attaches the child again
+	repo.TouchFanout("events+idle")
+	assert.Equal(t, []string{"active", "idle"}, repo.Fanouts("events"))
+}
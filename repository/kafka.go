@@ -0,0 +1,205 @@
+package repository
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bogdanovich/siberite/config"
+	"github.com/bogdanovich/siberite/queue"
+)
+
+// kafkaPrefix names per-topic queues holding items not exported yet
+const kafkaPrefix = "kafka_"
+
+// kafkaContentType is a Kafka REST proxy v2 format of base64 encoded records
+const kafkaContentType = "application/vnd.kafka.binary.v2+json"
+
+// exporter publishes items of selected queues to Kafka topics. Items
+// enqueued by clients are copied to a kafka_<topic> spool queue, a spooled
+// item is removed once the proxy acknowledged it, so the spool head is
+// a cursor surviving restarts. A response lost on the way leads to
+// a duplicate on retry.
+type exporter struct {
+	repo     *QueueRepository
+	cfg      *config.KafkaConfig
+	client   *http.Client
+	done     chan struct{}
+	wg       sync.WaitGroup
+	exported uint64
+	errors   uint64
+}
+
+func startExporter(repo *QueueRepository, cfg *config.KafkaConfig) *exporter {
+	if cfg == nil {
+		return nil
+	}
+	e := &exporter{
+		repo:   repo,
+		cfg:    cfg,
+		client: &http.Client{Timeout: replicationTimeout},
+		done:   make(chan struct{}),
+	}
+	for _, topic := range cfg.TopicNames() {
+		e.wg.Add(1)
+		go e.export(topic)
+	}
+	return e
+}
+
+func (e *exporter) stop() {
+	if e == nil {
+		return
+	}
+	close(e.done)
+	e.wg.Wait()
+}
+
+// Export spools a copy of an item enqueued by a client for its Kafka topic
+func (repo *QueueRepository) Export(name string, item *queue.Item) {
+	topic := repo.config.Kafka.Topic(name)
+	if topic == "" || strings.HasPrefix(name, kafkaPrefix) || strings.HasPrefix(name, spoolPrefix) {
+		return
+	}
+	q, err := repo.GetQueue(name)
+	if err == nil {
+		var sq *queue.Queue
+		if sq, err = repo.GetQueue(kafkaSpoolName(topic)); err == nil {
+			err = mirrorItem(q, sq, item)
+		}
+	}
+	if err != nil {
+		log.Printf("Can't spool item of %s for kafka topic %s: %s", name, topic, err.Error())
+	}
+}
+
+// kafkaSpoolName returns a spool queue name of a topic
+func kafkaSpoolName(topic string) string {
+	return kafkaPrefix + strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return '_'
+	}, topic)
+}
+
+// export publishes spooled items of a topic in batches
+func (e *exporter) export(topic string) {
+	defer e.wg.Done()
+	for {
+		sq, err := e.repo.GetQueue(kafkaSpoolName(topic))
+		if err != nil {
+			log.Printf("Can't open spool of kafka topic %s: %s", topic, err.Error())
+			if !e.wait(replicationRetryInterval) {
+				return
+			}
+			continue
+		}
+		items, values, err := e.peek(sq)
+		if err != nil {
+			log.Printf("Can't read spool of kafka topic %s: %s", topic, err.Error())
+			if !e.wait(replicationRetryInterval) {
+				return
+			}
+			continue
+		}
+		if len(items) == 0 {
+			if !e.wait(replicationPollInterval) {
+				return
+			}
+			continue
+		}
+		if err = postRecords(e.client, e.cfg.URL, topic, values); err != nil {
+			atomic.AddUint64(&e.errors, 1)
+			log.Printf("Can't export to kafka topic %s: %s", topic, err.Error())
+			if !e.wait(replicationRetryInterval) {
+				return
+			}
+			continue
+		}
+		for range items {
+			item, err := sq.Dequeue()
+			if err != nil {
+				break
+			}
+			sq.DeleteBlob(item.Blob)
+		}
+		atomic.AddUint64(&e.exported, uint64(len(items)))
+	}
+}
+
+// peek returns up to a batch of spooled items from the head with their values
+func (e *exporter) peek(sq *queue.Queue) ([]*queue.Item, [][]byte, error) {
+	items := []*queue.Item{}
+	values := [][]byte{}
+	for i := 0; i < e.cfg.Batch; i++ {
+		item, err := sq.PeekAt(uint64(i))
+		if err == queue.ErrEmpty {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		value := item.Value
+		if item.Blob != nil {
+			var buf bytes.Buffer
+			if err = sq.WriteBlob(item.Blob, &buf); err != nil {
+				return nil, nil, err
+			}
+			value = buf.Bytes()
+		}
+		items = append(items, item)
+		values = append(values, value)
+	}
+	return items, values, nil
+}
+
+// wait returns false once the exporter is stopped
+func (e *exporter) wait(d time.Duration) bool {
+	select {
+	case <-e.done:
+		return false
+	case <-time.After(d):
+		return true
+	}
+}
+
+// postRecords produces values to a topic through a Kafka REST proxy
+func postRecords(client *http.Client, baseURL string, topic string, values [][]byte) error {
+	records := make([]map[string][]byte, len(values))
+	for i, value := range values {
+		records[i] = map[string][]byte{"value": value}
+	}
+	body, err := json.Marshal(map[string]interface{}{"records": records})
+	if err != nil {
+		return err
+	}
+	url := strings.TrimSuffix(baseURL, "/") + "/topics/" + topic
+	resp, err := client.Post(url, kafkaContentType, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s responded %s", url, resp.Status)
+	}
+	return nil
+}
+
+// stats shows items exported to Kafka and failed requests,
+// items waiting for export are items of kafka_<topic> queues
+func (e *exporter) stats() []StatItem {
+	if e == nil {
+		return nil
+	}
+	return []StatItem{
+		{"kafka_exported", fmt.Sprintf("%d", atomic.LoadUint64(&e.exported))},
+		{"kafka_errors", fmt.Sprintf("%d", atomic.LoadUint64(&e.errors))},
+	}
+}
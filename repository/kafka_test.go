@@ -0,0 +1,76 @@
+package repository
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bogdanovich/siberite/config"
+	"github.com/bogdanovich/siberite/queue"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Export(t *testing.T) {
+	replicationPollInterval = 10 * time.Millisecond
+	replicationRetryInterval = 10 * time.Millisecond
+	defer func() { replicationRetryInterval = 5 * time.Second }()
+
+	var failures int32 = 1
+	topics := make(chan string, 10)
+	values := make(chan []string, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The first request fails and is retried
+		if atomic.AddInt32(&failures, -1) >= 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		var produced struct {
+			Records []struct{ Value []byte }
+		}
+		json.Unmarshal(body, &produced)
+		batch := []string{}
+		for _, record := range produced.Records {
+			batch = append(batch, string(record.Value))
+		}
+		topics <- r.URL.Path
+		values <- batch
+	}))
+	defer server.Close()
+
+	cfg := config.Default()
+	cfg.Kafka = &config.KafkaConfig{URL: server.URL, Topics: map[string]string{"events_*": "edge.events"}}
+	assert.Nil(t, cfg.Validate())
+	repo, err := InitializeWithConfig(dir, cfg)
+	assert.Nil(t, err)
+	defer repo.DeleteAllQueues()
+	defer repo.CloseAllQueues()
+
+	q, _ := repo.GetQueue("events_a")
+	for _, value := range []string{"1", "2"} {
+		item := &queue.Item{Value: []byte(value)}
+		assert.Nil(t, q.EnqueueItem(item))
+		repo.Export("events_a", item)
+	}
+	repo.Export("work", &queue.Item{Value: []byte("3")})
+
+	select {
+	case topic := <-topics:
+		assert.Equal(t, "/topics/edge.events", topic)
+		assert.Equal(t, []string{"1", "2"}, <-values)
+	case <-time.After(time.Second):
+		t.Fatal("items were not exported")
+	}
+	// Exported items leave the spool, the queue itself is untouched
+	sq, _ := repo.GetQueue(kafkaSpoolName("edge.events"))
+	for i := 0; i < 100 && sq.Length() > 0; i++ {
+		time.Sleep(time.Millisecond)
+	}
+	assert.Equal(t, uint64(0), sq.Length())
+	assert.Equal(t, uint64(2), q.Length())
+	assert.Equal(t, uint64(1), atomic.LoadUint64(&repo.exporter.errors))
+}
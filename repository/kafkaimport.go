@@ -0,0 +1,229 @@
+package repository
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bogdanovich/siberite/config"
+	"github.com/bogdanovich/siberite/queue"
+)
+
+// kafkaV2ContentType is a Kafka REST proxy v2 format of requests without records
+const kafkaV2ContentType = "application/vnd.kafka.v2+json"
+
+// errConsumerGone is returned when the proxy dropped an idle consumer instance
+var errConsumerGone = errors.New("kafka consumer instance is gone")
+
+// importer enqueues records of Kafka topics to queues through a consumer
+// instance of a Kafka REST proxy. Offsets are committed after fetched
+// records are enqueued, a failed enqueue recreates the consumer instance
+// to fetch records from the last committed offsets again, so delivery
+// is at-least-once.
+type importer struct {
+	repo     *QueueRepository
+	cfg      *config.KafkaConfig
+	client   *http.Client
+	done     chan struct{}
+	wg       sync.WaitGroup
+	consumer string
+	imported uint64
+	errors   uint64
+}
+
+func startImporter(repo *QueueRepository, cfg *config.KafkaConfig) *importer {
+	if cfg == nil || cfg.Import == nil {
+		return nil
+	}
+	i := &importer{
+		repo:   repo,
+		cfg:    cfg,
+		client: &http.Client{Timeout: replicationTimeout},
+		done:   make(chan struct{}),
+	}
+	i.wg.Add(1)
+	go i.run()
+	return i
+}
+
+func (i *importer) stop() {
+	if i == nil {
+		return
+	}
+	close(i.done)
+	i.wg.Wait()
+}
+
+type kafkaRecord struct {
+	Topic     string `json:"topic"`
+	Value     []byte `json:"value"`
+	Partition int    `json:"partition"`
+	Offset    int64  `json:"offset"`
+}
+
+func (i *importer) run() {
+	defer i.wg.Done()
+	defer i.closeConsumer()
+	for {
+		select {
+		case <-i.done:
+			return
+		default:
+		}
+		if i.consumer == "" {
+			if err := i.subscribe(); err != nil {
+				i.fail("Can't subscribe to kafka topics: %s", err)
+				if !i.wait(replicationRetryInterval) {
+					return
+				}
+				continue
+			}
+		}
+		var records []kafkaRecord
+		err := i.request("GET", i.consumer+"/records", nil, &records)
+		if err != nil {
+			if err == errConsumerGone {
+				i.consumer = ""
+				continue
+			}
+			i.fail("Can't fetch kafka records: %s", err)
+			if !i.wait(replicationRetryInterval) {
+				return
+			}
+			continue
+		}
+		if len(records) == 0 {
+			if !i.wait(replicationPollInterval) {
+				return
+			}
+			continue
+		}
+		if err = i.enqueue(records); err != nil {
+			// Records fetched after the last commit are fetched again
+			i.fail("Can't import kafka records: %s", err)
+			i.closeConsumer()
+			if !i.wait(replicationRetryInterval) {
+				return
+			}
+			continue
+		}
+		if err = i.request("POST", i.consumer+"/offsets", nil, nil); err != nil {
+			i.fail("Can't commit kafka offsets: %s", err)
+			i.closeConsumer()
+			if !i.wait(replicationRetryInterval) {
+				return
+			}
+		}
+	}
+}
+
+// enqueue adds values of records to queues mapped to their topics
+func (i *importer) enqueue(records []kafkaRecord) error {
+	for _, record := range records {
+		name, ok := i.cfg.Import.Queues[record.Topic]
+		if !ok {
+			continue
+		}
+		item := &queue.Item{Value: record.Value}
+		if err := i.repo.Enqueue(i.repo.Context(), name, item); err != nil {
+			return fmt.Errorf("%s offset %d of partition %d: %s", record.Topic, record.Offset, record.Partition, err.Error())
+		}
+		atomic.AddUint64(&i.imported, 1)
+	}
+	return nil
+}
+
+// subscribe creates a consumer instance of the group and subscribes it to topics
+func (i *importer) subscribe() error {
+	var instance struct {
+		BaseURI string `json:"base_uri"`
+	}
+	url := strings.TrimSuffix(i.cfg.URL, "/") + "/consumers/" + i.cfg.Import.Group
+	settings := map[string]string{"format": "binary", "auto.offset.reset": "earliest", "auto.commit.enable": "false"}
+	if err := i.request("POST", url, settings, &instance); err != nil {
+		return err
+	}
+	i.consumer = instance.BaseURI
+	topics := map[string][]string{"topics": i.cfg.Import.ImportTopics()}
+	if err := i.request("POST", i.consumer+"/subscription", topics, nil); err != nil {
+		i.closeConsumer()
+		return err
+	}
+	return nil
+}
+
+// closeConsumer deletes the consumer instance, its uncommitted records
+// are delivered to other instances of the group or a new one
+func (i *importer) closeConsumer() {
+	if i.consumer == "" {
+		return
+	}
+	if err := i.request("DELETE", i.consumer, nil, nil); err != nil && err != errConsumerGone {
+		log.Printf("Can't close kafka consumer instance: %s", err.Error())
+	}
+	i.consumer = ""
+}
+
+// request sends a JSON body to the proxy and decodes a JSON response into out
+func (i *importer) request(method string, url string, body interface{}, out interface{}) error {
+	var data []byte
+	if body != nil {
+		var err error
+		if data, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequest(method, url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", kafkaV2ContentType)
+	req.Header.Set("Accept", kafkaContentType)
+	resp, err := i.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return errConsumerGone
+	case resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent:
+		return fmt.Errorf("%s %s responded %s", method, url, resp.Status)
+	case out != nil:
+		return json.NewDecoder(resp.Body).Decode(out)
+	}
+	return nil
+}
+
+func (i *importer) fail(format string, err error) {
+	atomic.AddUint64(&i.errors, 1)
+	log.Printf(format, err.Error())
+}
+
+// wait returns false once the importer is stopped
+func (i *importer) wait(d time.Duration) bool {
+	select {
+	case <-i.done:
+		return false
+	case <-time.After(d):
+		return true
+	}
+}
+
+// stats shows records imported from Kafka and failed requests
+func (i *importer) stats() []StatItem {
+	if i == nil {
+		return nil
+	}
+	return []StatItem{
+		{"kafka_imported", fmt.Sprintf("%d", atomic.LoadUint64(&i.imported))},
+		{"kafka_import_errors", fmt.Sprintf("%d", atomic.LoadUint64(&i.errors))},
+	}
+}
@@ -0,0 +1,82 @@
+package repository
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bogdanovich/siberite/config"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeKafkaProxy serves one consumer instance returning records once
+// and records requests it received
+type fakeKafkaProxy struct {
+	records  []kafkaRecord
+	requests []string
+	sync.Mutex
+}
+
+func (p *fakeKafkaProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p.Lock()
+	defer p.Unlock()
+	p.requests = append(p.requests, r.Method+" "+r.URL.Path)
+	switch r.URL.Path {
+	case "/consumers/edge":
+		json.NewEncoder(w).Encode(map[string]string{
+			"instance_id": "1", "base_uri": "http://" + r.Host + "/consumers/edge/instances/1"})
+	case "/consumers/edge/instances/1/records":
+		json.NewEncoder(w).Encode(p.records)
+		p.records = nil
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (p *fakeKafkaProxy) received(request string) bool {
+	p.Lock()
+	defer p.Unlock()
+	for _, r := range p.requests {
+		if r == request {
+			return true
+		}
+	}
+	return false
+}
+
+func Test_Import(t *testing.T) {
+	replicationPollInterval = 10 * time.Millisecond
+	proxy := &fakeKafkaProxy{records: []kafkaRecord{
+		{Topic: "events", Value: []byte("1")},
+		{Topic: "events", Value: []byte("2"), Offset: 1},
+		{Topic: "other", Value: []byte("3")},
+	}}
+	server := httptest.NewServer(proxy)
+	defer server.Close()
+
+	cfg := config.Default()
+	cfg.Kafka = &config.KafkaConfig{URL: server.URL,
+		Import: &config.KafkaImportConfig{Group: "edge", Queues: map[string]string{"events": "edge_events"}}}
+	assert.Nil(t, cfg.Validate())
+	repo, err := InitializeWithConfig(dir, cfg)
+	assert.Nil(t, err)
+	defer repo.DeleteAllQueues()
+
+	for i := 0; i < 100 && !proxy.received("POST /consumers/edge/instances/1/offsets"); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.True(t, proxy.received("POST /consumers/edge/instances/1/subscription"))
+	assert.True(t, proxy.received("POST /consumers/edge/instances/1/offsets"))
+	q, _ := repo.GetQueue("edge_events")
+	assert.Equal(t, uint64(2), q.Length())
+	item, _ := q.Dequeue()
+	assert.Equal(t, "1", string(item.Value))
+	assert.Equal(t, []StatItem{{"kafka_imported", "2"}, {"kafka_import_errors", "0"}}, repo.importer.stats())
+
+	// The consumer instance is removed on shutdown
+	repo.CloseAllQueues()
+	assert.True(t, proxy.received("DELETE /consumers/edge/instances/1"))
+}
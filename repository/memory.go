@@ -0,0 +1,263 @@
+package repository
+
+import (
+	"log"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bogdanovich/siberite/queue"
+
+	"github.com/syndtr/goleveldb/leveldb/cache"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+)
+
+// MemoryKind is a kind of memory tracked by callers of TrackMemory
+type MemoryKind int
+
+// Memory held by connections
+const (
+	// MemoryConnections are connection read and write buffers
+	MemoryConnections MemoryKind = iota
+	// MemoryOpenItems are values of items opened by consumers
+	MemoryOpenItems
+	// MemoryTransactions are values staged in transactions
+	MemoryTransactions
+	// MemoryReplay are values of consumed items kept for REPLAY_LAST
+	MemoryReplay
+	memoryKinds
+)
+
+// memoryRefreshInterval is how often storage memory is estimated
+var memoryRefreshInterval = time.Second
+
+// MemoryUsage is approximate memory used by siberite in bytes
+type MemoryUsage struct {
+	Connections  int64
+	OpenItems    int64
+	Transactions int64
+	Replay       int64
+	// Memtables are counted at write buffer size of every open queue
+	Memtables   int64
+	BlockCaches int64
+	// InMemoryQueues are tables of queues kept in memory
+	InMemoryQueues int64
+	// Limit is max_memory, zero when memory is not capped
+	Limit int64
+	// CachesShrunk is set while block caches are emptied to stay under Limit
+	CachesShrunk bool
+}
+
+// Total returns a sum of memory used
+func (u *MemoryUsage) Total() int64 {
+	return u.Connections + u.OpenItems + u.Transactions + u.Replay + u.Memtables + u.BlockCaches + u.InMemoryQueues
+}
+
+// memoryAccount tracks memory held by connections and block caches
+// of queues, storage memory is estimated in background every second
+type memoryAccount struct {
+	tracked [memoryKinds]int64
+	// storage is an estimate of memtables, caches and in-memory tables
+	storage int64
+	shrunk  int32
+
+	cachesLock sync.Mutex
+	caches     map[*trackedCache]struct{}
+	wg         sync.WaitGroup
+}
+
+func newMemoryAccount() *memoryAccount {
+	return &memoryAccount{caches: map[*trackedCache]struct{}{}}
+}
+
+// trackedCache is a block cache that can be emptied under memory pressure
+type trackedCache struct {
+	cache.Cacher
+	m        *memoryAccount
+	capacity int
+}
+
+// Close unregisters the cache when its queue is closed
+func (c *trackedCache) Close() error {
+	c.m.cachesLock.Lock()
+	delete(c.m.caches, c)
+	c.m.cachesLock.Unlock()
+	return c.Cacher.Close()
+}
+
+// blockCacher returns an LRU cacher whose caches are registered,
+// caches created while memory is short start empty
+func (m *memoryAccount) blockCacher() opt.Cacher {
+	if m == nil {
+		return opt.LRUCacher
+	}
+	return &opt.CacherFunc{NewFunc: func(capacity int) cache.Cacher {
+		c := &trackedCache{Cacher: cache.NewLRU(capacity), m: m, capacity: capacity}
+		m.cachesLock.Lock()
+		defer m.cachesLock.Unlock()
+		if atomic.LoadInt32(&m.shrunk) == 1 {
+			c.SetCapacity(0)
+		}
+		m.caches[c] = struct{}{}
+		return c
+	}}
+}
+
+// setCachesShrunk empties block caches or restores their capacity
+func (m *memoryAccount) setCachesShrunk(shrunk bool) {
+	m.cachesLock.Lock()
+	defer m.cachesLock.Unlock()
+	value := int32(0)
+	if shrunk {
+		value = 1
+	}
+	if atomic.SwapInt32(&m.shrunk, value) == value {
+		return
+	}
+	for c := range m.caches {
+		if shrunk {
+			c.SetCapacity(0)
+		} else {
+			c.SetCapacity(c.capacity)
+		}
+	}
+}
+
+// TrackMemory adds delta bytes of memory of a kind, negative delta releases it
+func (repo *QueueRepository) TrackMemory(kind MemoryKind, delta int64) {
+	if repo.memory == nil || delta == 0 {
+		return
+	}
+	atomic.AddInt64(&repo.memory.tracked[kind], delta)
+}
+
+// MemoryUsage returns approximate memory used by queues and connections
+func (repo *QueueRepository) MemoryUsage() *MemoryUsage {
+	usage := repo.storageMemory()
+	usage.Limit = repo.config.MemoryLimit()
+	if m := repo.memory; m != nil {
+		usage.Connections = atomic.LoadInt64(&m.tracked[MemoryConnections])
+		usage.OpenItems = atomic.LoadInt64(&m.tracked[MemoryOpenItems])
+		usage.Transactions = atomic.LoadInt64(&m.tracked[MemoryTransactions])
+		usage.Replay = atomic.LoadInt64(&m.tracked[MemoryReplay])
+		usage.CachesShrunk = atomic.LoadInt32(&m.shrunk) == 1
+	}
+	return usage
+}
+
+// MemoryExceeded reports whether memory is over max_memory even though
+// block caches were emptied, writes are rejected then. Storage memory
+// is the last estimate of watchMemory, so writes don't estimate it.
+func (repo *QueueRepository) MemoryExceeded() bool {
+	m := repo.memory
+	if m == nil || repo.config.MemoryLimit() == 0 {
+		return false
+	}
+	if atomic.LoadInt32(&m.shrunk) == 0 {
+		return false
+	}
+	total := atomic.LoadInt64(&m.storage)
+	for kind := range m.tracked {
+		total += atomic.LoadInt64(&m.tracked[kind])
+	}
+	return total > repo.config.MemoryLimit()
+}
+
+// watchMemory checks memory every memoryRefreshInterval until the repository
+// is closed, max_memory may be set at runtime, so it runs without a limit too
+func (repo *QueueRepository) watchMemory() {
+	m := repo.memory
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		ticker := time.NewTicker(memoryRefreshInterval)
+		defer ticker.Stop()
+		for {
+			repo.checkMemory()
+			select {
+			case <-repo.ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// wait waits for watchMemory to return after the repository context is done
+func (m *memoryAccount) wait() {
+	if m == nil {
+		return
+	}
+	m.wg.Wait()
+}
+
+// checkMemory empties block caches once memory is over max_memory
+// and restores them after usage drops below 80% of it
+func (repo *QueueRepository) checkMemory() {
+	m := repo.memory
+	limit := repo.config.MemoryLimit()
+	if m == nil || limit == 0 {
+		return
+	}
+	usage := repo.MemoryUsage()
+	atomic.StoreInt64(&m.storage, usage.Memtables+usage.BlockCaches+usage.InMemoryQueues)
+	switch total := usage.Total(); {
+	case total > limit && !usage.CachesShrunk:
+		log.Printf("Memory usage %d bytes is over max_memory %d, emptying block caches", total, limit)
+		m.setCachesShrunk(true)
+	case total < limit/5*4 && usage.CachesShrunk:
+		log.Printf("Memory usage %d bytes is back under max_memory %d, restoring block caches", total, limit)
+		m.setCachesShrunk(false)
+	}
+}
+
+// storageMemory estimates memtables, block caches and in-memory tables of open queues
+func (repo *QueueRepository) storageMemory() *MemoryUsage {
+	usage := &MemoryUsage{}
+	for _, q := range repo.queues() {
+		writeBuffer := repo.config.Storage(q.Name).WriteBuffer
+		if writeBuffer == 0 {
+			writeBuffer = opt.DefaultWriteBuffer
+		}
+		usage.Memtables += int64(writeBuffer)
+		s, err := q.StorageStats()
+		if err != nil {
+			continue
+		}
+		usage.BlockCaches += int64(s.BlockCache)
+		if repo.inMemory {
+			usage.InMemoryQueues += levelsSize(s.Levels)
+		}
+	}
+	return usage
+}
+
+func levelsSize(levels []queue.LevelStats) int64 {
+	var size int64
+	for _, l := range levels {
+		size += l.Size
+	}
+	return size
+}
+
+// MemoryStats returns memory usage as stat items
+func (repo *QueueRepository) MemoryStats() []StatItem {
+	usage := repo.MemoryUsage()
+	shrunk := 0
+	if usage.CachesShrunk {
+		shrunk = 1
+	}
+	return []StatItem{
+		{"memory_connections", strconv.FormatInt(usage.Connections, 10)},
+		{"memory_open_items", strconv.FormatInt(usage.OpenItems, 10)},
+		{"memory_transactions", strconv.FormatInt(usage.Transactions, 10)},
+		{"memory_replay", strconv.FormatInt(usage.Replay, 10)},
+		{"memory_memtables", strconv.FormatInt(usage.Memtables, 10)},
+		{"memory_block_caches", strconv.FormatInt(usage.BlockCaches, 10)},
+		{"memory_in_memory_queues", strconv.FormatInt(usage.InMemoryQueues, 10)},
+		{"memory_total", strconv.FormatInt(usage.Total(), 10)},
+		{"memory_limit", strconv.FormatInt(usage.Limit, 10)},
+		{"memory_caches_shrunk", strconv.Itoa(shrunk)},
+	}
+}
@@ -0,0 +1,79 @@
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"github.com/bogdanovich/siberite/config"
+	"github.com/bogdanovich/siberite/queue"
+	"github.com/stretchr/testify/assert"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+)
+
+func Test_TrackMemory(t *testing.T) {
+	repo, err := Initialize(dir)
+	assert.Nil(t, err)
+	defer repo.DeleteAllQueues()
+	repo.DeleteAllQueues()
+
+	repo.TrackMemory(MemoryConnections, 8192)
+	repo.TrackMemory(MemoryOpenItems, 100)
+	repo.TrackMemory(MemoryTransactions, 30)
+	repo.TrackMemory(MemoryOpenItems, -40)
+	_, err = repo.GetQueue("test1")
+	assert.Nil(t, err)
+
+	usage := repo.MemoryUsage()
+	assert.Equal(t, int64(8192), usage.Connections)
+	assert.Equal(t, int64(60), usage.OpenItems)
+	assert.Equal(t, int64(30), usage.Transactions)
+	assert.Equal(t, int64(opt.DefaultWriteBuffer), usage.Memtables)
+	assert.Equal(t, int64(8192+60+30+opt.DefaultWriteBuffer), usage.Total())
+	assert.Equal(t, int64(0), usage.Limit)
+	assert.False(t, repo.MemoryExceeded())
+
+	stats := repo.MemoryStats()
+	assert.Equal(t, StatItem{"memory_open_items", "60"}, stats[1])
+	assert.Equal(t, StatItem{"memory_limit", "0"}, stats[8])
+}
+
+func Test_MaxMemory(t *testing.T) {
+	cfg := config.Default()
+	cfg.MaxMemory = 1 << 20
+	cfg.Queues["cached"] = &config.QueueConfig{Storage: &config.StorageConfig{
+		BlockCacher:    config.CacherLRU,
+		BlockCacheSize: 1 << 20,
+	}}
+	assert.Nil(t, cfg.Validate())
+
+	repo, err := InitializeWithConfig(dir, cfg)
+	assert.Nil(t, err)
+	defer repo.DeleteAllQueues()
+	repo.DeleteAllQueues()
+
+	q, err := repo.GetQueue("cached")
+	assert.Nil(t, err)
+	assert.Nil(t, q.Enqueue([]byte("1")))
+	assert.Len(t, repo.memory.caches, 1)
+
+	// Memtable alone is over the limit, caches are emptied first
+	repo.checkMemory()
+	assert.True(t, repo.MemoryExceeded())
+	assert.Equal(t, ErrOutOfMemory, repo.Enqueue(context.Background(), "cached", &queue.Item{Value: []byte("2")}))
+	assert.Equal(t, uint64(1), q.Length())
+	assert.True(t, repo.MemoryUsage().CachesShrunk)
+	for c := range repo.memory.caches {
+		assert.Equal(t, 0, c.Capacity())
+	}
+
+	assert.Nil(t, cfg.Set("max_memory", "1073741824"))
+	repo.checkMemory()
+	assert.False(t, repo.MemoryUsage().CachesShrunk)
+	assert.False(t, repo.MemoryExceeded())
+	for c := range repo.memory.caches {
+		assert.Equal(t, 1<<20, c.Capacity())
+	}
+
+	repo.DeleteQueue("cached")
+	assert.Len(t, repo.memory.caches, 0)
+}
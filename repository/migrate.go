@@ -0,0 +1,278 @@
+package repository
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bogdanovich/siberite/audit"
+	"github.com/bogdanovich/siberite/queue"
+)
+
+// Migration statuses shown in queue stats
+const (
+	MigrationRunning  = "running"
+	MigrationRetrying = "retrying"
+	MigrationDone     = "done"
+	MigrationStopped  = "stopped"
+	MigrationFailed   = "failed"
+)
+
+// ErrMigrationRunning is returned when a queue is already being migrated
+var ErrMigrationRunning = errors.New("Queue migration is already running")
+
+var migrationRetryInterval = 5 * time.Second
+
+// migration streams items of a queue to another server
+type migration struct {
+	queue  string
+	target string
+	// rate limits items sent per second, zero is unlimited
+	rate   int
+	cancel context.CancelFunc
+	sent   uint64
+	errors uint64
+	status atomic.Value
+}
+
+// migrationRegistry keeps the last migration of every queue
+type migrationRegistry struct {
+	byQueue map[string]*migration
+	sync.Mutex
+}
+
+func newMigrationRegistry() *migrationRegistry {
+	return &migrationRegistry{byQueue: map[string]*migration{}}
+}
+
+// Migrate starts streaming all items of a queue to another siberite server
+// with SET and SETMETA commands. An item is removed once the target stored
+// it, so a migration stopped or interrupted by a restart continues with
+// remaining items when it is started again. A response lost on the way
+// or an item consumed locally while it is sent leads to a duplicate on
+// the target. Delayed items are sent once due, the migration is done
+// when the queue has neither items nor delayed items.
+func (repo *QueueRepository) Migrate(name string, target string, rate int) error {
+	if _, err := repo.GetQueue(name); err != nil {
+		return err
+	}
+	repo.migrations.Lock()
+	defer repo.migrations.Unlock()
+	if m, ok := repo.migrations.byQueue[name]; ok && m.running() {
+		return ErrMigrationRunning
+	}
+	ctx, cancel := context.WithCancel(repo.Context())
+	m := &migration{queue: name, target: target, rate: rate, cancel: cancel}
+	m.status.Store(MigrationRunning)
+	repo.migrations.byQueue[name] = m
+	log.Printf("Migrating queue %s to %s", name, target)
+	go repo.migrate(ctx, m)
+	return nil
+}
+
+// StopMigration stops a running migration of a queue,
+// it returns false when there is none
+func (repo *QueueRepository) StopMigration(name string) bool {
+	repo.migrations.Lock()
+	defer repo.migrations.Unlock()
+	m, ok := repo.migrations.byQueue[name]
+	if !ok || !m.running() {
+		return false
+	}
+	m.cancel()
+	return true
+}
+
+func (m *migration) running() bool {
+	status := m.status.Load().(string)
+	return status == MigrationRunning || status == MigrationRetrying
+}
+
+// migrate sends items from the queue head until the queue is empty,
+// the head item is removed only after the target stored it
+func (repo *QueueRepository) migrate(ctx context.Context, m *migration) {
+	var conn net.Conn
+	var rw *bufio.ReadWriter
+	// closed stops a goroutine closing the connection on cancel
+	var closed chan struct{}
+	disconnect := func() {
+		if conn != nil {
+			close(closed)
+			conn.Close()
+			conn = nil
+		}
+	}
+	defer disconnect()
+	var interval time.Duration
+	if m.rate > 0 {
+		interval = time.Second / time.Duration(m.rate)
+	}
+
+	for {
+		if ctx.Err() != nil {
+			m.finish(MigrationStopped)
+			return
+		}
+		q, err := repo.GetQueue(m.queue)
+		if err != nil {
+			log.Printf("Can't migrate queue %s: %s", m.queue, err.Error())
+			m.finish(MigrationFailed)
+			return
+		}
+		item, err := q.Front()
+		if err == queue.ErrEmpty {
+			if q.Delayed() == 0 {
+				m.finish(MigrationDone)
+				return
+			}
+			// Delayed items are sent once they return to the head
+			wait := time.Until(q.NextDue())
+			if wait > migrationRetryInterval {
+				wait = migrationRetryInterval
+			}
+			sleepCtx(ctx, wait)
+			continue
+		}
+		if err != nil {
+			log.Printf("Can't migrate queue %s: %s", m.queue, err.Error())
+			m.finish(MigrationFailed)
+			return
+		}
+		if conn == nil {
+			if conn, err = repo.dialer.Dial(m.target, replicationTimeout); err != nil {
+				conn = nil
+				m.retry(fmt.Sprintf("can't connect to %s: %s", m.target, err.Error()))
+				sleepCtx(ctx, migrationRetryInterval)
+				continue
+			}
+			rw = bufio.NewReadWriter(bufio.NewReader(conn), bufio.NewWriter(conn))
+			// Closing the connection interrupts a send waiting for the target
+			closed = make(chan struct{})
+			go func(conn net.Conn, closed chan struct{}) {
+				select {
+				case <-ctx.Done():
+					conn.Close()
+				case <-closed:
+				}
+			}(conn, closed)
+		}
+
+		conn.SetDeadline(time.Now().Add(replicationTimeout))
+		if err = sendItem(rw, m.queue, q, item); err != nil {
+			if err == errRejected {
+				log.Printf("Migration target %s rejected an item of %s", m.target, m.queue)
+				m.finish(MigrationFailed)
+				return
+			}
+			disconnect()
+			m.retry(fmt.Sprintf("can't send to %s: %s", m.target, err.Error()))
+			sleepCtx(ctx, migrationRetryInterval)
+			continue
+		}
+		if err = q.RemoveHead(item); err != nil {
+			// The item was consumed meanwhile, it is on the target too
+			log.Printf("Migrated item of queue %s was not removed: %s", m.queue, err.Error())
+		} else {
+			q.DeleteBlob(item.Blob)
+			repo.record(audit.EventDrain, m.queue, item)
+		}
+		atomic.AddUint64(&m.sent, 1)
+		m.status.Store(MigrationRunning)
+		if interval > 0 {
+			sleepCtx(ctx, interval)
+		}
+	}
+}
+
+func (m *migration) retry(reason string) {
+	atomic.AddUint64(&m.errors, 1)
+	m.status.Store(MigrationRetrying)
+	log.Printf("Migration of queue %s is retrying, %s", m.queue, reason)
+}
+
+func (m *migration) finish(status string) {
+	m.cancel()
+	m.status.Store(status)
+	log.Printf("Migration of queue %s to %s %s: %d items sent", m.queue, m.target, status, atomic.LoadUint64(&m.sent))
+}
+
+// sendItem writes an item as SET or SETMETA command when it has headers
+// or a message id
+func sendItem(rw *bufio.ReadWriter, name string, q *queue.Queue, item *queue.Item) error {
+	var exptime int64
+	if !item.ExpiresAt.IsZero() {
+		exptime = item.ExpiresAt.Unix()
+	}
+	if len(item.Headers) == 0 && item.MessageID == "" {
+		fmt.Fprintf(rw, "set %s %d %d %d", name, item.Flags, exptime, item.Size)
+	} else {
+		fmt.Fprintf(rw, "setmeta %s %d %d %d", name, item.Flags, exptime, item.Size)
+		for _, header := range item.Headers {
+			fmt.Fprintf(rw, " %s=%s", header.Key, header.Value)
+		}
+		if item.MessageID != "" {
+			fmt.Fprintf(rw, " %s=%s", MessageIDHeader, item.MessageID)
+		}
+	}
+	rw.WriteString("\r\n")
+	if item.Blob != nil {
+		if err := q.WriteBlob(item.Blob, rw); err != nil {
+			return err
+		}
+	} else {
+		rw.Write(item.Value)
+	}
+	rw.WriteString("\r\n")
+	if err := rw.Flush(); err != nil {
+		return err
+	}
+
+	response, err := rw.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	switch response = strings.TrimSpace(response); {
+	case response == "STORED" || response == "NOT_STORED":
+		return nil
+	case strings.HasPrefix(response, "SERVER_ERROR"):
+		return errors.New(response)
+	}
+	return errRejected
+}
+
+// sleepCtx waits for a duration unless ctx is done first
+func sleepCtx(ctx context.Context, d time.Duration) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+	case <-timer.C:
+	}
+}
+
+// migrationStats returns progress of the last migration of a queue
+func (repo *QueueRepository) migrationStats(name string) []StatItem {
+	if repo.migrations == nil {
+		return nil
+	}
+	repo.migrations.Lock()
+	m, ok := repo.migrations.byQueue[name]
+	repo.migrations.Unlock()
+	if !ok {
+		return nil
+	}
+	prefix := "queue_" + name + "_migrate_"
+	return []StatItem{
+		{prefix + "target", m.target},
+		{prefix + "status", m.status.Load().(string)},
+		{prefix + "sent", fmt.Sprintf("%d", atomic.LoadUint64(&m.sent))},
+		{prefix + "errors", fmt.Sprintf("%d", atomic.LoadUint64(&m.errors))},
+	}
+}
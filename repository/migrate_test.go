@@ -0,0 +1,147 @@
+package repository
+
+import (
+	"bufio"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/bogdanovich/siberite/queue"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Migrate(t *testing.T) {
+	commands := make(chan string, 10)
+	listener := fakePeer(t, commands)
+	defer listener.Close()
+
+	repo, err := Initialize(dir)
+	assert.Nil(t, err)
+	defer repo.DeleteAllQueues()
+
+	q, _ := repo.GetQueue("work")
+	q.EnqueueItem(&queue.Item{Value: []byte("1"), MessageID: "0005225d3a3b70000000002a"})
+	q.EnqueueItem(&queue.Item{Value: []byte("2"), Flags: 3, Headers: []queue.Header{{Key: "k", Value: "v"}},
+		MessageID: "0005225d3a3b70010000002a"})
+
+	target := listener.Addr().String()
+	assert.Nil(t, repo.Migrate("work", target, 1000))
+	for _, expected := range []string{
+		"setmeta work 0 0 1 msg_id=0005225d3a3b70000000002a 1",
+		"setmeta work 3 0 1 k=v msg_id=0005225d3a3b70010000002a 2",
+	} {
+		select {
+		case command := <-commands:
+			assert.Equal(t, expected, command)
+		case <-time.After(time.Second):
+			t.Fatal("item was not migrated")
+		}
+	}
+
+	for i := 0; i < 100 && repo.migrationStats("work")[1].Value != MigrationDone; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, []StatItem{
+		{"queue_work_migrate_target", target},
+		{"queue_work_migrate_status", MigrationDone},
+		{"queue_work_migrate_sent", "2"},
+		{"queue_work_migrate_errors", "0"},
+	}, repo.migrationStats("work"))
+	assert.Equal(t, uint64(0), q.Length())
+	assert.False(t, repo.StopMigration("work"))
+}
+
+func Test_MigrateRetry(t *testing.T) {
+	migrationRetryInterval = 10 * time.Millisecond
+	repo, err := Initialize(dir)
+	assert.Nil(t, err)
+	defer repo.DeleteAllQueues()
+
+	q, _ := repo.GetQueue("work")
+	q.Enqueue([]byte("1"))
+
+	// Nothing listens on a closed listener address, items stay in the queue
+	listener := fakePeer(t, make(chan string))
+	target := listener.Addr().String()
+	listener.Close()
+	assert.Nil(t, repo.Migrate("work", target, 0))
+	assert.Equal(t, ErrMigrationRunning, repo.Migrate("work", target, 0))
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, MigrationRetrying, repo.migrationStats("work")[1].Value)
+	assert.Equal(t, uint64(1), q.Length())
+
+	assert.True(t, repo.StopMigration("work"))
+	for i := 0; i < 100 && repo.migrationStats("work")[1].Value != MigrationStopped; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, MigrationStopped, repo.migrationStats("work")[1].Value)
+	assert.Equal(t, uint64(1), q.Length())
+}
+
+func Test_MigrateDelayed(t *testing.T) {
+	commands := make(chan string, 10)
+	listener := fakePeer(t, commands)
+	defer listener.Close()
+
+	repo, err := Initialize(dir)
+	assert.Nil(t, err)
+	defer repo.DeleteAllQueues()
+
+	q, _ := repo.GetQueue("work")
+	q.Enqueue([]byte("1"))
+	item, _ := q.Dequeue()
+	assert.Nil(t, q.Delay(item, time.Now().Add(50*time.Millisecond)))
+
+	assert.Nil(t, repo.Migrate("work", listener.Addr().String(), 0))
+	select {
+	case command := <-commands:
+		assert.Regexp(t, "^setmeta work 0 0 1 msg_id=[0-9a-f]+ 1$", command)
+	case <-time.After(time.Second):
+		t.Fatal("delayed item was not migrated")
+	}
+	for i := 0; i < 100 && repo.migrationStats("work")[1].Value != MigrationDone; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, MigrationDone, repo.migrationStats("work")[1].Value)
+	assert.Equal(t, uint64(0), q.Delayed())
+}
+
+func Test_MigrateUnconfirmed(t *testing.T) {
+	migrationRetryInterval = 10 * time.Millisecond
+	repo, err := Initialize(dir)
+	assert.Nil(t, err)
+	defer repo.DeleteAllQueues()
+
+	q, _ := repo.GetQueue("work")
+	q.Enqueue([]byte("1"))
+
+	// The target drops connections before it confirms an item
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			bufio.NewReader(conn).ReadString('\n')
+			conn.Close()
+		}
+	}()
+
+	assert.Nil(t, repo.Migrate("work", listener.Addr().String(), 0))
+	for i := 0; i < 100 && repo.migrationStats("work")[1].Value != MigrationRetrying; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, MigrationRetrying, repo.migrationStats("work")[1].Value)
+	assert.Equal(t, uint64(1), q.Length())
+	item, _ := q.Peek()
+	assert.Equal(t, "1", string(item.Value))
+
+	assert.True(t, repo.StopMigration("work"))
+	for i := 0; i < 100 && repo.migrationStats("work")[1].Value != MigrationStopped; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, uint64(1), q.Length())
+}
@@ -0,0 +1,36 @@
+package repository
+
+import (
+	"errors"
+
+	"github.com/bogdanovich/siberite/hlc"
+	"github.com/bogdanovich/siberite/queue"
+)
+
+// MessageIDHeader carries a message id of an item sent to another
+// server, the receiving server keeps the id instead of giving a new one
+const MessageIDHeader = "msg_id"
+
+// ErrInvalidMessageID is returned for msg_id headers that are not message ids
+var ErrInvalidMessageID = errors.New("Invalid msg_id header")
+
+// AdoptMessageID moves a msg_id header of an item into its message id
+// and advances the clock past it, so ids issued here follow the item
+func AdoptMessageID(item *queue.Item) error {
+	headers := item.Headers[:0:0]
+	for _, header := range item.Headers {
+		if header.Key != MessageIDHeader {
+			headers = append(headers, header)
+			continue
+		}
+		if _, _, ok := hlc.ParseID(header.Value); !ok {
+			return ErrInvalidMessageID
+		}
+		item.MessageID = header.Value
+		hlc.Observe(header.Value)
+	}
+	if item.MessageID != "" {
+		item.Headers = headers
+	}
+	return nil
+}
@@ -0,0 +1,23 @@
+package repository
+
+import (
+	"testing"
+
+	"github.com/bogdanovich/siberite/queue"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_AdoptMessageID(t *testing.T) {
+	item := &queue.Item{Headers: []queue.Header{{Key: "k", Value: "v"}}}
+	assert.Nil(t, AdoptMessageID(item))
+	assert.Equal(t, "", item.MessageID)
+	assert.Equal(t, []queue.Header{{Key: "k", Value: "v"}}, item.Headers)
+
+	item.Headers = append(item.Headers, queue.Header{Key: MessageIDHeader, Value: "0005225d3a3b70000000002a"})
+	assert.Nil(t, AdoptMessageID(item))
+	assert.Equal(t, "0005225d3a3b70000000002a", item.MessageID)
+	assert.Equal(t, []queue.Header{{Key: "k", Value: "v"}}, item.Headers)
+
+	item = &queue.Item{Headers: []queue.Header{{Key: MessageIDHeader, Value: "42"}}}
+	assert.Equal(t, ErrInvalidMessageID, AdoptMessageID(item))
+}
@@ -0,0 +1,295 @@
+package repository
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bogdanovich/siberite/config"
+	"github.com/bogdanovich/siberite/objectstore"
+	"github.com/bogdanovich/siberite/queue"
+)
+
+// objectsDir keeps segments not uploaded yet next to queue directories
+const objectsDir = ".objects"
+
+const (
+	segmentExt  = ".jsonl.gz"
+	segmentOpen = ".open"
+)
+
+// Reasons items are archived for
+const (
+	ObjectConsumed = "consumed"
+	ObjectExpired  = "expired"
+)
+
+// objectArchiver writes items consumed from or expired in queues with
+// object_archive enabled to gzipped JSON lines segments per queue and
+// uploads closed segments every interval. Segments are closed when they
+// reach segment_size and before every upload, an uploaded segment is
+// removed. The gzip stream is flushed after every item, so items of
+// a segment still open when the process crashes are recovered and
+// uploaded as far as they were written.
+type objectArchiver struct {
+	cfg      *config.ObjectStoreConfig
+	store    *objectstore.S3
+	dir      string
+	segments map[string]*segment
+	lock     sync.Mutex
+	// uploadLock serializes uploads of closed segments
+	uploadLock sync.Mutex
+	done       chan struct{}
+	wg         sync.WaitGroup
+	items      uint64
+	uploaded   uint64
+	errors     uint64
+}
+
+// segment is an open segment file of a queue
+type segment struct {
+	path  string
+	file  *os.File
+	size  countingWriter
+	gz    *gzip.Writer
+	items int
+}
+
+type countingWriter struct {
+	w *os.File
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// archivedItem is a line of a segment
+type archivedItem struct {
+	Queue      string            `json:"queue"`
+	ID         uint64            `json:"id"`
+	Reason     string            `json:"reason"`
+	ArchivedAt time.Time         `json:"archived_at"`
+	EnqueuedAt time.Time         `json:"enqueued_at"`
+	Flags      uint32            `json:"flags"`
+	Headers    map[string]string `json:"headers,omitempty"`
+	Value      []byte            `json:"value"`
+}
+
+func startObjectArchiver(repo *QueueRepository, cfg *config.ObjectStoreConfig) *objectArchiver {
+	if cfg == nil || repo.inMemory {
+		return nil
+	}
+	a := &objectArchiver{
+		cfg:      cfg,
+		store:    objectstore.NewS3(cfg.Endpoint, cfg.Region, cfg.Bucket, cfg.AccessKey, cfg.SecretKey),
+		dir:      filepath.Join(repo.DataPath, objectsDir),
+		segments: map[string]*segment{},
+		done:     make(chan struct{}),
+	}
+	// Segments left open by a crash are finished and uploaded
+	paths, _ := filepath.Glob(filepath.Join(a.dir, "*", "*"+segmentExt+segmentOpen))
+	for _, path := range paths {
+		if err := recoverSegment(path); err != nil {
+			log.Printf("Can't recover object archive segment %s: %s", path, err.Error())
+		}
+	}
+	a.wg.Add(1)
+	go a.run()
+	return a
+}
+
+// stop closes open segments, they are uploaded after a restart
+func (a *objectArchiver) stop() {
+	if a == nil {
+		return
+	}
+	close(a.done)
+	a.wg.Wait()
+	a.closeSegments()
+}
+
+func (a *objectArchiver) run() {
+	defer a.wg.Done()
+	ticker := time.NewTicker(a.cfg.UploadInterval())
+	defer ticker.Stop()
+	for {
+		a.upload()
+		select {
+		case <-a.done:
+			return
+		case <-ticker.C:
+			a.closeSegments()
+		}
+	}
+}
+
+// add appends an item to the open segment of a queue
+func (a *objectArchiver) add(name string, q *queue.Queue, item *queue.Item, reason string) {
+	if a == nil {
+		return
+	}
+	value := item.Value
+	if item.Blob != nil && len(value) == 0 {
+		var buf bytes.Buffer
+		if err := q.WriteBlob(item.Blob, &buf); err != nil {
+			log.Printf("Can't archive item of %s to object store: %s", name, err.Error())
+			atomic.AddUint64(&a.errors, 1)
+			return
+		}
+		value = buf.Bytes()
+	}
+	line := archivedItem{
+		Queue:      name,
+		ID:         item.ID(),
+		Reason:     reason,
+		ArchivedAt: time.Now(),
+		EnqueuedAt: item.EnqueuedAt,
+		Flags:      item.Flags,
+		Value:      value,
+	}
+	if len(item.Headers) > 0 {
+		line.Headers = map[string]string{}
+		for _, header := range item.Headers {
+			line.Headers[header.Key] = header.Value
+		}
+	}
+	data, err := json.Marshal(line)
+	if err != nil {
+		return
+	}
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	s, ok := a.segments[name]
+	if !ok {
+		if s, err = a.openSegment(name); err != nil {
+			log.Printf("Can't open object archive segment of %s: %s", name, err.Error())
+			atomic.AddUint64(&a.errors, 1)
+			return
+		}
+		a.segments[name] = s
+	}
+	s.gz.Write(append(data, '\n'))
+	if err = s.gz.Flush(); err != nil {
+		log.Printf("Can't write object archive segment %s: %s", s.path, err.Error())
+		atomic.AddUint64(&a.errors, 1)
+	}
+	s.items++
+	atomic.AddUint64(&a.items, 1)
+	if s.size.n >= a.cfg.SegmentSize {
+		a.closeSegment(name, s)
+	}
+}
+
+func (a *objectArchiver) openSegment(name string) (*segment, error) {
+	dir := filepath.Join(a.dir, name)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	path := filepath.Join(dir, strconv.FormatInt(time.Now().UnixNano(), 10)+segmentExt)
+	file, err := os.Create(path + segmentOpen)
+	if err != nil {
+		return nil, err
+	}
+	s := &segment{path: path, file: file, size: countingWriter{w: file}}
+	s.gz = gzip.NewWriter(&s.size)
+	return s, nil
+}
+
+// recoverSegment rewrites items of a segment left open by a crash to a
+// finished segment, a line cut off by the crash is dropped
+func recoverSegment(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var lines []byte
+	if gz, err := gzip.NewReader(bytes.NewReader(data)); err == nil {
+		// The stream of an open segment ends without a trailer
+		lines, _ = ioutil.ReadAll(gz)
+	}
+	lines = lines[:bytes.LastIndexByte(lines, '\n')+1]
+	if len(lines) > 0 {
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		gz.Write(lines)
+		gz.Close()
+		if err = ioutil.WriteFile(strings.TrimSuffix(path, segmentOpen), buf.Bytes(), 0644); err != nil {
+			return err
+		}
+	}
+	return os.Remove(path)
+}
+
+// closeSegment finishes a segment so it is uploaded, caller must hold the lock
+func (a *objectArchiver) closeSegment(name string, s *segment) {
+	delete(a.segments, name)
+	err := s.gz.Close()
+	if closeErr := s.file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(s.path+segmentOpen, s.path)
+	}
+	if err != nil {
+		log.Printf("Can't close object archive segment %s: %s", s.path, err.Error())
+		atomic.AddUint64(&a.errors, 1)
+	}
+}
+
+func (a *objectArchiver) closeSegments() {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	for name, s := range a.segments {
+		a.closeSegment(name, s)
+	}
+}
+
+// upload puts closed segments to the object store under
+// <prefix><queue>/<yyyy>/<mm>/<dd>/<segment>, uploaded segments are removed
+func (a *objectArchiver) upload() {
+	a.uploadLock.Lock()
+	defer a.uploadLock.Unlock()
+	paths, _ := filepath.Glob(filepath.Join(a.dir, "*", "*"+segmentExt))
+	for _, path := range paths {
+		name := filepath.Base(filepath.Dir(path))
+		created, _ := strconv.ParseInt(strings.TrimSuffix(filepath.Base(path), segmentExt), 10, 64)
+		key := a.cfg.Prefix + name + "/" + time.Unix(0, created).UTC().Format("2006/01/02") + "/" + filepath.Base(path)
+		data, err := ioutil.ReadFile(path)
+		if err == nil {
+			err = a.store.Put(key, data, "application/gzip")
+		}
+		if err != nil {
+			log.Printf("Can't upload object archive segment %s: %s", path, err.Error())
+			atomic.AddUint64(&a.errors, 1)
+			return
+		}
+		os.Remove(path)
+		atomic.AddUint64(&a.uploaded, 1)
+	}
+}
+
+// stats shows archived items, uploaded segments and errors
+func (a *objectArchiver) stats() []StatItem {
+	if a == nil {
+		return nil
+	}
+	return []StatItem{
+		{"object_archive_items", fmt.Sprintf("%d", atomic.LoadUint64(&a.items))},
+		{"object_archive_uploaded", fmt.Sprintf("%d", atomic.LoadUint64(&a.uploaded))},
+		{"object_archive_errors", fmt.Sprintf("%d", atomic.LoadUint64(&a.errors))},
+	}
+}
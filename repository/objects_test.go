@@ -0,0 +1,116 @@
+package repository
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bogdanovich/siberite/config"
+	"github.com/bogdanovich/siberite/queue"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ObjectArchive(t *testing.T) {
+	var lock sync.Mutex
+	objects := map[string][]byte{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		lock.Lock()
+		objects[r.URL.Path] = body
+		lock.Unlock()
+	}))
+	defer server.Close()
+
+	dataDir, err := ioutil.TempDir("", "siberite")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dataDir)
+	cfg := config.Default()
+	cfg.ObjectStore = &config.ObjectStoreConfig{Endpoint: server.URL, Bucket: "archive", Prefix: "edge/",
+		AccessKey: "AKID", SecretKey: "secret", Interval: "1h"}
+	cfg.Queues["work"] = &config.QueueConfig{ObjectArchive: true}
+	assert.Nil(t, cfg.Validate())
+	repo, err := InitializeWithConfig(dataDir, cfg)
+	assert.Nil(t, err)
+	defer repo.CloseAllQueues()
+
+	ctx := context.Background()
+	repo.Enqueue(ctx, "work", &queue.Item{Value: []byte("expired"), ExpiresAt: time.Now().Add(-time.Second)})
+	repo.Enqueue(ctx, "work", &queue.Item{Value: []byte("consumed"), Headers: []queue.Header{{Key: "k", Value: "v"}}})
+	repo.Enqueue(ctx, "other", &queue.Item{Value: []byte("skipped")})
+	item, err := repo.Dequeue(ctx, "work")
+	assert.Nil(t, err)
+	assert.Equal(t, "consumed", string(item.Value))
+	repo.Dequeue(ctx, "other")
+
+	repo.objects.closeSegments()
+	repo.objects.upload()
+
+	lock.Lock()
+	defer lock.Unlock()
+	assert.Equal(t, 1, len(objects))
+	for path, data := range objects {
+		assert.True(t, strings.HasPrefix(path, "/archive/edge/work/"+time.Now().UTC().Format("2006/01/02")+"/"), path)
+		assert.True(t, strings.HasSuffix(path, ".jsonl.gz"), path)
+		gz, err := gzip.NewReader(bytes.NewReader(data))
+		assert.Nil(t, err)
+		lines := []archivedItem{}
+		scanner := bufio.NewScanner(gz)
+		for scanner.Scan() {
+			var line archivedItem
+			assert.Nil(t, json.Unmarshal(scanner.Bytes(), &line))
+			lines = append(lines, line)
+		}
+		assert.Equal(t, 2, len(lines))
+		assert.Equal(t, ObjectExpired, lines[0].Reason)
+		assert.Equal(t, "expired", string(lines[0].Value))
+		assert.Equal(t, ObjectConsumed, lines[1].Reason)
+		assert.Equal(t, "consumed", string(lines[1].Value))
+		assert.Equal(t, map[string]string{"k": "v"}, lines[1].Headers)
+		assert.Equal(t, "work", lines[1].Queue)
+	}
+	assert.Equal(t, []StatItem{{"object_archive_items", "2"}, {"object_archive_uploaded", "1"},
+		{"object_archive_errors", "0"}}, repo.objects.stats())
+}
+
+func Test_recoverSegment(t *testing.T) {
+	dataDir, err := ioutil.TempDir("", "siberite")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dataDir)
+
+	// A crash leaves a flushed stream without a trailer and a partial line
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	gz.Write([]byte("{\"queue\":\"work\"}\n"))
+	gz.Flush()
+	gz.Write([]byte("{\"queue\":"))
+	gz.Flush()
+	path := dataDir + "/1" + segmentExt
+	assert.Nil(t, ioutil.WriteFile(path+segmentOpen, buf.Bytes(), 0644))
+	assert.Nil(t, recoverSegment(path+segmentOpen))
+
+	_, err = os.Stat(path + segmentOpen)
+	assert.True(t, os.IsNotExist(err))
+	data, err := ioutil.ReadFile(path)
+	assert.Nil(t, err)
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	assert.Nil(t, err)
+	lines, err := ioutil.ReadAll(r)
+	assert.Nil(t, err)
+	assert.Equal(t, "{\"queue\":\"work\"}\n", string(lines))
+
+	// Segments without items are removed
+	assert.Nil(t, ioutil.WriteFile(path+segmentOpen, nil, 0644))
+	assert.Nil(t, recoverSegment(path+segmentOpen))
+	_, err = os.Stat(path + segmentOpen)
+	assert.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,105 @@
+package repository
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/bogdanovich/siberite/config"
+	"github.com/bogdanovich/siberite/objectstore"
+	"github.com/bogdanovich/siberite/queue"
+)
+
+// newBlobStore returns a store of offloaded values, nil when offloading is off
+func newBlobStore(cfg *config.OffloadConfig) (queue.BlobStore, error) {
+	switch {
+	case cfg == nil:
+		return nil, nil
+	case cfg.S3 != nil:
+		s3 := cfg.S3
+		return &s3BlobStore{
+			store:  objectstore.NewS3(s3.Endpoint, s3.Region, s3.Bucket, s3.AccessKey, s3.SecretKey),
+			prefix: s3.Prefix,
+		}, nil
+	}
+	if err := os.MkdirAll(cfg.Path, 0755); err != nil {
+		return nil, fmt.Errorf("error creating offload directory (%s): %s", cfg.Path, err.Error())
+	}
+	return &fileBlobStore{dir: cfg.Path}, nil
+}
+
+func blobName(id uint64) string {
+	return fmt.Sprintf("%016x", id)
+}
+
+// fileBlobStore keeps values as files of a directory,
+// a value is written to a temporary file renamed on Close
+type fileBlobStore struct {
+	dir string
+}
+
+type fileBlobWriter struct {
+	*os.File
+	path string
+}
+
+func (w *fileBlobWriter) Close() error {
+	if err := w.File.Close(); err != nil {
+		return err
+	}
+	return os.Rename(w.Name(), w.path)
+}
+
+func (s *fileBlobStore) Create(id uint64) (io.WriteCloser, error) {
+	path := filepath.Join(s.dir, blobName(id))
+	file, err := os.Create(path + ".tmp")
+	if err != nil {
+		return nil, err
+	}
+	return &fileBlobWriter{File: file, path: path}, nil
+}
+
+func (s *fileBlobStore) Open(id uint64) (io.ReadCloser, error) {
+	return os.Open(filepath.Join(s.dir, blobName(id)))
+}
+
+func (s *fileBlobStore) Delete(id uint64) error {
+	err := os.Remove(filepath.Join(s.dir, blobName(id)))
+	if os.IsNotExist(err) {
+		// An aborted value was never stored
+		os.Remove(filepath.Join(s.dir, blobName(id)+".tmp"))
+		return nil
+	}
+	return err
+}
+
+// s3BlobStore keeps values as objects, a value
+// is buffered in memory and uploaded on Close
+type s3BlobStore struct {
+	store  *objectstore.S3
+	prefix string
+}
+
+type s3BlobWriter struct {
+	bytes.Buffer
+	s   *s3BlobStore
+	key string
+}
+
+func (w *s3BlobWriter) Close() error {
+	return w.s.store.Put(w.key, w.Bytes(), "application/octet-stream")
+}
+
+func (s *s3BlobStore) Create(id uint64) (io.WriteCloser, error) {
+	return &s3BlobWriter{s: s, key: s.prefix + blobName(id)}, nil
+}
+
+func (s *s3BlobStore) Open(id uint64) (io.ReadCloser, error) {
+	return s.store.Get(s.prefix + blobName(id))
+}
+
+func (s *s3BlobStore) Delete(id uint64) error {
+	return s.store.Delete(s.prefix + blobName(id))
+}
@@ -0,0 +1,88 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/bogdanovich/siberite/config"
+	"github.com/bogdanovich/siberite/queue"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Offload_Path(t *testing.T) {
+	dataDir, err := ioutil.TempDir("", "siberite")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dataDir)
+	blobDir, err := ioutil.TempDir("", "siberite_blobs")
+	assert.Nil(t, err)
+	defer os.RemoveAll(blobDir)
+	cfg := config.Default()
+	cfg.Offload = &config.OffloadConfig{Path: blobDir, MinSize: config.MinOffloadSize}
+	assert.Nil(t, cfg.Validate())
+	repo, err := InitializeWithConfig(dataDir, cfg)
+	assert.Nil(t, err)
+	defer repo.CloseAllQueues()
+
+	value := bytes.Repeat([]byte("v"), config.MinOffloadSize)
+	q, err := repo.GetQueue("large")
+	assert.Nil(t, err)
+	w := q.NewSizedBlobWriter(int64(len(value)))
+	w.Write(value)
+	assert.Nil(t, w.Close())
+	assert.Nil(t, q.EnqueueItem(&queue.Item{Blob: w.Blob()}))
+
+	files, _ := ioutil.ReadDir(blobDir)
+	assert.Equal(t, 1, len(files))
+
+	item, err := repo.Dequeue(context.Background(), "large")
+	assert.Nil(t, err)
+	assert.Equal(t, value, item.Value)
+	files, _ = ioutil.ReadDir(blobDir)
+	assert.Equal(t, 0, len(files))
+}
+
+func Test_Offload_S3(t *testing.T) {
+	var lock sync.Mutex
+	objects := map[string][]byte{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		switch r.Method {
+		case "PUT":
+			objects[r.URL.Path], _ = ioutil.ReadAll(r.Body)
+		case "GET":
+			w.Write(objects[r.URL.Path])
+		case "DELETE":
+			delete(objects, r.URL.Path)
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer server.Close()
+
+	store, err := newBlobStore(&config.OffloadConfig{S3: &config.ObjectStoreConfig{
+		Endpoint: server.URL, Region: "us-east-1", Bucket: "blobs", Prefix: "edge/", AccessKey: "AKID", SecretKey: "secret"}})
+	assert.Nil(t, err)
+
+	w, err := store.Create(42)
+	assert.Nil(t, err)
+	w.Write([]byte("value"))
+	assert.Nil(t, w.Close())
+	lock.Lock()
+	assert.Equal(t, "value", string(objects["/blobs/edge/"+blobName(42)]))
+	lock.Unlock()
+
+	r, err := store.Open(42)
+	assert.Nil(t, err)
+	value, _ := ioutil.ReadAll(r)
+	r.Close()
+	assert.Equal(t, "value", string(value))
+
+	assert.Nil(t, store.Delete(42))
+	assert.Equal(t, 0, len(objects))
+}
@@ -0,0 +1,57 @@
+package repository
+
+import (
+	"hash/fnv"
+	"sync"
+
+	"github.com/bogdanovich/siberite/queue"
+)
+
+// PartitionKeyHeader assigns items with equal values to one partition
+// of a partitioned queue, items without it are spread round robin
+const PartitionKeyHeader = "partition_key"
+
+// partitionCursors keep round robin positions of partitioned queues
+type partitionCursors struct {
+	next map[string]int
+	sync.Mutex
+}
+
+func newPartitionCursors() *partitionCursors {
+	return &partitionCursors{next: map[string]int{}}
+}
+
+// Partitions returns partition names of a partitioned queue <queue>#<count>,
+// nil for other queues
+func Partitions(name string) []string {
+	_, count, ok := queue.SplitPartitioned(name)
+	if !ok {
+		return nil
+	}
+	partitions := make([]string, count)
+	for i := range partitions {
+		partitions[i] = queue.PartitionName(name, i)
+	}
+	return partitions
+}
+
+// PartitionFor returns a partition of a partitioned queue an item with
+// given headers is enqueued to, other queue names are returned as is
+func (repo *QueueRepository) PartitionFor(name string, headers []queue.Header) string {
+	_, count, ok := queue.SplitPartitioned(name)
+	if !ok {
+		return name
+	}
+	for _, header := range headers {
+		if header.Key == PartitionKeyHeader {
+			h := fnv.New32a()
+			h.Write([]byte(header.Value))
+			return queue.PartitionName(name, int(h.Sum32()%uint32(count)))
+		}
+	}
+	repo.partitions.Lock()
+	defer repo.partitions.Unlock()
+	i := repo.partitions.next[name] % count
+	repo.partitions.next[name] = i + 1
+	return queue.PartitionName(name, i)
+}
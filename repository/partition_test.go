@@ -0,0 +1,35 @@
+package repository
+
+import (
+	"testing"
+
+	"github.com/bogdanovich/siberite/queue"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_PartitionFor(t *testing.T) {
+	repo, err := Initialize(dir)
+	assert.Nil(t, err)
+	defer repo.DeleteAllQueues()
+
+	assert.Equal(t, []string{"work#2#0", "work#2#1"}, Partitions("work#2"))
+	assert.Nil(t, Partitions("work"))
+	assert.Equal(t, "work", repo.PartitionFor("work", nil))
+
+	// Items without a partition key are spread round robin
+	assert.Equal(t, "work#2#0", repo.PartitionFor("work#2", nil))
+	assert.Equal(t, "work#2#1", repo.PartitionFor("work#2", nil))
+	assert.Equal(t, "work#2#0", repo.PartitionFor("work#2", nil))
+
+	// Items with equal keys go to one partition
+	key := []queue.Header{{Key: PartitionKeyHeader, Value: "user42"}}
+	partition := repo.PartitionFor("work#2", key)
+	for i := 0; i < 5; i++ {
+		assert.Equal(t, partition, repo.PartitionFor("work#2", key))
+	}
+	assert.NotEqual(t, repo.PartitionFor("work#2", []queue.Header{{Key: PartitionKeyHeader, Value: "a"}}),
+		repo.PartitionFor("work#2", []queue.Header{{Key: PartitionKeyHeader, Value: "b"}}))
+
+	_, err = repo.GetQueue("work#2")
+	assert.Equal(t, queue.ErrInvalidName, err)
+}
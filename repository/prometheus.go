@@ -0,0 +1,219 @@
+package repository
+
+import (
+	"io"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/bogdanovich/siberite/metrics"
+	"github.com/bogdanovich/siberite/queue"
+)
+
+// WritePrometheus writes repository stats in Prometheus text format
+func (repo *QueueRepository) WritePrometheus(w io.Writer) {
+	p := metrics.NewPrometheusWriter(w)
+	stats := repo.Stats
+
+	p.Gauge("siberite_uptime_seconds", "Seconds since server start.",
+		float64(time.Now().Unix()-stats.StartTime))
+	p.Gauge("siberite_connections", "Currently open connections.",
+		float64(stats.CurrentConnections))
+	p.Counter("siberite_connections_total", "Connections accepted since server start.",
+		float64(stats.TotalConnections))
+	p.Counter("siberite_cmd_get_total", "GET commands served.", float64(stats.CmdGet))
+	p.Counter("siberite_cmd_set_total", "SET commands served.", float64(stats.CmdSet))
+	p.Counter("siberite_items_total", "Items enqueued by clients.", float64(stats.TotalItems))
+	p.Counter("siberite_panics_total", "Panics recovered in client sessions.", float64(atomic.LoadUint64(&stats.Panics)))
+	degraded := 0.0
+	if stats.Degraded {
+		degraded = 1
+	}
+	p.Gauge("siberite_degraded", "Queues are kept in a fallback data directory or in memory.", degraded)
+	if repo.elector != nil {
+		leader := 0.0
+		if repo.elector.Leader() {
+			leader = 1
+		}
+		p.Gauge("siberite_leader", "Instance is a leader of replicated queues.", leader)
+	}
+	memory := repo.MemoryUsage()
+	for _, m := range []struct {
+		kind  string
+		bytes int64
+	}{
+		{"connections", memory.Connections},
+		{"open_items", memory.OpenItems},
+		{"transactions", memory.Transactions},
+		{"replay", memory.Replay},
+		{"memtables", memory.Memtables},
+		{"block_caches", memory.BlockCaches},
+		{"in_memory_queues", memory.InMemoryQueues},
+	} {
+		p.Gauge("siberite_memory_bytes", "Approximate memory used, by kind.", float64(m.bytes), "kind", m.kind)
+	}
+
+	queues := repo.queues()
+	for _, q := range queues {
+		p.Gauge("siberite_queue_items", "Items in the queue.", float64(q.Length()), "queue", q.Name)
+	}
+	for _, q := range queues {
+		p.Gauge("siberite_queue_open_transactions", "Items opened by consumers and not closed yet.",
+			float64(q.Stats.OpenTransactions), "queue", q.Name)
+	}
+	for _, q := range queues {
+		p.Gauge("siberite_queue_age_seconds", "Time the head item has been waiting in the queue.",
+			q.Age().Seconds(), "queue", q.Name)
+	}
+	for _, q := range queues {
+		p.Gauge("siberite_queue_delayed_items", "Delayed items waiting to return to the queue.",
+			float64(q.Delayed()), "queue", q.Name)
+	}
+	for _, q := range queues {
+		p.Gauge("siberite_queue_delayed_next_due_timestamp_seconds", "Due time of the earliest delayed item, zero if none.",
+			float64(unixTime(q.NextDue())), "queue", q.Name)
+	}
+	for _, q := range queues {
+		p.Gauge("siberite_queue_peak_items", "Largest number of items in the queue since server start.",
+			float64(atomic.LoadUint64(&q.Stats.PeakItems)), "queue", q.Name)
+	}
+	for _, q := range queues {
+		for i, rate := range q.Stats.EnqueueRate.Rates() {
+			p.Gauge("siberite_queue_enqueue_rate", "Moving average of items enqueued per second.",
+				rate, "queue", q.Name, "window", rateWindows[i])
+		}
+	}
+	for _, q := range queues {
+		for i, rate := range q.Stats.DequeueRate.Rates() {
+			p.Gauge("siberite_queue_dequeue_rate", "Moving average of items dequeued per second.",
+				rate, "queue", q.Name, "window", rateWindows[i])
+		}
+	}
+	for _, q := range queues {
+		p.Counter("siberite_queue_bytes_in_total", "Bytes of values enqueued.",
+			float64(atomic.LoadUint64(&q.Stats.BytesIn)), "queue", q.Name)
+	}
+	for _, q := range queues {
+		p.Counter("siberite_queue_bytes_out_total", "Bytes of values dequeued.",
+			float64(atomic.LoadUint64(&q.Stats.BytesOut)), "queue", q.Name)
+	}
+	for _, q := range queues {
+		p.Gauge("siberite_queue_last_enqueue_timestamp_seconds", "Time of the last enqueue, zero if none.",
+			float64(unixSeconds(atomic.LoadInt64(&q.Stats.LastEnqueue))), "queue", q.Name)
+	}
+	for _, q := range queues {
+		p.Gauge("siberite_queue_last_dequeue_timestamp_seconds", "Time of the last dequeue, zero if none.",
+			float64(unixSeconds(atomic.LoadInt64(&q.Stats.LastDequeue))), "queue", q.Name)
+	}
+	for _, q := range queues {
+		readers, _ := repo.Clients(q.Name)
+		p.Gauge("siberite_queue_readers", "Sessions that read from the queue in the last 5 minutes.",
+			float64(readers), "queue", q.Name)
+	}
+	for _, q := range queues {
+		_, writers := repo.Clients(q.Name)
+		p.Gauge("siberite_queue_writers", "Sessions that wrote to the queue in the last 5 minutes.",
+			float64(writers), "queue", q.Name)
+	}
+	for _, q := range queues {
+		if usage, ok := repo.sizer.get(q.Name); ok {
+			p.Gauge("siberite_queue_disk_bytes", "Size of the queue database files, measured in background.",
+				float64(usage.bytes), "queue", q.Name)
+		}
+	}
+	for _, q := range queues {
+		p.Histogram("siberite_queue_time_in_queue_seconds", "Time items spent in the queue before dequeue.",
+			q.Stats.TimeInQueue, "queue", q.Name)
+	}
+	repo.writeStoragePrometheus(p, queues)
+	for _, name := range stats.Commands() {
+		p.Histogram("siberite_command_duration_seconds", "Command execution time.",
+			stats.CommandLatency(name), "command", name)
+	}
+}
+
+// writeStoragePrometheus writes leveldb stats of queues
+func (repo *QueueRepository) writeStoragePrometheus(p *metrics.PrometheusWriter, queues []*queue.Queue) {
+	names := []string{}
+	storage := []*queue.StorageStats{}
+	for _, q := range queues {
+		if s, err := q.StorageStats(); err == nil {
+			names = append(names, q.Name)
+			storage = append(storage, s)
+		}
+	}
+	for i, s := range storage {
+		for _, l := range s.Levels {
+			p.Gauge("siberite_queue_leveldb_level_tables", "Tables of a leveldb level.",
+				float64(l.Tables), "queue", names[i], "level", strconv.Itoa(l.Level))
+		}
+	}
+	for i, s := range storage {
+		for _, l := range s.Levels {
+			p.Gauge("siberite_queue_leveldb_level_bytes", "Size of tables of a leveldb level.",
+				float64(l.Size), "queue", names[i], "level", strconv.Itoa(l.Level))
+		}
+	}
+	for i, s := range storage {
+		for _, l := range s.Levels {
+			p.Counter("siberite_queue_leveldb_compaction_seconds_total", "Time spent compacting into a leveldb level.",
+				l.CompactionTime.Seconds(), "queue", names[i], "level", strconv.Itoa(l.Level))
+		}
+	}
+	for i, s := range storage {
+		for _, l := range s.Levels {
+			p.Counter("siberite_queue_leveldb_compaction_read_bytes_total", "Bytes read by compactions into a leveldb level.",
+				float64(l.CompactionRead), "queue", names[i], "level", strconv.Itoa(l.Level))
+		}
+	}
+	for i, s := range storage {
+		for _, l := range s.Levels {
+			p.Counter("siberite_queue_leveldb_compaction_write_bytes_total", "Bytes written by compactions into a leveldb level.",
+				float64(l.CompactionWrite), "queue", names[i], "level", strconv.Itoa(l.Level))
+		}
+	}
+	for i, s := range storage {
+		p.Counter("siberite_queue_leveldb_write_delays_total", "Writes delayed by compaction.",
+			float64(s.WriteDelays), "queue", names[i])
+	}
+	for i, s := range storage {
+		p.Counter("siberite_queue_leveldb_write_delay_seconds_total", "Time writes were delayed by compaction.",
+			s.WriteDelayTime.Seconds(), "queue", names[i])
+	}
+	for i, s := range storage {
+		paused := 0.0
+		if s.WritePaused {
+			paused = 1
+		}
+		p.Gauge("siberite_queue_leveldb_write_paused", "Writes are paused until compaction catches up.",
+			paused, "queue", names[i])
+	}
+	for i, s := range storage {
+		p.Gauge("siberite_queue_leveldb_opened_tables", "Tables kept open in the table cache.",
+			float64(s.OpenedTables), "queue", names[i])
+	}
+	for i, s := range storage {
+		p.Gauge("siberite_queue_leveldb_memtable_bytes", "Size of writes not flushed to leveldb tables yet.",
+			float64(s.MemtableBytes), "queue", names[i])
+	}
+	for i, s := range storage {
+		p.Counter("siberite_queue_leveldb_mem_compactions_total", "Memtable flushes into leveldb tables.",
+			float64(s.MemCompactions), "queue", names[i])
+	}
+	for i, s := range storage {
+		p.Counter("siberite_queue_leveldb_level0_compactions_total", "Compactions of leveldb level 0.",
+			float64(s.Level0Compactions), "queue", names[i])
+	}
+	for i, s := range storage {
+		p.Counter("siberite_queue_leveldb_table_compactions_total", "Compactions of leveldb levels above 0.",
+			float64(s.TableCompactions), "queue", names[i])
+	}
+}
+
+func (repo *QueueRepository) queues() []*queue.Queue {
+	queues := []*queue.Queue{}
+	for pair := range repo.storage.IterBuffered() {
+		queues = append(queues, pair.Val.(*queue.Queue))
+	}
+	return queues
+}
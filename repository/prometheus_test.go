@@ -0,0 +1,42 @@
+package repository
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_WritePrometheus(t *testing.T) {
+	repo, _ := Initialize(dir)
+	defer repo.DeleteAllQueues()
+
+	q, _ := repo.GetQueue("test1")
+	q.Enqueue([]byte("1"))
+	q.Enqueue([]byte("2"))
+	q.Dequeue()
+	repo.Stats.ObserveCommand("get", time.Millisecond)
+
+	var buf bytes.Buffer
+	repo.WritePrometheus(&buf)
+	output := buf.String()
+
+	for _, line := range []string{
+		"# TYPE siberite_uptime_seconds gauge",
+		"# TYPE siberite_cmd_get_total counter",
+		"siberite_queue_items{queue=\"test1\"} 1",
+		"siberite_queue_open_transactions{queue=\"test1\"} 0",
+		"# TYPE siberite_queue_time_in_queue_seconds histogram",
+		"siberite_queue_time_in_queue_seconds_count{queue=\"test1\"} 1",
+		"siberite_command_duration_seconds_count{command=\"get\"} 1",
+		"siberite_queue_leveldb_write_delays_total{queue=\"test1\"} 0",
+		"# TYPE siberite_queue_leveldb_write_paused gauge",
+		"# TYPE siberite_queue_leveldb_memtable_bytes gauge",
+		"siberite_queue_leveldb_mem_compactions_total{queue=\"test1\"} 0",
+		"siberite_memory_bytes{kind=\"open_items\"} 0",
+	} {
+		assert.True(t, strings.Contains(output, line+"\n"), line)
+	}
+}
@@ -0,0 +1,36 @@
+package repository
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/bogdanovich/siberite/metrics"
+	"github.com/bogdanovich/siberite/queue"
+)
+
+// rateWindows name metrics.RateWindows in stat keys
+var rateWindows = []string{"1m", "5m", "15m"}
+
+// rateStats returns per second moving averages as <prefix>_<window> stats
+func rateStats(prefix string, rates []float64) []StatItem {
+	stats := []StatItem{}
+	for i, rate := range rates {
+		stats = append(stats, StatItem{prefix + "_" + rateWindows[i], fmt.Sprintf("%.2f", rate)})
+	}
+	return stats
+}
+
+// totalRates sums enqueue and dequeue rates of open queues
+func totalRates(queues []*queue.Queue, now time.Time) (enqueued []float64, dequeued []float64) {
+	enqueued = make([]float64, len(metrics.RateWindows))
+	dequeued = make([]float64, len(metrics.RateWindows))
+	for _, q := range queues {
+		for i, rate := range q.Stats.EnqueueRate.RatesAt(now) {
+			enqueued[i] += rate
+		}
+		for i, rate := range q.Stats.DequeueRate.RatesAt(now) {
+			dequeued[i] += rate
+		}
+	}
+	return enqueued, dequeued
+}
@@ -0,0 +1,268 @@
+package repository
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bogdanovich/siberite/config"
+	"github.com/bogdanovich/siberite/coordination"
+	"github.com/bogdanovich/siberite/queue"
+)
+
+// OriginHeader tags items forwarded to peers with a site they were enqueued at
+const OriginHeader = "origin"
+
+const (
+	// spoolPrefix names per-peer queues holding items not forwarded yet
+	spoolPrefix = "replication_"
+	// spoolQueueHeader keeps a target queue name of a spooled item
+	spoolQueueHeader = "replication.queue"
+)
+
+var (
+	replicationPollInterval  = 100 * time.Millisecond
+	replicationRetryInterval = 5 * time.Second
+	replicationTimeout       = 30 * time.Second
+)
+
+// replicator forwards spooled items to peers over memcache protocol
+// and loads snapshots of a primary on a warm standby
+type replicator struct {
+	repo *QueueRepository
+	cfg  *config.ReplicationConfig
+	done chan struct{}
+	wg   sync.WaitGroup
+	// skips keeps spool positions of queue snapshots taken by peers
+	skips    map[string]uint64
+	skipLock sync.Mutex
+	// loading is a queue being replaced with a snapshot
+	loading     string
+	loadingLock sync.RWMutex
+	snapshot    snapshotProgress
+}
+
+// snapshotProgress tracks progress of loading snapshots
+type snapshotProgress struct {
+	Loading  int32
+	Queues   uint64
+	Items    uint64
+	LoadedAt int64
+}
+
+func startReplicator(repo *QueueRepository, cfg *config.ReplicationConfig) *replicator {
+	if cfg == nil {
+		return nil
+	}
+	r := &replicator{repo: repo, cfg: cfg, done: make(chan struct{}), skips: map[string]uint64{}}
+	for _, peer := range cfg.Peers {
+		r.wg.Add(1)
+		go r.forward(peer)
+	}
+	if cfg.Bootstrap != nil {
+		r.wg.Add(1)
+		go r.bootstrap()
+	}
+	return r
+}
+
+func startElector(cfg *config.Config) *coordination.Elector {
+	if cfg.Coordination == nil {
+		return nil
+	}
+	cc := cfg.Coordination
+	e := coordination.NewConsul(cc.Consul, cc.Key, cfg.Replication.Origin, cc.LeaderTTL())
+	e.Start()
+	<-e.Elected()
+	return e
+}
+
+func (r *replicator) stop() {
+	if r == nil {
+		return
+	}
+	close(r.done)
+	r.wg.Wait()
+}
+
+// Replicate spools a copy of an item enqueued by a client for every peer,
+// items received from peers carry origin header and are not forwarded again,
+// so sites never exchange the same item twice
+func (repo *QueueRepository) Replicate(name string, item *queue.Item) {
+	cfg := repo.config.Replication
+	if !cfg.Replicated(name) || strings.HasPrefix(name, spoolPrefix) {
+		return
+	}
+	if _, ok := item.Header(OriginHeader); ok {
+		return
+	}
+	q, err := repo.GetQueue(name)
+	if err != nil {
+		log.Printf("Can't replicate item of %s: %s", name, err.Error())
+		return
+	}
+	spooled := *item
+	spooled.Headers = append(append([]queue.Header{}, item.Headers...), queue.Header{Key: spoolQueueHeader, Value: name})
+	for _, peer := range cfg.Peers {
+		sq, err := repo.GetQueue(spoolName(peer))
+		if err == nil {
+			err = mirrorItem(q, sq, &spooled)
+		}
+		if err != nil {
+			log.Printf("Can't spool item of %s for %s: %s", name, peer, err.Error())
+		}
+	}
+}
+
+// Writable reports whether an item may be enqueued to a queue, with leader
+// election configured followers accept items of replicated queues only from peers
+func (repo *QueueRepository) Writable(name string, item *queue.Item) bool {
+	if repo.elector == nil || !repo.config.Replication.Replicated(name) || repo.elector.Leader() {
+		return true
+	}
+	_, ok := item.Header(OriginHeader)
+	return ok
+}
+
+// Leader reports whether the instance is a leader of replicated queues,
+// an instance without leader election configured is always a leader
+func (repo *QueueRepository) Leader() bool {
+	return repo.elector == nil || repo.elector.Leader()
+}
+
+// spoolName returns a spool queue name of a peer
+func spoolName(peer string) string {
+	return spoolPrefix + strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return '_'
+	}, peer)
+}
+
+// forward sends spooled items to a peer in order, an item is removed
+// from the spool once the peer stored it, so a peer that is down
+// receives its backlog when it comes back. A response lost on the way
+// leads to a duplicate on retry, peers drop it within dedup_window
+// of the queue by its message id.
+func (r *replicator) forward(peer string) {
+	defer r.wg.Done()
+	var conn net.Conn
+	var rw *bufio.ReadWriter
+	defer func() {
+		if conn != nil {
+			conn.Close()
+		}
+	}()
+
+	for {
+		sq, err := r.repo.GetQueue(spoolName(peer))
+		if err != nil {
+			log.Printf("Can't open spool of %s: %s", peer, err.Error())
+			if !r.wait(replicationRetryInterval) {
+				return
+			}
+			continue
+		}
+		item, err := sq.Peek()
+		if err != nil {
+			if !r.wait(replicationPollInterval) {
+				return
+			}
+			continue
+		}
+		if r.skipped(peer, item) {
+			if _, err = sq.Dequeue(); err == nil {
+				sq.DeleteBlob(item.Blob)
+			}
+			continue
+		}
+		if conn == nil {
+			if conn, err = r.repo.dialer.Dial(peer, replicationTimeout); err != nil {
+				conn = nil
+				log.Printf("Can't connect to replication peer %s: %s", peer, err.Error())
+				if !r.wait(replicationRetryInterval) {
+					return
+				}
+				continue
+			}
+			rw = bufio.NewReadWriter(bufio.NewReader(conn), bufio.NewWriter(conn))
+		}
+
+		conn.SetDeadline(time.Now().Add(replicationTimeout))
+		err = r.send(rw, sq, item)
+		if err == errRejected {
+			log.Printf("Replication peer %s rejected an item, dropping it", peer)
+		} else if err != nil {
+			log.Printf("Can't replicate to %s: %s", peer, err.Error())
+			conn.Close()
+			conn = nil
+			if !r.wait(replicationRetryInterval) {
+				return
+			}
+			continue
+		}
+		if _, err = sq.Dequeue(); err == nil {
+			sq.DeleteBlob(item.Blob)
+		}
+	}
+}
+
+// wait returns false once the replicator is stopped
+func (r *replicator) wait(d time.Duration) bool {
+	select {
+	case <-r.done:
+		return false
+	case <-time.After(d):
+		return true
+	}
+}
+
+var errRejected = errors.New("item rejected")
+
+// send writes an item as SETMETA command tagged with origin
+func (r *replicator) send(rw *bufio.ReadWriter, sq *queue.Queue, item *queue.Item) error {
+	name, _ := item.Header(spoolQueueHeader)
+	var exptime int64
+	if !item.ExpiresAt.IsZero() {
+		exptime = item.ExpiresAt.Unix()
+	}
+	fmt.Fprintf(rw, "setmeta %s %d %d %d", name, item.Flags, exptime, item.Size)
+	for _, header := range item.Headers {
+		if header.Key != spoolQueueHeader && header.Key != OriginHeader {
+			fmt.Fprintf(rw, " %s=%s", header.Key, header.Value)
+		}
+	}
+	if item.MessageID != "" {
+		fmt.Fprintf(rw, " %s=%s", MessageIDHeader, item.MessageID)
+	}
+	fmt.Fprintf(rw, " %s=%s\r\n", OriginHeader, r.cfg.Origin)
+	if item.Blob != nil {
+		if err := sq.WriteBlob(item.Blob, rw); err != nil {
+			return err
+		}
+	} else {
+		rw.Write(item.Value)
+	}
+	rw.WriteString("\r\n")
+	if err := rw.Flush(); err != nil {
+		return err
+	}
+
+	response, err := rw.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	switch response = strings.TrimSpace(response); {
+	case response == "STORED" || response == "NOT_STORED":
+		return nil
+	case strings.HasPrefix(response, "SERVER_ERROR"):
+		return errors.New(response)
+	}
+	return errRejected
+}
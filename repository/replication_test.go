@@ -0,0 +1,119 @@
+package repository
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bogdanovich/siberite/config"
+	"github.com/bogdanovich/siberite/coordination"
+	"github.com/bogdanovich/siberite/queue"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakePeer accepts SETMETA commands and stores their lines
+func fakePeer(t *testing.T, commands chan<- string) net.Listener {
+	return fakePeerAt(t, "127.0.0.1:0", commands)
+}
+
+func fakePeerAt(t *testing.T, addr string, commands chan<- string) net.Listener {
+	listener, err := net.Listen("tcp", addr)
+	assert.Nil(t, err)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		rw := bufio.NewReadWriter(bufio.NewReader(conn), bufio.NewWriter(conn))
+		for {
+			line, err := rw.ReadString('\n')
+			if err != nil {
+				return
+			}
+			if strings.HasPrefix(line, "auth ") {
+				commands <- strings.TrimSpace(line)
+				rw.WriteString("AUTHENTICATED replica\r\n")
+				rw.Flush()
+				continue
+			}
+			size, _ := strconv.Atoi(strings.Fields(line)[4])
+			data := make([]byte, size+2)
+			if _, err = io.ReadFull(rw, data); err != nil {
+				return
+			}
+			commands <- strings.TrimSpace(line) + " " + string(data[:size])
+			rw.WriteString("STORED\r\n")
+			rw.Flush()
+		}
+	}()
+	return listener
+}
+
+func Test_Replicate(t *testing.T) {
+	replicationPollInterval = 10 * time.Millisecond
+	commands := make(chan string, 10)
+	listener := fakePeer(t, commands)
+	defer listener.Close()
+
+	cfg := config.Default()
+	cfg.Replication = &config.ReplicationConfig{
+		Origin: "dc1",
+		Peers:  []string{listener.Addr().String()},
+		Queues: []string{"events_*"},
+	}
+	assert.Nil(t, cfg.Validate())
+
+	repo, err := InitializeWithConfig(dir, cfg)
+	assert.Nil(t, err)
+	defer repo.DeleteAllQueues()
+	defer repo.CloseAllQueues()
+
+	q, _ := repo.GetQueue("events_a")
+	item := &queue.Item{Value: []byte("1"), Flags: 3, Headers: []queue.Header{{Key: "k", Value: "v"}}}
+	assert.Nil(t, q.EnqueueItem(item))
+	repo.Replicate("events_a", item)
+
+	// Items received from peers and other queues are not forwarded
+	received := &queue.Item{Value: []byte("2"), Headers: []queue.Header{{Key: OriginHeader, Value: "dc2"}}}
+	assert.Nil(t, q.EnqueueItem(received))
+	repo.Replicate("events_a", received)
+	repo.Replicate("work", &queue.Item{Value: []byte("3")})
+
+	select {
+	case command := <-commands:
+		assert.Equal(t, "setmeta events_a 3 0 1 k=v msg_id="+item.MessageID+" origin=dc1 1", command)
+	case <-time.After(time.Second):
+		t.Fatal("item was not replicated")
+	}
+	select {
+	case command := <-commands:
+		t.Fatalf("unexpected command %s", command)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	sq, _ := repo.GetQueue(spoolName(listener.Addr().String()))
+	assert.Equal(t, uint64(0), sq.Length())
+}
+
+func Test_Writable(t *testing.T) {
+	cfg := config.Default()
+	cfg.Replication = &config.ReplicationConfig{Origin: "dc1", Peers: []string{"127.0.0.1:1"}, Queues: []string{"events_*"}}
+	repo := &QueueRepository{config: cfg}
+	item := &queue.Item{}
+	forwarded := &queue.Item{Headers: []queue.Header{{Key: OriginHeader, Value: "dc2"}}}
+
+	// Without leader election every instance accepts writes
+	assert.True(t, repo.Leader())
+	assert.True(t, repo.Writable("events_a", item))
+
+	repo.elector = coordination.NewConsul("http://127.0.0.1:1", "key", "dc1", time.Second)
+	assert.False(t, repo.Leader())
+	assert.False(t, repo.Writable("events_a", item))
+	assert.True(t, repo.Writable("events_a", forwarded))
+	assert.True(t, repo.Writable("work", item))
+}
@@ -1,15 +1,28 @@
 package repository
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
 	"log"
+	"os"
+	"path"
 	"path/filepath"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/bogdanovich/siberite/audit"
+	"github.com/bogdanovich/siberite/auth"
+	"github.com/bogdanovich/siberite/config"
+	"github.com/bogdanovich/siberite/coordination"
+	"github.com/bogdanovich/siberite/hlc"
+	"github.com/bogdanovich/siberite/metrics"
+	"github.com/bogdanovich/siberite/peer"
 	"github.com/bogdanovich/siberite/queue"
 	"github.com/streamrail/concurrent-map"
+	"github.com/syndtr/goleveldb/leveldb"
 )
 
 // Version represents siberite version
@@ -17,9 +30,47 @@ const Version = "siberite-0.4.1"
 
 // QueueRepository represents a repository of queues
 type QueueRepository struct {
-	storage  cmap.ConcurrentMap
-	DataPath string
-	Stats    *Stats
+	storage    cmap.ConcurrentMap
+	DataPath   string
+	Stats      *Stats
+	Audit      *audit.Log
+	Auth       auth.Provider
+	Policy     *auth.Policy
+	tenants    []*Tenant
+	config     *config.Config
+	scheduler  *scheduler
+	taps       map[string][]*tap
+	tapLock    sync.RWMutex
+	fanouts    *fanoutRegistry
+	memory     *memoryAccount
+	migrations *migrationRegistry
+	sessions   *sessionRegistry
+	clients    *clientRegistry
+	events     *eventBus
+	partitions *partitionCursors
+	inMemory   bool
+	meta       *leveldb.DB
+	metaLock   sync.Mutex
+	dialer     *peer.Dialer
+	replicator *replicator
+	elector    *coordination.Elector
+	alerter    *alerter
+	sizer      *diskSizer
+	shadow     *shadow
+	exporter   *exporter
+	importer   *importer
+	objects    *objectArchiver
+	blobs      queue.BlobStore
+	slowlog    slowlog
+	nameRule   *queue.NameRule
+	// expectedQueues is a number of queues found in data directory
+	// on startup, see openFilesCapacity
+	expectedQueues int
+	filesWarned    int32
+	// ctx is cancelled by CloseAllQueues
+	ctx    context.Context
+	cancel context.CancelFunc
+	// Mutex guards queue open and delete, lookups of open queues don't take it
 	sync.Mutex
 }
 
@@ -31,6 +82,16 @@ type Stats struct {
 	TotalConnections   uint64
 	CmdGet             uint64
 	CmdSet             uint64
+	TotalItems         uint64
+	AuthFailures       uint64
+	// Panics counts panics recovered in client sessions
+	Panics uint64
+	// ConfigChanges counts settings changed at runtime, see SetConfig
+	ConfigChanges uint64
+	// Degraded is set when queues are kept in a fallback location
+	Degraded bool
+	latency  map[string]*metrics.Histogram
+	sync.RWMutex
 }
 
 // StatItem - a single stats item
@@ -43,40 +104,259 @@ var err error
 
 // Initialize and open all queues in the data directory
 func Initialize(dataDir string) (*QueueRepository, error) {
+	return InitializeWithConfig(dataDir, config.Default())
+}
+
+// InitializeWithConfig opens all queues in the data directory
+// and starts scheduled maintenance of queues
+func InitializeWithConfig(dataDir string, cfg *config.Config) (*QueueRepository, error) {
+	return initializeWithConfig(dataDir, cfg, false, true)
+}
+
+// OpenWithConfig opens all queues in the data directory without starting
+// replication, maintenance and other background services, e.g. to check them
+func OpenWithConfig(dataDir string, cfg *config.Config) (*QueueRepository, error) {
+	return initializeWithConfig(dataDir, cfg, false, false)
+}
+
+// InitializeInMemory creates a repository keeping queues in memory only,
+// items are lost when it is closed
+func InitializeInMemory(cfg *config.Config) (*QueueRepository, error) {
+	return initializeWithConfig("", cfg, true, true)
+}
+
+func initializeWithConfig(dataDir string, cfg *config.Config, inMemory bool, services bool) (*QueueRepository, error) {
 	dataPath, err := filepath.Abs(dataDir)
 	if err != nil {
 		return nil, err
 	}
-	stats := &Stats{Version, time.Now().Unix(), 0, 0, 0, 0}
-	repo := QueueRepository{storage: cmap.New(), DataPath: dataPath, Stats: stats}
-	return &repo, repo.initialize()
+	stats := &Stats{
+		Version:   Version,
+		StartTime: time.Now().Unix(),
+		latency:   make(map[string]*metrics.Histogram),
+	}
+	repo := &QueueRepository{
+		storage:  cmap.New(),
+		DataPath: dataPath,
+		Stats:    stats,
+		config:   cfg,
+		taps:     map[string][]*tap{},
+		fanouts:  newFanoutRegistry(),
+		memory:   newMemoryAccount(),
+	}
+	repo.migrations = newMigrationRegistry()
+	repo.sessions = newSessionRegistry()
+	repo.clients = newClientRegistry()
+	repo.events = newEventBus()
+	repo.partitions = newPartitionCursors()
+	repo.inMemory = inMemory
+	if repo.nameRule, err = newNameRule(cfg.QueueNames); err != nil {
+		return nil, err
+	}
+	repo.scheduler = newScheduler(repo)
+	repo.ctx, repo.cancel = context.WithCancel(context.Background())
+	if !inMemory {
+		err = checkWritable(dataPath)
+	}
+	if err != nil && cfg.DataFallback != "" {
+		log.Printf("WARNING: data directory %s is not writable (%s), running degraded with %s data directory",
+			dataPath, err.Error(), cfg.DataFallback)
+		if err = repo.fallback(cfg.DataFallback); err != nil {
+			return repo, err
+		}
+	}
+	if cfg.Audit != nil {
+		repo.Audit, err = audit.Open(cfg.Audit.Path, cfg.Audit.MaxSize, cfg.Audit.MaxFiles)
+		if err != nil {
+			return repo, fmt.Errorf("error opening audit log: %s", err.Error())
+		}
+	}
+	if repo.Auth, err = auth.New(cfg.Auth); err != nil {
+		return repo, err
+	}
+	repo.Policy = auth.NewPolicy(cfg.Auth)
+	repo.tenants = newTenants(cfg.Auth)
+	if err = repo.loadCounters(); err != nil {
+		log.Printf("WARNING: can't load counters (%s), counters will reset on restart", err.Error())
+	}
+	if err = repo.loadFanouts(); err != nil {
+		return repo, fmt.Errorf("error loading fanouts: %s", err.Error())
+	}
+	if repo.blobs, err = newBlobStore(cfg.Offload); err != nil {
+		return repo, err
+	}
+	if repo.dialer, err = peer.NewDialer(cfg.Peer); err != nil {
+		return repo, err
+	}
+	// Sites of a replication setup issue message ids of their origin,
+	// other servers use a random node
+	if cfg.Replication != nil {
+		hlc.SetNode(cfg.Replication.Origin)
+	}
+	// Queues opened on startup get expire hooks of object archive
+	if services {
+		repo.objects = startObjectArchiver(repo, cfg.ObjectStore)
+	}
+	if err = repo.initialize(); err != nil {
+		return repo, err
+	}
+	if err = repo.replayJournals(); err != nil {
+		return repo, err
+	}
+	if !services {
+		return repo, nil
+	}
+	// Bootstrap of a follower must not replace data of a leader,
+	// so the replicator starts once leadership is known
+	repo.elector = startElector(cfg)
+	repo.replicator = startReplicator(repo, cfg.Replication)
+	repo.alerter = startAlerter(repo, cfg)
+	repo.sizer = startDiskSizer(repo, cfg.DiskUsage())
+	repo.watchMemory()
+	repo.shadow = startShadow(cfg.Shadow, repo.dialer)
+	repo.exporter = startExporter(repo, cfg.Kafka)
+	repo.importer = startImporter(repo, cfg.Kafka)
+	repo.scheduler.start()
+	return repo, nil
+}
+
+// Context returns a context cancelled when the repository is closed,
+// waiting operations derive their contexts from it
+func (repo *QueueRepository) Context() context.Context {
+	if repo.ctx == nil {
+		return context.Background()
+	}
+	return repo.ctx
+}
+
+// InMemory reports whether queues are kept in memory only
+func (repo *QueueRepository) InMemory() bool {
+	return repo.inMemory
+}
+
+// fallback switches repository to a secondary data directory or memory
+func (repo *QueueRepository) fallback(dataDir string) error {
+	repo.Stats.Degraded = true
+	if dataDir == config.FallbackMemory {
+		repo.inMemory = true
+		return nil
+	}
+	dataPath, err := filepath.Abs(dataDir)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(dataPath, 0777); err != nil {
+		return err
+	}
+	repo.DataPath = dataPath
+	return checkWritable(dataPath)
+}
+
+func checkWritable(dataPath string) error {
+	f, err := ioutil.TempFile(dataPath, ".siberite")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(f.Name())
 }
 
 // GetQueue returns existing queue from repository,
 // creates a new one if it doesn't exist
 func (repo *QueueRepository) GetQueue(key string) (*queue.Queue, error) {
+	return repo.getQueue(key, true)
+}
+
+// getQueue opens a queue, a queue without data in the data directory
+// is announced as created unless it is recreated by FlushQueue
+func (repo *QueueRepository) getQueue(key string, announce bool) (*queue.Queue, error) {
 	q, ok := repo.get(key)
 	if !ok {
 		repo.Lock()
 		defer repo.Unlock()
 		if q, ok = repo.get(key); !ok {
-			q, err = queue.Open(key, repo.DataPath)
+			var err error
+			created := repo.inMemory
+			if !created {
+				_, err = os.Stat(filepath.Join(repo.DataPath, repo.names().Dir(key)))
+				created = os.IsNotExist(err)
+			}
+			if repo.inMemory {
+				q, err = queue.OpenInMemoryWithRule(key, repo.storageOptions(key), repo.names())
+			} else {
+				q, err = queue.OpenWithRule(key, repo.DataPath, repo.storageOptions(key), repo.names())
+			}
 			if err != nil {
 				return nil, err
 			}
+			if repo.config.VerifyOnOpen {
+				repo.verify(q)
+			}
+			if repo.config.ParanoidReads {
+				q.SetReadVerification(func(anomaly string) {
+					log.Printf("WARNING: queue %s: %s", key, anomaly)
+				})
+			}
+			if repo.objects != nil && repo.config.Queue(key).ObjectArchive {
+				q.SetExpireHook(func(item *queue.Item) {
+					repo.objects.add(key, q, item, ObjectExpired)
+				})
+			}
+			if repo.blobs != nil {
+				q.SetBlobStore(repo.blobs, repo.config.Offload.MinSize)
+				if removed, err := q.RemoveOrphanValues(); err != nil {
+					log.Printf("Can't remove orphan values of %s: %s", key, err.Error())
+				} else if removed > 0 {
+					log.Printf("Removed %d orphan values of %s", removed, key)
+				}
+			}
+			if gc := repo.config.GroupCommit; gc != nil {
+				target, maxWindow := gc.Limits()
+				q.SetGroupCommit(target, maxWindow, gc.MaxBatch)
+			}
 			repo.storage.Set(key, q)
+			repo.registerFanout(key)
+			repo.checkOpenFiles()
+			if created && announce {
+				repo.publish(EventCreated, key, nil)
+			}
 		}
 	}
 	return q, nil
 }
 
+// Config returns server configuration
+func (repo *QueueRepository) Config() *config.Config {
+	return repo.config
+}
+
+// QueueConfig returns configured settings of a queue
+func (repo *QueueRepository) QueueConfig(key string) *config.QueueConfig {
+	return repo.config.Queue(key)
+}
+
 // DeleteQueue deletes a queue from the repository
 func (repo *QueueRepository) DeleteQueue(key string) error {
-	if q, ok := repo.get(key); ok {
-		q.Drop()
-		repo.storage.Remove(key)
+	deleted, err := repo.deleteQueue(key)
+	if deleted {
+		repo.publish(EventDeleted, key, nil)
 	}
-	return nil
+	return err
+}
+
+// deleteQueue drops an open queue, it reports whether there was one
+func (repo *QueueRepository) deleteQueue(key string) (bool, error) {
+	repo.Lock()
+	defer repo.Unlock()
+	q, ok := repo.get(key)
+	if !ok {
+		// Existing queues are deleted even if naming rules changed since
+		return false, repo.ValidateName(key)
+	}
+	q.Drop()
+	repo.storage.Remove(key)
+	repo.unregisterFanout(key)
+	return true, nil
 }
 
 // DeleteAllQueues deletes all queues from the repo
@@ -93,12 +373,14 @@ func (repo *QueueRepository) DeleteAllQueues() error {
 
 // FlushQueue removes all items from queue
 func (repo *QueueRepository) FlushQueue(key string) error {
-	err := repo.DeleteQueue(key)
+	_, err := repo.deleteQueue(key)
 	if err != nil {
 		return err
 	}
 	// initialize new queue
-	_, err = repo.GetQueue(key)
+	if _, err = repo.getQueue(key, false); err == nil {
+		repo.publish(EventFlushed, key, nil)
+	}
 	return err
 }
 
@@ -114,8 +396,27 @@ func (repo *QueueRepository) FlushAllQueues() error {
 	return nil
 }
 
-// CloseAllQueues closes all queues
+// CloseAllQueues stops scheduled maintenance, saves counters,
+// closes all queues and audit log
 func (repo *QueueRepository) CloseAllQueues() error {
+	if repo.cancel != nil {
+		repo.cancel()
+	}
+	repo.scheduler.stop()
+	repo.replicator.stop()
+	repo.elector.Stop()
+	repo.alerter.stop()
+	repo.sizer.stop()
+	repo.memory.wait()
+	repo.shadow.stop()
+	repo.exporter.stop()
+	repo.importer.stop()
+	repo.objects.stop()
+	// Items of parked sessions go back to their queues
+	repo.releaseParkedSessions()
+	if err := repo.closeCounters(); err != nil {
+		log.Printf("Can't save counters: %s", err.Error())
+	}
 	var err error
 	var q *queue.Queue
 	for pair := range repo.storage.IterBuffered() {
@@ -125,7 +426,7 @@ func (repo *QueueRepository) CloseAllQueues() error {
 		}
 		q.Close()
 	}
-	return nil
+	return repo.Audit.Close()
 }
 
 // FullStats gets repository stats
@@ -139,38 +440,218 @@ func (repo *QueueRepository) FullStats() []StatItem {
 	stats = append(stats, StatItem{"total_connections", fmt.Sprintf("%d", repo.Stats.TotalConnections)})
 	stats = append(stats, StatItem{"cmd_get", fmt.Sprintf("%d", repo.Stats.CmdGet)})
 	stats = append(stats, StatItem{"cmd_set", fmt.Sprintf("%d", repo.Stats.CmdSet)})
-	var q *queue.Queue
+	stats = append(stats, StatItem{"total_items", fmt.Sprintf("%d", repo.Stats.TotalItems)})
+	stats = append(stats, StatItem{"panics", fmt.Sprintf("%d", atomic.LoadUint64(&repo.Stats.Panics))})
+	if repo.Auth != nil {
+		stats = append(stats, StatItem{"auth_failures", fmt.Sprintf("%d", atomic.LoadUint64(&repo.Stats.AuthFailures))})
+	}
+	stats = append(stats, repo.tenantStats()...)
+	enqueued, dequeued := totalRates(repo.queues(), time.Now())
+	stats = append(stats, rateStats("enqueue_rate", enqueued)...)
+	stats = append(stats, rateStats("dequeue_rate", dequeued)...)
+	if repo.elector != nil {
+		leader := 0
+		if repo.elector.Leader() {
+			leader = 1
+		}
+		stats = append(stats, StatItem{"leader", fmt.Sprintf("%d", leader)})
+	}
+	stats = append(stats, repo.replicator.snapshotStats()...)
+	stats = append(stats, repo.scheduler.throttle.stats()...)
+	stats = append(stats, repo.shadow.stats()...)
+	stats = append(stats, repo.exporter.stats()...)
+	stats = append(stats, repo.importer.stats()...)
+	stats = append(stats, repo.objects.stats()...)
+	if repo.Stats.Degraded {
+		dataPath := repo.DataPath
+		if repo.inMemory {
+			dataPath = config.FallbackMemory
+		}
+		stats = append(stats, StatItem{"degraded", "1"})
+		stats = append(stats, StatItem{"data_path", dataPath})
+	}
 	for pair := range repo.storage.IterBuffered() {
-		q = pair.Val.(*queue.Queue)
-		stats = append(stats, StatItem{"queue_" + q.Name + "_items", fmt.Sprintf("%d", q.Length())})
-		stats = append(stats, StatItem{"queue_" + q.Name + "_open_transactions", fmt.Sprintf("%d", q.Stats.OpenTransactions)})
+		stats = append(stats, repo.queueStats(pair.Val.(*queue.Queue))...)
+	}
+	for _, name := range repo.Stats.Commands() {
+		latency := repo.Stats.CommandLatency(name)
+		for _, p := range percentiles {
+			stats = append(stats, StatItem{"cmd_" + name + "_latency_" + p.name + "_us",
+				fmt.Sprintf("%d", latency.Quantile(p.value)/time.Microsecond)})
+		}
+	}
+	return stats
+}
+
+// MatchingStats returns stats of queues matching a glob pattern
+func (repo *QueueRepository) MatchingStats(pattern string) ([]StatItem, error) {
+	names, err := repo.MatchQueues(pattern)
+	if err != nil {
+		return nil, err
+	}
+	stats := []StatItem{}
+	for _, name := range names {
+		if q, ok := repo.get(name); ok {
+			stats = append(stats, repo.queueStats(q)...)
+		}
+	}
+	return stats, nil
+}
+
+// MatchQueues returns sorted names of open queues matching a glob pattern
+func (repo *QueueRepository) MatchQueues(pattern string) ([]string, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, err
+	}
+	names := []string{}
+	for _, name := range repo.queueNames() {
+		if ok, _ := path.Match(pattern, name); ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (repo *QueueRepository) queueStats(q *queue.Queue) []StatItem {
+	stats := []StatItem{}
+	stats = append(stats, StatItem{"queue_" + q.Name + "_items", fmt.Sprintf("%d", q.Length())})
+	stats = append(stats, StatItem{"queue_" + q.Name + "_open_transactions", fmt.Sprintf("%d", q.Stats.OpenTransactions)})
+	stats = append(stats, StatItem{"queue_" + q.Name + "_age_ms", fmt.Sprintf("%d", q.Age()/time.Millisecond)})
+	stats = append(stats, StatItem{"queue_" + q.Name + "_delayed_items", fmt.Sprintf("%d", q.Delayed())})
+	stats = append(stats, StatItem{"queue_" + q.Name + "_delayed_next_due", fmt.Sprintf("%d", unixTime(q.NextDue()))})
+	stats = append(stats, StatItem{"queue_" + q.Name + "_archived_items", fmt.Sprintf("%d", q.Archived())})
+	stats = append(stats, StatItem{"queue_" + q.Name + "_peak_items", fmt.Sprintf("%d", atomic.LoadUint64(&q.Stats.PeakItems))})
+	stats = append(stats, StatItem{"queue_" + q.Name + "_bytes_in", fmt.Sprintf("%d", atomic.LoadUint64(&q.Stats.BytesIn))})
+	stats = append(stats, StatItem{"queue_" + q.Name + "_bytes_out", fmt.Sprintf("%d", atomic.LoadUint64(&q.Stats.BytesOut))})
+	stats = append(stats, rateStats("queue_"+q.Name+"_enqueue_rate", q.Stats.EnqueueRate.Rates())...)
+	stats = append(stats, rateStats("queue_"+q.Name+"_dequeue_rate", q.Stats.DequeueRate.Rates())...)
+	stats = append(stats, StatItem{"queue_" + q.Name + "_last_enqueue", fmt.Sprintf("%d", unixSeconds(atomic.LoadInt64(&q.Stats.LastEnqueue)))})
+	stats = append(stats, StatItem{"queue_" + q.Name + "_last_dequeue", fmt.Sprintf("%d", unixSeconds(atomic.LoadInt64(&q.Stats.LastDequeue)))})
+	readers, writers := repo.Clients(q.Name)
+	stats = append(stats, StatItem{"queue_" + q.Name + "_readers", fmt.Sprintf("%d", readers)})
+	stats = append(stats, StatItem{"queue_" + q.Name + "_writers", fmt.Sprintf("%d", writers)})
+	stats = append(stats, StatItem{"queue_" + q.Name + "_rebases", fmt.Sprintf("%d", atomic.LoadUint64(&q.Stats.Rebases))})
+	stats = append(stats, StatItem{"queue_" + q.Name + "_last_rebase", fmt.Sprintf("%d", unixSeconds(atomic.LoadInt64(&q.Stats.LastRebase)))})
+	stats = append(stats, StatItem{"queue_" + q.Name + "_disconnect_requeued", fmt.Sprintf("%d", q.Stats.DisconnectRequeued)})
+	stats = append(stats, StatItem{"queue_" + q.Name + "_disconnect_delayed", fmt.Sprintf("%d", q.Stats.DisconnectDelayed)})
+	stats = append(stats, StatItem{"queue_" + q.Name + "_disconnect_dead_lettered", fmt.Sprintf("%d", q.Stats.DisconnectDeadLettered)})
+	for _, p := range percentiles {
+		stats = append(stats, StatItem{"queue_" + q.Name + "_time_in_queue_" + p.name + "_ms",
+			fmt.Sprintf("%d", q.Stats.TimeInQueue.Quantile(p.value)/time.Millisecond)})
+	}
+	if repo.config.ParanoidReads {
+		stats = append(stats, StatItem{"queue_" + q.Name + "_read_anomalies", fmt.Sprintf("%d", atomic.LoadUint64(&q.Stats.ReadAnomalies))})
+	}
+	stats = append(stats, repo.scheduler.stats(q.Name)...)
+	stats = append(stats, repo.migrationStats(q.Name)...)
+	if g := q.GroupCommitStats(); g != nil {
+		stats = append(stats, StatItem{"queue_" + q.Name + "_group_commit_window_us", fmt.Sprintf("%d", g.Window/time.Microsecond)})
+		stats = append(stats, StatItem{"queue_" + q.Name + "_group_commit_p99_us", fmt.Sprintf("%d", g.P99/time.Microsecond)})
+		stats = append(stats, StatItem{"queue_" + q.Name + "_group_commit_batches", fmt.Sprintf("%d", g.Batches)})
+		stats = append(stats, StatItem{"queue_" + q.Name + "_group_commit_items", fmt.Sprintf("%d", g.Items)})
 	}
 	return stats
 }
 
+// unixSeconds converts unix nanoseconds to seconds, zero stays zero
+func unixSeconds(nanoseconds int64) int64 {
+	return nanoseconds / int64(time.Second)
+}
+
+// unixTime converts time to unix seconds, zero time stays zero
+func unixTime(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.Unix()
+}
+
+var percentiles = []struct {
+	name  string
+	value float64
+}{{"p50", 0.5}, {"p95", 0.95}, {"p99", 0.99}}
+
+// ObserveCommand records command execution time
+func (s *Stats) ObserveCommand(name string, d time.Duration) {
+	s.CommandLatency(name).Observe(d)
+}
+
+// CommandLatency returns command latency histogram
+func (s *Stats) CommandLatency(name string) *metrics.Histogram {
+	s.RLock()
+	h, ok := s.latency[name]
+	s.RUnlock()
+	if ok {
+		return h
+	}
+
+	s.Lock()
+	defer s.Unlock()
+	if h, ok = s.latency[name]; !ok {
+		h = metrics.NewHistogram(metrics.LatencyBuckets)
+		s.latency[name] = h
+	}
+	return h
+}
+
+// Commands returns sorted names of commands with recorded latency
+func (s *Stats) Commands() []string {
+	s.RLock()
+	defer s.RUnlock()
+	names := make([]string, 0, len(s.latency))
+	for name := range s.latency {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
 // Count returns a total number of queues
 func (repo *QueueRepository) Count() int {
 	return repo.storage.Count()
 }
 
 func (repo *QueueRepository) initialize() error {
+	if repo.inMemory {
+		return nil
+	}
 	dirs, err := ioutil.ReadDir(repo.DataPath)
 	if err != nil {
 		return fmt.Errorf("error opening data directory (%s): %s", repo.DataPath, err.Error())
 	}
 	for _, dir := range dirs {
-		if dir.IsDir() {
+		if dir.IsDir() && dir.Name() != metaDir && dir.Name() != objectsDir && dir.Name() != stagingDir {
+			repo.expectedQueues++
+		}
+	}
+	for _, dir := range dirs {
+		if dir.IsDir() && dir.Name() != metaDir && dir.Name() != objectsDir && dir.Name() != stagingDir {
+			name, ok := repo.names().Name(dir.Name())
+			if !ok {
+				log.Printf("initializing queue %s...invalid directory name", dir.Name())
+				continue
+			}
 			// queue initization
-			q, err := repo.GetQueue(dir.Name())
+			q, err := repo.GetQueue(name)
 			if err != nil {
-				log.Printf("initializing queue %s...%s", dir.Name(), err.Error())
+				log.Printf("initializing queue %s...%s", name, err.Error())
+				continue
 			}
-			log.Printf("queue \"%s\": size %d, head %d, tail %d", dir.Name(), q.Length(), q.Head(), q.Tail())
+			log.Printf("queue \"%s\": size %d, head %d, tail %d", name, q.Length(), q.Head(), q.Tail())
 		}
 	}
 	return nil
 }
 
+func (repo *QueueRepository) queueNames() []string {
+	names := []string{}
+	for pair := range repo.storage.IterBuffered() {
+		names = append(names, pair.Key)
+	}
+	return names
+}
+
 func (repo *QueueRepository) get(key string) (*queue.Queue, bool) {
 	val, ok := repo.storage.Get(key)
 	if ok {
@@ -178,3 +659,45 @@ func (repo *QueueRepository) get(key string) (*queue.Queue, bool) {
 	}
 	return nil, ok
 }
+
+// Lookup returns an open queue without opening or creating it
+func (repo *QueueRepository) Lookup(key string) (*queue.Queue, bool) {
+	return repo.get(key)
+}
+
+// ValidateName checks a queue name against configured naming rules
+func (repo *QueueRepository) ValidateName(name string) error {
+	return repo.names().Validate(name)
+}
+
+func (repo *QueueRepository) names() *queue.NameRule {
+	if repo.nameRule == nil {
+		return queue.DefaultNameRule
+	}
+	return repo.nameRule
+}
+
+// newNameRule builds queue naming rules, unset settings keep defaults
+func newNameRule(nc *config.QueueNamesConfig) (*queue.NameRule, error) {
+	if nc == nil {
+		return queue.DefaultNameRule, nil
+	}
+	chars, maxLength := nc.Chars, nc.MaxLength
+	if maxLength == 0 {
+		maxLength = queue.DefaultNameMaxLength
+	}
+	var rule *queue.NameRule
+	var err error
+	if nc.Encode {
+		rule, err = queue.NewEncodedNameRule(chars, maxLength)
+	} else {
+		if chars == "" {
+			chars = queue.DefaultNameChars
+		}
+		rule, err = queue.NewNameRule(chars, maxLength)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("queue_names: %s", err.Error())
+	}
+	return rule, nil
+}
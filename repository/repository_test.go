@@ -3,8 +3,13 @@ package repository
 import (
 	"fmt"
 	"os"
+	"runtime"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/bogdanovich/siberite/config"
 	"github.com/bogdanovich/siberite/queue"
 	"github.com/stretchr/testify/assert"
 )
@@ -51,8 +56,8 @@ func Test_Initialize(t *testing.T) {
 
 	for i := 0; i < len(queueNames); i++ {
 		q, _ = repo.GetQueue(queueNames[i])
-		assert.Equal(t, uint64(1), q.Head(), "Invalid queue initialization")
-		assert.Equal(t, uint64(totalItems), q.Tail(), "Invalid queue initialization")
+		assert.Equal(t, uint64(1<<62+1), q.Head(), "Invalid queue initialization")
+		assert.Equal(t, uint64(1<<62+totalItems), q.Tail(), "Invalid queue initialization")
 		assert.Equal(t, uint64(totalItems-1), q.Length(), "Invalid queue initialization")
 	}
 	repo.DeleteAllQueues()
@@ -84,10 +89,34 @@ func Test_FullStats(t *testing.T) {
 	repo.GetQueue("test1")
 	repo.GetQueue("test2")
 
+	repo.Stats.ObserveCommand("get", time.Millisecond)
+
 	statItemKeys := []string{
 		"uptime", "time", "version", "curr_connections", "total_connections",
-		"cmd_get", "cmd_set", "queue_test2_items", "queue_test2_open_transactions",
+		"cmd_get", "cmd_set", "total_items", "panics",
+		"enqueue_rate_1m", "enqueue_rate_5m", "enqueue_rate_15m",
+		"dequeue_rate_1m", "dequeue_rate_5m", "dequeue_rate_15m",
+		"queue_test2_items", "queue_test2_open_transactions",
+		"queue_test2_age_ms", "queue_test2_delayed_items", "queue_test2_delayed_next_due", "queue_test2_archived_items",
+		"queue_test2_peak_items", "queue_test2_bytes_in", "queue_test2_bytes_out",
+		"queue_test2_enqueue_rate_1m", "queue_test2_enqueue_rate_5m", "queue_test2_enqueue_rate_15m",
+		"queue_test2_dequeue_rate_1m", "queue_test2_dequeue_rate_5m", "queue_test2_dequeue_rate_15m",
+		"queue_test2_last_enqueue", "queue_test2_last_dequeue", "queue_test2_readers", "queue_test2_writers",
+		"queue_test2_rebases", "queue_test2_last_rebase",
+		"queue_test2_disconnect_requeued", "queue_test2_disconnect_delayed", "queue_test2_disconnect_dead_lettered",
+		"queue_test2_time_in_queue_p50_ms",
+		"queue_test2_time_in_queue_p95_ms", "queue_test2_time_in_queue_p99_ms",
 		"queue_test1_items", "queue_test1_open_transactions",
+		"queue_test1_age_ms", "queue_test1_delayed_items", "queue_test1_delayed_next_due", "queue_test1_archived_items",
+		"queue_test1_peak_items", "queue_test1_bytes_in", "queue_test1_bytes_out",
+		"queue_test1_enqueue_rate_1m", "queue_test1_enqueue_rate_5m", "queue_test1_enqueue_rate_15m",
+		"queue_test1_dequeue_rate_1m", "queue_test1_dequeue_rate_5m", "queue_test1_dequeue_rate_15m",
+		"queue_test1_last_enqueue", "queue_test1_last_dequeue", "queue_test1_readers", "queue_test1_writers",
+		"queue_test1_rebases", "queue_test1_last_rebase",
+		"queue_test1_disconnect_requeued", "queue_test1_disconnect_delayed", "queue_test1_disconnect_dead_lettered",
+		"queue_test1_time_in_queue_p50_ms",
+		"queue_test1_time_in_queue_p95_ms", "queue_test1_time_in_queue_p99_ms",
+		"cmd_get_latency_p50_us", "cmd_get_latency_p95_us", "cmd_get_latency_p99_us",
 	}
 
 	for i, statItem := range repo.FullStats() {
@@ -112,14 +141,66 @@ func Test_GetQueue(t *testing.T) {
 	assert.Equal(t, 2, repo.Count())
 
 	_, err = repo.GetQueue("test:test")
-	assert.Equal(t, "Queue name is not alphanumeric", err.Error())
+	assert.Equal(t, queue.ErrInvalidName.Error(), err.Error())
 	assert.Equal(t, 2, repo.Count())
 
 	_, err = repo.GetQueue("testtest!@#$%^&*-=")
-	assert.Equal(t, "Queue name is not alphanumeric", err.Error())
+	assert.Equal(t, queue.ErrInvalidName.Error(), err.Error())
 	assert.Equal(t, 2, repo.Count())
 }
 
+func Test_QueueNames(t *testing.T) {
+	cfg := config.Default()
+	cfg.QueueNames = &config.QueueNamesConfig{Chars: "a-z0-9_.:-"}
+	assert.Nil(t, cfg.Validate())
+	repo, err := InitializeWithConfig(dir, cfg)
+	defer repo.DeleteAllQueues()
+	assert.Nil(t, err)
+
+	_, err = repo.GetQueue("eu:orders.v2-1")
+	assert.Nil(t, err)
+	assert.Equal(t, queue.ErrInvalidName, repo.DeleteQueue("Orders"))
+	assert.Equal(t, queue.ErrInvalidName, repo.FlushQueue("Orders"))
+	assert.Nil(t, repo.ValidateName(strings.Repeat("a", 100)))
+	assert.Equal(t, queue.ErrNameTooLong, repo.ValidateName(strings.Repeat("a", 101)))
+	repo.CloseAllQueues()
+
+	// Queues left from wider rules are skipped on startup
+	repo, err = Initialize(dir)
+	assert.Nil(t, err)
+	_, ok := repo.get("eu:orders.v2-1")
+	assert.False(t, ok)
+	repo.CloseAllQueues()
+	os.RemoveAll(dir + "/eu:orders.v2-1")
+
+	cfg.QueueNames.Chars = "a-z*"
+	_, err = InitializeWithConfig(dir, cfg)
+	assert.Equal(t, "queue_names: queue name can't contain '*'", err.Error())
+}
+
+func Test_EncodedQueueNames(t *testing.T) {
+	cfg := config.Default()
+	cfg.QueueNames = &config.QueueNamesConfig{Encode: true}
+	assert.Nil(t, cfg.Validate())
+	repo, err := InitializeWithConfig(dir, cfg)
+	assert.Nil(t, err)
+	q, err := repo.GetQueue("tenant:Café")
+	assert.Nil(t, err)
+	q.Enqueue([]byte("1"))
+	_, err = repo.GetQueue("a b")
+	assert.Equal(t, queue.ErrInvalidName, err)
+	repo.CloseAllQueues()
+
+	repo, err = InitializeWithConfig(dir, cfg)
+	defer repo.DeleteAllQueues()
+	assert.Nil(t, err)
+	q, ok := repo.get("tenant:Café")
+	assert.True(t, ok)
+	assert.Equal(t, uint64(1), q.Length())
+	_, err = os.Stat(dir + "/tenant%3ACaf%C3%A9")
+	assert.Nil(t, err)
+}
+
 func Test_Count(t *testing.T) {
 	repo, _ := Initialize(dir)
 	defer repo.DeleteAllQueues()
@@ -128,3 +209,103 @@ func Test_Count(t *testing.T) {
 	repo.GetQueue("test2")
 	assert.Equal(t, 2, repo.Count())
 }
+
+func Test_CommandLatency(t *testing.T) {
+	repo, _ := Initialize(dir)
+	defer repo.DeleteAllQueues()
+
+	assert.Equal(t, []string{}, repo.Stats.Commands())
+
+	repo.Stats.ObserveCommand("set", time.Millisecond)
+	repo.Stats.ObserveCommand("get", time.Millisecond)
+	repo.Stats.ObserveCommand("get", time.Millisecond)
+
+	assert.Equal(t, []string{"get", "set"}, repo.Stats.Commands())
+	assert.Equal(t, uint64(2), repo.Stats.CommandLatency("get").Count())
+	assert.Equal(t, uint64(1), repo.Stats.CommandLatency("set").Count())
+}
+
+func Test_GetQueue_Concurrent(t *testing.T) {
+	repo, _ := Initialize(dir)
+	defer repo.DeleteAllQueues()
+
+	var wg sync.WaitGroup
+	queues := make([]*queue.Queue, 100)
+	for i := range queues {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			queues[i], _ = repo.GetQueue(fmt.Sprintf("concurrent%d", i%10))
+		}(i)
+	}
+	wg.Wait()
+
+	assert.Equal(t, 10, repo.Count())
+	for i := range queues {
+		assert.True(t, queues[i] == queues[i%10])
+	}
+}
+
+// connections is a number of concurrent clients in benchmarks
+const connections = 1000
+
+func Benchmark_GetQueue(b *testing.B) {
+	repo, _ := Initialize(dir)
+	defer repo.DeleteAllQueues()
+
+	names := make([]string, 16)
+	for i := range names {
+		names[i] = fmt.Sprintf("bench%d", i)
+		repo.GetQueue(names[i])
+	}
+
+	b.SetParallelism(connections/runtime.GOMAXPROCS(0) + 1)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			repo.GetQueue(names[i%len(names)])
+			i++
+		}
+	})
+}
+
+func Test_InitializeWithConfig_Fallback(t *testing.T) {
+	// a file in place of data directory is never writable
+	unwritable := dir + "/unwritable"
+	f, _ := os.Create(unwritable)
+	f.Close()
+	defer os.Remove(unwritable)
+
+	cfg := config.Default()
+	cfg.DataFallback = config.FallbackMemory
+	repo, err := InitializeWithConfig(unwritable, cfg)
+	assert.Nil(t, err)
+	assert.True(t, repo.InMemory())
+	assert.True(t, repo.Stats.Degraded)
+
+	q, err := repo.GetQueue("test")
+	assert.Nil(t, err)
+	assert.Nil(t, q.Enqueue([]byte("1")))
+	assert.Nil(t, repo.EnqueueAll(map[string][]*queue.Item{"test": {{Value: []byte("2")}}}))
+	assert.Equal(t, uint64(2), q.Length())
+	assert.Contains(t, repo.FullStats(), StatItem{"data_path", "memory"})
+	repo.DeleteAllQueues()
+	repo.CloseAllQueues()
+
+	fallback := dir + "/fallback"
+	cfg.DataFallback = fallback
+	repo, err = InitializeWithConfig(unwritable, cfg)
+	assert.Nil(t, err)
+	defer repo.DeleteAllQueues()
+	assert.False(t, repo.InMemory())
+	assert.True(t, repo.Stats.Degraded)
+	repo.GetQueue("test")
+	_, err = os.Stat(fallback + "/test")
+	assert.Nil(t, err)
+	assert.Contains(t, repo.FullStats(), StatItem{"degraded", "1"})
+
+	// Without fallback an unwritable data directory is an error
+	_, err = Initialize(unwritable)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,97 @@
+package repository
+
+import (
+	"sync"
+	"time"
+)
+
+// parkedSession is state of a disconnected session waiting for RESUME
+type parkedSession struct {
+	// owner is a name of the identity of the session, empty without auth
+	owner   string
+	state   interface{}
+	release func()
+	timer   *time.Timer
+}
+
+// sessionRegistry keeps parked sessions by resume token
+type sessionRegistry struct {
+	byToken map[string]*parkedSession
+	sync.Mutex
+}
+
+func newSessionRegistry() *sessionRegistry {
+	return &sessionRegistry{byToken: map[string]*parkedSession{}}
+}
+
+// ParkSession keeps state of a disconnected session of an owner identity
+// for resume_grace, release is called unless the session is resumed within it.
+// It returns false when resume is disabled.
+func (repo *QueueRepository) ParkSession(token, owner string, state interface{}, release func()) bool {
+	grace := repo.config.Resume()
+	if grace == 0 || repo.sessions == nil || repo.Context().Err() != nil {
+		return false
+	}
+	p := &parkedSession{owner: owner, state: state, release: release}
+	repo.sessions.Lock()
+	defer repo.sessions.Unlock()
+	repo.sessions.byToken[token] = p
+	p.timer = time.AfterFunc(grace, func() {
+		if repo.takeSession(token) == p {
+			p.release()
+		}
+	})
+	return true
+}
+
+// ResumeSession returns state of a parked session, the caller takes it over.
+// A session of another owner stays parked and is reported missing,
+// so tokens of other identities can't be told from unknown ones.
+func (repo *QueueRepository) ResumeSession(token, owner string) (interface{}, bool) {
+	p := repo.takeOwnedSession(token, func(p *parkedSession) bool { return p.owner == owner })
+	if p == nil {
+		return nil, false
+	}
+	p.timer.Stop()
+	return p.state, true
+}
+
+// takeSession removes a parked session, only one of resume,
+// grace expiry and shutdown gets it
+func (repo *QueueRepository) takeSession(token string) *parkedSession {
+	return repo.takeOwnedSession(token, nil)
+}
+
+// takeOwnedSession removes a parked session if owned reports true for it
+func (repo *QueueRepository) takeOwnedSession(token string, owned func(*parkedSession) bool) *parkedSession {
+	if repo.sessions == nil {
+		return nil
+	}
+	repo.sessions.Lock()
+	defer repo.sessions.Unlock()
+	p, ok := repo.sessions.byToken[token]
+	if !ok || owned != nil && !owned(p) {
+		return nil
+	}
+	delete(repo.sessions.byToken, token)
+	return p
+}
+
+// releaseParkedSessions releases all parked sessions before queues are closed
+func (repo *QueueRepository) releaseParkedSessions() {
+	if repo.sessions == nil {
+		return
+	}
+	repo.sessions.Lock()
+	tokens := make([]string, 0, len(repo.sessions.byToken))
+	for token := range repo.sessions.byToken {
+		tokens = append(tokens, token)
+	}
+	repo.sessions.Unlock()
+	for _, token := range tokens {
+		if p := repo.takeSession(token); p != nil {
+			p.timer.Stop()
+			p.release()
+		}
+	}
+}
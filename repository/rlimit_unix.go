@@ -0,0 +1,15 @@
+//go:build !windows
+// +build !windows
+
+package repository
+
+import "syscall"
+
+// fileLimit returns the process open files limit, zero if unknown
+func fileLimit() uint64 {
+	var rl syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &rl); err != nil {
+		return 0
+	}
+	return uint64(rl.Cur)
+}
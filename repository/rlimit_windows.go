@@ -0,0 +1,6 @@
+package repository
+
+// fileLimit returns the process open files limit, zero if unknown
+func fileLimit() uint64 {
+	return 0
+}
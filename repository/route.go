@@ -0,0 +1,107 @@
+package repository
+
+import (
+	"fmt"
+	"log"
+	"sync/atomic"
+
+	"github.com/bogdanovich/siberite/audit"
+	"github.com/bogdanovich/siberite/queue"
+)
+
+// RouteTargets returns destination queues of routing rules of a queue
+// matching an item, keep is false when a matching rule moves the item.
+// Items are routed once, routes of destination queues don't apply.
+func (repo *QueueRepository) RouteTargets(name string, item *queue.Item) (targets []string, keep bool) {
+	rules := repo.config.Queue(name).Routes
+	if len(rules) == 0 {
+		return nil, true
+	}
+	headers := make(map[string]string, len(item.Headers))
+	for _, header := range item.Headers {
+		headers[header.Key] = header.Value
+	}
+	keep = true
+	seen := map[string]bool{}
+	for _, rule := range rules {
+		if !rule.Match(headers, item.Value) {
+			continue
+		}
+		keep = keep && !rule.Move
+		for _, target := range rule.To {
+			if !seen[target] {
+				seen[target] = true
+				targets = append(targets, target)
+			}
+		}
+	}
+	return targets, keep
+}
+
+// Route enqueues copies of an item of queue q to destination queues,
+// copies are replicated, exported and fanned out as enqueued by a client.
+// It returns an error if no destination queue stored a copy, so an item
+// moved by routing rules is not acknowledged when it is stored nowhere.
+func (repo *QueueRepository) Route(name string, q *queue.Queue, item *queue.Item, targets []string) error {
+	var lastErr error
+	stored := 0
+	for _, target := range targets {
+		tq, err := repo.GetQueue(target)
+		var routed *queue.Item
+		if err == nil {
+			routed, err = copyItem(q, tq, item)
+		}
+		if err != nil {
+			log.Printf("Can't route item of %s to %s: %s", name, target, err.Error())
+			lastErr = err
+			continue
+		}
+		repo.enqueued(target, routed)
+		stored++
+	}
+	if stored == 0 && lastErr != nil {
+		return fmt.Errorf("Can't route item: %s", lastErr.Error())
+	}
+	return nil
+}
+
+// RouteAll applies routing rules to items enqueued together, routed copies
+// are added to the batch and moved items are left out, so they are
+// enqueued atomically with the rest of it
+func (repo *QueueRepository) RouteAll(items map[string][]*queue.Item) map[string][]*queue.Item {
+	routed := make(map[string][]*queue.Item, len(items))
+	for name, list := range items {
+		for _, item := range list {
+			targets, keep := repo.RouteTargets(name, item)
+			if keep {
+				routed[name] = append(routed[name], item)
+			}
+			for _, target := range targets {
+				routed[target] = append(routed[target], &queue.Item{
+					Value: item.Value, Flags: item.Flags, Headers: append([]queue.Header(nil), item.Headers...),
+					ExpiresAt: item.ExpiresAt, MessageID: item.MessageID,
+				})
+			}
+		}
+	}
+	return routed
+}
+
+// Enqueued runs hooks of an item stored in a queue on behalf of a client of
+// connection conn: audit, replication, shadowing, export and fanout. Every
+// enqueue path calls it, so items reach the same hooks however they are stored.
+func (repo *QueueRepository) Enqueued(name string, item *queue.Item, conn uint64) {
+	if err := repo.Audit.Record(audit.EventEnqueue, name, conn, item.UniqueID()); err != nil {
+		log.Printf("Can't write audit log: %s", err.Error())
+	}
+	repo.Replicate(name, item)
+	repo.Shadow(name, item)
+	repo.Export(name, item)
+	repo.Fanout(name, item)
+}
+
+// enqueued runs hooks of an item enqueued by the server on behalf of a client
+func (repo *QueueRepository) enqueued(name string, item *queue.Item) {
+	repo.Enqueued(name, item, 0)
+	atomic.AddUint64(&repo.Stats.TotalItems, 1)
+}
@@ -0,0 +1,74 @@
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"github.com/bogdanovich/siberite/config"
+	"github.com/bogdanovich/siberite/queue"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Route(t *testing.T) {
+	cfg := config.Default()
+	cfg.Queues["events"] = &config.QueueConfig{Routes: []*config.RouteRule{
+		{Header: "type=order", To: []string{"orders"}, Move: true},
+		{Prefix: "{", To: []string{"json", "orders"}},
+	}}
+	assert.Nil(t, cfg.Validate())
+	repo, err := InitializeWithConfig(dir, cfg)
+	assert.Nil(t, err)
+	defer repo.DeleteAllQueues()
+	ctx := context.Background()
+
+	order := &queue.Item{Value: []byte("{}"), Headers: []queue.Header{{Key: "type", Value: "order"}}}
+	targets, keep := repo.RouteTargets("events", order)
+	assert.Equal(t, []string{"orders", "json"}, targets)
+	assert.False(t, keep)
+	targets, keep = repo.RouteTargets("events", &queue.Item{Value: []byte("x")})
+	assert.Equal(t, 0, len(targets))
+	assert.True(t, keep)
+
+	assert.Nil(t, repo.Enqueue(ctx, "events", order))
+	assert.Nil(t, repo.Enqueue(ctx, "events", &queue.Item{Value: []byte("{1}")}))
+	for name, expected := range map[string]uint64{"events": 1, "orders": 2, "json": 2} {
+		q, _ := repo.GetQueue(name)
+		assert.Equal(t, expected, q.Length(), name)
+	}
+	item, err := repo.Dequeue(ctx, "orders")
+	assert.Nil(t, err)
+	assert.Equal(t, order.Headers, item.Headers)
+
+	batch := repo.RouteAll(map[string][]*queue.Item{
+		"events": {order, {Value: []byte("x")}},
+		"other":  {{Value: []byte("{")}},
+	})
+	assert.Equal(t, 1, len(batch["events"]))
+	assert.Equal(t, 1, len(batch["orders"]))
+	assert.Equal(t, 1, len(batch["json"]))
+	assert.Equal(t, 1, len(batch["other"]))
+
+	// Copies don't share headers with the routed item
+	batch["orders"][0].Headers[0].Value = "refund"
+	assert.Equal(t, "order", order.Headers[0].Value)
+}
+
+func Test_Route_Failed(t *testing.T) {
+	cfg := config.Default()
+	cfg.Queues["events"] = &config.QueueConfig{Routes: []*config.RouteRule{
+		{Header: "type=order", To: []string{".invalid"}, Move: true},
+		{Prefix: "{", To: []string{".invalid"}},
+	}}
+	assert.Nil(t, cfg.Validate())
+	repo, err := InitializeWithConfig(dir, cfg)
+	assert.Nil(t, err)
+	defer repo.DeleteAllQueues()
+	ctx := context.Background()
+
+	// A moved item stored nowhere fails, a failed copy of a kept item doesn't
+	order := &queue.Item{Value: []byte("1"), Headers: []queue.Header{{Key: "type", Value: "order"}}}
+	assert.EqualError(t, repo.Enqueue(ctx, "events", order), "Can't route item: "+queue.ErrInvalidName.Error())
+	assert.Nil(t, repo.Enqueue(ctx, "events", &queue.Item{Value: []byte("{}")}))
+	q, _ := repo.GetQueue("events")
+	assert.Equal(t, uint64(1), q.Length())
+}
@@ -0,0 +1,34 @@
+package repository
+
+import (
+	"fmt"
+	"log"
+	"sync/atomic"
+
+	"github.com/bogdanovich/siberite/config"
+)
+
+// SetConfig changes a runtime tunable setting on behalf of a connection,
+// the change is logged and recorded in the audit log
+func (repo *QueueRepository) SetConfig(key string, value string, conn uint64) error {
+	if err := repo.config.Set(key, value); err != nil {
+		return err
+	}
+	atomic.AddUint64(&repo.Stats.ConfigChanges, 1)
+	log.Printf("Setting %s changed to %s by connection %d", key, value, conn)
+	if err := repo.Audit.RecordConfig(key, value, conn); err != nil {
+		log.Printf("Can't write audit log: %s", err.Error())
+	}
+	return nil
+}
+
+// ConfigStats returns runtime tunable settings and a number of changes as stat items
+func (repo *QueueRepository) ConfigStats() []StatItem {
+	stats := make([]StatItem, 0, len(config.Tunables)+1)
+	for _, key := range config.Tunables {
+		value, _ := repo.config.Get(key)
+		stats = append(stats, StatItem{"config_" + key, value})
+	}
+	changes := atomic.LoadUint64(&repo.Stats.ConfigChanges)
+	return append(stats, StatItem{"config_changes", fmt.Sprintf("%d", changes)})
+}
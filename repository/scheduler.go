@@ -0,0 +1,221 @@
+package repository
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bogdanovich/siberite/config"
+)
+
+var schedulerInterval = time.Minute
+
+// Queues idle for rebaseIdle with up to rebaseMaxItems items are rebased, see queue.Rebase
+var (
+	rebaseIdle     = 10 * time.Minute
+	rebaseMaxItems = uint64(100000)
+)
+
+// policyRun keeps scheduling state of a queue policy
+type policyRun struct {
+	queue   string
+	policy  *config.Policy
+	lastRun time.Time
+	nextRun time.Time
+	err     error
+	// deferredSince is a time a due compaction was first deferred
+	deferredSince time.Time
+}
+
+// scheduler runs queue maintenance policies
+type scheduler struct {
+	repo *QueueRepository
+	runs map[string]*policyRun
+	done chan struct{}
+	once sync.Once
+	sync.Mutex
+
+	throttle *compactionThrottle
+}
+
+func newScheduler(repo *QueueRepository) *scheduler {
+	return &scheduler{repo: repo, runs: map[string]*policyRun{}, done: make(chan struct{}),
+		throttle: newCompactionThrottle(repo.config.CompactionThrottle)}
+}
+
+func (s *scheduler) start() {
+	ticker := time.NewTicker(schedulerInterval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-s.done:
+				return
+			case now := <-ticker.C:
+				s.tick(now)
+			}
+		}
+	}()
+}
+
+func (s *scheduler) stop() {
+	s.once.Do(func() { close(s.done) })
+}
+
+// tick runs every due policy of every open queue, purges expired
+// deduplication keys and archived items, rebases idle queues, detaches
+// idle fanout children, checks memory against max_memory and saves counters.
+// Compactions are deferred while recent command latency is high
+// if compaction_throttle is set.
+func (s *scheduler) tick(now time.Time) {
+	if err := s.repo.saveCounters(); err != nil {
+		log.Printf("saving counters failed: %s", err.Error())
+	}
+	s.throttle.update(s.repo.Stats)
+	s.repo.detachFanouts(now)
+	s.repo.checkMemory()
+	for _, name := range s.repo.queueNames() {
+		s.purgeDedupKeys(name, now)
+		s.purgeArchive(name, now)
+		s.promoteDelayed(name)
+		s.rebase(name)
+		for i, policy := range s.repo.config.Queue(name).Policies {
+			run := s.run(name, i, policy, now)
+			if now.Before(run.nextRun) {
+				continue
+			}
+			if policy.Action == config.ActionCompact && s.deferCompaction(run, now) {
+				continue
+			}
+			err := s.execute(name, policy)
+			if err != nil {
+				log.Printf("queue %s: %s policy failed: %s", name, policy.Action, err.Error())
+			}
+			s.Lock()
+			run.lastRun = now
+			run.nextRun = policy.Next(now)
+			run.err = err
+			s.Unlock()
+		}
+	}
+}
+
+// run returns state of i-th queue policy, new policies
+// are scheduled relative to the first time they are seen
+func (s *scheduler) run(name string, i int, policy *config.Policy, now time.Time) *policyRun {
+	s.Lock()
+	defer s.Unlock()
+	key := fmt.Sprintf("%s/%d", name, i)
+	run, ok := s.runs[key]
+	if !ok || run.policy != policy {
+		run = &policyRun{queue: name, policy: policy, nextRun: policy.Next(now)}
+		s.runs[key] = run
+	}
+	return run
+}
+
+func (s *scheduler) purgeDedupKeys(name string, now time.Time) {
+	window := s.repo.config.Queue(name).Dedup()
+	if window == 0 {
+		return
+	}
+	q, err := s.repo.GetQueue(name)
+	if err != nil {
+		return
+	}
+	if _, err = q.PurgeDedupKeys(now.Add(-window)); err != nil {
+		log.Printf("queue %s: purging dedup keys failed: %s", name, err.Error())
+	}
+}
+
+func (s *scheduler) purgeArchive(name string, now time.Time) {
+	retention := s.repo.config.Queue(name).ArchiveRetention()
+	if retention == 0 {
+		return
+	}
+	q, err := s.repo.GetQueue(name)
+	if err != nil || q.Archived() == 0 {
+		return
+	}
+	if _, err = q.PurgeArchive(now.Add(-retention)); err != nil {
+		log.Printf("queue %s: purging archive failed: %s", name, err.Error())
+	}
+}
+
+func (s *scheduler) promoteDelayed(name string) {
+	q, err := s.repo.GetQueue(name)
+	if err != nil || q.Delayed() == 0 {
+		return
+	}
+	if err = q.PromoteDelayed(); err != nil {
+		log.Printf("queue %s: promoting delayed items failed: %s", name, err.Error())
+	}
+}
+
+// rebase renumbers items of an idle queue whose offsets
+// moved far from the start, replication spools keep their offsets
+func (s *scheduler) rebase(name string) {
+	if strings.HasPrefix(name, spoolPrefix) {
+		return
+	}
+	q, err := s.repo.GetQueue(name)
+	if err != nil {
+		return
+	}
+	rebased, err := q.Rebase(rebaseIdle, rebaseMaxItems)
+	if err != nil {
+		log.Printf("queue %s: rebase failed: %s", name, err.Error())
+	} else if rebased {
+		log.Printf("queue %s: rebased %d items", name, q.Length())
+	}
+}
+
+func (s *scheduler) execute(name string, policy *config.Policy) error {
+	switch policy.Action {
+	case config.ActionFlush:
+		return s.repo.FlushQueue(name)
+	case config.ActionCompact:
+		q, err := s.repo.GetQueue(name)
+		if err != nil {
+			return err
+		}
+		return q.Compact()
+	case config.ActionExpire:
+		q, err := s.repo.GetQueue(name)
+		if err != nil {
+			return err
+		}
+		expired, err := q.Expire(time.Now().Add(-policy.Age()))
+		if expired > 0 {
+			log.Printf("queue %s: expired %d items", name, expired)
+		}
+		return err
+	}
+	return nil
+}
+
+// stats returns last run time of executed policies of a queue
+func (s *scheduler) stats(name string) []StatItem {
+	s.Lock()
+	defer s.Unlock()
+	stats := []StatItem{}
+	for i := 0; ; i++ {
+		run, ok := s.runs[fmt.Sprintf("%s/%d", name, i)]
+		if !ok {
+			break
+		}
+		if run.lastRun.IsZero() {
+			continue
+		}
+		prefix := "queue_" + name + "_policy_" + run.policy.Action
+		stats = append(stats, StatItem{prefix + "_last_run", fmt.Sprintf("%d", run.lastRun.Unix())})
+		status := "ok"
+		if run.err != nil {
+			status = "error"
+		}
+		stats = append(stats, StatItem{prefix + "_last_status", status})
+	}
+	return stats
+}
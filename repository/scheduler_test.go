@@ -0,0 +1,101 @@
+package repository
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/bogdanovich/siberite/config"
+	"github.com/bogdanovich/siberite/queue"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_SchedulerTick(t *testing.T) {
+	cfg := config.Default()
+	cfg.Queues["test*"] = &config.QueueConfig{
+		Policies: []*config.Policy{
+			{Action: config.ActionExpire, Schedule: "every 1h", MaxAge: "1d"},
+		},
+	}
+	cfg.Queues["flushed"] = &config.QueueConfig{
+		Policies: []*config.Policy{
+			{Action: config.ActionFlush, Schedule: "daily 02:00"},
+		},
+	}
+	assert.Nil(t, cfg.Validate())
+
+	repo, err := InitializeWithConfig(dir, cfg)
+	assert.Nil(t, err)
+	defer repo.DeleteAllQueues()
+	defer repo.CloseAllQueues()
+
+	q, _ := repo.GetQueue("test1")
+	q.EnqueueItem(&queue.Item{Value: []byte("old"), EnqueuedAt: time.Now().Add(-48 * time.Hour)})
+	q.Enqueue([]byte("new"))
+	f, _ := repo.GetQueue("flushed")
+	f.Enqueue([]byte("1"))
+
+	now := time.Date(2015, 9, 23, 1, 30, 0, 0, time.Local)
+
+	// First tick only schedules policies
+	repo.scheduler.tick(now)
+	assert.Equal(t, uint64(2), q.Length())
+	assert.Equal(t, uint64(1), f.Length())
+	assert.Equal(t, 0, len(repo.scheduler.stats("test1")))
+
+	repo.scheduler.tick(now.Add(time.Hour))
+	assert.Equal(t, uint64(1), q.Length())
+	f, _ = repo.GetQueue("flushed")
+	assert.Equal(t, uint64(0), f.Length())
+
+	stats := repo.scheduler.stats("test1")
+	assert.Equal(t, []StatItem{
+		{"queue_test1_policy_expire_last_run", fmt.Sprintf("%d", now.Add(time.Hour).Unix())},
+		{"queue_test1_policy_expire_last_status", "ok"},
+	}, stats)
+	assert.Equal(t, "queue_flushed_policy_flush_last_run", repo.scheduler.stats("flushed")[0].Key)
+}
+
+func Test_SchedulerCompactionThrottle(t *testing.T) {
+	cfg := config.Default()
+	cfg.CompactionThrottle = &config.CompactionThrottleConfig{MaxP99: "10ms", MaxDefer: "3h"}
+	cfg.Queues["test1"] = &config.QueueConfig{
+		Policies: []*config.Policy{
+			{Action: config.ActionCompact, Schedule: "every 1h"},
+		},
+	}
+	assert.Nil(t, cfg.Validate())
+
+	repo, err := InitializeWithConfig(dir, cfg)
+	assert.Nil(t, err)
+	defer repo.DeleteAllQueues()
+	defer repo.CloseAllQueues()
+	repo.GetQueue("test1")
+
+	now := time.Date(2015, 9, 23, 1, 30, 0, 0, time.Local)
+	repo.scheduler.tick(now)
+
+	// Slow writes since the last tick defer a due compaction
+	repo.Stats.ObserveCommand("set", time.Second)
+	repo.scheduler.tick(now.Add(time.Hour))
+	assert.Equal(t, 0, len(repo.scheduler.stats("test1")))
+	assert.Equal(t, []StatItem{
+		{"compaction_throttled", "1"},
+		{"compaction_recent_p99_us", "995000"},
+		{"compaction_deferred", "1"},
+	}, repo.scheduler.throttle.stats())
+
+	// Compaction runs once traffic calms down
+	repo.Stats.ObserveCommand("set", time.Millisecond)
+	repo.scheduler.tick(now.Add(2 * time.Hour))
+	assert.Equal(t, "queue_test1_policy_compact_last_run", repo.scheduler.stats("test1")[0].Key)
+	assert.Equal(t, "0", repo.scheduler.throttle.stats()[0].Value)
+
+	// Deferred compaction runs regardless of latency after max_defer
+	for i := 3; i <= 6; i++ {
+		repo.Stats.ObserveCommand("set", time.Second)
+		repo.scheduler.tick(now.Add(time.Duration(i) * time.Hour))
+	}
+	assert.Equal(t, fmt.Sprintf("%d", now.Add(6*time.Hour).Unix()), repo.scheduler.stats("test1")[0].Value)
+	assert.Equal(t, "4", repo.scheduler.throttle.stats()[2].Value)
+}
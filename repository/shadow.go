@@ -0,0 +1,157 @@
+package repository
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bogdanovich/siberite/config"
+	"github.com/bogdanovich/siberite/peer"
+	"github.com/bogdanovich/siberite/queue"
+)
+
+// shadow forwards copies of enqueued items to another system to validate it
+// with production traffic. Items are sent once from a memory buffer: items
+// that don't fit into the buffer, fail to send or are stored as blobs are
+// counted and dropped, shadowing never slows down or fails local enqueues.
+type shadow struct {
+	cfg    *config.ShadowConfig
+	items  chan shadowItem
+	done   chan struct{}
+	wg     sync.WaitGroup
+	client *http.Client
+	dialer *peer.Dialer
+
+	conn    net.Conn
+	rw      *bufio.ReadWriter
+	failing bool
+
+	sent    uint64
+	dropped uint64
+	errors  uint64
+}
+
+type shadowItem struct {
+	queue string
+	item  queue.Item
+}
+
+func startShadow(cfg *config.ShadowConfig, dialer *peer.Dialer) *shadow {
+	if cfg == nil {
+		return nil
+	}
+	s := &shadow{
+		cfg:    cfg,
+		items:  make(chan shadowItem, cfg.Buffer),
+		done:   make(chan struct{}),
+		client: &http.Client{Timeout: replicationTimeout},
+		dialer: dialer,
+	}
+	s.wg.Add(1)
+	go s.run()
+	return s
+}
+
+func (s *shadow) stop() {
+	if s == nil {
+		return
+	}
+	close(s.done)
+	s.wg.Wait()
+}
+
+// Shadow queues a copy of an item enqueued by a client for the shadow endpoint
+func (repo *QueueRepository) Shadow(name string, item *queue.Item) {
+	s := repo.shadow
+	if s == nil || !s.cfg.Shadowed(name) {
+		return
+	}
+	if item.Blob != nil {
+		atomic.AddUint64(&s.dropped, 1)
+		return
+	}
+	copied := *item
+	copied.Size = int32(len(item.Value))
+	select {
+	case s.items <- shadowItem{queue: name, item: copied}:
+	default:
+		atomic.AddUint64(&s.dropped, 1)
+	}
+}
+
+func (s *shadow) run() {
+	defer s.wg.Done()
+	defer s.disconnect()
+	for {
+		select {
+		case <-s.done:
+			return
+		case si := <-s.items:
+			var err error
+			if s.cfg.URL != "" {
+				err = s.produce(si)
+			} else {
+				err = s.send(si)
+			}
+			if err != nil {
+				// Only the first failure of a row is logged
+				if !s.failing {
+					log.Printf("Can't shadow item of %s: %s", si.queue, err.Error())
+				}
+				s.failing = true
+				atomic.AddUint64(&s.errors, 1)
+				continue
+			}
+			s.failing = false
+			atomic.AddUint64(&s.sent, 1)
+		}
+	}
+}
+
+// send writes an item to a memcache protocol target, a failed
+// connection is reopened for the next item
+func (s *shadow) send(si shadowItem) error {
+	if s.conn == nil {
+		conn, err := s.dialer.Dial(s.cfg.Target, replicationTimeout)
+		if err != nil {
+			return err
+		}
+		s.conn = conn
+		s.rw = bufio.NewReadWriter(bufio.NewReader(conn), bufio.NewWriter(conn))
+	}
+	s.conn.SetDeadline(time.Now().Add(replicationTimeout))
+	err := sendItem(s.rw, si.queue, nil, &si.item)
+	if err != nil && err != errRejected {
+		s.disconnect()
+	}
+	return err
+}
+
+func (s *shadow) disconnect() {
+	if s.conn != nil {
+		s.conn.Close()
+		s.conn = nil
+	}
+}
+
+// produce posts an item to a topic named after its queue through a Kafka REST proxy
+func (s *shadow) produce(si shadowItem) error {
+	return postRecords(s.client, s.cfg.URL, si.queue, [][]byte{si.item.Value})
+}
+
+// stats shows items sent to the shadow endpoint, dropped and failed to send
+func (s *shadow) stats() []StatItem {
+	if s == nil {
+		return nil
+	}
+	return []StatItem{
+		{"shadow_sent", fmt.Sprintf("%d", atomic.LoadUint64(&s.sent))},
+		{"shadow_dropped", fmt.Sprintf("%d", atomic.LoadUint64(&s.dropped))},
+		{"shadow_errors", fmt.Sprintf("%d", atomic.LoadUint64(&s.errors))},
+	}
+}
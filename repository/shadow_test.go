@@ -0,0 +1,106 @@
+package repository
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bogdanovich/siberite/config"
+	"github.com/bogdanovich/siberite/queue"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Shadow(t *testing.T) {
+	commands := make(chan string, 10)
+	listener := fakePeer(t, commands)
+	defer listener.Close()
+
+	cfg := config.Default()
+	cfg.Shadow = &config.ShadowConfig{Target: listener.Addr().String(), Queues: []string{"events_*"}}
+	assert.Nil(t, cfg.Validate())
+
+	repo, err := InitializeWithConfig(dir, cfg)
+	assert.Nil(t, err)
+	defer repo.DeleteAllQueues()
+	defer repo.CloseAllQueues()
+
+	repo.Shadow("work", &queue.Item{Value: []byte("1")})
+	repo.Shadow("events_a", &queue.Item{Value: []byte("2"), Flags: 3})
+	repo.Shadow("events_a", &queue.Item{Blob: &queue.Blob{}})
+
+	select {
+	case command := <-commands:
+		assert.Equal(t, "set events_a 3 0 1 2", command)
+	case <-time.After(time.Second):
+		t.Fatal("item was not shadowed")
+	}
+	// The item is counted once the target responds
+	for i := 0; i < 100 && atomic.LoadUint64(&repo.shadow.sent) == 0; i++ {
+		time.Sleep(time.Millisecond)
+	}
+	assert.Equal(t, []StatItem{{"shadow_sent", "1"}, {"shadow_dropped", "1"}, {"shadow_errors", "0"}}, repo.shadow.stats())
+}
+
+func Test_Shadow_Auth(t *testing.T) {
+	commands := make(chan string, 10)
+	listener := fakePeer(t, commands)
+	defer listener.Close()
+
+	cfg := config.Default()
+	cfg.Shadow = &config.ShadowConfig{Target: listener.Addr().String(), Queues: []string{"events_*"}}
+	cfg.Peer = &config.PeerConfig{User: "replica", Password: "s3cret"}
+	assert.Nil(t, cfg.Validate())
+
+	repo, err := InitializeWithConfig(dir, cfg)
+	assert.Nil(t, err)
+	defer repo.DeleteAllQueues()
+	defer repo.CloseAllQueues()
+
+	repo.Shadow("events_a", &queue.Item{Value: []byte("1")})
+	for _, expected := range []string{"auth replica s3cret", "set events_a 0 0 1 1"} {
+		select {
+		case command := <-commands:
+			assert.Equal(t, expected, command)
+		case <-time.After(time.Second):
+			t.Fatal("item was not shadowed")
+		}
+	}
+}
+
+func Test_Shadow_Kafka(t *testing.T) {
+	requests := make(chan *http.Request, 10)
+	bodies := make(chan []byte, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		requests <- r
+		bodies <- body
+	}))
+	defer server.Close()
+
+	cfg := config.Default()
+	cfg.Shadow = &config.ShadowConfig{URL: server.URL, Queues: []string{"events_*"}}
+	assert.Nil(t, cfg.Validate())
+	repo, err := InitializeWithConfig(dir, cfg)
+	assert.Nil(t, err)
+	defer repo.DeleteAllQueues()
+	defer repo.CloseAllQueues()
+
+	repo.Shadow("events_a", &queue.Item{Value: []byte("hello")})
+
+	select {
+	case r := <-requests:
+		assert.Equal(t, "/topics/events_a", r.URL.Path)
+		assert.Equal(t, "application/vnd.kafka.binary.v2+json", r.Header.Get("Content-Type"))
+	case <-time.After(time.Second):
+		t.Fatal("item was not shadowed")
+	}
+	var produced struct {
+		Records []struct{ Value []byte }
+	}
+	assert.Nil(t, json.Unmarshal(<-bodies, &produced))
+	assert.Equal(t, "hello", string(produced.Records[0].Value))
+}
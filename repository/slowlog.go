@@ -0,0 +1,59 @@
+package repository
+
+import (
+	"sync"
+	"time"
+)
+
+// SlowEntry is a command that exceeded the slow log threshold
+type SlowEntry struct {
+	ID       uint64
+	Time     time.Time
+	Command  string
+	Queue    string
+	Duration time.Duration
+	// Size is a size of a value stored or returned by the command
+	Size int64
+}
+
+// slowlog keeps recent slow commands in a ring buffer
+type slowlog struct {
+	sync.Mutex
+	entries []SlowEntry
+	next    uint64
+}
+
+// ObserveSlow records a command taking longer than the configured threshold
+func (repo *QueueRepository) ObserveSlow(command string, queue string, d time.Duration, size int64) {
+	threshold, capacity := repo.config.Slowlog()
+	if threshold == 0 || d < threshold || capacity == 0 {
+		return
+	}
+	s := &repo.slowlog
+	s.Lock()
+	defer s.Unlock()
+	if len(s.entries) != capacity {
+		s.entries = make([]SlowEntry, capacity)
+	}
+	s.next++
+	s.entries[int(s.next%uint64(capacity))] = SlowEntry{
+		ID: s.next, Time: time.Now(), Command: command, Queue: queue, Duration: d, Size: size,
+	}
+}
+
+// Slowlog returns recorded slow commands, the most recent first
+func (repo *QueueRepository) Slowlog() []SlowEntry {
+	s := &repo.slowlog
+	s.Lock()
+	defer s.Unlock()
+	entries := []SlowEntry{}
+	for i := 0; i < len(s.entries) && uint64(i) < s.next; i++ {
+		entry := s.entries[int((s.next-uint64(i))%uint64(len(s.entries)))]
+		if entry.ID == 0 {
+			// the buffer was resized
+			break
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
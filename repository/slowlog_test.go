@@ -0,0 +1,40 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bogdanovich/siberite/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Slowlog(t *testing.T) {
+	cfg := config.Default()
+	cfg.SlowlogThreshold = "10ms"
+	cfg.SlowlogSize = 2
+	assert.Nil(t, cfg.Validate())
+	repo := &QueueRepository{config: cfg}
+	assert.Equal(t, []SlowEntry{}, repo.Slowlog())
+
+	repo.ObserveSlow("get", "test", 5*time.Millisecond, 0)
+	assert.Equal(t, 0, len(repo.Slowlog()))
+
+	repo.ObserveSlow("get", "test", 10*time.Millisecond, 1)
+	repo.ObserveSlow("set", "test", 20*time.Millisecond, 2)
+	repo.ObserveSlow("flush_all", "", 30*time.Millisecond, 0)
+	entries := repo.Slowlog()
+	assert.Equal(t, 2, len(entries))
+	assert.Equal(t, uint64(3), entries[0].ID)
+	assert.Equal(t, "flush_all", entries[0].Command)
+	assert.Equal(t, 30*time.Millisecond, entries[0].Duration)
+	assert.Equal(t, uint64(2), entries[1].ID)
+	assert.Equal(t, "set", entries[1].Command)
+	assert.Equal(t, "test", entries[1].Queue)
+	assert.Equal(t, int64(2), entries[1].Size)
+
+	// Zero threshold disables the log
+	cfg.SlowlogThreshold = "0"
+	assert.Nil(t, cfg.Validate())
+	repo.ObserveSlow("get", "test", time.Second, 0)
+	assert.Equal(t, uint64(3), repo.Slowlog()[0].ID)
+}
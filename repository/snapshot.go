@@ -0,0 +1,426 @@
+package repository
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/bogdanovich/siberite/queue"
+)
+
+// snapshotKey keeps a time the last snapshot was loaded in metadata database
+const snapshotKey = "snapshot_loaded"
+
+// stagingDir keeps a snapshot of a queue being loaded next to queue
+// directories, the queue is replaced once its snapshot is complete
+const stagingDir = ".snapshot"
+
+// snapshotTimeHeader carries enqueue time of snapshot items, see GET <queue>/ts
+const snapshotTimeHeader = "ts"
+
+// ErrUnknownPeer is returned for snapshots requested by a site that is not a peer
+var ErrUnknownPeer = errors.New("Unknown replication peer")
+
+// Snapshot takes a snapshot of queue items for a peer bootstrapping from
+// this site. Items spooled for the peer before the snapshot are included
+// in it and are skipped by the forwarder, items enqueued later are forwarded.
+// An empty peer takes a snapshot without affecting replication.
+func (repo *QueueRepository) Snapshot(name string, peer string) (*queue.Queue, *queue.Snapshot, error) {
+	q, err := repo.GetQueue(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	if peer != "" {
+		if err = repo.replicator.skipSpooled(peer, name); err != nil {
+			return nil, nil, err
+		}
+	}
+	snap, err := q.Snapshot()
+	return q, snap, err
+}
+
+// SpoolQueue reports whether a queue holds items not forwarded to a peer yet
+func SpoolQueue(name string) bool {
+	return strings.HasPrefix(name, spoolPrefix)
+}
+
+// SnapshotLoading reports whether a queue is being replaced with a snapshot,
+// writes are rejected until it is loaded to keep items in order
+func (repo *QueueRepository) SnapshotLoading(name string) bool {
+	if repo.replicator == nil {
+		return false
+	}
+	repo.replicator.loadingLock.RLock()
+	defer repo.replicator.loadingLock.RUnlock()
+	return repo.replicator.loading == name
+}
+
+// skipSpooled makes the forwarder of a peer drop items of a queue
+// spooled so far, spooled items were enqueued before a snapshot is taken
+func (r *replicator) skipSpooled(peer string, name string) error {
+	if r == nil || !r.hasPeer(peer) {
+		return ErrUnknownPeer
+	}
+	sq, err := r.repo.GetQueue(spoolName(peer))
+	if err != nil {
+		return err
+	}
+	r.skipLock.Lock()
+	r.skips[peer+" "+name] = sq.Tail()
+	r.skipLock.Unlock()
+	return nil
+}
+
+// skipped reports whether a spooled item is included in a snapshot taken by a peer
+func (r *replicator) skipped(peer string, item *queue.Item) bool {
+	name, _ := item.Header(spoolQueueHeader)
+	r.skipLock.Lock()
+	defer r.skipLock.Unlock()
+	return item.ID() <= r.skips[peer+" "+name]
+}
+
+func (r *replicator) hasPeer(peer string) bool {
+	for _, p := range r.cfg.Peers {
+		if p == peer {
+			return true
+		}
+	}
+	return false
+}
+
+// bootstrap loads snapshots of replicated queues from the primary,
+// once into an empty data directory or repeatedly with an interval
+func (r *replicator) bootstrap() {
+	defer r.wg.Done()
+	interval := r.cfg.Bootstrap.RepeatInterval()
+	if interval == 0 && r.repo.snapshotLoaded() {
+		return
+	}
+	for {
+		// A leader takes writes, loading a snapshot would lose them
+		if r.repo.elector == nil || !r.repo.elector.Leader() {
+			if err := r.loadSnapshot(); err != nil {
+				log.Printf("Can't load snapshot from %s: %s", r.cfg.Bootstrap.Primary, err.Error())
+				if !r.wait(replicationRetryInterval) {
+					return
+				}
+				continue
+			}
+			r.repo.saveSnapshotLoaded()
+			if interval == 0 {
+				return
+			}
+		}
+		if !r.wait(interval) {
+			return
+		}
+	}
+}
+
+// loadSnapshot replaces replicated queues with their snapshots
+// Command: SNAPSHOT <queue pattern> [<advertise>]
+// Response:
+// QUEUE <queue> <items>
+// VALUE <queue> <flags> <bytes> [<key>=<value>...]
+// <data block>
+// ...
+// END
+func (r *replicator) loadSnapshot() error {
+	conn, err := r.repo.dialer.Dial(r.cfg.Bootstrap.Primary, replicationTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	atomic.StoreInt32(&r.snapshot.Loading, 1)
+	atomic.StoreUint64(&r.snapshot.Queues, 0)
+	atomic.StoreUint64(&r.snapshot.Items, 0)
+	defer atomic.StoreInt32(&r.snapshot.Loading, 0)
+	defer r.setLoading("")
+
+	rw := bufio.NewReadWriter(bufio.NewReader(conn), bufio.NewWriter(conn))
+	for _, pattern := range r.cfg.Queues {
+		conn.SetDeadline(time.Now().Add(replicationTimeout))
+		fmt.Fprintf(rw, "snapshot %s %s\r\n", pattern, r.cfg.Bootstrap.Advertise)
+		if err = rw.Flush(); err != nil {
+			return err
+		}
+		if err = r.readSnapshot(conn, rw.Reader); err != nil {
+			return err
+		}
+	}
+	atomic.StoreInt64(&r.snapshot.LoadedAt, time.Now().UnixNano())
+	return nil
+}
+
+func (r *replicator) readSnapshot(conn net.Conn, reader *bufio.Reader) error {
+	var staged *queue.Queue
+	name := ""
+	defer func() {
+		if staged != nil {
+			staged.Drop()
+		}
+	}()
+	for {
+		conn.SetDeadline(time.Now().Add(replicationTimeout))
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		fields := strings.Fields(line)
+		if staged != nil && len(fields) > 0 && fields[0] != "VALUE" {
+			err = r.repo.replaceQueue(name, staged)
+			staged = nil
+			if err != nil {
+				return err
+			}
+		}
+		switch {
+		case len(fields) == 1 && fields[0] == "END":
+			r.setLoading("")
+			return nil
+		case len(fields) == 3 && fields[0] == "QUEUE":
+			if SpoolQueue(fields[1]) {
+				return fmt.Errorf("unexpected queue %s", fields[1])
+			}
+			name = fields[1]
+			r.setLoading(name)
+			if staged, err = r.repo.openStaging(name); err != nil {
+				return err
+			}
+			atomic.AddUint64(&r.snapshot.Queues, 1)
+		case len(fields) >= 4 && fields[0] == "VALUE" && staged != nil && fields[1] == name:
+			if err = readSnapshotItem(staged, fields, reader); err != nil {
+				return err
+			}
+			atomic.AddUint64(&r.snapshot.Items, 1)
+		default:
+			return fmt.Errorf("unexpected response %q", strings.TrimSpace(line))
+		}
+	}
+}
+
+// openStaging opens an empty queue outside of the repository
+// to load a snapshot of a queue into
+func (repo *QueueRepository) openStaging(name string) (*queue.Queue, error) {
+	if repo.inMemory {
+		return queue.OpenInMemoryWithRule(name, repo.storageOptions(name), repo.names())
+	}
+	dataDir := filepath.Join(repo.DataPath, stagingDir)
+	// A snapshot left by a crash is loaded again
+	if err := os.RemoveAll(filepath.Join(dataDir, repo.names().Dir(name))); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dataDir, 0755); err != nil {
+		return nil, err
+	}
+	return queue.OpenWithRule(name, dataDir, repo.storageOptions(name), repo.names())
+}
+
+// replaceQueue replaces items of a queue with a loaded snapshot, a queue
+// already holding the same items is kept, so repeated snapshots don't
+// flush queues that haven't changed since the previous one
+func (repo *QueueRepository) replaceQueue(name string, staged *queue.Queue) error {
+	defer staged.Drop()
+	if q, ok := repo.Lookup(name); ok {
+		same, err := sameItems(q, staged)
+		if err != nil || same {
+			return err
+		}
+	}
+	if err := repo.FlushQueue(name); err != nil {
+		return err
+	}
+	q, err := repo.GetQueue(name)
+	if err != nil {
+		return err
+	}
+	snap, err := staged.Snapshot()
+	if err != nil {
+		return err
+	}
+	defer snap.Release()
+	return snap.Items(func(item *queue.Item) error {
+		restored := &queue.Item{Value: item.Value, Flags: item.Flags, Headers: item.Headers,
+			EnqueuedAt: item.EnqueuedAt, ExpiresAt: item.ExpiresAt, MessageID: item.MessageID}
+		if item.Blob != nil {
+			w := q.NewSizedBlobWriter(item.Blob.Size)
+			err := snap.WriteBlob(item.Blob, w)
+			if err == nil {
+				err = w.Close()
+			}
+			if err != nil {
+				w.Abort()
+				return err
+			}
+			restored.Blob = w.Blob()
+		}
+		if err := q.EnqueueItem(restored); err != nil {
+			q.DeleteBlob(restored.Blob)
+			return err
+		}
+		return nil
+	})
+}
+
+// sameItems reports whether two queues hold items of the same message ids
+// in the same order, items without message ids are never the same
+func sameItems(q *queue.Queue, staged *queue.Queue) (bool, error) {
+	ids := []string{}
+	for _, source := range []*queue.Queue{q, staged} {
+		snap, err := source.Snapshot()
+		if err != nil {
+			return false, err
+		}
+		if source == staged && snap.Length() != uint64(len(ids)) {
+			snap.Release()
+			return false, nil
+		}
+		i := 0
+		err = snap.Items(func(item *queue.Item) error {
+			if item.MessageID == "" {
+				return errDifferentItems
+			}
+			if source == q {
+				ids = append(ids, item.MessageID)
+			} else if i >= len(ids) || ids[i] != item.MessageID {
+				return errDifferentItems
+			}
+			i++
+			return nil
+		})
+		snap.Release()
+		if err == errDifferentItems {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// errDifferentItems stops comparing items of queues
+var errDifferentItems = errors.New("different items")
+
+// readSnapshotItem enqueues an item of VALUE response,
+// values larger than a chunk are stored as blobs
+func readSnapshotItem(q *queue.Queue, fields []string, reader *bufio.Reader) error {
+	flags, err := strconv.ParseUint(fields[2], 10, 32)
+	if err != nil {
+		return err
+	}
+	size, err := strconv.ParseInt(fields[3], 10, 64)
+	if err != nil || size < 0 {
+		return fmt.Errorf("invalid value size %q", fields[3])
+	}
+	item := &queue.Item{Flags: uint32(flags)}
+	for _, field := range fields[4:] {
+		kv := strings.SplitN(field, "=", 2)
+		if len(kv) != 2 {
+			return fmt.Errorf("invalid header %q", field)
+		}
+		item.Headers = append(item.Headers, queue.Header{Key: kv[0], Value: kv[1]})
+	}
+	if err = AdoptMessageID(item); err != nil {
+		return err
+	}
+	adoptEnqueueTime(item)
+
+	if size > queue.ChunkSize {
+		w := q.NewSizedBlobWriter(size)
+		_, err = io.CopyBuffer(w, io.LimitReader(reader, size), make([]byte, queue.ChunkSize))
+		if err == nil {
+			err = w.Close()
+		}
+		if err != nil {
+			w.Abort()
+			return err
+		}
+		item.Blob = w.Blob()
+	} else {
+		item.Value = make([]byte, size)
+		if _, err = io.ReadFull(reader, item.Value); err != nil {
+			return err
+		}
+	}
+	if _, err = reader.Discard(2); err == nil {
+		err = q.EnqueueItem(item)
+	}
+	if err != nil {
+		q.DeleteBlob(item.Blob)
+	}
+	return err
+}
+
+// adoptEnqueueTime moves the ts=<unix milliseconds> header, which follows
+// item headers in snapshots, into enqueue time of the item
+func adoptEnqueueTime(item *queue.Item) {
+	last := len(item.Headers) - 1
+	if last < 0 || item.Headers[last].Key != snapshotTimeHeader {
+		return
+	}
+	ms, err := strconv.ParseInt(item.Headers[last].Value, 10, 64)
+	if err != nil {
+		return
+	}
+	if ms > 0 {
+		item.EnqueuedAt = time.Unix(0, ms*int64(time.Millisecond))
+	}
+	item.Headers = item.Headers[:last]
+	if last == 0 {
+		item.Headers = nil
+	}
+}
+
+func (r *replicator) setLoading(name string) {
+	r.loadingLock.Lock()
+	r.loading = name
+	r.loadingLock.Unlock()
+}
+
+// snapshotStats shows progress of loading snapshots
+func (r *replicator) snapshotStats() []StatItem {
+	if r == nil || r.cfg.Bootstrap == nil {
+		return nil
+	}
+	return []StatItem{
+		{"snapshot_loading", fmt.Sprintf("%d", atomic.LoadInt32(&r.snapshot.Loading))},
+		{"snapshot_queues", fmt.Sprintf("%d", atomic.LoadUint64(&r.snapshot.Queues))},
+		{"snapshot_items", fmt.Sprintf("%d", atomic.LoadUint64(&r.snapshot.Items))},
+		{"snapshot_loaded", fmt.Sprintf("%d", unixSeconds(atomic.LoadInt64(&r.snapshot.LoadedAt)))},
+	}
+}
+
+// snapshotLoaded reports whether a snapshot was ever loaded into the data directory
+func (repo *QueueRepository) snapshotLoaded() bool {
+	repo.metaLock.Lock()
+	defer repo.metaLock.Unlock()
+	if repo.meta == nil {
+		return false
+	}
+	ok, _ := repo.meta.Has([]byte(snapshotKey), nil)
+	return ok
+}
+
+func (repo *QueueRepository) saveSnapshotLoaded() {
+	repo.metaLock.Lock()
+	defer repo.metaLock.Unlock()
+	if repo.meta == nil {
+		return
+	}
+	value := make([]byte, 8)
+	binary.BigEndian.PutUint64(value, uint64(time.Now().UnixNano()))
+	if err := repo.meta.Put([]byte(snapshotKey), value, nil); err != nil {
+		log.Printf("Can't save snapshot time: %s", err.Error())
+	}
+}
@@ -0,0 +1,169 @@
+package repository
+
+import (
+	"bufio"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bogdanovich/siberite/config"
+	"github.com/bogdanovich/siberite/queue"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_SnapshotSkipsSpooled(t *testing.T) {
+	replicationPollInterval = 10 * time.Millisecond
+	replicationRetryInterval = 10 * time.Millisecond
+	defer func() { replicationRetryInterval = 5 * time.Second }()
+
+	// The peer is down until the snapshot is taken
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	peer := listener.Addr().String()
+	listener.Close()
+
+	cfg := config.Default()
+	cfg.Replication = &config.ReplicationConfig{Origin: "dc1", Peers: []string{peer}, Queues: []string{"events_*"}}
+	repo, err := InitializeWithConfig(dir, cfg)
+	assert.Nil(t, err)
+	defer repo.DeleteAllQueues()
+	defer repo.CloseAllQueues()
+
+	q, _ := repo.GetQueue("events_a")
+	for _, value := range []string{"1", "2"} {
+		item := &queue.Item{Value: []byte(value)}
+		q.EnqueueItem(item)
+		repo.Replicate("events_a", item)
+	}
+
+	_, _, err = repo.Snapshot("events_a", "127.0.0.1:1")
+	assert.Equal(t, ErrUnknownPeer, err)
+	_, snap, err := repo.Snapshot("events_a", peer)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(2), snap.Length())
+	snap.Release()
+
+	item := &queue.Item{Value: []byte("3")}
+	q.EnqueueItem(item)
+	repo.Replicate("events_a", item)
+
+	commands := make(chan string, 10)
+	listener = fakePeerAt(t, peer, commands)
+	defer listener.Close()
+	select {
+	case command := <-commands:
+		assert.Equal(t, "setmeta events_a 0 0 1 msg_id="+item.MessageID+" origin=dc1 3", command)
+	case <-time.After(time.Second):
+		t.Fatal("item was not replicated")
+	}
+	select {
+	case command := <-commands:
+		t.Fatalf("unexpected command %s", command)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+// fakePrimary answers SNAPSHOT command with a given response
+func fakePrimary(t *testing.T, response string, commands chan<- string) net.Listener {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		rw := bufio.NewReadWriter(bufio.NewReader(conn), bufio.NewWriter(conn))
+		line, err := rw.ReadString('\n')
+		if err != nil {
+			return
+		}
+		commands <- line
+		rw.WriteString(response)
+		rw.Flush()
+		rw.ReadString('\n')
+	}()
+	return listener
+}
+
+func Test_Bootstrap(t *testing.T) {
+	// Existing items are replaced with the snapshot
+	q, err := queue.Open("events_a", dir)
+	assert.Nil(t, err)
+	q.Enqueue([]byte("old"))
+	q.Close()
+
+	commands := make(chan string, 1)
+	listener := fakePrimary(t, "QUEUE events_a 2\r\n"+
+		"VALUE events_a 1 1 k=v ts=1800000000000\r\n1\r\n"+
+		"VALUE events_a 0 2\r\n23\r\n"+
+		"QUEUE events_b 0\r\n"+
+		"END\r\n", commands)
+	defer listener.Close()
+
+	cfg := config.Default()
+	cfg.Replication = &config.ReplicationConfig{
+		Origin:    "dc2",
+		Queues:    []string{"events_*"},
+		Bootstrap: &config.BootstrapConfig{Primary: listener.Addr().String(), Advertise: "10.0.0.2:22133"},
+	}
+	assert.Nil(t, cfg.Validate())
+	repo, err := InitializeWithConfig(dir, cfg)
+	assert.Nil(t, err)
+	defer repo.DeleteAllQueues()
+	defer repo.CloseAllQueues()
+
+	assert.Equal(t, "snapshot events_* 10.0.0.2:22133\r\n", <-commands)
+	for i := 0; i < 100 && atomic.LoadInt64(&repo.replicator.snapshot.LoadedAt) == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.False(t, repo.SnapshotLoading("events_a"))
+
+	q, _ = repo.GetQueue("events_a")
+	assert.Equal(t, uint64(2), q.Length())
+	item, _ := q.Dequeue()
+	assert.Equal(t, "1", string(item.Value))
+	assert.Equal(t, uint32(1), item.Flags)
+	assert.Equal(t, []queue.Header{{Key: "k", Value: "v"}}, item.Headers)
+	assert.Equal(t, time.Unix(1800000000, 0), item.EnqueuedAt)
+	item, _ = q.Dequeue()
+	assert.Equal(t, "23", string(item.Value))
+
+	stats := map[string]string{}
+	for _, stat := range repo.FullStats() {
+		stats[stat.Key] = stat.Value
+	}
+	assert.Equal(t, "0", stats["snapshot_loading"])
+	assert.Equal(t, "2", stats["snapshot_queues"])
+	assert.Equal(t, "2", stats["snapshot_items"])
+	assert.NotEqual(t, "0", stats["snapshot_loaded"])
+}
+
+func Test_replaceQueue(t *testing.T) {
+	repo, err := Initialize(dir)
+	assert.Nil(t, err)
+	defer repo.CloseAllQueues()
+	q, err := repo.GetQueue("events_c")
+	assert.Nil(t, err)
+	defer repo.DeleteQueue("events_c")
+	q.EnqueueItem(&queue.Item{Value: []byte("1"), MessageID: "0005225d3a3b70000000002a"})
+
+	// A queue holding the same items is kept
+	staged, err := repo.openStaging("events_c")
+	assert.Nil(t, err)
+	staged.EnqueueItem(&queue.Item{Value: []byte("1"), MessageID: "0005225d3a3b70000000002a"})
+	assert.Nil(t, repo.replaceQueue("events_c", staged))
+	current, _ := repo.Lookup("events_c")
+	assert.True(t, current == q)
+
+	staged, err = repo.openStaging("events_c")
+	assert.Nil(t, err)
+	staged.EnqueueItem(&queue.Item{Value: []byte("2"), EnqueuedAt: time.Unix(1800000000, 0)})
+	assert.Nil(t, repo.replaceQueue("events_c", staged))
+	current, _ = repo.Lookup("events_c")
+	assert.Equal(t, uint64(1), current.Length())
+	item, _ := current.Peek()
+	assert.Equal(t, "2", string(item.Value))
+	assert.Equal(t, time.Unix(1800000000, 0), item.EnqueuedAt)
+}
@@ -0,0 +1,175 @@
+package repository
+
+import (
+	"errors"
+	"log"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/bogdanovich/siberite/config"
+	"github.com/bogdanovich/siberite/queue"
+
+	"github.com/syndtr/goleveldb/leveldb/filter"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+)
+
+// storageOptions returns leveldb options of a queue
+func (repo *QueueRepository) storageOptions(name string) *opt.Options {
+	sc := repo.config.Storage(name)
+	if sc.OpenFilesLimit == 0 {
+		sc.OpenFilesLimit = repo.openFilesCapacity()
+	}
+	o := leveldbOptions(sc)
+	if o.BlockCacher == opt.LRUCacher && repo.config.MemoryLimit() > 0 {
+		// Block caches are emptied first when memory is over max_memory
+		o.BlockCacher = repo.memory.blockCacher()
+	}
+	return o
+}
+
+// Open files budget settings
+const (
+	// filesPerQueue are files a queue keeps open besides cached tables:
+	// lock, info log, manifest and journal
+	filesPerQueue = 4
+	// minOpenFiles and maxOpenFiles bound a number of cached tables of a queue,
+	// maxOpenFiles is leveldb default
+	minOpenFiles = 16
+	maxOpenFiles = 500
+)
+
+// openFilesCapacity splits open files budget between queues opened so far
+// or found in data directory on startup, zero keeps leveldb default
+func (repo *QueueRepository) openFilesCapacity() int {
+	budget := repo.config.MaxOpenFiles
+	if budget == 0 {
+		budget = int(fileLimit() / 2)
+	}
+	if budget == 0 || repo.inMemory {
+		return 0
+	}
+	queues := repo.Count() + 1
+	if repo.expectedQueues > queues {
+		queues = repo.expectedQueues
+	}
+	capacity := budget/queues - filesPerQueue
+	if capacity < minOpenFiles {
+		capacity = minOpenFiles
+	}
+	if capacity > maxOpenFiles {
+		capacity = maxOpenFiles
+	}
+	return capacity
+}
+
+// checkOpenFiles warns once queues may use most of the process open files limit
+func (repo *QueueRepository) checkOpenFiles() {
+	limit := fileLimit()
+	capacity := repo.openFilesCapacity()
+	if limit == 0 || capacity == 0 {
+		return
+	}
+	// Queues with open_files_limit set are estimated with the budget too
+	files := uint64(repo.Count()*(capacity+filesPerQueue)) + atomic.LoadUint64(&repo.Stats.CurrentConnections)
+	if files <= limit*8/10 {
+		atomic.StoreInt32(&repo.filesWarned, 0)
+		return
+	}
+	if atomic.CompareAndSwapInt32(&repo.filesWarned, 0, 1) {
+		log.Printf("WARNING: %d queues may use up to %d of %d open files, raise the limit or set max_open_files",
+			repo.Count(), files, limit)
+	}
+}
+
+// leveldbOptions applies configured settings over default queue options
+func leveldbOptions(sc config.StorageConfig) *opt.Options {
+	o := queue.DefaultOptions()
+	o.WriteBuffer = sc.WriteBuffer
+	o.BlockSize = sc.BlockSize
+	o.CompactionTableSize = sc.CompactionTableSize
+	o.OpenFilesCacheCapacity = sc.OpenFilesLimit
+	if sc.BloomFilterBits > 0 {
+		o.Filter = filter.NewBloomFilter(sc.BloomFilterBits)
+	}
+	if sc.BlockCacher == config.CacherLRU {
+		o.BlockCacher = opt.LRUCacher
+		o.DisableBlockCache = false
+		o.BlockCacheCapacity = sc.BlockCacheSize
+	}
+	switch sc.Compression {
+	case config.CompressionSnappy:
+		o.Compression = opt.SnappyCompression
+	case config.CompressionNone:
+		o.Compression = opt.NoCompression
+	}
+	return o
+}
+
+// StorageStats returns leveldb stats of open queues matching a glob pattern
+func (repo *QueueRepository) StorageStats(pattern string) ([]StatItem, error) {
+	names, err := repo.MatchQueues(pattern)
+	if err != nil {
+		return nil, err
+	}
+	stats := []StatItem{}
+	for _, name := range names {
+		q, ok := repo.get(name)
+		if !ok {
+			continue
+		}
+		s, err := q.StorageStats()
+		if err != nil {
+			continue
+		}
+		prefix := "queue_" + name + "_leveldb_"
+		for _, l := range s.Levels {
+			level := prefix + "level" + strconv.Itoa(l.Level) + "_"
+			stats = append(stats,
+				StatItem{level + "tables", strconv.Itoa(l.Tables)},
+				StatItem{level + "bytes", strconv.FormatInt(l.Size, 10)},
+				StatItem{level + "compaction_ms", strconv.FormatInt(int64(l.CompactionTime/time.Millisecond), 10)},
+				StatItem{level + "compaction_read_bytes", strconv.FormatInt(l.CompactionRead, 10)},
+				StatItem{level + "compaction_write_bytes", strconv.FormatInt(l.CompactionWrite, 10)})
+		}
+		paused := "0"
+		if s.WritePaused {
+			paused = "1"
+		}
+		stats = append(stats,
+			StatItem{prefix + "write_delays", strconv.Itoa(int(s.WriteDelays))},
+			StatItem{prefix + "write_delay_ms", strconv.FormatInt(int64(s.WriteDelayTime/time.Millisecond), 10)},
+			StatItem{prefix + "write_paused", paused},
+			StatItem{prefix + "opened_tables", strconv.Itoa(s.OpenedTables)},
+			StatItem{prefix + "io_read_bytes", strconv.FormatUint(s.IORead, 10)},
+			StatItem{prefix + "io_write_bytes", strconv.FormatUint(s.IOWrite, 10)},
+			StatItem{prefix + "memtable_bytes", strconv.FormatInt(s.MemtableBytes, 10)},
+			StatItem{prefix + "mem_compactions", strconv.FormatUint(uint64(s.MemCompactions), 10)},
+			StatItem{prefix + "level0_compactions", strconv.FormatUint(uint64(s.Level0Compactions), 10)},
+			StatItem{prefix + "table_compactions", strconv.FormatUint(uint64(s.TableCompactions), 10)})
+	}
+	return stats, nil
+}
+
+// ErrUnknownQueue is returned for queues that are not open
+var ErrUnknownQueue = errors.New("Unknown queue")
+
+// QueueInfo returns stats of a single open queue with its head and tail
+// offsets and disk usage measured in background, see disk_usage_interval
+func (repo *QueueRepository) QueueInfo(name string) ([]StatItem, error) {
+	q, ok := repo.get(name)
+	if !ok {
+		return nil, ErrUnknownQueue
+	}
+	usage, err := repo.diskUsage(name)
+	if err != nil {
+		return nil, err
+	}
+	prefix := "queue_" + name + "_"
+	stats := repo.queueStats(q)
+	return append(stats,
+		StatItem{prefix + "head", strconv.FormatUint(q.Head(), 10)},
+		StatItem{prefix + "tail", strconv.FormatUint(q.Tail(), 10)},
+		StatItem{prefix + "disk_bytes", strconv.FormatInt(usage.bytes, 10)},
+		StatItem{prefix + "disk_files", strconv.Itoa(usage.files)}), nil
+}
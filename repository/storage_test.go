@@ -0,0 +1,83 @@
+package repository
+
+import (
+	"testing"
+
+	"github.com/bogdanovich/siberite/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+)
+
+func Test_leveldbOptions(t *testing.T) {
+	o := leveldbOptions(config.StorageConfig{})
+	assert.Equal(t, 0, o.WriteBuffer)
+	assert.Nil(t, o.Filter)
+	assert.Equal(t, opt.DefaultCompression, o.Compression)
+	assert.True(t, o.DisableBlockCache)
+
+	o = leveldbOptions(config.StorageConfig{
+		WriteBuffer:         1 << 24,
+		BlockSize:           1 << 16,
+		CompactionTableSize: 1 << 22,
+		OpenFilesLimit:      100,
+		BloomFilterBits:     10,
+		Compression:         config.CompressionNone,
+	})
+	assert.Equal(t, 1<<24, o.WriteBuffer)
+	assert.Equal(t, 1<<16, o.BlockSize)
+	assert.Equal(t, 1<<22, o.CompactionTableSize)
+	assert.Equal(t, 100, o.OpenFilesCacheCapacity)
+	assert.NotNil(t, o.Filter)
+	assert.Equal(t, opt.NoCompression, o.Compression)
+	assert.True(t, o.DisableBlockCache)
+
+	o = leveldbOptions(config.StorageConfig{BlockCacher: config.CacherLRU, BlockCacheSize: 1 << 20})
+	assert.False(t, o.DisableBlockCache)
+	assert.Equal(t, opt.LRUCacher, o.BlockCacher)
+	assert.Equal(t, 1<<20, o.BlockCacheCapacity)
+}
+
+func Test_GetQueue_StorageOptions(t *testing.T) {
+	cfg := config.Default()
+	cfg.Queues["large"] = &config.QueueConfig{Storage: &config.StorageConfig{BloomFilterBits: 10, Compression: "none"}}
+	assert.Nil(t, cfg.Validate())
+
+	repo, err := InitializeWithConfig(dir, cfg)
+	assert.Nil(t, err)
+	defer repo.DeleteAllQueues()
+
+	q, err := repo.GetQueue("large")
+	assert.Nil(t, err)
+	assert.Nil(t, q.Enqueue([]byte("1")))
+	item, _ := q.Dequeue()
+	assert.Equal(t, "1", string(item.Value))
+}
+
+func Test_openFilesCapacity(t *testing.T) {
+	cfg := config.Default()
+	cfg.MaxOpenFiles = 1000
+	cfg.Queues["large"] = &config.QueueConfig{Storage: &config.StorageConfig{OpenFilesLimit: 64}}
+	assert.Nil(t, cfg.Validate())
+
+	repo, err := InitializeWithConfig(dir, cfg)
+	assert.Nil(t, err)
+	defer repo.DeleteAllQueues()
+	repo.DeleteAllQueues()
+
+	assert.Equal(t, maxOpenFiles, repo.openFilesCapacity())
+	repo.GetQueue("test1")
+	repo.GetQueue("test2")
+	repo.GetQueue("test3")
+	assert.Equal(t, 1000/4-filesPerQueue, repo.storageOptions("test4").OpenFilesCacheCapacity)
+	assert.Equal(t, 64, repo.storageOptions("large").OpenFilesCacheCapacity)
+
+	repo.expectedQueues = 1000
+	assert.Equal(t, minOpenFiles, repo.openFilesCapacity())
+
+	// Budget defaults to a half of the process limit
+	cfg.MaxOpenFiles = 0
+	if limit := fileLimit(); limit >= 2000 {
+		repo.expectedQueues = int(limit / 2 / 100)
+		assert.InDelta(t, 100-filesPerQueue, repo.openFilesCapacity(), 2)
+	}
+}
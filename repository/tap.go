@@ -0,0 +1,107 @@
+package repository
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/bogdanovich/siberite/queue"
+)
+
+// tap mirrors items dequeued from a queue to a tap queue
+type tap struct {
+	queue string
+	until time.Time
+}
+
+// Tap mirrors copies of items dequeued from a queue to a tap queue
+// until a given time, zero time removes the tap
+func (repo *QueueRepository) Tap(name string, tapName string, until time.Time) error {
+	if name == tapName {
+		return errors.New("Tap queue must differ from the tapped queue")
+	}
+	if !until.IsZero() {
+		if _, err := repo.GetQueue(tapName); err != nil {
+			return err
+		}
+	}
+
+	repo.tapLock.Lock()
+	defer repo.tapLock.Unlock()
+	taps := []*tap{}
+	for _, t := range repo.taps[name] {
+		if t.queue != tapName {
+			taps = append(taps, t)
+		}
+	}
+	if !until.IsZero() {
+		taps = append(taps, &tap{queue: tapName, until: until})
+	}
+	if len(taps) == 0 {
+		delete(repo.taps, name)
+		return nil
+	}
+	repo.taps[name] = taps
+	return nil
+}
+
+// Mirror enqueues a copy of an item dequeued from a queue to its active taps
+func (repo *QueueRepository) Mirror(name string, q *queue.Queue, item *queue.Item) {
+	for _, tapName := range repo.activeTaps(name, time.Now()) {
+		tq, err := repo.GetQueue(tapName)
+		if err == nil {
+			err = mirrorItem(q, tq, item)
+		}
+		if err != nil {
+			log.Printf("Can't mirror item of %s to %s: %s", name, tapName, err.Error())
+		}
+	}
+}
+
+// activeTaps returns tap queue names of a queue, expired taps are removed
+func (repo *QueueRepository) activeTaps(name string, now time.Time) []string {
+	repo.tapLock.RLock()
+	taps := repo.taps[name]
+	repo.tapLock.RUnlock()
+	if len(taps) == 0 {
+		return nil
+	}
+
+	names := []string{}
+	for _, t := range taps {
+		if now.Before(t.until) {
+			names = append(names, t.queue)
+		} else {
+			repo.Tap(name, t.queue, time.Time{})
+		}
+	}
+	return names
+}
+
+func mirrorItem(q *queue.Queue, tq *queue.Queue, item *queue.Item) error {
+	_, err := copyItem(q, tq, item)
+	return err
+}
+
+// copyItem enqueues a copy of an item of q to tq and returns the copy
+func copyItem(q *queue.Queue, tq *queue.Queue, item *queue.Item) (*queue.Item, error) {
+	mirror := &queue.Item{Value: item.Value, Flags: item.Flags, Headers: item.Headers, ExpiresAt: item.ExpiresAt, MessageID: item.MessageID}
+	if item.Blob != nil {
+		w := tq.NewSizedBlobWriter(item.Blob.Size)
+		err := q.WriteBlob(item.Blob, w)
+		if err == nil {
+			err = w.Close()
+		}
+		if err != nil {
+			w.Abort()
+			return nil, err
+		}
+		mirror.Blob = w.Blob()
+	}
+	err := tq.EnqueueItem(mirror)
+	if err != nil {
+		tq.DeleteBlob(mirror.Blob)
+		return nil, err
+	}
+	return mirror, nil
+}
@@ -0,0 +1,35 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Tap(t *testing.T) {
+	repo, _ := Initialize(dir)
+	defer repo.DeleteAllQueues()
+
+	q, _ := repo.GetQueue("test")
+	q.Enqueue([]byte("1"))
+	q.Enqueue([]byte("2"))
+
+	assert.Nil(t, repo.Tap("test", "tap1", time.Now().Add(time.Hour)))
+	assert.Nil(t, repo.Tap("test", "tap2", time.Now().Add(-time.Second)))
+
+	item, _ := q.Dequeue()
+	repo.Mirror("test", q, item)
+
+	tap1, _ := repo.GetQueue("tap1")
+	tap2, _ := repo.GetQueue("tap2")
+	assert.Equal(t, uint64(1), tap1.Length())
+	assert.Equal(t, uint64(0), tap2.Length())
+	assert.Equal(t, []string{"tap1"}, repo.activeTaps("test", time.Now()))
+
+	assert.Nil(t, repo.Tap("test", "tap1", time.Time{}))
+	item, _ = q.Dequeue()
+	repo.Mirror("test", q, item)
+	assert.Equal(t, uint64(1), tap1.Length())
+	assert.Equal(t, 0, len(repo.taps))
+}
@@ -0,0 +1,173 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bogdanovich/siberite/config"
+)
+
+// tenantUsageTTL is how long measured usage of a tenant is reused,
+// so admitting a command doesn't walk every queue of the tenant
+const tenantUsageTTL = time.Second
+
+// Quota errors, see AdmitQueue and AdmitEnqueue
+var (
+	ErrQueueQuota   = errors.New("Queue quota exceeded")
+	ErrStorageQuota = errors.New("Storage quota exceeded")
+	ErrRateQuota    = errors.New("Enqueue rate quota exceeded")
+)
+
+// Tenant enforces quotas on queues owned by a group of identities
+type Tenant struct {
+	Name     string
+	config   *config.TenantConfig
+	rejected uint64
+
+	sync.Mutex
+	queues   int
+	bytes    int64
+	measured time.Time
+	tokens   float64
+	refilled time.Time
+}
+
+// newTenants creates tenants of auth config in name order
+func newTenants(cfg *config.AuthConfig) []*Tenant {
+	if cfg == nil {
+		return nil
+	}
+	tenants := []*Tenant{}
+	for name, tc := range cfg.Tenants {
+		tenants = append(tenants, &Tenant{Name: name, config: tc, tokens: tenantBurst(tc)})
+	}
+	sort.Slice(tenants, func(i, j int) bool { return tenants[i].Name < tenants[j].Name })
+	return tenants
+}
+
+// tenantBurst is a number of items enqueued at once before the rate
+// quota applies, one second worth of the rate
+func tenantBurst(tc *config.TenantConfig) float64 {
+	if tc.MaxEnqueueRate < 1 {
+		return 1
+	}
+	return tc.MaxEnqueueRate
+}
+
+// TenantOf returns a tenant of an identity, nil if it has none
+func (repo *QueueRepository) TenantOf(identity string) *Tenant {
+	for _, t := range repo.tenants {
+		if config.MatchAny(t.config.Identities, identity) {
+			return t
+		}
+	}
+	return nil
+}
+
+// Owns reports whether a queue counts against quotas of the tenant
+func (t *Tenant) Owns(name string) bool {
+	return config.MatchAny(t.config.Queues, name)
+}
+
+// AdmitQueue rejects a queue not open yet when the tenant owning it
+// has max_queues queues already, queue patterns are not checked
+func (repo *QueueRepository) AdmitQueue(t *Tenant, name string) error {
+	if t == nil || t.config.MaxQueues == 0 || strings.ContainsAny(name, "*?[") || !t.Owns(name) {
+		return nil
+	}
+	if _, ok := repo.Lookup(name); ok {
+		return nil
+	}
+	if queues, _ := repo.tenantUsage(t, time.Now()); queues >= t.config.MaxQueues {
+		return t.reject(ErrQueueQuota)
+	}
+	t.Lock()
+	// The queue is counted until usage is measured again
+	t.queues++
+	t.Unlock()
+	return nil
+}
+
+// AdmitEnqueue rejects n items enqueued to a queue when the tenant
+// owning it exceeds max_bytes or max_enqueue_rate
+func (repo *QueueRepository) AdmitEnqueue(t *Tenant, name string, n int) error {
+	if t == nil || !t.Owns(name) {
+		return nil
+	}
+	now := time.Now()
+	if t.config.MaxBytes > 0 {
+		if _, bytes := repo.tenantUsage(t, now); bytes >= t.config.MaxBytes {
+			return t.reject(ErrStorageQuota)
+		}
+	}
+	if t.config.MaxEnqueueRate > 0 && !t.take(float64(n), now) {
+		return t.reject(ErrRateQuota)
+	}
+	return nil
+}
+
+func (t *Tenant) reject(err error) error {
+	atomic.AddUint64(&t.rejected, 1)
+	return err
+}
+
+// take removes n tokens of the enqueue rate bucket refilled
+// at max_enqueue_rate per second
+func (t *Tenant) take(n float64, now time.Time) bool {
+	t.Lock()
+	defer t.Unlock()
+	burst := tenantBurst(t.config)
+	if !t.refilled.IsZero() {
+		t.tokens += now.Sub(t.refilled).Seconds() * t.config.MaxEnqueueRate
+		if t.tokens > burst {
+			t.tokens = burst
+		}
+	}
+	t.refilled = now
+	if t.tokens < n {
+		return false
+	}
+	t.tokens -= n
+	return true
+}
+
+// tenantUsage returns a number of open queues owned by a tenant
+// and their disk usage, measured at most once per tenantUsageTTL
+func (repo *QueueRepository) tenantUsage(t *Tenant, now time.Time) (int, int64) {
+	t.Lock()
+	defer t.Unlock()
+	if now.Sub(t.measured) < tenantUsageTTL {
+		return t.queues, t.bytes
+	}
+	t.queues, t.bytes = 0, 0
+	for _, q := range repo.queues() {
+		if !t.Owns(q.Name) {
+			continue
+		}
+		t.queues++
+		if usage, err := repo.diskUsage(q.Name); err == nil {
+			t.bytes += usage.bytes
+		}
+	}
+	t.measured = now
+	return t.queues, t.bytes
+}
+
+// tenantStats returns usage and rejected commands of each tenant
+func (repo *QueueRepository) tenantStats() []StatItem {
+	stats := []StatItem{}
+	for _, t := range repo.tenants {
+		queues, bytes := repo.tenantUsage(t, time.Now())
+		prefix := fmt.Sprintf("tenant_%s_", t.Name)
+		stats = append(stats,
+			StatItem{prefix + "queues", fmt.Sprintf("%d", queues)},
+			StatItem{prefix + "bytes", fmt.Sprintf("%d", bytes)},
+			StatItem{prefix + "rejected", fmt.Sprintf("%d", atomic.LoadUint64(&t.rejected))})
+	}
+	return stats
+}
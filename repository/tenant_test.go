@@ -0,0 +1,67 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bogdanovich/siberite/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Tenant(t *testing.T) {
+	cfg := config.Default()
+	cfg.Auth = &config.AuthConfig{
+		Providers: []*config.AuthProviderConfig{{Type: config.AuthToken, Tokens: map[string]string{"s3cret": "ci"}}},
+		Tenants: map[string]*config.TenantConfig{
+			"builds": {Identities: []string{"ci*"}, Queues: []string{"builds_*"}, MaxQueues: 2, MaxEnqueueRate: 2},
+			"zeta":   {Identities: []string{"*"}, Queues: []string{"zeta"}},
+		},
+	}
+	assert.Nil(t, cfg.Validate())
+	repo, err := InitializeWithConfig(dir, cfg)
+	assert.Nil(t, err)
+	defer repo.DeleteAllQueues()
+
+	tenant := repo.TenantOf("ci")
+	assert.Equal(t, "builds", tenant.Name)
+	assert.Equal(t, "zeta", repo.TenantOf("ops").Name)
+
+	assert.Nil(t, repo.AdmitQueue(tenant, "builds_1"))
+	repo.GetQueue("builds_1")
+	assert.Nil(t, repo.AdmitQueue(tenant, "builds_1"))
+	assert.Nil(t, repo.AdmitQueue(tenant, "builds_2"))
+	assert.Equal(t, ErrQueueQuota, repo.AdmitQueue(tenant, "builds_3"))
+	assert.Nil(t, repo.AdmitQueue(tenant, "other"))
+	assert.Nil(t, repo.AdmitQueue(tenant, "builds_*"))
+
+	assert.Nil(t, repo.AdmitEnqueue(tenant, "builds_1", 1))
+	assert.Nil(t, repo.AdmitEnqueue(tenant, "builds_1", 1))
+	assert.Equal(t, ErrRateQuota, repo.AdmitEnqueue(tenant, "builds_1", 1))
+	assert.Nil(t, repo.AdmitEnqueue(tenant, "other", 1))
+	assert.True(t, tenant.take(1, time.Now().Add(time.Second)))
+
+	stats := map[string]string{}
+	for _, item := range repo.FullStats() {
+		stats[item.Key] = item.Value
+	}
+	assert.Equal(t, "2", stats["tenant_builds_rejected"])
+	assert.Equal(t, "0", stats["tenant_zeta_queues"])
+}
+
+func Test_Tenant_Storage(t *testing.T) {
+	cfg := config.Default()
+	cfg.Auth = &config.AuthConfig{
+		Providers: []*config.AuthProviderConfig{{Type: config.AuthToken, Tokens: map[string]string{"s3cret": "ci"}}},
+		Tenants:   map[string]*config.TenantConfig{"builds": {Identities: []string{"ci"}, Queues: []string{"builds"}, MaxBytes: 1}},
+	}
+	repo, err := InitializeWithConfig(dir, cfg)
+	assert.Nil(t, err)
+	defer repo.DeleteAllQueues()
+
+	tenant := repo.TenantOf("ci")
+	assert.Nil(t, repo.AdmitEnqueue(tenant, "builds", 1))
+	repo.GetQueue("builds")
+	// Usage is measured again once tenantUsageTTL passes
+	tenant.measured = time.Time{}
+	assert.Equal(t, ErrStorageQuota, repo.AdmitEnqueue(tenant, "builds", 1))
+}
@@ -0,0 +1,206 @@
+package repository
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/bogdanovich/siberite/queue"
+)
+
+// Transaction journal is written to the data directory before queues
+// are changed and removed once every queue is written. Journals left
+// by a stopped server are replayed on startup, so a transaction is
+// either applied to all queues or to none of them.
+const journalExt = ".txn"
+
+var lastJournalID uint64
+
+var errInvalidJournal = errors.New("invalid transaction journal")
+
+// EnqueueAll appends items to a number of queues atomically
+func (repo *QueueRepository) EnqueueAll(items map[string][]*queue.Item) error {
+	names := make([]string, 0, len(items))
+	for name := range items {
+		names = append(names, name)
+	}
+	// Queues are locked in name order so concurrent transactions can't deadlock
+	sort.Strings(names)
+
+	queues := make([]*queue.Queue, len(names))
+	for i, name := range names {
+		q, err := repo.GetQueue(name)
+		if err != nil {
+			return err
+		}
+		queues[i] = q
+	}
+	for _, q := range queues {
+		q.Lock()
+		defer q.Unlock()
+	}
+
+	records := make([][]queue.Record, len(queues))
+	for i, q := range queues {
+		records[i] = q.PrepareRecords(items[names[i]])
+	}
+	journal, err := repo.writeJournal(names, records)
+	if err != nil {
+		return err
+	}
+	for i, q := range queues {
+		if err = q.WriteRecords(records[i]); err != nil {
+			for j := i - 1; j >= 0; j-- {
+				if queues[j].RemoveRecords(records[j]) != nil {
+					// journal completes the transaction on restart
+					return err
+				}
+			}
+			os.Remove(journal)
+			return err
+		}
+	}
+	if journal == "" {
+		return nil
+	}
+	if err = os.Remove(journal); err != nil {
+		log.Printf("Can't remove transaction journal %s: %s", journal, err.Error())
+	}
+	return nil
+}
+
+// writeJournal returns an empty path for in memory queues
+func (repo *QueueRepository) writeJournal(names []string, records [][]queue.Record) (string, error) {
+	if repo.inMemory {
+		return "", nil
+	}
+	id := atomic.AddUint64(&lastJournalID, 1)
+	path := filepath.Join(repo.DataPath, fmt.Sprintf("%d_%d%s", time.Now().UnixNano(), id, journalExt))
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+	for i, name := range names {
+		writeBytes(w, []byte(name))
+		writeUvarint(w, uint64(len(records[i])))
+		for _, record := range records[i] {
+			writeBytes(w, record.Key)
+			writeBytes(w, record.Value)
+		}
+	}
+	if err = w.Flush(); err == nil {
+		err = f.Sync()
+	}
+	if err != nil {
+		os.Remove(path)
+		return "", err
+	}
+	return path, nil
+}
+
+// replayJournals applies transactions interrupted by server stop
+func (repo *QueueRepository) replayJournals() error {
+	if repo.inMemory {
+		return nil
+	}
+	paths, err := filepath.Glob(filepath.Join(repo.DataPath, "*"+journalExt))
+	if err != nil {
+		return err
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		if err = repo.replayJournal(path); err != nil {
+			return fmt.Errorf("error replaying %s: %s", path, err.Error())
+		}
+		if err = os.Remove(path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (repo *QueueRepository) replayJournal(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	journal, err := readJournal(data)
+	if err != nil {
+		// journal is complete before any queue is written
+		log.Printf("discarding incomplete transaction journal %s", path)
+		return nil
+	}
+	for name, records := range journal {
+		q, err := repo.GetQueue(name)
+		if err != nil {
+			return err
+		}
+		if err = q.RestoreRecords(records); err != nil {
+			return err
+		}
+	}
+	log.Printf("replayed transaction journal %s", path)
+	return nil
+}
+
+func readJournal(data []byte) (map[string][]queue.Record, error) {
+	journal := map[string][]queue.Record{}
+	for len(data) > 0 {
+		name, err := readBytes(&data)
+		if err != nil {
+			return nil, err
+		}
+		count, n := binary.Uvarint(data)
+		if n <= 0 {
+			return nil, errInvalidJournal
+		}
+		data = data[n:]
+		records := []queue.Record{}
+		for i := uint64(0); i < count; i++ {
+			key, err := readBytes(&data)
+			if err != nil {
+				return nil, err
+			}
+			value, err := readBytes(&data)
+			if err != nil {
+				return nil, err
+			}
+			records = append(records, queue.Record{Key: key, Value: value})
+		}
+		journal[string(name)] = records
+	}
+	return journal, nil
+}
+
+func writeUvarint(w io.Writer, value uint64) {
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(buf[:], value)
+	w.Write(buf[:n])
+}
+
+func writeBytes(w io.Writer, data []byte) {
+	writeUvarint(w, uint64(len(data)))
+	w.Write(data)
+}
+
+func readBytes(data *[]byte) ([]byte, error) {
+	length, n := binary.Uvarint(*data)
+	if n <= 0 || uint64(len(*data)-n) < length {
+		return nil, errInvalidJournal
+	}
+	value := (*data)[n : n+int(length)]
+	*data = (*data)[n+int(length):]
+	return value, nil
+}
@@ -0,0 +1,73 @@
+package repository
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bogdanovich/siberite/queue"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_EnqueueAll(t *testing.T) {
+	repo, _ := Initialize(dir)
+	defer repo.DeleteAllQueues()
+
+	q1, _ := repo.GetQueue("test1")
+	q1.Enqueue([]byte("0"))
+
+	err := repo.EnqueueAll(map[string][]*queue.Item{
+		"test1": {{Value: []byte("1")}, {Value: []byte("2")}},
+		"test2": {{Value: []byte("3")}},
+	})
+	assert.Nil(t, err)
+
+	q2, _ := repo.GetQueue("test2")
+	assert.Equal(t, uint64(3), q1.Length())
+	assert.Equal(t, uint64(1), q2.Length())
+
+	journals, _ := filepath.Glob(filepath.Join(repo.DataPath, "*"+journalExt))
+	assert.Equal(t, 0, len(journals))
+
+	// Invalid queue name fails the whole transaction
+	err = repo.EnqueueAll(map[string][]*queue.Item{
+		"test1":    {{Value: []byte("4")}},
+		"invalid-": {{Value: []byte("5")}},
+	})
+	assert.NotNil(t, err)
+	assert.Equal(t, uint64(3), q1.Length())
+}
+
+func Test_replayJournals(t *testing.T) {
+	repo, _ := Initialize(dir)
+	q, _ := repo.GetQueue("test1")
+	q.Enqueue([]byte("0"))
+
+	// Journal of a transaction interrupted before queues were written
+	q.Lock()
+	records := q.PrepareRecords([]*queue.Item{{Value: []byte("1")}, {Value: []byte("2")}})
+	q.Unlock()
+	_, err := repo.writeJournal([]string{"test1"}, [][]queue.Record{records})
+	assert.Nil(t, err)
+
+	// Incomplete journal is discarded
+	incomplete := filepath.Join(repo.DataPath, "0_0"+journalExt)
+	f, _ := os.Create(incomplete)
+	f.Write([]byte{5, 't'})
+	f.Close()
+	repo.CloseAllQueues()
+
+	repo, err = Initialize(dir)
+	assert.Nil(t, err)
+	defer repo.DeleteAllQueues()
+
+	q, _ = repo.GetQueue("test1")
+	assert.Equal(t, uint64(3), q.Length())
+	for _, expected := range []string{"0", "1", "2"} {
+		item, _ := q.Dequeue()
+		assert.Equal(t, expected, string(item.Value))
+	}
+
+	journals, _ := filepath.Glob(filepath.Join(repo.DataPath, "*"+journalExt))
+	assert.Equal(t, 0, len(journals))
+}
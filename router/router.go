@@ -0,0 +1,421 @@
+// Package router implements a protocol compatible siberite proxy
+// that spreads queues across backend servers by consistent hashing
+// of queue names.
+//
+// Every client connection keeps its own connection to each backend
+// it used, so open reads stay tied to a client connection as usual
+// and are aborted by the backend when the client disconnects.
+package router
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bogdanovich/siberite/config"
+	"github.com/bogdanovich/siberite/errcode"
+	"github.com/bogdanovich/siberite/hashring"
+	"github.com/bogdanovich/siberite/peer"
+	"github.com/bogdanovich/siberite/protocol"
+)
+
+// Version represents router version
+const Version = "siberite-router-0.4.1"
+
+var dialTimeout = 5 * time.Second
+
+// backendTimeout limits a wait for every read from a backend,
+// so a stalled backend can't block a session and Stop
+var backendTimeout = 30 * time.Second
+
+// Router forwards client commands to backend servers
+type Router struct {
+	backends    []string
+	ring        *hashring.Ring
+	startTime   int64
+	connections uint64
+	ch          chan struct{}
+	wg          *sync.WaitGroup
+	dialer      *peer.Dialer
+}
+
+// New creates a router of given backend addresses
+func New(backends []string) *Router {
+	return &Router{
+		backends:  backends,
+		ring:      hashring.New(backends, hashring.DefaultReplicas),
+		startTime: time.Now().Unix(),
+		ch:        make(chan struct{}),
+		wg:        &sync.WaitGroup{},
+	}
+}
+
+// Open loads TLS and credentials backends are connected with,
+// backends are connected with plain TCP if it's not called
+func (r *Router) Open(cfg *config.PeerConfig) (err error) {
+	r.dialer, err = peer.NewDialer(cfg)
+	return err
+}
+
+// Backend returns a backend address of a queue
+func (r *Router) Backend(queueName string) string {
+	return r.ring.Get(queueName)
+}
+
+// Serve accepts client connections until Stop
+func (r *Router) Serve(listener *net.TCPListener) {
+	r.wg.Add(1)
+	defer r.wg.Done()
+	log.Println("routing to", strings.Join(r.backends, ", "))
+	for {
+		select {
+		case <-r.ch:
+			log.Println("stopping listening on", listener.Addr())
+			listener.Close()
+			return
+		default:
+		}
+		listener.SetDeadline(time.Now().Add(1e9))
+		conn, err := listener.AcceptTCP()
+		if err != nil {
+			if opErr, ok := err.(*net.OpError); ok && opErr.Timeout() {
+				continue
+			}
+			log.Println(err)
+			continue
+		}
+		r.wg.Add(1)
+		go r.handleConnection(conn)
+	}
+}
+
+// Stop stops accepting connections and waits for sessions to finish
+func (r *Router) Stop() {
+	log.Println("stopping router...")
+	close(r.ch)
+	r.wg.Wait()
+}
+
+func (r *Router) handleConnection(conn net.Conn) {
+	defer conn.Close()
+	defer r.wg.Done()
+	atomic.AddUint64(&r.connections, 1)
+
+	s := newSession(r, conn)
+	defer s.close()
+	for {
+		select {
+		case <-r.ch:
+			return
+		default:
+		}
+		conn.SetReadDeadline(time.Now().Add(1e9))
+		err := s.dispatch()
+		if opErr, ok := err.(*net.OpError); ok && opErr.Timeout() {
+			continue
+		}
+		if err != nil {
+			if err != io.EOF {
+				log.Println(conn.RemoteAddr(), err)
+			}
+			return
+		}
+	}
+}
+
+// session represents a client connection and its backend connections
+type session struct {
+	router   *Router
+	conn     net.Conn
+	client   *bufio.ReadWriter
+	backends map[string]*backend
+	// modes are session modes (EXTSET, EXTGET, ERRCODES) negotiated
+	// with every backend connection
+	modes map[string]bool
+	// wait extends backend read deadlines while a command waits
+	// on the backend, e.g. BARRIER with a timeout
+	wait time.Duration
+}
+
+// sessionModes lists session mode commands in negotiation order
+var sessionModes = []string{"extset", "extget", "errcodes"}
+
+type backend struct {
+	conn net.Conn
+	rw   *bufio.ReadWriter
+}
+
+// backendReader sets a read deadline of a backend connection before every read
+type backendReader struct {
+	s    *session
+	conn net.Conn
+}
+
+func (r backendReader) Read(p []byte) (int, error) {
+	r.conn.SetReadDeadline(time.Now().Add(backendTimeout + r.s.wait))
+	return r.conn.Read(p)
+}
+
+func newSession(r *Router, conn net.Conn) *session {
+	return &session{
+		router:   r,
+		conn:     conn,
+		client:   bufio.NewReadWriter(bufio.NewReader(conn), bufio.NewWriter(conn)),
+		backends: map[string]*backend{},
+		modes:    map[string]bool{},
+	}
+}
+
+func (s *session) close() {
+	for _, b := range s.backends {
+		b.conn.Close()
+	}
+}
+
+// dispatch reads a client command and forwards it
+func (s *session) dispatch() error {
+	line, err := s.client.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	s.conn.SetReadDeadline(time.Time{})
+	command := strings.Split(strings.Trim(line, " \r\n"), " ")
+	name := strings.ToLower(command[0])
+
+	switch name {
+	case "get", "gets", "delete", "flush", "drain", "tap", "requeue", "replay", "sample", "scheduled", "barrier", "migrate",
+		"close", "abort":
+		if len(command) < 2 {
+			return s.sendError("ERROR Invalid input")
+		}
+		if strings.ContainsAny(command[1], "*?[") {
+			return s.sendError("ERROR Queue patterns are not supported by router")
+		}
+		if name == "barrier" && len(command) == 3 {
+			if ms, convErr := strconv.Atoi(command[2]); convErr == nil && ms > 0 {
+				s.wait = time.Duration(ms) * time.Millisecond
+				defer func() { s.wait = 0 }()
+			}
+		}
+		err = s.forward(queueName(command[1]), line, 0)
+	case "set", "setmeta":
+		if len(command) < 5 {
+			return s.sendError("ERROR Invalid input")
+		}
+		size, convErr := strconv.Atoi(command[4])
+		if convErr != nil || size < 0 {
+			return s.sendError("ERROR Invalid <bytes> number")
+		}
+		err = s.forward(queueName(command[1]), line, size+2)
+	case "bset":
+		if len(command) < 5 {
+			return s.sendError("ERROR Invalid input")
+		}
+		size, convErr := strconv.Atoi(command[len(command)-1])
+		if convErr != nil || size < 0 {
+			return s.sendError("ERROR Invalid <bytes> number")
+		}
+		// Queues of other backends can't be written atomically
+		addr := s.router.Backend(queueName(command[1]))
+		for _, arg := range command[2 : len(command)-3] {
+			if s.router.Backend(queueName(arg)) != addr {
+				if _, err = io.CopyN(ioutil.Discard, s.client, int64(size+2)); err != nil {
+					return err
+				}
+				return s.sendError("CLIENT_ERROR Queues of BSET are on different backends")
+			}
+		}
+		err = s.forward(queueName(command[1]), line, size+2)
+	case "stats":
+		if len(command) == 3 && command[1] == "queue" {
+			err = s.forward(queueName(command[2]), line, 0)
+			break
+		}
+		if len(command) > 1 {
+			return s.sendError("ERROR Queue patterns are not supported by router")
+		}
+		err = s.stats()
+	case "flush_all":
+		err = s.broadcast(line)
+	case "version":
+		fmt.Fprintf(s.client, "VERSION %s\r\n", Version)
+	case "ping":
+		s.client.WriteString("PONG\r\n")
+	case "extset", "extget", "errcodes":
+		if len(command) != 2 || (strings.ToLower(command[1]) != "on" && strings.ToLower(command[1]) != "off") {
+			return s.sendError("ERROR Invalid input")
+		}
+		s.modes[name] = strings.ToLower(command[1]) == "on"
+		// Backend connections are reopened in the new mode
+		for addr := range s.backends {
+			s.drop(addr)
+		}
+		s.client.WriteString("END\r\n")
+	case "txn":
+		return s.sendError("ERROR Transactions are not supported by router")
+	default:
+		return s.sendError("ERROR Unknown command")
+	}
+	if flushErr := s.client.Flush(); err == nil {
+		err = flushErr
+	}
+	return err
+}
+
+func (s *session) sendError(message string) error {
+	if s.modes["errcodes"] {
+		fmt.Fprintf(s.client, "%s\r\n", errcode.Format(message))
+	} else {
+		fmt.Fprintf(s.client, "%s\r\n", message)
+	}
+	s.client.Flush()
+	return errors.New(message)
+}
+
+// queueName returns a queue a backend is chosen by, command options
+// are stripped, fanout children live on the backend of their parent
+// and partitions <queue>#<count>#<index> on the backend of <queue>#<count>
+func queueName(arg string) string {
+	name := protocol.ParseGet(arg).Queue
+	name = strings.SplitN(name, "+", 2)[0]
+	if strings.Count(name, "#") == 2 {
+		name = name[:strings.LastIndex(name, "#")]
+	}
+	return name
+}
+
+// forward sends a command line and dataSize bytes of payload to the backend
+// of a queue and relays the response
+func (s *session) forward(name string, line string, dataSize int) error {
+	addr := s.router.Backend(name)
+	b, err := s.backend(addr)
+	if err != nil {
+		return s.sendError("SERVER_ERROR Backend " + addr + " is unavailable")
+	}
+	b.rw.WriteString(line)
+	if dataSize > 0 {
+		if _, err = io.CopyN(b.rw, s.client, int64(dataSize)); err != nil {
+			s.drop(addr)
+			return err
+		}
+	}
+	if err = b.rw.Flush(); err != nil {
+		s.drop(addr)
+		return s.sendError("SERVER_ERROR Backend " + addr + " is unavailable")
+	}
+	if err = relay(b.rw.Reader, s.client.Writer); err != nil {
+		s.drop(addr)
+		// Timeouts of backend reads must not pass for client read timeouts
+		if _, ok := err.(net.Error); ok {
+			return s.sendError("SERVER_ERROR Backend " + addr + " is unavailable")
+		}
+	}
+	return err
+}
+
+// broadcast sends a single line command to every backend
+// and relays the last response when all of them succeeded
+func (s *session) broadcast(line string) error {
+	var response string
+	for _, addr := range s.router.backends {
+		b, err := s.backend(addr)
+		if err == nil {
+			b.rw.WriteString(line)
+			err = b.rw.Flush()
+		}
+		if err == nil {
+			response, err = b.rw.ReadString('\n')
+		}
+		if err != nil {
+			s.drop(addr)
+			return s.sendError("SERVER_ERROR Backend " + addr + " is unavailable")
+		}
+		if strings.HasPrefix(response, "ERROR") || strings.Contains(response, "_ERROR") {
+			s.drop(addr)
+			return s.sendError(strings.TrimSpace(response))
+		}
+	}
+	s.client.WriteString(response)
+	return nil
+}
+
+func (s *session) backend(addr string) (*backend, error) {
+	if b, ok := s.backends[addr]; ok {
+		return b, nil
+	}
+	conn, err := s.router.dialer.Dial(addr, dialTimeout)
+	if err != nil {
+		log.Printf("Can't connect to backend %s: %s", addr, err.Error())
+		return nil, err
+	}
+	b := &backend{conn: conn, rw: bufio.NewReadWriter(bufio.NewReader(backendReader{s, conn}), bufio.NewWriter(conn))}
+	for _, mode := range sessionModes {
+		if !s.modes[mode] {
+			continue
+		}
+		var response string
+		b.rw.WriteString(mode + " on\r\n")
+		if err = b.rw.Flush(); err == nil {
+			response, err = b.rw.ReadString('\n')
+		}
+		if err == nil && response != "END\r\n" {
+			err = errors.New(strings.TrimSpace(response))
+		}
+		if err != nil {
+			conn.Close()
+			log.Printf("Can't negotiate %s with backend %s: %s", mode, addr, err.Error())
+			return nil, err
+		}
+	}
+	s.backends[addr] = b
+	return b, nil
+}
+
+func (s *session) drop(addr string) {
+	if b, ok := s.backends[addr]; ok {
+		b.conn.Close()
+		delete(s.backends, addr)
+	}
+}
+
+// relay copies a backend response up to its final line,
+// backend closes a connection after an error response
+func relay(r *bufio.Reader, w *bufio.Writer) error {
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		w.WriteString(line)
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		switch fields[0] {
+		case "VALUE":
+			if len(fields) < 4 {
+				return errors.New("Invalid backend response " + strings.TrimSpace(line))
+			}
+			size, err := strconv.Atoi(fields[3])
+			if err != nil {
+				return err
+			}
+			if _, err = io.CopyN(w, r, int64(size)+2); err != nil {
+				return err
+			}
+		case "END", "STORED", "NOT_STORED", "QUEUED", "NOT_FOUND":
+			return nil
+		case "ERROR", "CLIENT_ERROR", "SERVER_ERROR":
+			return errors.New(strings.TrimSpace(line))
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package router
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bogdanovich/siberite/service"
+	"github.com/stretchr/testify/assert"
+)
+
+var dir = "./test_data"
+
+func TestMain(m *testing.M) {
+	result := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(result)
+}
+
+func listen(t *testing.T) *net.TCPListener {
+	listener, err := net.ListenTCP("tcp", &net.TCPAddr{IP: net.ParseIP("127.0.0.1")})
+	assert.Nil(t, err)
+	return listener
+}
+
+// startBackends starts siberite services with separate data directories
+func startBackends(t *testing.T, n int) ([]string, func()) {
+	addrs := []string{}
+	services := []*service.Service{}
+	for i := 0; i < n; i++ {
+		dataDir := fmt.Sprintf("%s/backend%d", dir, i)
+		assert.Nil(t, os.MkdirAll(dataDir, 0777))
+		s := service.New(dataDir)
+		listener := listen(t)
+		go s.Serve(listener)
+		addrs = append(addrs, listener.Addr().String())
+		services = append(services, s)
+	}
+	return addrs, func() {
+		for _, s := range services {
+			s.Stop()
+		}
+	}
+}
+
+func command(t *testing.T, rw *bufio.ReadWriter, cmd string, lines int) string {
+	rw.WriteString(cmd)
+	rw.Flush()
+	response := ""
+	for i := 0; i < lines; i++ {
+		line, err := rw.ReadString('\n')
+		assert.Nil(t, err)
+		response += line
+	}
+	return response
+}
+
+func Test_Router(t *testing.T) {
+	backends, stop := startBackends(t, 2)
+	defer stop()
+
+	r := New(backends)
+	listener := listen(t)
+	go r.Serve(listener)
+	defer r.Stop()
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	assert.Nil(t, err)
+	defer conn.Close()
+	rw := bufio.NewReadWriter(bufio.NewReader(conn), bufio.NewWriter(conn))
+
+	queues := []string{}
+	for i := 0; i < 20; i++ {
+		queues = append(queues, "queue"+strconv.Itoa(i))
+	}
+	used := map[string]bool{}
+	for _, q := range queues {
+		used[r.Backend(q)] = true
+		assert.Equal(t, "STORED\r\n", command(t, rw, "set "+q+" 0 0 6\r\nx\r\nEND\r\n", 1))
+	}
+	assert.Equal(t, 2, len(used), "queues should be spread across backends")
+
+	for _, q := range queues {
+		// Payload lines are not mistaken for the end of a response
+		assert.Equal(t, "VALUE "+q+" 0 6\r\nx\r\nEND\r\nEND\r\n", command(t, rw, "get "+q+"/open\r\n", 4))
+		assert.Equal(t, "END\r\n", command(t, rw, "get "+q+"/close\r\n", 1))
+	}
+
+	assert.Equal(t, "PONG\r\n", command(t, rw, "ping\r\n", 1))
+	assert.Equal(t, "VERSION "+Version+"\r\n", command(t, rw, "version\r\n", 1))
+
+	rw.WriteString("stats\r\n")
+	rw.Flush()
+	stats := map[string]string{}
+	for {
+		line, err := rw.ReadString('\n')
+		assert.Nil(t, err)
+		if line == "END\r\n" {
+			break
+		}
+		fields := strings.Fields(line)
+		stats[fields[1]] = fields[2]
+	}
+	assert.Equal(t, "2", stats["backends"])
+	assert.Equal(t, "20", stats["cmd_set"])
+	assert.Equal(t, "20", stats["cmd_get"])
+	assert.Equal(t, "0", stats["queue_queue0_items"])
+
+	// Extended SET responses are negotiated with backends
+	assert.Equal(t, "END\r\n", command(t, rw, "extset on\r\n", 1))
+	assert.Equal(t, "STORED 1\r\n", command(t, rw, "set queue0 0 0 1\r\n1\r\n", 1))
+	assert.Equal(t, "STORED 2\r\n", command(t, rw, "set queue0 0 0 1\r\n1\r\n", 1))
+	assert.Equal(t, "END\r\n", command(t, rw, "extset off\r\n", 1))
+	assert.Equal(t, "STORED\r\n", command(t, rw, "set queue0 0 0 1\r\n1\r\n", 1))
+	assert.Equal(t, "END\r\n", command(t, rw, "extget on\r\n", 1))
+	assert.Equal(t, "VALUE queue0 0 1\r\n1\r\nEND 2\r\n", command(t, rw, "get queue0\r\n", 3))
+	assert.Equal(t, "END\r\n", command(t, rw, "extget off\r\n", 1))
+
+	assert.Equal(t, "Flushed all queues.\r\n", command(t, rw, "flush_all\r\n", 1))
+
+	assert.Equal(t, "ERROR Transactions are not supported by router\r\n", command(t, rw, "txn begin\r\n", 1))
+
+	// Router and backend errors carry codes after ERRCODES,
+	// an error response closes a connection
+	for _, test := range []struct{ command, response string }{
+		{"get queue0/unknown\r\n", "ERROR 1003 Invalid command\r\n"},
+		{"txn begin\r\n", "ERROR 1012 Transactions are not supported by router\r\n"},
+	} {
+		conn, err := net.Dial("tcp", listener.Addr().String())
+		assert.Nil(t, err)
+		rw := bufio.NewReadWriter(bufio.NewReader(conn), bufio.NewWriter(conn))
+		assert.Equal(t, "END\r\n", command(t, rw, "errcodes on\r\n", 1))
+		assert.Equal(t, test.response, command(t, rw, test.command, 1))
+		conn.Close()
+	}
+}
+
+func Test_Router_StalledBackend(t *testing.T) {
+	// A backend that accepts connections and never answers
+	stalled := listen(t)
+	defer stalled.Close()
+	go func() {
+		for {
+			conn, err := stalled.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+	backendTimeout = 100 * time.Millisecond
+	defer func() { backendTimeout = 30 * time.Second }()
+
+	r := New([]string{stalled.Addr().String()})
+	listener := listen(t)
+	go r.Serve(listener)
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	assert.Nil(t, err)
+	defer conn.Close()
+	rw := bufio.NewReadWriter(bufio.NewReader(conn), bufio.NewWriter(conn))
+	assert.Equal(t, "SERVER_ERROR Backend "+stalled.Addr().String()+" is unavailable\r\n",
+		command(t, rw, "get work\r\n", 1))
+	r.Stop()
+}
@@ -0,0 +1,83 @@
+package router
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// stats collects STATS of every backend and merges them:
+// numbers are summed, latency percentiles and timestamps take the maximum,
+// uptime, time, version and connection counters are router's own
+func (s *session) stats() error {
+	keys := []string{}
+	values := map[string]string{}
+	for _, addr := range s.router.backends {
+		b, err := s.backend(addr)
+		if err == nil {
+			b.rw.WriteString("stats\r\n")
+			err = b.rw.Flush()
+		}
+		for err == nil {
+			var line string
+			if line, err = b.rw.ReadString('\n'); err != nil {
+				break
+			}
+			fields := strings.Fields(line)
+			if len(fields) == 1 && fields[0] == "END" {
+				break
+			}
+			if len(fields) != 3 || fields[0] != "STAT" {
+				err = fmt.Errorf("Invalid backend response %s", strings.TrimSpace(line))
+				break
+			}
+			key, value := fields[1], fields[2]
+			previous, ok := values[key]
+			if !ok {
+				keys = append(keys, key)
+			}
+			values[key] = mergeStat(key, previous, value)
+		}
+		if err != nil {
+			s.drop(addr)
+			return s.sendError("SERVER_ERROR Backend " + addr + " is unavailable")
+		}
+	}
+
+	now := time.Now().Unix()
+	fmt.Fprintf(s.client, "STAT uptime %d\r\n", now-s.router.startTime)
+	fmt.Fprintf(s.client, "STAT time %d\r\n", now)
+	fmt.Fprintf(s.client, "STAT version %s\r\n", Version)
+	fmt.Fprintf(s.client, "STAT backends %d\r\n", len(s.router.backends))
+	fmt.Fprintf(s.client, "STAT total_connections %d\r\n", atomic.LoadUint64(&s.router.connections))
+	for _, key := range keys {
+		switch key {
+		case "uptime", "time", "version", "total_connections":
+			continue
+		}
+		fmt.Fprintf(s.client, "STAT %s %s\r\n", key, values[key])
+	}
+	s.client.WriteString("END\r\n")
+	return nil
+}
+
+func mergeStat(key string, previous string, value string) string {
+	if previous == "" {
+		return value
+	}
+	a, errA := strconv.ParseInt(previous, 10, 64)
+	b, errB := strconv.ParseInt(value, 10, 64)
+	if errA != nil || errB != nil {
+		return previous
+	}
+	if strings.Contains(key, "_latency_") || strings.Contains(key, "_time_in_queue_") || strings.HasSuffix(key, "_age_ms") ||
+		strings.Contains(key, "_last_") {
+		if b > a {
+			a = b
+		}
+		return strconv.FormatInt(a, 10)
+	}
+	return strconv.FormatInt(a+b, 10)
+}
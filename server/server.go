@@ -0,0 +1,196 @@
+// Package server runs a siberite server in-process, so applications
+// can embed siberite for tests or single binary deployments:
+//
+//	s := server.New(server.Config{DataDir: "./data", Addr: "127.0.0.1:0"})
+//	if err := s.Listen(); err != nil {
+//		log.Fatalln(err)
+//	}
+//	go s.ListenAndServe()
+//	c := client.New(s.Addr().String())
+//	...
+//	s.Shutdown(context.Background())
+//
+// Settings with a router section run the server in router mode.
+package server
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+
+	"github.com/bogdanovich/siberite/config"
+	"github.com/bogdanovich/siberite/router"
+	"github.com/bogdanovich/siberite/service"
+)
+
+// DefaultAddr is used when Config.Addr is empty
+const DefaultAddr = "0.0.0.0:22133"
+
+// ErrServerClosed is returned by ListenAndServe after Shutdown
+var ErrServerClosed = errors.New("siberite: server closed")
+
+// Config represents embedded server settings
+type Config struct {
+	// DataDir is a path to data directory, not used in router mode
+	DataDir string
+	// InMemory keeps queues in memory only instead of DataDir
+	InMemory bool
+	// Addr is an ip and port to listen, port 0 picks a free port
+	Addr string
+	// HTTPAddr serves Prometheus metrics and probes, disabled if empty
+	HTTPAddr string
+	// Settings are configuration file settings, defaults if nil
+	Settings *config.Config
+}
+
+// Server represents an embedded siberite server
+type Server struct {
+	cfg      Config
+	service  *service.Service
+	router   *router.Router
+	listener *net.TCPListener
+	http     *http.Server
+	serving  bool
+	closed   bool
+	done     chan struct{}
+	sync.Mutex
+}
+
+// New creates a server, settings must be validated
+func New(cfg Config) *Server {
+	if cfg.Addr == "" {
+		cfg.Addr = DefaultAddr
+	}
+	if cfg.Settings == nil {
+		cfg.Settings = config.Default()
+	}
+	s := &Server{cfg: cfg, done: make(chan struct{})}
+	if cfg.Settings.Router != nil {
+		s.router = router.New(cfg.Settings.Router.Backends)
+	} else if cfg.InMemory {
+		s.service = service.NewInMemory(cfg.Settings)
+	} else {
+		s.service = service.NewWithConfig(cfg.DataDir, cfg.Settings)
+	}
+	return s
+}
+
+// Listen binds server address, ListenAndServe calls it if needed
+func (s *Server) Listen() error {
+	s.Lock()
+	defer s.Unlock()
+	if s.closed {
+		return ErrServerClosed
+	}
+	if s.listener != nil {
+		return nil
+	}
+	laddr, err := net.ResolveTCPAddr("tcp", s.cfg.Addr)
+	if err != nil {
+		return err
+	}
+	s.listener, err = net.ListenTCP("tcp", laddr)
+	if err != nil {
+		return err
+	}
+	log.Println("listening on", s.listener.Addr())
+	return nil
+}
+
+// Addr returns the listening address, nil before Listen
+func (s *Server) Addr() net.Addr {
+	s.Lock()
+	defer s.Unlock()
+	if s.listener == nil {
+		return nil
+	}
+	return s.listener.Addr()
+}
+
+// ListenAndServe opens queues and serves clients until Shutdown,
+// it returns ErrServerClosed after Shutdown
+func (s *Server) ListenAndServe() error {
+	if err := s.Listen(); err != nil {
+		return err
+	}
+	if s.service != nil {
+		if err := s.service.Open(); err != nil {
+			return err
+		}
+	} else if err := s.router.Open(s.cfg.Settings.Peer); err != nil {
+		return err
+	}
+
+	s.Lock()
+	if s.closed {
+		s.Unlock()
+		return ErrServerClosed
+	}
+	if s.serving {
+		s.Unlock()
+		return errors.New("siberite: server is already serving")
+	}
+	if s.cfg.HTTPAddr != "" && s.service != nil {
+		httpListener, err := net.Listen("tcp", s.cfg.HTTPAddr)
+		if err != nil {
+			s.Unlock()
+			return err
+		}
+		log.Println("http listening on", httpListener.Addr())
+		s.http = &http.Server{Handler: s.service.HTTPHandler()}
+		go s.http.Serve(httpListener)
+	}
+	s.serving = true
+	s.Unlock()
+
+	if s.router != nil {
+		s.router.Serve(s.listener)
+	} else {
+		s.service.Serve(s.listener)
+	}
+	<-s.done
+	return ErrServerClosed
+}
+
+// Shutdown stops accepting clients, waits for connected clients
+// to finish their commands and closes queues. If ctx is done first,
+// Shutdown returns its error and shutdown goes on in background.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.Lock()
+	if s.closed {
+		s.Unlock()
+		return ErrServerClosed
+	}
+	s.closed = true
+	serving := s.serving
+	s.Unlock()
+
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		defer close(s.done)
+		if s.http != nil {
+			s.http.Shutdown(ctx)
+		}
+		if !serving {
+			if s.listener != nil {
+				s.listener.Close()
+			}
+			return
+		}
+		if s.router != nil {
+			s.router.Stop()
+		} else {
+			s.service.Stop()
+		}
+	}()
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,52 @@
+package server
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/bogdanovich/siberite/client"
+	"github.com/stretchr/testify/assert"
+)
+
+var dir = "./test_data"
+
+func TestMain(m *testing.M) {
+	result := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(result)
+}
+
+func Test_Server(t *testing.T) {
+	s := New(Config{DataDir: dir, Addr: "127.0.0.1:0"})
+	assert.Nil(t, s.Addr())
+	assert.Nil(t, s.Listen())
+	served := make(chan error, 1)
+	go func() { served <- s.ListenAndServe() }()
+
+	c := client.New(s.Addr().String())
+	assert.Nil(t, c.Set("work", []byte("1")))
+	c.Close()
+
+	assert.Nil(t, s.Shutdown(context.Background()))
+	assert.Equal(t, ErrServerClosed, <-served)
+	assert.Equal(t, ErrServerClosed, s.Shutdown(context.Background()))
+
+	// Queues are closed on shutdown, so a new server opens the same data directory
+	s = New(Config{DataDir: dir, Addr: "127.0.0.1:0"})
+	assert.Nil(t, s.Listen())
+	go s.ListenAndServe()
+	defer s.Shutdown(context.Background())
+
+	c = client.New(s.Addr().String())
+	defer c.Close()
+	value, err := c.Get("work")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("1"), value)
+}
+
+func Test_ServerInvalidDataDir(t *testing.T) {
+	s := New(Config{DataDir: "server_test.go/data", Addr: "127.0.0.1:0"})
+	assert.NotNil(t, s.ListenAndServe())
+	assert.Nil(t, s.Shutdown(context.Background()))
+}
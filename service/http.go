@@ -0,0 +1,68 @@
+package service
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sync/atomic"
+)
+
+// HTTPHandler returns a handler serving Prometheus metrics at /metrics,
+// liveness probe at /healthz and readiness probe at /readyz
+func (s *Service) HTTPHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", s.metrics)
+	mux.HandleFunc("/healthz", s.healthz)
+	mux.HandleFunc("/readyz", s.readyz)
+	return mux
+}
+
+func (s *Service) healthz(w http.ResponseWriter, r *http.Request) {
+	fmt.Fprint(w, "ok\n")
+}
+
+// readyz reports whether the service accepts clients: all queues are opened,
+// data directory is writable, load is below configured thresholds
+// and the service is not stopping
+func (s *Service) readyz(w http.ResponseWriter, r *http.Request) {
+	if err := s.ready(); err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	fmt.Fprint(w, "ok\n")
+}
+
+func (s *Service) ready() error {
+	if atomic.LoadInt32(&s.stopping) == 1 {
+		return fmt.Errorf("stopping")
+	}
+	repo := s.repository()
+	if repo == nil {
+		return fmt.Errorf("initializing")
+	}
+	if !repo.InMemory() {
+		f, err := ioutil.TempFile(repo.DataPath, ".readyz")
+		if err != nil {
+			return fmt.Errorf("data directory is not writable: %s", err.Error())
+		}
+		f.Close()
+		os.Remove(f.Name())
+	}
+
+	maxConnections := s.config.ConnectionLimit()
+	if connections := atomic.LoadUint64(&repo.Stats.CurrentConnections); maxConnections > 0 && connections >= maxConnections {
+		return fmt.Errorf("too many connections: %d", connections)
+	}
+	return nil
+}
+
+func (s *Service) metrics(w http.ResponseWriter, r *http.Request) {
+	repo := s.repository()
+	if repo == nil {
+		http.Error(w, "initializing", http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	repo.WritePrometheus(w)
+}
@@ -0,0 +1,58 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bogdanovich/siberite/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_HTTPHandler_Metrics(t *testing.T) {
+	s := New(dir)
+	handler := s.HTTPHandler()
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+
+	s.repo, err = repository.Initialize(dir)
+	assert.Nil(t, err)
+	defer s.repo.CloseAllQueues()
+
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.True(t, strings.Contains(recorder.Body.String(), "siberite_connections 0\n"))
+}
+
+func Test_HTTPHandler_Probes(t *testing.T) {
+	s := New(dir)
+	s.config.MaxConnections = 1
+	handler := s.HTTPHandler()
+
+	get := func(path string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest("GET", path, nil))
+		return recorder
+	}
+
+	assert.Equal(t, http.StatusOK, get("/healthz").Code)
+	assert.Equal(t, http.StatusServiceUnavailable, get("/readyz").Code)
+	assert.Equal(t, "initializing\n", get("/readyz").Body.String())
+
+	s.repo, err = repository.Initialize(dir)
+	assert.Nil(t, err)
+	defer s.repo.CloseAllQueues()
+	assert.Equal(t, http.StatusOK, get("/readyz").Code)
+
+	s.repo.Stats.CurrentConnections = 1
+	assert.Equal(t, "too many connections: 1\n", get("/readyz").Body.String())
+	s.repo.Stats.CurrentConnections = 0
+
+	s.stopping = 1
+	assert.Equal(t, http.StatusServiceUnavailable, get("/readyz").Code)
+	assert.Equal(t, http.StatusOK, get("/healthz").Code)
+}
@@ -1,28 +1,48 @@
 package service
 
 import (
+	"crypto/tls"
 	"log"
 	"net"
+	"runtime/debug"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/bogdanovich/siberite/config"
 	"github.com/bogdanovich/siberite/controller"
 	"github.com/bogdanovich/siberite/repository"
 )
 
+// acceptRetryDelay slows down accepting after listener errors
+const acceptRetryDelay = 10 * time.Millisecond
+
 // Service represents a siberite tcp server
 type Service struct {
 	dataDir string
+	config  *config.Config
 	repo    *repository.QueueRepository
 	ch      chan struct{}
 	wg      *sync.WaitGroup
+	mu      sync.RWMutex
+	// stopping is set once graceful shutdown starts
+	stopping int32
+	// inMemory keeps queues in memory only, see NewInMemory
+	inMemory bool
+	// tls is set when clients connect with TLS
+	tls *tls.Config
 }
 
 // New creates a new service
 func New(dataDir string) *Service {
+	return NewWithConfig(dataDir, config.Default())
+}
+
+// NewWithConfig creates a new service with a given configuration
+func NewWithConfig(dataDir string, cfg *config.Config) *Service {
 	s := &Service{
 		dataDir: dataDir,
-		repo:    &repository.QueueRepository{},
+		config:  cfg,
 		ch:      make(chan struct{}),
 		wg:      &sync.WaitGroup{},
 	}
@@ -30,15 +50,50 @@ func New(dataDir string) *Service {
 	return s
 }
 
+// NewInMemory creates a service keeping queues in memory only
+func NewInMemory(cfg *config.Config) *Service {
+	s := NewWithConfig("", cfg)
+	s.inMemory = true
+	return s
+}
+
+// Open initializes queue repository unless it is initialized already,
+// Serve opens it on start
+func (s *Service) Open() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.repo != nil {
+		return nil
+	}
+	log.Println("initializing...")
+	tlsConfig, err := loadTLS(s.config.TLS)
+	if err != nil {
+		return err
+	}
+	var repo *repository.QueueRepository
+	if s.inMemory {
+		repo, err = repository.InitializeInMemory(s.config)
+		log.Println("keeping queues in memory")
+	} else {
+		repo, err = repository.InitializeWithConfig(s.dataDir, s.config)
+		log.Println("data directory: ", s.dataDir)
+	}
+	if err != nil {
+		if repo != nil {
+			repo.CloseAllQueues()
+		}
+		return err
+	}
+	s.repo = repo
+	s.tls = tlsConfig
+	return nil
+}
+
 // Serve starts the service
 func (s *Service) Serve(listener *net.TCPListener) {
 	defer s.wg.Done()
 
-	log.Println("initializing...")
-	var err error
-	s.repo, err = repository.Initialize(s.dataDir)
-	log.Println("data directory: ", s.dataDir)
-	if err != nil {
+	if err := s.Open(); err != nil {
 		log.Fatal(err)
 	}
 
@@ -50,31 +105,75 @@ func (s *Service) Serve(listener *net.TCPListener) {
 			return
 		default:
 		}
-		listener.SetDeadline(time.Now().Add(1e9))
-		conn, err := listener.AcceptTCP()
-		if nil != err {
-			if opErr, ok := err.(*net.OpError); ok && opErr.Timeout() {
-				continue
-			}
-			log.Println(err)
+		s.accept(listener)
+	}
+}
+
+// accept accepts a client connection and starts its session,
+// a panic is recovered so the listener keeps accepting
+func (s *Service) accept(listener *net.TCPListener) {
+	defer s.recoverPanic("listener")
+	listener.SetDeadline(time.Now().Add(1e9))
+	conn, err := listener.AcceptTCP()
+	if nil != err {
+		if opErr, ok := err.(*net.OpError); ok && opErr.Timeout() {
+			return
 		}
-		s.wg.Add(1)
-		go s.handleConnection(conn)
+		log.Println(err)
+		// Persistent errors, e.g. out of file descriptors, are retried at a slower pace
+		time.Sleep(acceptRetryDelay)
+		return
 	}
+	s.wg.Add(1)
+	go s.handleConnection(conn)
 }
 
-// Stop service
+// recoverPanic logs a recovered panic with its stack trace and counts it in stats
+func (s *Service) recoverPanic(source interface{}) {
+	r := recover()
+	if r == nil {
+		return
+	}
+	log.Printf("panic in %v: %v\n%s", source, r, debug.Stack())
+	if repo := s.repository(); repo != nil {
+		atomic.AddUint64(&repo.Stats.Panics, 1)
+	}
+}
+
+// Stop service, waits for connections to finish and closes queues
 func (s *Service) Stop() {
 	log.Println("stopping service and finishing work...")
+	atomic.StoreInt32(&s.stopping, 1)
 	close(s.ch)
 	s.wg.Wait()
+	if repo := s.repository(); repo != nil {
+		repo.CloseAllQueues()
+	}
 }
 
+// handleConnection serves a client session. A panic in the session is
+// recovered after the session is finished, so its transaction is aborted
+// and open items are returned, other sessions keep running.
 func (s *Service) handleConnection(conn *net.TCPConn) {
 	defer conn.Close()
 	defer s.wg.Done()
+	defer s.recoverPanic(conn.RemoteAddr())
+
+	if keepAlive := s.config.KeepAlive(); keepAlive > 0 {
+		conn.SetKeepAlive(true)
+		conn.SetKeepAlivePeriod(keepAlive)
+	} else {
+		conn.SetKeepAlive(false)
+	}
+	if network := s.config.Network; network != nil {
+		setSocketOptions(conn, network)
+	}
 
-	controller := controller.NewSession(conn, s.repo)
+	var session controller.Conn = conn
+	if s.tls != nil {
+		session = tls.Server(conn, s.tls)
+	}
+	controller := controller.NewSession(session, s.repo)
 	defer controller.FinishSession()
 
 	for {
@@ -97,6 +196,31 @@ func (s *Service) handleConnection(conn *net.TCPConn) {
 	}
 }
 
+// setSocketOptions applies network settings to a client connection,
+// socket buffer sizes are hints the operating system may adjust
+func setSocketOptions(conn *net.TCPConn, network *config.NetworkConfig) {
+	if err := conn.SetNoDelay(network.NoDelay()); err != nil {
+		log.Println(conn.RemoteAddr(), err)
+	}
+	if network.SocketReadBuffer > 0 {
+		if err := conn.SetReadBuffer(network.SocketReadBuffer); err != nil {
+			log.Println(conn.RemoteAddr(), err)
+		}
+	}
+	if network.SocketWriteBuffer > 0 {
+		if err := conn.SetWriteBuffer(network.SocketWriteBuffer); err != nil {
+			log.Println(conn.RemoteAddr(), err)
+		}
+	}
+}
+
+// repository returns initialized queue repository or nil
+func (s *Service) repository() *repository.QueueRepository {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.repo
+}
+
 // Version returns siberite version
 func (s *Service) Version() string {
 	return repository.Version
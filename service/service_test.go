@@ -3,11 +3,15 @@ package service
 import (
 	"bufio"
 	"fmt"
+	"io/ioutil"
 	"log"
 	"net"
 	"os"
+	"sync/atomic"
 	"testing"
 
+	"github.com/bogdanovich/siberite/config"
+	"github.com/bogdanovich/siberite/controller"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -46,3 +50,77 @@ func Test_StartGetVersionAndStop(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Equal(t, fmt.Sprintf("VERSION %s\r\n", s.Version()), answer)
 }
+
+func Test_NetworkSettings(t *testing.T) {
+	noDelay := false
+	cfg := config.Default()
+	cfg.Network = &config.NetworkConfig{ReadBuffer: 512, TCPNoDelay: &noDelay,
+		SocketReadBuffer: 65536, SocketWriteBuffer: 65536}
+	assert.Nil(t, cfg.Validate())
+	dataDir, err := ioutil.TempDir("", "siberite")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dataDir)
+	s := NewWithConfig(dataDir, cfg)
+	listener, err := net.ListenTCP("tcp", &net.TCPAddr{IP: net.ParseIP("127.0.0.1")})
+	assert.Nil(t, err)
+	go s.Serve(listener)
+	defer s.Stop()
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	assert.Nil(t, err)
+	defer conn.Close()
+	// A value larger than the read buffer is read in parts
+	value := make([]byte, 2048)
+	for i := range value {
+		value[i] = 'x'
+	}
+	fmt.Fprintf(conn, "set work 0 0 %d\r\n%s\r\nget work\r\n", len(value), value)
+	r := bufio.NewReader(conn)
+	answer, err := r.ReadString('\n')
+	assert.Nil(t, err)
+	assert.Equal(t, "STORED\r\n", answer)
+	answer, err = r.ReadString('\n')
+	assert.Nil(t, err)
+	assert.Equal(t, "VALUE work 0 2048\r\n", answer)
+}
+
+func Test_SessionPanic(t *testing.T) {
+	controller.Use(func(cmd *controller.Command, next controller.Handler) error {
+		if cmd.QueueName == "panic" {
+			panic("test panic")
+		}
+		return next(cmd)
+	})
+	dataDir, err := ioutil.TempDir("", "siberite")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dataDir)
+	s := New(dataDir)
+	listener, err := net.ListenTCP("tcp", &net.TCPAddr{IP: net.ParseIP("127.0.0.1")})
+	assert.Nil(t, err)
+	go s.Serve(listener)
+	defer s.Stop()
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	assert.Nil(t, err)
+	r := bufio.NewReader(conn)
+	fmt.Fprintf(conn, "txn begin\r\nset work 0 0 1\r\nx\r\n")
+	for _, expected := range []string{"END\r\n", "QUEUED\r\n"} {
+		answer, err := r.ReadString('\n')
+		assert.Nil(t, err)
+		assert.Equal(t, expected, answer)
+	}
+	fmt.Fprintf(conn, "get panic\r\n")
+	_, err = r.ReadString('\n')
+	assert.NotNil(t, err)
+	conn.Close()
+
+	// The server keeps running, the staged item is discarded
+	conn, err = net.Dial("tcp", listener.Addr().String())
+	assert.Nil(t, err)
+	defer conn.Close()
+	fmt.Fprintf(conn, "get work\r\n")
+	answer, err := bufio.NewReader(conn).ReadString('\n')
+	assert.Nil(t, err)
+	assert.Equal(t, "END\r\n", answer)
+	assert.Equal(t, uint64(1), atomic.LoadUint64(&s.repository().Stats.Panics))
+}
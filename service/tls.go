@@ -0,0 +1,38 @@
+package service
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/bogdanovich/siberite/config"
+)
+
+// loadTLS returns server TLS settings, nil if TLS is not configured.
+// Client certificates are verified when given, so clients
+// without one can still authenticate with AUTH command.
+func loadTLS(cfg *config.TLSConfig) (*tls.Config, error) {
+	if cfg == nil {
+		return nil, nil
+	}
+	cert, err := tls.LoadX509KeyPair(cfg.Cert, cfg.Key)
+	if err != nil {
+		return nil, fmt.Errorf("error loading tls certificate: %s", err.Error())
+	}
+	tlsConfig := &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	if cfg.ClientCA != "" {
+		pem, err := ioutil.ReadFile(cfg.ClientCA)
+		if err != nil {
+			return nil, fmt.Errorf("error loading tls client_ca: %s", err.Error())
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New("error loading tls client_ca: no certificates found")
+		}
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	return tlsConfig, nil
+}
@@ -0,0 +1,105 @@
+package service
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bogdanovich/siberite/config"
+	"github.com/stretchr/testify/assert"
+)
+
+// issue creates a certificate signed by parent, self-signed if parent is nil
+func issue(t *testing.T, name string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage = x509.KeyUsageCertSign
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	assert.Nil(t, err)
+	cert, err := x509.ParseCertificate(der)
+	assert.Nil(t, err)
+	return cert, key
+}
+
+func writePEM(t *testing.T, path string, cert *x509.Certificate, key *ecdsa.PrivateKey) {
+	var data []byte
+	if cert != nil {
+		data = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+	} else {
+		der, err := x509.MarshalECPrivateKey(key)
+		assert.Nil(t, err)
+		data = pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+	}
+	assert.Nil(t, ioutil.WriteFile(path, data, 0600))
+}
+
+func Test_TLS_MutualAuth(t *testing.T) {
+	certDir, err := ioutil.TempDir("", "siberite_tls")
+	assert.Nil(t, err)
+	defer os.RemoveAll(certDir)
+	ca, caKey := issue(t, "siberite-ca", nil, nil)
+	server, serverKey := issue(t, "siberite", ca, caKey)
+	client, clientKey := issue(t, "worker-1", ca, caKey)
+	writePEM(t, filepath.Join(certDir, "ca.pem"), ca, nil)
+	writePEM(t, filepath.Join(certDir, "server.pem"), server, nil)
+	writePEM(t, filepath.Join(certDir, "server.key"), nil, serverKey)
+
+	cfg := config.Default()
+	cfg.TLS = &config.TLSConfig{Cert: filepath.Join(certDir, "server.pem"),
+		Key: filepath.Join(certDir, "server.key"), ClientCA: filepath.Join(certDir, "ca.pem")}
+	cfg.Auth = &config.AuthConfig{Providers: []*config.AuthProviderConfig{{Type: config.AuthMTLS}}}
+	assert.Nil(t, cfg.Validate())
+	dataDir, err := ioutil.TempDir("", "siberite")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dataDir)
+	s := NewWithConfig(dataDir, cfg)
+	listener, err := net.ListenTCP("tcp", &net.TCPAddr{IP: net.ParseIP("127.0.0.1")})
+	assert.Nil(t, err)
+	go s.Serve(listener)
+	defer s.Stop()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+	clientCert := tls.Certificate{Certificate: [][]byte{client.Raw}, PrivateKey: clientKey}
+	for _, test := range []struct {
+		certs    []tls.Certificate
+		expected string
+	}{
+		{[]tls.Certificate{clientCert}, "END\r\n"},
+		{nil, "CLIENT_ERROR Authentication required\r\n"},
+	} {
+		conn, err := tls.Dial("tcp", listener.Addr().String(), &tls.Config{RootCAs: roots, Certificates: test.certs})
+		assert.Nil(t, err)
+		fmt.Fprintf(conn, "get work\r\n")
+		answer, err := bufio.NewReader(conn).ReadString('\n')
+		assert.Nil(t, err)
+		assert.Equal(t, test.expected, answer)
+		conn.Close()
+	}
+}
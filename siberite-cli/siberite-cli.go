@@ -0,0 +1,94 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/bogdanovich/siberite/client"
+	"github.com/bogdanovich/siberite/inspect"
+)
+
+var (
+	server     = flag.String("server", "127.0.0.1:22133", "ip and port of siberite server")
+	decode     = flag.String("decode", "auto", "payload decoder: "+strings.Join(inspect.Names(), ", "))
+	descriptor = flag.String("descriptor", "", "protobuf FileDescriptorSet file used by protobuf decoder")
+	message    = flag.String("message", "", "fully qualified protobuf message type of payloads")
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: siberite-cli [flags] peek <queue> [<count>]\n\nFlags:\n")
+	flag.PrintDefaults()
+	os.Exit(2)
+}
+
+func main() {
+	log.SetFlags(0)
+	flag.Usage = usage
+	flag.Parse()
+	args := flag.Args()
+	if len(args) < 2 || len(args) > 3 || args[0] != "peek" {
+		usage()
+	}
+	count := 1
+	if len(args) == 3 {
+		var err error
+		if count, err = strconv.Atoi(args[2]); err != nil || count < 1 {
+			usage()
+		}
+	}
+
+	decoder, err := newDecoder()
+	if err != nil {
+		log.Fatalln(err)
+	}
+	c := client.New(*server)
+	defer c.Close()
+	if err = peek(c, decoder, args[1], count); err != nil {
+		log.Fatalln(err)
+	}
+}
+
+func newDecoder() (inspect.Decoder, error) {
+	if *descriptor != "" {
+		*decode = "protobuf"
+		data, err := ioutil.ReadFile(*descriptor)
+		if err != nil {
+			return nil, err
+		}
+		return inspect.NewProtobuf(data, *message)
+	}
+	decoder, ok := inspect.Lookup(*decode)
+	if !ok {
+		return nil, fmt.Errorf("unknown decoder %q", *decode)
+	}
+	return decoder, nil
+}
+
+// peek prints up to count items from the queue head
+func peek(c *client.Client, decoder inspect.Decoder, queue string, count int) error {
+	for i := 0; i < count; i++ {
+		value, err := c.Peek(queue, i)
+		if err != nil {
+			return err
+		}
+		if value == nil {
+			if i == 0 {
+				fmt.Println("(empty)")
+			}
+			return nil
+		}
+		text, err := decoder.Decode(value)
+		if err != nil {
+			// Payloads the decoder doesn't understand are shown raw
+			text, _ = inspect.Raw(value)
+			text = fmt.Sprintf("(%s: %s)\n%s", *decode, err.Error(), text)
+		}
+		fmt.Printf("--- %s #%d (%d bytes)\n%s\n", queue, i, len(value), text)
+	}
+	return nil
+}
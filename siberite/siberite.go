@@ -1,52 +1,101 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
-	"net"
 	"os"
 	"os/signal"
 	"runtime"
 	"syscall"
 
-	service "github.com/bogdanovich/siberite/service"
+	"github.com/bogdanovich/siberite/config"
+	"github.com/bogdanovich/siberite/repository"
+	"github.com/bogdanovich/siberite/server"
 )
 
 var (
 	dataDir     = flag.String("data", "./data", "path to data directory")
+	configFile  = flag.String("config", "", "path to configuration file")
 	hostAndPort = flag.String("listen", "0.0.0.0:22133", "ip and port to listen")
+	httpAddr    = flag.String("http", "", "ip and port to serve prometheus metrics (disabled if empty)")
 	versionFlag = flag.Bool("version", false, "prints current version")
+	checkFlag   = flag.Bool("check", false, "checks queues integrity and exits")
+	repairFlag  = flag.Bool("repair", false, "repairs queue offsets found broken by -check")
 )
 
 func main() {
 	flag.Parse()
 	runtime.GOMAXPROCS(runtime.NumCPU())
 
-	service := service.New(*dataDir)
+	cfg := config.Default()
+	if *configFile != "" {
+		var err error
+		if cfg, err = config.Load(*configFile); err != nil {
+			log.Fatalln(err)
+		}
+	}
+
+	if *checkFlag {
+		os.Exit(check(cfg))
+	}
 
 	if *versionFlag {
-		fmt.Println(service.Version())
+		fmt.Println(repository.Version)
 		os.Exit(0)
 	}
 
-	laddr, err := net.ResolveTCPAddr("tcp", *hostAndPort)
-	if nil != err {
+	s := server.New(server.Config{DataDir: *dataDir, Addr: *hostAndPort, HTTPAddr: *httpAddr, Settings: cfg})
+	if err := s.Listen(); err != nil {
 		log.Fatalln(err)
 	}
-	listener, err := net.ListenTCP("tcp", laddr)
-	if nil != err {
-		log.Fatalln(err)
-	}
-	log.Println("listening on", listener.Addr())
-
-	go service.Serve(listener)
+	go func() {
+		if err := s.ListenAndServe(); err != server.ErrServerClosed {
+			log.Fatalln(err)
+		}
+	}()
 
 	// Handle SIGINT and SIGTERM.
-	ch := make(chan os.Signal)
+	ch := make(chan os.Signal, 1)
 	signal.Notify(ch, syscall.SIGINT, syscall.SIGTERM)
 	log.Println(<-ch)
 
-	// Stop the service gracefully.
-	service.Stop()
+	// Stop the server gracefully.
+	s.Shutdown(context.Background())
+}
+
+// check reports queue anomalies, exit status is 1 if any are left unrepaired
+// or items can't be decoded
+func check(cfg *config.Config) int {
+	repo, err := repository.OpenWithConfig(*dataDir, cfg)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	defer repo.CloseAllQueues()
+
+	reports, err := repo.Check(*repairFlag)
+	if err != nil {
+		log.Println(err)
+		return 1
+	}
+	status := 0
+	for _, r := range reports {
+		state := "ok"
+		if r.Repaired {
+			state = "repaired"
+		} else if !r.OK() {
+			state = "broken"
+		}
+		// Items that can't be decoded are never repaired
+		if state == "broken" || r.InvalidRecords > 0 {
+			status = 1
+		}
+		fmt.Printf("%s: %s, head %d, tail %d, items %d, gaps %d, invalid keys %d, invalid records %d\n",
+			r.Queue, state, r.Head, r.Tail, r.Items, len(r.Gaps), r.InvalidKeys, r.InvalidRecords)
+		for _, gap := range r.Gaps {
+			fmt.Printf("%s: missing offsets %d-%d\n", r.Queue, gap.From, gap.To)
+		}
+	}
+	return status
 }
@@ -0,0 +1,159 @@
+// Package siberitetest runs siberite servers in-process for integration
+// tests of applications using siberite, no external process is needed:
+//
+//	func TestWorker(t *testing.T) {
+//		s := siberitetest.Start(t, siberitetest.Options{InMemory: true})
+//		defer s.Stop()
+//		s.Seed("work", "job1", "job2")
+//		runWorker(s.Addr())
+//		s.AssertQueue("work")
+//		s.AssertQueue("done", "job1", "job2")
+//	}
+//
+// Servers listen on a free local port and keep queues in a temporary
+// data directory removed by Stop, or in memory.
+package siberitetest
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/bogdanovich/siberite/client"
+	"github.com/bogdanovich/siberite/config"
+	"github.com/bogdanovich/siberite/server"
+)
+
+// Options are test server settings
+type Options struct {
+	// InMemory keeps queues in memory instead of a temporary data directory
+	InMemory bool
+	// Settings are configuration file settings, defaults if nil
+	Settings *config.Config
+}
+
+// Server is a siberite server started by a test
+type Server struct {
+	t       testing.TB
+	opts    Options
+	dataDir string
+	server  *server.Server
+	served  chan error
+	client  *client.Client
+}
+
+// Start starts a server, the test fails if it can't be started
+func Start(t testing.TB, opts Options) *Server {
+	t.Helper()
+	s := &Server{t: t, opts: opts}
+	if !opts.InMemory {
+		dataDir, err := ioutil.TempDir("", "siberitetest")
+		if err != nil {
+			t.Fatalf("siberitetest: can't create data directory: %s", err)
+		}
+		s.dataDir = dataDir
+	}
+	s.start("127.0.0.1:0")
+	return s
+}
+
+func (s *Server) start(addr string) {
+	s.t.Helper()
+	s.server = server.New(server.Config{
+		DataDir:  s.dataDir,
+		InMemory: s.opts.InMemory,
+		Addr:     addr,
+		Settings: s.opts.Settings,
+	})
+	if err := s.server.Listen(); err != nil {
+		s.t.Fatalf("siberitetest: can't listen: %s", err)
+	}
+	s.served = make(chan error, 1)
+	go func() { s.served <- s.server.ListenAndServe() }()
+	s.client = client.New(s.Addr())
+	// Queues are opened before the first command is served
+	if err := s.client.Ping("siberitetest"); err != nil {
+		s.t.Fatalf("siberitetest: server is not responding: %s", err)
+	}
+}
+
+// Addr returns host:port the server listens on
+func (s *Server) Addr() string {
+	return s.server.Addr().String()
+}
+
+// Client returns a client of the server shared by helpers
+func (s *Server) Client() *client.Client {
+	return s.client
+}
+
+// Restart stops the server and starts it again on the same address,
+// items of a server with a data directory are kept
+func (s *Server) Restart() {
+	s.t.Helper()
+	addr := s.Addr()
+	s.shutdown()
+	s.start(addr)
+}
+
+// Stop stops the server and removes its data directory
+func (s *Server) Stop() {
+	s.t.Helper()
+	s.shutdown()
+	if s.dataDir != "" {
+		os.RemoveAll(s.dataDir)
+	}
+}
+
+func (s *Server) shutdown() {
+	s.t.Helper()
+	s.client.Close()
+	if err := s.server.Shutdown(context.Background()); err != nil {
+		s.t.Errorf("siberitetest: shutdown failed: %s", err)
+	}
+	if err := <-s.served; err != server.ErrServerClosed {
+		s.t.Errorf("siberitetest: server failed: %s", err)
+	}
+}
+
+// Seed enqueues values to a queue in order
+func (s *Server) Seed(queue string, values ...string) {
+	s.t.Helper()
+	for _, value := range values {
+		if err := s.client.Set(queue, []byte(value)); err != nil {
+			s.t.Fatalf("siberitetest: can't seed %s: %s", queue, err)
+		}
+	}
+}
+
+// Items returns values of a queue from head to tail without removing them
+func (s *Server) Items(queue string) []string {
+	s.t.Helper()
+	items := []string{}
+	for i := 0; ; i++ {
+		value, err := s.client.Peek(queue, i)
+		if err != nil {
+			s.t.Fatalf("siberitetest: can't read %s: %s", queue, err)
+		}
+		if value == nil {
+			return items
+		}
+		items = append(items, string(value))
+	}
+}
+
+// AssertQueue fails the test unless a queue holds exactly given values in order
+func (s *Server) AssertQueue(queue string, values ...string) bool {
+	s.t.Helper()
+	if values == nil {
+		values = []string{}
+	}
+	items := s.Items(queue)
+	if !reflect.DeepEqual(items, values) {
+		s.t.Errorf("siberitetest: queue %s holds %q, expected %q", queue, items, values)
+		return false
+	}
+	return true
+}
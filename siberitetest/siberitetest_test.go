@@ -0,0 +1,35 @@
+package siberitetest
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Server(t *testing.T) {
+	s := Start(t, Options{})
+	dataDir := s.dataDir
+
+	s.Seed("work", "1", "2")
+	assert.True(t, s.AssertQueue("work", "1", "2"))
+	value, err := s.Client().Get("work")
+	assert.Nil(t, err)
+	assert.Equal(t, "1", string(value))
+
+	s.Restart()
+	assert.True(t, s.AssertQueue("work", "2"))
+	assert.True(t, s.AssertQueue("empty"))
+
+	s.Stop()
+	_, err = os.Stat(dataDir)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func Test_ServerInMemory(t *testing.T) {
+	s := Start(t, Options{InMemory: true})
+	s.Seed("work", "1")
+	s.Restart()
+	assert.True(t, s.AssertQueue("work"))
+	s.Stop()
+}
@@ -0,0 +1,65 @@
+// Package otel adapts OpenTelemetry tracers to siberite tracing hooks.
+//
+//	trace.SetTracer(otel.New(otelapi.GetTracerProvider()))
+package otel
+
+import (
+	"context"
+
+	"github.com/bogdanovich/siberite/trace"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "github.com/bogdanovich/siberite"
+
+// Tracer creates siberite spans backed by OpenTelemetry spans
+type Tracer struct {
+	tracer     oteltrace.Tracer
+	propagator propagation.TraceContext
+}
+
+// New creates a tracer using a given tracer provider
+func New(provider oteltrace.TracerProvider) *Tracer {
+	return &Tracer{tracer: provider.Tracer(instrumentationName)}
+}
+
+// Start begins a new OpenTelemetry span
+func (t *Tracer) Start(name string, parent trace.Span, remote string) trace.Span {
+	ctx := context.Background()
+	if remote != "" {
+		carrier := propagation.MapCarrier{trace.TraceParentHeader: remote}
+		ctx = t.propagator.Extract(ctx, carrier)
+	} else if p, ok := parent.(*span); ok {
+		ctx = p.ctx
+	}
+	ctx, s := t.tracer.Start(ctx, name)
+	return &span{ctx: ctx, span: s, propagator: t.propagator}
+}
+
+type span struct {
+	ctx        context.Context
+	span       oteltrace.Span
+	propagator propagation.TraceContext
+}
+
+func (s *span) SetAttribute(key string, value string) {
+	s.span.SetAttributes(attribute.String(key, value))
+}
+
+func (s *span) SetError(err error) {
+	s.span.RecordError(err)
+	s.span.SetStatus(codes.Error, err.Error())
+}
+
+func (s *span) TraceParent() string {
+	carrier := propagation.MapCarrier{}
+	s.propagator.Inject(s.ctx, carrier)
+	return carrier.Get(trace.TraceParentHeader)
+}
+
+func (s *span) End() {
+	s.span.End()
+}
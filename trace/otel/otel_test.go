@@ -0,0 +1,44 @@
+package otel
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+var traceParent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+func Test_Start(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	tracer := New(provider)
+
+	root := tracer.Start("siberite.command", nil, "")
+	child := tracer.Start("siberite.dequeue", root, "")
+	child.SetAttribute("queue", "work")
+	child.End()
+	root.End()
+
+	remote := tracer.Start("siberite.enqueue", root, traceParent)
+	remote.SetError(errors.New("failed"))
+	remote.End()
+
+	spans := recorder.Ended()
+	assert.Equal(t, 3, len(spans))
+
+	assert.Equal(t, "siberite.dequeue", spans[0].Name())
+	assert.Equal(t, spans[1].SpanContext().SpanID(), spans[0].Parent().SpanID())
+	assert.Equal(t, "queue", string(spans[0].Attributes()[0].Key))
+
+	assert.Equal(t, "siberite.enqueue", spans[2].Name())
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", spans[2].SpanContext().TraceID().String())
+	assert.Equal(t, "00f067aa0ba902b7", spans[2].Parent().SpanID().String())
+	assert.Equal(t, "failed", spans[2].Status().Description)
+
+	assert.True(t, strings.HasPrefix(remote.TraceParent(), "00-4bf92f3577b34da6a3ce929d0e0e4736-"))
+	assert.NotEqual(t, traceParent, remote.TraceParent())
+}
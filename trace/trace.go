@@ -0,0 +1,69 @@
+// Package trace provides tracing hooks for siberite.
+// Spans are discarded unless a Tracer is registered with SetTracer,
+// see trace/otel for OpenTelemetry integration.
+package trace
+
+import "sync/atomic"
+
+// TraceParentHeader is an item header that carries W3C trace context
+// from producers to consumers
+const TraceParentHeader = "traceparent"
+
+// Tracer starts new spans
+type Tracer interface {
+	// Start begins a new span. Remote is a W3C traceparent received
+	// from a client and takes precedence over a local parent span.
+	// Both parent and remote may be empty.
+	Start(name string, parent Span, remote string) Span
+}
+
+// Span represents a single traced operation
+type Span interface {
+	SetAttribute(key string, value string)
+	SetError(err error)
+	// TraceParent returns span context in W3C traceparent format
+	TraceParent() string
+	End()
+}
+
+type tracerHolder struct {
+	tracer Tracer
+}
+
+var current atomic.Value
+
+func init() {
+	current.Store(tracerHolder{noopTracer{}})
+}
+
+// SetTracer registers a tracer used for all new spans,
+// nil restores default no-op tracer
+func SetTracer(tracer Tracer) {
+	if tracer == nil {
+		tracer = noopTracer{}
+	}
+	current.Store(tracerHolder{tracer})
+}
+
+// Start begins a new span using registered tracer
+func Start(name string, parent Span, remote string) Span {
+	return current.Load().(tracerHolder).tracer.Start(name, parent, remote)
+}
+
+type noopTracer struct{}
+
+// Start returns a span that only passes remote trace context through,
+// so producers and consumers stay connected without a registered tracer
+func (noopTracer) Start(name string, parent Span, remote string) Span {
+	if remote == "" && parent != nil {
+		remote = parent.TraceParent()
+	}
+	return noopSpan(remote)
+}
+
+type noopSpan string
+
+func (noopSpan) SetAttribute(key string, value string) {}
+func (noopSpan) SetError(err error)                    {}
+func (s noopSpan) TraceParent() string                 { return string(s) }
+func (noopSpan) End()                                  {}
@@ -0,0 +1,44 @@
+package trace
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var traceParent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+type mockTracer struct {
+	started []string
+}
+
+func (t *mockTracer) Start(name string, parent Span, remote string) Span {
+	t.started = append(t.started, name)
+	return noopSpan(remote)
+}
+
+func Test_Start_Noop(t *testing.T) {
+	span := Start("test", nil, "")
+	assert.Equal(t, "", span.TraceParent())
+	span.End()
+
+	span = Start("test", nil, traceParent)
+	assert.Equal(t, traceParent, span.TraceParent())
+
+	child := Start("child", span, "")
+	assert.Equal(t, traceParent, child.TraceParent())
+}
+
+func Test_SetTracer(t *testing.T) {
+	tracer := &mockTracer{}
+	SetTracer(tracer)
+	defer SetTracer(nil)
+
+	Start("one", nil, "")
+	Start("two", nil, "")
+	assert.Equal(t, []string{"one", "two"}, tracer.started)
+
+	SetTracer(nil)
+	Start("three", nil, "")
+	assert.Equal(t, []string{"one", "two"}, tracer.started)
+}